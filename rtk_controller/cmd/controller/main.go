@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"syscall"
 	"time"
 
@@ -20,9 +22,9 @@ import (
 	"rtk_controller/internal/logging"
 	"rtk_controller/internal/mcp"
 	"rtk_controller/internal/mqtt"
-	"rtk_controller/internal/qos"
 	"rtk_controller/internal/schema"
 	"rtk_controller/internal/storage"
+	"rtk_controller/internal/tenancy"
 	"rtk_controller/internal/topology"
 	"rtk_controller/internal/workflow"
 
@@ -42,6 +44,9 @@ func main() {
 		mcpHost    = flag.String("mcp-host", "localhost", "MCP server host")
 		mcpPort    = flag.Int("mcp-port", 8080, "MCP server port")
 		version    = flag.Bool("version", false, "Show version information")
+
+		migrateTo   = flag.String("migrate-storage", "", "Copy all keys from the configured storage backend to this backend and exit")
+		migratePath = flag.String("migrate-path", "", "Data directory of the migration target (default: storage.path)")
 	)
 	flag.Parse()
 
@@ -71,27 +76,33 @@ func main() {
 		perfLogger.Close()
 	}()
 
+	// Copy storage to another backend and exit
+	if *migrateTo != "" {
+		runStorageMigration(cfg.Storage, *migrateTo, *migratePath)
+		return
+	}
+
 	// If MCP mode is specified, run MCP server
 	if *mcpMode {
-		runMCPServer(cfg, *mcpHost, *mcpPort)
+		runMCPServer(cfg, auditLogger, *mcpHost, *mcpPort)
 		return
 	}
 
 	// If CLI mode is specified, run interactive CLI
 	if *cliMode {
 		// Initialize storage for CLI
-		buntStorage, err := storage.NewBuntDB(cfg.Storage.Path)
+		dataStorage, err := storage.Open(cfg.Storage.Backend, cfg.Storage.Path)
 		if err != nil {
 			log.Fatalf("Failed to initialize storage: %v", err)
 		}
-		defer buntStorage.Close()
+		defer dataStorage.Close()
 
 		// Initialize topology and identity storage
-		topologyStorage := storage.NewTopologyStorage(buntStorage)
-		identityStorage := storage.NewIdentityStorage(buntStorage)
+		topologyStorage := storage.NewTopologyStorage(dataStorage)
+		identityStorage := storage.NewIdentityStorage(dataStorage)
 
 		// Initialize MQTT client for CLI
-		mqttClient, err := mqtt.NewClient(cfg.MQTT, buntStorage)
+		mqttClient, err := mqtt.NewClient(commandSessionConfig(cfg.MQTT, "cli"), dataStorage)
 		if err != nil {
 			log.Fatalf("Failed to create MQTT client: %v", err)
 		}
@@ -106,10 +117,8 @@ func main() {
 		}
 		identityManager := identity.NewManager(identityStorage, identityConfig)
 
-		// Initialize topology manager
+		// Initialize the site registry; per-site topology managers use this template
 		topologyConfig := topology.ManagerConfig{
-			Tenant:                     "default", // TODO: Get from config
-			Site:                       "default", // TODO: Get from config
 			TopologyUpdateInterval:     30 * time.Second,
 			MetricsUpdateInterval:      1 * time.Minute,
 			CleanupInterval:            5 * time.Minute,
@@ -123,24 +132,39 @@ func main() {
 			// TODO: Add discovery config when fields are available
 			DiscoveryConfig: topology.DiscoveryConfig{},
 		}
-		topologyManager, err := topology.NewManager(topologyStorage, identityStorage, identityManager, topologyConfig)
+		siteRegistry := tenancy.NewRegistry(siteConfigFrom(cfg.Sites), topologyStorage, identityStorage, identityManager, topologyConfig)
+		topologyManager, err := siteRegistry.TopologyManager("", "")
 		if err != nil {
 			log.Fatalf("Failed to create topology manager: %v", err)
 		}
 
 		// Initialize core services for CLI
-		deviceManager := device.NewManager(buntStorage)
-		commandManager := command.NewManager(mqttClient, buntStorage)
-		diagnosisManager := diagnosis.NewManager(cfg.Diagnosis, buntStorage)
+		deviceManager := device.NewManager(dataStorage)
+		siteRegistry.SetSiteDirectory(deviceManager)
+		eventProcessor := device.NewEventProcessor(dataStorage)
+		commandManager := command.NewManager(mqttClient, dataStorage)
+		if err := commandManager.ApplyConfig(cfg.Commands); err != nil {
+			log.Fatalf("Invalid commands configuration: %v", err)
+		}
+		commandManager.SetDeviceDirectory(deviceManager)
+		commandManager.SetGroupDirectory(identityManager)
+		diagnosisManager := diagnosis.NewManager(cfg.Diagnosis, dataStorage)
 
 		// Initialize QoS manager for LLM tools
-		qosManager := qos.NewQoSManager(nil) // Use default config
+		qosManager, err := siteRegistry.QoSManager("", "")
+		if err != nil {
+			log.Fatalf("Failed to create QoS manager: %v", err)
+		}
 
 		// Initialize changeset manager
-		changesetManager := changeset.NewSimpleManager(buntStorage, commandManager)
+		changesetManager := changeset.NewSimpleManager(dataStorage, commandManager)
+		changesetManager.SetHealthSources(deviceManager, nil)
+		changesetManager.SetAuditLogger(auditLogger)
+		changesetManager.SetRolloutControl(mqttClient, rolloutControlTopic(cfg.Sites))
 
 		// Initialize LLM tool engine
-		llmToolEngine := llm.NewToolEngine(buntStorage, commandManager, topologyManager, qosManager)
+		llmToolEngine := llm.NewToolEngine(dataStorage, commandManager, topologyManager, qosManager)
+		llmToolEngine.SetSiteManagers(siteRegistry)
 		if err := llmToolEngine.Start(context.Background()); err != nil {
 			log.Fatalf("Failed to start LLM tool engine: %v", err)
 		}
@@ -153,7 +177,7 @@ func main() {
 			ConfidenceThreshold:    0.7,
 			FallbackWorkflow:       "general_network_diagnosis",
 		}
-		workflowEngine, err := workflow.NewWorkflowEngine(llmToolEngine, buntStorage, workflowConfig)
+		workflowEngine, err := workflow.NewWorkflowEngine(llmToolEngine, dataStorage, workflowConfig)
 		if err != nil {
 			log.Fatalf("Failed to create workflow engine: %v", err)
 		}
@@ -177,12 +201,53 @@ func main() {
 			log.Fatalf("Failed to start changeset manager: %v", err)
 		}
 
+		// Schema validation and processing targets for replaying dead letters
+		schemaManager, err := schema.NewManager(schemaConfigFrom(cfg.Schema), dataStorage)
+		if err != nil {
+			log.Fatalf("Failed to create schema manager: %v", err)
+		}
+		if err := schemaManager.Initialize(); err != nil {
+			log.Fatalf("Failed to initialize schema manager: %v", err)
+		}
+		defer schemaManager.Stop()
+		mqttClient.SetDeviceManager(deviceManager)
+		mqttClient.SetEventProcessor(eventProcessor)
+		mqttClient.SetSchemaValidator(mqtt.NewSchemaValidatorAdapter(schemaManager))
+		mqttClient.SetStrictValidation(cfg.Schema.StrictValidation)
+		if err := mqttClient.GetDeadLetterStore().ApplyConfig(cfg.Schema); err != nil {
+			log.Fatalf("Failed to configure dead letters: %v", err)
+		}
+
+		// Storage snapshots, compaction and restore on demand; scheduled
+		// backups only run in service mode
+		backupConfig, err := backupConfigFrom(cfg.Storage)
+		if err != nil {
+			log.Fatalf("Invalid storage configuration: %v", err)
+		}
+		backupManager, err := storage.NewBackupManager(dataStorage, backupConfig)
+		if err != nil {
+			log.Fatalf("Failed to create backup manager: %v", err)
+		}
+
+		// Follow the results of commands, changesets and rollouts sent from the CLI
+		if err := startCommandSession(context.Background(), mqttClient, commandManager); err != nil {
+			log.Warnf("Commands cannot reach devices: %v", err)
+		}
+
 		// Create and start interactive CLI with topology support
-		interactiveCLI := cli.NewInteractiveCLI(cfg, mqttClient, buntStorage, deviceManager, commandManager, diagnosisManager)
+		interactiveCLI := cli.NewInteractiveCLI(cfg, mqttClient, dataStorage, deviceManager, commandManager, diagnosisManager)
 		interactiveCLI.SetTopologyManager(topologyManager)
 		interactiveCLI.SetIdentityManager(identityManager)
 		interactiveCLI.SetChangesetManager(changesetManager)
+		interactiveCLI.SetSchemaManager(schemaManager)
+		interactiveCLI.SetSiteRegistry(siteRegistry)
+		interactiveCLI.SetBackupManager(backupManager)
 		interactiveCLI.Start()
+
+		// Pending commands are already stored; a restore must not get them back
+		if mqttClient.IsConnected() {
+			mqttClient.Disconnect()
+		}
 		return
 	}
 
@@ -194,58 +259,77 @@ func main() {
 	defer cancel()
 
 	// Initialize storage
-	buntStorage, err := storage.NewBuntDB(cfg.Storage.Path)
+	dataStorage, err := storage.Open(cfg.Storage.Backend, cfg.Storage.Path)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
-	defer buntStorage.Close()
+	defer dataStorage.Close()
 
-	// Initialize schema manager
-	schemaConfig := schema.Config{
-		Enabled:             cfg.Schema.Enabled,
-		SchemaFiles:         cfg.Schema.SchemaFiles,
-		StrictValidation:    cfg.Schema.StrictValidation,
-		LogValidationErrors: cfg.Schema.LogValidationErrors,
-		CacheResults:        cfg.Schema.CacheResults,
-		CacheSize:           cfg.Schema.CacheSize,
-		StoreResults:        cfg.Schema.StoreResults,
-	}
-	schemaManager, err := schema.NewManager(schemaConfig, buntStorage)
+	// Keep CLI restores from swapping the storage under this process
+	dataLock, err := storage.LockData(cfg.Storage.Path)
 	if err != nil {
-		log.Fatalf("Failed to create schema manager: %v", err)
+		log.Fatalf("Failed to lock storage: %v", err)
 	}
+	defer dataLock.Release()
 
-	if err := schemaManager.Initialize(); err != nil {
-		log.Fatalf("Failed to initialize schema manager: %v", err)
+	// Initialize storage backups and compaction
+	backupConfig, err := backupConfigFrom(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Invalid storage configuration: %v", err)
+	}
+	backupManager, err := storage.NewBackupManager(dataStorage, backupConfig)
+	if err != nil {
+		log.Fatalf("Failed to create backup manager: %v", err)
 	}
 
-	// Initialize MQTT client
-	mqttClient, err := mqtt.NewClient(cfg.MQTT, buntStorage)
+	// Initialize MQTT client; the service also takes rollout control
+	// requests from CLI and MCP processes
+	serviceMQTT := cfg.MQTT
+	serviceMQTT.Topics.Subscribe = append(slices.Clone(cfg.MQTT.Topics.Subscribe), rolloutControlTopic(cfg.Sites))
+	mqttClient, err := mqtt.NewClient(serviceMQTT, dataStorage)
 	if err != nil {
 		log.Fatalf("Failed to create MQTT client: %v", err)
 	}
 
-	// Initialize core services
-	deviceManager := device.NewManager(buntStorage)
-	eventProcessor := device.NewEventProcessor(buntStorage)
-	commandManager := command.NewManager(mqttClient, buntStorage)
-	diagnosisManager := diagnosis.NewManager(cfg.Diagnosis, buntStorage)
-
-	// Initialize QoS manager for LLM tools
-	qosManager := qos.NewQoSManager(nil) // Use default config
+	// Initialize schema manager; the alert handler is set first so that
+	// schema files failing to load at startup are alerted on too
+	schemaManager, err := schema.NewManager(schemaConfigFrom(cfg.Schema), dataStorage)
+	if err != nil {
+		log.Fatalf("Failed to create schema manager: %v", err)
+	}
+	publishSchemaAlert := schemaAlertPublisher(mqttClient, cfg.MQTT.ClientID)
+	schemaManager.SetAlertHandler(publishSchemaAlert)
 
-	// Initialize changeset manager
-	changesetManager := changeset.NewSimpleManager(buntStorage, commandManager)
+	if err := schemaManager.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize schema manager: %v", err)
+	}
 
-	// Initialize topology manager for service mode
+	// Initialize core services
+	deviceManager := device.NewManager(dataStorage)
+	eventProcessor := device.NewEventProcessor(dataStorage)
+	commandManager := command.NewManager(mqttClient, dataStorage)
+	if err := commandManager.ApplyConfig(cfg.Commands); err != nil {
+		log.Fatalf("Invalid commands configuration: %v", err)
+	}
+	diagnosisManager := diagnosis.NewManager(cfg.Diagnosis, dataStorage)
+
+	// Initialize changeset manager; the quality source of rollout health
+	// gates is set once the site's topology manager exists
+	changesetManager := changeset.NewSimpleManager(dataStorage, commandManager)
+	changesetManager.SetHealthSources(deviceManager, nil)
+	changesetManager.SetAuditLogger(auditLogger)
+	// Only the service runs schedules and recovers interrupted changesets
+	changesetManager.EnableScheduler()
+	mqttClient.RegisterHandler(rolloutControlTopic(cfg.Sites), changeset.NewRolloutControlHandler(changesetManager))
+
+	// Initialize the site registry for service mode; per-site topology
+	// managers use this template
 	topologyConfig := topology.ManagerConfig{
-		Tenant:                 "default", // TODO: Get from config
-		Site:                   "default", // TODO: Get from config
 		TopologyUpdateInterval: 30 * time.Second,
 		MetricsUpdateInterval:  1 * time.Minute,
 	}
-	topologyStorage := storage.NewTopologyStorage(buntStorage)
-	identityStorage := storage.NewIdentityStorage(buntStorage)
+	topologyStorage := storage.NewTopologyStorage(dataStorage)
+	identityStorage := storage.NewIdentityStorage(dataStorage)
 	identityConfig := identity.ManagerConfig{
 		EnableAutoDiscovery:  true,
 		EnableFingerprinting: true,
@@ -254,13 +338,56 @@ func main() {
 		CleanupInterval:      1 * time.Hour,
 	}
 	identityManager := identity.NewManager(identityStorage, identityConfig)
-	topologyManager, err := topology.NewManager(topologyStorage, identityStorage, identityManager, topologyConfig)
+	siteRegistry := tenancy.NewRegistry(siteConfigFrom(cfg.Sites), topologyStorage, identityStorage, identityManager, topologyConfig)
+	siteRegistry.SetSiteDirectory(deviceManager)
+	topologyManager, err := siteRegistry.TopologyManager("", "")
 	if err != nil {
 		log.Fatalf("Failed to create topology manager: %v", err)
 	}
 
+	// Initialize QoS manager for LLM tools
+	qosManager, err := siteRegistry.QoSManager("", "")
+	if err != nil {
+		log.Fatalf("Failed to create QoS manager: %v", err)
+	}
+
+	// Monitor connection quality of the default site for rollout health gates
+	qualityMonitor := topology.NewConnectionQualityMonitor(topologyManager,
+		topology.NewConnectionHistoryTracker(topologyStorage, identityStorage, topology.ConnectionHistoryConfig{}),
+		topology.NewWiFiClientCollector(topologyStorage, identityStorage, topology.WiFiCollectorConfig{}),
+		nil, topologyStorage, identityStorage, topology.DefaultQualityMonitorConfig())
+	if err := qualityMonitor.Start(); err != nil {
+		log.Fatalf("Failed to start connection quality monitor: %v", err)
+	}
+	changesetManager.SetHealthSources(deviceManager, qualityMonitor)
+
+	// Deliver real-time topology events of the default site
+	var topologyUpdater *topology.RealtimeTopologyUpdater
+	if cfg.TopologyEvents.Enabled {
+		topologyUpdater, err = startTopologyUpdater(cfg.TopologyEvents, topologyManager, topologyStorage, mqttClient)
+		if err != nil {
+			log.Fatalf("Failed to start topology event delivery: %v", err)
+		}
+	}
+
+	// Raise topology alerts of the default site and notify the configured routes
+	alertingSystem := topology.NewTopologyAlertingSystem(topologyManager, qualityMonitor, nil, nil, nil,
+		topologyStorage, identityStorage, topology.DefaultAlertingConfig())
+	if err := alertingSystem.ApplyConfig(cfg.Alerting); err != nil {
+		log.Fatalf("Invalid alerting configuration: %v", err)
+	}
+	alertingSystem.SetNotificationPublisher(mqttClient)
+	if err := alertingSystem.Start(); err != nil {
+		log.Fatalf("Failed to start topology alerting: %v", err)
+	}
+
+	// Resolve group command members through the device registry and device groups/tags
+	commandManager.SetDeviceDirectory(deviceManager)
+	commandManager.SetGroupDirectory(identityManager)
+
 	// Initialize LLM tool engine
-	llmToolEngine := llm.NewToolEngine(buntStorage, commandManager, topologyManager, qosManager)
+	llmToolEngine := llm.NewToolEngine(dataStorage, commandManager, topologyManager, qosManager)
+	llmToolEngine.SetSiteManagers(siteRegistry)
 	if err := llmToolEngine.Start(ctx); err != nil {
 		log.Fatalf("Failed to start LLM tool engine: %v", err)
 	}
@@ -273,7 +400,7 @@ func main() {
 		ConfidenceThreshold:    0.7,
 		FallbackWorkflow:       "general_network_diagnosis",
 	}
-	workflowEngine, err := workflow.NewWorkflowEngine(llmToolEngine, buntStorage, workflowConfig)
+	workflowEngine, err := workflow.NewWorkflowEngine(llmToolEngine, dataStorage, workflowConfig)
 	if err != nil {
 		log.Fatalf("Failed to create workflow engine: %v", err)
 	}
@@ -304,6 +431,10 @@ func main() {
 	// Create schema validator adapter for MQTT client
 	schemaAdapter := mqtt.NewSchemaValidatorAdapter(schemaManager)
 	mqttClient.SetSchemaValidator(schemaAdapter)
+	mqttClient.SetStrictValidation(cfg.Schema.StrictValidation)
+	if err := mqttClient.GetDeadLetterStore().ApplyConfig(cfg.Schema); err != nil {
+		log.Fatalf("Failed to configure dead letters: %v", err)
+	}
 
 	// Web Console and API server removed - using CLI only
 
@@ -312,6 +443,10 @@ func main() {
 	if err := mqttClient.Connect(ctx); err != nil {
 		log.Fatalf("Failed to connect to MQTT: %v", err)
 	}
+	// A startup schema alert is raised before the connection is up
+	if alert := schemaManager.GetReloadStatus().ActiveAlert; alert != nil {
+		publishSchemaAlert(alert)
+	}
 
 	log.Info("Starting device manager...")
 	if err := deviceManager.Start(ctx); err != nil {
@@ -333,6 +468,11 @@ func main() {
 		log.Fatalf("Failed to start diagnosis manager: %v", err)
 	}
 
+	log.Info("Starting storage backup worker...")
+	if err := backupManager.Start(ctx); err != nil {
+		log.Fatalf("Failed to start storage backup worker: %v", err)
+	}
+
 	log.WithFields(log.Fields{
 		"mqtt_broker": cfg.MQTT.Broker,
 		"mode":        "daemon",
@@ -345,6 +485,13 @@ func main() {
 	cancel()
 
 	// Stop services gracefully
+	alertingSystem.Stop()
+	qualityMonitor.Stop()
+	if topologyUpdater != nil {
+		topologyUpdater.Stop()
+	}
+	backupManager.Stop()
+	schemaManager.Stop()
 	diagnosisManager.Stop()
 	commandManager.Stop()
 	changesetManager.Stop()
@@ -401,6 +548,207 @@ func setupEnhancedLogging(cfg config.LoggingConfig) (*logging.Logger, *logging.A
 	return appLogger, auditLogger, perfLogger, nil
 }
 
+// schemaConfigFrom maps the controller schema settings onto the schema manager config
+func schemaConfigFrom(cfg config.SchemaConfig) schema.Config {
+	versions := make([]schema.VersionConfig, 0, len(cfg.Versions))
+	for _, v := range cfg.Versions {
+		versions = append(versions, schema.VersionConfig{
+			Name:       v.Name,
+			Version:    v.Version,
+			File:       v.File,
+			Deprecated: v.Deprecated,
+		})
+	}
+
+	return schema.Config{
+		Enabled:             cfg.Enabled,
+		SchemaFiles:         cfg.SchemaFiles,
+		SchemaDirs:          cfg.SchemaDirs,
+		WatchDirs:           cfg.WatchDirs,
+		StrictValidation:    cfg.StrictValidation,
+		LogValidationErrors: cfg.LogValidationErrors,
+		CacheResults:        cfg.CacheResults,
+		CacheSize:           cfg.CacheSize,
+		StoreResults:        cfg.StoreResults,
+		Versions:            versions,
+	}
+}
+
+// siteConfigFrom maps the controller sites settings onto the site registry config
+func siteConfigFrom(cfg config.SitesConfig) tenancy.Config {
+	return tenancy.Config{
+		DefaultTenant: cfg.DefaultTenant,
+		DefaultSite:   cfg.DefaultSite,
+		MaxSites:      cfg.MaxSites,
+	}
+}
+
+// runStorageMigration copies every key of the configured storage into an
+// empty storage of another backend
+func runStorageMigration(cfg config.StorageConfig, backend, path string) {
+	if path == "" {
+		path = cfg.Path
+	}
+	source := cfg.Backend
+	if source == "" {
+		source = storage.BackendBuntDB
+	}
+	if backend == source && filepath.Clean(path) == filepath.Clean(cfg.Path) {
+		log.Fatalf("Migration source and target are the same %s storage in %s", backend, path)
+	}
+
+	src, err := storage.Open(source, cfg.Path)
+	if err != nil {
+		log.Fatalf("Failed to open source storage: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := storage.Open(backend, path)
+	if err != nil {
+		log.Fatalf("Failed to open target storage: %v", err)
+	}
+	defer dst.Close()
+
+	start := time.Now()
+	copied, err := storage.Migrate(dst, src, storage.DefaultMigrateBatchSize)
+	if err != nil {
+		log.Fatalf("Storage migration failed: %v", err)
+	}
+
+	fmt.Printf("Migrated %d keys from %s (%s) to %s (%s) in %v\n",
+		copied, source, cfg.Path, backend, path, time.Since(start).Round(time.Millisecond))
+	fmt.Printf("Set storage.backend to %q and storage.path to %q to use the new storage\n", backend, path)
+}
+
+// backupConfigFrom maps the controller storage settings onto the backup
+// worker config
+func backupConfigFrom(cfg config.StorageConfig) (storage.BackupConfig, error) {
+	backupConfig := storage.BackupConfig{
+		Dir:     cfg.BackupDir,
+		Count:   cfg.BackupCount,
+		DataDir: cfg.Path,
+	}
+	if backupConfig.Dir == "" {
+		backupConfig.Dir = filepath.Join(cfg.Path, "backups")
+	}
+
+	var err error
+	if cfg.BackupInterval != "" {
+		if backupConfig.Interval, err = time.ParseDuration(cfg.BackupInterval); err != nil {
+			return backupConfig, fmt.Errorf("invalid backup interval: %w", err)
+		}
+	}
+	if cfg.CompactInterval != "" {
+		if backupConfig.CompactInterval, err = time.ParseDuration(cfg.CompactInterval); err != nil {
+			return backupConfig, fmt.Errorf("invalid compact interval: %w", err)
+		}
+	}
+	return backupConfig, nil
+}
+
+// commandSessionTopics are the topics a CLI or MCP process follows: the
+// responses to its commands and the device LWTs that hold commands back
+var commandSessionTopics = []string{
+	"rtk/v1/+/+/+/cmd/ack",
+	"rtk/v1/+/+/+/cmd/res",
+	"rtk/v1/+/+/+/cmd/progress",
+	"rtk/v1/+/+/+/lwt",
+}
+
+// commandSessionConfig returns the MQTT settings of a CLI or MCP process. It
+// connects under its own client ID so the service keeps its session, and
+// leaves device state and events to the service.
+func commandSessionConfig(cfg config.MQTTConfig, mode string) config.MQTTConfig {
+	cfg.ClientID = fmt.Sprintf("%s-%s-%d", cfg.ClientID, mode, os.Getpid())
+	cfg.Topics.Subscribe = commandSessionTopics
+	cfg.Logging.Enabled = false
+	return cfg
+}
+
+// rolloutControlTopic is where CLI and MCP processes send pause, resume and
+// abort requests for rollouts the service runs
+func rolloutControlTopic(cfg config.SitesConfig) string {
+	return fmt.Sprintf(changeset.RolloutControlTopic, cfg.DefaultTenant, cfg.DefaultSite)
+}
+
+// brokerConnection connects a process to the MQTT broker
+type brokerConnection interface {
+	Connect(ctx context.Context) error
+}
+
+// startCommandSession starts the command manager of a CLI or MCP process
+// and connects it to the broker, so commands, changesets and rollouts sent
+// from the process are followed to their results. The handlers are
+// registered before the connection delivers any response.
+func startCommandSession(ctx context.Context, client brokerConnection, commandManager *command.Manager) error {
+	if err := commandManager.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start command manager: %w", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to MQTT: %w", err)
+	}
+	return nil
+}
+
+// startTopologyUpdater starts real-time topology event delivery for a site,
+// subscribing the MQTT events topic and the configured webhooks to every
+// event. SSE and WebSocket clients subscribe through the stream endpoint.
+func startTopologyUpdater(cfg config.TopologyEventsConfig, manager *topology.Manager, topologyStorage *storage.TopologyStorage, publisher topology.EventPublisher) (*topology.RealtimeTopologyUpdater, error) {
+	updater := topology.NewRealtimeTopologyUpdater(manager, nil, nil, topologyStorage, topology.RealtimeUpdaterConfig{
+		MaxRetries:        5,
+		RetryBackoffMs:    1000,
+		MaxSubscriptions:  cfg.MaxSubscriptions,
+		WebhookSecret:     cfg.WebhookSecret,
+		WebhookTimeout:    10 * time.Second,
+		StreamAddress:     cfg.StreamAddress,
+		StreamToken:       cfg.StreamToken,
+		AllowedOrigins:    cfg.AllowedOrigins,
+		ChannelBufferSize: 1000,
+		WorkerPoolSize:    4,
+		UpdateRetention:   time.Hour,
+	})
+	updater.SetEventPublisher(publisher)
+
+	if cfg.PublishMQTT {
+		if _, err := updater.Subscribe("mqtt", topology.UpdateFilter{}, topology.DeliveryMQTT, ""); err != nil {
+			return nil, err
+		}
+	}
+	for i, endpoint := range cfg.Webhooks {
+		if _, err := updater.Subscribe(fmt.Sprintf("webhook-%d", i+1), topology.UpdateFilter{}, topology.DeliveryWebhook, endpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := updater.Start(); err != nil {
+		return nil, err
+	}
+	return updater, nil
+}
+
+// schemaAlertPublisher publishes schema alerts (e.g. a broken schema file
+// rejected by hot reload) on the controller's alert topic. Alerts raised
+// before the client connects are left to the caller to publish afterwards.
+func schemaAlertPublisher(mqttClient *mqtt.Client, clientID string) func(*schema.SchemaAlert) {
+	topic := fmt.Sprintf("rtk/controller/%s/alert", clientID)
+	return func(alert *schema.SchemaAlert) {
+		if !mqttClient.IsConnected() {
+			log.Debug("MQTT not connected, schema alert is published once it is")
+			return
+		}
+		payload := map[string]interface{}{
+			"type":     "schema_reload_failed",
+			"severity": "error",
+			"message":  alert.Message,
+			"errors":   alert.Errors,
+			"ts":       alert.RaisedAt.UnixMilli(),
+		}
+		if err := mqttClient.Publish(topic, 1, false, payload); err != nil {
+			log.WithError(err).Warn("Failed to publish schema alert")
+		}
+	}
+}
+
 func setupLogging(level string) {
 	log.SetFormatter(&log.JSONFormatter{
 		TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
@@ -432,7 +780,7 @@ func waitForShutdown() {
 	<-sigCh
 }
 
-func runMCPServer(cfg *config.Config, host string, port int) {
+func runMCPServer(cfg *config.Config, auditLogger *logging.AuditLogger, host string, port int) {
 	log.Info("Starting RTK Controller MCP Server...")
 	printBanner()
 
@@ -441,18 +789,25 @@ func runMCPServer(cfg *config.Config, host string, port int) {
 	defer cancel()
 
 	// Initialize storage
-	buntStorage, err := storage.NewBuntDB(cfg.Storage.Path)
+	dataStorage, err := storage.Open(cfg.Storage.Backend, cfg.Storage.Path)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
-	defer buntStorage.Close()
+	defer dataStorage.Close()
+
+	// Keep CLI restores from swapping the storage under this process
+	dataLock, err := storage.LockData(cfg.Storage.Path)
+	if err != nil {
+		log.Fatalf("Failed to lock storage: %v", err)
+	}
+	defer dataLock.Release()
 
 	// Initialize topology and identity storage
-	topologyStorage := storage.NewTopologyStorage(buntStorage)
-	identityStorage := storage.NewIdentityStorage(buntStorage)
+	topologyStorage := storage.NewTopologyStorage(dataStorage)
+	identityStorage := storage.NewIdentityStorage(dataStorage)
 
 	// Initialize MQTT client for MCP server
-	mqttClient, err := mqtt.NewClient(cfg.MQTT, buntStorage)
+	mqttClient, err := mqtt.NewClient(commandSessionConfig(cfg.MQTT, "mcp"), dataStorage)
 	if err != nil {
 		log.Fatalf("Failed to create MQTT client: %v", err)
 	}
@@ -467,10 +822,8 @@ func runMCPServer(cfg *config.Config, host string, port int) {
 	}
 	identityManager := identity.NewManager(identityStorage, identityConfig)
 
-	// Initialize topology manager
+	// Initialize the site registry; per-site topology managers use this template
 	topologyConfig := topology.ManagerConfig{
-		Tenant:                     "default",
-		Site:                       "default",
 		TopologyUpdateInterval:     30 * time.Second,
 		MetricsUpdateInterval:      1 * time.Minute,
 		CleanupInterval:            5 * time.Minute,
@@ -483,24 +836,38 @@ func runMCPServer(cfg *config.Config, host string, port int) {
 		EnableDeviceClassification: true,
 		DiscoveryConfig:            topology.DiscoveryConfig{},
 	}
-	topologyManager, err := topology.NewManager(topologyStorage, identityStorage, identityManager, topologyConfig)
+	siteRegistry := tenancy.NewRegistry(siteConfigFrom(cfg.Sites), topologyStorage, identityStorage, identityManager, topologyConfig)
+	topologyManager, err := siteRegistry.TopologyManager("", "")
 	if err != nil {
 		log.Fatalf("Failed to create topology manager: %v", err)
 	}
 
 	// Initialize core services for MCP server
-	deviceManager := device.NewManager(buntStorage)
-	commandManager := command.NewManager(mqttClient, buntStorage)
-	diagnosisManager := diagnosis.NewManager(cfg.Diagnosis, buntStorage)
+	deviceManager := device.NewManager(dataStorage)
+	siteRegistry.SetSiteDirectory(deviceManager)
+	commandManager := command.NewManager(mqttClient, dataStorage)
+	if err := commandManager.ApplyConfig(cfg.Commands); err != nil {
+		log.Fatalf("Invalid commands configuration: %v", err)
+	}
+	commandManager.SetDeviceDirectory(deviceManager)
+	commandManager.SetGroupDirectory(identityManager)
+	diagnosisManager := diagnosis.NewManager(cfg.Diagnosis, dataStorage)
 
 	// Initialize QoS manager for LLM tools
-	qosManager := qos.NewQoSManager(nil)
+	qosManager, err := siteRegistry.QoSManager("", "")
+	if err != nil {
+		log.Fatalf("Failed to create QoS manager: %v", err)
+	}
 
 	// Initialize changeset manager
-	changesetManager := changeset.NewSimpleManager(buntStorage, commandManager)
+	changesetManager := changeset.NewSimpleManager(dataStorage, commandManager)
+	changesetManager.SetHealthSources(deviceManager, nil)
+	changesetManager.SetAuditLogger(auditLogger)
+	changesetManager.SetRolloutControl(mqttClient, rolloutControlTopic(cfg.Sites))
 
 	// Initialize LLM tool engine
-	llmToolEngine := llm.NewToolEngine(buntStorage, commandManager, topologyManager, qosManager)
+	llmToolEngine := llm.NewToolEngine(dataStorage, commandManager, topologyManager, qosManager)
+	llmToolEngine.SetSiteManagers(siteRegistry)
 	if err := llmToolEngine.Start(ctx); err != nil {
 		log.Fatalf("Failed to start LLM tool engine: %v", err)
 	}
@@ -513,7 +880,7 @@ func runMCPServer(cfg *config.Config, host string, port int) {
 		ConfidenceThreshold:    0.7,
 		FallbackWorkflow:       "general_network_diagnosis",
 	}
-	workflowEngine, err := workflow.NewWorkflowEngine(llmToolEngine, buntStorage, workflowConfig)
+	workflowEngine, err := workflow.NewWorkflowEngine(llmToolEngine, dataStorage, workflowConfig)
 	if err != nil {
 		log.Fatalf("Failed to create workflow engine: %v", err)
 	}
@@ -537,6 +904,11 @@ func runMCPServer(cfg *config.Config, host string, port int) {
 		log.Fatalf("Failed to start changeset manager: %v", err)
 	}
 
+	// Follow the results of commands and changesets sent by MCP tools
+	if err := startCommandSession(ctx, mqttClient, commandManager); err != nil {
+		log.Warnf("Commands cannot reach devices: %v", err)
+	}
+
 	// Create MCP server configuration
 	mcpConfig := mcp.ServerConfig{
 		Name:    "RTK Controller MCP Server",
@@ -625,7 +997,9 @@ func runMCPServer(cfg *config.Config, host string, port int) {
 	diagnosisManager.Stop()
 	commandManager.Stop()
 	deviceManager.Stop()
-	mqttClient.Disconnect()
+	if mqttClient.IsConnected() {
+		mqttClient.Disconnect()
+	}
 
 	log.Info("RTK Controller MCP Server stopped gracefully")
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rtk_controller/internal/changeset"
+	"rtk_controller/internal/command"
+	"rtk_controller/internal/config"
+	"rtk_controller/internal/mqtt"
+	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loopbackBroker stands in for the broker and a device that completes every
+// command. Like the broker, it only delivers results once connected, and
+// only to a handler registered for the result topic.
+type loopbackBroker struct {
+	mu        sync.Mutex
+	connected bool
+	handlers  map[string]mqtt.MessageHandler
+}
+
+func (b *loopbackBroker) Connect(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.connected = true
+	return nil
+}
+
+func (b *loopbackBroker) RegisterHandler(pattern string, handler mqtt.MessageHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[pattern] = handler
+}
+
+func (b *loopbackBroker) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	b.mu.Lock()
+	handler := b.handlers["rtk/v1/+/+/+/cmd/res"]
+	deliver := b.connected && handler != nil
+	b.mu.Unlock()
+
+	request, ok := payload.(map[string]interface{})
+	if !deliver || !ok || !strings.HasSuffix(topic, "/cmd/req") {
+		return nil
+	}
+	data, _ := json.Marshal(map[string]interface{}{"id": request["id"], "status": "completed"})
+	go handler.HandleMessage(strings.TrimSuffix(topic, "req")+"res", data)
+	return nil
+}
+
+func TestCommandSessionConfig(t *testing.T) {
+	cfg := config.MQTTConfig{ClientID: "rtk-controller"}
+	cfg.Topics.Subscribe = []string{"rtk/v1/+/+/+/state"}
+	cfg.Logging.Enabled = true
+
+	session := commandSessionConfig(cfg, "cli")
+	assert.True(t, strings.HasPrefix(session.ClientID, "rtk-controller-cli-"))
+	assert.Contains(t, session.Topics.Subscribe, "rtk/v1/+/+/+/cmd/res")
+	assert.NotContains(t, session.Topics.Subscribe, "rtk/v1/+/+/+/state")
+	assert.False(t, session.Logging.Enabled)
+	assert.Equal(t, "rtk-controller", cfg.ClientID)
+}
+
+func TestStartCommandSession_ExecutesChangeset(t *testing.T) {
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	// Wired as in CLI mode
+	broker := &loopbackBroker{handlers: make(map[string]mqtt.MessageHandler)}
+	commandManager := command.NewManager(broker, store)
+	changesetManager := changeset.NewSimpleManager(store, commandManager)
+	require.NoError(t, changesetManager.Start(context.Background()))
+	t.Cleanup(func() { changesetManager.Stop() })
+
+	require.NoError(t, startCommandSession(context.Background(), broker, commandManager))
+	t.Cleanup(commandManager.Stop)
+
+	draft, err := changesetManager.CreateChangeset(context.Background(), nil)
+	require.NoError(t, err)
+	require.NoError(t, changesetManager.AddCommandToChangeset(draft.ID, &types.Command{
+		ID: "step-1", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel", Timeout: 5 * time.Second,
+	}))
+
+	require.NoError(t, changesetManager.ExecuteChangeset(context.Background(), draft.ID))
+
+	stored, err := changesetManager.GetChangeset(draft.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusCompleted, stored.Status)
+	require.Len(t, stored.Results, 1)
+	assert.True(t, stored.Results[0].Success)
+}
@@ -0,0 +1,193 @@
+package changeset
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"rtk_controller/internal/logging"
+	"rtk_controller/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Audit actions recorded for changesets
+const (
+	auditApprovalRequested = "changeset_approval_requested"
+	auditApproved          = "changeset_approved"
+	auditRejected          = "changeset_rejected"
+	auditExecuted          = "changeset_execute"
+)
+
+// SetAuditLogger sets the audit logger that records approval decisions
+func (m *SimpleManager) SetAuditLogger(audit *logging.AuditLogger) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.audit = audit
+}
+
+// SetRequireSessionApproval sets whether changesets created from an LLM
+// session need approval. It applies to changesets created afterwards.
+func (m *SimpleManager) SetRequireSessionApproval(required bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.config.RequireSessionApproval = required
+}
+
+// checkExecutable reports whether a changeset may start executing.
+// Callers hold m.mutex.
+func checkExecutable(changeset *types.Changeset) error {
+	switch changeset.Status {
+	case types.ChangesetStatusApproved:
+		return nil
+	case types.ChangesetStatusDraft:
+		if changeset.RequiresApproval {
+			return fmt.Errorf("changeset %s requires approval before execution", changeset.ID)
+		}
+		return nil
+	case types.ChangesetStatusPendingApproval:
+		return fmt.Errorf("changeset %s is waiting for approval", changeset.ID)
+	default:
+		return fmt.Errorf("changeset %s is not in draft status", changeset.ID)
+	}
+}
+
+// SubmitForApproval moves a draft changeset to pending approval. Once
+// submitted its commands can no longer be changed.
+func (m *SimpleManager) SubmitForApproval(ctx context.Context, changesetID, requestedBy string) error {
+	m.mutex.Lock()
+	changeset, exists := m.activeChangesets[changesetID]
+	if !exists {
+		m.mutex.Unlock()
+		return fmt.Errorf("changeset %s not found", changesetID)
+	}
+	if changeset.Status != types.ChangesetStatusDraft {
+		m.mutex.Unlock()
+		return fmt.Errorf("cannot submit changeset in status %s", changeset.Status)
+	}
+	if len(changeset.Commands) == 0 {
+		m.mutex.Unlock()
+		return fmt.Errorf("changeset %s has no commands", changesetID)
+	}
+
+	changeset.Status = types.ChangesetStatusPendingApproval
+	changeset.RequiresApproval = true
+	changeset.Approval = &types.ChangesetApproval{
+		RequestedBy: requestedBy,
+		RequestedAt: time.Now(),
+	}
+	err := m.persistChangeset(changeset)
+	audit := m.audit
+	m.mutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to persist changeset: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"changeset_id": changesetID,
+		"requested_by": requestedBy,
+	}).Info("Changeset submitted for approval")
+
+	if audit != nil {
+		audit.LogAction(ctx, auditApprovalRequested, requestedBy, "changeset:"+changesetID, map[string]interface{}{
+			"session_id":    changeset.SessionID,
+			"created_by":    changeset.CreatedBy,
+			"command_count": len(changeset.Commands),
+		})
+	}
+	return nil
+}
+
+// ApproveChangeset approves a changeset waiting for approval. The approver
+// must differ from the creator of the changeset.
+func (m *SimpleManager) ApproveChangeset(ctx context.Context, changesetID, approver, comment string) error {
+	return m.decide(ctx, changesetID, approver, comment, true)
+}
+
+// RejectChangeset rejects a changeset waiting for approval and returns it to
+// draft so it can be revised and submitted again.
+func (m *SimpleManager) RejectChangeset(ctx context.Context, changesetID, approver, reason string) error {
+	return m.decide(ctx, changesetID, approver, reason, false)
+}
+
+func (m *SimpleManager) decide(ctx context.Context, changesetID, approver, comment string, approved bool) error {
+	if approver == "" {
+		return fmt.Errorf("approver is required")
+	}
+
+	m.mutex.Lock()
+	changeset, exists := m.activeChangesets[changesetID]
+	if !exists {
+		m.mutex.Unlock()
+		return fmt.Errorf("changeset %s not found", changesetID)
+	}
+	if changeset.Status != types.ChangesetStatusPendingApproval || changeset.Approval == nil {
+		m.mutex.Unlock()
+		return fmt.Errorf("changeset %s is not waiting for approval", changesetID)
+	}
+	if approved && (approver == changeset.CreatedBy || approver == changeset.Approval.RequestedBy) {
+		m.mutex.Unlock()
+		return fmt.Errorf("%s cannot approve their own changeset", approver)
+	}
+
+	now := time.Now()
+	changeset.Approval.Approver = approver
+	changeset.Approval.Approved = approved
+	changeset.Approval.Comment = comment
+	changeset.Approval.DecidedAt = &now
+	if approved {
+		changeset.Status = types.ChangesetStatusApproved
+	} else {
+		changeset.Status = types.ChangesetStatusDraft
+	}
+	err := m.persistChangeset(changeset)
+	audit := m.audit
+	m.mutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to persist changeset: %w", err)
+	}
+
+	action := auditApproved
+	if !approved {
+		action = auditRejected
+	}
+
+	log.WithFields(log.Fields{
+		"changeset_id": changesetID,
+		"approver":     approver,
+		"approved":     approved,
+	}).Info("Changeset approval decided")
+
+	if audit != nil {
+		audit.LogAction(ctx, action, approver, "changeset:"+changesetID, map[string]interface{}{
+			"comment":      comment,
+			"requested_by": changeset.Approval.RequestedBy,
+			"session_id":   changeset.SessionID,
+		})
+	}
+	return nil
+}
+
+// auditExecution records the start of an execution together with the
+// approver that allowed it
+func (m *SimpleManager) auditExecution(ctx context.Context, changeset *types.Changeset) {
+	m.mutex.RLock()
+	audit := m.audit
+	m.mutex.RUnlock()
+	if audit == nil {
+		return
+	}
+
+	details := map[string]interface{}{
+		"command_count": len(changeset.Commands),
+		"session_id":    changeset.SessionID,
+	}
+	user := changeset.CreatedBy
+	if changeset.Approval != nil && changeset.Approval.Approved {
+		details["approver"] = changeset.Approval.Approver
+		user = changeset.Approval.Approver
+	}
+	audit.LogAction(ctx, auditExecuted, user, "changeset:"+changeset.ID, details)
+}
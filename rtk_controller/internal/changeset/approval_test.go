@@ -0,0 +1,95 @@
+package changeset
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rtk_controller/internal/config"
+	"rtk_controller/internal/logging"
+	"rtk_controller/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApproval_SessionChangesetRequiresApproval(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+	})
+
+	logFile := filepath.Join(t.TempDir(), "controller.log")
+	audit, err := logging.NewAuditLogger(config.LoggingConfig{Level: "info", Format: "json", File: logFile})
+	require.NoError(t, err)
+	t.Cleanup(func() { audit.Close() })
+	manager.SetAuditLogger(audit)
+
+	changeset, err := manager.CreateChangeset(context.Background(), &types.ChangesetOptions{
+		CreatedBy: "llm",
+		SessionID: "session-1",
+	})
+	require.NoError(t, err)
+	assert.True(t, changeset.RequiresApproval)
+	require.NoError(t, manager.AddCommandToChangeset(changeset.ID, &types.Command{
+		ID: "step-1", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel", Timeout: 5 * time.Second,
+	}))
+
+	ctx := context.Background()
+	assert.ErrorContains(t, manager.ExecuteChangeset(ctx, changeset.ID), "requires approval")
+
+	require.NoError(t, manager.SubmitForApproval(ctx, changeset.ID, "llm"))
+	assert.Equal(t, types.ChangesetStatusPendingApproval, changeset.Status)
+	assert.ErrorContains(t, manager.ExecuteChangeset(ctx, changeset.ID), "waiting for approval")
+	assert.Error(t, manager.AddCommandToChangeset(changeset.ID, &types.Command{ID: "late"}), "submitted changesets are frozen")
+
+	assert.ErrorContains(t, manager.ApproveChangeset(ctx, changeset.ID, "llm", ""), "own changeset")
+	assert.Error(t, manager.ApproveChangeset(ctx, changeset.ID, "", ""))
+
+	require.NoError(t, manager.ApproveChangeset(ctx, changeset.ID, "alice", "channel 6 is clear"))
+	assert.Equal(t, types.ChangesetStatusApproved, changeset.Status)
+	require.NoError(t, manager.ExecuteChangeset(ctx, changeset.ID))
+	assert.Len(t, device.requests(), 1)
+
+	stored, err := manager.loadChangeset(changeset.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.Approval)
+	assert.Equal(t, "alice", stored.Approval.Approver)
+	assert.True(t, stored.Approval.Approved)
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(logFile), "controller.audit.log"))
+	require.NoError(t, err)
+	log := string(data)
+	assert.Contains(t, log, `"audit_action":"changeset_approval_requested"`)
+	assert.Contains(t, log, `"audit_action":"changeset_approved"`)
+	assert.Contains(t, log, `"audit_user":"alice"`)
+	assert.Contains(t, log, `"detail_approver":"alice"`)
+}
+
+func TestApproval_RejectReturnsToDraft(t *testing.T) {
+	manager, _ := setupExecutionTest(t, nil)
+	ctx := context.Background()
+
+	changeset := newDraft(t, manager, []*types.Command{
+		{ID: "step-1", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel"},
+	}, nil)
+	assert.False(t, changeset.RequiresApproval, "approval is optional outside LLM sessions")
+
+	assert.Error(t, manager.RejectChangeset(ctx, changeset.ID, "bob", "not submitted"))
+	require.NoError(t, manager.SubmitForApproval(ctx, changeset.ID, "carol"))
+	require.NoError(t, manager.RejectChangeset(ctx, changeset.ID, "bob", "wrong channel"))
+
+	assert.Equal(t, types.ChangesetStatusDraft, changeset.Status)
+	assert.True(t, changeset.RequiresApproval, "a submitted changeset stays under approval")
+	assert.False(t, changeset.Approval.Approved)
+	assert.Equal(t, "wrong channel", changeset.Approval.Comment)
+	assert.ErrorContains(t, manager.ExecuteChangeset(ctx, changeset.ID), "requires approval")
+
+	// The draft can be revised and submitted again
+	require.NoError(t, manager.AddCommandToChangeset(changeset.ID, &types.Command{
+		ID: "step-2", DeviceID: "office/floor1/ap1", Operation: "wifi.set_power",
+	}))
+	require.NoError(t, manager.SubmitForApproval(ctx, changeset.ID, "carol"))
+	assert.Nil(t, changeset.Approval.DecidedAt)
+}
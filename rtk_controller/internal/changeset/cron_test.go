@@ -0,0 +1,47 @@
+package changeset
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	// Friday 2026-10-16 10:17 UTC
+	from := time.Date(2026, 10, 16, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 16, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * sun", time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC)},
+		{"30 2 1 * *", time.Date(2026, 11, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 22 * * 1-5", time.Date(2026, 10, 16, 22, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 13 * fri", time.Date(2026, 10, 23, 9, 0, 0, 0, time.UTC)}, // either day field matches
+		{"0,45 10 * * *", time.Date(2026, 10, 16, 10, 45, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		cron, err := parseCron(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, cron.Next(from), tt.expr)
+	}
+
+	never, err := parseCron("0 0 31 2 *")
+	require.NoError(t, err)
+	assert.True(t, never.Next(from).IsZero())
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		_, err := parseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
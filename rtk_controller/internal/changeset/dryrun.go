@@ -0,0 +1,143 @@
+package changeset
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"rtk_controller/pkg/types"
+)
+
+// DryRunChangeset renders what a changeset would change on each device
+// without sending anything. Each command argument is compared with the
+// device's last known attributes (attr) and state components; commands on
+// the same device are applied in order, so a later command sees the values
+// of an earlier one.
+func (m *SimpleManager) DryRunChangeset(changesetID string) (*types.ChangesetDiff, error) {
+	changeset, err := m.GetChangeset(changesetID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	devices := m.devices
+	commands := append([]*types.Command(nil), changeset.Commands...)
+	m.mutex.RUnlock()
+
+	if devices == nil {
+		return nil, fmt.Errorf("device state source not configured")
+	}
+
+	diff := &types.ChangesetDiff{
+		ChangesetID: changesetID,
+		Devices:     make([]*types.DeviceDiff, 0),
+		GeneratedAt: time.Now(),
+	}
+	byDevice := make(map[string]*types.DeviceDiff)
+	states := make(map[string]*types.DeviceState)
+	pending := make(map[string]map[string]interface{}) // device key -> field -> value set by earlier commands
+
+	for _, cmd := range commands {
+		tenant, site, deviceID, err := commandTarget(cmd)
+		if err != nil {
+			return nil, err
+		}
+		key := deviceKey(cmd)
+
+		deviceDiff, exists := byDevice[key]
+		if !exists {
+			deviceDiff = &types.DeviceDiff{DeviceKey: key, Changes: make([]types.FieldDiff, 0)}
+			if state, err := devices.GetDevice(tenant, site, deviceID); err == nil && state != nil {
+				deviceDiff.Known = true
+				deviceDiff.Online = state.Online
+				deviceDiff.LastSeen = state.LastSeen
+				states[key] = state
+			}
+			byDevice[key] = deviceDiff
+			pending[key] = make(map[string]interface{})
+			diff.Devices = append(diff.Devices, deviceDiff)
+		}
+
+		argKeys := make([]string, 0, len(cmd.Args))
+		for arg := range cmd.Args {
+			argKeys = append(argKeys, arg)
+		}
+		sort.Strings(argKeys)
+
+		for _, arg := range argKeys {
+			after := cmd.Args[arg]
+			field, before, known := lookupField(states[key], cmd.Operation, arg)
+			if value, ok := pending[key][field]; ok {
+				before, known = value, true
+			}
+			pending[key][field] = after
+
+			deviceDiff.Changes = append(deviceDiff.Changes, types.FieldDiff{
+				Field:     field,
+				Before:    before,
+				After:     after,
+				Known:     known,
+				Changed:   !known || !sameValue(before, after),
+				CommandID: cmd.ID,
+				Operation: cmd.Operation,
+			})
+		}
+	}
+
+	return diff, nil
+}
+
+// lookupField finds the current value of a command argument. It tries the
+// argument as a dotted path, then prefixed with the operation's domain
+// ("wifi.set_channel" + "channel" -> "wifi.channel"), first in attributes
+// and then in state components. The returned field is the path that
+// matched, or the preferred path when nothing matched.
+func lookupField(state *types.DeviceState, operation, arg string) (string, interface{}, bool) {
+	candidates := []string{arg}
+	if domain, _, found := strings.Cut(operation, "."); found && !strings.HasPrefix(arg, domain+".") {
+		candidates = []string{domain + "." + arg, arg}
+	}
+
+	if state != nil {
+		for _, path := range candidates {
+			for _, source := range []map[string]interface{}{state.Attributes, state.Components} {
+				if value, ok := lookupPath(source, path); ok {
+					return path, value, true
+				}
+			}
+		}
+	}
+	return candidates[0], nil, false
+}
+
+// lookupPath resolves a dotted path in nested maps. A flat key containing
+// dots takes precedence over nesting.
+func lookupPath(data map[string]interface{}, path string) (interface{}, bool) {
+	if data == nil {
+		return nil, false
+	}
+	if value, ok := data[path]; ok {
+		return value, true
+	}
+
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		return nil, false
+	}
+	nested, ok := data[head].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookupPath(nested, rest)
+}
+
+// sameValue compares values loosely so that CLI strings match JSON numbers
+// and booleans ("6" == 6.0)
+func sameValue(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
@@ -0,0 +1,67 @@
+package changeset
+
+import (
+	"testing"
+
+	"rtk_controller/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunChangeset(t *testing.T) {
+	manager, device := setupExecutionTest(t, nil)
+	manager.SetHealthSources(&fakeStates{states: map[string]*types.DeviceState{
+		"office:floor1:ap1": {
+			Online:   true,
+			LastSeen: 1700000000000,
+			Attributes: map[string]interface{}{
+				"wifi": map[string]interface{}{"channel": float64(1), "ssid": "Office"},
+			},
+			Components: map[string]interface{}{
+				"radio.tx_power": float64(20),
+			},
+		},
+	}}, nil)
+
+	changeset := newDraft(t, manager, []*types.Command{
+		{ID: "step-1", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel", Args: map[string]interface{}{"channel": "6"}},
+		{ID: "step-2", DeviceID: "office/floor1/ap1", Operation: "wifi.set_ssid", Args: map[string]interface{}{"ssid": "Office"}},
+		{ID: "step-3", DeviceID: "office/floor1/ap1", Operation: "radio.set", Args: map[string]interface{}{"tx_power": 17}},
+		{ID: "step-4", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel", Args: map[string]interface{}{"channel": 11}},
+		{ID: "step-5", DeviceID: "office/floor2/ap2", Operation: "wifi.set_channel", Args: map[string]interface{}{"channel": 6}},
+	}, nil)
+
+	diff, err := manager.DryRunChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Empty(t, device.requests(), "dry run must not send commands")
+	require.Len(t, diff.Devices, 2)
+
+	ap1 := diff.Devices[0]
+	assert.Equal(t, "office:floor1:ap1", ap1.DeviceKey)
+	assert.True(t, ap1.Known)
+	assert.True(t, ap1.Online)
+	assert.Equal(t, []types.FieldDiff{
+		{Field: "wifi.channel", Before: float64(1), After: "6", Known: true, Changed: true, CommandID: "step-1", Operation: "wifi.set_channel"},
+		{Field: "wifi.ssid", Before: "Office", After: "Office", Known: true, Changed: false, CommandID: "step-2", Operation: "wifi.set_ssid"},
+		{Field: "radio.tx_power", Before: float64(20), After: 17, Known: true, Changed: true, CommandID: "step-3", Operation: "radio.set"},
+		{Field: "wifi.channel", Before: "6", After: 11, Known: true, Changed: true, CommandID: "step-4", Operation: "wifi.set_channel"},
+	}, ap1.Changes)
+
+	ap2 := diff.Devices[1]
+	assert.False(t, ap2.Known)
+	require.Len(t, ap2.Changes, 1)
+	assert.Equal(t, "wifi.channel", ap2.Changes[0].Field)
+	assert.False(t, ap2.Changes[0].Known)
+	assert.True(t, ap2.Changes[0].Changed)
+}
+
+func TestDryRunChangeset_RequiresStateSource(t *testing.T) {
+	manager, _ := setupExecutionTest(t, nil)
+	changeset := newDraft(t, manager, []*types.Command{
+		{ID: "step-1", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel"},
+	}, nil)
+
+	_, err := manager.DryRunChangeset(changeset.ID)
+	assert.Error(t, err)
+}
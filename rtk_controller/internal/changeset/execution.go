@@ -0,0 +1,142 @@
+package changeset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"rtk_controller/internal/command"
+	"rtk_controller/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultCommandTimeout is used for changeset commands without a timeout
+const defaultCommandTimeout = 30 * time.Second
+
+// commandTarget returns the tenant, site and device of a changeset command.
+// Commands without Tenant/Site may carry a "tenant:site:device" or
+// "tenant/site/device" device ID.
+func commandTarget(cmd *types.Command) (string, string, string, error) {
+	if cmd.Tenant != "" && cmd.Site != "" {
+		return cmd.Tenant, cmd.Site, cmd.DeviceID, nil
+	}
+
+	for _, sep := range []string{":", "/"} {
+		parts := strings.Split(cmd.DeviceID, sep)
+		if len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "" {
+			return parts[0], parts[1], parts[2], nil
+		}
+	}
+
+	return "", "", "", fmt.Errorf("command %s has no tenant/site for device %q", cmd.ID, cmd.DeviceID)
+}
+
+// deviceKey returns the tenant:site:device key of a command's target, or the
+// raw device ID when the target cannot be resolved
+func deviceKey(cmd *types.Command) string {
+	tenant, site, deviceID, err := commandTarget(cmd)
+	if err != nil {
+		return cmd.DeviceID
+	}
+	return fmt.Sprintf("%s:%s:%s", tenant, site, deviceID)
+}
+
+// runCommand sends one changeset command and waits for its outcome
+func (m *SimpleManager) runCommand(ctx context.Context, cmd *types.Command, phase string) *types.CommandResult {
+	startTime := time.Now()
+	result := &types.CommandResult{
+		CommandID:  cmd.ID,
+		ExecutedAt: startTime,
+		Phase:      phase,
+	}
+
+	finish := func(status, message string) *types.CommandResult {
+		result.Status = status
+		result.Message = message
+		result.Success = status == string(types.CommandStatusCompleted)
+		result.Duration = time.Since(startTime)
+		return result
+	}
+
+	tenant, site, deviceID, err := commandTarget(cmd)
+	if err != nil {
+		return finish(string(types.CommandStatusFailed), err.Error())
+	}
+
+	timeout := cmd.Timeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+
+	// Subscribe before sending so a fast result cannot be missed
+	changed := make(chan struct{}, 1)
+	subID := m.commandManager.Subscribe("", func(update command.CommandUpdate) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	defer m.commandManager.Unsubscribe(subID)
+
+	sent, err := m.commandManager.SendCommandWithOptions(tenant, site, deviceID, cmd.Operation, cmd.Args, 0,
+		command.SendOptions{Timeout: timeout})
+	if err != nil {
+		return finish(string(types.CommandStatusFailed), err.Error())
+	}
+	result.DeviceCommandID = sent.ID
+
+	if cmd.Expectation == "none" {
+		return finish(string(types.CommandStatusCompleted), "Command sent")
+	}
+
+	// Retries may follow a timed out attempt
+	attempts := sent.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	deadline := time.NewTimer(timeout * time.Duration(attempts))
+	defer deadline.Stop()
+
+	for {
+		current, err := m.commandManager.GetCommand(sent.ID)
+		if err == nil {
+			switch current.Status {
+			case "completed":
+				result.Data = current.Result
+				return finish(current.Status, "Command completed")
+			case "ack":
+				if cmd.Expectation == "ack" {
+					return finish(string(types.CommandStatusCompleted), "Command acknowledged")
+				}
+			case "failed", "timeout", "cancelled":
+				result.Data = current.Result
+				message := current.Error
+				if message == "" {
+					message = "Command " + current.Status
+				}
+				return finish(current.Status, message)
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return finish(string(types.CommandStatusTimeout), "Timed out waiting for device result")
+		case <-ctx.Done():
+			return finish(string(types.CommandStatusFailed), ctx.Err().Error())
+		}
+	}
+}
+
+// recordResult appends a step result and persists the changeset
+func (m *SimpleManager) recordResult(changeset *types.Changeset, result *types.CommandResult) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	changeset.AddResult(result)
+	if err := m.persistChangeset(changeset); err != nil {
+		log.WithError(err).Warn("Failed to persist changeset progress")
+	}
+}
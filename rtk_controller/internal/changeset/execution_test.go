@@ -0,0 +1,256 @@
+package changeset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"rtk_controller/internal/command"
+	"rtk_controller/internal/mqtt"
+	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDevice answers published commands through the command manager.
+// Operations listed in results reply with that payload; others get no reply.
+type fakeDevice struct {
+	mu       sync.Mutex
+	manager  *command.Manager
+	results  map[string]map[string]interface{}
+	received []string // "topic op"
+}
+
+func (d *fakeDevice) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	request := payload.(map[string]interface{})
+	op := request["op"].(string)
+
+	d.mu.Lock()
+	d.received = append(d.received, fmt.Sprintf("%s %s", topic, op))
+	result, reply := d.results[op]
+	d.mu.Unlock()
+
+	if reply {
+		response := map[string]interface{}{"id": request["id"]}
+		for k, v := range result {
+			response[k] = v
+		}
+		data, _ := json.Marshal(response)
+		resTopic := topic[:len(topic)-len("req")] + "res"
+		go d.manager.HandleCommandResult(resTopic, data)
+	}
+	return nil
+}
+
+func (d *fakeDevice) RegisterHandler(pattern string, handler mqtt.MessageHandler) {}
+
+func (d *fakeDevice) requests() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.received...)
+}
+
+func setupExecutionTest(t *testing.T, results map[string]map[string]interface{}) (*SimpleManager, *fakeDevice) {
+	t.Helper()
+
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	device := &fakeDevice{results: results}
+	device.manager = command.NewManager(device, store)
+
+	return NewSimpleManager(store, device.manager), device
+}
+
+func newDraft(t *testing.T, manager *SimpleManager, commands, rollback []*types.Command) *types.Changeset {
+	t.Helper()
+
+	changeset, err := manager.CreateChangeset(context.Background(), nil)
+	require.NoError(t, err)
+	for _, cmd := range commands {
+		require.NoError(t, manager.AddCommandToChangeset(changeset.ID, cmd))
+	}
+	for _, cmd := range rollback {
+		require.NoError(t, manager.AddRollbackCommandToChangeset(changeset.ID, cmd))
+	}
+	return changeset
+}
+
+func TestCommandTarget(t *testing.T) {
+	tenant, site, device, err := commandTarget(&types.Command{Tenant: "office", Site: "floor1", DeviceID: "ap1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"office", "floor1", "ap1"}, []string{tenant, site, device})
+
+	tenant, site, device, err = commandTarget(&types.Command{DeviceID: "office:floor2:ap2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"office", "floor2", "ap2"}, []string{tenant, site, device})
+
+	tenant, site, device, err = commandTarget(&types.Command{DeviceID: "lab/bench/ap3"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lab", "bench", "ap3"}, []string{tenant, site, device})
+
+	_, _, _, err = commandTarget(&types.Command{DeviceID: "ap4"})
+	assert.Error(t, err)
+}
+
+func TestExecuteChangeset_WaitsForResults(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed", "result": map[string]interface{}{"channel": 6}},
+		"wifi.set_power":   {"status": "completed"},
+	})
+
+	changeset := newDraft(t, manager, []*types.Command{
+		{ID: "step-1", Tenant: "office", Site: "floor1", DeviceID: "ap1", Operation: "wifi.set_channel", Timeout: 5 * time.Second},
+		{ID: "step-2", DeviceID: "office:floor2:ap2", Operation: "wifi.set_power", Timeout: 5 * time.Second},
+	}, nil)
+
+	require.NoError(t, manager.ExecuteChangeset(context.Background(), changeset.ID))
+
+	stored, err := manager.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusCompleted, stored.Status)
+	require.Len(t, stored.Results, 2)
+	assert.True(t, stored.Results[0].Success)
+	assert.Equal(t, "completed", stored.Results[0].Status)
+	assert.NotEmpty(t, stored.Results[0].DeviceCommandID)
+	assert.Equal(t, types.ResultPhaseExecute, stored.Results[1].Phase)
+
+	assert.Equal(t, []string{
+		"rtk/v1/office/floor1/ap1/cmd/req wifi.set_channel",
+		"rtk/v1/office/floor2/ap2/cmd/req wifi.set_power",
+	}, device.requests())
+}
+
+func TestExecuteChangeset_FailureRollsBack(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+		"wifi.set_ssid":    {"status": "failed", "error": "radio busy"},
+		"wifi.restore":     {"status": "completed"},
+	})
+
+	changeset := newDraft(t, manager, []*types.Command{
+		{ID: "step-1", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel", Timeout: 5 * time.Second},
+		{ID: "step-2", DeviceID: "office/floor1/ap1", Operation: "wifi.set_ssid", Timeout: 5 * time.Second},
+		{ID: "step-3", DeviceID: "office/floor1/ap1", Operation: "wifi.set_power", Timeout: 5 * time.Second},
+	}, []*types.Command{
+		{ID: "undo-1", DeviceID: "office/floor1/ap1", Operation: "wifi.restore", Args: map[string]interface{}{"what": "channel"}, Timeout: 5 * time.Second},
+		{ID: "undo-2", DeviceID: "office/floor1/ap1", Operation: "wifi.restore", Args: map[string]interface{}{"what": "ssid"}, Timeout: 5 * time.Second},
+	})
+
+	err := manager.ExecuteChangeset(context.Background(), changeset.ID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "radio busy")
+
+	stored, err := manager.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusRolledBack, stored.Status)
+	assert.NotNil(t, stored.RolledBackAt)
+
+	var steps []string
+	for _, result := range stored.Results {
+		steps = append(steps, fmt.Sprintf("%s:%s:%s", result.Phase, result.CommandID, result.Status))
+	}
+	assert.Equal(t, []string{
+		"execute:step-1:completed",
+		"execute:step-2:failed",
+		"rollback:undo-2:completed",
+		"rollback:undo-1:completed",
+	}, steps)
+
+	// step-3 never ran
+	assert.Len(t, device.requests(), 4)
+
+	summary := stored.GetSummary()
+	assert.Equal(t, 1, summary.SuccessCount)
+	assert.Equal(t, 1, summary.FailureCount)
+}
+
+func TestExecuteChangeset_Timeout(t *testing.T) {
+	manager, _ := setupExecutionTest(t, map[string]map[string]interface{}{})
+
+	changeset := newDraft(t, manager, []*types.Command{
+		{ID: "step-1", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel", Timeout: time.Second},
+	}, nil)
+
+	err := manager.ExecuteChangeset(context.Background(), changeset.ID)
+	require.Error(t, err)
+
+	stored, err := manager.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusFailed, stored.Status)
+	require.Len(t, stored.Results, 1)
+	assert.Equal(t, "timeout", stored.Results[0].Status)
+	assert.False(t, stored.Results[0].Success)
+}
+
+func TestExecuteChangeset_MissingTarget(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{})
+
+	changeset := newDraft(t, manager, []*types.Command{
+		{ID: "step-1", DeviceID: "ap1", Operation: "wifi.set_channel"},
+	}, nil)
+
+	require.Error(t, manager.ExecuteChangeset(context.Background(), changeset.ID))
+	assert.Empty(t, device.requests())
+}
+
+func TestExecuteChangeset_RollsBackOnlyStepsThatRan(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+		"wifi.restore":     {"status": "completed"},
+	})
+
+	// step-2 has no tenant/site, so it fails before reaching a device
+	changeset := newDraft(t, manager, []*types.Command{
+		{ID: "step-1", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel", Timeout: 5 * time.Second},
+		{ID: "step-2", DeviceID: "ap2", Operation: "wifi.set_channel", Timeout: 5 * time.Second},
+		{ID: "step-3", DeviceID: "office/floor1/ap3", Operation: "wifi.set_channel", Timeout: 5 * time.Second},
+	}, []*types.Command{
+		{ID: "undo-1", DeviceID: "office/floor1/ap1", Operation: "wifi.restore", Timeout: 5 * time.Second},
+		{ID: "undo-2", DeviceID: "office/floor1/ap2", Operation: "wifi.restore", Timeout: 5 * time.Second},
+		{ID: "undo-3", DeviceID: "office/floor1/ap3", Operation: "wifi.restore", Timeout: 5 * time.Second},
+	})
+
+	require.Error(t, manager.ExecuteChangeset(context.Background(), changeset.ID))
+
+	stored, err := manager.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusRolledBack, stored.Status)
+
+	var steps []string
+	for _, result := range stored.Results {
+		steps = append(steps, fmt.Sprintf("%s:%s", result.Phase, result.CommandID))
+	}
+	assert.Equal(t, []string{"execute:step-1", "execute:step-2", "rollback:undo-1"}, steps)
+	assert.Equal(t, []string{
+		"rtk/v1/office/floor1/ap1/cmd/req wifi.set_channel",
+		"rtk/v1/office/floor1/ap1/cmd/req wifi.restore",
+	}, device.requests())
+}
+
+func TestExecuteChangeset_SubSecondTimeout(t *testing.T) {
+	manager, _ := setupExecutionTest(t, map[string]map[string]interface{}{})
+
+	changeset := newDraft(t, manager, []*types.Command{
+		{ID: "step-1", DeviceID: "office/floor1/ap1", Operation: "wifi.set_channel", Timeout: 300 * time.Millisecond},
+	}, nil)
+
+	start := time.Now()
+	require.Error(t, manager.ExecuteChangeset(context.Background(), changeset.ID))
+	assert.Less(t, time.Since(start), time.Second)
+
+	stored, err := manager.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.Results, 1)
+	assert.Equal(t, "timeout", stored.Results[0].Status)
+
+	sent, err := manager.commandManager.GetCommand(stored.Results[0].DeviceCommandID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), sent.TimeoutMS)
+}
@@ -0,0 +1,108 @@
+package changeset
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"rtk_controller/internal/topology"
+	"rtk_controller/pkg/types"
+)
+
+// DeviceStateSource provides the last known state of a device
+type DeviceStateSource interface {
+	GetDevice(tenant, site, deviceID string) (*types.DeviceState, error)
+}
+
+// QualitySource provides connection quality scores and alerts, as
+// implemented by topology.ConnectionQualityMonitor
+type QualitySource interface {
+	GetAllConnectionQuality() map[string]*topology.ConnectionMetrics
+	GetQualityAlerts(resolved bool) []topology.QualityAlert
+}
+
+// SetHealthSources sets where rollout health gates read device health.
+// Either source may be nil; rollouts with a gate check that needs it are
+// then rejected rather than passing unchecked.
+func (m *SimpleManager) SetHealthSources(devices DeviceStateSource, quality QualitySource) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.devices = devices
+	m.quality = quality
+}
+
+// checkGateSources rejects gate checks that have no source to read from.
+// Callers hold m.mutex.
+func (m *SimpleManager) checkGateSources(gate *types.HealthGate) error {
+	if gate == nil {
+		return nil
+	}
+	if gate.RequireOnline && m.devices == nil {
+		return fmt.Errorf("online gate needs device state, which is not available")
+	}
+	if (gate.MinQualityScore > 0 || gate.CheckAlerts) && m.quality == nil {
+		return fmt.Errorf("min_quality and alerts gates need connection quality monitoring, which is not running")
+	}
+	return nil
+}
+
+// checkHealth returns an error describing the first degradation found for
+// the given device keys
+func (m *SimpleManager) checkHealth(gate *types.HealthGate, deviceKeys []string, since time.Time) error {
+	m.mutex.RLock()
+	devices, quality := m.devices, m.quality
+	m.mutex.RUnlock()
+
+	var problems []string
+	ids := make(map[string]bool, len(deviceKeys))
+
+	for _, key := range deviceKeys {
+		parts := strings.SplitN(key, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		tenant, site, deviceID := parts[0], parts[1], parts[2]
+		ids[deviceID] = true
+
+		if gate.RequireOnline && devices != nil {
+			state, err := devices.GetDevice(tenant, site, deviceID)
+			switch {
+			case err != nil || state == nil:
+				problems = append(problems, fmt.Sprintf("%s has no state", key))
+			case !state.Online:
+				problems = append(problems, fmt.Sprintf("%s is offline", key))
+			case state.Health == "critical":
+				problems = append(problems, fmt.Sprintf("%s health is critical", key))
+			}
+		}
+	}
+
+	if quality != nil && gate.MinQualityScore > 0 {
+		for _, metrics := range quality.GetAllConnectionQuality() {
+			if !ids[metrics.DeviceID] {
+				continue
+			}
+			if score := metrics.OverallQuality.Overall; score < gate.MinQualityScore {
+				problems = append(problems, fmt.Sprintf("%s connection %s quality %.2f below %.2f",
+					metrics.DeviceID, metrics.MacAddress, score, gate.MinQualityScore))
+			}
+		}
+	}
+
+	if quality != nil && gate.CheckAlerts {
+		newAlerts := 0
+		for _, alert := range quality.GetQualityAlerts(false) {
+			if ids[alert.DeviceID] && alert.FirstDetected.After(since) {
+				newAlerts++
+			}
+		}
+		if newAlerts > gate.MaxNewAlerts {
+			problems = append(problems, fmt.Sprintf("%d new quality alerts (max %d)", newAlerts, gate.MaxNewAlerts))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,430 @@
+package changeset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"rtk_controller/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// planBatches splits the devices targeted by commands into rollout batches,
+// keeping the order in which devices first appear
+func planBatches(commands []*types.Command, strategy *types.RolloutStrategy) ([][]string, error) {
+	var devices []string
+	seen := make(map[string]bool)
+	for _, cmd := range commands {
+		if _, _, _, err := commandTarget(cmd); err != nil {
+			return nil, err
+		}
+		key := deviceKey(cmd)
+		if !seen[key] {
+			seen[key] = true
+			devices = append(devices, key)
+		}
+	}
+
+	var batches [][]string
+	if strategy.CanarySize > 0 && len(devices) > 0 {
+		n := min(strategy.CanarySize, len(devices))
+		batches = append(batches, devices[:n])
+		devices = devices[n:]
+	}
+	for len(devices) > 0 {
+		n := len(devices)
+		if strategy.BatchSize > 0 {
+			n = min(strategy.BatchSize, n)
+		}
+		batches = append(batches, devices[:n])
+		devices = devices[n:]
+	}
+	return batches, nil
+}
+
+// SetRolloutStrategy sets or clears the rollout strategy of a draft changeset
+func (m *SimpleManager) SetRolloutStrategy(changesetID string, strategy *types.RolloutStrategy) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	changeset, exists := m.activeChangesets[changesetID]
+	if !exists {
+		return fmt.Errorf("changeset %s not found", changesetID)
+	}
+	if changeset.Status != types.ChangesetStatusDraft {
+		return fmt.Errorf("cannot change rollout of changeset in status %s", changeset.Status)
+	}
+	if strategy != nil {
+		if err := m.checkGateSources(strategy.HealthGate); err != nil {
+			return err
+		}
+	}
+
+	changeset.Rollout = strategy
+	return m.persistChangeset(changeset)
+}
+
+// Rollout control actions
+const (
+	RolloutPause  = "pause"
+	RolloutResume = "resume"
+	RolloutAbort  = "abort"
+)
+
+// RolloutControlTopic carries rollout control requests to the controller
+// service, which runs scheduled rollouts: rtk/v1/{tenant}/{site}/_controller/changeset/control
+const RolloutControlTopic = "rtk/v1/%s/%s/_controller/changeset/control"
+
+// RolloutControl asks the process running a rollout to pause, resume or
+// abort it
+type RolloutControl struct {
+	ChangesetID string `json:"changeset_id"`
+	Action      string `json:"action"`
+}
+
+// RolloutControlPublisher sends rollout control requests, as implemented by
+// mqtt.Client
+type RolloutControlPublisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+}
+
+// SetRolloutControl forwards control of rollouts this process does not run
+// to topic, where the service picks it up through a RolloutControlHandler
+func (m *SimpleManager) SetRolloutControl(publisher RolloutControlPublisher, topic string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.controlPublisher = publisher
+	m.controlTopic = topic
+}
+
+// PauseRollout stops a rollout before its next batch
+func (m *SimpleManager) PauseRollout(changesetID string) error {
+	return m.controlRollout(RolloutControl{ChangesetID: changesetID, Action: RolloutPause}, true)
+}
+
+// ResumeRollout continues a paused rollout
+func (m *SimpleManager) ResumeRollout(changesetID string) error {
+	return m.controlRollout(RolloutControl{ChangesetID: changesetID, Action: RolloutResume}, true)
+}
+
+// AbortRollout halts a rollout and rolls back the devices it changed
+func (m *SimpleManager) AbortRollout(changesetID string) error {
+	return m.controlRollout(RolloutControl{ChangesetID: changesetID, Action: RolloutAbort}, true)
+}
+
+// controlRollout applies a control request to a rollout running in this
+// process. Requests for other rollouts are forwarded when forward is set
+// and a control publisher is configured.
+func (m *SimpleManager) controlRollout(control RolloutControl, forward bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	changeset, exists := m.activeChangesets[control.ChangesetID]
+	wake, running := m.rolloutWake[control.ChangesetID]
+	if !exists || !running || changeset.RolloutState == nil {
+		if forward && m.controlPublisher != nil {
+			if err := m.controlPublisher.Publish(m.controlTopic, 1, false, control); err != nil {
+				return fmt.Errorf("failed to send rollout %s request: %w", control.Action, err)
+			}
+			log.WithFields(log.Fields{
+				"changeset_id": control.ChangesetID,
+				"action":       control.Action,
+			}).Info("Forwarded rollout control to the controller service")
+			return nil
+		}
+		if !exists {
+			return fmt.Errorf("changeset %s not found", control.ChangesetID)
+		}
+		return fmt.Errorf("changeset %s has no rollout in progress", control.ChangesetID)
+	}
+
+	state := changeset.RolloutState
+	switch control.Action {
+	case RolloutPause:
+		if state.Paused {
+			return fmt.Errorf("rollout already paused")
+		}
+		state.Paused = true
+	case RolloutResume:
+		if !state.Paused {
+			return fmt.Errorf("rollout is not paused")
+		}
+		state.Paused = false
+	case RolloutAbort:
+		state.Aborted = true
+	default:
+		return fmt.Errorf("unknown rollout action %q", control.Action)
+	}
+	if err := m.persistChangeset(changeset); err != nil {
+		log.WithError(err).Warn("Failed to persist rollout state")
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// RolloutControlHandler applies rollout control requests forwarded by CLI
+// and MCP processes
+type RolloutControlHandler struct {
+	manager *SimpleManager
+}
+
+// NewRolloutControlHandler creates a handler for RolloutControlTopic
+func NewRolloutControlHandler(manager *SimpleManager) *RolloutControlHandler {
+	return &RolloutControlHandler{manager: manager}
+}
+
+func (h *RolloutControlHandler) HandleMessage(topic string, payload []byte) error {
+	var control RolloutControl
+	if err := json.Unmarshal(payload, &control); err != nil {
+		return fmt.Errorf("failed to parse rollout control: %w", err)
+	}
+
+	if err := h.manager.controlRollout(control, false); err != nil {
+		return fmt.Errorf("rollout %s of %s not applied: %w", control.Action, control.ChangesetID, err)
+	}
+	log.WithFields(log.Fields{
+		"changeset_id": control.ChangesetID,
+		"action":       control.Action,
+	}).Info("Applied forwarded rollout control")
+	return nil
+}
+
+// executeRollout runs a changeset batch by batch. A failed command, a failed
+// health gate or an abort halts the rollout and rolls back the devices that
+// were changed so far.
+func (m *SimpleManager) executeRollout(ctx context.Context, changeset *types.Changeset) error {
+	strategy := changeset.Rollout
+	startTime := time.Now()
+
+	batches, err := planBatches(changeset.Commands, strategy)
+	if err == nil {
+		// The strategy may have been set by a process with other sources
+		m.mutex.RLock()
+		err = m.checkGateSources(strategy.HealthGate)
+		m.mutex.RUnlock()
+	}
+	if err != nil {
+		m.mutex.Lock()
+		changeset.Status = types.ChangesetStatusFailed
+		changeset.RolloutState = &types.RolloutState{HaltReason: err.Error()}
+		if perr := m.persistChangeset(changeset); perr != nil {
+			log.WithError(perr).Error("Failed to persist changeset")
+		}
+		m.mutex.Unlock()
+		return err
+	}
+
+	wake := make(chan struct{}, 1)
+	m.mutex.Lock()
+	changeset.RolloutState = &types.RolloutState{Batches: batches}
+	m.rolloutWake[changeset.ID] = wake
+	if err := m.persistChangeset(changeset); err != nil {
+		log.WithError(err).Warn("Failed to persist rollout state")
+	}
+	m.mutex.Unlock()
+
+	return m.runRollout(ctx, changeset, wake, 0, startTime)
+}
+
+// recoverRollouts continues rollouts that were paused when the controller
+// stopped. They stay paused until resumed or aborted. Callers hold m.mutex.
+func (m *SimpleManager) recoverRollouts() {
+	for _, changeset := range m.activeChangesets {
+		state := changeset.RolloutState
+		if changeset.Status != types.ChangesetStatusPaused || changeset.Rollout == nil || state == nil {
+			continue
+		}
+
+		// Pausing happens between batches, after CurrentBatch has run
+		state.Paused = true
+		wake := make(chan struct{}, 1)
+		m.rolloutWake[changeset.ID] = wake
+		go func(changeset *types.Changeset, next int) {
+			if err := m.runRollout(m.ctx, changeset, wake, next, time.Now()); err != nil {
+				log.WithError(err).WithField("changeset_id", changeset.ID).Warn("Recovered rollout did not complete")
+			}
+		}(changeset, state.CurrentBatch+1)
+
+		log.WithField("changeset_id", changeset.ID).Info("Recovered paused changeset rollout")
+	}
+}
+
+// runRollout runs the planned batches from index first on. Batches before
+// first have already run.
+func (m *SimpleManager) runRollout(ctx context.Context, changeset *types.Changeset, wake chan struct{}, first int, startTime time.Time) error {
+	strategy := changeset.Rollout
+	batches := changeset.RolloutState.Batches
+
+	defer func() {
+		m.mutex.Lock()
+		delete(m.rolloutWake, changeset.ID)
+		m.mutex.Unlock()
+	}()
+
+	touched := make(map[string]bool)
+	var touchedKeys []string
+	for _, batch := range batches[:first] {
+		for _, key := range batch {
+			touched[key] = true
+			touchedKeys = append(touchedKeys, key)
+		}
+	}
+	var haltReason string
+
+batches:
+	for i := first; i < len(batches); i++ {
+		batch := batches[i]
+		if i > 0 && !m.awaitResume(ctx, changeset, wake) {
+			m.mutex.RLock()
+			aborted := changeset.RolloutState.Aborted
+			m.mutex.RUnlock()
+			if !aborted {
+				// Stopped while paused; the rollout stays paused and the
+				// scheduler process continues it after a restart
+				return fmt.Errorf("rollout stopped while paused before batch %d", i+1)
+			}
+			haltReason = "rollout aborted"
+			break
+		}
+
+		m.mutex.Lock()
+		changeset.RolloutState.CurrentBatch = i
+		m.mutex.Unlock()
+
+		log.WithFields(log.Fields{
+			"changeset_id": changeset.ID,
+			"batch":        i + 1,
+			"batches":      len(batches),
+			"devices":      len(batch),
+		}).Info("Rolling out changeset batch")
+
+		inBatch := make(map[string]bool, len(batch))
+		for _, key := range batch {
+			inBatch[key] = true
+			touched[key] = true
+			touchedKeys = append(touchedKeys, key)
+		}
+
+		for _, cmd := range changeset.Commands {
+			if !inBatch[deviceKey(cmd)] {
+				continue
+			}
+			result := m.runCommand(ctx, cmd, types.ResultPhaseExecute)
+			m.recordResult(changeset, result)
+			if !result.Success {
+				haltReason = fmt.Sprintf("command %s failed in batch %d: %s", cmd.ID, i+1, result.Message)
+				break batches
+			}
+		}
+
+		if !m.observe(ctx, changeset, wake, strategy.Pause) {
+			haltReason = "rollout aborted"
+			break
+		}
+
+		if strategy.HealthGate != nil {
+			if err := m.checkHealth(strategy.HealthGate, touchedKeys, startTime); err != nil {
+				haltReason = fmt.Sprintf("health gate failed after batch %d: %v", i+1, err)
+				break
+			}
+		}
+	}
+
+	m.mutex.Lock()
+	executedAt := time.Now()
+	changeset.ExecutedAt = &executedAt
+	changeset.RolloutState.HaltReason = haltReason
+	if haltReason == "" {
+		changeset.Status = types.ChangesetStatusCompleted
+	} else {
+		changeset.Status = types.ChangesetStatusFailed
+	}
+	if err := m.persistChangeset(changeset); err != nil {
+		log.WithError(err).Error("Failed to persist changeset after rollout")
+	}
+	m.mutex.Unlock()
+
+	if haltReason == "" {
+		log.WithFields(log.Fields{
+			"changeset_id": changeset.ID,
+			"duration":     time.Since(startTime),
+		}).Info("Changeset rollout completed")
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"changeset_id": changeset.ID,
+		"reason":       haltReason,
+	}).Error("Changeset rollout halted")
+
+	if len(changeset.RollbackCommands) == 0 {
+		return fmt.Errorf("rollout halted: %s", haltReason)
+	}
+	touchedDevice := func(_ int, cmd *types.Command) bool { return touched[deviceKey(cmd)] }
+	if err := m.rollback(m.ctx, changeset, touchedDevice); err != nil {
+		return fmt.Errorf("rollout halted: %s; %w", haltReason, err)
+	}
+	return fmt.Errorf("rollout halted: %s; changed devices rolled back", haltReason)
+}
+
+// awaitResume blocks while the rollout is paused. It returns false when the
+// rollout was aborted or ctx ended.
+func (m *SimpleManager) awaitResume(ctx context.Context, changeset *types.Changeset, wake <-chan struct{}) bool {
+	for {
+		m.mutex.Lock()
+		state := changeset.RolloutState
+		if state.Aborted {
+			m.mutex.Unlock()
+			return false
+		}
+		if !state.Paused {
+			changeset.Status = types.ChangesetStatusExecuting
+			m.mutex.Unlock()
+			return true
+		}
+		if changeset.Status != types.ChangesetStatusPaused {
+			changeset.Status = types.ChangesetStatusPaused
+			if err := m.persistChangeset(changeset); err != nil {
+				log.WithError(err).Warn("Failed to persist paused changeset")
+			}
+			log.WithField("changeset_id", changeset.ID).Info("Changeset rollout paused")
+		}
+		m.mutex.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// observe waits out the pause after a batch. It returns false when the
+// rollout was aborted or ctx ended.
+func (m *SimpleManager) observe(ctx context.Context, changeset *types.Changeset, wake <-chan struct{}, pause time.Duration) bool {
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+
+	for {
+		m.mutex.RLock()
+		aborted := changeset.RolloutState.Aborted
+		m.mutex.RUnlock()
+		if aborted {
+			return false
+		}
+
+		select {
+		case <-timer.C:
+			return true
+		case <-wake:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
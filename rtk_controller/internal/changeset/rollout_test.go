@@ -0,0 +1,347 @@
+package changeset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"rtk_controller/internal/command"
+	"rtk_controller/internal/topology"
+	"rtk_controller/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStates is a DeviceStateSource keyed by tenant:site:device_id
+type fakeStates struct {
+	mu     sync.Mutex
+	states map[string]*types.DeviceState
+}
+
+func (f *fakeStates) GetDevice(tenant, site, deviceID string) (*types.DeviceState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state, ok := f.states[fmt.Sprintf("%s:%s:%s", tenant, site, deviceID)]
+	if !ok {
+		return nil, fmt.Errorf("device not found")
+	}
+	return state, nil
+}
+
+type fakeQuality struct {
+	metrics map[string]*topology.ConnectionMetrics
+	alerts  []topology.QualityAlert
+}
+
+func (f *fakeQuality) GetAllConnectionQuality() map[string]*topology.ConnectionMetrics {
+	return f.metrics
+}
+
+func (f *fakeQuality) GetQualityAlerts(resolved bool) []topology.QualityAlert {
+	return f.alerts
+}
+
+func rolloutCommands(op string, devices ...string) []*types.Command {
+	var commands []*types.Command
+	for _, device := range devices {
+		commands = append(commands, &types.Command{
+			ID:        op + "-" + device,
+			DeviceID:  "office/floor1/" + device,
+			Operation: op,
+			Timeout:   5 * time.Second,
+		})
+	}
+	return commands
+}
+
+func TestPlanBatches(t *testing.T) {
+	commands := rolloutCommands("wifi.set_channel", "ap1", "ap2", "ap3", "ap4", "ap5")
+	commands = append(commands, rolloutCommands("wifi.set_power", "ap1")...)
+
+	batches, err := planBatches(commands, &types.RolloutStrategy{CanarySize: 1, BatchSize: 3})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"office:floor1:ap1"},
+		{"office:floor1:ap2", "office:floor1:ap3", "office:floor1:ap4"},
+		{"office:floor1:ap5"},
+	}, batches)
+
+	batches, err = planBatches(commands, &types.RolloutStrategy{CanarySize: 2})
+	require.NoError(t, err)
+	assert.Len(t, batches, 2)
+	assert.Len(t, batches[1], 3)
+
+	_, err = planBatches([]*types.Command{{ID: "bad", DeviceID: "ap1"}}, &types.RolloutStrategy{})
+	assert.Error(t, err)
+}
+
+func TestRollout_RunsBatchesInOrder(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+	})
+
+	changeset := newDraft(t, manager, rolloutCommands("wifi.set_channel", "ap1", "ap2", "ap3"), nil)
+	require.NoError(t, manager.SetRolloutStrategy(changeset.ID, &types.RolloutStrategy{CanarySize: 1, BatchSize: 2}))
+
+	require.NoError(t, manager.ExecuteChangeset(context.Background(), changeset.ID))
+
+	stored, err := manager.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusCompleted, stored.Status)
+	require.NotNil(t, stored.RolloutState)
+	assert.Len(t, stored.RolloutState.Batches, 2)
+	assert.Equal(t, 1, stored.RolloutState.CurrentBatch)
+	assert.Empty(t, stored.RolloutState.HaltReason)
+	assert.Len(t, device.requests(), 3)
+
+	assert.Error(t, manager.SetRolloutStrategy(changeset.ID, nil), "rollout can only change on drafts")
+}
+
+func TestRollout_HealthGateHaltsAndRollsBackTouchedDevices(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+		"wifi.restore":     {"status": "completed"},
+	})
+	manager.SetHealthSources(&fakeStates{states: map[string]*types.DeviceState{
+		"office:floor1:ap1": {Online: true, Health: "ok"},
+		"office:floor1:ap2": {Online: false},
+		"office:floor1:ap3": {Online: true},
+	}}, nil)
+
+	changeset := newDraft(t, manager,
+		rolloutCommands("wifi.set_channel", "ap1", "ap2", "ap3"),
+		rolloutCommands("wifi.restore", "ap1", "ap2", "ap3"))
+	require.NoError(t, manager.SetRolloutStrategy(changeset.ID, &types.RolloutStrategy{
+		CanarySize: 1,
+		BatchSize:  1,
+		HealthGate: &types.HealthGate{RequireOnline: true},
+	}))
+
+	err := manager.ExecuteChangeset(context.Background(), changeset.ID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "office:floor1:ap2 is offline")
+
+	stored, err := manager.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusRolledBack, stored.Status)
+	assert.Equal(t, 1, stored.RolloutState.CurrentBatch)
+	assert.Contains(t, stored.RolloutState.HaltReason, "batch 2")
+
+	// ap3 was never changed, so it is not rolled back either
+	assert.Equal(t, []string{
+		"rtk/v1/office/floor1/ap1/cmd/req wifi.set_channel",
+		"rtk/v1/office/floor1/ap2/cmd/req wifi.set_channel",
+		"rtk/v1/office/floor1/ap2/cmd/req wifi.restore",
+		"rtk/v1/office/floor1/ap1/cmd/req wifi.restore",
+	}, device.requests())
+}
+
+func TestRollout_RejectsGateWithoutSource(t *testing.T) {
+	manager, device := setupExecutionTest(t, nil)
+	manager.SetHealthSources(&fakeStates{}, nil)
+
+	changeset := newDraft(t, manager, rolloutCommands("wifi.set_channel", "ap1"), nil)
+	for _, gate := range []*types.HealthGate{
+		{MinQualityScore: 0.6},
+		{CheckAlerts: true},
+	} {
+		assert.ErrorContains(t, manager.SetRolloutStrategy(changeset.ID, &types.RolloutStrategy{HealthGate: gate}),
+			"connection quality monitoring")
+	}
+
+	// The service passes its connection quality monitor
+	monitor := topology.NewConnectionQualityMonitor(&topology.Manager{}, nil, nil, nil, nil, nil, topology.DefaultQualityMonitorConfig())
+	manager.SetHealthSources(&fakeStates{}, monitor)
+	require.NoError(t, manager.SetRolloutStrategy(changeset.ID, &types.RolloutStrategy{
+		HealthGate: &types.HealthGate{MinQualityScore: 0.6, CheckAlerts: true},
+	}))
+	require.NoError(t, manager.SetRolloutStrategy(changeset.ID, &types.RolloutStrategy{
+		HealthGate: &types.HealthGate{RequireOnline: true},
+	}))
+
+	// A strategy stored by a process that had the source is refused at execution
+	manager.SetHealthSources(nil, nil)
+	assert.ErrorContains(t, manager.ExecuteChangeset(context.Background(), changeset.ID), "online gate")
+	assert.Empty(t, device.requests())
+}
+
+func TestCheckHealth_QualityAndAlerts(t *testing.T) {
+	manager, _ := setupExecutionTest(t, nil)
+	since := time.Now()
+
+	quality := &fakeQuality{
+		metrics: map[string]*topology.ConnectionMetrics{
+			"ap1-aa": {DeviceID: "ap1", MacAddress: "aa", OverallQuality: topology.QualityScore{Overall: 0.4}},
+			"ap9-bb": {DeviceID: "ap9", MacAddress: "bb", OverallQuality: topology.QualityScore{Overall: 0.1}},
+		},
+		alerts: []topology.QualityAlert{
+			{DeviceID: "ap1", FirstDetected: since.Add(-time.Minute)},
+			{DeviceID: "ap1", FirstDetected: since.Add(time.Second)},
+		},
+	}
+	manager.SetHealthSources(nil, quality)
+	keys := []string{"office:floor1:ap1"}
+
+	assert.NoError(t, manager.checkHealth(&types.HealthGate{RequireOnline: true}, keys, since))
+	assert.NoError(t, manager.checkHealth(&types.HealthGate{MinQualityScore: 0.3}, keys, since))
+	assert.ErrorContains(t, manager.checkHealth(&types.HealthGate{MinQualityScore: 0.5}, keys, since), "quality 0.40")
+	assert.NoError(t, manager.checkHealth(&types.HealthGate{CheckAlerts: true, MaxNewAlerts: 1}, keys, since))
+	assert.ErrorContains(t, manager.checkHealth(&types.HealthGate{CheckAlerts: true}, keys, since), "1 new quality alerts")
+}
+
+func TestRollout_PauseResumeAbort(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+		"wifi.restore":     {"status": "completed"},
+	})
+
+	run := func(pause time.Duration) (*types.Changeset, chan error) {
+		changeset := newDraft(t, manager,
+			rolloutCommands("wifi.set_channel", "ap1", "ap2"),
+			rolloutCommands("wifi.restore", "ap1", "ap2"))
+		require.NoError(t, manager.SetRolloutStrategy(changeset.ID, &types.RolloutStrategy{CanarySize: 1, Pause: pause}))
+
+		done := make(chan error, 1)
+		go func() { done <- manager.ExecuteChangeset(context.Background(), changeset.ID) }()
+		return changeset, done
+	}
+
+	status := func(id string) types.ChangesetStatus {
+		cs, err := manager.GetChangeset(id)
+		require.NoError(t, err)
+		manager.mutex.RLock()
+		defer manager.mutex.RUnlock()
+		return cs.Status
+	}
+
+	// Pause during the canary observation, then resume
+	changeset, done := run(200 * time.Millisecond)
+	require.Eventually(t, func() bool { return manager.PauseRollout(changeset.ID) == nil }, 2*time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool { return status(changeset.ID) == types.ChangesetStatusPaused }, 2*time.Second, 5*time.Millisecond)
+	assert.Len(t, device.requests(), 1, "second batch must wait while paused")
+	require.NoError(t, manager.ResumeRollout(changeset.ID))
+	require.NoError(t, <-done)
+	assert.Equal(t, types.ChangesetStatusCompleted, status(changeset.ID))
+	assert.Error(t, manager.ResumeRollout(changeset.ID), "rollout no longer running")
+
+	// Abort during the canary observation rolls back the canary only
+	changeset, done = run(time.Minute)
+	require.Eventually(t, func() bool { return manager.AbortRollout(changeset.ID) == nil }, 2*time.Second, 5*time.Millisecond)
+	err := <-done
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "aborted")
+	assert.Equal(t, types.ChangesetStatusRolledBack, status(changeset.ID))
+	assert.Equal(t, "rtk/v1/office/floor1/ap1/cmd/req wifi.restore", device.requests()[len(device.requests())-1])
+	assert.Len(t, device.requests(), 4)
+}
+
+// controlBus delivers forwarded rollout control requests to a handler, as
+// the broker does between a CLI process and the service
+type controlBus struct {
+	handler *RolloutControlHandler
+	topics  []string
+	errs    []error
+}
+
+func (b *controlBus) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	b.topics = append(b.topics, topic)
+	b.errs = append(b.errs, b.handler.HandleMessage(topic, data))
+	return nil
+}
+
+func TestRollout_ControlForwardedToService(t *testing.T) {
+	service, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+		"wifi.restore":     {"status": "completed"},
+	})
+	changeset := newDraft(t, service,
+		rolloutCommands("wifi.set_channel", "ap1", "ap2"),
+		rolloutCommands("wifi.restore", "ap1", "ap2"))
+	require.NoError(t, service.SetRolloutStrategy(changeset.ID, &types.RolloutStrategy{CanarySize: 1, Pause: time.Minute}))
+	done := make(chan error, 1)
+	go func() { done <- service.ExecuteChangeset(context.Background(), changeset.ID) }()
+	require.Eventually(t, func() bool { return len(device.requests()) == 1 }, 2*time.Second, 5*time.Millisecond)
+
+	// A CLI process does not run the rollout
+	cli := NewSimpleManager(service.storage, command.NewManager(device, service.storage))
+	assert.Error(t, cli.PauseRollout(changeset.ID))
+
+	topic := fmt.Sprintf(RolloutControlTopic, "office", "floor1")
+	bus := &controlBus{handler: NewRolloutControlHandler(service)}
+	cli.SetRolloutControl(bus, topic)
+
+	require.NoError(t, cli.PauseRollout(changeset.ID))
+	require.NoError(t, cli.PauseRollout(changeset.ID))
+	require.NoError(t, cli.AbortRollout(changeset.ID))
+	assert.Equal(t, []string{topic, topic, topic}, bus.topics)
+	assert.NoError(t, bus.errs[0])
+	assert.Error(t, bus.errs[1], "already paused in the service")
+	assert.NoError(t, bus.errs[2])
+
+	err := <-done
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "aborted")
+	stored, err := service.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+	assert.Equal(t, types.ChangesetStatusRolledBack, stored.Status)
+}
+
+func TestRollout_PausedSurvivesRestart(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+		"wifi.restore":     {"status": "completed"},
+	})
+	manager.EnableScheduler()
+	require.NoError(t, manager.Start(context.Background()))
+
+	changeset := newDraft(t, manager,
+		rolloutCommands("wifi.set_channel", "ap1", "ap2"),
+		rolloutCommands("wifi.restore", "ap1", "ap2"))
+	require.NoError(t, manager.SetRolloutStrategy(changeset.ID, &types.RolloutStrategy{CanarySize: 1, Pause: 100 * time.Millisecond}))
+
+	done := make(chan error, 1)
+	go func() { done <- manager.ExecuteChangeset(manager.ctx, changeset.ID) }()
+	require.Eventually(t, func() bool { return manager.PauseRollout(changeset.ID) == nil }, 2*time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool {
+		stored, err := manager.loadChangeset(changeset.ID)
+		return err == nil && stored.Status == types.ChangesetStatusPaused
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// Shutting down keeps the rollout paused instead of failing it
+	require.NoError(t, manager.Stop())
+	require.Error(t, <-done)
+	stored, err := manager.loadChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusPaused, stored.Status)
+
+	restarted := NewSimpleManager(manager.storage, command.NewManager(device, manager.storage))
+	device.manager = restarted.commandManager
+	restarted.EnableScheduler()
+	require.NoError(t, restarted.Start(context.Background()))
+	t.Cleanup(func() { restarted.Stop() })
+
+	recovered, err := restarted.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusPaused, recovered.Status)
+	assert.Len(t, device.requests(), 1, "the second batch waits for resume")
+
+	require.NoError(t, restarted.ResumeRollout(changeset.ID))
+	require.Eventually(t, func() bool {
+		stored, err := restarted.loadChangeset(changeset.ID)
+		return err == nil && stored.Status == types.ChangesetStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{
+		"rtk/v1/office/floor1/ap1/cmd/req wifi.set_channel",
+		"rtk/v1/office/floor1/ap2/cmd/req wifi.set_channel",
+	}, device.requests())
+}
@@ -0,0 +1,458 @@
+package changeset
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/types"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Storage key prefixes for schedules and maintenance windows
+const (
+	scheduleKeyPrefix = "changeset_schedule:"
+	windowKeyPrefix   = "maintenance_window:"
+)
+
+// ExecuteOptions controls a single changeset execution
+type ExecuteOptions struct {
+	// Force executes even outside the maintenance windows of the sites
+	// the changeset touches
+	Force bool
+}
+
+// location returns the time zone of a schedule or window
+func location(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	return loc, nil
+}
+
+// AddMaintenanceWindow stores a maintenance window for a site
+func (m *SimpleManager) AddMaintenanceWindow(window *types.MaintenanceWindow) error {
+	if window.Tenant == "" || window.Site == "" {
+		return fmt.Errorf("maintenance window needs a tenant and site")
+	}
+	if _, err := parseCron(window.Cron); err != nil {
+		return err
+	}
+	if window.Duration <= 0 {
+		return fmt.Errorf("maintenance window duration must be positive")
+	}
+	if _, err := location(window.Timezone); err != nil {
+		return err
+	}
+
+	if window.ID == "" {
+		window.ID = uuid.New().String()
+	}
+	if window.CreatedAt.IsZero() {
+		window.CreatedAt = time.Now()
+	}
+
+	data, err := json.Marshal(window)
+	if err != nil {
+		return fmt.Errorf("failed to marshal maintenance window: %w", err)
+	}
+	key := fmt.Sprintf("%s%s:%s:%s", windowKeyPrefix, window.Tenant, window.Site, window.ID)
+	if err := m.storage.Set(key, string(data)); err != nil {
+		return fmt.Errorf("failed to store maintenance window: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"window_id": window.ID,
+		"tenant":    window.Tenant,
+		"site":      window.Site,
+		"cron":      window.Cron,
+		"duration":  window.Duration,
+	}).Info("Added maintenance window")
+	return nil
+}
+
+// ListMaintenanceWindows returns the maintenance windows of a site, or of
+// every site when tenant and site are empty
+func (m *SimpleManager) ListMaintenanceWindows(tenant, site string) ([]*types.MaintenanceWindow, error) {
+	prefix := windowKeyPrefix
+	if tenant != "" {
+		prefix += tenant + ":"
+		if site != "" {
+			prefix += site + ":"
+		}
+	}
+
+	windows := make([]*types.MaintenanceWindow, 0)
+	err := m.storage.View(func(tx storage.Transaction) error {
+		return tx.IteratePrefix(prefix, func(key, value string) error {
+			var window types.MaintenanceWindow
+			if err := json.Unmarshal([]byte(value), &window); err != nil {
+				log.WithError(err).WithField("key", key).Warn("Skipping invalid maintenance window")
+				return nil
+			}
+			windows = append(windows, &window)
+			return nil
+		})
+	})
+	return windows, err
+}
+
+// RemoveMaintenanceWindow deletes a maintenance window by ID
+func (m *SimpleManager) RemoveMaintenanceWindow(windowID string) error {
+	windows, err := m.ListMaintenanceWindows("", "")
+	if err != nil {
+		return err
+	}
+	for _, window := range windows {
+		if window.ID == windowID {
+			return m.storage.Delete(fmt.Sprintf("%s%s:%s:%s", windowKeyPrefix, window.Tenant, window.Site, window.ID))
+		}
+	}
+	return fmt.Errorf("maintenance window %s not found", windowID)
+}
+
+// windowOpen reports whether now falls inside the window, and otherwise
+// when it opens next
+func windowOpen(window *types.MaintenanceWindow, now time.Time) (bool, time.Time) {
+	cron, err := parseCron(window.Cron)
+	if err != nil {
+		return false, time.Time{}
+	}
+	loc, err := location(window.Timezone)
+	if err != nil {
+		return false, time.Time{}
+	}
+
+	local := now.In(loc)
+	// The latest opening that is still within Duration of now
+	opened := cron.Next(local.Add(-window.Duration))
+	if !opened.IsZero() && !opened.After(local) {
+		return true, opened
+	}
+	return false, cron.Next(local)
+}
+
+// checkWindows returns an error naming the first site touched by commands
+// that has maintenance windows, none of which is open at now. Sites without
+// windows are not restricted.
+func (m *SimpleManager) checkWindows(commands []*types.Command, now time.Time) error {
+	sites := make(map[string]bool)
+	var order []string
+	for _, cmd := range commands {
+		tenant, site, _, err := commandTarget(cmd)
+		if err != nil {
+			continue
+		}
+		key := tenant + ":" + site
+		if !sites[key] {
+			sites[key] = true
+			order = append(order, key)
+		}
+	}
+
+	for _, key := range order {
+		tenant, site, _ := strings.Cut(key, ":")
+		windows, err := m.ListMaintenanceWindows(tenant, site)
+		if err != nil {
+			return fmt.Errorf("failed to read maintenance windows for %s/%s: %w", tenant, site, err)
+		}
+		if len(windows) == 0 {
+			continue
+		}
+
+		var next time.Time
+		open := false
+		for _, window := range windows {
+			inside, at := windowOpen(window, now)
+			if inside {
+				open = true
+				break
+			}
+			if !at.IsZero() && (next.IsZero() || at.Before(next)) {
+				next = at
+			}
+		}
+		if !open {
+			if next.IsZero() {
+				return fmt.Errorf("site %s/%s is outside its maintenance windows", tenant, site)
+			}
+			return fmt.Errorf("site %s/%s is outside its maintenance windows (next opens %s)",
+				tenant, site, next.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// ScheduleChangeset stores a schedule that will execute a changeset that
+// has not run yet. The schedule survives controller restarts.
+func (m *SimpleManager) ScheduleChangeset(schedule *types.ChangesetSchedule) (*types.ChangesetSchedule, error) {
+	changeset, err := m.GetChangeset(schedule.ChangesetID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if hasStarted(changeset) {
+		return nil, fmt.Errorf("cannot schedule changeset in status %s", changeset.Status)
+	}
+
+	loc, err := location(schedule.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	now := m.now()
+
+	switch schedule.Type {
+	case types.ScheduleTypeOnce:
+		if schedule.RunAt == nil {
+			return nil, fmt.Errorf("one-off schedule needs a run time")
+		}
+		if !schedule.RunAt.After(now) {
+			return nil, fmt.Errorf("run time %s is in the past", schedule.RunAt.Format(time.RFC3339))
+		}
+		next := *schedule.RunAt
+		schedule.NextRun = &next
+	case types.ScheduleTypeCron:
+		cron, err := parseCron(schedule.Cron)
+		if err != nil {
+			return nil, err
+		}
+		next := cron.Next(now.In(loc))
+		if next.IsZero() {
+			return nil, fmt.Errorf("cron expression %q never matches", schedule.Cron)
+		}
+		schedule.NextRun = &next
+	default:
+		return nil, fmt.Errorf("unknown schedule type %q", schedule.Type)
+	}
+
+	schedule.ID = uuid.New().String()
+	schedule.Status = types.ScheduleStatusScheduled
+	schedule.CreatedAt = now
+	if err := m.persistSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"schedule_id":  schedule.ID,
+		"changeset_id": schedule.ChangesetID,
+		"type":         schedule.Type,
+		"next_run":     schedule.NextRun.Format(time.RFC3339),
+		"force":        schedule.Force,
+	}).Info("Scheduled changeset")
+	return schedule, nil
+}
+
+// ListSchedules returns all changeset schedules ordered by next run
+func (m *SimpleManager) ListSchedules() ([]*types.ChangesetSchedule, error) {
+	schedules := make([]*types.ChangesetSchedule, 0)
+	err := m.storage.View(func(tx storage.Transaction) error {
+		return tx.IteratePrefix(scheduleKeyPrefix, func(key, value string) error {
+			var schedule types.ChangesetSchedule
+			if err := json.Unmarshal([]byte(value), &schedule); err != nil {
+				log.WithError(err).WithField("key", key).Warn("Skipping invalid changeset schedule")
+				return nil
+			}
+			schedules = append(schedules, &schedule)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		a, b := schedules[i].NextRun, schedules[j].NextRun
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(*b)
+	})
+	return schedules, nil
+}
+
+// CancelSchedule cancels a schedule that has not started its changeset
+func (m *SimpleManager) CancelSchedule(scheduleID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	schedule, err := m.loadSchedule(scheduleID)
+	if err != nil {
+		return err
+	}
+	if schedule.Status != types.ScheduleStatusScheduled {
+		return fmt.Errorf("cannot cancel schedule in status %s", schedule.Status)
+	}
+
+	schedule.Status = types.ScheduleStatusCancelled
+	schedule.NextRun = nil
+	return m.persistSchedule(schedule)
+}
+
+// scheduleWorker starts due schedules until the manager stops
+func (m *SimpleManager) scheduleWorker() {
+	ticker := time.NewTicker(m.config.ScheduleInterval)
+	defer ticker.Stop()
+
+	m.runDueSchedules(m.now())
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.runDueSchedules(m.now())
+		}
+	}
+}
+
+// runDueSchedules starts the changesets of schedules due at now. Runs that
+// were missed while the controller was down are started on the first pass.
+func (m *SimpleManager) runDueSchedules(now time.Time) {
+	schedules, err := m.ListSchedules()
+	if err != nil {
+		log.WithError(err).Error("Failed to list changeset schedules")
+		return
+	}
+
+	for _, due := range schedules {
+		if due.Status != types.ScheduleStatusScheduled || due.NextRun == nil || due.NextRun.After(now) {
+			continue
+		}
+
+		// Reload under the lock; the schedule may have been cancelled since
+		m.mutex.Lock()
+		schedule, err := m.loadSchedule(due.ID)
+		if err == nil && schedule.Status != types.ScheduleStatusScheduled {
+			m.mutex.Unlock()
+			continue
+		}
+		if err == nil {
+			schedule.Status = types.ScheduleStatusRunning
+			schedule.LastRun = &now
+			err = m.persistSchedule(schedule)
+		}
+		m.mutex.Unlock()
+		if err != nil {
+			log.WithError(err).WithField("schedule_id", due.ID).Error("Failed to start changeset schedule")
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"schedule_id":  schedule.ID,
+			"changeset_id": schedule.ChangesetID,
+		}).Info("Starting scheduled changeset")
+
+		go func(schedule *types.ChangesetSchedule) {
+			err := m.ExecuteChangesetWithOptions(m.ctx, schedule.ChangesetID, ExecuteOptions{Force: schedule.Force})
+			m.finishSchedule(schedule, err)
+		}(schedule)
+	}
+}
+
+// finishSchedule records the outcome of a scheduled run. A cron schedule
+// whose changeset did not start (outside a window, not yet approved) tries
+// again at its next match.
+func (m *SimpleManager) finishSchedule(schedule *types.ChangesetSchedule, runErr error) {
+	changeset, _ := m.GetChangeset(schedule.ChangesetID)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	schedule.NextRun = nil
+	switch {
+	case runErr == nil:
+		schedule.Status = types.ScheduleStatusCompleted
+		schedule.LastResult = "completed"
+	case schedule.Type == types.ScheduleTypeCron && changeset != nil && !hasStarted(changeset):
+		schedule.Status = types.ScheduleStatusScheduled
+		schedule.LastResult = runErr.Error()
+		if cron, err := parseCron(schedule.Cron); err == nil {
+			if loc, err := location(schedule.Timezone); err == nil {
+				if next := cron.Next(m.now().In(loc)); !next.IsZero() {
+					schedule.NextRun = &next
+				}
+			}
+		}
+		if schedule.NextRun == nil {
+			schedule.Status = types.ScheduleStatusFailed
+		}
+	default:
+		schedule.Status = types.ScheduleStatusFailed
+		schedule.LastResult = runErr.Error()
+	}
+
+	if err := m.persistSchedule(schedule); err != nil {
+		log.WithError(err).WithField("schedule_id", schedule.ID).Error("Failed to persist changeset schedule")
+	}
+
+	entry := log.WithFields(log.Fields{
+		"schedule_id":  schedule.ID,
+		"changeset_id": schedule.ChangesetID,
+		"status":       schedule.Status,
+	})
+	if runErr != nil {
+		entry.WithError(runErr).Warn("Scheduled changeset did not complete")
+	} else {
+		entry.Info("Scheduled changeset completed")
+	}
+}
+
+// hasStarted reports whether a changeset has left the draft and approval states
+func hasStarted(changeset *types.Changeset) bool {
+	switch changeset.Status {
+	case types.ChangesetStatusDraft, types.ChangesetStatusPendingApproval, types.ChangesetStatusApproved:
+		return false
+	}
+	return true
+}
+
+// recoverSchedules marks schedules that were running when the controller
+// stopped as failed. Callers hold m.mutex.
+func (m *SimpleManager) recoverSchedules() {
+	schedules, err := m.ListSchedules()
+	if err != nil {
+		log.WithError(err).Warn("Failed to load changeset schedules")
+		return
+	}
+	for _, schedule := range schedules {
+		if schedule.Status != types.ScheduleStatusRunning {
+			continue
+		}
+		schedule.Status = types.ScheduleStatusFailed
+		schedule.LastResult = "interrupted by controller restart"
+		if err := m.persistSchedule(schedule); err != nil {
+			log.WithError(err).WithField("schedule_id", schedule.ID).Warn("Failed to persist changeset schedule")
+		}
+	}
+}
+
+func (m *SimpleManager) persistSchedule(schedule *types.ChangesetSchedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+	return m.storage.Set(scheduleKeyPrefix+schedule.ID, string(data))
+}
+
+func (m *SimpleManager) loadSchedule(scheduleID string) (*types.ChangesetSchedule, error) {
+	data, err := m.storage.Get(scheduleKeyPrefix + scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %s not found", scheduleID)
+	}
+	var schedule types.ChangesetSchedule
+	if err := json.Unmarshal([]byte(data), &schedule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+	return &schedule, nil
+}
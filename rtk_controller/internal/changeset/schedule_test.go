@@ -0,0 +1,248 @@
+package changeset
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"rtk_controller/internal/command"
+	"rtk_controller/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a settable clock for schedule tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func useClock(manager *SimpleManager, now time.Time) *fakeClock {
+	clock := &fakeClock{now: now}
+	manager.now = clock.Now
+	return clock
+}
+
+func waitSchedule(t *testing.T, manager *SimpleManager, id string, status types.ScheduleStatus) *types.ChangesetSchedule {
+	t.Helper()
+	var schedule *types.ChangesetSchedule
+	require.Eventually(t, func() bool {
+		var err error
+		schedule, err = manager.loadSchedule(id)
+		return err == nil && schedule.Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+	return schedule
+}
+
+func TestMaintenanceWindow_RefusesOutsideUnlessForced(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+	})
+	// Sunday 2026-10-18 05:30 UTC
+	useClock(manager, time.Date(2026, 10, 18, 5, 30, 0, 0, time.UTC))
+
+	require.NoError(t, manager.AddMaintenanceWindow(&types.MaintenanceWindow{
+		Tenant: "office", Site: "floor1", Cron: "0 3 * * sun", Duration: 2 * time.Hour, Timezone: "UTC",
+	}))
+	assert.Error(t, manager.AddMaintenanceWindow(&types.MaintenanceWindow{
+		Tenant: "office", Site: "floor1", Cron: "bad", Duration: time.Hour,
+	}))
+
+	floor1 := rolloutCommands("wifi.set_channel", "ap1")
+	floor2 := []*types.Command{{ID: "other", DeviceID: "office/floor2/ap9", Operation: "wifi.set_channel", Timeout: 5 * time.Second}}
+
+	err := manager.checkWindows(floor1, time.Date(2026, 10, 18, 5, 30, 0, 0, time.UTC))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "next opens 2026-10-25T03:00:00Z")
+	assert.NoError(t, manager.checkWindows(floor1, time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC)))
+	assert.NoError(t, manager.checkWindows(floor1, time.Date(2026, 10, 18, 4, 59, 0, 0, time.UTC)))
+	assert.Error(t, manager.checkWindows(floor1, time.Date(2026, 10, 18, 5, 0, 0, 0, time.UTC)))
+	assert.NoError(t, manager.checkWindows(floor2, time.Date(2026, 10, 18, 5, 30, 0, 0, time.UTC)), "sites without windows are unrestricted")
+
+	changeset := newDraft(t, manager, floor1, nil)
+	err = manager.ExecuteChangeset(context.Background(), changeset.ID)
+	assert.ErrorContains(t, err, "outside its maintenance windows")
+	assert.Equal(t, types.ChangesetStatusDraft, changeset.Status)
+	assert.Empty(t, device.requests())
+
+	require.NoError(t, manager.ExecuteChangesetWithOptions(context.Background(), changeset.ID, ExecuteOptions{Force: true}))
+	assert.Len(t, device.requests(), 1)
+
+	windows, err := manager.ListMaintenanceWindows("office", "floor1")
+	require.NoError(t, err)
+	require.Len(t, windows, 1)
+	require.NoError(t, manager.RemoveMaintenanceWindow(windows[0].ID))
+	windows, err = manager.ListMaintenanceWindows("", "")
+	require.NoError(t, err)
+	assert.Empty(t, windows)
+}
+
+func TestSchedule_OnceRunsWhenDue(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+	})
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	useClock(manager, start)
+
+	changeset := newDraft(t, manager, rolloutCommands("wifi.set_channel", "ap1"), nil)
+
+	past := start.Add(-time.Minute)
+	_, err := manager.ScheduleChangeset(&types.ChangesetSchedule{ChangesetID: changeset.ID, Type: types.ScheduleTypeOnce, RunAt: &past})
+	assert.Error(t, err)
+
+	runAt := start.Add(time.Hour)
+	schedule, err := manager.ScheduleChangeset(&types.ChangesetSchedule{ChangesetID: changeset.ID, Type: types.ScheduleTypeOnce, RunAt: &runAt})
+	require.NoError(t, err)
+	assert.Equal(t, types.ScheduleStatusScheduled, schedule.Status)
+
+	manager.runDueSchedules(start.Add(30 * time.Minute))
+	assert.Empty(t, device.requests(), "not due yet")
+
+	manager.runDueSchedules(runAt)
+	done := waitSchedule(t, manager, schedule.ID, types.ScheduleStatusCompleted)
+	assert.Nil(t, done.NextRun)
+	assert.Equal(t, types.ChangesetStatusCompleted, changeset.Status)
+	assert.Len(t, device.requests(), 1)
+
+	assert.Error(t, manager.CancelSchedule(schedule.ID), "completed schedules cannot be cancelled")
+}
+
+func TestSchedule_CronRetriesUntilWindowOpens(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+	})
+	// Friday 2026-10-16 12:00 UTC
+	clock := useClock(manager, time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+
+	require.NoError(t, manager.AddMaintenanceWindow(&types.MaintenanceWindow{
+		Tenant: "office", Site: "floor1", Cron: "0 3 * * sun", Duration: time.Hour, Timezone: "UTC",
+	}))
+	changeset := newDraft(t, manager, rolloutCommands("wifi.set_channel", "ap1"), nil)
+
+	// Daily at 03:00; Saturday is outside the window, Sunday inside
+	schedule, err := manager.ScheduleChangeset(&types.ChangesetSchedule{
+		ChangesetID: changeset.ID, Type: types.ScheduleTypeCron, Cron: "0 3 * * *", Timezone: "UTC",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC), schedule.NextRun.UTC())
+
+	saturday := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+	clock.Set(saturday)
+	manager.runDueSchedules(saturday)
+	retried := waitSchedule(t, manager, schedule.ID, types.ScheduleStatusScheduled)
+	require.NotNil(t, retried.LastRun)
+	assert.Contains(t, retried.LastResult, "outside its maintenance windows")
+	assert.Equal(t, time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC), retried.NextRun.UTC())
+	assert.Empty(t, device.requests())
+
+	sunday := time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC)
+	clock.Set(sunday)
+	manager.runDueSchedules(sunday)
+	waitSchedule(t, manager, schedule.ID, types.ScheduleStatusCompleted)
+	assert.Len(t, device.requests(), 1)
+}
+
+func TestSchedule_SurvivesRestart(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+	})
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	useClock(manager, start)
+
+	changeset := newDraft(t, manager, rolloutCommands("wifi.set_channel", "ap1"), nil)
+	runAt := start.Add(time.Hour)
+	schedule, err := manager.ScheduleChangeset(&types.ChangesetSchedule{ChangesetID: changeset.ID, Type: types.ScheduleTypeOnce, RunAt: &runAt})
+	require.NoError(t, err)
+
+	// A new manager on the same storage picks up the changeset and schedule
+	restarted := NewSimpleManager(manager.storage, command.NewManager(device, manager.storage))
+	device.manager = restarted.commandManager
+	useClock(restarted, runAt.Add(time.Minute))
+	restarted.config.ScheduleInterval = time.Hour
+	restarted.EnableScheduler()
+	require.NoError(t, restarted.Start(context.Background()))
+	t.Cleanup(func() { restarted.Stop() })
+
+	waitSchedule(t, restarted, schedule.ID, types.ScheduleStatusCompleted)
+	stored, err := restarted.GetChangeset(changeset.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChangesetStatusCompleted, stored.Status)
+	assert.Len(t, device.requests(), 1)
+}
+
+func TestSchedule_OnlySchedulerProcessRuns(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+	})
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	useClock(manager, start)
+
+	changeset := newDraft(t, manager, rolloutCommands("wifi.set_channel", "ap1"), nil)
+	runAt := start.Add(time.Hour)
+	schedule, err := manager.ScheduleChangeset(&types.ChangesetSchedule{ChangesetID: changeset.ID, Type: types.ScheduleTypeOnce, RunAt: &runAt})
+	require.NoError(t, err)
+
+	// A CLI process on the same storage neither runs the schedule nor
+	// recovers it
+	cli := NewSimpleManager(manager.storage, command.NewManager(device, manager.storage))
+	useClock(cli, runAt.Add(time.Minute))
+	cli.config.ScheduleInterval = 10 * time.Millisecond
+	require.NoError(t, cli.Start(context.Background()))
+	t.Cleanup(func() { cli.Stop() })
+
+	time.Sleep(100 * time.Millisecond)
+	stored, err := cli.loadSchedule(schedule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ScheduleStatusScheduled, stored.Status)
+	assert.Empty(t, device.requests())
+}
+
+func TestSchedule_CancelledWhileListingIsNotRun(t *testing.T) {
+	manager, device := setupExecutionTest(t, map[string]map[string]interface{}{
+		"wifi.set_channel": {"status": "completed"},
+	})
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	useClock(manager, start)
+
+	changeset := newDraft(t, manager, rolloutCommands("wifi.set_channel", "ap1"), nil)
+	runAt := start.Add(time.Hour)
+	schedule, err := manager.ScheduleChangeset(&types.ChangesetSchedule{ChangesetID: changeset.ID, Type: types.ScheduleTypeOnce, RunAt: &runAt})
+	require.NoError(t, err)
+
+	// Hold the lock so the worker lists the schedule, then cancel it before
+	// the worker can claim it
+	manager.mutex.Lock()
+	done := make(chan struct{})
+	go func() {
+		manager.runDueSchedules(runAt)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancelled, err := manager.loadSchedule(schedule.ID)
+	require.NoError(t, err)
+	cancelled.Status = types.ScheduleStatusCancelled
+	cancelled.NextRun = nil
+	require.NoError(t, manager.persistSchedule(cancelled))
+	manager.mutex.Unlock()
+	<-done
+
+	stored, err := manager.loadSchedule(schedule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ScheduleStatusCancelled, stored.Status)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, device.requests())
+}
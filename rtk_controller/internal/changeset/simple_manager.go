@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"rtk_controller/internal/command"
+	"rtk_controller/internal/logging"
 	"rtk_controller/internal/storage"
 	"rtk_controller/pkg/types"
 
@@ -25,9 +26,28 @@ type SimpleManager struct {
 	activeChangesets map[string]*types.Changeset
 	mutex            sync.RWMutex
 
+	// Rollout health sources and controls
+	devices     DeviceStateSource
+	quality     QualitySource
+	rolloutWake map[string]chan struct{}
+
+	// Where control of rollouts run by another process is sent
+	controlPublisher RolloutControlPublisher
+	controlTopic     string
+
+	// Approval audit trail (nil disables audit entries)
+	audit *logging.AuditLogger
+
 	// Configuration
 	config *ManagerConfig
 
+	// now is the clock used by schedules and maintenance windows
+	now func() time.Time
+
+	// scheduler is set in the one process that runs schedules and recovers
+	// work interrupted by a restart
+	scheduler bool
+
 	// Control
 	ctx     context.Context
 	cancel  context.CancelFunc
@@ -50,6 +70,13 @@ type ManagerConfig struct {
 
 	// RetentionDays is how long to keep completed changesets
 	RetentionDays int
+
+	// RequireSessionApproval requires approval before executing changesets
+	// created from an LLM session
+	RequireSessionApproval bool
+
+	// ScheduleInterval is how often due changeset schedules are checked
+	ScheduleInterval time.Duration
 }
 
 // DefaultManagerConfig returns sensible default configuration
@@ -60,6 +87,9 @@ func DefaultManagerConfig() *ManagerConfig {
 		AutoCleanup:         true,
 		CleanupInterval:     1 * time.Hour,
 		RetentionDays:       30,
+
+		RequireSessionApproval: true,
+		ScheduleInterval:       30 * time.Second,
 	}
 }
 
@@ -71,12 +101,24 @@ func NewSimpleManager(storage storage.Storage, commandManager *command.Manager)
 		storage:          storage,
 		commandManager:   commandManager,
 		activeChangesets: make(map[string]*types.Changeset),
+		rolloutWake:      make(map[string]chan struct{}),
 		config:           DefaultManagerConfig(),
+		now:              time.Now,
 		ctx:              ctx,
 		cancel:           cancel,
 	}
 }
 
+// EnableScheduler makes Start run due schedules and recover changesets and
+// schedules that a restart interrupted. Only the service process enables it;
+// CLI and MCP processes share its storage and must not run schedules twice or
+// fail the service's work in progress.
+func (m *SimpleManager) EnableScheduler() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.scheduler = true
+}
+
 // Start starts the changeset manager
 func (m *SimpleManager) Start(ctx context.Context) error {
 	m.mutex.Lock()
@@ -95,6 +137,11 @@ func (m *SimpleManager) Start(ctx context.Context) error {
 	if m.config.AutoCleanup {
 		go m.cleanupWorker()
 	}
+	if m.scheduler {
+		m.recoverSchedules()
+		m.recoverRollouts()
+		go m.scheduleWorker()
+	}
 
 	m.started = true
 	log.Info("Simple changeset manager started")
@@ -143,6 +190,8 @@ func (m *SimpleManager) CreateChangeset(ctx context.Context, options *types.Chan
 		changeset.CreatedBy = options.CreatedBy
 		changeset.SessionID = options.SessionID
 		changeset.TraceID = options.TraceID
+		changeset.Rollout = options.Rollout
+		changeset.RequiresApproval = options.RequireApproval
 		if options.Metadata != nil {
 			for k, v := range options.Metadata {
 				changeset.Metadata[k] = v
@@ -150,6 +199,10 @@ func (m *SimpleManager) CreateChangeset(ctx context.Context, options *types.Chan
 		}
 	}
 
+	if changeset.SessionID != "" && m.config.RequireSessionApproval {
+		changeset.RequiresApproval = true
+	}
+
 	// Store in memory and persistence
 	m.activeChangesets[changeset.ID] = changeset
 	if err := m.persistChangeset(changeset); err != nil {
@@ -195,8 +248,22 @@ func (m *SimpleManager) AddCommandToChangeset(changesetID string, cmd *types.Com
 	return nil
 }
 
-// ExecuteChangeset executes all commands in a changeset
+// ExecuteChangeset executes the commands of a changeset one at a time,
+// waiting for each device result before sending the next. On the first
+// failure the remaining commands are skipped and the rollback commands run
+// in reverse order.
 func (m *SimpleManager) ExecuteChangeset(ctx context.Context, changesetID string) error {
+	return m.ExecuteChangesetWithOptions(ctx, changesetID, ExecuteOptions{})
+}
+
+// ExecuteChangesetWithOptions executes a changeset like ExecuteChangeset.
+// Unless opts.Force is set it refuses to start outside the maintenance
+// windows of the sites the changeset touches.
+func (m *SimpleManager) ExecuteChangesetWithOptions(ctx context.Context, changesetID string, opts ExecuteOptions) error {
+	if m.commandManager == nil {
+		return fmt.Errorf("command manager not available")
+	}
+
 	m.mutex.Lock()
 	changeset, exists := m.activeChangesets[changesetID]
 	if !exists {
@@ -204,92 +271,101 @@ func (m *SimpleManager) ExecuteChangeset(ctx context.Context, changesetID string
 		return fmt.Errorf("changeset %s not found", changesetID)
 	}
 
-	if changeset.Status != types.ChangesetStatusDraft {
+	if err := checkExecutable(changeset); err != nil {
 		m.mutex.Unlock()
-		return fmt.Errorf("changeset %s is not in draft status", changesetID)
+		return err
+	}
+
+	if !opts.Force {
+		if err := m.checkWindows(changeset.Commands, m.now()); err != nil {
+			m.mutex.Unlock()
+			return fmt.Errorf("changeset %s not executed: %w", changesetID, err)
+		}
 	}
 
 	// Update status
 	changeset.Status = types.ChangesetStatusExecuting
 	m.mutex.Unlock()
 
+	m.auditExecution(ctx, changeset)
+
 	log.WithFields(log.Fields{
 		"changeset_id":  changesetID,
 		"command_count": len(changeset.Commands),
 	}).Info("Executing changeset")
 
+	if changeset.Rollout != nil {
+		return m.executeRollout(ctx, changeset)
+	}
+
 	startTime := time.Now()
-	var allSuccessful = true
+	var failed *types.CommandResult
+	ran := 0 // commands that reached their device
 
 	// Execute each command
 	for _, cmd := range changeset.Commands {
-		cmdStartTime := time.Now()
-
-		// Execute command through command manager
-		// Convert timeout from Duration to seconds
-		timeoutSeconds := int(cmd.Timeout.Seconds())
-		if timeoutSeconds <= 0 {
-			timeoutSeconds = 30 // default timeout
-		}
-
-		// Use SendCommand instead of ExecuteCommand
-		_, err := m.commandManager.SendCommand("default", "default", cmd.DeviceID, cmd.Operation, cmd.Args, timeoutSeconds)
-
-		duration := time.Since(cmdStartTime)
-		result := &types.CommandResult{
-			CommandID:  cmd.ID,
-			Success:    err == nil,
-			ExecutedAt: time.Now(),
-			Duration:   duration,
+		result := m.runCommand(ctx, cmd, types.ResultPhaseExecute)
+		m.recordResult(changeset, result)
+		if result.DeviceCommandID != "" {
+			ran++
 		}
 
-		if err != nil {
-			result.Message = err.Error()
-			allSuccessful = false
+		if !result.Success {
+			failed = result
 			log.WithFields(log.Fields{
 				"changeset_id": changesetID,
 				"command_id":   cmd.ID,
-				"error":        err.Error(),
+				"error":        result.Message,
 			}).Error("Command execution failed")
-		} else {
-			result.Message = "Command executed successfully"
-			result.Data = cmd.Result // If the command manager sets result data
+			break
 		}
-
-		changeset.AddResult(result)
 	}
 
-	// Update final status
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
 	executedAt := time.Now()
 	changeset.ExecutedAt = &executedAt
-
-	if allSuccessful {
+	if failed == nil {
 		changeset.Status = types.ChangesetStatusCompleted
-		log.WithFields(log.Fields{
-			"changeset_id": changesetID,
-			"duration":     time.Since(startTime),
-		}).Info("Changeset executed successfully")
 	} else {
 		changeset.Status = types.ChangesetStatusFailed
+	}
+	if err := m.persistChangeset(changeset); err != nil {
+		log.WithError(err).Error("Failed to persist changeset after execution")
+	}
+	m.mutex.Unlock()
+
+	if failed == nil {
 		log.WithFields(log.Fields{
 			"changeset_id": changesetID,
 			"duration":     time.Since(startTime),
-		}).Error("Changeset execution failed")
+		}).Info("Changeset executed successfully")
+		return nil
 	}
 
-	// Persist updated changeset
-	if err := m.persistChangeset(changeset); err != nil {
-		log.WithError(err).Error("Failed to persist changeset after execution")
+	log.WithFields(log.Fields{
+		"changeset_id": changesetID,
+		"duration":     time.Since(startTime),
+	}).Error("Changeset execution failed")
+
+	if len(changeset.RollbackCommands) == 0 {
+		return fmt.Errorf("command %s failed: %s", failed.CommandID, failed.Message)
 	}
 
-	return nil
+	// Only undo the commands that ran. The caller's context may be what
+	// failed the command; roll back regardless.
+	ranStep := func(i int, _ *types.Command) bool { return i < ran }
+	if err := m.rollback(m.ctx, changeset, ranStep); err != nil {
+		return fmt.Errorf("command %s failed: %s; %w", failed.CommandID, failed.Message, err)
+	}
+	return fmt.Errorf("command %s failed: %s; changeset rolled back", failed.CommandID, failed.Message)
 }
 
 // RollbackChangeset rolls back a changeset by executing rollback commands
 func (m *SimpleManager) RollbackChangeset(ctx context.Context, changesetID string) error {
+	if m.commandManager == nil {
+		return fmt.Errorf("command manager not available")
+	}
+
 	m.mutex.Lock()
 	changeset, exists := m.activeChangesets[changesetID]
 	if !exists {
@@ -308,32 +384,38 @@ func (m *SimpleManager) RollbackChangeset(ctx context.Context, changesetID strin
 	}
 	m.mutex.Unlock()
 
+	return m.rollback(ctx, changeset, nil)
+}
+
+// rollback runs the rollback commands in reverse order and records the
+// outcome. Rollback command i undoes command i of the changeset. When include
+// is not nil only the rollback commands it selects are run.
+func (m *SimpleManager) rollback(ctx context.Context, changeset *types.Changeset, include func(i int, cmd *types.Command) bool) error {
 	log.WithFields(log.Fields{
-		"changeset_id":           changesetID,
+		"changeset_id":           changeset.ID,
 		"rollback_command_count": len(changeset.RollbackCommands),
 	}).Info("Rolling back changeset")
 
 	startTime := time.Now()
-	var allSuccessful = true
+	var failures, total int
 
 	// Execute rollback commands in reverse order
 	for i := len(changeset.RollbackCommands) - 1; i >= 0; i-- {
 		cmd := changeset.RollbackCommands[i]
-
-		// Convert timeout from Duration to seconds for rollback command
-		timeoutSeconds := int(cmd.Timeout.Seconds())
-		if timeoutSeconds <= 0 {
-			timeoutSeconds = 30 // default timeout
+		if include != nil && !include(i, cmd) {
+			continue
 		}
+		total++
 
-		// Use SendCommand instead of ExecuteCommand
-		_, err := m.commandManager.SendCommand("default", "default", cmd.DeviceID, cmd.Operation, cmd.Args, timeoutSeconds)
-		if err != nil {
-			allSuccessful = false
+		result := m.runCommand(ctx, cmd, types.ResultPhaseRollback)
+		m.recordResult(changeset, result)
+
+		if !result.Success {
+			failures++
 			log.WithFields(log.Fields{
-				"changeset_id": changesetID,
+				"changeset_id": changeset.ID,
 				"command_id":   cmd.ID,
-				"error":        err.Error(),
+				"error":        result.Message,
 			}).Error("Rollback command execution failed")
 		}
 	}
@@ -345,16 +427,16 @@ func (m *SimpleManager) RollbackChangeset(ctx context.Context, changesetID strin
 	rolledBackAt := time.Now()
 	changeset.RolledBackAt = &rolledBackAt
 
-	if allSuccessful {
+	if failures == 0 {
 		changeset.Status = types.ChangesetStatusRolledBack
 		log.WithFields(log.Fields{
-			"changeset_id": changesetID,
+			"changeset_id": changeset.ID,
 			"duration":     time.Since(startTime),
 		}).Info("Changeset rolled back successfully")
 	} else {
 		changeset.Status = types.ChangesetStatusRollbackFailed
 		log.WithFields(log.Fields{
-			"changeset_id": changesetID,
+			"changeset_id": changeset.ID,
 			"duration":     time.Since(startTime),
 		}).Error("Changeset rollback failed")
 	}
@@ -364,6 +446,32 @@ func (m *SimpleManager) RollbackChangeset(ctx context.Context, changesetID strin
 		log.WithError(err).Error("Failed to persist changeset after rollback")
 	}
 
+	if failures > 0 {
+		return fmt.Errorf("rollback failed for %d of %d commands", failures, total)
+	}
+	return nil
+}
+
+// AddRollbackCommandToChangeset adds a command that undoes part of a draft
+// changeset. The Nth rollback command undoes the Nth command.
+func (m *SimpleManager) AddRollbackCommandToChangeset(changesetID string, cmd *types.Command) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	changeset, exists := m.activeChangesets[changesetID]
+	if !exists {
+		return fmt.Errorf("changeset %s not found", changesetID)
+	}
+
+	if changeset.Status != types.ChangesetStatusDraft {
+		return fmt.Errorf("cannot add rollback commands to changeset in status %s", changeset.Status)
+	}
+
+	changeset.AddRollbackCommand(cmd)
+
+	if err := m.persistChangeset(changeset); err != nil {
+		return fmt.Errorf("failed to persist changeset: %w", err)
+	}
 	return nil
 }
 
@@ -418,7 +526,7 @@ func (m *SimpleManager) DeleteChangeset(changesetID string) error {
 		return fmt.Errorf("changeset %s not found", changesetID)
 	}
 
-	if changeset.Status == types.ChangesetStatusExecuting {
+	if changeset.Status == types.ChangesetStatusExecuting || changeset.Status == types.ChangesetStatusPaused {
 		return fmt.Errorf("cannot delete changeset %s while executing", changesetID)
 	}
 
@@ -460,8 +568,54 @@ func (m *SimpleManager) loadChangeset(changesetID string) (*types.Changeset, err
 	return &changeset, nil
 }
 
+// loadActiveChangesets loads changesets that have not finished. In the
+// scheduler process, changesets that were executing when the controller
+// stopped are marked failed; paused rollouts stay paused.
 func (m *SimpleManager) loadActiveChangesets() error {
-	// TODO: Implement loading active changesets from storage on startup
+	var interrupted []*types.Changeset
+
+	err := m.storage.View(func(tx storage.Transaction) error {
+		return tx.IteratePrefix("changeset:", func(key, value string) error {
+			var changeset types.Changeset
+			if err := json.Unmarshal([]byte(value), &changeset); err != nil {
+				log.WithError(err).WithField("key", key).Warn("Skipping invalid changeset")
+				return nil
+			}
+
+			switch changeset.Status {
+			case types.ChangesetStatusDraft, types.ChangesetStatusPendingApproval, types.ChangesetStatusApproved,
+				types.ChangesetStatusPaused:
+				m.activeChangesets[changeset.ID] = &changeset
+			case types.ChangesetStatusExecuting:
+				if m.scheduler {
+					interrupted = append(interrupted, &changeset)
+				} else {
+					m.activeChangesets[changeset.ID] = &changeset
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, changeset := range interrupted {
+		changeset.Status = types.ChangesetStatusFailed
+		if changeset.Metadata == nil {
+			changeset.Metadata = make(map[string]interface{})
+		}
+		changeset.Metadata["failure_reason"] = "interrupted by controller restart"
+		m.activeChangesets[changeset.ID] = changeset
+		if err := m.persistChangeset(changeset); err != nil {
+			log.WithError(err).WithField("changeset_id", changeset.ID).Warn("Failed to mark interrupted changeset")
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"loaded":      len(m.activeChangesets),
+		"interrupted": len(interrupted),
+	}).Debug("Loaded active changesets")
 	return nil
 }
 
@@ -82,6 +82,7 @@ func setupTestManager(t *testing.T) (*SimpleManager, *MockStorage) {
 	mockStorage.On("Get", mock.AnythingOfType("string")).Return("", nil)
 	mockStorage.On("Delete", mock.AnythingOfType("string")).Return(nil)
 	mockStorage.On("Exists", mock.AnythingOfType("string")).Return(false, nil)
+	mockStorage.On("View", mock.Anything).Return(nil)
 
 	// Create a simple manager without command manager for basic testing
 	manager := NewSimpleManager(mockStorage, nil)
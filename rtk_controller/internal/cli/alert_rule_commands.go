@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rtk_controller/internal/mqtt"
+	"rtk_controller/internal/storage"
+	"rtk_controller/internal/topology"
+	"rtk_controller/pkg/types"
+)
+
+// alertRulesCommand handles "topology alerts rules ..."
+func (cli *InteractiveCLI) alertRulesCommand(tenant, site string, args []string) (string, error) {
+	if len(args) == 0 {
+		return cli.listAlertRules()
+	}
+
+	switch args[0] {
+	case "list":
+		return cli.listAlertRules()
+	case "validate":
+		if len(args) < 2 {
+			return "", fmt.Errorf("usage: topology alerts rules validate <file|expression>")
+		}
+		return validateAlertRules(strings.Join(args[1:], " "))
+	case "test":
+		return cli.testAlertRules(tenant, site, args[1:])
+	default:
+		return "", fmt.Errorf("unknown alerts rules subcommand: %s", args[0])
+	}
+}
+
+// alertRules returns the rules of the running alerting system, or else the
+// built-in rules overridden by the configured rule files
+func (cli *InteractiveCLI) alertRules() ([]topology.AlertRule, error) {
+	if cli.topologyCommands != nil && cli.topologyCommands.alertingSystem != nil {
+		return cli.topologyCommands.alertingSystem.GetAlertRules(), nil
+	}
+
+	var fileRules []topology.AlertRule
+	if cli.config != nil {
+		var err error
+		if fileRules, err = topology.LoadAlertRuleFiles(cli.config.Alerting.RuleFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	overridden := make(map[string]bool)
+	for _, rule := range fileRules {
+		overridden[rule.ID] = true
+	}
+	var rules []topology.AlertRule
+	for _, rule := range topology.DefaultAlertRules() {
+		if !overridden[rule.ID] {
+			rules = append(rules, rule)
+		}
+	}
+	return append(rules, fileRules...), nil
+}
+
+func (cli *InteractiveCLI) listAlertRules() (string, error) {
+	rules, err := cli.alertRules()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-24s %-9s %-8s %-24s %s\n", "ID", "SEVERITY", "ENABLED", "SOURCE", "EXPRESSION")
+	b.WriteString(strings.Repeat("-", 100) + "\n")
+	for _, rule := range rules {
+		source := rule.Source
+		if source == "" {
+			source = "built-in"
+		}
+		fmt.Fprintf(&b, "%-24s %-9s %-8t %-24s %s\n", rule.ID, rule.Severity, rule.Enabled, source, rule.Expression)
+	}
+	fmt.Fprintf(&b, "%d rules", len(rules))
+	return b.String(), nil
+}
+
+// validateAlertRules checks a rule file, or a single expression
+func validateAlertRules(target string) (string, error) {
+	if _, err := os.Stat(target); err == nil {
+		rules, err := topology.LoadAlertRuleFile(target)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s: %d valid rules\n", target, len(rules))
+		for _, rule := range rules {
+			fmt.Fprintf(&b, "  %-24s %s\n", rule.ID, rule.Expression)
+		}
+		return strings.TrimSuffix(b.String(), "\n"), nil
+	}
+
+	expr, err := topology.ParseRuleExpression(target)
+	if err != nil {
+		return "", err
+	}
+	return describeRuleExpression(expr), nil
+}
+
+func describeRuleExpression(expr *topology.RuleExpression) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Valid expression: %s\n", expr.Source)
+	for i, clause := range expr.Clauses {
+		if i > 0 {
+			fmt.Fprintf(&b, "  %s\n", strings.ToLower(string(expr.Logic)))
+		}
+		fmt.Fprintf(&b, "  %s\n", clause)
+	}
+	if len(expr.Selectors) == 0 {
+		b.WriteString("Applies to: all devices")
+	} else {
+		selectors := make([]string, 0, len(expr.Selectors))
+		for _, selector := range expr.Selectors {
+			selectors = append(selectors, selector.String())
+		}
+		fmt.Fprintf(&b, "Applies to: %s", strings.Join(selectors, ", "))
+	}
+	return b.String()
+}
+
+// testAlertRules evaluates rules against the MQTT message log of a site:
+// test <rule-id|file|expression> [--since=24h] [--until=<time>] [--step=1m]
+func (cli *InteractiveCLI) testAlertRules(tenant, site string, args []string) (string, error) {
+	const usage = "usage: topology alerts rules test <rule-id|file|expression> [--since=24h] [--until=<time>] [--step=1m]"
+
+	now := time.Now()
+	since := now.Add(-24 * time.Hour)
+	until := now
+	step := time.Minute
+
+	var target []string
+	for _, arg := range args {
+		var err error
+		switch {
+		case strings.HasPrefix(arg, "--since="):
+			since, err = parseTimeArg(strings.TrimPrefix(arg, "--since="), now)
+		case strings.HasPrefix(arg, "--until="):
+			until, err = parseTimeArg(strings.TrimPrefix(arg, "--until="), now)
+		case strings.HasPrefix(arg, "--step="):
+			step, err = time.ParseDuration(strings.TrimPrefix(arg, "--step="))
+		default:
+			target = append(target, arg)
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", arg, err)
+		}
+	}
+	if len(target) == 0 {
+		return "", errors.New(usage)
+	}
+
+	rules, err := cli.resolveAlertRules(strings.Join(target, " "))
+	if err != nil {
+		return "", err
+	}
+	if cli.storage == nil {
+		return "", fmt.Errorf("storage not available")
+	}
+
+	// Load enough history before the test period for windows and durations
+	lookback := time.Duration(0)
+	for _, rule := range rules {
+		expr, err := topology.ParseRuleExpression(rule.Expression)
+		if err != nil {
+			return "", fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+		if expr.Lookback() > lookback {
+			lookback = expr.Lookback()
+		}
+	}
+
+	messages, err := mqtt.QueryMessageLog(cli.storage, since.Add(-lookback).UnixMilli(), until.UnixMilli(),
+		map[string]string{"topic_filter": fmt.Sprintf("rtk/v1/%s/%s/#", tenant, site)}, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to read message log: %w", err)
+	}
+	history := topology.NewMetricHistory()
+	for _, message := range messages {
+		history.Add(topology.ExtractMetricSamples(message.Topic, []byte(message.Payload), time.UnixMilli(message.Timestamp))...)
+	}
+
+	identityStorage := storage.NewIdentityStorage(cli.storage)
+	lookup := func(device string) *types.DeviceIdentity {
+		return topology.LookupDeviceIdentity(identityStorage, device)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Tested against %d messages (%d samples) from %s/%s, %s to %s every %s\n",
+		len(messages), history.Len(), tenant, site, since.Format(time.RFC3339), until.Format(time.RFC3339), step)
+	for _, rule := range rules {
+		result, err := topology.TestAlertRule(rule, history, since, until, step, lookup)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "\nRule %s: %s\n", rule.ID, result.Expression)
+		fmt.Fprintf(&b, "  %d devices, %d evaluations, fired %d times\n", result.Devices, result.Evaluations, len(result.Firings))
+		for _, firing := range result.Firings {
+			end := "ongoing"
+			duration := until.Sub(firing.Start)
+			if !firing.End.IsZero() {
+				end = firing.End.Format("15:04:05")
+				duration = firing.End.Sub(firing.Start)
+			}
+			fmt.Fprintf(&b, "  %-20s %s - %-8s (%s) %s\n", firing.Device, firing.Start.Format("2006-01-02 15:04:05"),
+				end, duration.Round(time.Second), formatClauseResults(firing.Results))
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// resolveAlertRules finds the rules a test refers to: a known rule ID, a
+// rule file or an expression
+func (cli *InteractiveCLI) resolveAlertRules(target string) ([]topology.AlertRule, error) {
+	rules, err := cli.alertRules()
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if rule.ID == target {
+			return []topology.AlertRule{rule}, nil
+		}
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		return topology.LoadAlertRuleFile(target)
+	}
+
+	if _, err := topology.ParseRuleExpression(target); err != nil {
+		return nil, fmt.Errorf("%q is not a rule ID, rule file or valid expression: %w", target, err)
+	}
+	return []topology.AlertRule{{ID: "expression", Name: "expression", Expression: target}}, nil
+}
+
+func formatClauseResults(results []topology.ClauseResult) string {
+	var parts []string
+	for _, result := range results {
+		if !result.Held {
+			continue
+		}
+		if result.Clause.Function == "absent" {
+			parts = append(parts, fmt.Sprintf("no %s for %.0fm", result.Clause.Metric, result.Value))
+			continue
+		}
+		name := result.Clause.Metric
+		if result.Clause.Function != "" {
+			name = fmt.Sprintf("%s(%s)", result.Clause.Function, result.Clause.Metric)
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", name, strconv.FormatFloat(result.Value, 'f', 2, 64)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseTimeArg parses an RFC 3339 time or a duration before now
+func parseTimeArg(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a duration such as 24h or an RFC 3339 time")
+	}
+	return now.Add(-d), nil
+}
@@ -3,11 +3,15 @@ package cli
 import (
 	"context"
 	"fmt"
+	"os/user"
+	"strconv"
 	"strings"
 	"time"
 
 	"rtk_controller/internal/changeset"
 	"rtk_controller/pkg/types"
+
+	"github.com/google/uuid"
 )
 
 // handleChangesetCommand handles changeset management commands
@@ -35,10 +39,11 @@ func (cli *InteractiveCLI) handleChangesetCommand(args []string, changesetManage
 		cli.showChangeset(args[1], changesetManager)
 	case "execute", "exec":
 		if len(args) < 2 {
-			fmt.Println("Usage: changeset execute <changeset_id>")
+			fmt.Println("Usage: changeset execute <changeset_id> [--force]")
 			return
 		}
-		cli.executeChangeset(args[1], changesetManager)
+		force := len(args) > 2 && args[2] == "--force"
+		cli.executeChangeset(args[1], force, changesetManager)
 	case "rollback":
 		if len(args) < 2 {
 			fmt.Println("Usage: changeset rollback <changeset_id>")
@@ -50,7 +55,64 @@ func (cli *InteractiveCLI) handleChangesetCommand(args []string, changesetManage
 			fmt.Println("Usage: changeset add <changeset_id> <device_id> <operation> [args...]")
 			return
 		}
-		cli.addCommandToChangeset(args[1:], changesetManager)
+		cli.addCommandToChangeset(args[1:], changesetManager, false)
+	case "add-rollback":
+		if len(args) < 4 {
+			fmt.Println("Usage: changeset add-rollback <changeset_id> <device_id> <operation> [args...]")
+			return
+		}
+		cli.addCommandToChangeset(args[1:], changesetManager, true)
+	case "rollout":
+		if len(args) < 2 {
+			fmt.Println("Usage: changeset rollout <changeset_id> [canary=N] [batch=N] [pause=30s] [online=true] [min_quality=0.6] [alerts=N]")
+			return
+		}
+		cli.setChangesetRollout(args[1], args[2:], changesetManager)
+	case "submit":
+		if len(args) < 2 {
+			fmt.Println("Usage: changeset submit <changeset_id>")
+			return
+		}
+		cli.submitChangeset(args[1], changesetManager)
+	case "approve", "reject":
+		if len(args) < 2 {
+			fmt.Printf("Usage: changeset %s <changeset_id> [comment]\n", args[0])
+			return
+		}
+		cli.decideChangeset(args[0] == "approve", args[1], args[2:], changesetManager)
+	case "diff", "dry-run":
+		if len(args) < 2 {
+			fmt.Println("Usage: changeset diff <changeset_id>")
+			return
+		}
+		cli.diffChangeset(args[1], changesetManager)
+	case "schedule":
+		if len(args) < 4 {
+			fmt.Println("Usage: changeset schedule <changeset_id> at <time> [--force] [--tz=Zone]")
+			fmt.Println("       changeset schedule <changeset_id> cron <min> <hour> <dom> <month> <dow> [--force] [--tz=Zone]")
+			return
+		}
+		cli.scheduleChangeset(args[1:], changesetManager)
+	case "schedules":
+		cli.listChangesetSchedules(changesetManager)
+	case "unschedule":
+		if len(args) < 2 {
+			fmt.Println("Usage: changeset unschedule <schedule_id>")
+			return
+		}
+		if err := changesetManager.CancelSchedule(args[1]); err != nil {
+			fmt.Printf("❌ Failed to cancel schedule: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Cancelled schedule %s\n", args[1])
+	case "window":
+		cli.handleMaintenanceWindowCommand(args[1:], changesetManager)
+	case "pause", "resume", "abort":
+		if len(args) < 2 {
+			fmt.Printf("Usage: changeset %s <changeset_id>\n", args[0])
+			return
+		}
+		cli.controlChangesetRollout(args[0], args[1], changesetManager)
 	default:
 		fmt.Printf("Unknown changeset subcommand: %s\n", args[0])
 		cli.showChangesetHelp()
@@ -64,12 +126,55 @@ func (cli *InteractiveCLI) showChangesetHelp() {
 	fmt.Println("  changeset list                         - List all changesets")
 	fmt.Println("  changeset show <id>                    - Show changeset details")
 	fmt.Println("  changeset execute <id>                 - Execute changeset")
+	fmt.Println("  changeset execute <id> --force         - Execute outside maintenance windows")
 	fmt.Println("  changeset rollback <id>                - Rollback changeset")
 	fmt.Println("  changeset add <id> <device> <op> [args] - Add command to changeset")
+	fmt.Println("  changeset add-rollback <id> <device> <op> [args] - Add rollback command")
+	fmt.Println("  changeset diff <id>                    - Dry-run: show per-device before/after")
+	fmt.Println("  changeset submit <id>                  - Submit changeset for approval")
+	fmt.Println("  changeset approve <id> [comment]       - Approve a submitted changeset")
+	fmt.Println("  changeset reject <id> [reason]         - Reject it back to draft")
+	fmt.Println("  changeset schedule <id> at <time>      - Execute once at a time (RFC3339 or 2006-01-02T15:04)")
+	fmt.Println("  changeset schedule <id> cron <5 fields> - Execute at the next cron match")
+	fmt.Println("  changeset schedules                    - List schedules")
+	fmt.Println("  changeset unschedule <schedule_id>     - Cancel a schedule")
+	fmt.Println("  changeset window add <tenant/site> <duration> <5 cron fields> - Add maintenance window")
+	fmt.Println("  changeset window list [tenant/site]    - List maintenance windows")
+	fmt.Println("  changeset window remove <window_id>    - Remove maintenance window")
+	fmt.Println("  changeset rollout <id> [options]       - Stage execution in batches")
+	fmt.Println("  changeset pause <id>                   - Pause a rollout before its next batch")
+	fmt.Println("  changeset resume <id>                  - Resume a paused rollout")
+	fmt.Println("  changeset abort <id>                   - Abort a rollout and roll back changed devices")
+	fmt.Println("")
+	fmt.Println("Devices are given as tenant/site/device_id. Commands run one at a time and")
+	fmt.Println("wait for the device result. The Nth rollback command undoes the Nth command;")
+	fmt.Println("the first failure runs the rollback commands of the steps that ran, in reverse.")
+	fmt.Println("")
+	fmt.Println("Changesets from LLM sessions must be approved by someone other than their")
+	fmt.Println("creator before they execute. Decisions are recorded as the current OS user.")
+	fmt.Println("")
+	fmt.Println("Sites with maintenance windows only accept changesets while a window is")
+	fmt.Println("open; schedules and execute take --force to override. Cron schedules retry")
+	fmt.Println("at the next match until the changeset has run. Schedules are run by the")
+	fmt.Println("controller service, not by this CLI.")
+	fmt.Println("")
+	fmt.Println("Rollout options:")
+	fmt.Println("  canary=N        - Devices in the first batch")
+	fmt.Println("  batch=N         - Devices per following batch (0 = all remaining)")
+	fmt.Println("  pause=30s       - Observation time after each batch")
+	fmt.Println("  online=true     - Halt if a changed device is offline or critical")
+	fmt.Println("  min_quality=0.6 - Halt if a changed device's connection quality drops below")
+	fmt.Println("  alerts=N        - Halt if more than N new quality alerts are raised")
+	fmt.Println("                    (min_quality and alerts need connection quality monitoring)")
+	fmt.Println("  off             - Remove the rollout strategy")
 	fmt.Println("")
 	fmt.Println("Examples:")
 	fmt.Println("  changeset create \"Update WiFi settings\"")
-	fmt.Println("  changeset add cs-123 device1 configure_wifi --ssid=NewSSID")
+	fmt.Println("  changeset add cs-123 office/floor1/device1 configure_wifi --ssid=NewSSID")
+	fmt.Println("  changeset add-rollback cs-123 office/floor1/device1 configure_wifi --ssid=OldSSID")
+	fmt.Println("  changeset rollout cs-123 canary=1 batch=5 pause=1m online=true alerts=0")
+	fmt.Println("  changeset window add office/floor1 2h 0 3 * * sun")
+	fmt.Println("  changeset schedule cs-123 cron 0 3 * * sun")
 	fmt.Println("  changeset execute cs-123")
 }
 
@@ -82,9 +187,15 @@ func (cli *InteractiveCLI) createChangeset(args []string, changesetManager *chan
 		description = "Changeset created via CLI"
 	}
 
+	createdBy, err := changesetUser()
+	if err != nil {
+		fmt.Printf("❌ Failed to create changeset: %v\n", err)
+		return
+	}
+
 	options := &types.ChangesetOptions{
 		Description: description,
-		CreatedBy:   "cli-user",
+		CreatedBy:   createdBy,
 		Metadata: map[string]interface{}{
 			"source":      "interactive_cli",
 			"created_via": "changeset_command",
@@ -133,6 +244,14 @@ func (cli *InteractiveCLI) showChangeset(changesetID string, changesetManager *c
 		fmt.Printf("Rolled back: %s\n", changeset.RolledBackAt.Format(time.RFC3339))
 	}
 
+	if changeset.RequiresApproval || changeset.Approval != nil {
+		cli.showChangesetApproval(changeset)
+	}
+
+	if changeset.Rollout != nil {
+		cli.showChangesetRollout(changeset)
+	}
+
 	if len(changeset.Commands) > 0 {
 		fmt.Printf("\nCommands (%d):\n", len(changeset.Commands))
 		fmt.Println(strings.Repeat("-", 20))
@@ -141,6 +260,14 @@ func (cli *InteractiveCLI) showChangeset(changesetID string, changesetManager *c
 		}
 	}
 
+	if len(changeset.RollbackCommands) > 0 {
+		fmt.Printf("\nRollback Commands (%d, run in reverse):\n", len(changeset.RollbackCommands))
+		fmt.Println(strings.Repeat("-", 20))
+		for i, cmd := range changeset.RollbackCommands {
+			fmt.Printf("%d. %s -> %s: %s\n", i+1, cmd.DeviceID, cmd.Operation, cmd.ID)
+		}
+	}
+
 	if len(changeset.Results) > 0 {
 		fmt.Printf("\nResults (%d):\n", len(changeset.Results))
 		fmt.Println(strings.Repeat("-", 15))
@@ -149,7 +276,11 @@ func (cli *InteractiveCLI) showChangeset(changesetID string, changesetManager *c
 			if !result.Success {
 				status = "❌ Failed"
 			}
-			fmt.Printf("%d. %s - %s\n", i+1, result.CommandID, status)
+			phase := ""
+			if result.Phase == types.ResultPhaseRollback {
+				phase = " (rollback)"
+			}
+			fmt.Printf("%d. %s%s - %s: %s (%v)\n", i+1, result.CommandID, phase, status, result.Message, result.Duration.Round(time.Millisecond))
 		}
 	}
 
@@ -163,17 +294,40 @@ func (cli *InteractiveCLI) showChangeset(changesetID string, changesetManager *c
 }
 
 // executeChangeset executes a changeset
-func (cli *InteractiveCLI) executeChangeset(changesetID string, changesetManager *changeset.SimpleManager) {
+func (cli *InteractiveCLI) executeChangeset(changesetID string, force bool, changesetManager *changeset.SimpleManager) {
+	opts := changeset.ExecuteOptions{Force: force}
+
+	cs, err := changesetManager.GetChangeset(changesetID)
+	if err != nil {
+		fmt.Printf("❌ Failed to retrieve changeset: %v\n", err)
+		return
+	}
+
+	// Rollouts pause between batches, so keep the prompt free for pause/resume/abort
+	if cs.Rollout != nil {
+		fmt.Printf("🚀 Starting rollout of changeset: %s\n", changesetID)
+		fmt.Println("Use 'changeset show' to follow progress and 'changeset pause|resume|abort' to control it")
+		go func() {
+			if err := changesetManager.ExecuteChangesetWithOptions(context.Background(), changesetID, opts); err != nil {
+				fmt.Printf("\n❌ Rollout of changeset %s failed: %v\n", changesetID, err)
+				return
+			}
+			fmt.Printf("\n✅ Rollout of changeset %s completed\n", changesetID)
+		}()
+		return
+	}
+
 	fmt.Printf("🚀 Executing changeset: %s\n", changesetID)
 	fmt.Println("This may take some time depending on the number of commands...")
 	fmt.Println()
 
 	startTime := time.Now()
-	err := changesetManager.ExecuteChangeset(context.Background(), changesetID)
+	err = changesetManager.ExecuteChangesetWithOptions(context.Background(), changesetID, opts)
 	executionTime := time.Since(startTime)
 
 	if err != nil {
 		fmt.Printf("❌ Changeset execution failed: %v\n", err)
+		fmt.Println("Use 'changeset show' to see the result of each step")
 		return
 	}
 
@@ -201,7 +355,7 @@ func (cli *InteractiveCLI) rollbackChangeset(changesetID string, changesetManage
 }
 
 // addCommandToChangeset adds a command to an existing changeset
-func (cli *InteractiveCLI) addCommandToChangeset(args []string, changesetManager *changeset.SimpleManager) {
+func (cli *InteractiveCLI) addCommandToChangeset(args []string, changesetManager *changeset.SimpleManager, rollback bool) {
 	if len(args) < 3 {
 		fmt.Println("Usage: changeset add <changeset_id> <device_id> <operation> [args...]")
 		return
@@ -225,6 +379,7 @@ func (cli *InteractiveCLI) addCommandToChangeset(args []string, changesetManager
 
 	// Create command
 	command := &types.Command{
+		ID:          uuid.New().String(),
 		DeviceID:    deviceID,
 		Operation:   operation,
 		Args:        cmdParams,
@@ -234,13 +389,22 @@ func (cli *InteractiveCLI) addCommandToChangeset(args []string, changesetManager
 		Expectation: "result", // expect result by default
 	}
 
-	err := changesetManager.AddCommandToChangeset(changesetID, command)
+	var err error
+	if rollback {
+		err = changesetManager.AddRollbackCommandToChangeset(changesetID, command)
+	} else {
+		err = changesetManager.AddCommandToChangeset(changesetID, command)
+	}
 	if err != nil {
 		fmt.Printf("❌ Failed to add command to changeset: %v\n", err)
 		return
 	}
 
-	fmt.Printf("✅ Added command to changeset %s\n", changesetID)
+	if rollback {
+		fmt.Printf("✅ Added rollback command to changeset %s\n", changesetID)
+	} else {
+		fmt.Printf("✅ Added command to changeset %s\n", changesetID)
+	}
 	fmt.Printf("   Device: %s\n", deviceID)
 	fmt.Printf("   Operation: %s\n", operation)
 	if len(cmdParams) > 0 {
@@ -248,5 +412,441 @@ func (cli *InteractiveCLI) addCommandToChangeset(args []string, changesetManager
 	}
 }
 
+// setChangesetRollout parses rollout options and sets them on a draft changeset
+func (cli *InteractiveCLI) setChangesetRollout(changesetID string, args []string, changesetManager *changeset.SimpleManager) {
+	if len(args) == 1 && args[0] == "off" {
+		if err := changesetManager.SetRolloutStrategy(changesetID, nil); err != nil {
+			fmt.Printf("❌ Failed to clear rollout: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Changeset %s will execute without staging\n", changesetID)
+		return
+	}
+
+	strategy := &types.RolloutStrategy{}
+	gate := &types.HealthGate{}
+	useGate := false
+
+	for _, arg := range args {
+		parts := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
+		if len(parts) != 2 {
+			fmt.Printf("❌ Invalid rollout option: %s\n", arg)
+			return
+		}
+		key, value := parts[0], parts[1]
+
+		var err error
+		switch key {
+		case "canary":
+			strategy.CanarySize, err = strconv.Atoi(value)
+		case "batch":
+			strategy.BatchSize, err = strconv.Atoi(value)
+		case "pause":
+			strategy.Pause, err = time.ParseDuration(value)
+		case "online":
+			gate.RequireOnline, err = strconv.ParseBool(value)
+			useGate = true
+		case "min_quality":
+			gate.MinQualityScore, err = strconv.ParseFloat(value, 64)
+			useGate = true
+		case "alerts":
+			gate.MaxNewAlerts, err = strconv.Atoi(value)
+			gate.CheckAlerts = true
+			useGate = true
+		default:
+			fmt.Printf("❌ Unknown rollout option: %s\n", key)
+			return
+		}
+		if err != nil {
+			fmt.Printf("❌ Invalid value for %s: %v\n", key, err)
+			return
+		}
+	}
+	if useGate {
+		strategy.HealthGate = gate
+	}
+
+	if err := changesetManager.SetRolloutStrategy(changesetID, strategy); err != nil {
+		fmt.Printf("❌ Failed to set rollout: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Rollout set for changeset %s\n", changesetID)
+	fmt.Printf("   Canary: %d, Batch: %d, Pause: %v\n", strategy.CanarySize, strategy.BatchSize, strategy.Pause)
+	if strategy.HealthGate != nil {
+		fmt.Printf("   Health gate: %s\n", formatHealthGate(strategy.HealthGate))
+	}
+}
+
+// controlChangesetRollout pauses, resumes or aborts a running rollout
+func (cli *InteractiveCLI) controlChangesetRollout(action, changesetID string, changesetManager *changeset.SimpleManager) {
+	var err error
+	switch action {
+	case "pause":
+		err = changesetManager.PauseRollout(changesetID)
+	case "resume":
+		err = changesetManager.ResumeRollout(changesetID)
+	case "abort":
+		err = changesetManager.AbortRollout(changesetID)
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to %s rollout: %v\n", action, err)
+		return
+	}
+	fmt.Printf("✅ Rollout %s requested for changeset %s\n", action, changesetID)
+}
+
+// showChangesetRollout prints the rollout strategy and progress of a changeset
+func (cli *InteractiveCLI) showChangesetRollout(cs *types.Changeset) {
+	strategy := cs.Rollout
+	fmt.Println("\nRollout:")
+	fmt.Println(strings.Repeat("-", 10))
+	fmt.Printf("  Canary: %d, Batch: %d, Pause: %v\n", strategy.CanarySize, strategy.BatchSize, strategy.Pause)
+	if strategy.HealthGate != nil {
+		fmt.Printf("  Health gate: %s\n", formatHealthGate(strategy.HealthGate))
+	}
+
+	state := cs.RolloutState
+	if state == nil {
+		return
+	}
+	for i, batch := range state.Batches {
+		marker := " "
+		if i == state.CurrentBatch {
+			marker = ">"
+		}
+		fmt.Printf("  %s batch %d: %s\n", marker, i+1, strings.Join(batch, ", "))
+	}
+	if state.Paused {
+		fmt.Println("  Paused")
+	}
+	if state.Aborted {
+		fmt.Println("  Aborted")
+	}
+	if state.HaltReason != "" {
+		fmt.Printf("  Halted: %s\n", state.HaltReason)
+	}
+}
+
+func formatHealthGate(gate *types.HealthGate) string {
+	var checks []string
+	if gate.RequireOnline {
+		checks = append(checks, "online")
+	}
+	if gate.MinQualityScore > 0 {
+		checks = append(checks, fmt.Sprintf("quality>=%.2f", gate.MinQualityScore))
+	}
+	if gate.CheckAlerts {
+		checks = append(checks, fmt.Sprintf("new alerts<=%d", gate.MaxNewAlerts))
+	}
+	if len(checks) == 0 {
+		return "none"
+	}
+	return strings.Join(checks, ", ")
+}
+
+// scheduleArgs splits --force and --tz=Zone from schedule arguments
+func scheduleArgs(args []string) (bool, string, []string) {
+	force := false
+	timezone := ""
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch {
+		case arg == "--force":
+			force = true
+		case strings.HasPrefix(arg, "--tz="):
+			timezone = strings.TrimPrefix(arg, "--tz=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return force, timezone, rest
+}
+
+// scheduleChangeset schedules a changeset once or on a cron expression
+func (cli *InteractiveCLI) scheduleChangeset(args []string, changesetManager *changeset.SimpleManager) {
+	force, timezone, rest := scheduleArgs(args)
+	createdBy, err := changesetUser()
+	if err != nil {
+		fmt.Printf("❌ Failed to schedule changeset: %v\n", err)
+		return
+	}
+
+	schedule := &types.ChangesetSchedule{
+		ChangesetID: rest[0],
+		Timezone:    timezone,
+		Force:       force,
+		CreatedBy:   createdBy,
+	}
+
+	switch rest[1] {
+	case "at":
+		if len(rest) != 3 {
+			fmt.Println("Usage: changeset schedule <changeset_id> at <time> [--force] [--tz=Zone]")
+			return
+		}
+		loc := time.Local
+		if timezone != "" {
+			var err error
+			if loc, err = time.LoadLocation(timezone); err != nil {
+				fmt.Printf("❌ Invalid timezone: %v\n", err)
+				return
+			}
+		}
+		runAt, err := time.Parse(time.RFC3339, rest[2])
+		if err != nil {
+			runAt, err = time.ParseInLocation("2006-01-02T15:04", rest[2], loc)
+		}
+		if err != nil {
+			fmt.Printf("❌ Invalid time %q: use RFC3339 or 2006-01-02T15:04\n", rest[2])
+			return
+		}
+		schedule.Type = types.ScheduleTypeOnce
+		schedule.RunAt = &runAt
+	case "cron":
+		if len(rest) != 7 {
+			fmt.Println("Usage: changeset schedule <changeset_id> cron <min> <hour> <dom> <month> <dow> [--force] [--tz=Zone]")
+			return
+		}
+		schedule.Type = types.ScheduleTypeCron
+		schedule.Cron = strings.Join(rest[2:], " ")
+	default:
+		fmt.Printf("❌ Unknown schedule type %q: use 'at' or 'cron'\n", rest[1])
+		return
+	}
+
+	created, err := changesetManager.ScheduleChangeset(schedule)
+	if err != nil {
+		fmt.Printf("❌ Failed to schedule changeset: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ Scheduled changeset %s (schedule %s)\n", created.ChangesetID, created.ID)
+	fmt.Printf("   Next run: %s\n", created.NextRun.Format(time.RFC3339))
+	if created.Force {
+		fmt.Println("   Maintenance windows: ignored (--force)")
+	}
+}
+
+// listChangesetSchedules prints all changeset schedules
+func (cli *InteractiveCLI) listChangesetSchedules(changesetManager *changeset.SimpleManager) {
+	schedules, err := changesetManager.ListSchedules()
+	if err != nil {
+		fmt.Printf("❌ Failed to list schedules: %v\n", err)
+		return
+	}
+	if len(schedules) == 0 {
+		fmt.Println("No changeset schedules")
+		return
+	}
+
+	fmt.Printf("%-36s %-36s %-5s %-10s %-25s %s\n", "SCHEDULE", "CHANGESET", "TYPE", "STATUS", "NEXT RUN", "LAST RESULT")
+	for _, schedule := range schedules {
+		next := "-"
+		if schedule.NextRun != nil {
+			next = schedule.NextRun.Format(time.RFC3339)
+		}
+		kind := schedule.Type
+		if schedule.Force {
+			kind += "!"
+		}
+		fmt.Printf("%-36s %-36s %-5s %-10s %-25s %s\n", schedule.ID, schedule.ChangesetID, kind, schedule.Status, next, schedule.LastResult)
+	}
+}
+
+// handleMaintenanceWindowCommand manages per-site maintenance windows
+func (cli *InteractiveCLI) handleMaintenanceWindowCommand(args []string, changesetManager *changeset.SimpleManager) {
+	if len(args) == 0 {
+		fmt.Println("Usage: changeset window add|list|remove ...")
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		_, timezone, rest := scheduleArgs(args[1:])
+		if len(rest) != 7 {
+			fmt.Println("Usage: changeset window add <tenant/site> <duration> <min> <hour> <dom> <month> <dow> [--tz=Zone]")
+			return
+		}
+		tenant, site, ok := strings.Cut(rest[0], "/")
+		if !ok {
+			fmt.Println("❌ Site must be given as tenant/site")
+			return
+		}
+		duration, err := time.ParseDuration(rest[1])
+		if err != nil {
+			fmt.Printf("❌ Invalid duration: %v\n", err)
+			return
+		}
+		window := &types.MaintenanceWindow{
+			Tenant:   tenant,
+			Site:     site,
+			Cron:     strings.Join(rest[2:], " "),
+			Duration: duration,
+			Timezone: timezone,
+		}
+		if err := changesetManager.AddMaintenanceWindow(window); err != nil {
+			fmt.Printf("❌ Failed to add maintenance window: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Added maintenance window %s for %s/%s\n", window.ID, tenant, site)
+	case "list":
+		var tenant, site string
+		if len(args) > 1 {
+			tenant, site, _ = strings.Cut(args[1], "/")
+		}
+		windows, err := changesetManager.ListMaintenanceWindows(tenant, site)
+		if err != nil {
+			fmt.Printf("❌ Failed to list maintenance windows: %v\n", err)
+			return
+		}
+		if len(windows) == 0 {
+			fmt.Println("No maintenance windows (sites without windows accept changesets at any time)")
+			return
+		}
+		for _, window := range windows {
+			zone := window.Timezone
+			if zone == "" {
+				zone = "local"
+			}
+			fmt.Printf("%s  %s/%s  %q for %v (%s)\n", window.ID, window.Tenant, window.Site, window.Cron, window.Duration, zone)
+		}
+	case "remove":
+		if len(args) < 2 {
+			fmt.Println("Usage: changeset window remove <window_id>")
+			return
+		}
+		if err := changesetManager.RemoveMaintenanceWindow(args[1]); err != nil {
+			fmt.Printf("❌ Failed to remove maintenance window: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Removed maintenance window %s\n", args[1])
+	default:
+		fmt.Printf("Unknown window subcommand: %s\n", args[0])
+	}
+}
+
+// changesetUser returns the OS user running the CLI. Changesets, approvals
+// and rejections are attributed to it; there is no option to act as someone
+// else, so the self-approval check cannot be bypassed.
+func changesetUser() (string, error) {
+	current, err := user.Current()
+	if err != nil || current.Username == "" {
+		return "", fmt.Errorf("cannot determine the current OS user: %v", err)
+	}
+	return current.Username, nil
+}
+
+// submitChangeset submits a draft changeset for approval
+func (cli *InteractiveCLI) submitChangeset(changesetID string, changesetManager *changeset.SimpleManager) {
+	requestedBy, err := changesetUser()
+	if err != nil {
+		fmt.Printf("❌ Failed to submit changeset: %v\n", err)
+		return
+	}
+	if err := changesetManager.SubmitForApproval(context.Background(), changesetID, requestedBy); err != nil {
+		fmt.Printf("❌ Failed to submit changeset: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ Changeset %s submitted for approval by %s\n", changesetID, requestedBy)
+	fmt.Println("Use 'changeset diff' to review what it would change")
+}
+
+// decideChangeset approves or rejects a changeset waiting for approval
+func (cli *InteractiveCLI) decideChangeset(approve bool, changesetID string, args []string, changesetManager *changeset.SimpleManager) {
+	approver, err := changesetUser()
+	if err != nil {
+		fmt.Printf("❌ Failed to record decision: %v\n", err)
+		return
+	}
+	comment := strings.Join(args, " ")
+
+	if approve {
+		err = changesetManager.ApproveChangeset(context.Background(), changesetID, approver, comment)
+	} else {
+		err = changesetManager.RejectChangeset(context.Background(), changesetID, approver, comment)
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to record decision: %v\n", err)
+		return
+	}
+
+	if approve {
+		fmt.Printf("✅ Changeset %s approved by %s\n", changesetID, approver)
+	} else {
+		fmt.Printf("✅ Changeset %s rejected by %s and returned to draft\n", changesetID, approver)
+	}
+}
+
+// diffChangeset prints the dry-run diff of a changeset
+func (cli *InteractiveCLI) diffChangeset(changesetID string, changesetManager *changeset.SimpleManager) {
+	diff, err := changesetManager.DryRunChangeset(changesetID)
+	if err != nil {
+		fmt.Printf("❌ Dry run failed: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Dry run of changeset %s (nothing sent)\n", changesetID)
+	fmt.Println(strings.Repeat("=", 40))
+	if len(diff.Devices) == 0 {
+		fmt.Println("No commands")
+		return
+	}
+
+	for _, device := range diff.Devices {
+		status := "no recorded state"
+		if device.Known {
+			status = "offline"
+			if device.Online {
+				status = "online"
+			}
+			if device.LastSeen > 0 {
+				status += ", last seen " + time.UnixMilli(device.LastSeen).Format(time.RFC3339)
+			}
+		}
+		fmt.Printf("\n%s (%s)\n", device.DeviceKey, status)
+
+		if len(device.Changes) == 0 {
+			fmt.Println("  (commands have no arguments to compare)")
+			continue
+		}
+		for _, change := range device.Changes {
+			marker := "~"
+			before := fmt.Sprintf("%v", change.Before)
+			if !change.Known {
+				marker = "+"
+				before = "(unknown)"
+			} else if !change.Changed {
+				marker = "="
+			}
+			fmt.Printf("  %s %s: %s -> %v  [%s]\n", marker, change.Field, before, change.After, change.Operation)
+		}
+	}
+	fmt.Println("\n~ changed, = unchanged, + no current value recorded")
+}
+
+// showChangesetApproval prints the approval state of a changeset
+func (cli *InteractiveCLI) showChangesetApproval(cs *types.Changeset) {
+	fmt.Println("\nApproval:")
+	fmt.Println(strings.Repeat("-", 10))
+	approval := cs.Approval
+	if approval == nil {
+		fmt.Println("  Required, not yet submitted")
+		return
+	}
+	fmt.Printf("  Requested by %s at %s\n", approval.RequestedBy, approval.RequestedAt.Format(time.RFC3339))
+	if approval.DecidedAt == nil {
+		fmt.Println("  Waiting for approver")
+		return
+	}
+	decision := "Approved"
+	if !approval.Approved {
+		decision = "Rejected"
+	}
+	fmt.Printf("  %s by %s at %s\n", decision, approval.Approver, approval.DecidedAt.Format(time.RFC3339))
+	if approval.Comment != "" {
+		fmt.Printf("  Comment: %s\n", approval.Comment)
+	}
+}
+
 // Additional helper functions for advanced changeset operations could go here
 // For example: batch operations, changeset templates, etc.
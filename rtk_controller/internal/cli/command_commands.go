@@ -48,16 +48,7 @@ func (c *CLI) sendCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	// Parse device ID to extract tenant, site, deviceID
-	deviceParts := strings.Split(deviceID, "-")
-	tenant := "default"
-	site := "default"
-	actualDeviceID := deviceID
-
-	if len(deviceParts) >= 3 {
-		tenant = deviceParts[0]
-		site = deviceParts[1]
-		actualDeviceID = strings.Join(deviceParts[2:], "-")
-	}
+	tenant, site, actualDeviceID := c.splitDeviceID(deviceID)
 
 	// Send command using the command manager interface
 	timeoutSeconds := int(timeout.Seconds())
@@ -122,7 +113,17 @@ func (c *CLI) commandHistory(cmd *cobra.Command, args []string) error {
 // commandCancel cancels a command
 func (c *CLI) commandCancel(cmd *cobra.Command, args []string) error {
 	commandID := args[0]
-	fmt.Printf("Command cancel functionality for %s requires integration with command manager\n", commandID)
+
+	command, err := c.commandManager.CancelCommand(commandID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel command: %w", err)
+	}
+
+	if command.Status == "cancelled" {
+		fmt.Printf("Command %s cancelled before delivery\n", commandID)
+		return nil
+	}
+	fmt.Printf("Cancel request %s sent for command %s\n", command.CancelRequestID, commandID)
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -398,3 +399,21 @@ func (c *CLI) addConfigCommands() {
 }
 
 // Command implementations will be in separate files for better organization
+
+// splitDeviceID splits a "tenant-site-device_id" argument. Shorter IDs name
+// a device of the configured default site.
+func (c *CLI) splitDeviceID(deviceID string) (tenant, site, id string) {
+	parts := strings.Split(deviceID, "-")
+	if len(parts) >= 3 {
+		return parts[0], parts[1], strings.Join(parts[2:], "-")
+	}
+
+	tenant, site = c.config.Sites.DefaultTenant, c.config.Sites.DefaultSite
+	if tenant == "" {
+		tenant = "default"
+	}
+	if site == "" {
+		site = "default"
+	}
+	return tenant, site, deviceID
+}
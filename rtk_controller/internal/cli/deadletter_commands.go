@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// handleDeadLetterCommand handles messages rejected by strict schema validation
+func (cli *InteractiveCLI) handleDeadLetterCommand(args []string) {
+	if cli.mqttClient == nil {
+		fmt.Println("MQTT client not available")
+		return
+	}
+
+	if len(args) == 0 {
+		fmt.Println("Dead-letter subcommands: list, show, replay, delete")
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		topicFilter := ""
+		if len(args) > 1 {
+			topicFilter = args[1]
+		}
+		cli.listDeadLetters(topicFilter)
+	case "show":
+		if len(args) < 2 {
+			fmt.Println("Usage: deadletter show <id>")
+			return
+		}
+		cli.showDeadLetter(args[1])
+	case "replay":
+		if len(args) < 2 {
+			fmt.Println("Usage: deadletter replay <id>|--all [topic_filter]")
+			return
+		}
+		cli.replayDeadLetters(args[1:])
+	case "delete", "rm":
+		if len(args) < 2 {
+			fmt.Println("Usage: deadletter delete <id>")
+			return
+		}
+		if err := cli.mqttClient.GetDeadLetterStore().Delete(args[1]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Dead letter %s deleted\n", args[1])
+	default:
+		fmt.Printf("Unknown deadletter subcommand: %s\n", args[0])
+	}
+}
+
+func (cli *InteractiveCLI) listDeadLetters(topicFilter string) {
+	letters, err := cli.mqttClient.GetDeadLetterStore().List(topicFilter)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(letters) == 0 {
+		fmt.Println("No dead-lettered messages")
+		return
+	}
+
+	fmt.Printf("%-18s %-20s %-45s %-20s %-7s %s\n", "ID", "RECEIVED", "TOPIC", "SCHEMA", "REPLAYS", "FIRST ERROR")
+	fmt.Println(strings.Repeat("-", 140))
+
+	for _, letter := range letters {
+		firstError := ""
+		if len(letter.Errors) > 0 {
+			firstError = letter.Errors[0]
+		}
+		if len(letter.LastReplayErrors) > 0 {
+			firstError = letter.LastReplayErrors[0]
+		}
+		fmt.Printf("%-18s %-20s %-45s %-20s %-7d %s\n",
+			letter.ID, time.UnixMilli(letter.ReceivedAt).Format("2006-01-02 15:04:05"),
+			letter.Topic, letter.Schema, letter.ReplayCount, firstError)
+	}
+	fmt.Printf("\nTotal: %d\n", len(letters))
+}
+
+func (cli *InteractiveCLI) showDeadLetter(id string) {
+	letter, err := cli.mqttClient.GetDeadLetterStore().Get(id)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Dead Letter: %s\n", letter.ID)
+	fmt.Printf("Topic:       %s\n", letter.Topic)
+	fmt.Printf("Received:    %s\n", time.UnixMilli(letter.ReceivedAt).Format("2006-01-02 15:04:05"))
+	fmt.Printf("QoS:         %d (retained: %t)\n", letter.QoS, letter.Retained)
+	fmt.Printf("Schema:      %s\n", letter.Schema)
+
+	fmt.Println("\nValidation Errors:")
+	for _, e := range letter.Errors {
+		fmt.Printf("  - %s\n", e)
+	}
+
+	if letter.ReplayCount > 0 {
+		fmt.Printf("\nReplays:     %d (last %s)\n", letter.ReplayCount,
+			time.UnixMilli(letter.LastReplayAt).Format("2006-01-02 15:04:05"))
+		for _, e := range letter.LastReplayErrors {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+
+	fmt.Println("\nPayload:")
+	var pretty interface{}
+	if err := json.Unmarshal([]byte(letter.Payload), &pretty); err == nil {
+		data, _ := json.MarshalIndent(pretty, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		fmt.Println(letter.Payload)
+	}
+}
+
+func (cli *InteractiveCLI) replayDeadLetters(args []string) {
+	ids := []string{args[0]}
+	if args[0] == "--all" {
+		topicFilter := ""
+		if len(args) > 1 {
+			topicFilter = args[1]
+		}
+		letters, err := cli.mqttClient.GetDeadLetterStore().List(topicFilter)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		ids = ids[:0]
+		for _, letter := range letters {
+			ids = append(ids, letter.ID)
+		}
+	}
+
+	replayed, failed := 0, 0
+	for _, id := range ids {
+		result, err := cli.mqttClient.ReplayDeadLetter(id)
+		if err != nil {
+			fmt.Printf("%s: error: %v\n", id, err)
+			failed++
+			continue
+		}
+		if !result.Valid {
+			fmt.Printf("%s: still invalid: %s\n", id, strings.Join(result.Errors, "; "))
+			failed++
+			continue
+		}
+		fmt.Printf("%s: replayed (schema %s)\n", id, result.Schema)
+		replayed++
+	}
+
+	if len(ids) > 1 {
+		fmt.Printf("\nReplayed %d, still dead-lettered %d\n", replayed, failed)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -84,14 +83,11 @@ func (c *CLI) printJSON(data interface{}) error {
 
 func (c *CLI) requestDeviceStatus(deviceID string) error {
 	// Parse device ID to get tenant, site
-	parts := strings.Split(deviceID, "-")
-	if len(parts) < 2 {
-		return fmt.Errorf("invalid device ID format")
-	}
+	tenant, site, actualDeviceID := c.splitDeviceID(deviceID)
 
 	// Create command to request device status
 	commandID := fmt.Sprintf("status-%d", time.Now().UnixMilli())
-	topic := fmt.Sprintf("rtk/v1/%s/%s/%s/cmd/req", "default", "default", deviceID)
+	topic := fmt.Sprintf("rtk/v1/%s/%s/%s/cmd/req", tenant, site, actualDeviceID)
 
 	payload := map[string]interface{}{
 		"id":         commandID,
@@ -9,14 +9,18 @@ import (
 
 	"github.com/chzyer/readline"
 
+	"rtk_controller/internal/changeset"
 	"rtk_controller/internal/command"
 	"rtk_controller/internal/config"
 	"rtk_controller/internal/device"
 	"rtk_controller/internal/diagnosis"
 	"rtk_controller/internal/identity"
 	"rtk_controller/internal/mqtt"
+	"rtk_controller/internal/schema"
 	"rtk_controller/internal/storage"
+	"rtk_controller/internal/tenancy"
 	"rtk_controller/internal/topology"
+	"rtk_controller/pkg/types"
 )
 
 // InteractiveCLI provides an interactive command line interface
@@ -29,8 +33,15 @@ type InteractiveCLI struct {
 	diagnosisManager *diagnosis.Manager
 	topologyManager  *topology.Manager
 	identityManager  *identity.Manager
+	schemaManager    *schema.Manager
 	changesetManager interface{} // Using interface{} to avoid import cycle
 	topologyCommands *TopologyCommands
+	siteRegistry     *tenancy.Registry
+	backupManager    *storage.BackupManager
+
+	// Tenant and site that scoped commands apply to (see "site use")
+	tenant string
+	site   string
 
 	// Command history and state
 	history []string
@@ -53,6 +64,8 @@ func NewInteractiveCLI(
 		deviceManager:    deviceManager,
 		commandManager:   commandManager,
 		diagnosisManager: diagnosisManager,
+		tenant:           config.Sites.DefaultTenant,
+		site:             config.Sites.DefaultSite,
 		history:          make([]string, 0),
 		running:          false,
 	}
@@ -97,6 +110,9 @@ func (cli *InteractiveCLI) Start() {
 		}
 
 		cli.executor(strings.TrimSpace(line))
+		if !cli.running {
+			break
+		}
 	}
 }
 
@@ -130,6 +146,11 @@ func (cli *InteractiveCLI) SetIdentityManager(manager *identity.Manager) {
 	}
 }
 
+// SetSchemaManager sets the schema manager
+func (cli *InteractiveCLI) SetSchemaManager(manager *schema.Manager) {
+	cli.schemaManager = manager
+}
+
 // SetChangesetManager sets the changeset manager
 func (cli *InteractiveCLI) SetChangesetManager(manager interface{}) {
 	cli.changesetManager = manager
@@ -142,30 +163,17 @@ func (cli *InteractiveCLI) handleChangesetCommandWrapper(args []string) {
 		return
 	}
 
-	// Since we can't import changeset package directly (circular import),
-	// we use interface{} and perform reflection-like operations
-	// This is a temporary solution - in production we'd use proper interfaces
-
-	// For now, provide basic changeset functionality
-	if len(args) == 0 {
-		fmt.Println("Changeset commands: create, list, show, execute, rollback")
-		fmt.Println("(Full changeset functionality requires proper type integration)")
+	manager, ok := cli.changesetManager.(*changeset.SimpleManager)
+	if !ok {
+		fmt.Println("Changeset manager has an unsupported type")
 		return
 	}
 
-	switch args[0] {
-	case "help":
-		fmt.Println("Changeset Management Commands:")
-		fmt.Println("  changeset create [description]  - Create new changeset")
-		fmt.Println("  changeset list                  - List all changesets")
-		fmt.Println("  changeset show <id>             - Show changeset details")
-		fmt.Println("  changeset execute <id>          - Execute changeset")
-		fmt.Println("  changeset rollback <id>         - Rollback changeset")
-	default:
-		fmt.Printf("Changeset command '%s' recognized but not fully implemented\n", args[0])
-		fmt.Println("Changeset functionality requires proper integration")
-		fmt.Println("Use 'changeset help' for available commands")
+	if len(args) > 0 && args[0] == "help" {
+		cli.showChangesetHelp()
+		return
 	}
+	cli.handleChangesetCommand(args, manager)
 }
 
 // executor handles command execution
@@ -211,6 +219,10 @@ func (cli *InteractiveCLI) executor(input string) {
 		cli.handleLLMCommand(args)
 	case "changeset", "cs":
 		cli.handleChangesetCommandWrapper(args)
+	case "deadletter", "dlq":
+		cli.handleDeadLetterCommand(args)
+	case "schema":
+		cli.handleSchemaCommand(args)
 	case "config", "cfg":
 		cli.handleConfigCommand(args)
 	case "log":
@@ -223,6 +235,8 @@ func (cli *InteractiveCLI) executor(input string) {
 		cli.handleTopologyCommand(args)
 	case "identity", "id":
 		cli.handleIdentityCommand(args)
+	case "site":
+		cli.handleSiteCommand(args)
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		fmt.Println("Type 'help' for available commands")
@@ -250,7 +264,14 @@ func (cli *InteractiveCLI) createCompleter() readline.AutoCompleter {
 			readline.PcItem("list"),
 			readline.PcItem("show"),
 			readline.PcItem("cancel"),
+			readline.PcItem("watch"),
+			readline.PcItem("queue"),
 			readline.PcItem("stats"),
+			readline.PcItem("group",
+				readline.PcItem("send"),
+				readline.PcItem("list"),
+				readline.PcItem("show"),
+			),
 		),
 		readline.PcItem("event",
 			readline.PcItem("list"),
@@ -289,8 +310,39 @@ func (cli *InteractiveCLI) createCompleter() readline.AutoCompleter {
 			readline.PcItem("execute"),
 			readline.PcItem("rollback"),
 			readline.PcItem("add"),
+			readline.PcItem("add-rollback"),
+			readline.PcItem("diff"),
+			readline.PcItem("submit"),
+			readline.PcItem("approve"),
+			readline.PcItem("reject"),
+			readline.PcItem("schedule"),
+			readline.PcItem("schedules"),
+			readline.PcItem("unschedule"),
+			readline.PcItem("window",
+				readline.PcItem("add"),
+				readline.PcItem("list"),
+				readline.PcItem("remove"),
+			),
+			readline.PcItem("rollout"),
+			readline.PcItem("pause"),
+			readline.PcItem("resume"),
+			readline.PcItem("abort"),
 			readline.PcItem("help"),
 		),
+		readline.PcItem("schema",
+			readline.PcItem("status"),
+			readline.PcItem("reload"),
+			readline.PcItem("versions"),
+			readline.PcItem("deprecate"),
+			readline.PcItem("undeprecate"),
+			readline.PcItem("compat"),
+		),
+		readline.PcItem("deadletter",
+			readline.PcItem("list"),
+			readline.PcItem("show"),
+			readline.PcItem("replay"),
+			readline.PcItem("delete"),
+		),
 		readline.PcItem("config",
 			readline.PcItem("show"),
 			readline.PcItem("reload"),
@@ -311,6 +363,14 @@ func (cli *InteractiveCLI) createCompleter() readline.AutoCompleter {
 			readline.PcItem("info"),
 			readline.PcItem("health"),
 			readline.PcItem("stats"),
+			readline.PcItem("storage",
+				readline.PcItem("status"),
+				readline.PcItem("backup"),
+				readline.PcItem("list"),
+				readline.PcItem("validate"),
+				readline.PcItem("restore"),
+				readline.PcItem("compact"),
+			),
 		),
 		readline.PcItem("topology",
 			readline.PcItem("show"),
@@ -322,7 +382,13 @@ func (cli *InteractiveCLI) createCompleter() readline.AutoCompleter {
 			readline.PcItem("quality"),
 			readline.PcItem("roaming"),
 			readline.PcItem("monitoring"),
-			readline.PcItem("alerts"),
+			readline.PcItem("alerts",
+				readline.PcItem("rules",
+					readline.PcItem("list"),
+					readline.PcItem("validate"),
+					readline.PcItem("test"),
+				),
+			),
 		),
 		readline.PcItem("identity",
 			readline.PcItem("list"),
@@ -331,6 +397,12 @@ func (cli *InteractiveCLI) createCompleter() readline.AutoCompleter {
 			readline.PcItem("update"),
 			readline.PcItem("stats"),
 		),
+		readline.PcItem("site",
+			readline.PcItem("list"),
+			readline.PcItem("use"),
+			readline.PcItem("show"),
+			readline.PcItem("register"),
+		),
 	)
 }
 
@@ -352,30 +424,41 @@ func (cli *InteractiveCLI) showHelp(args []string) {
 		fmt.Println("  changeset <subcommand> - Changeset management")
 		fmt.Println("  topology <subcommand> - Network topology management")
 		fmt.Println("  identity <subcommand> - Device identity management")
+		fmt.Println("  site <subcommand>  - Tenant/site scope for device, command, topology and llm")
+		fmt.Println("  schema <subcommand> - Schema versions and device compatibility")
+		fmt.Println("  deadletter <subcommand> - Messages rejected by strict schema validation")
 		fmt.Println("  config <subcommand> - Configuration management")
 		fmt.Println("  log <subcommand>   - Log management")
 		fmt.Println("  test <subcommand>  - Test commands")
-		fmt.Println("  system <subcommand> - System information")
+		fmt.Println("  system <subcommand> - System information, storage backups and restore")
 		fmt.Println()
 		fmt.Println("Use 'help <command>' for detailed help on a specific command")
+		fmt.Println("Scoped commands accept --site=<tenant>/<site> to override the current site")
 		return
 	}
 
 	switch args[0] {
 	case "device":
 		fmt.Println("Device management commands:")
-		fmt.Println("  device list [--status=online|offline] [--limit=N] - List devices")
+		fmt.Println("  device list [--all] - List devices of the current site, or of every site")
 		fmt.Println("  device show <device_id> - Show device details")
 		fmt.Println("  device status <device_id> - Show device status")
 		fmt.Println("  device history <device_id> - Show device history")
 		fmt.Println("  device stats - Show device statistics")
 	case "command":
 		fmt.Println("Command management commands:")
-		fmt.Println("  command send <device_id> <operation> [args...] - Send command")
+		fmt.Println("  command send <device_id> <operation> [timeout_seconds] [low|normal|high] - Send command to a device of the current site")
 		fmt.Println("  command list [--device=<id>] [--status=<status>] - List commands")
 		fmt.Println("  command show <command_id> - Show command details")
 		fmt.Println("  command cancel <command_id> - Cancel pending command")
+		fmt.Println("  command watch <command_id> [seconds] - Follow progress until the command finishes")
+		fmt.Println("  command queue - List commands waiting for delivery or retry")
 		fmt.Println("  command stats - Show command statistics")
+		fmt.Println("  command group send <target> <operation> [timeout_seconds] - Send to a group of devices")
+		fmt.Println("      target: group:<tenant>/<site>/<group>, tag:<tenant>/<site>/<tag>,")
+		fmt.Println("              site:<tenant>/<site|*>, broadcast[:<tenant>]")
+		fmt.Println("  command group list - List group commands")
+		fmt.Println("  command group show <command_id> - Show per-device status of a group command")
 	case "event":
 		fmt.Println("Event monitoring commands:")
 		fmt.Println("  event list [--device=<id>] [--type=<type>] - List events")
@@ -394,10 +477,15 @@ func (cli *InteractiveCLI) showHelp(args []string) {
 		fmt.Println("  topology roaming [device_id] - Show roaming information")
 		fmt.Println("  topology monitoring - Show monitoring status")
 		fmt.Println("  topology alerts - Show topology alerts")
+		fmt.Println("  topology alerts rules [list] - List alert rules")
+		fmt.Println("  topology alerts rules validate <file|expression> - Check a rule file or expression")
+		fmt.Println("  topology alerts rules test <rule-id|file|expression> [--since=24h] [--until=<time>] [--step=1m]")
+		fmt.Println("                           - Show when rules would have fired over stored history")
+		fmt.Println("  Expression example: rssi < -75 for 5m on group:bedroom")
 	case "llm", "ai":
 		fmt.Println("LLM Diagnostic Tool Commands:")
 		fmt.Println("  llm list                           - List available LLM tools")
-		fmt.Println("  llm exec <tool> [params]           - Execute LLM tool")
+		fmt.Println("  llm exec <tool> [params]           - Execute LLM tool (tenant/site params default to the current site)")
 		fmt.Println("  llm session create [device_id]     - Create new session")
 		fmt.Println("  llm session list                   - List active sessions")
 		fmt.Println("  llm session close <session_id>     - Close session")
@@ -424,12 +512,33 @@ func (cli *InteractiveCLI) showHelp(args []string) {
 		fmt.Println("  changeset execute <id>               - Execute changeset")
 		fmt.Println("  changeset rollback <id>              - Rollback changeset")
 		fmt.Println("  changeset add <id> <device> <op> [args] - Add command to changeset")
+		fmt.Println("  changeset add-rollback <id> <device> <op> [args] - Add rollback command")
+		fmt.Println("  changeset diff <id>                  - Dry-run before/after per device")
+		fmt.Println("  changeset submit|approve|reject <id> - Approval workflow")
+		fmt.Println("  changeset schedule <id> at|cron ...  - Schedule execution")
+		fmt.Println("  changeset window add|list|remove     - Per-site maintenance windows")
+		fmt.Println("  changeset rollout <id> [canary=N] [batch=N] [pause=30s] [gate...] - Stage execution")
+		fmt.Println("  changeset pause|resume|abort <id>    - Control a running rollout")
 		fmt.Println("")
 		fmt.Println("Examples:")
 		fmt.Println("  changeset create \"Update WiFi settings\"")
 		fmt.Println("  changeset add cs-123 device1 configure_wifi --ssid=NewSSID")
 		fmt.Println("  changeset execute cs-123")
 		fmt.Println("  changeset rollback cs-123")
+	case "deadletter", "dlq":
+		fmt.Println("Dead-letter commands (schema.strict_validation):")
+		fmt.Println("  deadletter list [topic_filter]       - List rejected messages")
+		fmt.Println("  deadletter show <id>                 - Show payload and validation errors")
+		fmt.Println("  deadletter replay <id>|--all [topic_filter] - Re-validate and process messages that now pass")
+		fmt.Println("  deadletter delete <id>               - Discard a rejected message")
+	case "schema":
+		fmt.Println("Schema commands:")
+		fmt.Println("  schema status                        - Loaded schemas, watched directories and reload alerts")
+		fmt.Println("  schema reload                        - Reload schemas now (keeps the old set on error)")
+		fmt.Println("  schema versions [name]               - List registered schema versions")
+		fmt.Println("  schema deprecate <name> <version>    - Mark a schema version deprecated")
+		fmt.Println("  schema undeprecate <name> <version>  - Mark a schema version current again")
+		fmt.Println("  schema compat [--all]                - Devices on deprecated or unregistered versions")
 	case "identity":
 		fmt.Println("Identity management commands:")
 		fmt.Println("  identity list - List device identities")
@@ -437,6 +546,29 @@ func (cli *InteractiveCLI) showHelp(args []string) {
 		fmt.Println("  identity classify <device_id> - Classify device type")
 		fmt.Println("  identity update <device_id> [--name=<name>] [--type=<type>] - Update device identity")
 		fmt.Println("  identity stats - Show identity statistics")
+	case "system", "sys":
+		fmt.Println("System commands:")
+		fmt.Println("  system info                          - Version and storage path")
+		fmt.Println("  system health                        - Health of MQTT, storage and managers")
+		fmt.Println("  system stats                         - Device, command and event statistics")
+		fmt.Println("  system storage [status]              - Database size, backup settings and last runs")
+		fmt.Println("  system storage backup                - Write a snapshot to the backup directory now")
+		fmt.Println("  system storage list                  - List snapshots, newest first")
+		fmt.Println("  system storage validate <snapshot>   - Check that a snapshot can be restored")
+		fmt.Println("  system storage restore <snapshot>    - Swap a snapshot in (service must be stopped; ends the session)")
+		fmt.Println("  system storage compact               - Rewrite the database file without dead entries")
+		fmt.Println("")
+		fmt.Println("<snapshot> is a file name in the backup directory or a path.")
+		fmt.Println("Restore first saves the current contents as a new snapshot.")
+	case "site":
+		fmt.Println("Site commands:")
+		fmt.Println("  site [show]                          - Show the current tenant/site scope")
+		fmt.Println("  site list [tenant]                   - List known sites and whether their managers are active")
+		fmt.Println("  site use <tenant>/<site>             - Scope device, command, topology and llm commands to a site")
+		fmt.Println("  site register <tenant>/<site> [name] - Register a site before its devices report")
+		fmt.Println("")
+		fmt.Println("Topology and QoS managers are created for a site on first use.")
+		fmt.Println("A single command can target another site with --site=<tenant>/<site>.")
 	default:
 		fmt.Printf("No help available for command: %s\n", args[0])
 	}
@@ -505,6 +637,18 @@ func (cli *InteractiveCLI) handleDeviceCommand(args []string) {
 }
 
 func (cli *InteractiveCLI) listDevices(args []string) {
+	tenant, site, args, err := cli.scopeArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	filter := &types.DeviceFilter{Tenant: tenant, Site: site}
+	for _, arg := range args {
+		if arg == "--all" {
+			filter = nil
+		}
+	}
+
 	fmt.Println("Device List")
 	fmt.Println("-----------")
 
@@ -513,7 +657,10 @@ func (cli *InteractiveCLI) listDevices(args []string) {
 		return
 	}
 
-	devices, total, err := cli.deviceManager.ListDevices(nil, 50, 0)
+	if filter != nil {
+		fmt.Printf("Site: %s/%s\n", tenant, site)
+	}
+	devices, total, err := cli.deviceManager.ListDevices(filter, 50, 0)
 	if err != nil {
 		fmt.Printf("Error listing devices: %v\n", err)
 		return
@@ -542,13 +689,18 @@ func (cli *InteractiveCLI) listDevices(args []string) {
 }
 
 func (cli *InteractiveCLI) showDevice(args []string) {
+	tenant, site, args, err := cli.scopeArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 	if len(args) == 0 {
-		fmt.Println("Usage: device show <device_id>")
+		fmt.Println("Usage: device show <device_id> [--site=<tenant>/<site>]")
 		return
 	}
 
 	deviceID := args[0]
-	device, err := cli.deviceManager.GetDevice("", "", deviceID)
+	device, err := cli.deviceManager.GetDevice(tenant, site, deviceID)
 	if err != nil {
 		fmt.Printf("Error getting device: %v\n", err)
 		return
@@ -580,16 +732,28 @@ func (cli *InteractiveCLI) showDevice(args []string) {
 			fmt.Printf("  %s: %v\n", key, value)
 		}
 	}
+
+	if len(device.SchemaVersions) > 0 {
+		fmt.Println("\nSchema Versions:")
+		for name, version := range device.SchemaVersions {
+			fmt.Printf("  %s: %s\n", name, version)
+		}
+	}
 }
 
 func (cli *InteractiveCLI) showDeviceStatus(args []string) {
+	tenant, site, args, err := cli.scopeArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 	if len(args) == 0 {
-		fmt.Println("Usage: device status <device_id>")
+		fmt.Println("Usage: device status <device_id> [--site=<tenant>/<site>]")
 		return
 	}
 
 	deviceID := args[0]
-	device, err := cli.deviceManager.GetDevice("", "", deviceID)
+	device, err := cli.deviceManager.GetDevice(tenant, site, deviceID)
 	if err != nil {
 		fmt.Printf("Error getting device: %v\n", err)
 		return
@@ -654,19 +818,25 @@ func (cli *InteractiveCLI) showDeviceStats() {
 
 func (cli *InteractiveCLI) handleCommandCommand(args []string) {
 	if len(args) == 0 {
-		fmt.Println("Command subcommands: send, list, show, cancel, stats")
+		fmt.Println("Command subcommands: send, list, show, cancel, watch, queue, stats, group")
 		return
 	}
 
 	switch args[0] {
 	case "send":
 		cli.sendCommand(args[1:])
+	case "group":
+		cli.handleGroupCommand(args[1:])
 	case "list":
 		cli.listCommands(args[1:])
 	case "show":
 		cli.showCommand(args[1:])
 	case "cancel":
 		cli.cancelCommand(args[1:])
+	case "watch":
+		cli.watchCommand(args[1:])
+	case "queue":
+		cli.listQueuedCommands()
 	case "stats":
 		cli.showCommandStats()
 	default:
@@ -675,9 +845,14 @@ func (cli *InteractiveCLI) handleCommandCommand(args []string) {
 }
 
 func (cli *InteractiveCLI) sendCommand(args []string) {
+	tenant, site, args, err := cli.scopeArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 	if len(args) < 2 {
-		fmt.Println("Usage: command send <device_id> <operation> [timeout_seconds]")
-		fmt.Println("Example: command send device1 reboot 30")
+		fmt.Println("Usage: command send <device_id> <operation> [timeout_seconds] [low|normal|high]")
+		fmt.Println("Example: command send device1 reboot 30 high")
 		return
 	}
 
@@ -689,15 +864,29 @@ func (cli *InteractiveCLI) sendCommand(args []string) {
 		fmt.Sscanf(args[2], "%d", &timeout)
 	}
 
-	fmt.Printf("Sending command '%s' to device '%s' (timeout: %ds)...\n", operation, deviceID, timeout)
+	var opts command.SendOptions
+	if len(args) > 3 {
+		priority, err := command.ParsePriority(args[3])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		opts.Priority = &priority
+	}
 
-	cmd, err := cli.commandManager.SendCommand("", "", deviceID, operation, map[string]interface{}{}, timeout)
+	fmt.Printf("Sending command '%s' to device '%s/%s/%s' (timeout: %ds)...\n", operation, tenant, site, deviceID, timeout)
+
+	cmd, err := cli.commandManager.SendCommandWithOptions(tenant, site, deviceID, operation, map[string]interface{}{}, timeout, opts)
 	if err != nil {
 		fmt.Printf("Error sending command: %v\n", err)
 		return
 	}
 
-	fmt.Printf("Command sent successfully!\n")
+	if cmd.Status == "queued" {
+		fmt.Printf("Command queued for delivery\n")
+	} else {
+		fmt.Printf("Command sent successfully!\n")
+	}
 	fmt.Printf("Command ID: %s\n", cmd.ID)
 	fmt.Printf("Status: %s\n", cmd.Status)
 }
@@ -748,6 +937,8 @@ func (cli *InteractiveCLI) showCommand(args []string) {
 	fmt.Printf("Device ID:    %s\n", cmd.DeviceID)
 	fmt.Printf("Operation:    %s\n", cmd.Operation)
 	fmt.Printf("Status:       %s\n", cmd.Status)
+	fmt.Printf("Priority:     %d\n", cmd.Priority)
+	fmt.Printf("Attempts:     %d/%d\n", cmd.Attempts, cmd.MaxAttempts)
 	fmt.Printf("Timeout:      %d ms\n", cmd.TimeoutMS)
 	fmt.Printf("Created At:   %s\n", cmd.CreatedAt.Format("2006-01-02 15:04:05"))
 
@@ -755,6 +946,10 @@ func (cli *InteractiveCLI) showCommand(args []string) {
 		fmt.Printf("Sent At:      %s\n", cmd.SentAt.Format("2006-01-02 15:04:05"))
 	}
 
+	if cmd.NextAttemptAt != nil {
+		fmt.Printf("Next Attempt: %s\n", cmd.NextAttemptAt.Format("2006-01-02 15:04:05"))
+	}
+
 	if cmd.CompletedAt != nil {
 		fmt.Printf("Completed At: %s\n", cmd.CompletedAt.Format("2006-01-02 15:04:05"))
 	}
@@ -770,6 +965,13 @@ func (cli *InteractiveCLI) showCommand(args []string) {
 		}
 	}
 
+	if len(cmd.Progress) > 0 {
+		fmt.Println("\nProgress:")
+		for key, value := range cmd.Progress {
+			fmt.Printf("  %s: %v\n", key, value)
+		}
+	}
+
 	if len(cmd.Result) > 0 {
 		fmt.Println("\nResult:")
 		for key, value := range cmd.Result {
@@ -786,7 +988,108 @@ func (cli *InteractiveCLI) cancelCommand(args []string) {
 
 	commandID := args[0]
 	fmt.Printf("Cancelling command: %s\n", commandID)
-	fmt.Println("Command cancellation is not yet implemented")
+
+	cmd, err := cli.commandManager.CancelCommand(commandID)
+	if err != nil {
+		fmt.Printf("Error cancelling command: %v\n", err)
+		return
+	}
+
+	if cmd.Status == "cancelled" {
+		fmt.Println("Command cancelled before delivery")
+		return
+	}
+	fmt.Printf("Cancel request %s sent to device\n", cmd.CancelRequestID)
+	fmt.Printf("Use 'command watch %s' to follow the cancellation\n", commandID)
+}
+
+func (cli *InteractiveCLI) watchCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: command watch <command_id> [seconds]")
+		return
+	}
+
+	commandID := args[0]
+	cmd, err := cli.commandManager.GetCommand(commandID)
+	if err != nil {
+		fmt.Printf("Error getting command: %v\n", err)
+		return
+	}
+	if cmd.CompletedAt != nil {
+		fmt.Printf("Command already finished with status %s\n", cmd.Status)
+		return
+	}
+
+	wait := time.Duration(cmd.TimeoutMS)*time.Millisecond + 15*time.Second
+	if len(args) > 1 {
+		var seconds int
+		fmt.Sscanf(args[1], "%d", &seconds)
+		if seconds > 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+	}
+
+	updates := make(chan command.CommandUpdate, 16)
+	subID := cli.commandManager.Subscribe(commandID, func(update command.CommandUpdate) {
+		select {
+		case updates <- update:
+		default:
+		}
+	})
+	defer cli.commandManager.Unsubscribe(subID)
+
+	fmt.Printf("Watching command %s (%s), status %s\n", commandID, cmd.Operation, cmd.Status)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case update := <-updates:
+			ts := time.Now().Format("15:04:05")
+			switch update.Kind {
+			case command.UpdateProgress:
+				fmt.Printf("[%s] progress:", ts)
+				for key, value := range update.Command.Progress {
+					fmt.Printf(" %s=%v", key, value)
+				}
+				fmt.Println()
+			case command.UpdateFinished:
+				fmt.Printf("[%s] finished: %s", ts, update.Command.Status)
+				if update.Command.Error != "" {
+					fmt.Printf(" (%s)", update.Command.Error)
+				}
+				fmt.Println()
+				return
+			default:
+				fmt.Printf("[%s] %s: status %s\n", ts, update.Kind, update.Command.Status)
+			}
+		case <-timer.C:
+			fmt.Println("Stopped watching; the command is still running")
+			return
+		}
+	}
+}
+
+func (cli *InteractiveCLI) listQueuedCommands() {
+	queued := cli.commandManager.QueuedCommands()
+	if len(queued) == 0 {
+		fmt.Println("No queued commands")
+		return
+	}
+
+	fmt.Printf("%-25s %-30s %-15s %-8s %-8s %-20s\n", "COMMAND ID", "DEVICE ID", "OPERATION", "PRIORITY", "ATTEMPTS", "NEXT ATTEMPT")
+	fmt.Println(strings.Repeat("-", 110))
+
+	for _, cmd := range queued {
+		next := "when online"
+		if cmd.NextAttemptAt != nil {
+			next = cmd.NextAttemptAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-25s %-30s %-15s %-8d %-8s %-20s\n",
+			cmd.ID, cmd.DeviceID, cmd.Operation, cmd.Priority,
+			fmt.Sprintf("%d/%d", cmd.Attempts, cmd.MaxAttempts), next)
+	}
 }
 
 func (cli *InteractiveCLI) showCommandStats() {
@@ -801,6 +1104,7 @@ func (cli *InteractiveCLI) showCommandStats() {
 	fmt.Println("==================")
 	fmt.Printf("Total Commands:     %d\n", stats.TotalCommands)
 	fmt.Printf("Pending Commands:   %d\n", stats.PendingCommands)
+	fmt.Printf("Queued Commands:    %d\n", stats.QueuedCommands)
 	fmt.Printf("Completed Commands: %d\n", stats.CompletedCommands)
 	fmt.Printf("Failed Commands:    %d\n", stats.FailedCommands)
 	fmt.Printf("Timeout Commands:   %d\n", stats.TimeoutCommands)
@@ -814,6 +1118,121 @@ func (cli *InteractiveCLI) showCommandStats() {
 	}
 }
 
+func (cli *InteractiveCLI) handleGroupCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Group command subcommands: send, list, show")
+		return
+	}
+
+	switch args[0] {
+	case "send":
+		cli.sendGroupCommand(args[1:])
+	case "list":
+		cli.listGroupCommands()
+	case "show":
+		cli.showGroupCommand(args[1:])
+	default:
+		fmt.Printf("Unknown group command subcommand: %s\n", args[0])
+	}
+}
+
+func (cli *InteractiveCLI) sendGroupCommand(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: command group send <target> <operation> [timeout_seconds]")
+		fmt.Println("Example: command group send group:office/floor1/lights light.set 30")
+		return
+	}
+
+	target, err := command.ParseGroupTarget(args[0])
+	if err != nil {
+		fmt.Printf("Invalid target: %v\n", err)
+		return
+	}
+
+	operation := args[1]
+	timeout := 30 // default timeout
+	if len(args) > 2 {
+		fmt.Sscanf(args[2], "%d", &timeout)
+	}
+
+	group, err := cli.commandManager.SendGroupCommand(target, operation, map[string]interface{}{}, timeout)
+	if err != nil {
+		fmt.Printf("Error sending group command: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Group command sent successfully!\n")
+	fmt.Printf("Command ID: %s\n", group.ID)
+	if group.Topic != "" {
+		fmt.Printf("Topic:      %s\n", group.Topic)
+	}
+	fmt.Printf("Members:    %d\n", len(group.Members))
+}
+
+func (cli *InteractiveCLI) listGroupCommands() {
+	groups, err := cli.commandManager.ListGroupCommands(20)
+	if err != nil {
+		fmt.Printf("Error listing group commands: %v\n", err)
+		return
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No group commands found")
+		return
+	}
+
+	fmt.Printf("%-18s %-32s %-16s %-9s %-26s %-20s\n", "COMMAND ID", "TARGET", "OPERATION", "STATUS", "ACK/DONE/FAIL/TIMEOUT", "CREATED AT")
+	fmt.Println(strings.Repeat("-", 125))
+
+	for _, group := range groups {
+		summary := group.Summary()
+		progress := fmt.Sprintf("%d/%d/%d/%d of %d", summary.Acked, summary.Completed, summary.Failed, summary.TimedOut, summary.Total)
+		fmt.Printf("%-18s %-32s %-16s %-9s %-26s %-20s\n",
+			group.ID, group.Target.String(), group.Operation, group.Status, progress,
+			group.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+}
+
+func (cli *InteractiveCLI) showGroupCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: command group show <command_id>")
+		return
+	}
+
+	group, err := cli.commandManager.GetGroupCommand(args[0])
+	if err != nil {
+		fmt.Printf("Error getting group command: %v\n", err)
+		return
+	}
+
+	summary := group.Summary()
+	fmt.Printf("Group Command Details: %s\n", group.ID)
+	fmt.Println(strings.Repeat("=", 30))
+	fmt.Printf("Target:       %s\n", group.Target.String())
+	if group.Topic != "" {
+		fmt.Printf("Topic:        %s\n", group.Topic)
+	}
+	fmt.Printf("Operation:    %s\n", group.Operation)
+	fmt.Printf("Status:       %s\n", group.Status)
+	fmt.Printf("Timeout:      %d ms\n", group.TimeoutMS)
+	fmt.Printf("Created At:   %s\n", group.CreatedAt.Format("2006-01-02 15:04:05"))
+	if group.CompletedAt != nil {
+		fmt.Printf("Completed At: %s\n", group.CompletedAt.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("Members:      %d (acked %d, completed %d, failed %d, timed out %d, pending %d)\n",
+		summary.Total, summary.Acked, summary.Completed, summary.Failed, summary.TimedOut, summary.Pending)
+
+	if len(group.Members) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%-40s %-10s %s\n", "DEVICE", "STATUS", "ERROR")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, member := range group.SortedMembers() {
+		fmt.Printf("%-40s %-10s %s\n", member.DeviceID, member.Status, member.Error)
+	}
+}
+
 func (cli *InteractiveCLI) handleEventCommand(args []string) {
 	if len(args) == 0 {
 		fmt.Println("Event subcommands: list, show, stats, watch")
@@ -949,11 +1368,13 @@ func (cli *InteractiveCLI) testStorage() {
 
 func (cli *InteractiveCLI) handleSystemCommand(args []string) {
 	if len(args) == 0 {
-		fmt.Println("System subcommands: info, health, stats")
+		fmt.Println("System subcommands: info, health, stats, storage")
 		return
 	}
 
 	switch args[0] {
+	case "storage":
+		cli.handleStorageCommand(args[1:])
 	case "info":
 		cli.showSystemInfo()
 	case "health":
@@ -971,7 +1392,7 @@ func (cli *InteractiveCLI) showSystemInfo() {
 	fmt.Printf("Version:       1.0.0\n")
 	fmt.Printf("Build Date:    %s\n", time.Now().Format("2006-01-02"))
 	fmt.Printf("Configuration: %s\n", "controller.yaml")
-	fmt.Printf("Storage Path:  %s\n", cli.config.Storage.Path)
+	fmt.Printf("Storage:       %s (%s)\n", cli.config.Storage.Path, cli.config.Storage.Backend)
 }
 
 func (cli *InteractiveCLI) showSystemHealth() {
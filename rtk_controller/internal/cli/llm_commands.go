@@ -149,6 +149,15 @@ func (cli *InteractiveCLI) executeLLMTool(toolName string, paramArgs []string) {
 		}
 	}
 
+	// Scope site-aware tools to the current site unless given
+	tenant, site := cli.currentScope()
+	if _, exists := params["tenant"]; !exists {
+		params["tenant"] = tenant
+	}
+	if _, exists := params["site"]; !exists {
+		params["site"] = site
+	}
+
 	fmt.Printf("Executing tool: %s\n", toolName)
 	if len(params) > 0 {
 		fmt.Printf("Parameters: %v\n", params)
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"rtk_controller/internal/schema"
+)
+
+// handleSchemaCommand handles schema version and compatibility commands
+func (cli *InteractiveCLI) handleSchemaCommand(args []string) {
+	if cli.schemaManager == nil {
+		fmt.Println("Schema manager not available")
+		return
+	}
+
+	if len(args) == 0 {
+		fmt.Println("Schema subcommands: status, reload, versions, deprecate, undeprecate, compat")
+		return
+	}
+
+	switch args[0] {
+	case "status":
+		cli.showSchemaStatus()
+	case "reload":
+		if err := cli.schemaManager.ReloadSchemas(); err != nil {
+			fmt.Printf("Reload failed, previous schemas kept: %v\n", err)
+			return
+		}
+		fmt.Printf("Schemas reloaded (%d loaded)\n", len(cli.schemaManager.GetLoadedSchemas()))
+	case "versions":
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		cli.listSchemaVersions(name)
+	case "deprecate", "undeprecate":
+		if len(args) < 3 {
+			fmt.Printf("Usage: schema %s <name> <version>\n", args[0])
+			return
+		}
+		deprecated := args[0] == "deprecate"
+		if err := cli.schemaManager.SetSchemaVersionDeprecated(args[1], args[2], deprecated); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if deprecated {
+			fmt.Printf("Schema %s/%s marked deprecated\n", args[1], args[2])
+		} else {
+			fmt.Printf("Schema %s/%s marked current\n", args[1], args[2])
+		}
+	case "compat":
+		all := len(args) > 1 && args[1] == "--all"
+		cli.showSchemaCompatibility(all)
+	default:
+		fmt.Printf("Unknown schema subcommand: %s\n", args[0])
+	}
+}
+
+func (cli *InteractiveCLI) showSchemaStatus() {
+	status := cli.schemaManager.GetReloadStatus()
+
+	fmt.Println("Schema Status")
+	fmt.Println("=============")
+	fmt.Printf("Loaded Schemas: %d\n", len(cli.schemaManager.GetLoadedSchemas()))
+	fmt.Printf("Versions:       %d\n", len(cli.schemaManager.GetSchemaVersions("")))
+	if len(status.Watching) > 0 {
+		fmt.Printf("Watching:       %s\n", strings.Join(status.Watching, ", "))
+	} else {
+		fmt.Println("Watching:       (hot reload off)")
+	}
+	fmt.Printf("Reloads:        %d (%d failed)\n", status.Reloads, status.FailedReloads)
+	if !status.LastReload.IsZero() {
+		fmt.Printf("Last Reload:    %s\n", status.LastReload.Format("2006-01-02 15:04:05"))
+	}
+
+	if alert := status.ActiveAlert; alert != nil {
+		fmt.Printf("\nALERT (%s): %s\n", alert.RaisedAt.Format("2006-01-02 15:04:05"), alert.Message)
+		for _, e := range alert.Errors {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+}
+
+func (cli *InteractiveCLI) listSchemaVersions(name string) {
+	versions := cli.schemaManager.GetSchemaVersions(name)
+	if len(versions) == 0 {
+		fmt.Println("No versioned schemas registered")
+		return
+	}
+
+	fmt.Printf("%-30s %-12s %s\n", "SCHEMA", "VERSION", "STATUS")
+	fmt.Println(strings.Repeat("-", 55))
+	for _, v := range versions {
+		status := "current"
+		if v.Deprecated {
+			status = "deprecated"
+		}
+		fmt.Printf("%-30s %-12s %s\n", v.Name, v.Version, status)
+	}
+}
+
+func (cli *InteractiveCLI) showSchemaCompatibility(all bool) {
+	if cli.deviceManager == nil {
+		fmt.Println("Device manager not available")
+		return
+	}
+
+	devices, _, err := cli.deviceManager.ListDevices(nil, 0, 0)
+	if err != nil {
+		fmt.Printf("Error listing devices: %v\n", err)
+		return
+	}
+
+	report := cli.schemaManager.CompatibilityReport(devices)
+
+	fmt.Println("Schema Compatibility Report")
+	fmt.Println("===========================")
+	fmt.Printf("Devices:      %d\n", report.Devices)
+	fmt.Printf("Current:      %d\n", report.Counts[schema.SchemaCompatCurrent])
+	fmt.Printf("Deprecated:   %d\n", report.Counts[schema.SchemaCompatDeprecated])
+	fmt.Printf("Unregistered: %d\n", report.Counts[schema.SchemaCompatUnregistered])
+
+	var entries []schema.DeviceSchemaCompat
+	for _, entry := range report.Entries {
+		if all || entry.Status != schema.SchemaCompatCurrent {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Printf("%-40s %-25s %-10s %-14s %s\n", "DEVICE", "SCHEMA", "VERSION", "STATUS", "LATEST")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, entry := range entries {
+		fmt.Printf("%-40s %-25s %-10s %-14s %s\n", entry.DeviceKey, entry.Schema, entry.Version, entry.Status, entry.Latest)
+	}
+}
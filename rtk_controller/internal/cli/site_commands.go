@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"rtk_controller/internal/tenancy"
+)
+
+// SetSiteRegistry sets the tenant/site registry and scopes the CLI to its
+// default site
+func (cli *InteractiveCLI) SetSiteRegistry(registry *tenancy.Registry) {
+	cli.siteRegistry = registry
+	if registry != nil {
+		cli.tenant, cli.site = registry.DefaultScope()
+	}
+}
+
+// currentScope returns the tenant and site commands apply to
+func (cli *InteractiveCLI) currentScope() (tenant, site string) {
+	tenant, site = cli.tenant, cli.site
+	if tenant == "" {
+		tenant = "default"
+	}
+	if site == "" {
+		site = "default"
+	}
+	return tenant, site
+}
+
+// scopeArgs removes a --site=<tenant>/<site> flag from args and returns the
+// scope it names, or the current scope when it is absent
+func (cli *InteractiveCLI) scopeArgs(args []string) (tenant, site string, rest []string, err error) {
+	tenant, site = cli.currentScope()
+	for _, arg := range args {
+		value, isScope := strings.CutPrefix(arg, "--site=")
+		if !isScope {
+			rest = append(rest, arg)
+			continue
+		}
+
+		t, s, err := tenancy.ParseScope(value)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if t != "" {
+			tenant = t
+		}
+		site = s
+	}
+	return tenant, site, rest, nil
+}
+
+// scopedTopologyCommands returns the topology commands bound to the topology
+// manager of a site
+func (cli *InteractiveCLI) scopedTopologyCommands(tenant, site string) (*TopologyCommands, error) {
+	if cli.siteRegistry == nil {
+		return cli.topologyCommands, nil
+	}
+
+	manager, err := cli.siteRegistry.TopologyManager(tenant, site)
+	if err != nil {
+		return nil, err
+	}
+	commands := *cli.topologyCommands
+	commands.topologyManager = manager
+	return &commands, nil
+}
+
+// handleSiteCommand handles tenant/site scoping commands
+func (cli *InteractiveCLI) handleSiteCommand(args []string) {
+	if len(args) == 0 {
+		cli.showSiteScope()
+		return
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		tenant := ""
+		if len(args) > 1 {
+			tenant = args[1]
+		}
+		cli.listSites(tenant)
+	case "use":
+		if len(args) < 2 {
+			fmt.Println("Usage: site use <tenant>/<site>")
+			return
+		}
+		tenant, site, err := tenancy.ParseScope(args[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if tenant == "" {
+			tenant, _ = cli.currentScope()
+		}
+		cli.tenant, cli.site = tenant, site
+		if cli.deviceManager != nil && !cli.deviceManager.HasSite(tenant, site) {
+			fmt.Printf("Note: %s/%s is not a known site yet; topology commands need devices reporting from it or \"site register\"\n", tenant, site)
+		}
+		fmt.Printf("Scope set to %s/%s\n", tenant, site)
+	case "show":
+		cli.showSiteScope()
+	case "register":
+		if len(args) < 2 {
+			fmt.Println("Usage: site register <tenant>/<site> [display name]")
+			return
+		}
+		if cli.deviceManager == nil {
+			fmt.Println("Device manager not available")
+			return
+		}
+		tenant, site, err := tenancy.ParseScope(args[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if tenant == "" {
+			tenant, _ = cli.currentScope()
+		}
+		info, err := cli.deviceManager.RegisterSite(tenant, site, strings.Join(args[2:], " "))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Site %s/%s registered\n", info.Tenant, info.Site)
+	default:
+		fmt.Printf("Unknown site subcommand: %s\n", args[0])
+	}
+}
+
+func (cli *InteractiveCLI) showSiteScope() {
+	tenant, site := cli.currentScope()
+	fmt.Printf("Current scope: %s/%s\n", tenant, site)
+
+	if cli.deviceManager == nil {
+		return
+	}
+	info, err := cli.deviceManager.GetSite(tenant, site)
+	if err != nil {
+		return
+	}
+	if info.Name != "" {
+		fmt.Printf("Name:          %s\n", info.Name)
+	}
+	fmt.Printf("Devices:       %d (%d online)\n", info.Devices, info.OnlineDevices)
+}
+
+func (cli *InteractiveCLI) listSites(tenant string) {
+	var statuses []tenancy.SiteStatus
+	switch {
+	case cli.siteRegistry != nil:
+		statuses = cli.siteRegistry.ListSites(tenant)
+	case cli.deviceManager != nil:
+		for _, info := range cli.deviceManager.ListSites(tenant) {
+			statuses = append(statuses, tenancy.SiteStatus{SiteInfo: *info})
+		}
+	default:
+		fmt.Println("Site registry not available")
+		return
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No sites found")
+		return
+	}
+
+	currentTenant, currentSite := cli.currentScope()
+	fmt.Printf("  %-20s %-20s %-20s %-10s %s\n", "TENANT", "SITE", "NAME", "DEVICES", "MANAGERS")
+	fmt.Println(strings.Repeat("-", 85))
+	for _, status := range statuses {
+		marker := " "
+		if status.Tenant == currentTenant && status.Site == currentSite {
+			marker = "*"
+		}
+		managers := "-"
+		if status.Active {
+			managers = "active"
+		}
+		devices := fmt.Sprintf("%d/%d", status.OnlineDevices, status.Devices)
+		fmt.Printf("%s %-20s %-20s %-20s %-10s %s\n", marker, status.Tenant, status.Site, status.Name, devices, managers)
+	}
+}
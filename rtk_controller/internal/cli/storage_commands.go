@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/utils"
+)
+
+// SetBackupManager sets the storage backup manager
+func (cli *InteractiveCLI) SetBackupManager(manager *storage.BackupManager) {
+	cli.backupManager = manager
+}
+
+// handleStorageCommand handles "system storage" subcommands
+func (cli *InteractiveCLI) handleStorageCommand(args []string) {
+	if cli.backupManager == nil {
+		fmt.Println("Storage backups not available")
+		return
+	}
+
+	if len(args) == 0 {
+		cli.showStorageStatus()
+		return
+	}
+
+	switch args[0] {
+	case "status":
+		cli.showStorageStatus()
+	case "backup":
+		info, err := cli.backupManager.Backup()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Snapshot %s written (%s)\n", info.Name, utils.FormatBytes(uint64(info.Size)))
+	case "list", "ls":
+		cli.listSnapshots()
+	case "validate":
+		if len(args) < 2 {
+			fmt.Println("Usage: system storage validate <snapshot>")
+			return
+		}
+		keys, err := cli.backupManager.ValidateSnapshot(args[1])
+		if err != nil {
+			fmt.Printf("Snapshot %s is not valid: %v\n", args[1], err)
+			return
+		}
+		fmt.Printf("Snapshot %s is valid (%d keys)\n", args[1], keys)
+	case "restore":
+		if len(args) < 2 {
+			fmt.Println("Usage: system storage restore <snapshot>")
+			return
+		}
+		keys, previous, err := cli.backupManager.Restore(args[1])
+		if previous != nil {
+			fmt.Printf("Previous contents saved as %s\n", previous.Name)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Restored %d keys from %s\n", keys, args[1])
+		fmt.Println("Exiting: the managers of this session still hold the old state; restart the controller to load the restored storage")
+		cli.Stop()
+	case "compact":
+		saved, err := cli.backupManager.Compact()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Storage compacted, %s reclaimed\n", utils.FormatBytes(uint64(saved)))
+	default:
+		fmt.Printf("Unknown storage subcommand: %s\n", args[0])
+	}
+}
+
+func (cli *InteractiveCLI) showStorageStatus() {
+	config := cli.backupManager.Config()
+	stats := cli.backupManager.GetStats()
+
+	fmt.Println("Storage")
+	fmt.Println("=======")
+	if size, err := cli.backupManager.Size(); err == nil {
+		fmt.Printf("Database size:    %s\n", utils.FormatBytes(uint64(size)))
+	}
+	fmt.Printf("Backup dir:       %s\n", config.Dir)
+	fmt.Printf("Backup count:     %d\n", config.Count)
+	fmt.Printf("Backup interval:  %s\n", formatInterval(config.Interval))
+	fmt.Printf("Compact interval: %s\n", formatInterval(config.CompactInterval))
+
+	if !stats.LastBackup.IsZero() {
+		fmt.Printf("Last backup:      %s (%s)\n", stats.LastBackupName, stats.LastBackup.Local().Format(time.RFC3339))
+	}
+	if stats.LastBackupError != "" {
+		fmt.Printf("Last error:       %s\n", stats.LastBackupError)
+	}
+	if !stats.LastCompaction.IsZero() {
+		fmt.Printf("Last compaction:  %s (%s reclaimed)\n", stats.LastCompaction.Format(time.RFC3339), utils.FormatBytes(uint64(stats.LastCompactSave)))
+	}
+	if !stats.LastRestore.IsZero() {
+		fmt.Printf("Last restore:     %s (%s)\n", stats.LastRestoreName, stats.LastRestore.Format(time.RFC3339))
+	}
+}
+
+func (cli *InteractiveCLI) listSnapshots() {
+	snapshots, err := cli.backupManager.ListSnapshots()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots found")
+		return
+	}
+
+	fmt.Printf("%-40s %-25s %s\n", "SNAPSHOT", "CREATED", "SIZE")
+	fmt.Println(strings.Repeat("-", 75))
+	for _, snapshot := range snapshots {
+		fmt.Printf("%-40s %-25s %s\n", snapshot.Name, snapshot.CreatedAt.Local().Format(time.RFC3339), utils.FormatBytes(uint64(snapshot.Size)))
+	}
+}
+
+func formatInterval(interval time.Duration) string {
+	if interval <= 0 {
+		return "disabled"
+	}
+	return interval.String()
+}
@@ -11,37 +11,49 @@ func (cli *InteractiveCLI) handleTopologyCommand(args []string) {
 		return
 	}
 
+	tenant, site, args, err := cli.scopeArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
 	if len(args) == 0 {
-		fmt.Println("Usage: topology <subcommand> [args...]")
+		fmt.Println("Usage: topology <subcommand> [args...] [--site=<tenant>/<site>]")
 		fmt.Println("Run 'help topology' for available subcommands")
 		return
 	}
 
+	// Use the topology manager of the scoped site
+	commands, err := cli.scopedTopologyCommands(tenant, site)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
 	subCommand := args[0]
 	subArgs := args[1:]
 
 	var result string
-	var err error
 
 	switch subCommand {
 	case "show":
-		result, err = cli.topologyCommands.ShowTopology(subArgs)
+		result, err = commands.ShowTopology(subArgs)
 	case "discover":
-		result, err = cli.topologyCommands.DiscoverTopology(subArgs)
+		result, err = commands.DiscoverTopology(subArgs)
 	case "status":
-		result, err = cli.topologyCommands.TopologyStatus(subArgs)
+		result, err = commands.TopologyStatus(subArgs)
 	case "stats":
-		result, err = cli.topologyCommands.TopologyStats(subArgs)
+		result, err = commands.TopologyStats(subArgs)
 	case "devices":
-		result, err = cli.topologyCommands.ShowDevices(subArgs)
+		result, err = commands.ShowDevices(subArgs)
 	case "connections":
-		result, err = cli.topologyCommands.ShowConnections(subArgs)
+		result, err = commands.ShowConnections(subArgs)
 	case "export":
-		result, err = cli.topologyCommands.ExportTopology(subArgs)
+		result, err = commands.ExportTopology(subArgs)
 	case "graph":
 		// Return a simple graph representation
 		result = "graph TD\n"
-		if _, gErr := cli.topologyCommands.ShowTopology(subArgs); gErr == nil {
+		if _, gErr := commands.ShowTopology(subArgs); gErr == nil {
 			result += "  subgraph Network\n"
 			result += "    Router[Router]\n"
 			result += "    AP[Access Point]\n"
@@ -50,7 +62,11 @@ func (cli *InteractiveCLI) handleTopologyCommand(args []string) {
 		}
 		err = nil
 	case "alerts":
-		result, err = cli.topologyCommands.ListAlerts(subArgs)
+		if len(subArgs) > 0 && subArgs[0] == "rules" {
+			result, err = cli.alertRulesCommand(tenant, site, subArgs[1:])
+		} else {
+			result, err = commands.ListAlerts(subArgs)
+		}
 	default:
 		fmt.Printf("Unknown topology subcommand: %s\n", subCommand)
 		return
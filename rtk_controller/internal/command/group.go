@@ -0,0 +1,624 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/types"
+	"rtk_controller/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Wildcard addresses every site (or every tenant) in a GroupTarget
+const Wildcard = "*"
+
+// DeviceDirectory lists the devices known to the controller.
+// device.Manager implements it.
+type DeviceDirectory interface {
+	ListDevices(filter *types.DeviceFilter, limit int, offset int) ([]*types.DeviceState, int, error)
+}
+
+// GroupDirectory lists the device identities that group and tag targets are
+// resolved against. identity.Manager implements it.
+type GroupDirectory interface {
+	ListDeviceIdentities(filter *types.DeviceIdentityFilter, limit, offset int) ([]*types.DeviceIdentity, int, error)
+}
+
+// GroupTarget selects the devices addressed by a group command
+type GroupTarget struct {
+	Tenant string `json:"tenant"`
+	Site   string `json:"site"`
+	Group  string `json:"group,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+}
+
+// ParseGroupTarget parses the CLI form of a target:
+//
+//	group:<tenant>/<site>/<group_id>
+//	tag:<tenant>/<site>/<tag>
+//	site:<tenant>/<site>     (site may be "*")
+//	broadcast[:<tenant>]
+func ParseGroupTarget(s string) (GroupTarget, error) {
+	kind, rest, _ := strings.Cut(s, ":")
+	parts := strings.Split(rest, "/")
+
+	switch kind {
+	case "group", "tag":
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return GroupTarget{}, fmt.Errorf("expected %s:<tenant>/<site>/<name>", kind)
+		}
+		target := GroupTarget{Tenant: parts[0], Site: parts[1]}
+		if kind == "group" {
+			target.Group = parts[2]
+		} else {
+			target.Tag = parts[2]
+		}
+		return target, target.Validate()
+	case "site":
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return GroupTarget{}, fmt.Errorf("expected site:<tenant>/<site>")
+		}
+		target := GroupTarget{Tenant: parts[0], Site: parts[1]}
+		return target, target.Validate()
+	case "broadcast":
+		if rest == "" {
+			return GroupTarget{Tenant: Wildcard, Site: Wildcard}, nil
+		}
+		return GroupTarget{Tenant: rest, Site: Wildcard}, nil
+	default:
+		return GroupTarget{}, fmt.Errorf("unknown target type %q (use group, tag, site or broadcast)", kind)
+	}
+}
+
+// Validate checks that the target can be resolved
+func (t GroupTarget) Validate() error {
+	if t.Tenant == "" || t.Site == "" {
+		return fmt.Errorf("tenant and site are required")
+	}
+	if t.Group != "" && t.Tag != "" {
+		return fmt.Errorf("group and tag are mutually exclusive")
+	}
+	if (t.Group != "" || t.Tag != "") && (t.Tenant == Wildcard || t.Site == Wildcard) {
+		return fmt.Errorf("group and tag targets need a concrete tenant and site")
+	}
+	if t.Tenant == Wildcard && t.Site != Wildcard {
+		return fmt.Errorf("a wildcard tenant requires a wildcard site")
+	}
+	return nil
+}
+
+// Topic returns the SPEC fan-out topic for the target. Tags and single
+// sites have no shared topic; those members are addressed individually.
+func (t GroupTarget) Topic() string {
+	switch {
+	case t.Group != "":
+		return fmt.Sprintf("rtk/v1/%s/%s/group/%s/cmd/req", t.Tenant, t.Site, t.Group)
+	case t.Tenant == Wildcard:
+		return "rtk/v1/broadcast/cmd/req"
+	case t.Site == Wildcard:
+		return fmt.Sprintf("rtk/v1/%s/broadcast/cmd/req", t.Tenant)
+	default:
+		return ""
+	}
+}
+
+// String returns the CLI form of the target
+func (t GroupTarget) String() string {
+	switch {
+	case t.Group != "":
+		return fmt.Sprintf("group:%s/%s/%s", t.Tenant, t.Site, t.Group)
+	case t.Tag != "":
+		return fmt.Sprintf("tag:%s/%s/%s", t.Tenant, t.Site, t.Tag)
+	case t.Tenant == Wildcard:
+		return "broadcast"
+	case t.Site == Wildcard:
+		return "broadcast:" + t.Tenant
+	default:
+		return fmt.Sprintf("site:%s/%s", t.Tenant, t.Site)
+	}
+}
+
+// memberOf reports whether identity belongs to a group or tag target. A
+// group is an identity location or tag, as in alert rule selectors.
+func (t GroupTarget) memberOf(identity *types.DeviceIdentity) bool {
+	if t.Group != "" && strings.EqualFold(identity.Location, t.Group) {
+		return true
+	}
+	name := t.Group
+	if t.Tag != "" {
+		name = t.Tag
+	}
+	for _, tag := range identity.Tags {
+		if strings.EqualFold(tag, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupMember tracks the response of one device to a group command
+type GroupMember struct {
+	DeviceID    string                 `json:"device_id"` // tenant:site:device_id
+	Status      string                 `json:"status"`    // sent, ack, completed, failed, timeout
+	Error       string                 `json:"error,omitempty"`
+	Result      map[string]interface{} `json:"result,omitempty"`
+	AckedAt     *time.Time             `json:"acked_at,omitempty"`
+	CompletedAt *time.Time             `json:"completed_at,omitempty"`
+}
+
+// GroupCommand is one command request fanned out to several devices
+type GroupCommand struct {
+	ID          string                  `json:"id"`
+	Target      GroupTarget             `json:"target"`
+	Topic       string                  `json:"topic,omitempty"`
+	Operation   string                  `json:"operation"`
+	Args        map[string]interface{}  `json:"args"`
+	TimeoutMS   int64                   `json:"timeout_ms"`
+	Status      string                  `json:"status"` // sent, completed, partial, failed, timeout
+	Members     map[string]*GroupMember `json:"members"`
+	CreatedAt   time.Time               `json:"created_at"`
+	SentAt      *time.Time              `json:"sent_at,omitempty"`
+	CompletedAt *time.Time              `json:"completed_at,omitempty"`
+}
+
+// GroupSummary aggregates member states of a group command
+type GroupSummary struct {
+	Total     int `json:"total"`
+	Acked     int `json:"acked"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	TimedOut  int `json:"timed_out"`
+	Pending   int `json:"pending"`
+}
+
+// Summary counts members by state. Acked includes members that have since
+// completed or failed.
+func (g *GroupCommand) Summary() GroupSummary {
+	s := GroupSummary{Total: len(g.Members)}
+	for _, member := range g.Members {
+		if member.AckedAt != nil {
+			s.Acked++
+		}
+		switch member.Status {
+		case "completed":
+			s.Completed++
+		case "failed":
+			s.Failed++
+		case "timeout":
+			s.TimedOut++
+		default:
+			s.Pending++
+		}
+	}
+	return s
+}
+
+// SortedMembers returns the members ordered by device ID
+func (g *GroupCommand) SortedMembers() []*GroupMember {
+	members := make([]*GroupMember, 0, len(g.Members))
+	for _, member := range g.Members {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].DeviceID < members[j].DeviceID })
+	return members
+}
+
+func (g *GroupCommand) copy() *GroupCommand {
+	c := *g
+	c.Members = make(map[string]*GroupMember, len(g.Members))
+	for key, member := range g.Members {
+		m := *member
+		c.Members[key] = &m
+	}
+	return &c
+}
+
+// finish sets the overall status once no member is pending
+func (g *GroupCommand) finish(now time.Time) bool {
+	summary := g.Summary()
+	if summary.Pending > 0 {
+		return false
+	}
+
+	switch {
+	case summary.Completed == 0 && summary.Failed == 0:
+		g.Status = "timeout"
+	case summary.Completed == summary.Total:
+		g.Status = "completed"
+	case summary.Completed == 0:
+		g.Status = "failed"
+	default:
+		g.Status = "partial"
+	}
+	g.CompletedAt = &now
+	return true
+}
+
+// SetDeviceDirectory sets the device registry used for site and broadcast
+// targets and to limit group and tag targets to their site
+func (m *Manager) SetDeviceDirectory(directory DeviceDirectory) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.devices = directory
+}
+
+// SetGroupDirectory sets the group and tag directory used for group and tag targets
+func (m *Manager) SetGroupDirectory(directory GroupDirectory) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.groups = directory
+}
+
+// SendGroupCommand sends one command to every device selected by target and
+// tracks the ack/result of each member.
+func (m *Manager) SendGroupCommand(target GroupTarget, operation string, args map[string]interface{}, timeoutSeconds int) (*GroupCommand, error) {
+	if err := target.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid target: %w", err)
+	}
+
+	members, err := m.resolveMembers(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve members: %w", err)
+	}
+	if len(members) == 0 && target.Topic() == "" {
+		return nil, fmt.Errorf("no devices match %s", target)
+	}
+
+	group := &GroupCommand{
+		ID:        utils.GenerateMessageID(),
+		Target:    target,
+		Topic:     target.Topic(),
+		Operation: operation,
+		Args:      args,
+		TimeoutMS: int64(timeoutSeconds * 1000),
+		Status:    "sent",
+		Members:   make(map[string]*GroupMember, len(members)),
+		CreatedAt: time.Now(),
+	}
+	for _, member := range members {
+		group.Members[member] = &GroupMember{DeviceID: member, Status: "sent"}
+	}
+
+	payload := buildCommandPayload(group.ID, operation, args, group.TimeoutMS)
+
+	if group.Topic != "" {
+		if err := m.mqttClient.Publish(group.Topic, 1, false, payload); err != nil {
+			return nil, fmt.Errorf("failed to publish group command: %w", err)
+		}
+	} else {
+		// No shared topic: address every member on its own cmd/req topic
+		// with the same command ID.
+		for _, member := range members {
+			tenant, site, deviceID := splitDeviceKey(member)
+			topic := utils.BuildTopic(tenant, site, deviceID, "cmd", "req")
+			if err := m.mqttClient.Publish(topic, 1, false, payload); err != nil {
+				group.Members[member].Status = "failed"
+				group.Members[member].Error = fmt.Sprintf("Failed to publish command: %v", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	group.SentAt = &now
+
+	m.mu.Lock()
+	if len(group.Members) == 0 || !group.finish(now) {
+		m.groupCommands[group.ID] = group
+	}
+	err = m.storeGroupCommand(group)
+	m.mu.Unlock()
+	if err != nil {
+		log.WithError(err).Error("Failed to store group command")
+	}
+
+	log.WithFields(log.Fields{
+		"command_id": group.ID,
+		"target":     target.String(),
+		"members":    len(group.Members),
+		"operation":  operation,
+		"topic":      group.Topic,
+	}).Info("Group command sent")
+
+	return group.copy(), nil
+}
+
+// GetGroupCommand returns a group command by ID
+func (m *Manager) GetGroupCommand(commandID string) (*GroupCommand, error) {
+	m.mu.RLock()
+	if group, exists := m.groupCommands[commandID]; exists {
+		defer m.mu.RUnlock()
+		return group.copy(), nil
+	}
+	m.mu.RUnlock()
+
+	var group GroupCommand
+	err := m.storage.View(func(tx storage.Transaction) error {
+		value, err := tx.Get(fmt.Sprintf("group_command:%s", commandID))
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(value), &group)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("group command not found: %s", commandID)
+	}
+
+	return &group, nil
+}
+
+// ListGroupCommands returns stored group commands, newest first
+func (m *Manager) ListGroupCommands(limit int) ([]*GroupCommand, error) {
+	var groups []*GroupCommand
+
+	err := m.storage.View(func(tx storage.Transaction) error {
+		return tx.IteratePrefix("group_command:", func(key, value string) error {
+			var group GroupCommand
+			if err := json.Unmarshal([]byte(value), &group); err != nil {
+				log.WithError(err).Warn("Failed to unmarshal group command")
+				return nil // Continue iteration
+			}
+			groups = append(groups, &group)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].CreatedAt.After(groups[j].CreatedAt) })
+	if limit > 0 && len(groups) > limit {
+		groups = groups[:limit]
+	}
+	return groups, nil
+}
+
+// resolveMembers returns the tenant:site:device_id keys addressed by target
+func (m *Manager) resolveMembers(target GroupTarget) ([]string, error) {
+	m.mu.RLock()
+	devices, groups := m.devices, m.groups
+	m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var members []string
+	add := func(tenant, site, deviceID string) {
+		key := fmt.Sprintf("%s:%s:%s", tenant, site, deviceID)
+		if !seen[key] {
+			seen[key] = true
+			members = append(members, key)
+		}
+	}
+
+	switch {
+	case target.Group != "" || target.Tag != "":
+		if groups == nil {
+			return nil, fmt.Errorf("no group directory configured")
+		}
+		if devices == nil {
+			return nil, fmt.Errorf("no device directory configured")
+		}
+
+		// Identities carry no tenant or site, so only devices registered
+		// in the target site are members
+		states, _, err := devices.ListDevices(&types.DeviceFilter{Tenant: target.Tenant, Site: target.Site}, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		inSite := make(map[string]bool, len(states))
+		for _, state := range states {
+			inSite[state.ID] = true
+		}
+
+		identities, _, err := groups.ListDeviceIdentities(nil, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, identity := range identities {
+			deviceID := deviceIDFromMAC(identity.MacAddress)
+			if inSite[deviceID] && target.memberOf(identity) {
+				add(target.Tenant, target.Site, deviceID)
+			}
+		}
+
+	default:
+		if devices == nil {
+			return nil, fmt.Errorf("no device directory configured")
+		}
+
+		filter := &types.DeviceFilter{}
+		if target.Tenant != Wildcard {
+			filter.Tenant = target.Tenant
+		}
+		if target.Site != Wildcard {
+			filter.Site = target.Site
+		}
+		states, _, err := devices.ListDevices(filter, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, state := range states {
+			add(state.Tenant, state.Site, state.ID)
+		}
+	}
+
+	sort.Strings(members)
+	return members, nil
+}
+
+// handleGroupAck records an ACK for a group command. It reports false when
+// commandID is not an active group command.
+func (m *Manager) handleGroupAck(commandID, topic string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	group, exists := m.groupCommands[commandID]
+	if !exists {
+		return false
+	}
+
+	member := group.member(topic)
+	if member == nil {
+		return true
+	}
+	now := time.Now()
+	if member.AckedAt == nil {
+		member.AckedAt = &now
+	}
+	if member.Status == "sent" {
+		member.Status = "ack"
+	}
+
+	if err := m.storeGroupCommand(group); err != nil {
+		log.WithError(err).Error("Failed to store group command ACK")
+	}
+	return true
+}
+
+// handleGroupResult records a result for a group command. It reports false
+// when commandID is not an active group command.
+func (m *Manager) handleGroupResult(commandID, topic string, resultData map[string]interface{}) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	group, exists := m.groupCommands[commandID]
+	if !exists {
+		return false
+	}
+
+	member := group.member(topic)
+	if member == nil {
+		return true
+	}
+	now := time.Now()
+	member.Status = "completed"
+	member.CompletedAt = &now
+	member.Result = resultData
+	if errorMsg, ok := resultData["error"].(string); ok && errorMsg != "" {
+		member.Status = "failed"
+		member.Error = errorMsg
+	}
+
+	if group.finish(now) {
+		delete(m.groupCommands, commandID)
+		log.WithFields(log.Fields{
+			"command_id": commandID,
+			"status":     group.Status,
+		}).Info("Group command completed")
+	}
+
+	if err := m.storeGroupCommand(group); err != nil {
+		log.WithError(err).Error("Failed to store group command result")
+	}
+	return true
+}
+
+// member returns the member addressed by a response topic. Commands sent on
+// a group or broadcast topic also reach devices the controller does not know
+// as members yet; those are added on their first response.
+func (g *GroupCommand) member(topic string) *GroupMember {
+	tenant, site, deviceID, _, _ := utils.ExtractTopicParts(topic)
+	if deviceID == "" {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s:%s:%s", tenant, site, deviceID)
+	if member, exists := g.Members[key]; exists {
+		return member
+	}
+	if g.Topic == "" {
+		return nil
+	}
+	if g.Target.Tenant != Wildcard && g.Target.Tenant != tenant {
+		return nil
+	}
+	if g.Target.Site != Wildcard && g.Target.Site != site {
+		return nil
+	}
+
+	member := &GroupMember{DeviceID: key, Status: "sent"}
+	g.Members[key] = member
+	return member
+}
+
+// checkGroupTimeouts marks members that did not finish in time
+func (m *Manager) checkGroupTimeouts(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for commandID, group := range m.groupCommands {
+		timeoutDuration := time.Duration(group.TimeoutMS) * time.Millisecond
+		if group.SentAt == nil || now.Sub(*group.SentAt) <= timeoutDuration {
+			continue
+		}
+
+		for _, member := range group.Members {
+			if member.Status == "sent" || member.Status == "ack" {
+				member.Status = "timeout"
+				member.Error = "Command execution timeout"
+			}
+		}
+		group.finish(now)
+		delete(m.groupCommands, commandID)
+
+		if err := m.storeGroupCommand(group); err != nil {
+			log.WithError(err).Error("Failed to store timeout group command")
+		}
+
+		summary := group.Summary()
+		log.WithFields(log.Fields{
+			"command_id": commandID,
+			"completed":  summary.Completed,
+			"timed_out":  summary.TimedOut,
+		}).Warn("Group command timed out")
+	}
+}
+
+// storeGroupCommand stores a group command in database
+func (m *Manager) storeGroupCommand(group *GroupCommand) error {
+	return m.storage.Transaction(func(tx storage.Transaction) error {
+		data, err := json.Marshal(group)
+		if err != nil {
+			return fmt.Errorf("failed to marshal group command: %w", err)
+		}
+		return tx.Set(fmt.Sprintf("group_command:%s", group.ID), string(data))
+	})
+}
+
+// loadGroupCommands loads unfinished group commands from storage
+func (m *Manager) loadGroupCommands() error {
+	return m.storage.View(func(tx storage.Transaction) error {
+		return tx.IteratePrefix("group_command:", func(key, value string) error {
+			var group GroupCommand
+			if err := json.Unmarshal([]byte(value), &group); err != nil {
+				log.WithError(err).Warn("Failed to unmarshal group command")
+				return nil // Continue iteration
+			}
+			if group.Status == "sent" {
+				m.groupCommands[group.ID] = &group
+			}
+			return nil
+		})
+	})
+}
+
+// splitDeviceKey splits a tenant:site:device_id key
+func splitDeviceKey(key string) (tenant, site, deviceID string) {
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) != 3 {
+		return "", "", key
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// deviceIDFromMAC converts aa:bb:cc:dd:ee:ff to the topic form aabbccddeeff
+func deviceIDFromMAC(mac string) string {
+	if hw, err := net.ParseMAC(mac); err == nil {
+		return strings.ReplaceAll(hw.String(), ":", "")
+	}
+	return strings.ToLower(mac)
+}
@@ -0,0 +1,243 @@
+package command
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rtk_controller/internal/identity"
+	"rtk_controller/internal/mqtt"
+	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/types"
+)
+
+// recordingMQTT records published messages
+type recordingMQTT struct {
+	mu        sync.Mutex
+	published []publishedMessage
+	err       error // returned by Publish when set
+	onPublish func(op string)
+}
+
+type publishedMessage struct {
+	topic   string
+	payload map[string]interface{}
+}
+
+func (r *recordingMQTT) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	r.mu.Lock()
+	if r.err != nil {
+		defer r.mu.Unlock()
+		return r.err
+	}
+	request := payload.(map[string]interface{})
+	r.published = append(r.published, publishedMessage{topic: topic, payload: request})
+	onPublish := r.onPublish
+	r.mu.Unlock()
+
+	if onPublish != nil {
+		op, _ := request["op"].(string)
+		onPublish(op)
+	}
+	return nil
+}
+
+func (r *recordingMQTT) RegisterHandler(pattern string, handler mqtt.MessageHandler) {}
+
+func (r *recordingMQTT) topics() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	topics := make([]string, 0, len(r.published))
+	for _, msg := range r.published {
+		topics = append(topics, msg.topic)
+	}
+	return topics
+}
+
+type staticDevices []*types.DeviceState
+
+func (d staticDevices) ListDevices(filter *types.DeviceFilter, limit int, offset int) ([]*types.DeviceState, int, error) {
+	var result []*types.DeviceState
+	for _, device := range d {
+		if filter.Tenant != "" && device.Tenant != filter.Tenant {
+			continue
+		}
+		if filter.Site != "" && device.Site != filter.Site {
+			continue
+		}
+		result = append(result, device)
+	}
+	return result, len(result), nil
+}
+
+func newGroupTestManager(t *testing.T) (*Manager, *recordingMQTT) {
+	t.Helper()
+
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	client := &recordingMQTT{}
+	manager := NewManager(client, store)
+	manager.SetDeviceDirectory(staticDevices{
+		{ID: "aabbccddee01", Tenant: "office", Site: "floor1"},
+		{ID: "aabbccddee02", Tenant: "office", Site: "floor1"},
+		{ID: "aabbccddee03", Tenant: "office", Site: "floor2"},
+		{ID: "aabbccddee04", Tenant: "lab", Site: "bench"},
+	})
+
+	// Groups and tags resolve through the identity manager used in production
+	identities := identity.NewManager(storage.NewIdentityStorage(store), identity.ManagerConfig{})
+	for _, id := range []*types.DeviceIdentity{
+		{MacAddress: "AA:BB:CC:DD:EE:01", Location: "Lights", Tags: []string{"shared"}},
+		{MacAddress: "aa:bb:cc:dd:ee:02", Tags: []string{"lights"}},
+		{MacAddress: "aa:bb:cc:dd:ee:03", Tags: []string{"critical", "shared"}},
+		{MacAddress: "aa:bb:cc:dd:ee:05", Location: "kitchen", Tags: []string{"shared"}},
+	} {
+		require.NoError(t, identities.SetDeviceIdentity(id))
+	}
+	manager.SetGroupDirectory(identities)
+	return manager, client
+}
+
+func respond(t *testing.T, manager *Manager, device, kind string, payload map[string]interface{}) {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	topic := "rtk/v1/" + device + "/cmd/" + kind
+	if kind == "ack" {
+		require.NoError(t, manager.HandleCommandAck(topic, data))
+	} else {
+		require.NoError(t, manager.HandleCommandResult(topic, data))
+	}
+}
+
+func TestParseGroupTarget(t *testing.T) {
+	tests := []struct {
+		input string
+		want  GroupTarget
+		topic string
+	}{
+		{"group:office/floor1/lights", GroupTarget{Tenant: "office", Site: "floor1", Group: "lights"}, "rtk/v1/office/floor1/group/lights/cmd/req"},
+		{"tag:office/floor1/critical", GroupTarget{Tenant: "office", Site: "floor1", Tag: "critical"}, ""},
+		{"site:office/floor1", GroupTarget{Tenant: "office", Site: "floor1"}, ""},
+		{"site:office/*", GroupTarget{Tenant: "office", Site: "*"}, "rtk/v1/office/broadcast/cmd/req"},
+		{"broadcast:office", GroupTarget{Tenant: "office", Site: "*"}, "rtk/v1/office/broadcast/cmd/req"},
+		{"broadcast", GroupTarget{Tenant: "*", Site: "*"}, "rtk/v1/broadcast/cmd/req"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			target, err := ParseGroupTarget(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, target)
+			assert.Equal(t, tt.topic, target.Topic())
+		})
+	}
+
+	for _, input := range []string{"group:office/lights", "site:*/floor1", "device:office/floor1/x", "group:office/*/lights"} {
+		_, err := ParseGroupTarget(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestManager_SendGroupCommand_Group(t *testing.T) {
+	manager, client := newGroupTestManager(t)
+
+	target, _ := ParseGroupTarget("group:office/floor1/lights")
+	group, err := manager.SendGroupCommand(target, "light.set", map[string]interface{}{"on": true}, 30)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"rtk/v1/office/floor1/group/lights/cmd/req"}, client.topics())
+	assert.Equal(t, group.ID, client.published[0].payload["id"])
+	assert.Len(t, group.Members, 2)
+	assert.Equal(t, GroupSummary{Total: 2, Pending: 2}, group.Summary())
+
+	respond(t, manager, "office/floor1/aabbccddee01", "ack", map[string]interface{}{"id": group.ID})
+	respond(t, manager, "office/floor1/aabbccddee01", "res", map[string]interface{}{"id": group.ID, "ok": true})
+	respond(t, manager, "office/floor1/aabbccddee02", "ack", map[string]interface{}{"id": group.ID})
+
+	status, err := manager.GetGroupCommand(group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "sent", status.Status)
+	assert.Equal(t, GroupSummary{Total: 2, Acked: 2, Completed: 1, Pending: 1}, status.Summary())
+
+	respond(t, manager, "office/floor1/aabbccddee02", "res", map[string]interface{}{"id": group.ID, "error": "bulb missing"})
+
+	status, err = manager.GetGroupCommand(group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "partial", status.Status)
+	assert.NotNil(t, status.CompletedAt)
+	assert.Equal(t, GroupSummary{Total: 2, Acked: 2, Completed: 1, Failed: 1}, status.Summary())
+	assert.Equal(t, "bulb missing", status.Members["office:floor1:aabbccddee02"].Error)
+}
+
+func TestManager_SendGroupCommand_TagPublishesPerDevice(t *testing.T) {
+	manager, client := newGroupTestManager(t)
+
+	target, _ := ParseGroupTarget("tag:office/floor2/critical")
+	group, err := manager.SendGroupCommand(target, "device.reboot", nil, 30)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"rtk/v1/office/floor2/aabbccddee03/cmd/req"}, client.topics())
+	assert.Contains(t, group.Members, "office:floor2:aabbccddee03")
+}
+
+func TestManager_SendGroupCommand_TagStaysInSite(t *testing.T) {
+	manager, client := newGroupTestManager(t)
+
+	// aabbccddee01 is registered on floor1 and 05 is not registered at all
+	target, _ := ParseGroupTarget("tag:office/floor2/shared")
+	group, err := manager.SendGroupCommand(target, "device.reboot", nil, 30)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"rtk/v1/office/floor2/aabbccddee03/cmd/req"}, client.topics())
+	assert.Len(t, group.Members, 1)
+	assert.Contains(t, group.Members, "office:floor2:aabbccddee03")
+}
+
+func TestManager_SendGroupCommand_BroadcastTimeout(t *testing.T) {
+	manager, client := newGroupTestManager(t)
+
+	target, _ := ParseGroupTarget("site:office/*")
+	group, err := manager.SendGroupCommand(target, "fw.update", nil, 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"rtk/v1/office/broadcast/cmd/req"}, client.topics())
+	assert.Len(t, group.Members, 3)
+
+	// A device missing from the registry answers the broadcast
+	respond(t, manager, "office/floor3/aabbccddee09", "res", map[string]interface{}{"id": group.ID})
+	// Devices of other tenants are ignored
+	respond(t, manager, "lab/bench/aabbccddee04", "res", map[string]interface{}{"id": group.ID})
+
+	manager.checkTimeouts()
+	status, _ := manager.GetGroupCommand(group.ID)
+	assert.Equal(t, "sent", status.Status)
+
+	manager.checkGroupTimeouts(time.Now().Add(2 * time.Second))
+
+	status, err = manager.GetGroupCommand(group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "partial", status.Status)
+	assert.Equal(t, GroupSummary{Total: 4, Completed: 1, TimedOut: 3}, status.Summary())
+
+	groups, err := manager.ListGroupCommands(10)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, group.ID, groups[0].ID)
+}
+
+func TestManager_SendGroupCommand_NoMembers(t *testing.T) {
+	manager, client := newGroupTestManager(t)
+
+	target, _ := ParseGroupTarget("site:office/lobby")
+	_, err := manager.SendGroupCommand(target, "device.reboot", nil, 30)
+	assert.Error(t, err)
+	assert.Empty(t, client.topics())
+}
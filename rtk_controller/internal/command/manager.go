@@ -15,15 +15,37 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// MQTTClient is the subset of the MQTT client used by the manager
+type MQTTClient interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+	RegisterHandler(pattern string, handler mqtt.MessageHandler)
+}
+
 // Manager handles command processing and response tracking
 type Manager struct {
-	mqttClient *mqtt.Client
+	mqttClient MQTTClient
 	storage    storage.Storage
 
 	// Command tracking
 	pendingCommands map[string]*types.DeviceCommand
+	groupCommands   map[string]*GroupCommand
 	mu              sync.RWMutex
 
+	// Delivery policy and device presence
+	policies    map[string]OperationPolicy
+	holdOffline bool
+	holdTTL     time.Duration
+	offline     map[string]bool
+	wake        chan struct{}
+
+	// Update subscribers
+	subscriptions map[string]*subscription
+	subMu         sync.RWMutex
+
+	// Group member resolution
+	devices DeviceDirectory
+	groups  GroupDirectory
+
 	// Background workers
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -40,18 +62,24 @@ type CommandStats struct {
 	CompletedCommands int            `json:"completed_commands"`
 	FailedCommands    int            `json:"failed_commands"`
 	TimeoutCommands   int            `json:"timeout_commands"`
+	QueuedCommands    int            `json:"queued_commands"`
 	StatusStats       map[string]int `json:"status_stats"`
 	LastUpdated       time.Time      `json:"last_updated"`
 }
 
 // NewManager creates a new command manager
-func NewManager(mqttClient *mqtt.Client, storage storage.Storage) *Manager {
+func NewManager(mqttClient MQTTClient, storage storage.Storage) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Manager{
 		mqttClient:      mqttClient,
 		storage:         storage,
 		pendingCommands: make(map[string]*types.DeviceCommand),
+		groupCommands:   make(map[string]*GroupCommand),
+		policies:        make(map[string]OperationPolicy),
+		offline:         make(map[string]bool),
+		wake:            make(chan struct{}, 1),
+		subscriptions:   make(map[string]*subscription),
 		ctx:             ctx,
 		cancel:          cancel,
 		done:            make(chan struct{}),
@@ -66,15 +94,22 @@ func (m *Manager) Start(ctx context.Context) error {
 	// Register MQTT handlers for command responses
 	m.mqttClient.RegisterHandler("rtk/v1/+/+/+/cmd/ack", &CommandAckHandler{manager: m})
 	m.mqttClient.RegisterHandler("rtk/v1/+/+/+/cmd/res", &CommandResultHandler{manager: m})
+	m.mqttClient.RegisterHandler("rtk/v1/+/+/+/cmd/progress", &CommandProgressHandler{manager: m})
+	m.mqttClient.RegisterHandler("rtk/v1/+/+/+/lwt", &DeviceLWTHandler{manager: m})
+	m.mqttClient.RegisterHandler("rtk/v1/+/+/+/state", &DeviceStateHandler{manager: m})
 
 	// Load pending commands from storage
 	if err := m.loadPendingCommands(); err != nil {
 		log.WithError(err).Warn("Failed to load pending commands from storage")
 	}
+	if err := m.loadGroupCommands(); err != nil {
+		log.WithError(err).Warn("Failed to load group commands from storage")
+	}
 
 	// Start background workers
 	go m.timeoutWorker()
 	go m.statsWorker()
+	go m.dispatchWorker()
 
 	log.WithField("pending_commands", len(m.pendingCommands)).Info("Command manager started")
 	return nil
@@ -95,17 +130,45 @@ func (m *Manager) Stop() {
 	log.Info("Command manager stopped")
 }
 
-// SendCommand sends a command to a device
+// SendCommand sends a command to a device using the policy of its operation
 func (m *Manager) SendCommand(tenant, site, deviceID, operation string, args map[string]interface{}, timeoutSeconds int) (*types.DeviceCommand, error) {
+	return m.SendCommandWithOptions(tenant, site, deviceID, operation, args, timeoutSeconds, SendOptions{})
+}
+
+// SendCommandWithOptions sends a command to a device. When hold_offline is
+// enabled, commands for devices whose LWT reports offline are queued until
+// the device comes back; failed attempts are retried per operation policy.
+func (m *Manager) SendCommandWithOptions(tenant, site, deviceID, operation string, args map[string]interface{}, timeoutSeconds int, opts SendOptions) (*types.DeviceCommand, error) {
+	deviceKey := fmt.Sprintf("%s:%s:%s", tenant, site, deviceID)
+
+	m.mu.RLock()
+	policy := m.policyFor(operation)
+	hold := m.holdOffline && m.isOffline(deviceKey)
+	m.mu.RUnlock()
+
 	// Create command
 	command := &types.DeviceCommand{
-		ID:        utils.GenerateMessageID(),
-		DeviceID:  fmt.Sprintf("%s:%s:%s", tenant, site, deviceID),
-		Operation: operation,
-		Args:      args,
-		TimeoutMS: int64(timeoutSeconds * 1000),
-		Status:    "pending",
-		CreatedAt: time.Now(),
+		ID:          utils.GenerateMessageID(),
+		DeviceID:    deviceKey,
+		Operation:   operation,
+		Args:        args,
+		TimeoutMS:   int64(timeoutSeconds * 1000),
+		Status:      "pending",
+		CreatedAt:   time.Now(),
+		Priority:    policy.Priority,
+		MaxAttempts: policy.MaxAttempts,
+	}
+	if opts.Priority != nil {
+		command.Priority = *opts.Priority
+	}
+	if opts.MaxAttempts != nil {
+		command.MaxAttempts = *opts.MaxAttempts
+	}
+	if opts.Timeout > 0 {
+		command.TimeoutMS = opts.Timeout.Milliseconds()
+	}
+	if hold {
+		command.Status = "queued"
 	}
 
 	// Store command
@@ -118,47 +181,44 @@ func (m *Manager) SendCommand(tenant, site, deviceID, operation string, args map
 	m.pendingCommands[command.ID] = command
 	m.mu.Unlock()
 
-	// Build MQTT command payload
-	payload := map[string]interface{}{
-		"id":         command.ID,
-		"op":         operation,
-		"schema":     fmt.Sprintf("cmd.%s/1.0", operation),
-		"args":       args,
-		"timeout_ms": command.TimeoutMS,
-		"expect":     "result",
-		"reply_to":   nil,
-		"ts":         time.Now().UnixMilli(),
+	if hold {
+		log.WithFields(log.Fields{
+			"command_id": command.ID,
+			"device_id":  deviceID,
+			"operation":  operation,
+			"priority":   command.Priority,
+		}).Info("Device offline, command held until it reconnects")
+		return command, nil
 	}
 
 	// Publish command
-	topic := utils.BuildTopic(tenant, site, deviceID, "cmd", "req")
-	if err := m.mqttClient.Publish(topic, 1, false, payload); err != nil {
-		// Remove from pending commands on publish failure
+	if err := m.publishCommand(command); err != nil {
+		now := time.Now()
+		reason := fmt.Sprintf("Failed to publish command: %v", err)
+
 		m.mu.Lock()
-		delete(m.pendingCommands, command.ID)
+		retry := m.scheduleRetry(command, reason, now)
+		if !retry {
+			// Remove from pending commands on publish failure
+			delete(m.pendingCommands, command.ID)
+		}
 		m.mu.Unlock()
 
+		if retry {
+			m.storeCommand(command)
+			return command, nil
+		}
+
 		// Update command status
 		command.Status = "failed"
-		command.Error = fmt.Sprintf("Failed to publish command: %v", err)
+		command.Error = reason
+		command.CompletedAt = &now
 		m.storeCommand(command)
 
 		return nil, fmt.Errorf("failed to publish command: %w", err)
 	}
 
-	// Update command status and timestamp
-	command.Status = "sent"
-	now := time.Now()
-	command.SentAt = &now
 	m.storeCommand(command)
-
-	log.WithFields(log.Fields{
-		"command_id": command.ID,
-		"device_id":  deviceID,
-		"operation":  operation,
-		"topic":      topic,
-	}).Info("Command sent to device")
-
 	return command, nil
 }
 
@@ -167,9 +227,9 @@ func (m *Manager) GetCommand(commandID string) (*types.DeviceCommand, error) {
 	// Check pending commands first
 	m.mu.RLock()
 	if cmd, exists := m.pendingCommands[commandID]; exists {
-		m.mu.RUnlock()
 		// Return a copy
 		cmdCopy := *cmd
+		m.mu.RUnlock()
 		return &cmdCopy, nil
 	}
 	m.mu.RUnlock()
@@ -252,6 +312,10 @@ func (m *Manager) HandleCommandAck(topic string, payload []byte) error {
 		return fmt.Errorf("missing or invalid command ID in ACK")
 	}
 
+	if m.handleGroupAck(commandID, topic) {
+		return nil
+	}
+
 	m.mu.Lock()
 	command, exists := m.pendingCommands[commandID]
 	if !exists {
@@ -259,8 +323,11 @@ func (m *Manager) HandleCommandAck(topic string, payload []byte) error {
 		return fmt.Errorf("command not found: %s", commandID)
 	}
 
-	// Update command status
-	command.Status = "ack"
+	// Update command status; a cancel in flight keeps its status
+	if command.Status != "cancelling" {
+		command.Status = "ack"
+	}
+	command.NextAttemptAt = nil
 	m.mu.Unlock()
 
 	// Store updated command
@@ -273,6 +340,8 @@ func (m *Manager) HandleCommandAck(topic string, payload []byte) error {
 		"device_id":  command.DeviceID,
 	}).Info("Command acknowledged by device")
 
+	m.notify(UpdateAck, command)
+	m.handleCancelAck(command)
 	return nil
 }
 
@@ -289,6 +358,10 @@ func (m *Manager) HandleCommandResult(topic string, payload []byte) error {
 		return fmt.Errorf("missing or invalid command ID in result")
 	}
 
+	if m.handleGroupResult(commandID, topic, resultData) {
+		return nil
+	}
+
 	m.mu.Lock()
 	command, exists := m.pendingCommands[commandID]
 	if !exists {
@@ -298,7 +371,6 @@ func (m *Manager) HandleCommandResult(topic string, payload []byte) error {
 
 	// Remove from pending commands
 	delete(m.pendingCommands, commandID)
-	m.mu.Unlock()
 
 	// Update command with result
 	command.Status = "completed"
@@ -310,7 +382,10 @@ func (m *Manager) HandleCommandResult(topic string, payload []byte) error {
 	if errorMsg, ok := resultData["error"].(string); ok && errorMsg != "" {
 		command.Status = "failed"
 		command.Error = errorMsg
+	} else if status, _ := resultData["status"].(string); status == "cancelled" {
+		command.Status = "cancelled"
 	}
+	m.mu.Unlock()
 
 	// Store updated command
 	if err := m.storeCommand(command); err != nil {
@@ -323,19 +398,36 @@ func (m *Manager) HandleCommandResult(topic string, payload []byte) error {
 		"status":     command.Status,
 	}).Info("Command completed")
 
+	m.notify(UpdateFinished, command)
+	m.handleCancelResult(command)
 	return nil
 }
 
-// storeCommand stores command in database
+// buildCommandPayload builds the cmd/req payload defined by the SPEC
+func buildCommandPayload(commandID, operation string, args map[string]interface{}, timeoutMS int64) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         commandID,
+		"op":         operation,
+		"schema":     fmt.Sprintf("cmd.%s/1.0", operation),
+		"args":       args,
+		"timeout_ms": timeoutMS,
+		"expect":     "result",
+		"reply_to":   nil,
+		"ts":         time.Now().UnixMilli(),
+	}
+}
+
+// storeCommand stores command in database. Callers must not hold m.mu.
 func (m *Manager) storeCommand(command *types.DeviceCommand) error {
-	return m.storage.Transaction(func(tx storage.Transaction) error {
-		key := fmt.Sprintf("command:%s", command.ID)
-		data, err := json.Marshal(command)
-		if err != nil {
-			return fmt.Errorf("failed to marshal command: %w", err)
-		}
+	m.mu.RLock()
+	data, err := json.Marshal(command)
+	m.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
 
-		return tx.Set(key, string(data))
+	return m.storage.Transaction(func(tx storage.Transaction) error {
+		return tx.Set(fmt.Sprintf("command:%s", command.ID), string(data))
 	})
 }
 
@@ -361,17 +453,40 @@ func (m *Manager) checkTimeouts() {
 	now := time.Now()
 	var timedOutCommands []*types.DeviceCommand
 
+	var retriedCommands []*types.DeviceCommand
+
 	m.mu.Lock()
 	for commandID, command := range m.pendingCommands {
+		switch command.Status {
+		case "queued":
+			// Queued commands wait for the dispatcher
+			continue
+		case "completed", "failed", "cancelled", "timeout":
+			continue
+		}
+
 		// Check if command has timed out
 		timeoutDuration := time.Duration(command.TimeoutMS) * time.Millisecond
 		if command.SentAt != nil && now.Sub(*command.SentAt) > timeoutDuration {
+			// A command being cancelled, and the cancel request itself, must
+			// not be sent to the device again
+			retryable := command.Status != "cancelling" && command.Operation != CancelOperation
+			if retryable && m.scheduleRetry(command, "Command execution timeout", now) {
+				retriedCommands = append(retriedCommands, command)
+				continue
+			}
 			timedOutCommands = append(timedOutCommands, command)
 			delete(m.pendingCommands, commandID)
 		}
 	}
 	m.mu.Unlock()
 
+	for _, command := range retriedCommands {
+		if err := m.storeCommand(command); err != nil {
+			log.WithError(err).Error("Failed to store retried command")
+		}
+	}
+
 	// Handle timed out commands
 	for _, command := range timedOutCommands {
 		command.Status = "timeout"
@@ -388,7 +503,12 @@ func (m *Manager) checkTimeouts() {
 			"device_id":  command.DeviceID,
 			"operation":  command.Operation,
 		}).Warn("Command timed out")
+
+		m.notify(UpdateFinished, command)
+		m.handleCancelResult(command)
 	}
+
+	m.checkGroupTimeouts(now)
 }
 
 // statsWorker updates command statistics periodically
@@ -437,6 +557,8 @@ func (m *Manager) updateStats() {
 				stats.FailedCommands++
 			case "timeout":
 				stats.TimeoutCommands++
+			case "queued":
+				stats.QueuedCommands++
 			}
 
 			return nil
@@ -462,8 +584,15 @@ func (m *Manager) loadPendingCommands() error {
 			}
 
 			// Only load commands that are still pending execution
-			if command.Status == "pending" || command.Status == "sent" || command.Status == "ack" {
+			switch command.Status {
+			case "pending", "sent", "ack", "cancelling":
+				m.pendingCommands[command.ID] = &command
+			case "queued":
 				m.pendingCommands[command.ID] = &command
+				// Held commands stay held until the device reports online
+				if command.NextAttemptAt == nil {
+					m.offline[command.DeviceID] = true
+				}
 			}
 
 			return nil
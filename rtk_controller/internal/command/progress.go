@@ -0,0 +1,298 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"rtk_controller/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CancelOperation is the operation of the request asking a device to abort a command
+const CancelOperation = "cancel_command"
+
+// cancelTimeoutSeconds bounds how long the device has to answer a cancel request
+const cancelTimeoutSeconds = 10
+
+// Update kinds delivered to subscribers
+const (
+	UpdateAck       = "ack"
+	UpdateProgress  = "progress"
+	UpdateCancel    = "cancel"     // cancel request sent
+	UpdateCancelAck = "cancel_ack" // device acknowledged the cancel request
+	UpdateFinished  = "finished"   // completed, failed, timeout or cancelled
+)
+
+// CommandUpdate describes a change to a tracked command
+type CommandUpdate struct {
+	Kind    string
+	Command *types.DeviceCommand // copy taken when the update happened
+}
+
+// UpdateCallback receives command updates. It is called from the MQTT
+// handler goroutine and must not block.
+type UpdateCallback func(update CommandUpdate)
+
+type subscription struct {
+	commandID string // empty for all commands
+	callback  UpdateCallback
+}
+
+var subscriptionSeq uint64
+
+// Subscribe registers callback for updates of commandID, or of every
+// command when commandID is empty. It returns the subscription ID.
+func (m *Manager) Subscribe(commandID string, callback UpdateCallback) string {
+	id := fmt.Sprintf("sub_%d", atomic.AddUint64(&subscriptionSeq, 1))
+
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+	m.subscriptions[id] = &subscription{commandID: commandID, callback: callback}
+	return id
+}
+
+// Unsubscribe removes a subscription
+func (m *Manager) Unsubscribe(subscriptionID string) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+	delete(m.subscriptions, subscriptionID)
+}
+
+// notify delivers an update to the matching subscribers. Callers must not hold m.mu.
+func (m *Manager) notify(kind string, command *types.DeviceCommand) {
+	m.subMu.RLock()
+	var callbacks []UpdateCallback
+	for _, sub := range m.subscriptions {
+		if sub.commandID == "" || sub.commandID == command.ID {
+			callbacks = append(callbacks, sub.callback)
+		}
+	}
+	m.subMu.RUnlock()
+
+	if len(callbacks) == 0 {
+		return
+	}
+
+	m.mu.RLock()
+	cmdCopy := *command
+	m.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(CommandUpdate{Kind: kind, Command: &cmdCopy})
+	}
+}
+
+// HandleCommandProgress handles cmd/progress messages. The progress object
+// is taken from the "progress" field, or from the whole message without its
+// envelope fields when the device reports progress inline.
+func (m *Manager) HandleCommandProgress(topic string, payload []byte) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return fmt.Errorf("failed to parse progress payload: %w", err)
+	}
+
+	commandID, ok := data["id"].(string)
+	if !ok {
+		return fmt.Errorf("missing or invalid command ID in progress")
+	}
+
+	progress, ok := data["progress"].(map[string]interface{})
+	if !ok {
+		progress = make(map[string]interface{}, len(data))
+		for key, value := range data {
+			switch key {
+			case "id", "schema", "ts":
+				continue
+			}
+			progress[key] = value
+		}
+	}
+
+	m.mu.Lock()
+	command, exists := m.pendingCommands[commandID]
+	if !exists {
+		m.mu.Unlock()
+		return fmt.Errorf("command not found: %s", commandID)
+	}
+
+	now := time.Now()
+	command.Progress = progress
+	command.ProgressAt = &now
+	// Progress implies the device received the command
+	if command.Status == "sent" {
+		command.Status = "ack"
+	}
+	m.mu.Unlock()
+
+	if err := m.storeCommand(command); err != nil {
+		log.WithError(err).Error("Failed to store command progress")
+	}
+
+	log.WithFields(log.Fields{
+		"command_id": commandID,
+		"device_id":  command.DeviceID,
+	}).Debug("Command progress received")
+
+	m.notify(UpdateProgress, command)
+	return nil
+}
+
+// CancelCommand cancels a pending command. Commands that were not delivered
+// yet are cancelled locally; otherwise a cancel_command request is published
+// to the device and the command stays "cancelling" until the device reports
+// the outcome.
+func (m *Manager) CancelCommand(commandID string) (*types.DeviceCommand, error) {
+	m.mu.Lock()
+	command, exists := m.pendingCommands[commandID]
+	if !exists {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("command not pending: %s", commandID)
+	}
+	if command.Operation == CancelOperation {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("cancel requests cannot be cancelled")
+	}
+
+	switch command.Status {
+	case "pending", "queued":
+		delete(m.pendingCommands, commandID)
+		now := time.Now()
+		command.Status = "cancelled"
+		command.CompletedAt = &now
+		command.NextAttemptAt = nil
+		m.mu.Unlock()
+
+		if err := m.storeCommand(command); err != nil {
+			log.WithError(err).Error("Failed to store cancelled command")
+		}
+		log.WithField("command_id", commandID).Info("Command cancelled before delivery")
+
+		m.notify(UpdateFinished, command)
+		cmdCopy := *command
+		return &cmdCopy, nil
+
+	case "cancelling":
+		m.mu.Unlock()
+		return nil, fmt.Errorf("cancel already requested for %s", commandID)
+	}
+
+	// Claim the cancel before sending so a concurrent cancel is refused
+	previousStatus := command.Status
+	command.Status = "cancelling"
+	m.mu.Unlock()
+
+	tenant, site, deviceID := splitDeviceKey(command.DeviceID)
+	cancel, err := m.SendCommand(tenant, site, deviceID, CancelOperation,
+		map[string]interface{}{"command_id": commandID}, cancelTimeoutSeconds)
+
+	m.mu.Lock()
+	// A result or timeout may have finished the command in the meantime
+	current := m.pendingCommands[commandID] == command && command.Status == "cancelling"
+	if err != nil {
+		if current {
+			command.Status = previousStatus
+		}
+		m.mu.Unlock()
+		return nil, fmt.Errorf("failed to send cancel request: %w", err)
+	}
+	if !current {
+		// The device may even have answered the cancel already
+		cmdCopy := *command
+		m.mu.Unlock()
+		if cmdCopy.Status == "cancelled" {
+			return &cmdCopy, nil
+		}
+		return nil, fmt.Errorf("command %s is %s after the cancel request", commandID, cmdCopy.Status)
+	}
+	command.CancelRequestID = cancel.ID
+	cmdCopy := *command
+	m.mu.Unlock()
+
+	if err := m.storeCommand(command); err != nil {
+		log.WithError(err).Error("Failed to store cancelling command")
+	}
+
+	log.WithFields(log.Fields{
+		"command_id": commandID,
+		"cancel_id":  cancel.ID,
+	}).Info("Cancel request sent to device")
+
+	m.notify(UpdateCancel, command)
+	return &cmdCopy, nil
+}
+
+// cancelledCommand returns the pending command a cancel request refers to.
+// Callers hold m.mu.
+func (m *Manager) cancelledCommand(cancel *types.DeviceCommand) *types.DeviceCommand {
+	if cancel.Operation != CancelOperation {
+		return nil
+	}
+	commandID, _ := cancel.Args["command_id"].(string)
+	command, exists := m.pendingCommands[commandID]
+	if !exists || command.CancelRequestID != cancel.ID {
+		return nil
+	}
+	return command
+}
+
+// handleCancelAck reports the device's acknowledgment of a cancel request
+func (m *Manager) handleCancelAck(cancel *types.DeviceCommand) {
+	m.mu.RLock()
+	command := m.cancelledCommand(cancel)
+	m.mu.RUnlock()
+
+	if command != nil {
+		m.notify(UpdateCancelAck, command)
+	}
+}
+
+// handleCancelResult finishes the cancelled command when the device confirms
+// the cancellation. A failed cancel request leaves the command running.
+func (m *Manager) handleCancelResult(cancel *types.DeviceCommand) {
+	m.mu.Lock()
+	command := m.cancelledCommand(cancel)
+	if command == nil {
+		m.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	finished := cancel.Status == "completed"
+	if finished {
+		delete(m.pendingCommands, command.ID)
+		command.Status = "cancelled"
+		command.CompletedAt = &now
+	} else {
+		command.Status = "ack"
+		command.Error = fmt.Sprintf("Cancel failed: %s", cancel.Error)
+	}
+	command.CancelRequestID = ""
+	m.mu.Unlock()
+
+	if err := m.storeCommand(command); err != nil {
+		log.WithError(err).Error("Failed to store cancelled command")
+	}
+
+	if finished {
+		log.WithField("command_id", command.ID).Info("Command cancelled by device")
+		m.notify(UpdateFinished, command)
+	} else {
+		log.WithFields(log.Fields{
+			"command_id": command.ID,
+			"error":      cancel.Error,
+		}).Warn("Device could not cancel command")
+		m.notify(UpdateCancelAck, command)
+	}
+}
+
+// CommandProgressHandler handles command progress messages
+type CommandProgressHandler struct {
+	manager *Manager
+}
+
+func (h *CommandProgressHandler) HandleMessage(topic string, payload []byte) error {
+	return h.manager.HandleCommandProgress(topic, payload)
+}
@@ -0,0 +1,234 @@
+package command
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type updateRecorder struct {
+	mu      sync.Mutex
+	updates []CommandUpdate
+}
+
+func (r *updateRecorder) record(update CommandUpdate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, update)
+}
+
+func (r *updateRecorder) kinds() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kinds := make([]string, 0, len(r.updates))
+	for _, update := range r.updates {
+		kinds = append(kinds, update.Kind)
+	}
+	return kinds
+}
+
+func TestManager_CommandProgress(t *testing.T) {
+	manager, _ := newQueueTestManager(t, newTestStorage(t))
+
+	command, err := manager.SendCommand("office", "floor1", "dev1", "diagnostics.speed_test", nil, 60)
+	require.NoError(t, err)
+
+	recorder := &updateRecorder{}
+	subID := manager.Subscribe(command.ID, recorder.record)
+	all := &updateRecorder{}
+	manager.Subscribe("", all.record)
+
+	other, err := manager.SendCommand("office", "floor1", "dev2", "light.set", nil, 60)
+	require.NoError(t, err)
+
+	respond(t, manager, "office/floor1/dev1", "ack", map[string]interface{}{"id": command.ID})
+	require.NoError(t, manager.HandleCommandProgress("rtk/v1/office/floor1/dev1/cmd/progress",
+		[]byte(`{"id":"`+command.ID+`","progress":{"percent":40,"stage":"download"}}`)))
+	// Inline progress fields without a progress object
+	require.NoError(t, manager.HandleCommandProgress("rtk/v1/office/floor1/dev1/cmd/progress",
+		[]byte(`{"id":"`+command.ID+`","ts":1,"percent":80}`)))
+	respond(t, manager, "office/floor1/dev2", "ack", map[string]interface{}{"id": other.ID})
+
+	stored, err := manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"percent": float64(80)}, stored.Progress)
+	assert.NotNil(t, stored.ProgressAt)
+
+	respond(t, manager, "office/floor1/dev1", "res", map[string]interface{}{"id": command.ID, "status": "completed"})
+
+	assert.Equal(t, []string{UpdateAck, UpdateProgress, UpdateProgress, UpdateFinished}, recorder.kinds())
+	assert.Equal(t, float64(40), recorder.updates[1].Command.Progress["percent"])
+	assert.Equal(t, "completed", recorder.updates[3].Command.Status)
+	assert.Len(t, all.kinds(), 5)
+
+	manager.Unsubscribe(subID)
+	respond(t, manager, "office/floor1/dev2", "res", map[string]interface{}{"id": other.ID})
+	assert.Len(t, recorder.kinds(), 4)
+
+	assert.Error(t, manager.HandleCommandProgress("rtk/v1/office/floor1/dev1/cmd/progress", []byte(`{"id":"unknown"}`)))
+}
+
+func TestManager_CancelQueuedCommand(t *testing.T) {
+	manager, client := newQueueTestManager(t, newTestStorage(t))
+
+	require.NoError(t, manager.HandleDeviceLWT("rtk/v1/office/floor1/dev1/lwt", []byte(`{"status":"offline"}`)))
+	command, err := manager.SendCommand("office", "floor1", "dev1", "fw.update", nil, 60)
+	require.NoError(t, err)
+
+	cancelled, err := manager.CancelCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "cancelled", cancelled.Status)
+	assert.Empty(t, client.topics(), "nothing to cancel on the device")
+	assert.Empty(t, manager.QueuedCommands())
+
+	_, err = manager.CancelCommand(command.ID)
+	assert.Error(t, err)
+}
+
+func TestManager_CancelRunningCommand(t *testing.T) {
+	manager, client := newQueueTestManager(t, newTestStorage(t))
+
+	command, err := manager.SendCommand("office", "floor1", "dev1", "fw.update", nil, 600)
+	require.NoError(t, err)
+	respond(t, manager, "office/floor1/dev1", "ack", map[string]interface{}{"id": command.ID})
+
+	recorder := &updateRecorder{}
+	manager.Subscribe(command.ID, recorder.record)
+
+	cancelling, err := manager.CancelCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "cancelling", cancelling.Status)
+
+	require.Len(t, client.published, 2)
+	request := client.published[1].payload
+	assert.Equal(t, CancelOperation, request["op"])
+	assert.Equal(t, cancelling.CancelRequestID, request["id"])
+	assert.Equal(t, command.ID, request["args"].(map[string]interface{})["command_id"])
+
+	_, err = manager.CancelCommand(command.ID)
+	assert.Error(t, err, "cancel already requested")
+
+	respond(t, manager, "office/floor1/dev1", "ack", map[string]interface{}{"id": cancelling.CancelRequestID})
+	respond(t, manager, "office/floor1/dev1", "res", map[string]interface{}{"id": cancelling.CancelRequestID, "status": "completed"})
+
+	stored, err := manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "cancelled", stored.Status)
+	assert.NotNil(t, stored.CompletedAt)
+	assert.Equal(t, []string{UpdateCancel, UpdateCancelAck, UpdateFinished}, recorder.kinds())
+
+	// The device's own cancelled result for the original arrives late
+	assert.Error(t, manager.HandleCommandResult("rtk/v1/office/floor1/dev1/cmd/res", []byte(`{"id":"`+command.ID+`","status":"cancelled"}`)))
+}
+
+func TestManager_CancelWhileCommandFinishes(t *testing.T) {
+	manager, client := newQueueTestManager(t, newTestStorage(t))
+
+	command, err := manager.SendCommand("office", "floor1", "dev1", "fw.update", nil, 600)
+	require.NoError(t, err)
+	respond(t, manager, "office/floor1/dev1", "ack", map[string]interface{}{"id": command.ID})
+
+	// A second cancel is refused while the first is being sent, and the
+	// result of the original lands before the send returns
+	var concurrentErr error
+	client.onPublish = func(op string) {
+		if op != CancelOperation {
+			return
+		}
+		_, concurrentErr = manager.CancelCommand(command.ID)
+		respond(t, manager, "office/floor1/dev1", "res", map[string]interface{}{"id": command.ID, "status": "completed"})
+	}
+
+	_, err = manager.CancelCommand(command.ID)
+	assert.Error(t, err)
+	assert.Error(t, concurrentErr)
+	assert.Len(t, client.topics(), 2, "a single cancel request")
+
+	stored, err := manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "completed", stored.Status)
+	assert.Empty(t, stored.CancelRequestID)
+}
+
+func TestManager_CancelSendFailureKeepsStatus(t *testing.T) {
+	manager, client := newQueueTestManager(t, newTestStorage(t))
+
+	command, err := manager.SendCommand("office", "floor1", "dev1", "fw.update", nil, 600)
+	require.NoError(t, err)
+	respond(t, manager, "office/floor1/dev1", "ack", map[string]interface{}{"id": command.ID})
+
+	client.mu.Lock()
+	client.err = errors.New("not connected")
+	client.mu.Unlock()
+	_, err = manager.CancelCommand(command.ID)
+	assert.Error(t, err)
+
+	stored, err := manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ack", stored.Status)
+
+	// The cancel can be tried again
+	client.mu.Lock()
+	client.err = nil
+	client.mu.Unlock()
+	cancelling, err := manager.CancelCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "cancelling", cancelling.Status)
+}
+
+func TestManager_CancelRejected(t *testing.T) {
+	manager, _ := newQueueTestManager(t, newTestStorage(t))
+
+	command, err := manager.SendCommand("office", "floor1", "dev1", "fw.update", nil, 600)
+	require.NoError(t, err)
+
+	cancelling, err := manager.CancelCommand(command.ID)
+	require.NoError(t, err)
+
+	respond(t, manager, "office/floor1/dev1", "res", map[string]interface{}{"id": cancelling.CancelRequestID, "error": "flash write in progress"})
+
+	stored, err := manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ack", stored.Status, "command keeps running")
+	assert.Contains(t, stored.Error, "flash write in progress")
+	assert.Empty(t, stored.CancelRequestID)
+
+	// The device finishes the original with a cancelled result instead
+	respond(t, manager, "office/floor1/dev1", "res", map[string]interface{}{"id": command.ID, "status": "cancelled"})
+	stored, err = manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "cancelled", stored.Status)
+}
+
+func TestManager_CancellingCommandTimesOutWithoutRetry(t *testing.T) {
+	manager, client := newQueueTestManager(t, newTestStorage(t))
+
+	// fw.* commands are retried on timeout, but not while being cancelled
+	command, err := manager.SendCommand("office", "floor1", "dev1", "fw.update", nil, 5)
+	require.NoError(t, err)
+	cancelling, err := manager.CancelCommand(command.ID)
+	require.NoError(t, err)
+	require.Len(t, client.topics(), 2)
+
+	manager.mu.Lock()
+	past := time.Now().Add(-time.Minute)
+	manager.pendingCommands[command.ID].SentAt = &past
+	manager.pendingCommands[cancelling.CancelRequestID].SentAt = &past
+	manager.mu.Unlock()
+	manager.checkTimeouts()
+	manager.dispatchQueued(time.Now().Add(time.Hour))
+
+	assert.Len(t, client.topics(), 2, "nothing is re-sent")
+	assert.Empty(t, manager.QueuedCommands())
+
+	stored, err := manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "timeout", stored.Status)
+	request, err := manager.GetCommand(cancelling.CancelRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "timeout", request.Status)
+}
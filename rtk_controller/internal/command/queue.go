@@ -0,0 +1,402 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"rtk_controller/internal/config"
+	"rtk_controller/pkg/types"
+	"rtk_controller/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Command priorities. Queued commands with a higher priority are delivered first.
+const (
+	PriorityLow    = 0
+	PriorityNormal = 5
+	PriorityHigh   = 10
+)
+
+// defaultBackoff is used when a policy allows retries without a backoff
+const defaultBackoff = 5 * time.Second
+
+// OperationPolicy controls retries and priority for an operation
+type OperationPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Priority    int
+}
+
+// SendOptions overrides the operation policy for a single command
+type SendOptions struct {
+	Priority    *int
+	MaxAttempts *int
+	Timeout     time.Duration // overrides timeoutSeconds when set
+}
+
+// ParsePriority parses low, normal, high or a number
+func ParsePriority(s string) (int, error) {
+	switch strings.ToLower(s) {
+	case "", "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	p, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q", s)
+	}
+	return p, nil
+}
+
+// ApplyConfig loads the offline hold settings and operation policies
+func (m *Manager) ApplyConfig(cfg config.CommandsConfig) error {
+	var holdTTL time.Duration
+	if cfg.HoldTTL != "" {
+		d, err := time.ParseDuration(cfg.HoldTTL)
+		if err != nil {
+			return fmt.Errorf("invalid commands.hold_ttl: %w", err)
+		}
+		holdTTL = d
+	}
+
+	policies := make(map[string]OperationPolicy, len(cfg.Policies))
+	for _, pc := range cfg.Policies {
+		if pc.Operation == "" {
+			return fmt.Errorf("command policy without operation")
+		}
+		policy := OperationPolicy{MaxAttempts: pc.MaxAttempts}
+		var err error
+		if pc.Backoff != "" {
+			if policy.Backoff, err = time.ParseDuration(pc.Backoff); err != nil {
+				return fmt.Errorf("invalid backoff for %s: %w", pc.Operation, err)
+			}
+		}
+		if pc.MaxBackoff != "" {
+			if policy.MaxBackoff, err = time.ParseDuration(pc.MaxBackoff); err != nil {
+				return fmt.Errorf("invalid max_backoff for %s: %w", pc.Operation, err)
+			}
+		}
+		if policy.Priority, err = ParsePriority(pc.Priority); err != nil {
+			return fmt.Errorf("invalid priority for %s: %w", pc.Operation, err)
+		}
+		policies[pc.Operation] = policy
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.holdOffline = cfg.HoldOffline
+	m.holdTTL = holdTTL
+	m.policies = policies
+	return nil
+}
+
+// SetOperationPolicy sets the policy for an operation, a prefix such as
+// "fw.*" or "*" for the default.
+func (m *Manager) SetOperationPolicy(operation string, policy OperationPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policies[operation] = policy
+}
+
+// SetHoldOffline enables holding commands for offline devices
+func (m *Manager) SetHoldOffline(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.holdOffline = enabled
+}
+
+// policyFor returns the most specific policy for operation. Callers hold m.mu.
+func (m *Manager) policyFor(operation string) OperationPolicy {
+	if policy, ok := m.policies[operation]; ok {
+		return policy
+	}
+
+	best, bestLen := OperationPolicy{MaxAttempts: 1, Priority: PriorityNormal}, -1
+	for pattern, policy := range m.policies {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if !ok || !strings.HasPrefix(operation, prefix) {
+			continue
+		}
+		if len(prefix) > bestLen {
+			best, bestLen = policy, len(prefix)
+		}
+	}
+	return best
+}
+
+// retryDelay returns the backoff before the given attempt (2 = first retry)
+func (p OperationPolicy) retryDelay(attempt int) time.Duration {
+	delay := p.Backoff
+	if delay <= 0 {
+		delay = defaultBackoff
+	}
+	for i := 2; i < attempt; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// publishCommand publishes one delivery attempt. Callers must not hold m.mu.
+func (m *Manager) publishCommand(command *types.DeviceCommand) error {
+	tenant, site, deviceID := splitDeviceKey(command.DeviceID)
+	payload := buildCommandPayload(command.ID, command.Operation, command.Args, command.TimeoutMS)
+	topic := utils.BuildTopic(tenant, site, deviceID, "cmd", "req")
+
+	err := m.mqttClient.Publish(topic, 1, false, payload)
+
+	m.mu.Lock()
+	command.Attempts++
+	if err == nil {
+		now := time.Now()
+		// A fast device may already have acknowledged or answered
+		if command.Status == "pending" || command.Status == "queued" {
+			command.Status = "sent"
+		}
+		command.SentAt = &now
+		command.NextAttemptAt = nil
+	}
+	m.mu.Unlock()
+
+	if err == nil {
+		log.WithFields(log.Fields{
+			"command_id": command.ID,
+			"device_id":  deviceID,
+			"operation":  command.Operation,
+			"topic":      topic,
+			"attempt":    command.Attempts,
+		}).Info("Command sent to device")
+	}
+	return err
+}
+
+// scheduleRetry queues command for another attempt if its policy allows one.
+// Callers hold m.mu.
+func (m *Manager) scheduleRetry(command *types.DeviceCommand, reason string, now time.Time) bool {
+	if command.Attempts >= command.MaxAttempts {
+		return false
+	}
+
+	next := now.Add(m.policyFor(command.Operation).retryDelay(command.Attempts + 1))
+	command.Status = "queued"
+	command.Error = reason
+	command.NextAttemptAt = &next
+
+	log.WithFields(log.Fields{
+		"command_id": command.ID,
+		"device_id":  command.DeviceID,
+		"attempt":    command.Attempts,
+		"retry_at":   next.Format(time.RFC3339),
+	}).Warn("Command will be retried")
+	return true
+}
+
+// isOffline reports whether the last LWT of a device said offline. Callers hold m.mu.
+func (m *Manager) isOffline(deviceKey string) bool {
+	return m.offline[deviceKey]
+}
+
+// HandleDeviceLWT tracks device presence from lwt messages
+func (m *Manager) HandleDeviceLWT(topic string, payload []byte) error {
+	tenant, site, deviceID, _, _ := utils.ExtractTopicParts(topic)
+	if deviceID == "" {
+		return fmt.Errorf("invalid lwt topic: %s", topic)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return fmt.Errorf("failed to parse lwt payload: %w", err)
+	}
+	status, _ := data["status"].(string)
+	if inner, ok := data["payload"].(map[string]interface{}); ok && status == "" {
+		status, _ = inner["status"].(string)
+	}
+
+	key := fmt.Sprintf("%s:%s:%s", tenant, site, deviceID)
+	if status == "online" {
+		m.markOnline(key)
+		return nil
+	}
+
+	m.mu.Lock()
+	m.offline[key] = true
+	m.mu.Unlock()
+	return nil
+}
+
+// HandleDeviceState treats any state message as a sign the device is online
+func (m *Manager) HandleDeviceState(topic string, payload []byte) error {
+	tenant, site, deviceID, _, _ := utils.ExtractTopicParts(topic)
+	if deviceID == "" {
+		return fmt.Errorf("invalid state topic: %s", topic)
+	}
+	m.markOnline(fmt.Sprintf("%s:%s:%s", tenant, site, deviceID))
+	return nil
+}
+
+func (m *Manager) markOnline(deviceKey string) {
+	m.mu.Lock()
+	wasOffline := m.offline[deviceKey]
+	delete(m.offline, deviceKey)
+	m.mu.Unlock()
+
+	if wasOffline {
+		log.WithField("device_id", deviceKey).Info("Device back online, delivering held commands")
+		m.wakeDispatcher()
+	}
+}
+
+func (m *Manager) wakeDispatcher() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// QueuedCommands returns the queued commands in delivery order
+func (m *Manager) QueuedCommands() []*types.DeviceCommand {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var queued []*types.DeviceCommand
+	for _, command := range m.pendingCommands {
+		if command.Status == "queued" {
+			cmdCopy := *command
+			queued = append(queued, &cmdCopy)
+		}
+	}
+	sortByPriority(queued)
+	return queued
+}
+
+// sortByPriority orders commands by priority, then by age
+func sortByPriority(commands []*types.DeviceCommand) {
+	sort.SliceStable(commands, func(i, j int) bool {
+		if commands[i].Priority != commands[j].Priority {
+			return commands[i].Priority > commands[j].Priority
+		}
+		return commands[i].CreatedAt.Before(commands[j].CreatedAt)
+	})
+}
+
+// dispatchWorker delivers queued commands whose device is online and whose
+// retry time has come, highest priority first.
+func (m *Manager) dispatchWorker() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+		m.dispatchQueued(time.Now())
+	}
+}
+
+// dispatchQueued delivers every queued command that is ready
+func (m *Manager) dispatchQueued(now time.Time) {
+	var ready, expired []*types.DeviceCommand
+
+	m.mu.Lock()
+	for id, command := range m.pendingCommands {
+		if command.Status != "queued" {
+			continue
+		}
+		if m.holdOffline && m.isOffline(command.DeviceID) {
+			if m.holdTTL > 0 && now.Sub(command.CreatedAt) > m.holdTTL {
+				delete(m.pendingCommands, id)
+				expired = append(expired, command)
+			}
+			continue
+		}
+		if command.NextAttemptAt != nil && now.Before(*command.NextAttemptAt) {
+			continue
+		}
+		ready = append(ready, command)
+	}
+	m.mu.Unlock()
+
+	for _, command := range expired {
+		command.Status = "timeout"
+		command.Error = "Device offline, command not delivered"
+		command.CompletedAt = &now
+		if err := m.storeCommand(command); err != nil {
+			log.WithError(err).Error("Failed to store expired command")
+		}
+		log.WithFields(log.Fields{
+			"command_id": command.ID,
+			"device_id":  command.DeviceID,
+		}).Warn("Held command expired")
+
+		m.notify(UpdateFinished, command)
+	}
+
+	sortByPriority(ready)
+	for _, command := range ready {
+		m.deliver(command)
+	}
+}
+
+// deliver publishes a queued command and handles a publish failure
+func (m *Manager) deliver(command *types.DeviceCommand) {
+	err := m.publishCommand(command)
+	if err == nil {
+		if err := m.storeCommand(command); err != nil {
+			log.WithError(err).Error("Failed to store sent command")
+		}
+		return
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	retry := m.scheduleRetry(command, fmt.Sprintf("Failed to publish command: %v", err), now)
+	if !retry {
+		delete(m.pendingCommands, command.ID)
+		command.Status = "failed"
+		command.Error = fmt.Sprintf("Failed to publish command: %v", err)
+		command.CompletedAt = &now
+	}
+	m.mu.Unlock()
+
+	if err := m.storeCommand(command); err != nil {
+		log.WithError(err).Error("Failed to store command")
+	}
+	if !retry {
+		m.notify(UpdateFinished, command)
+	}
+}
+
+// DeviceLWTHandler handles device lwt messages
+type DeviceLWTHandler struct {
+	manager *Manager
+}
+
+func (h *DeviceLWTHandler) HandleMessage(topic string, payload []byte) error {
+	return h.manager.HandleDeviceLWT(topic, payload)
+}
+
+// DeviceStateHandler handles device state messages
+type DeviceStateHandler struct {
+	manager *Manager
+}
+
+func (h *DeviceStateHandler) HandleMessage(topic string, payload []byte) error {
+	return h.manager.HandleDeviceState(topic, payload)
+}
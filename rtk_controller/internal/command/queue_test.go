@@ -0,0 +1,178 @@
+package command
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rtk_controller/internal/config"
+	"rtk_controller/internal/storage"
+)
+
+func newQueueTestManager(t *testing.T, store storage.Storage) (*Manager, *recordingMQTT) {
+	t.Helper()
+
+	client := &recordingMQTT{}
+	manager := NewManager(client, store)
+	require.NoError(t, manager.ApplyConfig(config.CommandsConfig{
+		HoldOffline: true,
+		Policies: []config.CommandPolicyConfig{
+			{Operation: "*", MaxAttempts: 1},
+			{Operation: "fw.*", MaxAttempts: 3, Backoff: "10s", MaxBackoff: "15s", Priority: "low"},
+			{Operation: "device.reboot", MaxAttempts: 2, Priority: "high"},
+		},
+	}))
+	require.NoError(t, manager.loadPendingCommands())
+	return manager, client
+}
+
+func newTestStorage(t *testing.T) storage.Storage {
+	t.Helper()
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestManager_PolicyFor(t *testing.T) {
+	manager, _ := newQueueTestManager(t, newTestStorage(t))
+
+	assert.Equal(t, 3, manager.policyFor("fw.update").MaxAttempts)
+	assert.Equal(t, PriorityLow, manager.policyFor("fw.update").Priority)
+	assert.Equal(t, PriorityHigh, manager.policyFor("device.reboot").Priority)
+	assert.Equal(t, 1, manager.policyFor("light.set").MaxAttempts)
+
+	policy := manager.policyFor("fw.update")
+	assert.Equal(t, 10*time.Second, policy.retryDelay(2))
+	assert.Equal(t, 15*time.Second, policy.retryDelay(3))
+	assert.Equal(t, 15*time.Second, policy.retryDelay(5))
+
+	assert.Error(t, manager.ApplyConfig(config.CommandsConfig{
+		Policies: []config.CommandPolicyConfig{{Operation: "x", Priority: "urgent"}},
+	}))
+}
+
+func TestManager_RetryAfterTimeout(t *testing.T) {
+	manager, client := newQueueTestManager(t, newTestStorage(t))
+
+	command, err := manager.SendCommand("office", "floor1", "dev1", "fw.update", nil, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "sent", command.Status)
+	assert.Equal(t, 1, command.Attempts)
+
+	// The first timeout schedules a retry after the backoff
+	manager.mu.Lock()
+	past := time.Now().Add(-6 * time.Second)
+	manager.pendingCommands[command.ID].SentAt = &past
+	manager.mu.Unlock()
+	manager.checkTimeouts()
+
+	queued, err := manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "queued", queued.Status)
+	require.NotNil(t, queued.NextAttemptAt)
+
+	manager.dispatchQueued(time.Now())
+	assert.Len(t, client.topics(), 1, "retry must wait for the backoff")
+
+	manager.dispatchQueued(queued.NextAttemptAt.Add(time.Millisecond))
+	assert.Len(t, client.topics(), 2)
+
+	resent, _ := manager.GetCommand(command.ID)
+	assert.Equal(t, "sent", resent.Status)
+	assert.Equal(t, 2, resent.Attempts)
+}
+
+func TestManager_TimeoutWithoutRetry(t *testing.T) {
+	manager, _ := newQueueTestManager(t, newTestStorage(t))
+
+	command, err := manager.SendCommand("office", "floor1", "dev1", "light.set", nil, 5)
+	require.NoError(t, err)
+
+	manager.mu.Lock()
+	past := time.Now().Add(-time.Minute)
+	manager.pendingCommands[command.ID].SentAt = &past
+	manager.mu.Unlock()
+	manager.checkTimeouts()
+
+	stored, err := manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "timeout", stored.Status)
+}
+
+func TestManager_PublishFailureRetries(t *testing.T) {
+	manager, client := newQueueTestManager(t, newTestStorage(t))
+	client.err = errors.New("not connected")
+
+	command, err := manager.SendCommand("office", "floor1", "dev1", "device.reboot", nil, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "queued", command.Status)
+
+	_, err = manager.SendCommand("office", "floor1", "dev1", "light.set", nil, 5)
+	assert.Error(t, err, "operations without retries fail immediately")
+
+	client.err = nil
+	manager.dispatchQueued(time.Now().Add(time.Minute))
+	assert.Equal(t, []string{"rtk/v1/office/floor1/dev1/cmd/req"}, client.topics())
+}
+
+func TestManager_HoldOfflineDeliversByPriority(t *testing.T) {
+	store := newTestStorage(t)
+	manager, client := newQueueTestManager(t, store)
+
+	require.NoError(t, manager.HandleDeviceLWT("rtk/v1/office/floor1/dev1/lwt", []byte(`{"status":"offline"}`)))
+
+	low, err := manager.SendCommand("office", "floor1", "dev1", "fw.update", nil, 30)
+	require.NoError(t, err)
+	normal, err := manager.SendCommand("office", "floor1", "dev1", "light.set", nil, 30)
+	require.NoError(t, err)
+	high, err := manager.SendCommand("office", "floor1", "dev1", "device.reboot", nil, 30)
+	require.NoError(t, err)
+
+	assert.Equal(t, "queued", low.Status)
+	assert.Empty(t, client.topics())
+	assert.Len(t, manager.QueuedCommands(), 3)
+
+	manager.dispatchQueued(time.Now())
+	assert.Empty(t, client.topics(), "held while the device is offline")
+
+	// Restart: the queue is persisted and still held
+	manager.savePendingCommands()
+	restarted, restartedClient := newQueueTestManager(t, store)
+	queued := restarted.QueuedCommands()
+	require.Len(t, queued, 3)
+	assert.Equal(t, []string{high.ID, normal.ID, low.ID}, []string{queued[0].ID, queued[1].ID, queued[2].ID})
+
+	restarted.dispatchQueued(time.Now())
+	assert.Empty(t, restartedClient.topics())
+
+	require.NoError(t, restarted.HandleDeviceLWT("rtk/v1/office/floor1/dev1/lwt", []byte(`{"status":"online"}`)))
+	restarted.dispatchQueued(time.Now())
+
+	require.Len(t, restartedClient.published, 3)
+	var order []string
+	for _, msg := range restartedClient.published {
+		order = append(order, msg.payload["op"].(string))
+	}
+	assert.Equal(t, []string{"device.reboot", "light.set", "fw.update"}, order)
+	assert.Empty(t, restarted.QueuedCommands())
+}
+
+func TestManager_HeldCommandExpires(t *testing.T) {
+	manager, client := newQueueTestManager(t, newTestStorage(t))
+	manager.holdTTL = time.Minute
+
+	require.NoError(t, manager.HandleDeviceLWT("rtk/v1/office/floor1/dev1/lwt", []byte(`{"status":"offline"}`)))
+	command, err := manager.SendCommand("office", "floor1", "dev1", "light.set", nil, 30)
+	require.NoError(t, err)
+
+	manager.dispatchQueued(time.Now().Add(2 * time.Minute))
+
+	stored, err := manager.GetCommand(command.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "timeout", stored.Status)
+	assert.Empty(t, client.topics())
+}
@@ -9,11 +9,15 @@ import (
 
 // Config represents the complete configuration structure
 type Config struct {
-	MQTT      MQTTConfig      `mapstructure:"mqtt"`
-	Storage   StorageConfig   `mapstructure:"storage"`
-	Diagnosis DiagnosisConfig `mapstructure:"diagnosis"`
-	Schema    SchemaConfig    `mapstructure:"schema"`
-	Logging   LoggingConfig   `mapstructure:"logging"`
+	MQTT           MQTTConfig           `mapstructure:"mqtt"`
+	Storage        StorageConfig        `mapstructure:"storage"`
+	Diagnosis      DiagnosisConfig      `mapstructure:"diagnosis"`
+	Schema         SchemaConfig         `mapstructure:"schema"`
+	Commands       CommandsConfig       `mapstructure:"commands"`
+	Sites          SitesConfig          `mapstructure:"sites"`
+	TopologyEvents TopologyEventsConfig `mapstructure:"topology_events"`
+	Alerting       AlertingConfig       `mapstructure:"alerting"`
+	Logging        LoggingConfig        `mapstructure:"logging"`
 }
 
 // MQTTConfig holds MQTT client configuration
@@ -56,9 +60,12 @@ type MQTTLogging struct {
 
 // StorageConfig holds database configuration
 type StorageConfig struct {
-	Path        string `mapstructure:"path"`
-	BackupDir   string `mapstructure:"backup_dir"`
-	BackupCount int    `mapstructure:"backup_count"`
+	Backend         string `mapstructure:"backend"` // buntdb or bolt
+	Path            string `mapstructure:"path"`
+	BackupDir       string `mapstructure:"backup_dir"`
+	BackupCount     int    `mapstructure:"backup_count"`
+	BackupInterval  string `mapstructure:"backup_interval"`  // empty or "0" disables scheduled backups
+	CompactInterval string `mapstructure:"compact_interval"` // empty or "0" disables scheduled compaction
 }
 
 // DiagnosisConfig holds diagnosis system configuration
@@ -73,11 +80,106 @@ type DiagnosisConfig struct {
 type SchemaConfig struct {
 	Enabled             bool     `mapstructure:"enabled"`
 	SchemaFiles         []string `mapstructure:"schema_files"`
+	SchemaDirs          []string `mapstructure:"schema_dirs"` // directories of *.json schemas
+	WatchDirs           bool     `mapstructure:"watch_dirs"`  // hot-reload when schema_dirs change
 	StrictValidation    bool     `mapstructure:"strict_validation"`
 	LogValidationErrors bool     `mapstructure:"log_validation_errors"`
 	CacheResults        bool     `mapstructure:"cache_results"`
 	CacheSize           int      `mapstructure:"cache_size"`
 	StoreResults        bool     `mapstructure:"store_results"`
+
+	// Dead letters kept by strict validation; the oldest are dropped first
+	DeadLetterMaxEntries int    `mapstructure:"dead_letter_max_entries"` // 0 keeps any number
+	DeadLetterTTL        string `mapstructure:"dead_letter_ttl"`         // empty keeps them until replayed or deleted
+
+	// Versioned schemas validated against the exact version a payload announces
+	Versions []SchemaVersionConfig `mapstructure:"versions"`
+}
+
+// SchemaVersionConfig registers a schema file for an announced schema name and version
+type SchemaVersionConfig struct {
+	Name       string `mapstructure:"name"`    // e.g. "state"
+	Version    string `mapstructure:"version"` // e.g. "1.1"
+	File       string `mapstructure:"file"`
+	Deprecated bool   `mapstructure:"deprecated"`
+}
+
+// CommandsConfig holds command delivery configuration
+type CommandsConfig struct {
+	HoldOffline bool                  `mapstructure:"hold_offline"` // queue commands for offline devices
+	HoldTTL     string                `mapstructure:"hold_ttl"`     // give up on held commands after this long, empty keeps them
+	Policies    []CommandPolicyConfig `mapstructure:"policies"`
+}
+
+// CommandPolicyConfig holds retry and priority settings for an operation.
+// Operation may be an exact name, a prefix like "fw.*" or "*" for the default.
+type CommandPolicyConfig struct {
+	Operation   string `mapstructure:"operation"`
+	MaxAttempts int    `mapstructure:"max_attempts"`
+	Backoff     string `mapstructure:"backoff"`
+	MaxBackoff  string `mapstructure:"max_backoff"`
+	Priority    string `mapstructure:"priority"` // low, normal, high or a number
+}
+
+// SitesConfig holds tenant/site registry configuration
+type SitesConfig struct {
+	DefaultTenant string `mapstructure:"default_tenant"` // scope used when none is given
+	DefaultSite   string `mapstructure:"default_site"`
+	MaxSites      int    `mapstructure:"max_sites"` // sites with topology/QoS managers at once, 0 for no limit
+}
+
+// TopologyEventsConfig holds delivery settings of real-time topology events
+type TopologyEventsConfig struct {
+	Enabled          bool     `mapstructure:"enabled"`
+	StreamAddress    string   `mapstructure:"stream_address"`  // SSE/WebSocket listen address, empty disables the endpoint
+	StreamToken      string   `mapstructure:"stream_token"`    // required from stream clients; the endpoint is not served without it
+	AllowedOrigins   []string `mapstructure:"allowed_origins"` // browser origins allowed besides the endpoint's own
+	PublishMQTT      bool     `mapstructure:"publish_mqtt"`    // publish every event to rtk/v1/{tenant}/{site}/_controller/topology/events
+	Webhooks         []string `mapstructure:"webhooks"`        // URLs every event is POSTed to
+	WebhookSecret    string   `mapstructure:"webhook_secret"`  // HMAC key of the X-RTK-Signature header
+	MaxSubscriptions int      `mapstructure:"max_subscriptions"`
+}
+
+// AlertingConfig holds topology alert notification settings
+type AlertingConfig struct {
+	Timeout       string                    `mapstructure:"timeout"`        // per delivery attempt
+	RetryInterval string                    `mapstructure:"retry_interval"` // first retry delay, doubled on each attempt
+	MaxRetries    int                       `mapstructure:"max_retries"`
+	SMTP          SMTPConfig                `mapstructure:"smtp"`
+	Routes        []NotificationRouteConfig `mapstructure:"routes"`
+	RuleFiles     []string                  `mapstructure:"rule_files"`  // YAML alert rule files
+	WatchRules    bool                      `mapstructure:"watch_rules"` // reload rule files when they change
+
+	// Correlation: repeats of an open alert are folded into it, alerts of
+	// clients are grouped under their AP's offline alert, and alerts
+	// that keep raising and clearing hold their notifications
+	Deduplicate     bool   `mapstructure:"deduplicate"`
+	DedupWindow     string `mapstructure:"dedup_window"` // empty folds repeats while the alert is open
+	GroupByUpstream bool   `mapstructure:"group_by_upstream"`
+	FlapThreshold   int    `mapstructure:"flap_threshold"` // state changes within flap_window, 0 disables
+	FlapWindow      string `mapstructure:"flap_window"`
+}
+
+// SMTPConfig holds the mail server used by email notification routes
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"` // empty disables authentication
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+}
+
+// NotificationRouteConfig sends alerts matching its severity filter to one
+// target
+type NotificationRouteConfig struct {
+	Name        string            `mapstructure:"name"`
+	Type        string            `mapstructure:"type"`         // email, webhook, slack, syslog or mqtt
+	Target      string            `mapstructure:"target"`       // addresses, URL, udp://host:514 or MQTT topic
+	Severities  []string          `mapstructure:"severities"`   // only these severities, empty for any
+	MinSeverity string            `mapstructure:"min_severity"` // lowest severity sent, empty for any
+	Secret      string            `mapstructure:"secret"`       // HMAC key for webhook routes
+	Headers     map[string]string `mapstructure:"headers"`      // extra HTTP headers for webhook and slack routes
+	Disabled    bool              `mapstructure:"disabled"`
 }
 
 // AnalyzerConfig holds individual analyzer configuration
@@ -122,6 +224,7 @@ func LoadConfig(configPath string) (*Config, error) {
 		"rtk/v1/+/+/+/lwt",
 		"rtk/v1/+/+/+/cmd/ack",
 		"rtk/v1/+/+/+/cmd/res",
+		"rtk/v1/+/+/+/cmd/progress",
 		"rtk/v1/+/+/+/attr",
 	})
 	viper.SetDefault("mqtt.logging.enabled", true)
@@ -136,9 +239,12 @@ func LoadConfig(configPath string) (*Config, error) {
 
 	// API and Console defaults removed
 
+	viper.SetDefault("storage.backend", "buntdb")
 	viper.SetDefault("storage.path", "data")
 	viper.SetDefault("storage.backup_dir", "data/backups")
 	viper.SetDefault("storage.backup_count", 7)
+	viper.SetDefault("storage.backup_interval", "24h")
+	viper.SetDefault("storage.compact_interval", "6h")
 
 	viper.SetDefault("diagnosis.enabled", true)
 	viper.SetDefault("diagnosis.default_analyzers", []string{
@@ -151,11 +257,35 @@ func LoadConfig(configPath string) (*Config, error) {
 	viper.SetDefault("schema.schema_files", []string{
 		"wifi_diagnosis_schemas.json",
 	})
+	viper.SetDefault("schema.watch_dirs", true)
 	viper.SetDefault("schema.strict_validation", false)
 	viper.SetDefault("schema.log_validation_errors", true)
 	viper.SetDefault("schema.cache_results", true)
 	viper.SetDefault("schema.cache_size", 1000)
 	viper.SetDefault("schema.store_results", false)
+	viper.SetDefault("schema.dead_letter_max_entries", 10000)
+	viper.SetDefault("schema.dead_letter_ttl", "168h")
+
+	viper.SetDefault("commands.hold_offline", true)
+	viper.SetDefault("commands.hold_ttl", "24h")
+
+	viper.SetDefault("sites.default_tenant", "default")
+	viper.SetDefault("sites.default_site", "default")
+	viper.SetDefault("sites.max_sites", 0)
+
+	viper.SetDefault("alerting.timeout", "10s")
+	viper.SetDefault("alerting.retry_interval", "30s")
+	viper.SetDefault("alerting.max_retries", 5)
+	viper.SetDefault("alerting.smtp.port", 25)
+	viper.SetDefault("alerting.watch_rules", true)
+	viper.SetDefault("alerting.deduplicate", true)
+	viper.SetDefault("alerting.group_by_upstream", true)
+	viper.SetDefault("alerting.flap_threshold", 6)
+	viper.SetDefault("alerting.flap_window", "15m")
+
+	viper.SetDefault("topology_events.enabled", false)
+	viper.SetDefault("topology_events.publish_mqtt", true)
+	viper.SetDefault("topology_events.max_subscriptions", 100)
 
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
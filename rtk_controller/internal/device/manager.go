@@ -22,6 +22,9 @@ type Manager struct {
 	devices map[string]*types.DeviceState
 	mu      sync.RWMutex
 
+	// Site registry, keyed by "tenant:site"
+	sites map[string]*types.SiteInfo
+
 	// Background workers
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -38,6 +41,7 @@ func NewManager(storage storage.Storage) *Manager {
 	return &Manager{
 		storage: storage,
 		devices: make(map[string]*types.DeviceState),
+		sites:   make(map[string]*types.SiteInfo),
 		ctx:     ctx,
 		cancel:  cancel,
 		done:    make(chan struct{}),
@@ -54,11 +58,21 @@ func (m *Manager) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to load devices from storage: %w", err)
 	}
 
+	m.mu.Lock()
+	err := m.loadSitesFromStorage()
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to load sites from storage: %w", err)
+	}
+
 	// Start background workers
 	go m.deviceCleanupWorker()
 	go m.statsWorker()
 
-	log.WithField("device_count", len(m.devices)).Info("Device manager started")
+	log.WithFields(log.Fields{
+		"device_count": len(m.devices),
+		"site_count":   len(m.sites),
+	}).Info("Device manager started")
 	return nil
 }
 
@@ -140,6 +154,7 @@ func (m *Manager) getOrCreateDevice(tenant, site, deviceID string) *types.Device
 	}
 
 	m.devices[key] = device
+	m.addSiteLocked(tenant, site)
 	return device
 }
 
@@ -176,9 +191,50 @@ func (m *Manager) updateDeviceFromAttributes(device *types.DeviceState, data map
 		device.DeviceType = deviceType
 	}
 
+	if versions := supportedSchemaVersions(data); len(versions) > 0 {
+		device.SchemaVersions = versions
+	}
+
 	return nil
 }
 
+// supportedSchemaVersions returns the highest version per schema name that an
+// attr message announces, from its own schema field and its
+// "supported_schemas" list (top level or inside "payload")
+func supportedSchemaVersions(data map[string]interface{}) map[string]string {
+	fields := []interface{}{data["schema"]}
+	if supported, ok := data["supported_schemas"].([]interface{}); ok {
+		fields = append(fields, supported...)
+	}
+	if payload, ok := data["payload"].(map[string]interface{}); ok {
+		if supported, ok := payload["supported_schemas"].([]interface{}); ok {
+			fields = append(fields, supported...)
+		}
+	}
+
+	versions := make(map[string]string)
+	for _, f := range fields {
+		field, ok := f.(string)
+		if !ok {
+			continue
+		}
+		name, version := utils.SplitSchemaField(field)
+		if name == "" || version == "" {
+			continue
+		}
+		if _, err := utils.ParseSchemaVersion(version); err != nil {
+			continue
+		}
+		if current, exists := versions[name]; exists {
+			if cmp, _ := utils.CompareSchemaVersions(version, current); cmp <= 0 {
+				continue
+			}
+		}
+		versions[name] = version
+	}
+	return versions
+}
+
 // updateDeviceFromTelemetry updates device from telemetry message
 func (m *Manager) updateDeviceFromTelemetry(device *types.DeviceState, subParts []string, data map[string]interface{}) error {
 	if len(subParts) == 0 {
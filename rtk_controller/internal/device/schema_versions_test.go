@@ -0,0 +1,40 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rtk_controller/internal/storage"
+)
+
+func TestManager_TracksSchemaVersionsFromAttr(t *testing.T) {
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	manager := NewManager(store)
+
+	topic := "rtk/v1/office/floor1/ap1/attr"
+	require.NoError(t, manager.UpdateDeviceState(topic, []byte(`{
+		"schema": "attr/1.0",
+		"ts": 1,
+		"supported_schemas": ["state/1.0", "state/1.10", "state/1.2", "evt.wifi.roam_miss/1.0", "bogus", "state/x"],
+		"payload": {"supported_schemas": ["telemetry.wifi_clients/2.1"]}
+	}`)))
+
+	device, err := manager.GetDevice("office", "floor1", "ap1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"attr":                   "1.0",
+		"state":                  "1.10",
+		"evt.wifi.roam_miss":     "1.0",
+		"telemetry.wifi_clients": "2.1",
+	}, device.SchemaVersions)
+
+	// A firmware downgrade announces a lower version and replaces the old set
+	require.NoError(t, manager.UpdateDeviceState(topic, []byte(`{"schema":"attr/1.0","ts":2,"supported_schemas":["state/1.0"]}`)))
+	device, err = manager.GetDevice("office", "floor1", "ap1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"attr": "1.0", "state": "1.0"}, device.SchemaVersions)
+}
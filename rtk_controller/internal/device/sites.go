@@ -0,0 +1,184 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/types"
+	"rtk_controller/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// siteKeyPrefix prefixes the storage keys of registered sites
+const siteKeyPrefix = "site:"
+
+// RegisterSite adds a tenant site to the registry, or updates the display
+// name of a registered one. Sites are also registered automatically when
+// their first device reports.
+func (m *Manager) RegisterSite(tenant, site, name string) (*types.SiteInfo, error) {
+	if err := utils.ValidateTopicLevel("tenant", tenant); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateTopicLevel("site", site); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := m.addSiteLocked(tenant, site)
+	if name != "" && info.Name != name {
+		info.Name = name
+		if err := m.saveSite(info); err != nil {
+			return nil, err
+		}
+	}
+
+	infoCopy := *info
+	return &infoCopy, nil
+}
+
+// GetSite returns a registered site with its device counts
+func (m *Manager) GetSite(tenant, site string) (*types.SiteInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, exists := m.sites[tenant+":"+site]
+	if !exists {
+		return nil, fmt.Errorf("site not found: %s/%s", tenant, site)
+	}
+
+	infoCopy := *info
+	m.countSiteDevices(&infoCopy)
+	return &infoCopy, nil
+}
+
+// HasSite reports whether a tenant site is registered
+func (m *Manager) HasSite(tenant, site string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, exists := m.sites[tenant+":"+site]
+	return exists
+}
+
+// ListSites returns the registered sites of a tenant, or of every tenant
+// when tenant is empty, ordered by tenant and site
+func (m *Manager) ListSites(tenant string) []*types.SiteInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sites []*types.SiteInfo
+	for _, info := range m.sites {
+		if tenant != "" && info.Tenant != tenant {
+			continue
+		}
+		infoCopy := *info
+		m.countSiteDevices(&infoCopy)
+		sites = append(sites, &infoCopy)
+	}
+
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].Tenant != sites[j].Tenant {
+			return sites[i].Tenant < sites[j].Tenant
+		}
+		return sites[i].Site < sites[j].Site
+	})
+	return sites
+}
+
+// ListTenants returns the tenants that have registered sites
+func (m *Manager) ListTenants() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var tenants []string
+	for _, info := range m.sites {
+		if !seen[info.Tenant] {
+			seen[info.Tenant] = true
+			tenants = append(tenants, info.Tenant)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// addSiteLocked registers a site if it is new; m.mu must be held
+func (m *Manager) addSiteLocked(tenant, site string) *types.SiteInfo {
+	key := tenant + ":" + site
+	if info, exists := m.sites[key]; exists {
+		return info
+	}
+
+	info := &types.SiteInfo{
+		Tenant:    tenant,
+		Site:      site,
+		CreatedAt: time.Now(),
+	}
+	m.sites[key] = info
+
+	if err := m.saveSite(info); err != nil {
+		log.WithError(err).WithField("site", key).Warn("Failed to save site")
+	}
+	log.WithFields(log.Fields{
+		"tenant": tenant,
+		"site":   site,
+	}).Info("Site registered")
+	return info
+}
+
+// countSiteDevices fills in the device counts of a site; m.mu must be held
+func (m *Manager) countSiteDevices(info *types.SiteInfo) {
+	info.Devices, info.OnlineDevices = 0, 0
+	for _, device := range m.devices {
+		if device.Tenant == info.Tenant && device.Site == info.Site {
+			info.Devices++
+			if device.Online {
+				info.OnlineDevices++
+			}
+		}
+	}
+}
+
+func (m *Manager) saveSite(info *types.SiteInfo) error {
+	if m.storage == nil {
+		return nil
+	}
+
+	stored := *info
+	stored.Devices, stored.OnlineDevices = 0, 0
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal site: %w", err)
+	}
+	return m.storage.Set(fmt.Sprintf("%s%s:%s", siteKeyPrefix, info.Tenant, info.Site), string(data))
+}
+
+// loadSitesFromStorage loads registered sites and registers the sites of
+// devices loaded from storage
+func (m *Manager) loadSitesFromStorage() error {
+	err := m.storage.View(func(tx storage.Transaction) error {
+		return tx.IteratePrefix(siteKeyPrefix, func(key, value string) error {
+			var info types.SiteInfo
+			if err := json.Unmarshal([]byte(value), &info); err != nil {
+				log.WithError(err).Warnf("Failed to unmarshal site: %s", key)
+				return nil // Continue iteration
+			}
+			m.sites[info.Tenant+":"+info.Site] = &info
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, device := range m.devices {
+		m.addSiteLocked(device.Tenant, device.Site)
+	}
+	return nil
+}
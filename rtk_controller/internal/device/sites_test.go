@@ -0,0 +1,50 @@
+package device
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rtk_controller/internal/storage"
+)
+
+func TestManager_SiteRegistry(t *testing.T) {
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	manager := NewManager(store)
+	require.NoError(t, manager.UpdateDeviceState("rtk/v1/acme/hq/ap1/state", []byte(`{"health":"ok"}`)))
+	require.NoError(t, manager.UpdateDeviceState("rtk/v1/acme/hq/ap2/state", []byte(`{"health":"ok"}`)))
+	require.NoError(t, manager.UpdateDeviceState("rtk/v1/smith/home/gw1/state", []byte(`{"health":"ok"}`)))
+
+	_, err = manager.RegisterSite("acme", "branch", "Branch office")
+	require.NoError(t, err)
+	_, err = manager.RegisterSite("acme", "a:b", "")
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"acme", "smith"}, manager.ListTenants())
+	assert.True(t, manager.HasSite("smith", "home"))
+	assert.False(t, manager.HasSite("smith", "cabin"))
+
+	sites := manager.ListSites("acme")
+	require.Len(t, sites, 2)
+	assert.Equal(t, "branch", sites[0].Site)
+	assert.Equal(t, "Branch office", sites[0].Name)
+	assert.Equal(t, 0, sites[0].Devices)
+	assert.Equal(t, "hq", sites[1].Site)
+	assert.Equal(t, 2, sites[1].Devices)
+	assert.Equal(t, 2, sites[1].OnlineDevices)
+
+	// Registered sites survive a restart
+	reloaded := NewManager(store)
+	require.NoError(t, reloaded.Start(context.Background()))
+	defer reloaded.Stop()
+
+	info, err := reloaded.GetSite("acme", "branch")
+	require.NoError(t, err)
+	assert.Equal(t, "Branch office", info.Name)
+	assert.Len(t, reloaded.ListSites(""), 3)
+}
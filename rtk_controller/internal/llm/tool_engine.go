@@ -30,6 +30,7 @@ type ToolEngine struct {
 	commandManager  *command.Manager
 	topologyManager *topology.Manager
 	qosManager      *qos.QoSManager
+	sites           SiteManagers // per-site managers for tenant/site scoped tools
 
 	// Metrics collection
 	metricsCollector *MetricsCollector
@@ -88,6 +89,14 @@ func NewToolEngine(
 	}
 }
 
+// SetSiteManagers makes the topology and QoS tools resolve their optional
+// tenant/site parameters to per-site managers. Call it before Start.
+func (e *ToolEngine) SetSiteManagers(sites SiteManagers) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.sites = sites
+}
+
 // Start starts the tool engine
 func (e *ToolEngine) Start(ctx context.Context) error {
 	e.mutex.Lock()
@@ -386,26 +395,30 @@ type SessionOptions struct {
 // registerBuiltInTools registers the built-in diagnostic tools
 func (e *ToolEngine) registerBuiltInTools() error {
 	// Register topology tools
-	if e.topologyManager != nil {
+	if e.topologyManager != nil || e.sites != nil {
 		topologyGetFull := NewTopologyGetFullTool(e.topologyManager)
+		topologyGetFull.sites = e.sites
 		if err := e.RegisterTool(topologyGetFull); err != nil {
 			return fmt.Errorf("failed to register topology.get_full tool: %w", err)
 		}
 
 		clientsList := NewClientsListTool(e.topologyManager)
+		clientsList.sites = e.sites
 		if err := e.RegisterTool(clientsList); err != nil {
 			return fmt.Errorf("failed to register clients.list tool: %w", err)
 		}
 	}
 
 	// Register network/QoS tools
-	if e.qosManager != nil {
+	if e.qosManager != nil || e.sites != nil {
 		qosGetStatus := NewQoSGetStatusTool(e.qosManager)
+		qosGetStatus.sites = e.sites
 		if err := e.RegisterTool(qosGetStatus); err != nil {
 			return fmt.Errorf("failed to register qos.get_status tool: %w", err)
 		}
 
 		trafficGetStats := NewTrafficGetStatsTool(e.qosManager)
+		trafficGetStats.sites = e.sites
 		if err := e.RegisterTool(trafficGetStats); err != nil {
 			return fmt.Errorf("failed to register traffic.get_stats tool: %w", err)
 		}
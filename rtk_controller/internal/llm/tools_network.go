@@ -12,6 +12,7 @@ import (
 // QoSGetStatusTool implements the qos.get_status LLM tool
 type QoSGetStatusTool struct {
 	qosManager *qos.QoSManager
+	sites      SiteManagers // resolves the tenant/site parameters when set
 }
 
 // NewQoSGetStatusTool creates a new qos.get_status tool
@@ -41,6 +42,11 @@ func (q *QoSGetStatusTool) RequiredCapabilities() []string {
 	return []string{"qos_query"}
 }
 
+// SiteScoped reports that the tool takes the tenant/site parameters
+func (q *QoSGetStatusTool) SiteScoped() bool {
+	return true
+}
+
 // Validate validates the tool parameters
 func (q *QoSGetStatusTool) Validate(params map[string]interface{}) error {
 	// Optional device_id parameter
@@ -57,7 +63,7 @@ func (q *QoSGetStatusTool) Validate(params map[string]interface{}) error {
 		}
 	}
 
-	return nil
+	return validateSiteScope(params)
 }
 
 // Execute executes the tool
@@ -83,14 +89,22 @@ func (q *QoSGetStatusTool) Execute(ctx context.Context, params map[string]interf
 		}
 	}
 
-	// Get QoS information from the manager
-	qosInfo := q.qosManager.GetQoSInfo()
+	// Get QoS information from the site's manager
+	qosManager, err := qosManagerFor(q.sites, q.qosManager, params)
+	if err != nil {
+		result.Error = fmt.Sprintf("Failed to resolve site: %v", err)
+		return result, nil
+	}
+	qosInfo := qosManager.GetQoSInfo()
+	tenant, site := siteScope(params)
 
 	// Build response data
 	statusData := map[string]interface{}{
 		"device_id": deviceID,
 		"status":    qosInfo,
 		"metadata": map[string]interface{}{
+			"tenant":       tenant,
+			"site":         site,
 			"retrieved_at": getCurrentTime(),
 			"source":       "qos_manager",
 		},
@@ -98,7 +112,7 @@ func (q *QoSGetStatusTool) Execute(ctx context.Context, params map[string]interf
 
 	// Add recommendations if requested
 	if includeRecommendations {
-		recommendations := q.qosManager.GetRecommendations()
+		recommendations := qosManager.GetRecommendations()
 		statusData["recommendations"] = recommendations
 	}
 
@@ -111,6 +125,7 @@ func (q *QoSGetStatusTool) Execute(ctx context.Context, params map[string]interf
 // TrafficGetStatsTool implements the traffic.get_stats LLM tool
 type TrafficGetStatsTool struct {
 	qosManager *qos.QoSManager
+	sites      SiteManagers // resolves the tenant/site parameters when set
 }
 
 // NewTrafficGetStatsTool creates a new traffic.get_stats tool
@@ -140,6 +155,11 @@ func (t *TrafficGetStatsTool) RequiredCapabilities() []string {
 	return []string{"traffic_analysis"}
 }
 
+// SiteScoped reports that the tool takes the tenant/site parameters
+func (t *TrafficGetStatsTool) SiteScoped() bool {
+	return true
+}
+
 // Validate validates the tool parameters
 func (t *TrafficGetStatsTool) Validate(params map[string]interface{}) error {
 	// Optional device_id parameter
@@ -167,7 +187,7 @@ func (t *TrafficGetStatsTool) Validate(params map[string]interface{}) error {
 		}
 	}
 
-	return nil
+	return validateSiteScope(params)
 }
 
 // Execute executes the tool
@@ -200,8 +220,14 @@ func (t *TrafficGetStatsTool) Execute(ctx context.Context, params map[string]int
 		}
 	}
 
-	// Get traffic statistics from QoS manager via traffic analyzer
-	stats := t.qosManager.GetQoSInfo().TrafficStats
+	// Get traffic statistics from the site's QoS manager via traffic analyzer
+	qosManager, err := qosManagerFor(t.sites, t.qosManager, params)
+	if err != nil {
+		result.Error = fmt.Sprintf("Failed to resolve site: %v", err)
+		return result, nil
+	}
+	stats := qosManager.GetQoSInfo().TrafficStats
+	tenant, site := siteScope(params)
 
 	// Build response data
 	statsData := map[string]interface{}{
@@ -209,6 +235,8 @@ func (t *TrafficGetStatsTool) Execute(ctx context.Context, params map[string]int
 		"time_range": fmt.Sprintf("%.1f hours", timeRangeHours),
 		"statistics": stats,
 		"metadata": map[string]interface{}{
+			"tenant":       tenant,
+			"site":         site,
 			"retrieved_at": getCurrentTime(),
 			"source":       "qos_manager",
 		},
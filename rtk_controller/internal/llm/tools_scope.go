@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"fmt"
+
+	"rtk_controller/internal/qos"
+	"rtk_controller/internal/topology"
+)
+
+// SiteManagers resolves the topology and QoS managers of a tenant site.
+// tenancy.Registry implements it; an empty tenant or site selects the
+// default scope.
+type SiteManagers interface {
+	TopologyManager(tenant, site string) (*topology.Manager, error)
+	QoSManager(tenant, site string) (*qos.QoSManager, error)
+}
+
+// validateSiteScope validates the optional tenant and site parameters
+// accepted by site-scoped tools
+func validateSiteScope(params map[string]interface{}) error {
+	for _, name := range []string{"tenant", "site"} {
+		if val, exists := params[name]; exists {
+			if _, ok := val.(string); !ok {
+				return fmt.Errorf("%s must be a string", name)
+			}
+		}
+	}
+	return nil
+}
+
+// siteScope returns the tenant and site parameters, empty when not given
+func siteScope(params map[string]interface{}) (tenant, site string) {
+	tenant, _ = params["tenant"].(string)
+	site, _ = params["site"].(string)
+	return tenant, site
+}
+
+// topologyManagerFor returns the topology manager of the site named in
+// params, or the fixed manager when no site registry is set
+func topologyManagerFor(sites SiteManagers, manager *topology.Manager, params map[string]interface{}) (*topology.Manager, error) {
+	if sites == nil {
+		return manager, nil
+	}
+	return sites.TopologyManager(siteScope(params))
+}
+
+// qosManagerFor returns the QoS manager of the site named in params, or the
+// fixed manager when no site registry is set
+func qosManagerFor(sites SiteManagers, manager *qos.QoSManager, params map[string]interface{}) (*qos.QoSManager, error) {
+	if sites == nil {
+		return manager, nil
+	}
+	return sites.QoSManager(siteScope(params))
+}
@@ -11,6 +11,7 @@ import (
 // TopologyGetFullTool implements the topology.get_full LLM tool
 type TopologyGetFullTool struct {
 	topologyManager *topology.Manager
+	sites           SiteManagers // resolves the tenant/site parameters when set
 }
 
 // NewTopologyGetFullTool creates a new topology.get_full tool
@@ -40,11 +41,16 @@ func (t *TopologyGetFullTool) RequiredCapabilities() []string {
 	return []string{"topology_query"}
 }
 
+// SiteScoped reports that the tool takes the tenant/site parameters
+func (t *TopologyGetFullTool) SiteScoped() bool {
+	return true
+}
+
 // Validate validates the tool parameters
 func (t *TopologyGetFullTool) Validate(params map[string]interface{}) error {
-	// topology.get_full doesn't require any specific parameters
+	// topology.get_full only takes the optional tenant/site scope
 	// Optional parameters could be added later (e.g., include_offline_devices, detail_level)
-	return nil
+	return validateSiteScope(params)
 }
 
 // Execute executes the tool
@@ -55,8 +61,13 @@ func (t *TopologyGetFullTool) Execute(ctx context.Context, params map[string]int
 		Timestamp: getCurrentTime(),
 	}
 
-	// Get topology from the manager
-	topology, err := t.topologyManager.GetCurrentTopology()
+	// Get topology from the site's manager
+	manager, err := topologyManagerFor(t.sites, t.topologyManager, params)
+	if err != nil {
+		result.Error = fmt.Sprintf("Failed to resolve site: %v", err)
+		return result, nil
+	}
+	topology, err := manager.GetCurrentTopology()
 	if err != nil {
 		result.Error = fmt.Sprintf("Failed to retrieve topology: %v", err)
 		return result, nil
@@ -86,6 +97,7 @@ func (t *TopologyGetFullTool) Execute(ctx context.Context, params map[string]int
 // ClientsListTool implements the clients.list LLM tool
 type ClientsListTool struct {
 	topologyManager *topology.Manager
+	sites           SiteManagers // resolves the tenant/site parameters when set
 }
 
 // NewClientsListTool creates a new clients.list tool
@@ -115,6 +127,11 @@ func (c *ClientsListTool) RequiredCapabilities() []string {
 	return []string{"device_discovery"}
 }
 
+// SiteScoped reports that the tool takes the tenant/site parameters
+func (c *ClientsListTool) SiteScoped() bool {
+	return true
+}
+
 // Validate validates the tool parameters
 func (c *ClientsListTool) Validate(params map[string]interface{}) error {
 	// Optional parameters validation
@@ -130,7 +147,7 @@ func (c *ClientsListTool) Validate(params map[string]interface{}) error {
 		}
 	}
 
-	return nil
+	return validateSiteScope(params)
 }
 
 // Execute executes the tool
@@ -142,7 +159,12 @@ func (c *ClientsListTool) Execute(ctx context.Context, params map[string]interfa
 	}
 
 	// Get topology to access device information
-	topology, err := c.topologyManager.GetCurrentTopology()
+	manager, err := topologyManagerFor(c.sites, c.topologyManager, params)
+	if err != nil {
+		result.Error = fmt.Sprintf("Failed to resolve site: %v", err)
+		return result, nil
+	}
+	topology, err := manager.GetCurrentTopology()
 	if err != nil {
 		result.Error = fmt.Sprintf("Failed to retrieve topology: %v", err)
 		return result, nil
@@ -225,6 +247,8 @@ func (c *ClientsListTool) Execute(ctx context.Context, params map[string]interfa
 			},
 		},
 		"metadata": map[string]interface{}{
+			"tenant":       topology.Tenant,
+			"site":         topology.Site,
 			"retrieved_at": getCurrentTime(),
 			"source":       "topology_manager",
 		},
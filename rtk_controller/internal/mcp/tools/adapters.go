@@ -36,6 +36,9 @@ func NewToolAdapter(llmTool types.LLMTool, logger *logrus.Logger) *ToolAdapter {
 	adapter.description = llmTool.Description()
 	adapter.category = extractCategoryFromName(llmTool.Name())
 	adapter.parameters = generateDefaultParametersSchema(llmTool.Name())
+	if scoped, ok := llmTool.(types.SiteScopedTool); ok && scoped.SiteScoped() {
+		addSiteScopeParameters(adapter.parameters)
+	}
 
 	return adapter
 }
@@ -268,6 +271,18 @@ func generateDefaultParametersSchema(toolName string) map[string]interface{} {
 	return properties
 }
 
+// addSiteScopeParameters 為支援租戶/站點範圍的工具加入參數，未指定時使用控制器預設範圍
+func addSiteScopeParameters(properties map[string]interface{}) {
+	properties["tenant"] = map[string]interface{}{
+		"type":        "string",
+		"description": "Tenant of the site to query (defaults to the controller's default tenant)",
+	}
+	properties["site"] = map[string]interface{}{
+		"type":        "string",
+		"description": "Site to query (defaults to the controller's default site)",
+	}
+}
+
 // MCPTool MCP 工具定義
 type MCPTool struct {
 	Name        string         `json:"name"`
@@ -54,6 +54,11 @@ type Client struct {
 	deviceManager   DeviceManager
 	eventProcessor  EventProcessor
 	schemaValidator SchemaValidator
+
+	// Strict validation keeps invalid messages out of processing and
+	// parks them in the dead-letter store
+	strictValidation bool
+	deadLetters      *DeadLetterStore
 }
 
 // MessageHandler defines the interface for handling MQTT messages
@@ -68,6 +73,7 @@ func NewClient(cfg config.MQTTConfig, storage storage.Storage) (*Client, error)
 		storage:  storage,
 		handlers: make(map[string]MessageHandler),
 	}
+	client.deadLetters = NewDeadLetterStore(storage)
 
 	// Initialize message logger if enabled
 	if cfg.Logging.Enabled {
@@ -253,6 +259,19 @@ func (c *Client) SetSchemaValidator(sv SchemaValidator) {
 	c.schemaValidator = sv
 }
 
+// SetStrictValidation controls whether messages that fail schema validation
+// are dead-lettered instead of processed
+func (c *Client) SetStrictValidation(strict bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.strictValidation = strict
+}
+
+// GetDeadLetterStore returns the store holding messages rejected by strict validation
+func (c *Client) GetDeadLetterStore() *DeadLetterStore {
+	return c.deadLetters
+}
+
 // defaultMessageHandler handles incoming MQTT messages
 func (c *Client) defaultMessageHandler(client mqtt.Client, msg mqtt.Message) {
 	topic := msg.Topic()
@@ -267,8 +286,10 @@ func (c *Client) defaultMessageHandler(client mqtt.Client, msg mqtt.Message) {
 	// Validate message using schema validator if enabled
 	c.mu.RLock()
 	schemaValidator := c.schemaValidator
+	strict := c.strictValidation
 	c.mu.RUnlock()
 
+	var rejected *ValidationResult
 	if schemaValidator != nil {
 		validationResult, err := schemaValidator.ValidateMessage(topic, payload)
 		if err != nil {
@@ -276,15 +297,14 @@ func (c *Client) defaultMessageHandler(client mqtt.Client, msg mqtt.Message) {
 				"topic": topic,
 				"error": err,
 			}).Error("Schema validation error")
+			rejected = &ValidationResult{Valid: false, Errors: []string{err.Error()}}
 		} else if !validationResult.Valid {
 			log.WithFields(log.Fields{
 				"topic":  topic,
 				"schema": validationResult.Schema,
 				"errors": validationResult.Errors,
 			}).Warn("Message failed schema validation")
-
-			// For strict validation, we could skip processing invalid messages
-			// For now, we log the validation failure and continue processing
+			rejected = validationResult
 		} else {
 			log.WithFields(log.Fields{
 				"topic":  topic,
@@ -300,6 +320,29 @@ func (c *Client) defaultMessageHandler(client mqtt.Client, msg mqtt.Message) {
 		}
 	}
 
+	// In strict mode invalid messages go to the dead-letter store instead
+	if strict && rejected != nil {
+		letter, err := c.deadLetters.Add(topic, payload, msg.Qos(), msg.Retained(), rejected.Schema, rejected.Errors)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"topic": topic,
+				"error": err,
+			}).Error("Failed to dead-letter invalid message")
+			return
+		}
+		log.WithFields(log.Fields{
+			"topic":       topic,
+			"dead_letter": letter.ID,
+		}).Warn("Message rejected by strict schema validation")
+		return
+	}
+
+	c.dispatch(topic, payload)
+}
+
+// dispatch hands a message to the device manager, event processor and any
+// matching handlers
+func (c *Client) dispatch(topic string, payload []byte) {
 	// Process device state updates and events
 	c.mu.RLock()
 	deviceManager := c.deviceManager
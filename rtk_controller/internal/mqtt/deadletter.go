@@ -0,0 +1,285 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"rtk_controller/internal/config"
+	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/utils"
+)
+
+const deadLetterPrefix = "mqtt_deadletter:"
+
+// DeadLetter is a message that strict schema validation kept away from the
+// device manager, event processor and handlers
+type DeadLetter struct {
+	ID         string   `json:"id"`
+	Topic      string   `json:"topic"`
+	Payload    string   `json:"payload"`
+	QoS        byte     `json:"qos"`
+	Retained   bool     `json:"retained"`
+	Schema     string   `json:"schema,omitempty"`
+	Errors     []string `json:"errors"`
+	ReceivedAt int64    `json:"received_at"`
+
+	// Replay bookkeeping; a successful replay removes the dead letter
+	ReplayCount      int      `json:"replay_count"`
+	LastReplayAt     int64    `json:"last_replay_at,omitempty"`
+	LastReplayErrors []string `json:"last_replay_errors,omitempty"`
+}
+
+// DeadLetterStore persists rejected messages so they can be inspected and
+// replayed once the schema or the sender is fixed
+type DeadLetterStore struct {
+	storage storage.Storage
+
+	mu         sync.Mutex // guards the limits and the index
+	maxEntries int
+	ttl        time.Duration
+
+	// index lists the stored dead letters oldest first, so enforcing the
+	// cap and TTL does not rescan storage on every Add. It is loaded from
+	// storage the first time a limit applies.
+	index   []deadLetterRef
+	indexed bool
+}
+
+type deadLetterRef struct {
+	id         string
+	receivedAt int64
+}
+
+// NewDeadLetterStore creates a dead-letter store on top of storage
+func NewDeadLetterStore(storage storage.Storage) *DeadLetterStore {
+	return &DeadLetterStore{storage: storage}
+}
+
+// ApplyConfig loads the dead-letter cap and retention
+func (s *DeadLetterStore) ApplyConfig(cfg config.SchemaConfig) error {
+	if cfg.DeadLetterMaxEntries < 0 {
+		return fmt.Errorf("invalid schema.dead_letter_max_entries: %d", cfg.DeadLetterMaxEntries)
+	}
+	var ttl time.Duration
+	if cfg.DeadLetterTTL != "" {
+		d, err := time.ParseDuration(cfg.DeadLetterTTL)
+		if err != nil {
+			return fmt.Errorf("invalid schema.dead_letter_ttl: %w", err)
+		}
+		ttl = d
+	}
+
+	s.mu.Lock()
+	s.maxEntries = cfg.DeadLetterMaxEntries
+	s.ttl = ttl
+	s.mu.Unlock()
+	return nil
+}
+
+// Add stores a rejected message and returns its dead-letter entry. Expired
+// entries and the oldest ones beyond the cap are dropped to make room.
+func (s *DeadLetterStore) Add(topic string, payload []byte, qos byte, retained bool, schema string, errors []string) (*DeadLetter, error) {
+	letter := &DeadLetter{
+		ID:         utils.GenerateMessageID(),
+		Topic:      topic,
+		Payload:    string(payload),
+		QoS:        qos,
+		Retained:   retained,
+		Schema:     schema,
+		Errors:     errors,
+		ReceivedAt: time.Now().UnixMilli(),
+	}
+	if err := s.save(letter); err != nil {
+		return nil, err
+	}
+	if err := s.track(letter, time.Now()); err != nil {
+		log.WithError(err).Warn("Failed to prune dead letters")
+	}
+	return letter, nil
+}
+
+// track records a newly stored dead letter in the index and prunes
+func (s *DeadLetterStore) track(letter *DeadLetter, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.indexed:
+		s.insert(deadLetterRef{id: letter.ID, receivedAt: letter.ReceivedAt})
+	case s.maxEntries == 0 && s.ttl == 0:
+		return nil
+	default:
+		// The freshly saved letter is part of the loaded index
+		if err := s.loadIndex(); err != nil {
+			return err
+		}
+	}
+	return s.prune(now)
+}
+
+// loadIndex builds the index from storage. The caller holds s.mu.
+func (s *DeadLetterStore) loadIndex() error {
+	letters, err := s.List("")
+	if err != nil {
+		return err
+	}
+	s.index = make([]deadLetterRef, 0, len(letters))
+	for _, letter := range letters {
+		s.index = append(s.index, deadLetterRef{id: letter.ID, receivedAt: letter.ReceivedAt})
+	}
+	s.indexed = true
+	return nil
+}
+
+// insert adds ref in ReceivedAt order; new letters normally go at the end.
+// The caller holds s.mu.
+func (s *DeadLetterStore) insert(ref deadLetterRef) {
+	i := sort.Search(len(s.index), func(i int) bool { return s.index[i].receivedAt > ref.receivedAt })
+	s.index = slices.Insert(s.index, i, ref)
+}
+
+// prune drops dead letters older than the TTL, then the oldest ones beyond
+// the cap. The caller holds s.mu.
+func (s *DeadLetterStore) prune(now time.Time) error {
+	drop := 0
+	if s.ttl > 0 {
+		cutoff := now.Add(-s.ttl).UnixMilli()
+		for drop < len(s.index) && s.index[drop].receivedAt < cutoff {
+			drop++
+		}
+	}
+	if s.maxEntries > 0 && len(s.index)-drop > s.maxEntries {
+		drop = len(s.index) - s.maxEntries
+	}
+
+	for i, ref := range s.index[:drop] {
+		if err := s.storage.Delete(deadLetterPrefix + ref.id); err != nil {
+			s.index = slices.Delete(s.index, 0, i)
+			return fmt.Errorf("failed to delete dead letter %s: %w", ref.id, err)
+		}
+	}
+	s.index = slices.Delete(s.index, 0, drop)
+	if drop > 0 {
+		log.WithField("count", drop).Debug("Dropped old dead letters")
+	}
+	return nil
+}
+
+// Get returns the dead letter with the given ID
+func (s *DeadLetterStore) Get(id string) (*DeadLetter, error) {
+	data, err := s.storage.Get(deadLetterPrefix + id)
+	if err != nil {
+		return nil, fmt.Errorf("dead letter not found: %s", id)
+	}
+
+	var letter DeadLetter
+	if err := json.Unmarshal([]byte(data), &letter); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+	}
+	return &letter, nil
+}
+
+// List returns dead letters, oldest first. A non-empty topicFilter limits
+// the result to topics matching it (MQTT wildcards allowed).
+func (s *DeadLetterStore) List(topicFilter string) ([]*DeadLetter, error) {
+	var letters []*DeadLetter
+	err := s.storage.View(func(tx storage.Transaction) error {
+		return tx.IteratePrefix(deadLetterPrefix, func(key, value string) error {
+			var letter DeadLetter
+			if err := json.Unmarshal([]byte(value), &letter); err != nil {
+				return nil // Skip invalid entries
+			}
+			if topicFilter != "" && !utils.TopicMatches(topicFilter, letter.Topic) {
+				return nil
+			}
+			letters = append(letters, &letter)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].ReceivedAt != letters[j].ReceivedAt {
+			return letters[i].ReceivedAt < letters[j].ReceivedAt
+		}
+		return letters[i].ID < letters[j].ID
+	})
+	return letters, nil
+}
+
+// Delete removes a dead letter
+func (s *DeadLetterStore) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if err := s.storage.Delete(deadLetterPrefix + id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := slices.IndexFunc(s.index, func(ref deadLetterRef) bool { return ref.id == id }); i >= 0 {
+		s.index = slices.Delete(s.index, i, i+1)
+	}
+	return nil
+}
+
+func (s *DeadLetterStore) save(letter *DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+	if err := s.storage.Set(deadLetterPrefix+letter.ID, string(data)); err != nil {
+		return fmt.Errorf("failed to store dead letter: %w", err)
+	}
+	return nil
+}
+
+// ReplayDeadLetter validates a dead-lettered message against the current
+// schemas and, if it now passes, processes it as if it had just arrived and
+// removes it from the store. A message that still fails stays dead-lettered
+// with the new errors recorded; the returned result carries them.
+func (c *Client) ReplayDeadLetter(id string) (*ValidationResult, error) {
+	letter, err := c.deadLetters.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	schemaValidator := c.schemaValidator
+	c.mu.RUnlock()
+
+	if schemaValidator == nil {
+		return nil, fmt.Errorf("no schema validator configured")
+	}
+
+	payload := []byte(letter.Payload)
+	result, err := schemaValidator.ValidateMessage(letter.Topic, payload)
+	if err != nil {
+		result = &ValidationResult{Valid: false, Errors: []string{err.Error()}, Schema: letter.Schema}
+	}
+
+	if !result.Valid {
+		letter.ReplayCount++
+		letter.LastReplayAt = time.Now().UnixMilli()
+		letter.LastReplayErrors = result.Errors
+		if err := c.deadLetters.save(letter); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if err := c.deadLetters.Delete(id); err != nil {
+		return nil, err
+	}
+	c.dispatch(letter.Topic, payload)
+	return result, nil
+}
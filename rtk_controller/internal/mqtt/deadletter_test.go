@@ -0,0 +1,250 @@
+package mqtt
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rtk_controller/internal/config"
+	"rtk_controller/internal/storage"
+)
+
+type testMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m *testMessage) Duplicate() bool   { return false }
+func (m *testMessage) Qos() byte         { return 1 }
+func (m *testMessage) Retained() bool    { return false }
+func (m *testMessage) Topic() string     { return m.topic }
+func (m *testMessage) MessageID() uint16 { return 1 }
+func (m *testMessage) Payload() []byte   { return m.payload }
+func (m *testMessage) Ack()              {}
+
+// testValidator rejects payloads containing any of the listed markers
+type testValidator struct {
+	mu      sync.Mutex
+	invalid []string
+}
+
+func (v *testValidator) ValidateMessage(topic string, payload []byte) (*ValidationResult, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, marker := range v.invalid {
+		if strings.Contains(string(payload), marker) {
+			return &ValidationResult{Valid: false, Schema: "state", Errors: []string{"bad field " + marker}}, nil
+		}
+	}
+	return &ValidationResult{Valid: true, Schema: "state"}, nil
+}
+
+func (v *testValidator) setInvalid(markers ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.invalid = markers
+}
+
+type recordingTarget struct {
+	mu     sync.Mutex
+	topics []string
+}
+
+func (r *recordingTarget) UpdateDeviceState(topic string, payload []byte) error {
+	return r.HandleMessage(topic, payload)
+}
+
+func (r *recordingTarget) ProcessEvent(topic string, payload []byte) error {
+	return r.HandleMessage(topic, payload)
+}
+
+func (r *recordingTarget) HandleMessage(topic string, payload []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.topics = append(r.topics, topic)
+	return nil
+}
+
+func (r *recordingTarget) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.topics...)
+}
+
+func setupDeadLetterTest(t *testing.T, strict bool) (*Client, *testValidator, *recordingTarget, *recordingTarget) {
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	client, err := NewClient(config.MQTTConfig{Broker: "localhost", Port: 1883, ClientID: "test-client"}, store)
+	require.NoError(t, err)
+
+	validator := &testValidator{invalid: []string{"bogus"}}
+	devices := &recordingTarget{}
+	handler := &recordingTarget{}
+	client.SetSchemaValidator(validator)
+	client.SetDeviceManager(devices)
+	client.SetEventProcessor(devices)
+	client.RegisterHandler("rtk/v1/#", handler)
+	client.SetStrictValidation(strict)
+	return client, validator, devices, handler
+}
+
+func TestClient_StrictValidationDeadLetters(t *testing.T) {
+	client, _, devices, handler := setupDeadLetterTest(t, true)
+
+	state := "rtk/v1/office/floor1/ap1/state"
+	client.defaultMessageHandler(nil, &testMessage{topic: state, payload: []byte(`{"health":"ok"}`)})
+	client.defaultMessageHandler(nil, &testMessage{topic: state, payload: []byte(`{"health":"bogus"}`)})
+	client.defaultMessageHandler(nil, &testMessage{topic: "rtk/v1/office/floor1/ap1/evt/alarm", payload: []byte(`{"bogus":1}`)})
+
+	assert.Equal(t, []string{state}, devices.received(), "invalid messages must not reach the device manager or event processor")
+	assert.Equal(t, []string{state}, handler.received(), "invalid messages must not reach handlers")
+
+	letters, err := client.GetDeadLetterStore().List("")
+	require.NoError(t, err)
+	assert.Len(t, letters, 2)
+
+	states, err := client.GetDeadLetterStore().List("rtk/v1/+/+/+/state")
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, state, states[0].Topic)
+	assert.Equal(t, `{"health":"bogus"}`, states[0].Payload)
+	assert.Equal(t, "state", states[0].Schema)
+	assert.Equal(t, []string{"bad field bogus"}, states[0].Errors)
+
+	events, err := client.GetDeadLetterStore().List("rtk/v1/+/+/+/evt/#")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "rtk/v1/office/floor1/ap1/evt/alarm", events[0].Topic)
+}
+
+func TestClient_NonStrictValidationProcessesInvalid(t *testing.T) {
+	client, _, devices, handler := setupDeadLetterTest(t, false)
+
+	state := "rtk/v1/office/floor1/ap1/state"
+	client.defaultMessageHandler(nil, &testMessage{topic: state, payload: []byte(`{"health":"bogus"}`)})
+
+	assert.Equal(t, []string{state}, devices.received())
+	assert.Equal(t, []string{state}, handler.received())
+	letters, err := client.GetDeadLetterStore().List("")
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func TestClient_ReplayDeadLetter(t *testing.T) {
+	client, validator, devices, handler := setupDeadLetterTest(t, true)
+
+	state := "rtk/v1/office/floor1/ap1/state"
+	client.defaultMessageHandler(nil, &testMessage{topic: state, payload: []byte(`{"health":"bogus"}`)})
+	letters, err := client.GetDeadLetterStore().List("")
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	id := letters[0].ID
+
+	// Still invalid: stays dead-lettered with the replay recorded
+	result, err := client.ReplayDeadLetter(id)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	letter, err := client.GetDeadLetterStore().Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, letter.ReplayCount)
+	assert.Equal(t, []string{"bad field bogus"}, letter.LastReplayErrors)
+	assert.Empty(t, devices.received())
+
+	// After the schema fix the message is processed and removed
+	validator.setInvalid()
+	result, err = client.ReplayDeadLetter(id)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, []string{state}, devices.received())
+	assert.Equal(t, []string{state}, handler.received())
+
+	_, err = client.GetDeadLetterStore().Get(id)
+	assert.Error(t, err)
+	_, err = client.ReplayDeadLetter(id)
+	assert.Error(t, err)
+}
+
+func TestDeadLetterStore_CapAndTTL(t *testing.T) {
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	letters := NewDeadLetterStore(store)
+	require.NoError(t, letters.ApplyConfig(config.SchemaConfig{DeadLetterMaxEntries: 3, DeadLetterTTL: "1h"}))
+
+	// An entry past the TTL is dropped on the next add
+	expired := &DeadLetter{ID: "expired", Topic: "rtk/v1/a/b/old/state", ReceivedAt: time.Now().Add(-2 * time.Hour).UnixMilli()}
+	require.NoError(t, letters.save(expired))
+
+	var topics []string
+	for _, device := range []string{"dev1", "dev2", "dev3", "dev4", "dev5"} {
+		topic := "rtk/v1/a/b/" + device + "/state"
+		topics = append(topics, topic)
+		_, err := letters.Add(topic, []byte(`{}`), 0, false, "state", []string{"invalid"})
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// Only the newest entries within the cap remain
+	remaining, err := letters.List("")
+	require.NoError(t, err)
+	var got []string
+	for _, letter := range remaining {
+		got = append(got, letter.Topic)
+	}
+	assert.Equal(t, topics[2:], got)
+
+	assert.Error(t, letters.ApplyConfig(config.SchemaConfig{DeadLetterTTL: "forever"}))
+	assert.Error(t, letters.ApplyConfig(config.SchemaConfig{DeadLetterMaxEntries: -1}))
+}
+
+// countingStorage counts full scans of the underlying storage
+type countingStorage struct {
+	storage.Storage
+	mu    sync.Mutex
+	views int
+}
+
+func (s *countingStorage) View(fn func(tx storage.Transaction) error) error {
+	s.mu.Lock()
+	s.views++
+	s.mu.Unlock()
+	return s.Storage.View(fn)
+}
+
+func TestDeadLetterStore_CapWithoutRescan(t *testing.T) {
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	counting := &countingStorage{Storage: store}
+	letters := NewDeadLetterStore(counting)
+	require.NoError(t, letters.ApplyConfig(config.SchemaConfig{DeadLetterMaxEntries: 3}))
+
+	var ids []string
+	for i := 0; i < 10; i++ {
+		letter, err := letters.Add("rtk/v1/a/b/dev1/state", []byte(`{}`), 0, false, "state", []string{"invalid"})
+		require.NoError(t, err)
+		ids = append(ids, letter.ID)
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.Equal(t, 1, counting.views, "storage is only scanned to build the index")
+
+	// A deleted letter no longer counts against the cap
+	require.NoError(t, letters.Delete(ids[9]))
+	_, err = letters.Add("rtk/v1/a/b/dev2/state", []byte(`{}`), 0, false, "state", []string{"invalid"})
+	require.NoError(t, err)
+
+	remaining, err := letters.List("")
+	require.NoError(t, err)
+	require.Len(t, remaining, 3)
+	assert.Equal(t, ids[7], remaining[0].ID)
+	assert.Equal(t, ids[8], remaining[1].ID)
+	assert.Equal(t, "rtk/v1/a/b/dev2/state", remaining[2].Topic)
+}
@@ -263,9 +263,15 @@ func (ml *MessageLogger) GetStats() *LoggingStats {
 
 // QueryMessages queries messages from storage
 func (ml *MessageLogger) QueryMessages(startTime, endTime int64, filters map[string]string, limit int) ([]*MQTTMessageLog, error) {
+	return QueryMessageLog(ml.storage, startTime, endTime, filters, limit)
+}
+
+// QueryMessageLog queries logged messages between two Unix millisecond
+// timestamps from a store, without a running logger
+func QueryMessageLog(s storage.Storage, startTime, endTime int64, filters map[string]string, limit int) ([]*MQTTMessageLog, error) {
 	var messages []*MQTTMessageLog
 
-	err := ml.storage.View(func(tx storage.Transaction) error {
+	err := s.View(func(tx storage.Transaction) error {
 		// Create iterator for time range
 		startKey := fmt.Sprintf("mqtt_log:%d:", startTime)
 		endKey := fmt.Sprintf("mqtt_log:%d:", endTime+1)
@@ -278,7 +284,7 @@ func (ml *MessageLogger) QueryMessages(startTime, endTime int64, filters map[str
 			}
 
 			// Apply filters
-			if ml.applyFilters(&msg, filters) {
+			if applyFilters(&msg, filters) {
 				messages = append(messages, &msg)
 
 				// Check limit
@@ -295,7 +301,7 @@ func (ml *MessageLogger) QueryMessages(startTime, endTime int64, filters map[str
 }
 
 // applyFilters checks if a message matches the given filters
-func (ml *MessageLogger) applyFilters(msg *MQTTMessageLog, filters map[string]string) bool {
+func applyFilters(msg *MQTTMessageLog, filters map[string]string) bool {
 	for key, value := range filters {
 		switch key {
 		case "topic_filter":
@@ -3,10 +3,12 @@ package schema
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	log "github.com/sirupsen/logrus"
 
 	"rtk_controller/internal/storage"
@@ -25,17 +27,44 @@ type Manager struct {
 	// Validation results cache (optional)
 	resultCache map[string]*ValidationResult
 	cacheSize   int
+
+	// Schema versions registered at runtime and deprecation changes, kept
+	// so that reloads preserve them
+	runtimeVersions []runtimeVersion
+	deprecations    map[string]bool
+
+	// Hot reload; generation increments on every validator swap so that
+	// results computed by a replaced validator are never cached
+	generation     uint64
+	reloadMu       sync.Mutex
+	reloadDebounce time.Duration
+	reloadStatus   ReloadStatus
+	alertHandler   func(*SchemaAlert)
+	watcher        *fsnotify.Watcher
+	stopWatch      chan struct{}
 }
 
 // Config holds schema validation configuration
 type Config struct {
 	Enabled             bool     `json:"enabled"`
 	SchemaFiles         []string `json:"schema_files"`
+	SchemaDirs          []string `json:"schema_dirs"`
+	WatchDirs           bool     `json:"watch_dirs"`
 	StrictValidation    bool     `json:"strict_validation"`
 	LogValidationErrors bool     `json:"log_validation_errors"`
 	CacheResults        bool     `json:"cache_results"`
 	CacheSize           int      `json:"cache_size"`
 	StoreResults        bool     `json:"store_results"`
+
+	Versions []VersionConfig `json:"versions"`
+}
+
+// VersionConfig registers a schema file for an announced schema name and version
+type VersionConfig struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	File       string `json:"file"`
+	Deprecated bool   `json:"deprecated"`
 }
 
 // ValidationStats holds validation statistics
@@ -60,7 +89,9 @@ func NewManager(config Config, storage storage.Storage) (*Manager, error) {
 			SchemaStats: make(map[string]int64),
 			ErrorStats:  make(map[string]int64),
 		},
-		cacheSize: config.CacheSize,
+		cacheSize:      config.CacheSize,
+		deprecations:   make(map[string]bool),
+		reloadDebounce: defaultReloadDebounce,
 	}
 
 	if config.CacheResults && config.CacheSize > 0 {
@@ -79,22 +110,26 @@ func (m *Manager) Initialize() error {
 
 	log.Info("Initializing JSON schema validation")
 
-	// Load built-in schemas
-	if err := m.validator.LoadBuiltinSchemas(); err != nil {
-		return fmt.Errorf("failed to load built-in schemas: %w", err)
+	validator, loadErrs, err := m.buildValidator()
+	if err != nil {
+		return err
+	}
+	if len(loadErrs) > 0 {
+		if m.config.StrictValidation {
+			return fmt.Errorf("failed to load schemas: %w", loadErrs[0])
+		}
+		m.raiseAlert("Some schema files failed to load and were skipped", loadErrs)
 	}
+	m.swapValidator(validator)
 
-	// Load external schema files
-	for _, schemaFile := range m.config.SchemaFiles {
-		if err := m.loadSchemaFile(schemaFile); err != nil {
-			log.WithError(err).WithField("file", schemaFile).Error("Failed to load schema file")
-			if m.config.StrictValidation {
-				return fmt.Errorf("failed to load schema file %s: %w", schemaFile, err)
-			}
+	// Watch schema directories for hot reload
+	if m.config.WatchDirs && len(m.config.SchemaDirs) > 0 {
+		if err := m.startWatcher(); err != nil {
+			log.WithError(err).Warn("Failed to watch schema directories, hot reload disabled")
 		}
 	}
 
-	schemas := m.validator.GetLoadedSchemas()
+	schemas := validator.GetLoadedSchemas()
 	log.WithField("schemas", schemas).Info("Schema validation initialized")
 
 	return nil
@@ -114,10 +149,15 @@ func (m *Manager) ValidateMessage(topic string, payload []byte) (*ValidationResu
 	m.stats.LastValidation = startTime
 	m.mu.Unlock()
 
+	validator, generation := m.current()
+
 	// Check cache first (if enabled)
 	cacheKey := m.getCacheKey(topic, payload)
-	if m.config.CacheResults && m.resultCache != nil {
-		if cached, exists := m.resultCache[cacheKey]; exists {
+	if m.config.CacheResults {
+		m.mu.RLock()
+		cached, exists := m.resultCache[cacheKey]
+		m.mu.RUnlock()
+		if exists {
 			return cached, nil
 		}
 	}
@@ -127,14 +167,14 @@ func (m *Manager) ValidateMessage(topic string, payload []byte) (*ValidationResu
 	var err error
 
 	// Try topic-based validation
-	result, err = m.validator.ValidateByTopic(topic, payload)
+	result, err = validator.ValidateByTopic(topic, payload)
 	if err != nil {
 		return nil, fmt.Errorf("topic-based validation failed: %w", err)
 	}
 
 	// If no schema matched from topic, try schema field validation
 	if result.Schema == "unknown" || result.Schema == "no_schema" {
-		schemaResult, schemaErr := m.validator.ValidateBySchemaField(payload)
+		schemaResult, schemaErr := validator.ValidateBySchemaField(payload)
 		if schemaErr == nil && schemaResult.Schema != "no_schema" {
 			result = schemaResult
 		}
@@ -153,8 +193,8 @@ func (m *Manager) ValidateMessage(topic string, payload []byte) (*ValidationResu
 	}
 
 	// Cache result if enabled
-	if m.config.CacheResults && m.resultCache != nil {
-		m.cacheResult(cacheKey, result)
+	if m.config.CacheResults {
+		m.cacheResult(cacheKey, result, generation)
 	}
 
 	// Store result if enabled
@@ -181,7 +221,8 @@ func (m *Manager) ValidateJSON(schemaName string, jsonData []byte) (*ValidationR
 		return &ValidationResult{Valid: true, Schema: "disabled"}, nil
 	}
 
-	result, err := m.validator.Validate(schemaName, jsonData)
+	validator, _ := m.current()
+	result, err := validator.Validate(schemaName, jsonData)
 	if err != nil {
 		return nil, err
 	}
@@ -220,49 +261,12 @@ func (m *Manager) GetStats() *ValidationStats {
 
 // GetLoadedSchemas returns list of loaded schemas
 func (m *Manager) GetLoadedSchemas() []string {
-	return m.validator.GetLoadedSchemas()
-}
-
-// ReloadSchemas reloads all schemas
-func (m *Manager) ReloadSchemas() error {
-	log.Info("Reloading JSON schemas")
-
-	// Create new validator
-	newValidator := NewValidator()
-
-	// Load built-in schemas
-	if err := newValidator.LoadBuiltinSchemas(); err != nil {
-		return fmt.Errorf("failed to reload built-in schemas: %w", err)
-	}
-
-	// Load external schema files
-	for _, schemaFile := range m.config.SchemaFiles {
-		if err := m.loadSchemaFileToValidator(newValidator, schemaFile); err != nil {
-			log.WithError(err).WithField("file", schemaFile).Error("Failed to reload schema file")
-			if m.config.StrictValidation {
-				return fmt.Errorf("failed to reload schema file %s: %w", schemaFile, err)
-			}
-		}
-	}
-
-	// Replace validator
-	m.validator = newValidator
-
-	// Clear cache
-	if m.resultCache != nil {
-		m.resultCache = make(map[string]*ValidationResult)
-	}
-
-	log.Info("Schemas reloaded successfully")
-	return nil
+	validator, _ := m.current()
+	return validator.GetLoadedSchemas()
 }
 
 // Private methods
 
-func (m *Manager) loadSchemaFile(filePath string) error {
-	return m.loadSchemaFileToValidator(m.validator, filePath)
-}
-
 func (m *Manager) loadSchemaFileToValidator(validator *Validator, filePath string) error {
 	// Check file extension to determine loading method
 	ext := filepath.Ext(filePath)
@@ -297,12 +301,22 @@ func (m *Manager) updateStats(result *ValidationResult) {
 }
 
 func (m *Manager) getCacheKey(topic string, payload []byte) string {
-	// Simple cache key based on topic and payload hash
-	// For production, consider using a proper hash function
-	return fmt.Sprintf("%s_%d", topic, len(payload))
+	// Key on the payload content, not just its size: with strict validation
+	// a cached verdict decides whether a message is processed at all
+	h := fnv.New64a()
+	h.Write(payload)
+	return fmt.Sprintf("%s_%x", topic, h.Sum64())
 }
 
-func (m *Manager) cacheResult(key string, result *ValidationResult) {
+func (m *Manager) cacheResult(key string, result *ValidationResult, generation uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Drop results computed by a validator that has since been replaced
+	if m.resultCache == nil || generation != m.generation {
+		return
+	}
+
 	// Implement simple LRU-like cache
 	if len(m.resultCache) >= m.cacheSize {
 		// Remove oldest entry (simple implementation)
@@ -0,0 +1,306 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultReloadDebounce collects the burst of events a file copy or editor
+// save produces into a single reload
+const defaultReloadDebounce = 500 * time.Millisecond
+
+// SchemaAlert is raised when schema files fail to load. On a reload the
+// previous validator set stays active until a later reload succeeds.
+type SchemaAlert struct {
+	RaisedAt time.Time `json:"raised_at"`
+	Message  string    `json:"message"`
+	Errors   []string  `json:"errors"`
+}
+
+// ReloadStatus reports schema reload activity
+type ReloadStatus struct {
+	Reloads       int64        `json:"reloads"`
+	FailedReloads int64        `json:"failed_reloads"`
+	LastReload    time.Time    `json:"last_reload"`
+	Watching      []string     `json:"watching,omitempty"`
+	ActiveAlert   *SchemaAlert `json:"active_alert,omitempty"`
+}
+
+// SetAlertHandler sets the function called whenever a schema alert is raised
+func (m *Manager) SetAlertHandler(handler func(*SchemaAlert)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alertHandler = handler
+}
+
+// GetReloadStatus returns reload statistics and the active alert, if any
+func (m *Manager) GetReloadStatus() ReloadStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := m.reloadStatus
+	if m.watcher != nil {
+		status.Watching = append([]string(nil), m.config.SchemaDirs...)
+	}
+	return status
+}
+
+// ReloadSchemas rebuilds the validator set from the built-in schemas, schema
+// files, schema directories and versioned schemas, and swaps it in
+// atomically. If any schema file fails to load, the current set stays in
+// place and an alert is raised.
+func (m *Manager) ReloadSchemas() error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	log.Info("Reloading JSON schemas")
+
+	validator, loadErrs, err := m.buildValidator()
+	if err == nil && len(loadErrs) > 0 {
+		err = errors.Join(loadErrs...)
+	}
+	if err != nil {
+		m.mu.Lock()
+		m.reloadStatus.FailedReloads++
+		m.mu.Unlock()
+
+		errs := loadErrs
+		if len(errs) == 0 {
+			errs = []error{err}
+		}
+		m.raiseAlert("Schema reload failed, keeping the previous schema set", errs)
+		return fmt.Errorf("failed to reload schemas: %w", err)
+	}
+
+	m.swapValidator(validator)
+
+	m.mu.Lock()
+	m.reloadStatus.Reloads++
+	m.reloadStatus.LastReload = time.Now()
+	resolved := m.reloadStatus.ActiveAlert != nil
+	m.reloadStatus.ActiveAlert = nil
+	m.mu.Unlock()
+
+	if resolved {
+		log.Info("Schema alert resolved by successful reload")
+	}
+	log.WithField("schemas", len(validator.GetLoadedSchemas())).Info("Schemas reloaded successfully")
+	return nil
+}
+
+// Stop stops watching schema directories
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	watcher, stop := m.watcher, m.stopWatch
+	m.watcher, m.stopWatch = nil, nil
+	m.mu.Unlock()
+
+	if watcher != nil {
+		close(stop)
+		watcher.Close()
+	}
+}
+
+// current returns the active validator and its generation
+func (m *Manager) current() (*Validator, uint64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.validator, m.generation
+}
+
+// swapValidator replaces the active validator and invalidates cached results
+func (m *Manager) swapValidator(validator *Validator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validator = validator
+	m.invalidateCacheLocked()
+}
+
+// invalidateCacheLocked drops cached results and moves to a new generation;
+// m.mu must be held
+func (m *Manager) invalidateCacheLocked() {
+	m.generation++
+	if m.resultCache != nil {
+		m.resultCache = make(map[string]*ValidationResult)
+	}
+}
+
+// buildValidator loads a complete validator set. err is set only if the
+// built-in schemas fail; loadErrs lists schema files that failed to load
+// and were left out.
+func (m *Manager) buildValidator() (validator *Validator, loadErrs []error, err error) {
+	validator = NewValidator()
+
+	// Load built-in schemas
+	if err := validator.LoadBuiltinSchemas(); err != nil {
+		return nil, nil, fmt.Errorf("failed to load built-in schemas: %w", err)
+	}
+
+	// Load external schema files
+	for _, schemaFile := range m.config.SchemaFiles {
+		if err := m.loadSchemaFileToValidator(validator, schemaFile); err != nil {
+			log.WithError(err).WithField("file", schemaFile).Error("Failed to load schema file")
+			loadErrs = append(loadErrs, fmt.Errorf("%s: %w", schemaFile, err))
+		}
+	}
+
+	// Load schema directories
+	for _, dir := range m.config.SchemaDirs {
+		loadErrs = append(loadErrs, loadSchemaDir(validator, dir)...)
+	}
+
+	// Load versioned schemas
+	loadErrs = append(loadErrs, m.loadSchemaVersions(validator)...)
+
+	return validator, loadErrs, nil
+}
+
+// loadSchemaDir loads every *.json file in dir. "<name>.json" is loaded as
+// schema <name>, replacing a built-in schema of that name;
+// "<name>@<version>.json" registers a version of <name>. A schema whose root
+// has "deprecated": true is registered as deprecated.
+func loadSchemaDir(validator *Validator, dir string) []error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.WithError(err).WithField("dir", dir).Error("Failed to read schema directory")
+		return []error{fmt.Errorf("%s: %w", dir, err)}
+	}
+
+	var loadErrs []error
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(fileName, ".") || filepath.Ext(fileName) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(dir, fileName)
+		if err := loadSchemaDirFile(validator, path, strings.TrimSuffix(fileName, ".json")); err != nil {
+			log.WithError(err).WithField("file", path).Error("Failed to load schema file")
+			loadErrs = append(loadErrs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return loadErrs
+}
+
+func loadSchemaDirFile(validator *Validator, path, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var root struct {
+		Deprecated bool `json:"deprecated"`
+	}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if base, version, versioned := strings.Cut(name, "@"); versioned {
+		return validator.RegisterSchemaVersion(base, version, string(data), root.Deprecated)
+	}
+	return validator.LoadSchemaFromString(name, string(data))
+}
+
+// raiseAlert records an active schema alert and passes it to the alert handler
+func (m *Manager) raiseAlert(message string, errs []error) {
+	alert := &SchemaAlert{
+		RaisedAt: time.Now(),
+		Message:  message,
+	}
+	for _, err := range errs {
+		alert.Errors = append(alert.Errors, err.Error())
+	}
+
+	m.mu.Lock()
+	m.reloadStatus.ActiveAlert = alert
+	handler := m.alertHandler
+	m.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"errors": alert.Errors,
+	}).Error(message)
+
+	if handler != nil {
+		handler(alert)
+	}
+}
+
+// startWatcher watches the schema directories and reloads on changes
+func (m *Manager) startWatcher() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create schema watcher: %w", err)
+	}
+
+	for _, dir := range m.config.SchemaDirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch schema directory %s: %w", dir, err)
+		}
+	}
+
+	stop := make(chan struct{})
+	m.mu.Lock()
+	m.watcher = watcher
+	m.stopWatch = stop
+	m.mu.Unlock()
+
+	go m.watchSchemaDirs(watcher, stop)
+
+	log.WithField("dirs", m.config.SchemaDirs).Info("Schema directory watcher started")
+	return nil
+}
+
+func (m *Manager) watchSchemaDirs(watcher *fsnotify.Watcher, stop chan struct{}) {
+	var debounce *time.Timer
+	var reload <-chan time.Time
+
+	for {
+		select {
+		case <-stop:
+			if debounce != nil {
+				debounce.Stop()
+			}
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Ext(event.Name) != ".json" || !event.Has(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) {
+				continue
+			}
+			log.WithFields(log.Fields{
+				"file": event.Name,
+				"op":   event.Op.String(),
+			}).Debug("Schema file changed")
+
+			if debounce == nil {
+				debounce = time.NewTimer(m.reloadDebounce)
+			} else {
+				debounce.Reset(m.reloadDebounce)
+			}
+			reload = debounce.C
+
+		case <-reload:
+			reload = nil
+			if err := m.ReloadSchemas(); err != nil {
+				log.WithError(err).Warn("Schema hot reload failed")
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.WithError(err).Error("Schema directory watcher error")
+		}
+	}
+}
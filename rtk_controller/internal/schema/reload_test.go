@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const stateTopic = "rtk/v1/office/floor1/ap1/state"
+
+func TestManager_ReloadSchemaDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "state@1.0.json"), []byte(stateV10), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a schema"), 0644))
+
+	manager, err := NewManager(Config{
+		Enabled:      true,
+		SchemaDirs:   []string{dir},
+		CacheResults: true,
+		CacheSize:    100,
+	}, nil)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var alerts []*SchemaAlert
+	manager.SetAlertHandler(func(alert *SchemaAlert) {
+		mu.Lock()
+		alerts = append(alerts, alert)
+		mu.Unlock()
+	})
+	require.NoError(t, manager.Initialize())
+	assert.Equal(t, []SchemaVersionInfo{{Name: "state", Version: "1.0"}}, manager.GetSchemaVersions("state"))
+
+	payload := []byte(`{"schema":"state/1.1","health":"ok","cpu_usage":1}`)
+	result, err := manager.ValidateMessage(stateTopic, payload)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+
+	// A broken file keeps the previous set and raises an alert
+	broken := filepath.Join(dir, "state@1.1.json")
+	require.NoError(t, os.WriteFile(broken, []byte(`{"type": `), 0644))
+	assert.Error(t, manager.ReloadSchemas())
+	assert.Len(t, manager.GetSchemaVersions("state"), 1)
+
+	status := manager.GetReloadStatus()
+	assert.Equal(t, int64(1), status.FailedReloads)
+	require.NotNil(t, status.ActiveAlert)
+	require.Len(t, status.ActiveAlert.Errors, 1)
+	assert.Contains(t, status.ActiveAlert.Errors[0], "state@1.1.json")
+	mu.Lock()
+	assert.Len(t, alerts, 1)
+	mu.Unlock()
+
+	// A successful reload swaps the set, clears the alert and drops cached results
+	require.NoError(t, os.WriteFile(broken, []byte(stateV11), 0644))
+	require.NoError(t, manager.ReloadSchemas())
+	assert.Len(t, manager.GetSchemaVersions("state"), 2)
+
+	status = manager.GetReloadStatus()
+	assert.Equal(t, int64(1), status.Reloads)
+	assert.Nil(t, status.ActiveAlert)
+
+	result, err = manager.ValidateMessage(stateTopic, payload)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+}
+
+func TestManager_WatchSchemaDir(t *testing.T) {
+	dir := t.TempDir()
+
+	manager, err := NewManager(Config{
+		Enabled:    true,
+		SchemaDirs: []string{dir},
+		WatchDirs:  true,
+	}, nil)
+	require.NoError(t, err)
+	manager.reloadDebounce = 20 * time.Millisecond
+	require.NoError(t, manager.Initialize())
+	t.Cleanup(manager.Stop)
+
+	assert.Equal(t, []string{dir}, manager.GetReloadStatus().Watching)
+	assert.Empty(t, manager.GetSchemaVersions("state"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "state@1.0.json"), []byte(stateV10), 0644))
+	require.Eventually(t, func() bool {
+		return len(manager.GetSchemaVersions("state")) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "state@1.0.json")))
+	require.Eventually(t, func() bool {
+		return len(manager.GetSchemaVersions("state")) == 0
+	}, 5*time.Second, 20*time.Millisecond)
+}
@@ -13,7 +13,11 @@ import (
 // Validator provides JSON schema validation functionality
 type Validator struct {
 	schemas map[string]*gojsonschema.Schema
-	mu      sync.RWMutex
+
+	// versions holds schemas registered per announced name and version,
+	// e.g. "state" -> "1.1.0"
+	versions map[string]map[string]*versionedSchema
+	mu       sync.RWMutex
 }
 
 // ValidationResult represents the result of schema validation
@@ -42,7 +46,8 @@ func (vr *ValidationResult) GetSchema() string {
 // NewValidator creates a new schema validator
 func NewValidator() *Validator {
 	return &Validator{
-		schemas: make(map[string]*gojsonschema.Schema),
+		schemas:  make(map[string]*gojsonschema.Schema),
+		versions: make(map[string]map[string]*versionedSchema),
 	}
 }
 
@@ -124,6 +129,11 @@ func (v *Validator) Validate(schemaName string, data interface{}) (*ValidationRe
 		return nil, fmt.Errorf("schema not found: %s", schemaName)
 	}
 
+	return validateWith(schema, schemaName, data)
+}
+
+// validateWith validates data against a compiled schema, reporting it as schemaName
+func validateWith(schema *gojsonschema.Schema, schemaName string, data interface{}) (*ValidationResult, error) {
 	// Convert data to JSON if it's not already a string
 	var jsonData interface{}
 	switch d := data.(type) {
@@ -176,6 +186,14 @@ func (v *Validator) Validate(schemaName string, data interface{}) (*ValidationRe
 
 // ValidateByTopic determines schema from MQTT topic and validates
 func (v *Validator) ValidateByTopic(topic string, payload []byte) (*ValidationResult, error) {
+	// A version announced in the payload takes precedence over the topic
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err == nil {
+		if result, ok, err := v.validateAnnouncedVersion(data); ok {
+			return result, err
+		}
+	}
+
 	schemaName := v.inferSchemaFromTopic(topic)
 	if schemaName == "" {
 		return &ValidationResult{
@@ -208,6 +226,10 @@ func (v *Validator) ValidateBySchemaField(payload []byte) (*ValidationResult, er
 		}, nil
 	}
 
+	if result, ok, err := v.validateAnnouncedVersion(data); ok {
+		return result, err
+	}
+
 	// Map schema field to schema name
 	schemaName := v.mapSchemaFieldToName(schemaField)
 	if schemaName == "" {
@@ -0,0 +1,349 @@
+package schema
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xeipuuv/gojsonschema"
+
+	"rtk_controller/pkg/types"
+	"rtk_controller/pkg/utils"
+)
+
+// versionedSchema is one registered version of an announced schema name
+type versionedSchema struct {
+	version    string // as registered, e.g. "1.1"
+	schema     *gojsonschema.Schema
+	deprecated bool
+}
+
+// SchemaVersionInfo describes a registered schema version
+type SchemaVersionInfo struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Deprecated bool   `json:"deprecated"`
+}
+
+// RegisterSchemaVersion registers a schema for an announced name and semantic
+// version. Payloads whose schema field names that version (e.g. "state/1.1")
+// are validated against it; once any version of a name is registered, payloads
+// announcing an unregistered version of it fail validation.
+func (v *Validator) RegisterSchemaVersion(name, version, schemaJSON string, deprecated bool) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid schema name %q", name)
+	}
+	key, err := utils.NormalizeSchemaVersion(version)
+	if err != nil {
+		return err
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schemaJSON))
+	if err != nil {
+		return fmt.Errorf("failed to load schema %s/%s: %w", name, version, err)
+	}
+
+	v.mu.Lock()
+	if v.versions[name] == nil {
+		v.versions[name] = make(map[string]*versionedSchema)
+	}
+	v.versions[name][key] = &versionedSchema{version: version, schema: schema, deprecated: deprecated}
+	v.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"schema":     name,
+		"version":    version,
+		"deprecated": deprecated,
+	}).Debug("Schema version registered")
+	return nil
+}
+
+// SetSchemaVersionDeprecated marks a registered schema version as deprecated
+// or current
+func (v *Validator) SetSchemaVersionDeprecated(name, version string, deprecated bool) error {
+	key, err := utils.NormalizeSchemaVersion(version)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	registered, exists := v.versions[name][key]
+	if !exists {
+		return fmt.Errorf("schema version not registered: %s/%s", name, version)
+	}
+	registered.deprecated = deprecated
+	return nil
+}
+
+// GetSchemaVersions returns the registered versions of a schema name, or of
+// all names when name is empty, ordered by name and ascending version
+func (v *Validator) GetSchemaVersions(name string) []SchemaVersionInfo {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	var infos []SchemaVersionInfo
+	for schemaName, versions := range v.versions {
+		if name != "" && schemaName != name {
+			continue
+		}
+		for _, registered := range versions {
+			infos = append(infos, SchemaVersionInfo{
+				Name:       schemaName,
+				Version:    registered.version,
+				Deprecated: registered.deprecated,
+			})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		cmp, _ := utils.CompareSchemaVersions(infos[i].Version, infos[j].Version)
+		return cmp < 0
+	})
+	return infos
+}
+
+// validateAnnouncedVersion validates data against the exact schema version
+// named by its schema field. ok is false when the payload announces no
+// version or no version of that name is registered, leaving validation to
+// the unversioned schemas.
+func (v *Validator) validateAnnouncedVersion(data map[string]interface{}) (result *ValidationResult, ok bool, err error) {
+	field, _ := data["schema"].(string)
+	name, version := utils.SplitSchemaField(field)
+	if version == "" {
+		return nil, false, nil
+	}
+
+	v.mu.RLock()
+	versions, versioned := v.versions[name]
+	var registered *versionedSchema
+	var known []string
+	if versioned {
+		if key, err := utils.NormalizeSchemaVersion(version); err == nil {
+			registered = versions[key]
+		}
+		for _, r := range versions {
+			known = append(known, r.version)
+		}
+	}
+	v.mu.RUnlock()
+
+	if !versioned {
+		return nil, false, nil
+	}
+
+	if registered == nil {
+		sort.Slice(known, func(i, j int) bool {
+			cmp, _ := utils.CompareSchemaVersions(known[i], known[j])
+			return cmp < 0
+		})
+		return &ValidationResult{
+			Valid:  false,
+			Errors: []string{fmt.Sprintf("schema version %s is not registered (known: %s)", field, strings.Join(known, ", "))},
+			Schema: field,
+		}, true, nil
+	}
+
+	result, err = validateWith(registered.schema, field, data)
+	return result, true, err
+}
+
+// Device schema compatibility statuses
+const (
+	SchemaCompatCurrent      = "current"
+	SchemaCompatDeprecated   = "deprecated"
+	SchemaCompatUnregistered = "unregistered"
+)
+
+// DeviceSchemaCompat is one device's highest supported version of a schema
+type DeviceSchemaCompat struct {
+	DeviceKey string `json:"device_key"`
+	Schema    string `json:"schema"`
+	Version   string `json:"version"`
+	Status    string `json:"status"`
+	Latest    string `json:"latest,omitempty"` // newest current version registered
+}
+
+// CompatibilityReport lists which devices support which registered schema
+// versions, flagging those whose best version is deprecated or unknown
+type CompatibilityReport struct {
+	GeneratedAt time.Time            `json:"generated_at"`
+	Devices     int                  `json:"devices"`
+	Entries     []DeviceSchemaCompat `json:"entries"`
+	Counts      map[string]int       `json:"counts"`
+}
+
+// Deprecated returns the entries for devices on deprecated schema versions
+func (r *CompatibilityReport) Deprecated() []DeviceSchemaCompat {
+	var entries []DeviceSchemaCompat
+	for _, entry := range r.Entries {
+		if entry.Status == SchemaCompatDeprecated {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// BuildCompatibilityReport checks each device's highest supported version of
+// every versioned schema against the registered versions. Schemas that have
+// no registered versions are not reported.
+func (v *Validator) BuildCompatibilityReport(devices []*types.DeviceState) *CompatibilityReport {
+	report := &CompatibilityReport{
+		GeneratedAt: time.Now(),
+		Devices:     len(devices),
+		Counts:      make(map[string]int),
+	}
+
+	latest := make(map[string]string)
+	for _, info := range v.GetSchemaVersions("") {
+		if !info.Deprecated {
+			latest[info.Name] = info.Version // ascending order leaves the newest
+		}
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for _, device := range devices {
+		deviceKey := fmt.Sprintf("%s:%s:%s", device.Tenant, device.Site, device.ID)
+		for name, version := range device.SchemaVersions {
+			versions, versioned := v.versions[name]
+			if !versioned {
+				continue
+			}
+
+			status := SchemaCompatUnregistered
+			if key, err := utils.NormalizeSchemaVersion(version); err == nil {
+				if registered, exists := versions[key]; exists {
+					status = SchemaCompatCurrent
+					if registered.deprecated {
+						status = SchemaCompatDeprecated
+					}
+				}
+			}
+
+			report.Entries = append(report.Entries, DeviceSchemaCompat{
+				DeviceKey: deviceKey,
+				Schema:    name,
+				Version:   version,
+				Status:    status,
+				Latest:    latest[name],
+			})
+			report.Counts[status]++
+		}
+	}
+
+	sort.Slice(report.Entries, func(i, j int) bool {
+		if report.Entries[i].DeviceKey != report.Entries[j].DeviceKey {
+			return report.Entries[i].DeviceKey < report.Entries[j].DeviceKey
+		}
+		return report.Entries[i].Schema < report.Entries[j].Schema
+	})
+	return report
+}
+
+// runtimeVersion is a schema version registered through the manager API
+type runtimeVersion struct {
+	name, version, schemaJSON string
+	deprecated                bool
+}
+
+// loadSchemaVersions registers configured and runtime schema versions on a
+// validator and applies deprecation changes made since. It returns the
+// errors of configured files that failed to load.
+func (m *Manager) loadSchemaVersions(validator *Validator) []error {
+	var loadErrs []error
+	for _, vc := range m.config.Versions {
+		if err := m.loadSchemaVersionFile(validator, vc); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"schema":  vc.Name,
+				"version": vc.Version,
+				"file":    vc.File,
+			}).Error("Failed to load schema version")
+			loadErrs = append(loadErrs, fmt.Errorf("schema %s/%s (%s): %w", vc.Name, vc.Version, vc.File, err))
+		}
+	}
+
+	m.mu.RLock()
+	runtimeVersions := append([]runtimeVersion(nil), m.runtimeVersions...)
+	deprecations := make(map[string]bool, len(m.deprecations))
+	for key, deprecated := range m.deprecations {
+		deprecations[key] = deprecated
+	}
+	m.mu.RUnlock()
+
+	for _, rv := range runtimeVersions {
+		// Already compiled once when registered, so this cannot fail
+		_ = validator.RegisterSchemaVersion(rv.name, rv.version, rv.schemaJSON, rv.deprecated)
+	}
+	for key, deprecated := range deprecations {
+		name, version := utils.SplitSchemaField(key)
+		if err := validator.SetSchemaVersionDeprecated(name, version, deprecated); err != nil {
+			log.WithError(err).Warn("Dropping deprecation of unregistered schema version")
+		}
+	}
+	return loadErrs
+}
+
+func (m *Manager) loadSchemaVersionFile(validator *Validator, vc VersionConfig) error {
+	data, err := os.ReadFile(vc.File)
+	if err != nil {
+		return err
+	}
+	return validator.RegisterSchemaVersion(vc.Name, vc.Version, string(data), vc.Deprecated)
+}
+
+// RegisterSchemaVersion registers a schema version at runtime
+func (m *Manager) RegisterSchemaVersion(name, version, schemaJSON string, deprecated bool) error {
+	// Serialize with reloads so the registration lands in the next validator set
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	validator, _ := m.current()
+	if err := validator.RegisterSchemaVersion(name, version, schemaJSON, deprecated); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.runtimeVersions = append(m.runtimeVersions, runtimeVersion{name: name, version: version, schemaJSON: schemaJSON, deprecated: deprecated})
+	m.invalidateCacheLocked()
+	m.mu.Unlock()
+	return nil
+}
+
+// SetSchemaVersionDeprecated marks a registered schema version as deprecated or current
+func (m *Manager) SetSchemaVersionDeprecated(name, version string, deprecated bool) error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	validator, _ := m.current()
+	if err := validator.SetSchemaVersionDeprecated(name, version, deprecated); err != nil {
+		return err
+	}
+
+	key, _ := utils.NormalizeSchemaVersion(version)
+	m.mu.Lock()
+	m.deprecations[name+"/"+key] = deprecated
+	m.mu.Unlock()
+	return nil
+}
+
+// GetSchemaVersions returns registered schema versions, for one name or all when name is empty
+func (m *Manager) GetSchemaVersions(name string) []SchemaVersionInfo {
+	validator, _ := m.current()
+	return validator.GetSchemaVersions(name)
+}
+
+// CompatibilityReport reports which devices are on deprecated or
+// unregistered versions of the versioned schemas
+func (m *Manager) CompatibilityReport(devices []*types.DeviceState) *CompatibilityReport {
+	validator, _ := m.current()
+	return validator.BuildCompatibilityReport(devices)
+}
@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rtk_controller/pkg/types"
+)
+
+const stateV10 = `{
+  "type": "object",
+  "properties": {"schema": {"const": "state/1.0"}, "health": {"type": "string"}},
+  "required": ["schema", "health"]
+}`
+
+const stateV11 = `{
+  "type": "object",
+  "properties": {"schema": {"const": "state/1.1"}, "health": {"type": "string"}, "cpu_usage": {"type": "number"}},
+  "required": ["schema", "health", "cpu_usage"]
+}`
+
+func TestValidator_ValidatesAnnouncedVersion(t *testing.T) {
+	validator := NewValidator()
+	require.NoError(t, validator.LoadBuiltinSchemas())
+	require.NoError(t, validator.RegisterSchemaVersion("state", "1.0", stateV10, true))
+	require.NoError(t, validator.RegisterSchemaVersion("state", "1.1.0", stateV11, false))
+	assert.Error(t, validator.RegisterSchemaVersion("state", "one", stateV10, false))
+	assert.Error(t, validator.RegisterSchemaVersion("state/1.2", "1.2", stateV10, false))
+
+	topic := "rtk/v1/office/floor1/ap1/state"
+	tests := []struct {
+		payload string
+		valid   bool
+		schema  string
+	}{
+		{`{"schema":"state/1.0","health":"ok"}`, true, "state/1.0"},
+		{`{"schema":"state/1.1","health":"ok"}`, false, "state/1.1"}, // 1.1 requires cpu_usage
+		{`{"schema":"state/1.1","health":"ok","cpu_usage":12.5}`, true, "state/1.1"},
+		{`{"schema":"state/1.2","health":"ok"}`, false, "state/1.2"},
+	}
+	for _, tt := range tests {
+		result, err := validator.ValidateByTopic(topic, []byte(tt.payload))
+		require.NoError(t, err, tt.payload)
+		assert.Equal(t, tt.valid, result.Valid, tt.payload)
+		assert.Equal(t, tt.schema, result.Schema, tt.payload)
+	}
+
+	// Schema field validation uses the same versions
+	result, err := validator.ValidateBySchemaField([]byte(`{"schema":"state/1.1","health":"ok","cpu_usage":1}`))
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+
+	// Names without registered versions keep the built-in schemas
+	result, err = validator.ValidateByTopic("rtk/v1/office/floor1/ap1/attr", []byte(`{"schema":"attr/1.0","ts":1}`))
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, "attr", result.Schema)
+
+	// Unknown versions list the registered ones in numeric order
+	require.NoError(t, validator.RegisterSchemaVersion("state", "10.0", stateV11, false))
+	result, err = validator.ValidateByTopic(topic, []byte(`{"schema":"state/9.0","health":"ok"}`))
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, []string{"schema version state/9.0 is not registered (known: 1.0, 1.1.0, 10.0)"}, result.Errors)
+
+	assert.Equal(t, []SchemaVersionInfo{
+		{Name: "state", Version: "1.0", Deprecated: true},
+		{Name: "state", Version: "1.1.0", Deprecated: false},
+		{Name: "state", Version: "10.0", Deprecated: false},
+	}, validator.GetSchemaVersions("state"))
+}
+
+func TestManager_CompatibilityReport(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "state-1.0.json")
+	require.NoError(t, os.WriteFile(file, []byte(stateV10), 0644))
+
+	manager, err := NewManager(Config{
+		Enabled:  true,
+		Versions: []VersionConfig{{Name: "state", Version: "1.0", File: file}},
+	}, nil)
+	require.NoError(t, err)
+	require.NoError(t, manager.Initialize())
+	require.NoError(t, manager.RegisterSchemaVersion("state", "1.1", stateV11, false))
+	require.NoError(t, manager.SetSchemaVersionDeprecated("state", "1.0", true))
+	assert.Error(t, manager.SetSchemaVersionDeprecated("state", "0.9", true))
+
+	// Reloading keeps runtime registrations and deprecations
+	require.NoError(t, manager.ReloadSchemas())
+	require.Len(t, manager.GetSchemaVersions("state"), 2)
+
+	devices := []*types.DeviceState{
+		{ID: "ap1", Tenant: "office", Site: "floor1", SchemaVersions: map[string]string{"state": "1.0", "evt.wifi.roam_miss": "1.0"}},
+		{ID: "ap2", Tenant: "office", Site: "floor1", SchemaVersions: map[string]string{"state": "1.1"}},
+		{ID: "ap3", Tenant: "office", Site: "floor1", SchemaVersions: map[string]string{"state": "2.0"}},
+		{ID: "ap4", Tenant: "office", Site: "floor1"},
+	}
+	report := manager.CompatibilityReport(devices)
+
+	assert.Equal(t, 4, report.Devices)
+	assert.Equal(t, map[string]int{
+		SchemaCompatCurrent:      1,
+		SchemaCompatDeprecated:   1,
+		SchemaCompatUnregistered: 1,
+	}, report.Counts)
+	assert.Equal(t, []DeviceSchemaCompat{
+		{DeviceKey: "office:floor1:ap1", Schema: "state", Version: "1.0", Status: SchemaCompatDeprecated, Latest: "1.1"},
+	}, report.Deprecated())
+}
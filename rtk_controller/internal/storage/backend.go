@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// Storage backends selectable with storage.backend
+const (
+	// BackendBuntDB keeps every key in memory and appends changes to
+	// controller.db. It is the default.
+	BackendBuntDB = "buntdb"
+
+	// BackendBolt keeps keys in an on-disk B+tree in controller.bolt and
+	// only caches what the OS page cache holds
+	BackendBolt = "bolt"
+)
+
+// Backends returns the names of the available storage backends
+func Backends() []string {
+	return []string{BackendBuntDB, BackendBolt}
+}
+
+// Open opens the storage backend with the given name in dataPath. An empty
+// name selects BuntDB.
+func Open(backend, dataPath string) (Storage, error) {
+	switch backend {
+	case "", BackendBuntDB:
+		return NewBuntDB(dataPath)
+	case BackendBolt:
+		return NewBolt(dataPath)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (available: %v)", backend, Backends())
+	}
+}
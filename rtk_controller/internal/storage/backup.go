@@ -0,0 +1,453 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	snapshotPrefix     = "controller-"
+	snapshotSuffix     = ".db"
+	snapshotTimeFormat = "20060102-150405.000000"
+)
+
+// BackupConfig holds backup worker configuration
+type BackupConfig struct {
+	// Dir is the directory snapshots are written to
+	Dir string
+
+	// Count is the number of snapshots kept; older ones are removed.
+	// 0 keeps every snapshot.
+	Count int
+
+	// Interval between scheduled snapshots; 0 disables them
+	Interval time.Duration
+
+	// CompactInterval between scheduled compactions; 0 disables them
+	CompactInterval time.Duration
+
+	// DataDir is the storage directory. Restores are refused while a
+	// service or MCP server holds its lock (see LockData).
+	DataDir string
+}
+
+// SnapshotInfo describes a snapshot file in the backup directory
+type SnapshotInfo struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupStats holds backup worker statistics
+type BackupStats struct {
+	LastBackup      time.Time `json:"last_backup,omitempty"`
+	LastBackupName  string    `json:"last_backup_name,omitempty"`
+	LastBackupError string    `json:"last_backup_error,omitempty"`
+	TotalBackups    int64     `json:"total_backups"`
+	LastCompaction  time.Time `json:"last_compaction,omitempty"`
+	LastCompactSave int64     `json:"last_compact_saved_bytes"`
+	LastRestore     time.Time `json:"last_restore,omitempty"`
+	LastRestoreName string    `json:"last_restore_name,omitempty"`
+}
+
+// BackupManager writes scheduled snapshots of the storage, rotates them,
+// compacts the storage file and restores snapshots
+type BackupManager struct {
+	store  Snapshotter
+	config BackupConfig
+
+	// Serializes backup, compaction and restore
+	opMu sync.Mutex
+
+	mu    sync.RWMutex
+	stats BackupStats
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewBackupManager creates a backup manager for a storage that supports
+// snapshots
+func NewBackupManager(store Storage, config BackupConfig) (*BackupManager, error) {
+	snapshotter, ok := store.(Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("storage %T does not support snapshots", store)
+	}
+	if config.Dir == "" {
+		return nil, fmt.Errorf("backup directory is required")
+	}
+	if config.Count < 0 {
+		return nil, fmt.Errorf("backup count must not be negative")
+	}
+
+	return &BackupManager{
+		store:  snapshotter,
+		config: config,
+	}, nil
+}
+
+// Start starts the scheduled backup and compaction routine
+func (bm *BackupManager) Start(ctx context.Context) error {
+	if bm.config.Interval <= 0 && bm.config.CompactInterval <= 0 {
+		log.Info("Scheduled storage backups and compaction disabled")
+		return nil
+	}
+
+	if err := os.MkdirAll(bm.config.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"backup_dir":       bm.config.Dir,
+		"backup_count":     bm.config.Count,
+		"backup_interval":  bm.config.Interval,
+		"compact_interval": bm.config.CompactInterval,
+	}).Info("Starting storage backup worker")
+
+	ctx, bm.cancel = context.WithCancel(ctx)
+	bm.done = make(chan struct{})
+	go bm.run(ctx)
+
+	return nil
+}
+
+// Stop stops the backup routine
+func (bm *BackupManager) Stop() {
+	if bm.cancel == nil {
+		return
+	}
+
+	bm.cancel()
+	<-bm.done
+	bm.cancel = nil
+
+	log.Info("Storage backup worker stopped")
+}
+
+func (bm *BackupManager) run(ctx context.Context) {
+	defer close(bm.done)
+
+	var backupC, compactC <-chan time.Time
+	if bm.config.Interval > 0 {
+		ticker := time.NewTicker(bm.config.Interval)
+		defer ticker.Stop()
+		backupC = ticker.C
+	}
+	if bm.config.CompactInterval > 0 {
+		ticker := time.NewTicker(bm.config.CompactInterval)
+		defer ticker.Stop()
+		compactC = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-backupC:
+			if _, err := bm.Backup(); err != nil {
+				log.WithError(err).Error("Scheduled storage backup failed")
+			}
+		case <-compactC:
+			if _, err := bm.Compact(); err != nil {
+				log.WithError(err).Error("Scheduled storage compaction failed")
+			}
+		}
+	}
+}
+
+// Backup writes a snapshot to the backup directory and removes snapshots
+// beyond the configured count
+func (bm *BackupManager) Backup() (*SnapshotInfo, error) {
+	bm.opMu.Lock()
+	defer bm.opMu.Unlock()
+
+	info, err := bm.backupLocked("")
+
+	bm.mu.Lock()
+	if err != nil {
+		bm.stats.LastBackupError = err.Error()
+	} else {
+		bm.stats.LastBackup = info.CreatedAt
+		bm.stats.LastBackupName = info.Name
+		bm.stats.LastBackupError = ""
+		bm.stats.TotalBackups++
+	}
+	bm.mu.Unlock()
+
+	return info, err
+}
+
+// backupLocked writes a snapshot and rotates old ones. keep names a
+// snapshot path that rotation must not remove. The caller holds opMu.
+func (bm *BackupManager) backupLocked(keep string) (*SnapshotInfo, error) {
+	start := time.Now()
+	if err := os.MkdirAll(bm.config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Snapshot names sort by creation time and must be unique
+	createdAt := start.UTC().Truncate(time.Microsecond)
+	var name, path string
+	for {
+		name = snapshotPrefix + createdAt.Format(snapshotTimeFormat) + snapshotSuffix
+		path = filepath.Join(bm.config.Dir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		createdAt = createdAt.Add(time.Microsecond)
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial
+	// snapshot that looks complete
+	tmp, err := os.CreateTemp(bm.config.Dir, name+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if err := bm.store.Snapshot(tmp); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, fmt.Errorf("failed to finalize snapshot: %w", err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &SnapshotInfo{
+		Name:      name,
+		Path:      path,
+		Size:      stat.Size(),
+		CreatedAt: createdAt,
+	}
+
+	removed, err := bm.rotate(keep)
+	if err != nil {
+		log.WithError(err).Warn("Failed to rotate storage snapshots")
+	}
+
+	log.WithFields(log.Fields{
+		"snapshot": name,
+		"size":     info.Size,
+		"removed":  removed,
+		"duration": time.Since(start),
+	}).Info("Storage snapshot written")
+	return info, nil
+}
+
+// rotate removes the oldest snapshots beyond the configured count, except
+// the one at keep
+func (bm *BackupManager) rotate(keep string) (int, error) {
+	if bm.config.Count == 0 {
+		return 0, nil
+	}
+
+	snapshots, err := bm.ListSnapshots()
+	if err != nil {
+		return 0, err
+	}
+
+	if keep != "" {
+		if abs, err := filepath.Abs(keep); err == nil {
+			keep = abs
+		}
+	}
+
+	removed := 0
+	for i := bm.config.Count; i < len(snapshots); i++ {
+		if abs, err := filepath.Abs(snapshots[i].Path); err == nil && abs == keep {
+			continue
+		}
+		if err := os.Remove(snapshots[i].Path); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// ListSnapshots returns the snapshots in the backup directory, newest first
+func (bm *BackupManager) ListSnapshots() ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(bm.config.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []SnapshotInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix)
+		createdAt, err := time.Parse(snapshotTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{
+			Name:      name,
+			Path:      filepath.Join(bm.config.Dir, name),
+			Size:      stat.Size(),
+			CreatedAt: createdAt,
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// ValidateSnapshot checks that a snapshot can be restored and returns its
+// key count. snapshot is a file name in the backup directory or a path.
+func (bm *BackupManager) ValidateSnapshot(snapshot string) (int, error) {
+	path := bm.snapshotPath(snapshot)
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	return bm.store.ValidateSnapshot(file)
+}
+
+// Restore validates a snapshot and swaps it in for the current contents of
+// the storage. A snapshot of the current contents is written first so the
+// restore can be undone. Managers caching storage contents do not see the
+// restore, so it is refused while another controller process uses the
+// storage and the calling process must restart afterwards.
+func (bm *BackupManager) Restore(snapshot string) (int, *SnapshotInfo, error) {
+	bm.opMu.Lock()
+	defer bm.opMu.Unlock()
+
+	if bm.config.DataDir != "" {
+		inUse, err := dataInUse(bm.config.DataDir)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to check storage lock: %w", err)
+		}
+		if inUse {
+			return 0, nil, fmt.Errorf("storage is in use by a running controller service; stop it before restoring")
+		}
+	}
+
+	path := bm.snapshotPath(snapshot)
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := bm.store.ValidateSnapshot(file); err != nil {
+		return 0, nil, err
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return 0, nil, err
+	}
+
+	// The snapshot being restored may be the oldest one; rotation must
+	// not remove it
+	previous, err := bm.backupLocked(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to back up current storage before restore: %w", err)
+	}
+
+	restored, err := bm.store.RestoreSnapshot(file)
+	if err != nil {
+		return restored, previous, err
+	}
+
+	bm.mu.Lock()
+	bm.stats.LastRestore = time.Now()
+	bm.stats.LastRestoreName = filepath.Base(path)
+	bm.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"snapshot": path,
+		"keys":     restored,
+		"previous": previous.Name,
+	}).Warn("Storage restored from snapshot")
+	return restored, previous, nil
+}
+
+// Compact shrinks the storage file and returns the bytes saved
+func (bm *BackupManager) Compact() (int64, error) {
+	bm.opMu.Lock()
+	defer bm.opMu.Unlock()
+
+	before, _ := bm.store.Size()
+	start := time.Now()
+	if err := bm.store.Compact(); err != nil {
+		return 0, fmt.Errorf("failed to compact storage: %w", err)
+	}
+	after, _ := bm.store.Size()
+
+	// Writes during compaction can grow the file past its old size
+	saved := before - after
+	if saved < 0 {
+		saved = 0
+	}
+	bm.mu.Lock()
+	bm.stats.LastCompaction = time.Now()
+	bm.stats.LastCompactSave = saved
+	bm.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"size_before": before,
+		"size_after":  after,
+		"duration":    time.Since(start),
+	}).Info("Storage compacted")
+	return saved, nil
+}
+
+// Size returns the current size of the storage file in bytes
+func (bm *BackupManager) Size() (int64, error) {
+	return bm.store.Size()
+}
+
+// Config returns the backup configuration
+func (bm *BackupManager) Config() BackupConfig {
+	return bm.config
+}
+
+// GetStats returns backup statistics
+func (bm *BackupManager) GetStats() BackupStats {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	return bm.stats
+}
+
+// snapshotPath resolves a snapshot name in the backup directory; names
+// containing a path separator are used as given
+func (bm *BackupManager) snapshotPath(snapshot string) string {
+	if strings.ContainsRune(snapshot, filepath.Separator) {
+		return snapshot
+	}
+	return filepath.Join(bm.config.Dir, snapshot)
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackupTest(t *testing.T, count int) (Storage, *BackupManager) {
+	db, err := NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	bm, err := NewBackupManager(db, BackupConfig{
+		Dir:   filepath.Join(t.TempDir(), "backups"),
+		Count: count,
+	})
+	require.NoError(t, err)
+	return db, bm
+}
+
+func TestBackupManager_BackupAndRotate(t *testing.T) {
+	db, bm := newBackupTest(t, 2)
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Set(fmt.Sprintf("device:%d", i), "{}"))
+		info, err := bm.Backup()
+		require.NoError(t, err)
+		names = append(names, info.Name)
+	}
+
+	snapshots, err := bm.ListSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, names[2], snapshots[0].Name)
+	assert.Equal(t, names[1], snapshots[1].Name)
+
+	count, err := bm.ValidateSnapshot(snapshots[0].Name)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	stats := bm.GetStats()
+	assert.Equal(t, int64(3), stats.TotalBackups)
+	assert.Equal(t, names[2], stats.LastBackupName)
+}
+
+func TestBackupManager_Restore(t *testing.T) {
+	db, bm := newBackupTest(t, 0)
+
+	require.NoError(t, db.Set("device:a", "old"))
+	snapshot, err := bm.Backup()
+	require.NoError(t, err)
+
+	require.NoError(t, db.Set("device:a", "new"))
+	require.NoError(t, db.Set("device:b", "new"))
+
+	restored, previous, err := bm.Restore(snapshot.Name)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored)
+	require.NotNil(t, previous)
+
+	value, err := db.Get("device:a")
+	require.NoError(t, err)
+	assert.Equal(t, "old", value)
+	exists, err := db.Exists("device:b")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// The state before the restore was kept as a snapshot
+	count, err := bm.ValidateSnapshot(previous.Name)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestBackupManager_RestoreKeepsRestoredSnapshot(t *testing.T) {
+	db, bm := newBackupTest(t, 2)
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.Set("device:a", fmt.Sprintf("v%d", i)))
+		info, err := bm.Backup()
+		require.NoError(t, err)
+		names = append(names, info.Name)
+	}
+
+	// Restoring the oldest snapshot with the rotation count reached
+	_, previous, err := bm.Restore(names[0])
+	require.NoError(t, err)
+
+	value, err := db.Get("device:a")
+	require.NoError(t, err)
+	assert.Equal(t, "v0", value)
+
+	snapshots, err := bm.ListSnapshots()
+	require.NoError(t, err)
+	var remaining []string
+	for _, snapshot := range snapshots {
+		remaining = append(remaining, snapshot.Name)
+	}
+	// The two newest are kept by the count, the restored one on top of them
+	assert.Equal(t, []string{previous.Name, names[1], names[0]}, remaining)
+}
+
+func TestBackupManager_RestoreRefusedWhileDataLocked(t *testing.T) {
+	dataDir := t.TempDir()
+	db, err := NewBuntDB(dataDir)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	bm, err := NewBackupManager(db, BackupConfig{Dir: filepath.Join(t.TempDir(), "backups"), DataDir: dataDir})
+	require.NoError(t, err)
+
+	require.NoError(t, db.Set("device:a", "old"))
+	snapshot, err := bm.Backup()
+	require.NoError(t, err)
+	require.NoError(t, db.Set("device:a", "new"))
+
+	// A running service holds the lock
+	lock, err := LockData(dataDir)
+	require.NoError(t, err)
+	_, _, err = bm.Restore(snapshot.Name)
+	assert.Error(t, err)
+	value, err := db.Get("device:a")
+	require.NoError(t, err)
+	assert.Equal(t, "new", value)
+
+	// Several long-running processes may share the storage
+	other, err := LockData(dataDir)
+	require.NoError(t, err)
+	require.NoError(t, other.Release())
+
+	require.NoError(t, lock.Release())
+	_, _, err = bm.Restore(snapshot.Name)
+	require.NoError(t, err)
+	value, err = db.Get("device:a")
+	require.NoError(t, err)
+	assert.Equal(t, "old", value)
+}
+
+func TestBackupManager_RestoreRejectsInvalidSnapshot(t *testing.T) {
+	db, bm := newBackupTest(t, 0)
+	require.NoError(t, db.Set("device:a", "current"))
+
+	snapshot, err := bm.Backup()
+	require.NoError(t, err)
+	data, err := os.ReadFile(snapshot.Path)
+	require.NoError(t, err)
+
+	// Truncated in the middle of a command
+	truncated := filepath.Join(t.TempDir(), "truncated.db")
+	require.NoError(t, os.WriteFile(truncated, data[:len(data)-3], 0644))
+	_, _, err = bm.Restore(truncated)
+	assert.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.db")
+	require.NoError(t, os.WriteFile(empty, nil, 0644))
+	_, _, err = bm.Restore(empty)
+	assert.Error(t, err)
+
+	value, err := db.Get("device:a")
+	require.NoError(t, err)
+	assert.Equal(t, "current", value)
+}
+
+func TestBackupManager_Compact(t *testing.T) {
+	db, bm := newBackupTest(t, 0)
+
+	for i := 0; i < 200; i++ {
+		require.NoError(t, db.Set("device:a", fmt.Sprintf("value-%d", i)))
+	}
+	before, err := bm.Size()
+	require.NoError(t, err)
+
+	saved, err := bm.Compact()
+	require.NoError(t, err)
+	assert.Greater(t, saved, int64(0))
+
+	after, err := bm.Size()
+	require.NoError(t, err)
+	assert.Less(t, after, before)
+
+	value, err := db.Get("device:a")
+	require.NoError(t, err)
+	assert.Equal(t, "value-199", value)
+}
@@ -0,0 +1,385 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// boltBucket holds every key; the key prefixes already namespace the data
+var boltBucket = []byte("rtk")
+
+// BoltStorage implements Storage interface using bbolt, an on-disk B+tree.
+// Unlike BuntDB it does not keep the whole dataset in memory, which suits
+// sites with many devices and long histories.
+type BoltStorage struct {
+	// mu guards db, which Compact replaces
+	mu   sync.RWMutex
+	db   *bbolt.DB
+	path string
+}
+
+// NewBolt creates a new bbolt storage instance
+func NewBolt(dataPath string) (Storage, error) {
+	// Ensure data directory exists
+	if err := os.MkdirAll(dataPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	dbPath := filepath.Join(dataPath, "controller.bolt")
+	db, err := openBolt(dbPath, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &BoltStorage{
+		db:   db,
+		path: dbPath,
+	}, nil
+}
+
+// openBolt opens a bbolt file and makes sure the data bucket exists
+func openBolt(path string, readOnly bool) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{
+		// Fail instead of blocking forever when another process holds the file
+		Timeout:  5 * time.Second,
+		ReadOnly: readOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if readOnly {
+		err = db.View(func(tx *bbolt.Tx) error {
+			if tx.Bucket(boltBucket) == nil {
+				return fmt.Errorf("bucket %q not found", boltBucket)
+			}
+			return nil
+		})
+	} else {
+		err = db.Update(func(tx *bbolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(boltBucket)
+			return err
+		})
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Set stores a key-value pair
+func (s *BoltStorage) Set(key, value string) error {
+	return s.Transaction(func(tx Transaction) error {
+		return tx.Set(key, value)
+	})
+}
+
+// Get retrieves a value by key
+func (s *BoltStorage) Get(key string) (string, error) {
+	var value string
+	err := s.View(func(tx Transaction) error {
+		var err error
+		value, err = tx.Get(key)
+		return err
+	})
+	return value, err
+}
+
+// Delete removes a key
+func (s *BoltStorage) Delete(key string) error {
+	return s.Transaction(func(tx Transaction) error {
+		return tx.Delete(key)
+	})
+}
+
+// Exists checks if a key exists
+func (s *BoltStorage) Exists(key string) (bool, error) {
+	var exists bool
+	err := s.View(func(tx Transaction) error {
+		var err error
+		exists, err = tx.Exists(key)
+		return err
+	})
+	return exists, err
+}
+
+// Transaction executes a function within a transaction
+func (s *BoltStorage) Transaction(fn func(Transaction) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return fn(&BoltTransaction{bucket: tx.Bucket(boltBucket)})
+	})
+}
+
+// View executes a read-only function
+func (s *BoltStorage) View(fn func(Transaction) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return fn(&BoltTransaction{bucket: tx.Bucket(boltBucket)})
+	})
+}
+
+// Close closes the database
+func (s *BoltStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Close()
+}
+
+// BoltTransaction implements Transaction interface
+type BoltTransaction struct {
+	bucket *bbolt.Bucket
+}
+
+// Set stores a key-value pair in transaction
+func (t *BoltTransaction) Set(key, value string) error {
+	return t.bucket.Put([]byte(key), []byte(value))
+}
+
+// Get retrieves a value by key in transaction
+func (t *BoltTransaction) Get(key string) (string, error) {
+	value := t.bucket.Get([]byte(key))
+	if value == nil {
+		return "", ErrNotFound
+	}
+	// Values are only valid for the life of the transaction; string() copies
+	return string(value), nil
+}
+
+// Delete removes a key in transaction
+func (t *BoltTransaction) Delete(key string) error {
+	if t.bucket.Get([]byte(key)) == nil {
+		if !t.bucket.Tx().Writable() {
+			return bbolt.ErrTxNotWritable
+		}
+		return ErrNotFound
+	}
+	return t.bucket.Delete([]byte(key))
+}
+
+// Exists checks if a key exists in transaction
+func (t *BoltTransaction) Exists(key string) (bool, error) {
+	return t.bucket.Get([]byte(key)) != nil, nil
+}
+
+// IterateRange iterates over keys in a range, from startKey up to but not
+// including endKey
+func (t *BoltTransaction) IterateRange(startKey, endKey string, fn func(key, value string) error) error {
+	end := []byte(endKey)
+	c := t.bucket.Cursor()
+	for k, v := c.Seek([]byte(startKey)); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+		if err := fn(string(k), string(v)); err == ErrStopIteration {
+			break
+		}
+		// Other errors are ignored and iteration continues, as with BuntDB
+	}
+	return nil
+}
+
+// IteratePrefix iterates over keys with a prefix
+func (t *BoltTransaction) IteratePrefix(prefix string, fn func(key, value string) error) error {
+	p := []byte(prefix)
+	c := t.bucket.Cursor()
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if err := fn(string(k), string(v)); err == ErrStopIteration {
+			break
+		}
+		// Other errors are ignored and iteration continues, as with BuntDB
+	}
+	return nil
+}
+
+// DeleteRange deletes keys in a range
+func (t *BoltTransaction) DeleteRange(startKey, endKey string) (int, error) {
+	// Collect keys first; deleting under a cursor skips entries
+	var keysToDelete [][]byte
+	end := []byte(endKey)
+	c := t.bucket.Cursor()
+	for k, _ := c.Seek([]byte(startKey)); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+		keysToDelete = append(keysToDelete, append([]byte(nil), k...))
+	}
+
+	deleted := 0
+	for _, key := range keysToDelete {
+		if err := t.bucket.Delete(key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Snapshot writes a consistent copy of the database file to w. Writers are
+// not blocked while the copy is taken.
+func (s *BoltStorage) Snapshot(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.View(func(tx *bbolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+// ValidateSnapshot opens a snapshot read-only, checks its consistency and
+// returns its key count
+func (s *BoltStorage) ValidateSnapshot(r io.Reader) (int, error) {
+	snapshot, cleanup, err := s.openSnapshot(r)
+	if err != nil {
+		return 0, err
+	}
+	defer cleanup()
+
+	var count int
+	err = snapshot.View(func(tx *bbolt.Tx) error {
+		count = tx.Bucket(boltBucket).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+// RestoreSnapshot validates a snapshot and then replaces the contents of
+// the database with it in one transaction
+func (s *BoltStorage) RestoreSnapshot(r io.Reader) (int, error) {
+	snapshot, cleanup, err := s.openSnapshot(r)
+	if err != nil {
+		return 0, err
+	}
+	defer cleanup()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	restored := 0
+	err = snapshot.View(func(src *bbolt.Tx) error {
+		return s.db.Update(func(dst *bbolt.Tx) error {
+			if err := dst.DeleteBucket(boltBucket); err != nil && err != bbolt.ErrBucketNotFound {
+				return err
+			}
+			bucket, err := dst.CreateBucket(boltBucket)
+			if err != nil {
+				return err
+			}
+			return src.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+				restored++
+				return bucket.Put(k, v)
+			})
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	return restored, nil
+}
+
+// Compact rewrites the database into a new file without free pages and
+// swaps it in. bbolt reuses freed pages but never shrinks its file, so this
+// is the only way to return space. Reads and writes wait while the file is
+// rewritten.
+func (s *BoltStorage) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmpPath := s.path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := bbolt.Open(tmpPath, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return err
+	}
+	if err := bbolt.Compact(dst, s.db, 64*1024*1024); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := s.db.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	renameErr := os.Rename(tmpPath, s.path)
+	if renameErr != nil {
+		os.Remove(tmpPath)
+	}
+
+	// Reopen whichever file is in place now
+	db, err := openBolt(s.path, false)
+	if err != nil {
+		return fmt.Errorf("failed to reopen database after compaction: %w", err)
+	}
+	s.db = db
+	return renameErr
+}
+
+// Size returns the size of the database file in bytes
+func (s *BoltStorage) Size() (int64, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// openSnapshot copies a snapshot to a temporary file and opens it
+// read-only after checking it is complete and consistent
+func (s *BoltStorage) openSnapshot(r io.Reader) (*bbolt.DB, func(), error) {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "restore-*.bolt")
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpPath := tmp.Name()
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	snapshot, err := openBolt(tmpPath, true)
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	cleanup := func() {
+		snapshot.Close()
+		os.Remove(tmpPath)
+	}
+
+	err = snapshot.View(func(tx *bbolt.Tx) error {
+		// A truncated copy still has valid meta pages; check the size they
+		// record before touching any other page
+		if tx.Size() > size {
+			return fmt.Errorf("truncated: %d of %d bytes", size, tx.Size())
+		}
+		for err := range tx.Check() {
+			return err
+		}
+		if tx.Bucket(boltBucket).Stats().KeyN == 0 {
+			return fmt.Errorf("no keys")
+		}
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	return snapshot, cleanup, nil
+}
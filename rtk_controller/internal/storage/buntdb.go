@@ -89,21 +89,28 @@ func (s *BuntDBStorage) Get(key string) (string, error) {
 		value, err = tx.Get(key)
 		return err
 	})
+	if err == buntdb.ErrNotFound {
+		return "", ErrNotFound
+	}
 	return value, err
 }
 
 // Delete removes a key
 func (s *BuntDBStorage) Delete(key string) error {
-	return s.db.Update(func(tx *buntdb.Tx) error {
+	err := s.db.Update(func(tx *buntdb.Tx) error {
 		_, err := tx.Delete(key)
 		return err
 	})
+	if err == buntdb.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
 }
 
 // Exists checks if a key exists
 func (s *BuntDBStorage) Exists(key string) (bool, error) {
 	_, err := s.Get(key)
-	if err == buntdb.ErrNotFound {
+	if err == ErrNotFound {
 		return false, nil
 	}
 	if err != nil {
@@ -144,19 +151,26 @@ func (t *BuntDBTransaction) Set(key, value string) error {
 
 // Get retrieves a value by key in transaction
 func (t *BuntDBTransaction) Get(key string) (string, error) {
-	return t.tx.Get(key)
+	value, err := t.tx.Get(key)
+	if err == buntdb.ErrNotFound {
+		return "", ErrNotFound
+	}
+	return value, err
 }
 
 // Delete removes a key in transaction
 func (t *BuntDBTransaction) Delete(key string) error {
 	_, err := t.tx.Delete(key)
+	if err == buntdb.ErrNotFound {
+		return ErrNotFound
+	}
 	return err
 }
 
 // Exists checks if a key exists in transaction
 func (t *BuntDBTransaction) Exists(key string) (bool, error) {
-	_, err := t.tx.Get(key)
-	if err == buntdb.ErrNotFound {
+	_, err := t.Get(key)
+	if err == ErrNotFound {
 		return false, nil
 	}
 	if err != nil {
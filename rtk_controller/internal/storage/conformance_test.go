@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Every storage backend must pass the same conformance suite
+func TestStorageConformance(t *testing.T) {
+	for _, backend := range Backends() {
+		backend := backend
+		t.Run(backend, func(t *testing.T) {
+			testStorageConformance(t, func(t *testing.T) Storage {
+				s, err := Open(backend, t.TempDir())
+				require.NoError(t, err)
+				t.Cleanup(func() { s.Close() })
+				return s
+			})
+		})
+	}
+}
+
+func TestOpen_UnknownBackend(t *testing.T) {
+	_, err := Open("leveldb", t.TempDir())
+	assert.Error(t, err)
+}
+
+func testStorageConformance(t *testing.T, open func(t *testing.T) Storage) {
+	t.Run("SetGetDelete", func(t *testing.T) {
+		s := open(t)
+
+		require.NoError(t, s.Set("device:a", "1"))
+		require.NoError(t, s.Set("device:a", "2"))
+		value, err := s.Get("device:a")
+		require.NoError(t, err)
+		assert.Equal(t, "2", value)
+
+		exists, err := s.Exists("device:a")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		require.NoError(t, s.Delete("device:a"))
+		exists, err = s.Exists("device:a")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		s := open(t)
+
+		_, err := s.Get("device:missing")
+		assert.True(t, errors.Is(err, ErrNotFound))
+		assert.True(t, errors.Is(s.Delete("device:missing"), ErrNotFound))
+
+		err = s.View(func(tx Transaction) error {
+			_, err := tx.Get("device:missing")
+			return err
+		})
+		assert.True(t, errors.Is(err, ErrNotFound))
+	})
+
+	t.Run("EmptyValue", func(t *testing.T) {
+		s := open(t)
+
+		require.NoError(t, s.Set("device:empty", ""))
+		value, err := s.Get("device:empty")
+		require.NoError(t, err)
+		assert.Equal(t, "", value)
+	})
+
+	t.Run("TransactionCommitAndRollback", func(t *testing.T) {
+		s := open(t)
+
+		require.NoError(t, s.Transaction(func(tx Transaction) error {
+			require.NoError(t, tx.Set("a", "1"))
+			require.NoError(t, tx.Set("b", "2"))
+			value, err := tx.Get("a")
+			require.NoError(t, err)
+			assert.Equal(t, "1", value)
+			return nil
+		}))
+
+		failure := errors.New("abort")
+		err := s.Transaction(func(tx Transaction) error {
+			require.NoError(t, tx.Set("a", "changed"))
+			require.NoError(t, tx.Delete("b"))
+			require.NoError(t, tx.Set("c", "3"))
+			return failure
+		})
+		assert.Equal(t, failure, err)
+
+		value, err := s.Get("a")
+		require.NoError(t, err)
+		assert.Equal(t, "1", value)
+		exists, err := s.Exists("b")
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = s.Exists("c")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("ViewIsReadOnly", func(t *testing.T) {
+		s := open(t)
+		require.NoError(t, s.Set("a", "1"))
+
+		err := s.View(func(tx Transaction) error {
+			return tx.Set("b", "2")
+		})
+		assert.Error(t, err)
+		err = s.View(func(tx Transaction) error {
+			return tx.Delete("a")
+		})
+		assert.Error(t, err)
+
+		exists, err := s.Exists("b")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("IteratePrefix", func(t *testing.T) {
+		s := open(t)
+		for _, key := range []string{"device:b", "device:a", "devices:x", "event:1", "device:c"} {
+			require.NoError(t, s.Set(key, "v-"+key))
+		}
+
+		var keys []string
+		require.NoError(t, s.View(func(tx Transaction) error {
+			return tx.IteratePrefix("device:", func(key, value string) error {
+				assert.Equal(t, "v-"+key, value)
+				keys = append(keys, key)
+				return nil
+			})
+		}))
+		assert.Equal(t, []string{"device:a", "device:b", "device:c"}, keys)
+
+		// Stop early
+		keys = nil
+		require.NoError(t, s.View(func(tx Transaction) error {
+			return tx.IteratePrefix("device:", func(key, value string) error {
+				keys = append(keys, key)
+				return ErrStopIteration
+			})
+		}))
+		assert.Equal(t, []string{"device:a"}, keys)
+
+		// Other callback errors skip the entry and continue
+		keys = nil
+		require.NoError(t, s.View(func(tx Transaction) error {
+			return tx.IteratePrefix("device:", func(key, value string) error {
+				keys = append(keys, key)
+				return errors.New("skip")
+			})
+		}))
+		assert.Len(t, keys, 3)
+
+		// An empty prefix visits every key
+		count := 0
+		require.NoError(t, s.View(func(tx Transaction) error {
+			return tx.IteratePrefix("", func(key, value string) error {
+				count++
+				return nil
+			})
+		}))
+		assert.Equal(t, 5, count)
+	})
+
+	t.Run("IterateAndDeleteRange", func(t *testing.T) {
+		s := open(t)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, s.Set(fmt.Sprintf("mqtt_log:%03d", i), "x"))
+		}
+		require.NoError(t, s.Set("other", "x"))
+
+		var keys []string
+		require.NoError(t, s.View(func(tx Transaction) error {
+			return tx.IterateRange("mqtt_log:003", "mqtt_log:006", func(key, value string) error {
+				keys = append(keys, key)
+				return nil
+			})
+		}))
+		assert.Equal(t, []string{"mqtt_log:003", "mqtt_log:004", "mqtt_log:005"}, keys)
+
+		var deleted int
+		require.NoError(t, s.Transaction(func(tx Transaction) error {
+			var err error
+			deleted, err = tx.DeleteRange("mqtt_log:", "mqtt_log:005")
+			return err
+		}))
+		assert.Equal(t, 5, deleted)
+
+		count, err := countKeys(s)
+		require.NoError(t, err)
+		assert.Equal(t, 6, count)
+	})
+
+	t.Run("Snapshot", func(t *testing.T) {
+		s := open(t)
+		snapshotter, ok := s.(Snapshotter)
+		require.True(t, ok, "backend must support snapshots")
+
+		require.NoError(t, s.Set("a", "old"))
+		var snapshot bytes.Buffer
+		require.NoError(t, snapshotter.Snapshot(&snapshot))
+
+		require.NoError(t, s.Set("a", "new"))
+		require.NoError(t, s.Set("b", "new"))
+
+		count, err := snapshotter.ValidateSnapshot(bytes.NewReader(snapshot.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		_, err = snapshotter.ValidateSnapshot(bytes.NewReader(snapshot.Bytes()[:snapshot.Len()/2]))
+		assert.Error(t, err)
+
+		restored, err := snapshotter.RestoreSnapshot(bytes.NewReader(snapshot.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, 1, restored)
+
+		value, err := s.Get("a")
+		require.NoError(t, err)
+		assert.Equal(t, "old", value)
+		exists, err := s.Exists("b")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		s := open(t)
+		snapshotter := s.(Snapshotter)
+
+		for i := 0; i < 100; i++ {
+			require.NoError(t, s.Set(fmt.Sprintf("key:%d", i), "value"))
+		}
+		require.NoError(t, snapshotter.Compact())
+
+		count, err := countKeys(s)
+		require.NoError(t, err)
+		assert.Equal(t, 100, count)
+
+		// Still writable after the file was rewritten
+		require.NoError(t, s.Set("key:new", "value"))
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		s := open(t)
+		require.NoError(t, s.Set("a", "1"))
+		require.NoError(t, s.Close())
+
+		assert.Error(t, s.Set("b", "2"))
+		_, err := s.Get("a")
+		assert.Error(t, err)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	for _, pair := range [][2]string{
+		{BackendBuntDB, BackendBolt},
+		{BackendBolt, BackendBuntDB},
+	} {
+		from, to := pair[0], pair[1]
+		t.Run(from+"_to_"+to, func(t *testing.T) {
+			src, err := Open(from, t.TempDir())
+			require.NoError(t, err)
+			defer src.Close()
+			dst, err := Open(to, t.TempDir())
+			require.NoError(t, err)
+			defer dst.Close()
+
+			for i := 0; i < 25; i++ {
+				require.NoError(t, src.Set(fmt.Sprintf("device:%02d", i), fmt.Sprintf(`{"id":%d}`, i)))
+			}
+
+			copied, err := Migrate(dst, src, 10)
+			require.NoError(t, err)
+			assert.Equal(t, 25, copied)
+
+			value, err := dst.Get("device:07")
+			require.NoError(t, err)
+			assert.Equal(t, `{"id":7}`, value)
+
+			// A second run would merge datasets and is refused
+			_, err = Migrate(dst, src, 10)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -2,8 +2,13 @@ package storage
 
 import "errors"
 
-// ErrStopIteration is returned to stop iteration
-var ErrStopIteration = errors.New("stop iteration")
+var (
+	// ErrStopIteration is returned to stop iteration
+	ErrStopIteration = errors.New("stop iteration")
+
+	// ErrNotFound is returned by Get for keys that do not exist
+	ErrNotFound = errors.New("not found")
+)
 
 // Storage defines the interface for data storage operations
 type Storage interface {
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const lockFileName = "controller.lock"
+
+// errLocked is returned by lockFile when another holder has the lock
+var errLocked = errors.New("lock held by another process")
+
+// DataLock is a shared lock on a storage directory. Long-running controller
+// processes hold it so that a restore from another process can tell the
+// storage is in use.
+type DataLock struct {
+	file *os.File
+}
+
+// LockData takes a shared lock on a storage directory
+func LockData(dataPath string) (*DataLock, error) {
+	file, err := openLockFile(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file, false); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock storage directory: %w", err)
+	}
+	return &DataLock{file: file}, nil
+}
+
+// Release drops the lock
+func (l *DataLock) Release() error {
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// dataInUse reports whether a controller process holds the lock of a
+// storage directory
+func dataInUse(dataPath string) (bool, error) {
+	file, err := openLockFile(dataPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	if err := lockFile(file, true); err != nil {
+		if errors.Is(err, errLocked) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, unlockFile(file)
+}
+
+func openLockFile(dataPath string) (*os.File, error) {
+	if err := os.MkdirAll(dataPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dataPath, lockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	return file, nil
+}
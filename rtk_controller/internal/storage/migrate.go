@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// DefaultMigrateBatchSize is the number of keys Migrate writes per
+// destination transaction
+const DefaultMigrateBatchSize = 1000
+
+// Migrate copies every key from src to dst and returns the number of keys
+// copied. dst must be empty so that a migration never merges two datasets;
+// src is only read. Keys are written in batches of batchSize per
+// transaction, and the key count of dst is checked afterwards.
+func Migrate(dst, src Storage, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultMigrateBatchSize
+	}
+
+	existing, err := countKeys(dst)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read destination: %w", err)
+	}
+	if existing > 0 {
+		return 0, fmt.Errorf("destination is not empty (%d keys)", existing)
+	}
+
+	type pair struct{ key, value string }
+	batch := make([]pair, 0, batchSize)
+	copied := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := dst.Transaction(func(tx Transaction) error {
+			for _, p := range batch {
+				if err := tx.Set(p.key, p.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		copied += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	var copyErr error
+	err = src.View(func(tx Transaction) error {
+		return tx.IteratePrefix("", func(key, value string) error {
+			batch = append(batch, pair{key, value})
+			if len(batch) < batchSize {
+				return nil
+			}
+			if copyErr = flush(); copyErr != nil {
+				return ErrStopIteration
+			}
+			return nil
+		})
+	})
+	if err == nil {
+		err = copyErr
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return copied, fmt.Errorf("migration failed after %d keys: %w", copied, err)
+	}
+
+	migrated, err := countKeys(dst)
+	if err != nil {
+		return copied, fmt.Errorf("failed to verify destination: %w", err)
+	}
+	if migrated != copied {
+		return copied, fmt.Errorf("destination has %d keys after copying %d", migrated, copied)
+	}
+	return copied, nil
+}
+
+// countKeys returns the number of keys in a storage
+func countKeys(s Storage) (int, error) {
+	count := 0
+	err := s.View(func(tx Transaction) error {
+		return tx.IteratePrefix("", func(key, value string) error {
+			count++
+			return nil
+		})
+	})
+	return count, err
+}
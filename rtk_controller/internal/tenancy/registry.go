@@ -0,0 +1,294 @@
+package tenancy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rtk_controller/internal/identity"
+	"rtk_controller/internal/qos"
+	"rtk_controller/internal/storage"
+	"rtk_controller/internal/topology"
+	"rtk_controller/pkg/types"
+	"rtk_controller/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Config holds tenant/site registry configuration
+type Config struct {
+	// Scope used when a request names no tenant or site
+	DefaultTenant string
+	DefaultSite   string
+
+	// MaxSites limits how many sites have managers at once; 0 means no limit
+	MaxSites int
+}
+
+// SiteDirectory lists the sites known to the device registry.
+// device.Manager implements it.
+type SiteDirectory interface {
+	HasSite(tenant, site string) bool
+	ListSites(tenant string) []*types.SiteInfo
+}
+
+// Site holds the managers of one tenant site
+type Site struct {
+	Tenant    string
+	Site      string
+	Topology  *topology.Manager
+	QoS       *qos.QoSManager
+	CreatedAt time.Time
+}
+
+// SiteStatus is a known or active site as reported by ListSites
+type SiteStatus struct {
+	types.SiteInfo
+	Active bool `json:"active"` // managers have been created for the site
+}
+
+// Registry creates per-site topology and QoS managers on demand, so that one
+// controller can serve many homes or offices
+type Registry struct {
+	config          Config
+	topologyStorage *storage.TopologyStorage
+	identityStorage *storage.IdentityStorage
+	identityManager *identity.Manager
+	topologyConfig  topology.ManagerConfig
+	qosConfig       *qos.QoSConfig
+	directory       SiteDirectory
+
+	sites map[string]*Site
+	mu    sync.Mutex
+}
+
+// NewRegistry creates a site registry. topologyConfig is the template for
+// per-site topology managers; its Tenant and Site are filled in per site.
+func NewRegistry(
+	config Config,
+	topologyStorage *storage.TopologyStorage,
+	identityStorage *storage.IdentityStorage,
+	identityManager *identity.Manager,
+	topologyConfig topology.ManagerConfig,
+) *Registry {
+	if config.DefaultTenant == "" {
+		config.DefaultTenant = "default"
+	}
+	if config.DefaultSite == "" {
+		config.DefaultSite = "default"
+	}
+
+	return &Registry{
+		config:          config,
+		topologyStorage: topologyStorage,
+		identityStorage: identityStorage,
+		identityManager: identityManager,
+		topologyConfig:  topologyConfig,
+		sites:           make(map[string]*Site),
+	}
+}
+
+// SetQoSConfig sets the configuration of per-site QoS managers; nil uses
+// the QoS defaults
+func (r *Registry) SetQoSConfig(config *qos.QoSConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.qosConfig = config
+}
+
+// SetSiteDirectory sets the source of known sites for ListSites
+func (r *Registry) SetSiteDirectory(directory SiteDirectory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.directory = directory
+}
+
+// DefaultScope returns the default tenant and site
+func (r *Registry) DefaultScope() (tenant, site string) {
+	return r.config.DefaultTenant, r.config.DefaultSite
+}
+
+// Resolve fills in an empty tenant or site from the default scope
+func (r *Registry) Resolve(tenant, site string) (string, string) {
+	if tenant == "" {
+		tenant = r.config.DefaultTenant
+	}
+	if site == "" {
+		site = r.config.DefaultSite
+	}
+	return tenant, site
+}
+
+// Get returns the managers of a site, creating them on first use. An empty
+// tenant or site selects the default. Other sites must be known to the site
+// directory, i.e. have reported devices or been registered, so that a
+// mistyped scope neither creates managers nor persists an empty topology.
+func (r *Registry) Get(tenant, site string) (*Site, error) {
+	tenant, site = r.Resolve(tenant, site)
+	if err := utils.ValidateTopicLevel("tenant", tenant); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateTopicLevel("site", site); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := tenant + ":" + site
+	if s, exists := r.sites[key]; exists {
+		return s, nil
+	}
+
+	if !r.isDefault(tenant, site) && (r.directory == nil || !r.directory.HasSite(tenant, site)) {
+		return nil, fmt.Errorf("unknown site %s/%s", tenant, site)
+	}
+
+	if r.config.MaxSites > 0 && len(r.sites) >= r.config.MaxSites {
+		return nil, fmt.Errorf("site limit reached (%d), cannot serve %s/%s", r.config.MaxSites, tenant, site)
+	}
+
+	topologyConfig := r.topologyConfig
+	topologyConfig.Tenant = tenant
+	topologyConfig.Site = site
+	topologyManager, err := topology.NewManager(r.topologyStorage, r.identityStorage, r.identityManager, topologyConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create topology manager for %s/%s: %w", tenant, site, err)
+	}
+
+	var qosConfig *qos.QoSConfig
+	if r.qosConfig != nil {
+		configCopy := *r.qosConfig
+		qosConfig = &configCopy
+	}
+
+	s := &Site{
+		Tenant:    tenant,
+		Site:      site,
+		Topology:  topologyManager,
+		QoS:       qos.NewQoSManager(qosConfig),
+		CreatedAt: time.Now(),
+	}
+	r.sites[key] = s
+
+	log.WithFields(log.Fields{
+		"tenant": tenant,
+		"site":   site,
+	}).Info("Created site managers")
+	return s, nil
+}
+
+// TopologyManager returns the topology manager of a site
+func (r *Registry) TopologyManager(tenant, site string) (*topology.Manager, error) {
+	s, err := r.Get(tenant, site)
+	if err != nil {
+		return nil, err
+	}
+	return s.Topology, nil
+}
+
+// QoSManager returns the QoS manager of a site
+func (r *Registry) QoSManager(tenant, site string) (*qos.QoSManager, error) {
+	s, err := r.Get(tenant, site)
+	if err != nil {
+		return nil, err
+	}
+	return s.QoS, nil
+}
+
+// Release stops and drops the managers of a site; they are recreated on
+// next use. The default site is shared with the rest of the controller and
+// is never released.
+func (r *Registry) Release(tenant, site string) bool {
+	tenant, site = r.Resolve(tenant, site)
+	if r.isDefault(tenant, site) {
+		return false
+	}
+
+	r.mu.Lock()
+	key := tenant + ":" + site
+	s, exists := r.sites[key]
+	delete(r.sites, key)
+	r.mu.Unlock()
+
+	if !exists {
+		return false
+	}
+	if s.Topology.IsRunning() {
+		if err := s.Topology.Stop(); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"tenant": tenant,
+				"site":   site,
+			}).Warn("Failed to stop site topology manager")
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"tenant": tenant,
+		"site":   site,
+	}).Info("Released site managers")
+	return true
+}
+
+func (r *Registry) isDefault(tenant, site string) bool {
+	return tenant == r.config.DefaultTenant && site == r.config.DefaultSite
+}
+
+// ListSites returns the sites known to the site directory together with
+// the sites that have managers, ordered by tenant and site. An empty tenant
+// lists every tenant.
+func (r *Registry) ListSites(tenant string) []SiteStatus {
+	r.mu.Lock()
+	directory := r.directory
+	active := make(map[string]*Site, len(r.sites))
+	for key, s := range r.sites {
+		active[key] = s
+	}
+	r.mu.Unlock()
+
+	var statuses []SiteStatus
+	seen := make(map[string]bool)
+	if directory != nil {
+		for _, info := range directory.ListSites(tenant) {
+			key := info.Tenant + ":" + info.Site
+			seen[key] = true
+			_, isActive := active[key]
+			statuses = append(statuses, SiteStatus{SiteInfo: *info, Active: isActive})
+		}
+	}
+
+	for key, s := range active {
+		if seen[key] || (tenant != "" && s.Tenant != tenant) {
+			continue
+		}
+		statuses = append(statuses, SiteStatus{
+			SiteInfo: types.SiteInfo{Tenant: s.Tenant, Site: s.Site, CreatedAt: s.CreatedAt},
+			Active:   true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Tenant != statuses[j].Tenant {
+			return statuses[i].Tenant < statuses[j].Tenant
+		}
+		return statuses[i].Site < statuses[j].Site
+	})
+	return statuses
+}
+
+// ParseScope parses a "tenant/site" scope. A bare name is a site of the
+// default tenant, which is returned empty.
+func ParseScope(scope string) (tenant, site string, err error) {
+	tenant, site, found := strings.Cut(scope, "/")
+	if !found {
+		tenant, site = "", scope
+	} else if err := utils.ValidateTopicLevel("tenant", tenant); err != nil {
+		return "", "", err
+	}
+	if err := utils.ValidateTopicLevel("site", site); err != nil {
+		return "", "", err
+	}
+	return tenant, site, nil
+}
@@ -0,0 +1,167 @@
+package tenancy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rtk_controller/internal/identity"
+	"rtk_controller/internal/storage"
+	"rtk_controller/internal/topology"
+	"rtk_controller/pkg/types"
+)
+
+type staticDirectory []*types.SiteInfo
+
+func (d staticDirectory) HasSite(tenant, site string) bool {
+	for _, info := range d {
+		if info.Tenant == tenant && info.Site == site {
+			return true
+		}
+	}
+	return false
+}
+
+func (d staticDirectory) ListSites(tenant string) []*types.SiteInfo {
+	var sites []*types.SiteInfo
+	for _, info := range d {
+		if tenant == "" || info.Tenant == tenant {
+			sites = append(sites, info)
+		}
+	}
+	return sites
+}
+
+func newTestRegistry(t *testing.T, config Config) *Registry {
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	identityStorage := storage.NewIdentityStorage(store)
+	return NewRegistry(config,
+		storage.NewTopologyStorage(store),
+		identityStorage,
+		identity.NewManager(identityStorage, identity.ManagerConfig{}),
+		topology.ManagerConfig{
+			TopologyUpdateInterval: time.Hour,
+			MetricsUpdateInterval:  time.Hour,
+			CleanupInterval:        time.Hour,
+			DiscoveryConfig: topology.DiscoveryConfig{
+				DeviceDiscoveryInterval: time.Hour,
+				ConnectionScanInterval:  time.Hour,
+			},
+		},
+	)
+}
+
+func TestRegistry_CreatesSiteManagersOnDemand(t *testing.T) {
+	registry := newTestRegistry(t, Config{DefaultTenant: "acme", DefaultSite: "hq", MaxSites: 2})
+	registry.SetSiteDirectory(staticDirectory{
+		{Tenant: "acme", Site: "branch"},
+		{Tenant: "acme", Site: "hq", Devices: 3},
+		{Tenant: "smith", Site: "home", Devices: 1},
+	})
+
+	// Empty scope selects the default site
+	defaultSite, err := registry.Get("", "")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", defaultSite.Tenant)
+	assert.Equal(t, "hq", defaultSite.Site)
+
+	current, err := defaultSite.Topology.GetCurrentTopology()
+	require.NoError(t, err)
+	assert.Equal(t, "acme", current.Tenant)
+	assert.Equal(t, "hq", current.Site)
+
+	// Managers are created once per site
+	qosManager, err := registry.QoSManager("acme", "hq")
+	require.NoError(t, err)
+	assert.Same(t, defaultSite.QoS, qosManager)
+
+	branch, err := registry.TopologyManager("acme", "branch")
+	require.NoError(t, err)
+	assert.NotSame(t, defaultSite.Topology, branch)
+	current, err = branch.GetCurrentTopology()
+	require.NoError(t, err)
+	assert.Equal(t, "branch", current.Site)
+
+	// Site limit and invalid names
+	_, err = registry.Get("smith", "home")
+	assert.Error(t, err)
+	_, err = registry.Get("acme", "a/b")
+	assert.Error(t, err)
+
+	statuses := registry.ListSites("")
+	require.Len(t, statuses, 3)
+	assert.Equal(t, "branch", statuses[0].Site)
+	assert.True(t, statuses[0].Active)
+	assert.Equal(t, "hq", statuses[1].Site)
+	assert.True(t, statuses[1].Active)
+	assert.Equal(t, 3, statuses[1].Devices)
+	assert.Equal(t, "smith", statuses[2].Tenant)
+	assert.False(t, statuses[2].Active)
+	assert.Len(t, registry.ListSites("smith"), 1)
+
+	// Releasing a site stops its managers and frees a slot under the limit
+	require.NoError(t, branch.Start())
+	assert.True(t, registry.Release("acme", "branch"))
+	assert.False(t, branch.IsRunning())
+	assert.False(t, registry.Release("acme", "branch"))
+	_, err = registry.Get("smith", "home")
+	assert.NoError(t, err)
+
+	// The default site stays
+	assert.False(t, registry.Release("", ""))
+}
+
+func TestRegistry_RejectsUnknownSites(t *testing.T) {
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	identityStorage := storage.NewIdentityStorage(store)
+	topologyStorage := storage.NewTopologyStorage(store)
+	registry := NewRegistry(Config{DefaultTenant: "acme", DefaultSite: "hq"},
+		topologyStorage, identityStorage,
+		identity.NewManager(identityStorage, identity.ManagerConfig{}),
+		topology.ManagerConfig{},
+	)
+
+	// Without a directory only the default site is served
+	_, err = registry.Get("", "")
+	require.NoError(t, err)
+	_, err = registry.Get("acme", "branch")
+	assert.Error(t, err)
+
+	registry.SetSiteDirectory(staticDirectory{{Tenant: "acme", Site: "hq"}})
+	_, err = registry.Get("acme", "typo")
+	assert.Error(t, err)
+	_, err = registry.TopologyManager("other", "hq")
+	assert.Error(t, err)
+
+	// Nothing is created or persisted for the rejected sites
+	assert.Len(t, registry.ListSites(""), 1)
+	_, err = topologyStorage.GetTopology("acme", "typo")
+	assert.Error(t, err)
+	_, err = topologyStorage.GetTopology("other", "hq")
+	assert.Error(t, err)
+}
+
+func TestParseScope(t *testing.T) {
+	tenant, site, err := ParseScope("acme/hq")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", tenant)
+	assert.Equal(t, "hq", site)
+
+	tenant, site, err = ParseScope("hq")
+	require.NoError(t, err)
+	assert.Equal(t, "", tenant)
+	assert.Equal(t, "hq", site)
+
+	for _, scope := range []string{"", "acme/", "/hq", "acme/hq/x", "acme/+"} {
+		_, _, err := ParseScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
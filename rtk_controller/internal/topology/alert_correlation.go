@@ -0,0 +1,247 @@
+package topology
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"rtk_controller/pkg/types"
+)
+
+// flapState tracks the raise/clear transitions of one alert fingerprint
+type flapState struct {
+	raised      bool
+	transitions []time.Time // within the flap window
+	flapping    bool
+	since       time.Time
+}
+
+// alertFingerprint identifies repeats of the same alert: the same type on
+// the same device, raised by the same rule
+func alertFingerprint(alertType TopologyAlertType, deviceID, macAddress, ruleID string) string {
+	sum := sha1.Sum([]byte(strings.Join([]string{
+		string(alertType),
+		normalizeDeviceKey(deviceID),
+		normalizeDeviceKey(macAddress),
+		ruleID,
+	}, "|")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// findDuplicateAlert returns the open alert with a fingerprint, if it last
+// occurred within the duplicate window; tas.mu must be held
+func (tas *TopologyAlertingSystem) findDuplicateAlert(fingerprint string, now time.Time) *TopologyAlert {
+	for _, alert := range tas.activeAlerts {
+		if alert.Fingerprint != fingerprint {
+			continue
+		}
+		if tas.config.DuplicateTimeWindow > 0 && now.Sub(alert.LastOccurrence) > tas.config.DuplicateTimeWindow {
+			continue
+		}
+		return alert
+	}
+	return nil
+}
+
+// findAlertByFingerprint returns the open alert with a fingerprint; tas.mu
+// must be held
+func (tas *TopologyAlertingSystem) findAlertByFingerprint(fingerprint string) *TopologyAlert {
+	for _, alert := range tas.activeAlerts {
+		if alert.Fingerprint == fingerprint {
+			return alert
+		}
+	}
+	return nil
+}
+
+// recordTransitionLocked records that an alert was raised or cleared and
+// reports whether it is flapping: changing state FlapThreshold times within
+// FlapWindow. Repeats of the current state are not transitions. tas.mu must
+// be held.
+func (tas *TopologyAlertingSystem) recordTransitionLocked(fingerprint string, raised bool, now time.Time) bool {
+	if tas.config.FlapThreshold <= 0 || tas.config.FlapWindow <= 0 {
+		return false
+	}
+
+	state, exists := tas.flapStates[fingerprint]
+	if !exists {
+		state = &flapState{raised: !raised}
+		tas.flapStates[fingerprint] = state
+	}
+	if state.raised == raised {
+		return state.flapping
+	}
+
+	state.raised = raised
+	state.transitions = append(pruneTransitions(state.transitions, now.Add(-tas.config.FlapWindow)), now)
+	if !state.flapping && len(state.transitions) >= tas.config.FlapThreshold {
+		state.flapping = true
+		state.since = now
+		tas.stats.FlappingAlerts++
+		if alert := tas.findAlertByFingerprint(fingerprint); alert != nil {
+			alert.Flapping = true
+			log.Printf("Alert %s is flapping (%d state changes in %s), holding notifications",
+				alert.ID, len(state.transitions), tas.config.FlapWindow)
+		}
+	}
+	return state.flapping
+}
+
+// processFlapping ends flapping for alerts that have kept one state for the
+// whole flap window. An alert that settled raised gets the notifications
+// held while it flapped; one that settled clear is resolved.
+func (tas *TopologyAlertingSystem) processFlapping(now time.Time) {
+	tas.mu.Lock()
+	defer tas.mu.Unlock()
+
+	var release []*TopologyAlert
+	for fingerprint, state := range tas.flapStates {
+		state.transitions = pruneTransitions(state.transitions, now.Add(-tas.config.FlapWindow))
+		if len(state.transitions) > 0 {
+			continue
+		}
+
+		alert := tas.findAlertByFingerprint(fingerprint)
+		if state.flapping {
+			state.flapping = false
+			if alert != nil {
+				alert.Flapping = false
+				alert.UpdatedAt = now
+				switch {
+				case !state.raised:
+					tas.resolveAlertLocked(alert.ID, "flap_detection", "settled after flapping", now)
+				case alert.NotificationsHeld && alert.ParentID == "":
+					alert.NotificationsHeld = false
+					release = append(release, alert)
+				}
+				log.Printf("Alert %s stopped flapping after %s", alert.ID, now.Sub(state.since).Round(time.Second))
+			}
+		}
+		if !state.raised || alert == nil {
+			delete(tas.flapStates, fingerprint)
+		}
+	}
+
+	for _, alert := range release {
+		go tas.processAlertActions(alert)
+	}
+}
+
+func pruneTransitions(transitions []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(transitions) && transitions[i].Before(cutoff) {
+		i++
+	}
+	return transitions[i:]
+}
+
+// groupAlertLocked links an alert to the outage of its upstream device. An
+// alert for a device behind an AP (or switch) that has an open outage alert
+// becomes a child of that alert and sends no notifications of its own; an
+// outage alert for an AP adopts the open alerts of the devices behind it.
+// tas.mu must be held.
+func (tas *TopologyAlertingSystem) groupAlertLocked(alert *TopologyAlert) {
+	if !tas.config.GroupByUpstream || tas.topologyManager == nil {
+		return
+	}
+	topology := tas.topologyManager.GetTopology()
+	if topology == nil {
+		return
+	}
+	links := newUpstreamLinks(topology)
+
+	// Join the open incident of the upstream device
+	if upstream := links.upstreamOf(alert.DeviceID); upstream != "" {
+		for _, parent := range tas.activeAlerts {
+			if parent.ID != alert.ID && parent.ParentID == "" &&
+				isOutageAlert(parent) && links.canonical(parent.DeviceID) == upstream {
+				tas.attachChildLocked(parent, alert)
+				return
+			}
+		}
+	}
+
+	// Adopt the open alerts of the devices behind this one
+	if !isOutageAlert(alert) {
+		return
+	}
+	device := links.canonical(alert.DeviceID)
+	for _, child := range tas.activeAlerts {
+		if child.ID != alert.ID && child.ParentID == "" && len(child.RelatedAlerts) == 0 &&
+			links.upstreamOf(child.DeviceID) == device {
+			tas.attachChildLocked(alert, child)
+		}
+	}
+}
+
+// isOutageAlert reports whether an alert means the device is unreachable,
+// so alerts of the devices behind it are consequences of it
+func isOutageAlert(alert *TopologyAlert) bool {
+	switch alert.Type {
+	case AlertDeviceOffline, AlertConnectionLost:
+		return true
+	}
+	return false
+}
+
+func (tas *TopologyAlertingSystem) attachChildLocked(parent, child *TopologyAlert) {
+	child.ParentID = parent.ID
+	child.NotificationsHeld = true
+	parent.RelatedAlerts = append(parent.RelatedAlerts, child.ID)
+	found := false
+	for _, device := range parent.AffectedDevices {
+		if device == child.DeviceID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		parent.AffectedDevices = append(parent.AffectedDevices, child.DeviceID)
+	}
+	parent.UpdatedAt = time.Now()
+	tas.stats.GroupedAlerts++
+
+	log.Printf("Grouped alert %s under %s", child.ID, parent.ID)
+}
+
+// upstreamLinks maps devices to the device they connect through. Devices
+// are known by ID or primary MAC, so both resolve to the device ID.
+type upstreamLinks struct {
+	aliases  map[string]string // normalized ID or MAC -> device ID
+	upstream map[string]string // device ID -> upstream device ID
+}
+
+func newUpstreamLinks(topology *types.NetworkTopology) *upstreamLinks {
+	links := &upstreamLinks{
+		aliases:  make(map[string]string),
+		upstream: make(map[string]string),
+	}
+	for id, device := range topology.Devices {
+		links.aliases[normalizeDeviceKey(id)] = id
+		if device.PrimaryMAC != "" {
+			links.aliases[normalizeDeviceKey(device.PrimaryMAC)] = id
+		}
+	}
+	// Connections run from the client to the device it attaches to
+	for _, connection := range topology.Connections {
+		from, to := links.canonical(connection.FromDeviceID), links.canonical(connection.ToDeviceID)
+		if from != to {
+			links.upstream[from] = to
+		}
+	}
+	return links
+}
+
+func (l *upstreamLinks) canonical(device string) string {
+	key := normalizeDeviceKey(device)
+	if id, exists := l.aliases[key]; exists {
+		return id
+	}
+	return key
+}
+
+func (l *upstreamLinks) upstreamOf(device string) string {
+	return l.upstream[l.canonical(device)]
+}
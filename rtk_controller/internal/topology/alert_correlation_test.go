@@ -0,0 +1,162 @@
+package topology
+
+import (
+	"testing"
+	"time"
+
+	"rtk_controller/internal/config"
+	"rtk_controller/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertingSystem_Deduplication(t *testing.T) {
+	tas := newTestAlertingSystem(t, config.AlertingConfig{Deduplicate: true})
+
+	first, err := tas.CreateAlert(AlertQualityDegraded, SeverityWarning, "ap-1", "", "Quality degraded", "", AlertContext{})
+	require.NoError(t, err)
+	again, err := tas.CreateAlert(AlertQualityDegraded, SeverityWarning, "AP-1", "", "Quality degraded", "", AlertContext{})
+	require.NoError(t, err)
+	assert.Same(t, first, again)
+	assert.Equal(t, 2, first.Frequency)
+
+	other, err := tas.CreateAlert(AlertQualityDegraded, SeverityWarning, "ap-2", "", "Quality degraded", "", AlertContext{})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Fingerprint, other.Fingerprint)
+
+	stats := tas.GetStats()
+	assert.Equal(t, int64(2), stats.TotalAlerts)
+	assert.Equal(t, int64(1), stats.DeduplicatedAlerts)
+
+	// A resolved alert is raised afresh
+	require.NoError(t, tas.ResolveAlert(first.ID, "test", "fixed"))
+	time.Sleep(2 * time.Millisecond)
+	raised, err := tas.CreateAlert(AlertQualityDegraded, SeverityWarning, "ap-1", "", "Quality degraded", "", AlertContext{})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, raised.ID)
+	assert.Equal(t, 1, raised.Frequency)
+}
+
+func TestAlertingSystem_GroupByUpstream(t *testing.T) {
+	tas := newTestAlertingSystem(t, config.AlertingConfig{Deduplicate: true, GroupByUpstream: true})
+	tas.topologyManager = &Manager{topology: &types.NetworkTopology{
+		Devices: map[string]*types.NetworkDevice{
+			"ap-1":   {DeviceID: "ap-1", PrimaryMAC: "AA:BB:CC:00:00:10"},
+			"phone":  {DeviceID: "phone", PrimaryMAC: "aa:bb:cc:00:00:01"},
+			"laptop": {DeviceID: "laptop", PrimaryMAC: "aa:bb:cc:00:00:02"},
+		},
+		Connections: []types.DeviceConnection{
+			{FromDeviceID: "aa:bb:cc:00:00:01", ToDeviceID: "ap-1"},
+			{FromDeviceID: "aa:bb:cc:00:00:02", ToDeviceID: "aa:bb:cc:00:00:10"},
+		},
+	}}
+
+	// The AP's outage adopts the alerts already open for its clients
+	phone, err := tas.CreateAlert(AlertQualityDegraded, SeverityWarning, "aa:bb:cc:00:00:01", "aa:bb:cc:00:00:01", "Quality degraded", "", AlertContext{})
+	require.NoError(t, err)
+	assert.Empty(t, phone.ParentID)
+	time.Sleep(2 * time.Millisecond)
+	ap, err := tas.CreateAlert(AlertDeviceOffline, SeverityCritical, "ap-1", "", "AP offline", "", AlertContext{})
+	require.NoError(t, err)
+	assert.Equal(t, ap.ID, phone.ParentID)
+	assert.True(t, phone.NotificationsHeld)
+
+	// Alerts raised while the AP is down join its incident
+	time.Sleep(2 * time.Millisecond)
+	laptop, err := tas.CreateAlert(AlertConnectionLost, SeverityError, "laptop", "", "Connection lost", "", AlertContext{})
+	require.NoError(t, err)
+	assert.Equal(t, ap.ID, laptop.ParentID)
+	assert.True(t, laptop.NotificationsHeld)
+	assert.False(t, ap.NotificationsHeld)
+	assert.ElementsMatch(t, []string{phone.ID, laptop.ID}, ap.RelatedAlerts)
+	assert.ElementsMatch(t, []string{"ap-1", "aa:bb:cc:00:00:01", "laptop"}, ap.AffectedDevices)
+	assert.Equal(t, int64(2), tas.GetStats().GroupedAlerts)
+
+	// Resolving the incident resolves the grouped alerts
+	require.NoError(t, tas.ResolveAlert(ap.ID, "test", "AP rebooted"))
+	assert.Empty(t, tas.GetActiveAlerts())
+	assert.Equal(t, "parent alert resolved: AP rebooted", laptop.CustomFields["resolution_reason"])
+}
+
+func TestAlertingSystem_FlapSuppression(t *testing.T) {
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		Deduplicate:   true,
+		FlapThreshold: 4,
+		FlapWindow:    "15m",
+	})
+	require.NoError(t, tas.AddAlertRule(AlertRule{
+		ID:          "device_offline",
+		Name:        "Device offline",
+		Enabled:     true,
+		Expression:  "online == 0",
+		Severity:    SeverityError,
+		AutoResolve: true,
+	}))
+	rule := tas.GetAlertRules()[0]
+
+	device := "aa:bb:cc:00:00:01"
+	now := time.Now().Truncate(time.Minute)
+	at := func(minute int) time.Time { return now.Add(time.Duration(minute) * time.Minute) }
+	evaluate := func(minute int, online float64) {
+		tas.metricHistory.Add(MetricSample{Device: device, Metric: "online", Value: online, Timestamp: at(minute)})
+		tas.evaluateRule(rule, at(minute))
+	}
+
+	evaluate(0, 0) // raised
+	evaluate(1, 1) // cleared
+	require.Empty(t, tas.GetActiveAlerts())
+	evaluate(2, 0) // raised
+	evaluate(3, 1) // cleared, fourth change: flapping
+
+	// Held open rather than resolved while flapping
+	alerts := tas.GetActiveAlerts()
+	require.Len(t, alerts, 1)
+	alert := tas.activeAlerts[alerts[0].ID]
+	assert.True(t, alert.Flapping)
+	evaluate(4, 0)
+	evaluate(5, 1)
+	assert.Len(t, tas.GetActiveAlerts(), 1)
+	assert.Equal(t, int64(1), tas.GetStats().FlappingAlerts)
+
+	// Still changing within the window
+	tas.processFlapping(at(10))
+	assert.Len(t, tas.GetActiveAlerts(), 1)
+
+	// Settled clear for the whole window: resolved
+	tas.processFlapping(at(21))
+	assert.Empty(t, tas.GetActiveAlerts())
+	assert.False(t, alert.Flapping)
+	assert.Equal(t, "settled after flapping", alert.CustomFields["resolution_reason"])
+	assert.Empty(t, tas.flapStates)
+}
+
+func TestAlertingSystem_FlappingHoldsNotifications(t *testing.T) {
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		Deduplicate:   true,
+		FlapThreshold: 3,
+		FlapWindow:    "10m",
+	})
+
+	raise := func() *TopologyAlert {
+		alert, err := tas.CreateAlert(AlertDeviceOffline, SeverityError, "ap-1", "", "AP offline", "", AlertContext{})
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+		return alert
+	}
+
+	first := raise()
+	assert.False(t, first.NotificationsHeld)
+	require.NoError(t, tas.ResolveAlert(first.ID, "test", "back online"))
+	flapping := raise()
+	assert.True(t, flapping.Flapping)
+	assert.True(t, flapping.NotificationsHeld)
+
+	// Settled raised: the held notifications are released
+	tas.processFlapping(time.Now().Add(11 * time.Minute))
+	tas.mu.RLock()
+	assert.False(t, flapping.Flapping)
+	assert.False(t, flapping.NotificationsHeld)
+	tas.mu.RUnlock()
+	assert.Len(t, tas.GetActiveAlerts(), 1)
+}
@@ -0,0 +1,369 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rtk_controller/pkg/utils"
+)
+
+// defaultMetricRetention is how long sampled metrics are kept for rule
+// evaluation when no rule needs more
+const defaultMetricRetention = time.Hour
+
+// MetricSample is one value of a device metric that alert rules evaluate
+type MetricSample struct {
+	Device    string // client MAC address or device ID
+	Metric    string
+	Value     float64
+	Timestamp time.Time
+}
+
+// MetricHistory keeps time ordered metric samples per device
+type MetricHistory struct {
+	series map[string]map[string][]MetricSample // device -> metric -> samples
+	mu     sync.RWMutex
+}
+
+// NewMetricHistory creates an empty metric history
+func NewMetricHistory() *MetricHistory {
+	return &MetricHistory{
+		series: make(map[string]map[string][]MetricSample),
+	}
+}
+
+// Add records samples. A sample with the same timestamp as the latest one
+// of its series replaces it.
+func (h *MetricHistory) Add(samples ...MetricSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, sample := range samples {
+		sample.Device = strings.ToLower(sample.Device)
+		metrics, exists := h.series[sample.Device]
+		if !exists {
+			metrics = make(map[string][]MetricSample)
+			h.series[sample.Device] = metrics
+		}
+
+		series := metrics[sample.Metric]
+		n := len(series)
+		switch {
+		case n == 0 || series[n-1].Timestamp.Before(sample.Timestamp):
+			series = append(series, sample)
+		case series[n-1].Timestamp.Equal(sample.Timestamp):
+			series[n-1] = sample
+		default:
+			// Out of order, keep the series sorted
+			i := sort.Search(n, func(i int) bool { return !series[i].Timestamp.Before(sample.Timestamp) })
+			if series[i].Timestamp.Equal(sample.Timestamp) {
+				series[i] = sample
+			} else {
+				series = append(series, MetricSample{})
+				copy(series[i+1:], series[i:])
+				series[i] = sample
+			}
+		}
+		metrics[sample.Metric] = series
+	}
+}
+
+// Series returns the samples of one metric of a device, oldest first
+func (h *MetricHistory) Series(device, metric string) []MetricSample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	series := h.series[strings.ToLower(device)][metric]
+	return append([]MetricSample(nil), series...)
+}
+
+// Devices returns the devices with samples of any of the metrics, or of
+// any metric at all when none are given
+func (h *MetricHistory) Devices(metrics ...string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var devices []string
+	for device, series := range h.series {
+		if len(metrics) == 0 {
+			devices = append(devices, device)
+			continue
+		}
+		for _, metric := range metrics {
+			if len(series[metric]) > 0 {
+				devices = append(devices, device)
+				break
+			}
+		}
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+// Len returns the number of samples held
+func (h *MetricHistory) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := 0
+	for _, metrics := range h.series {
+		for _, series := range metrics {
+			count += len(series)
+		}
+	}
+	return count
+}
+
+// Prune drops samples older than cutoff. The latest sample of each series
+// is kept so absent() can still tell the metric was reported.
+func (h *MetricHistory) Prune(cutoff time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, metrics := range h.series {
+		for metric, series := range metrics {
+			i := sort.Search(len(series), func(i int) bool { return !series[i].Timestamp.Before(cutoff) })
+			if i == len(series) {
+				i = len(series) - 1
+			}
+			if i > 0 {
+				metrics[metric] = append([]MetricSample(nil), series[i:]...)
+			}
+		}
+	}
+}
+
+// RuleFiring is a period during which a rule fired for a device
+type RuleFiring struct {
+	Device  string
+	Start   time.Time
+	End     time.Time // zero if still firing at the end of the test
+	Results []ClauseResult
+}
+
+// RuleTestResult reports when a rule would have fired over a span of
+// history
+type RuleTestResult struct {
+	RuleID      string
+	Expression  string
+	Since       time.Time
+	Until       time.Time
+	Step        time.Duration
+	Devices     int // devices the rule applies to
+	Samples     int
+	Evaluations int
+	Firings     []RuleFiring
+}
+
+// TestAlertRule evaluates a rule against recorded metric history every step
+// between since and until, the way the alert processing loop would have
+func TestAlertRule(rule AlertRule, history *MetricHistory, since, until time.Time, step time.Duration, lookup IdentityLookup) (*RuleTestResult, error) {
+	expr := rule.compiled
+	if expr == nil {
+		if rule.Expression == "" {
+			return nil, fmt.Errorf("rule %s has no expression", rule.ID)
+		}
+		var err error
+		if expr, err = ParseRuleExpression(rule.Expression); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+	}
+	if !until.After(since) {
+		return nil, fmt.Errorf("test period is empty")
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+
+	result := &RuleTestResult{
+		RuleID:     rule.ID,
+		Expression: expr.Source,
+		Since:      since,
+		Until:      until,
+		Step:       step,
+		Samples:    history.Len(),
+	}
+
+	for _, device := range history.Devices(expr.Metrics()...) {
+		if !expr.AppliesTo(device, lookup) {
+			continue
+		}
+		result.Devices++
+
+		var current *RuleFiring
+		for at := since; !at.After(until); at = at.Add(step) {
+			result.Evaluations++
+			fired, results := expr.Evaluate(history, device, at)
+			switch {
+			case fired && current == nil:
+				current = &RuleFiring{Device: device, Start: at, Results: results}
+			case !fired && current != nil:
+				current.End = at
+				result.Firings = append(result.Firings, *current)
+				current = nil
+			}
+		}
+		if current != nil {
+			result.Firings = append(result.Firings, *current)
+		}
+	}
+
+	return result, nil
+}
+
+// ExtractMetricSamples turns a logged MQTT message into metric samples.
+// Numeric and boolean fields become metrics named by their JSON path,
+// arrays of objects with a mac_address or mac field become samples of
+// that client, and lwt messages report online as 0 or 1.
+func ExtractMetricSamples(topic string, payload []byte, timestamp time.Time) []MetricSample {
+	_, _, deviceID, messageType, _ := utils.ExtractTopicParts(topic)
+	if deviceID == "" || strings.HasPrefix(deviceID, "_") {
+		return nil
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil
+	}
+	if ts := payloadTimestamp(data); !ts.IsZero() {
+		timestamp = ts
+	}
+
+	if messageType == "lwt" {
+		online := 0.0
+		if status, _ := data["status"].(string); status == "online" {
+			online = 1
+		}
+		return []MetricSample{{Device: deviceID, Metric: "online", Value: online, Timestamp: timestamp}}
+	}
+
+	var samples []MetricSample
+	if messageType == "state" {
+		samples = append(samples, MetricSample{Device: deviceID, Metric: "online", Value: 1, Timestamp: timestamp})
+	}
+	return appendPayloadSamples(samples, deviceID, "", data, timestamp)
+}
+
+func appendPayloadSamples(samples []MetricSample, device, prefix string, data map[string]interface{}, timestamp time.Time) []MetricSample {
+	for key, value := range data {
+		if prefix == "" && (key == "timestamp" || key == "ts" || key == "schema") {
+			continue
+		}
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case float64:
+			samples = append(samples, MetricSample{Device: device, Metric: name, Value: v, Timestamp: timestamp})
+		case bool:
+			value := 0.0
+			if v {
+				value = 1
+			}
+			samples = append(samples, MetricSample{Device: device, Metric: name, Value: value, Timestamp: timestamp})
+		case map[string]interface{}:
+			samples = appendPayloadSamples(samples, device, name, v, timestamp)
+		case []interface{}:
+			for _, item := range v {
+				object, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				mac, _ := object["mac_address"].(string)
+				if mac == "" {
+					mac, _ = object["mac"].(string)
+				}
+				if mac != "" {
+					samples = appendPayloadSamples(samples, mac, "", object, timestamp)
+				}
+			}
+		}
+	}
+	return samples
+}
+
+// payloadTimestamp returns the message's own timestamp in milliseconds, if
+// it has one
+func payloadTimestamp(data map[string]interface{}) time.Time {
+	for _, key := range []string{"timestamp", "ts"} {
+		if ms, ok := data[key].(float64); ok && ms > 0 {
+			return time.UnixMilli(int64(ms))
+		}
+	}
+	return time.Time{}
+}
+
+// collectMetricSamples samples the live metrics alert rules evaluate: the
+// quality monitor's signal and performance figures, online state from the
+// topology and per-client roams in the last hour
+func (tas *TopologyAlertingSystem) collectMetricSamples(now time.Time) []MetricSample {
+	var samples []MetricSample
+
+	if tas.qualityMonitor != nil {
+		for _, metrics := range tas.qualityMonitor.GetAllConnectionQuality() {
+			device := metrics.MacAddress
+			if device == "" {
+				device = metrics.DeviceID
+			}
+			timestamp := metrics.LastUpdate
+			if timestamp.IsZero() {
+				timestamp = now
+			}
+
+			values := map[string]float64{
+				"snr":             metrics.SignalStrength.SNR,
+				"quality":         metrics.OverallQuality.Overall,
+				"latency_ms":      metrics.Latency.CurrentLatencyMs,
+				"packet_loss":     metrics.PacketLoss.CurrentLossRate,
+				"jitter_ms":       metrics.Jitter.CurrentJitterMs,
+				"throughput_mbps": metrics.Throughput.CurrentThroughputMbps,
+			}
+			if metrics.SignalStrength.CurrentRSSI != 0 {
+				values["rssi"] = float64(metrics.SignalStrength.CurrentRSSI)
+			}
+			for metric, value := range values {
+				samples = append(samples, MetricSample{Device: device, Metric: metric, Value: value, Timestamp: timestamp})
+			}
+		}
+	}
+
+	if tas.topologyManager != nil {
+		if topology := tas.topologyManager.GetTopology(); topology != nil {
+			for id, device := range topology.Devices {
+				key := device.PrimaryMAC
+				if key == "" {
+					key = id
+				}
+				online := 0.0
+				if device.Online {
+					online = 1
+				}
+				samples = append(samples, MetricSample{Device: key, Metric: "online", Value: online, Timestamp: now})
+			}
+		}
+	}
+
+	if tas.roamingDetector != nil {
+		roams := make(map[string]int)
+		for _, event := range tas.roamingDetector.GetRoamingEvents(now.Add(-time.Hour), "") {
+			roams[strings.ToLower(event.MacAddress)]++
+		}
+		// Clients that stopped roaming go back to zero
+		for _, device := range tas.metricHistory.Devices("roaming_frequency") {
+			if _, exists := roams[device]; !exists {
+				roams[device] = 0
+			}
+		}
+		for mac, count := range roams {
+			samples = append(samples, MetricSample{Device: mac, Metric: "roaming_frequency", Value: float64(count), Timestamp: now})
+		}
+	}
+
+	return samples
+}
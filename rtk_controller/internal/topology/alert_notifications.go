@@ -0,0 +1,797 @@
+package topology
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rtk_controller/internal/config"
+)
+
+// AlertsTopic is the MQTT topic alerts are published to by mqtt routes
+// without a target
+const AlertsTopic = "rtk/v1/%s/%s/_controller/alerts"
+
+// maxNotificationBackoff caps the delay between notification retries
+const maxNotificationBackoff = time.Hour
+
+// syslogFacility is local0; syslogEnterpriseID is used in the structured
+// data ID
+const (
+	syslogFacility     = 16
+	syslogEnterpriseID = "rtk@32473"
+)
+
+// NotificationRoute sends alerts matching its severity filter to one target
+type NotificationRoute struct {
+	Name        string
+	Target      NotificationTarget
+	Severities  []AlertSeverity // only these severities, empty for any
+	MinSeverity AlertSeverity   // lowest severity sent, empty for any
+	Secret      string          // HMAC key for webhook routes
+	Headers     map[string]string
+}
+
+// SMTPSettings holds the mail server used by email routes
+type SMTPSettings struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// AlertNotification is the JSON body of webhook and MQTT alert
+// notifications
+type AlertNotification struct {
+	ID                 string            `json:"id"`
+	Route              string            `json:"route"`
+	Type               TopologyAlertType `json:"type"`
+	Severity           AlertSeverity     `json:"severity"`
+	Status             AlertStatus       `json:"status"`
+	Category           AlertCategory     `json:"category,omitempty"`
+	Tenant             string            `json:"tenant"`
+	Site               string            `json:"site"`
+	DeviceID           string            `json:"device_id,omitempty"`
+	MacAddress         string            `json:"mac_address,omitempty"`
+	FriendlyName       string            `json:"friendly_name,omitempty"`
+	Title              string            `json:"title"`
+	Description        string            `json:"description,omitempty"`
+	Message            string            `json:"message,omitempty"`
+	Timestamp          int64             `json:"ts"`
+	LastOccurrence     int64             `json:"last_occurrence"`
+	Frequency          int               `json:"frequency"`
+	EscalationLevel    int               `json:"escalation_level,omitempty"`
+	RecommendedActions []string          `json:"recommended_actions,omitempty"`
+}
+
+// slackMessage is the body of a Slack-compatible incoming webhook
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color     string       `json:"color,omitempty"`
+	Title     string       `json:"title"`
+	Text      string       `json:"text,omitempty"`
+	Fields    []slackField `json:"fields,omitempty"`
+	Footer    string       `json:"footer,omitempty"`
+	Timestamp int64        `json:"ts"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// ApplyConfig loads notification routes, the SMTP server, retry settings
+// and alert rule files. Call it before Start.
+func (tas *TopologyAlertingSystem) ApplyConfig(cfg config.AlertingConfig) error {
+	var timeout, retryInterval time.Duration
+	var err error
+	if cfg.Timeout != "" {
+		if timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			return fmt.Errorf("invalid alerting.timeout: %w", err)
+		}
+	}
+	if cfg.RetryInterval != "" {
+		if retryInterval, err = time.ParseDuration(cfg.RetryInterval); err != nil {
+			return fmt.Errorf("invalid alerting.retry_interval: %w", err)
+		}
+		if retryInterval <= 0 {
+			return fmt.Errorf("invalid alerting.retry_interval: must be positive")
+		}
+	}
+
+	routes := make([]NotificationRoute, 0, len(cfg.Routes))
+	for i, rc := range cfg.Routes {
+		name := rc.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", rc.Type, i+1)
+		}
+
+		route := NotificationRoute{
+			Name: name,
+			Target: NotificationTarget{
+				Type:    NotificationType(rc.Type),
+				Target:  rc.Target,
+				Enabled: !rc.Disabled,
+			},
+			MinSeverity: AlertSeverity(rc.MinSeverity),
+			Secret:      rc.Secret,
+			Headers:     rc.Headers,
+		}
+
+		switch route.Target.Type {
+		case NotificationEmail, NotificationWebhook, NotificationSlack, NotificationSyslog:
+			if rc.Target == "" {
+				return fmt.Errorf("notification route %s has no target", name)
+			}
+		case NotificationMQTT:
+			// An empty target publishes to AlertsTopic
+		default:
+			return fmt.Errorf("notification route %s: unsupported type %q", name, rc.Type)
+		}
+		if route.Target.Type == NotificationEmail && (cfg.SMTP.Host == "" || cfg.SMTP.From == "") {
+			return fmt.Errorf("notification route %s: email routes need alerting.smtp.host and alerting.smtp.from", name)
+		}
+		if route.Target.Type == NotificationSyslog {
+			if _, _, err := syslogAddress(rc.Target); err != nil {
+				return fmt.Errorf("notification route %s: %w", name, err)
+			}
+		}
+
+		if rc.MinSeverity != "" && severityRank(route.MinSeverity) < 0 {
+			return fmt.Errorf("notification route %s: unknown severity %q", name, rc.MinSeverity)
+		}
+		for _, severity := range rc.Severities {
+			if severityRank(AlertSeverity(severity)) < 0 {
+				return fmt.Errorf("notification route %s: unknown severity %q", name, severity)
+			}
+			route.Severities = append(route.Severities, AlertSeverity(severity))
+		}
+
+		routes = append(routes, route)
+	}
+
+	rules, err := LoadAlertRuleFiles(cfg.RuleFiles)
+	if err != nil {
+		return fmt.Errorf("invalid alerting.rule_files: %w", err)
+	}
+
+	var dedupWindow, flapWindow time.Duration
+	if cfg.DedupWindow != "" {
+		if dedupWindow, err = time.ParseDuration(cfg.DedupWindow); err != nil {
+			return fmt.Errorf("invalid alerting.dedup_window: %w", err)
+		}
+	}
+	if cfg.FlapThreshold < 0 {
+		return fmt.Errorf("invalid alerting.flap_threshold: must not be negative")
+	}
+	if cfg.FlapThreshold > 0 {
+		if flapWindow, err = time.ParseDuration(cfg.FlapWindow); err != nil {
+			return fmt.Errorf("invalid alerting.flap_window: %w", err)
+		}
+		if flapWindow <= 0 {
+			return fmt.Errorf("invalid alerting.flap_window: must be positive")
+		}
+	}
+
+	tas.mu.Lock()
+	defer tas.mu.Unlock()
+	tas.config.RuleFiles = cfg.RuleFiles
+	tas.config.WatchRuleFiles = cfg.WatchRules
+	tas.replaceFileRulesLocked(rules)
+	tas.config.DuplicateAlertSuppression = cfg.Deduplicate
+	tas.config.DuplicateTimeWindow = dedupWindow
+	tas.config.GroupByUpstream = cfg.GroupByUpstream
+	tas.config.FlapThreshold = cfg.FlapThreshold
+	tas.config.FlapWindow = flapWindow
+	tas.config.NotificationRoutes = routes
+	tas.config.SMTP = SMTPSettings{
+		Host:     cfg.SMTP.Host,
+		Port:     cfg.SMTP.Port,
+		Username: cfg.SMTP.Username,
+		Password: cfg.SMTP.Password,
+		From:     cfg.SMTP.From,
+	}
+	if timeout > 0 {
+		tas.config.NotificationTimeout = timeout
+	}
+	if retryInterval > 0 {
+		tas.config.NotificationRetryInterval = retryInterval
+	}
+	tas.config.NotificationRetries = cfg.MaxRetries
+	return nil
+}
+
+// SetNotificationPublisher sets the MQTT publisher used by mqtt routes
+func (tas *TopologyAlertingSystem) SetNotificationPublisher(publisher EventPublisher) {
+	tas.mu.Lock()
+	defer tas.mu.Unlock()
+	tas.publisher = publisher
+}
+
+// Matches reports whether the route sends alerts of a severity
+func (r NotificationRoute) Matches(severity AlertSeverity) bool {
+	if !r.Target.Enabled {
+		return false
+	}
+	if len(r.Severities) > 0 {
+		found := false
+		for _, s := range r.Severities {
+			if s == severity {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.MinSeverity != "" && severityRank(severity) < severityRank(r.MinSeverity) {
+		return false
+	}
+	return true
+}
+
+// severityRank orders severities, returning -1 for unknown ones
+func severityRank(severity AlertSeverity) int {
+	switch severity {
+	case SeverityInfo, SeverityLow:
+		return 0
+	case SeverityWarning, SeverityMedium:
+		return 1
+	case SeverityError, SeverityHigh:
+		return 2
+	case SeverityCritical:
+		return 3
+	default:
+		return -1
+	}
+}
+
+func (tas *TopologyAlertingSystem) getNotificationRoutes(alert *TopologyAlert) []NotificationRoute {
+	tas.mu.RLock()
+	defer tas.mu.RUnlock()
+
+	var routes []NotificationRoute
+	for _, route := range tas.config.NotificationRoutes {
+		if route.Matches(alert.Severity) {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+func (tas *TopologyAlertingSystem) sendNotifications(alert *TopologyAlert) {
+	tas.notify(alert, tas.getNotificationRoutes(alert))
+}
+
+// notify sends an alert through routes without waiting for them. Each
+// route is delivered on its own so a slow target does not hold up the
+// others; its record stays pending until the attempt finishes. Failed
+// deliveries are picked up by retryFailedNotifications.
+func (tas *TopologyAlertingSystem) notify(alert *TopologyAlert, routes []NotificationRoute) {
+	if len(routes) == 0 {
+		return
+	}
+
+	// Send from a copy so the alert can change while requests are in flight
+	tas.mu.Lock()
+	snapshot := *alert
+	first := len(alert.NotificationsSent)
+	for _, route := range routes {
+		alert.NotificationsSent = append(alert.NotificationsSent, NotificationRecord{
+			Type:   route.Target.Type,
+			Target: route.Target.Target,
+			Route:  route.Name,
+			Status: NotificationPending,
+			route:  route,
+		})
+	}
+	tas.mu.Unlock()
+
+	for i, route := range routes {
+		tas.notifications.Add(1)
+		go func(index int, route NotificationRoute) {
+			defer tas.notifications.Done()
+			response, err := tas.sendNotification(route, &snapshot)
+
+			tas.mu.Lock()
+			defer tas.mu.Unlock()
+			tas.recordNotificationAttempt(&alert.NotificationsSent[index], response, err)
+		}(first+i, route)
+	}
+}
+
+// recordNotificationAttempt writes the outcome of a delivery attempt to its
+// record and schedules the next retry. Callers hold tas.mu.
+func (tas *TopologyAlertingSystem) recordNotificationAttempt(record *NotificationRecord, response string, err error) {
+	record.Attempts++
+	record.SentAt = time.Now()
+	record.Response = response
+
+	if err == nil {
+		record.Status = NotificationSent
+		record.Error = ""
+		record.NextRetry = time.Time{}
+		tas.stats.NotificationsSent++
+		return
+	}
+
+	record.Status = NotificationFailed
+	record.Error = err.Error()
+	tas.stats.NotificationsFailed++
+
+	if record.Attempts > tas.config.NotificationRetries {
+		record.NextRetry = time.Time{}
+		log.Printf("Giving up %s notification via route %s after %d attempts: %v",
+			record.Type, record.Route, record.Attempts, err)
+		return
+	}
+	record.NextRetry = record.SentAt.Add(tas.notificationBackoff(record.Attempts))
+	log.Printf("%s notification via route %s failed, retrying at %s: %v",
+		record.Type, record.Route, record.NextRetry.Format(time.RFC3339), err)
+}
+
+// notificationBackoff doubles the retry interval after every failed attempt,
+// up to maxNotificationBackoff
+func (tas *TopologyAlertingSystem) notificationBackoff(attempts int) time.Duration {
+	backoff := tas.config.NotificationRetryInterval
+	if backoff <= 0 {
+		backoff = 30 * time.Second
+	}
+	for i := 1; i < attempts && backoff < maxNotificationBackoff; i++ {
+		backoff *= 2
+		if backoff > maxNotificationBackoff {
+			backoff = maxNotificationBackoff
+		}
+	}
+	return backoff
+}
+
+// retryFailedNotifications re-sends failed notifications whose backoff has
+// elapsed
+func (tas *TopologyAlertingSystem) retryFailedNotifications() {
+	type retry struct {
+		alert    *TopologyAlert
+		index    int
+		route    NotificationRoute
+		snapshot TopologyAlert
+	}
+
+	now := time.Now()
+	var due []retry
+
+	tas.mu.Lock()
+	for _, alert := range tas.activeAlerts {
+		for i := range alert.NotificationsSent {
+			record := &alert.NotificationsSent[i]
+			if record.Status != NotificationFailed || record.NextRetry.IsZero() || now.Before(record.NextRetry) {
+				continue
+			}
+			record.Status = NotificationRetrying
+			due = append(due, retry{alert: alert, index: i, route: record.route, snapshot: *alert})
+		}
+	}
+	tas.mu.Unlock()
+
+	for _, r := range due {
+		response, err := tas.sendNotification(r.route, &r.snapshot)
+
+		tas.mu.Lock()
+		tas.recordNotificationAttempt(&r.alert.NotificationsSent[r.index], response, err)
+		tas.mu.Unlock()
+	}
+}
+
+func (tas *TopologyAlertingSystem) sendNotification(route NotificationRoute, alert *TopologyAlert) (string, error) {
+	switch route.Target.Type {
+	case NotificationEmail:
+		return tas.sendEmailNotification(route, alert)
+	case NotificationWebhook:
+		return tas.sendWebhookNotification(route, alert)
+	case NotificationSlack:
+		return tas.sendSlackNotification(route, alert)
+	case NotificationSyslog:
+		return tas.sendSyslogNotification(route, alert)
+	case NotificationMQTT:
+		return tas.sendMQTTNotification(route, alert)
+	case NotificationSMS, NotificationPagerDuty, NotificationSNMP:
+		return "", fmt.Errorf("%s notifications are not supported", route.Target.Type)
+	default:
+		return "", fmt.Errorf("unsupported notification type: %s", route.Target.Type)
+	}
+}
+
+func (tas *TopologyAlertingSystem) notificationTimeout() time.Duration {
+	if tas.config.NotificationTimeout > 0 {
+		return tas.config.NotificationTimeout
+	}
+	return 10 * time.Second
+}
+
+// encodeAlert builds the AlertNotification sent for an alert
+func (tas *TopologyAlertingSystem) encodeAlert(route NotificationRoute, alert *TopologyAlert) ([]byte, error) {
+	tenant, site := topologyScope(tas.topologyManager)
+	return json.Marshal(AlertNotification{
+		ID:                 alert.ID,
+		Route:              route.Name,
+		Type:               alert.Type,
+		Severity:           alert.Severity,
+		Status:             alert.Status,
+		Category:           alert.Category,
+		Tenant:             tenant,
+		Site:               site,
+		DeviceID:           alert.DeviceID,
+		MacAddress:         alert.MacAddress,
+		FriendlyName:       alert.FriendlyName,
+		Title:              alert.Title,
+		Description:        alert.Description,
+		Message:            alert.Message,
+		Timestamp:          alert.CreatedAt.UnixMilli(),
+		LastOccurrence:     alert.LastOccurrence.UnixMilli(),
+		Frequency:          alert.Frequency,
+		EscalationLevel:    alert.EscalationLevel,
+		RecommendedActions: alert.RecommendedActions,
+	})
+}
+
+// sendEmailNotification mails the alert to the comma-separated addresses
+// of the route, upgrading to TLS when the server offers STARTTLS
+func (tas *TopologyAlertingSystem) sendEmailNotification(route NotificationRoute, alert *TopologyAlert) (string, error) {
+	settings := tas.config.SMTP
+	if settings.Host == "" || settings.From == "" {
+		return "", fmt.Errorf("SMTP server not configured")
+	}
+	var recipients []string
+	for _, address := range strings.Split(route.Target.Target, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	if len(recipients) == 0 {
+		return "", fmt.Errorf("no email recipients")
+	}
+
+	port := settings.Port
+	if port == 0 {
+		port = 25
+	}
+	address := net.JoinHostPort(settings.Host, strconv.Itoa(port))
+	timeout := tas.notificationTimeout()
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, settings.Host)
+	if err != nil {
+		conn.Close()
+		return "", fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: settings.Host}); err != nil {
+			return "", fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+	if settings.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", settings.Username, settings.Password, settings.Host)); err != nil {
+			return "", fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(settings.From); err != nil {
+		return "", fmt.Errorf("SMTP server rejected sender: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return "", fmt.Errorf("SMTP server rejected %s: %w", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(formatAlertEmail(settings.From, recipients, alert)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("SMTP server rejected message: %w", err)
+	}
+	client.Quit()
+
+	return fmt.Sprintf("accepted by %s for %d recipients", address, len(recipients)), nil
+}
+
+// formatAlertEmail builds a plain text message with CRLF line endings
+func formatAlertEmail(from string, to []string, alert *TopologyAlert) []byte {
+	oneLine := strings.NewReplacer("\r", " ", "\n", " ")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: [%s] %s\r\n", strings.ToUpper(string(alert.Severity)), oneLine.Replace(alert.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+
+	body := []string{alert.Message, ""}
+	body = append(body,
+		fmt.Sprintf("Alert:       %s", alert.ID),
+		fmt.Sprintf("Type:        %s", alert.Type),
+		fmt.Sprintf("Severity:    %s", alert.Severity),
+	)
+	if alert.DeviceID != "" {
+		body = append(body, fmt.Sprintf("Device:      %s", alert.DeviceID))
+	}
+	if alert.FriendlyName != "" && alert.FriendlyName != alert.DeviceID {
+		body = append(body, fmt.Sprintf("Name:        %s", alert.FriendlyName))
+	}
+	body = append(body,
+		fmt.Sprintf("Created:     %s", alert.CreatedAt.Format(time.RFC3339)),
+		fmt.Sprintf("Occurrences: %d", alert.Frequency),
+	)
+	if len(alert.RecommendedActions) > 0 {
+		body = append(body, "", "Recommended actions:")
+		for _, action := range alert.RecommendedActions {
+			body = append(body, "- "+action)
+		}
+	}
+	for _, line := range body {
+		b.WriteString(strings.ReplaceAll(line, "\n", "\r\n"))
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
+
+// sendWebhookNotification POSTs an AlertNotification, signed like topology
+// event webhooks when the route has a secret
+func (tas *TopologyAlertingSystem) sendWebhookNotification(route NotificationRoute, alert *TopologyAlert) (string, error) {
+	body, err := tas.encodeAlert(route, alert)
+	if err != nil {
+		return "", err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{
+		WebhookEventHeader:     "alert." + string(alert.Type),
+		WebhookDeliveryHeader:  alert.ID,
+		WebhookTimestampHeader: timestamp,
+	}
+	if route.Secret != "" {
+		headers[WebhookSignatureHeader] = SignWebhook(route.Secret, timestamp, body)
+	}
+	return tas.postNotification(route, headers, body)
+}
+
+// sendSlackNotification posts to a Slack-compatible incoming webhook URL
+func (tas *TopologyAlertingSystem) sendSlackNotification(route NotificationRoute, alert *TopologyAlert) (string, error) {
+	fields := []slackField{
+		{Title: "Severity", Value: string(alert.Severity), Short: true},
+		{Title: "Type", Value: string(alert.Type), Short: true},
+	}
+	if alert.DeviceID != "" {
+		fields = append(fields, slackField{Title: "Device", Value: alert.DeviceID, Short: true})
+	}
+	if alert.Frequency > 1 {
+		fields = append(fields, slackField{Title: "Occurrences", Value: strconv.Itoa(alert.Frequency), Short: true})
+	}
+
+	color := "#439FE0"
+	switch severityRank(alert.Severity) {
+	case 1:
+		color = "warning"
+	case 2, 3:
+		color = "danger"
+	}
+
+	body, err := json.Marshal(slackMessage{
+		Text: fmt.Sprintf("[%s] %s", strings.ToUpper(string(alert.Severity)), alert.Title),
+		Attachments: []slackAttachment{{
+			Color:     color,
+			Title:     alert.Title,
+			Text:      alert.Description,
+			Fields:    fields,
+			Footer:    alert.ID,
+			Timestamp: alert.CreatedAt.Unix(),
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+	return tas.postNotification(route, nil, body)
+}
+
+func (tas *TopologyAlertingSystem) postNotification(route NotificationRoute, headers map[string]string, body []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tas.notificationTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, route.Target.Target, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range route.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := tas.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.Status, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return resp.Status, nil
+}
+
+// sendSyslogNotification sends an RFC 5424 message to udp://host[:port]
+// or tcp://host[:port]; TCP uses octet-counting framing (RFC 6587)
+func (tas *TopologyAlertingSystem) sendSyslogNotification(route NotificationRoute, alert *TopologyAlert) (string, error) {
+	network, address, err := syslogAddress(route.Target.Target)
+	if err != nil {
+		return "", err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+	tenant, site := topologyScope(tas.topologyManager)
+	message := formatSyslogMessage(alert, time.Now(), hostname, tenant, site)
+
+	timeout := tas.notificationTimeout()
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to syslog server: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if network == "tcp" {
+		message = strconv.Itoa(len(message)) + " " + message
+	}
+	if _, err := io.WriteString(conn, message); err != nil {
+		return "", fmt.Errorf("failed to write syslog message: %w", err)
+	}
+	return fmt.Sprintf("sent to %s://%s", network, address), nil
+}
+
+// syslogAddress splits a syslog target into network and address, using
+// UDP and port 514 when they are not given
+func syslogAddress(target string) (network, address string, err error) {
+	network, address = "udp", target
+	if scheme, rest, found := strings.Cut(target, "://"); found {
+		network, address = scheme, rest
+	}
+	if network != "udp" && network != "tcp" {
+		return "", "", fmt.Errorf("unsupported syslog transport %q", network)
+	}
+	if address == "" {
+		return "", "", fmt.Errorf("syslog target has no host")
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "514")
+	}
+	return network, address, nil
+}
+
+// formatSyslogMessage formats an alert as an RFC 5424 message
+func formatSyslogMessage(alert *TopologyAlert, now time.Time, hostname, tenant, site string) string {
+	// PRI = facility * 8 + severity
+	severity := 5 // notice
+	switch alert.Severity {
+	case SeverityCritical:
+		severity = 2
+	case SeverityError, SeverityHigh:
+		severity = 3
+	case SeverityWarning, SeverityMedium:
+		severity = 4
+	case SeverityInfo, SeverityLow:
+		severity = 6
+	}
+
+	params := []struct{ name, value string }{
+		{"alert_id", alert.ID},
+		{"type", string(alert.Type)},
+		{"severity", string(alert.Severity)},
+		{"tenant", tenant},
+		{"site", site},
+		{"device_id", alert.DeviceID},
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	var sd strings.Builder
+	sd.WriteString("[" + syslogEnterpriseID)
+	for _, param := range params {
+		if param.value != "" {
+			fmt.Fprintf(&sd, ` %s="%s"`, param.name, escape.Replace(param.value))
+		}
+	}
+	sd.WriteString("]")
+
+	message := alert.Title
+	if alert.Description != "" {
+		message += ": " + alert.Description
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s rtk-controller %d %s %s %s",
+		syslogFacility*8+severity,
+		now.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(hostname, 255),
+		os.Getpid(),
+		syslogHeaderField(string(alert.Type), 32),
+		sd.String(),
+		strings.ReplaceAll(message, "\n", " "),
+	)
+}
+
+// syslogHeaderField keeps the printable ASCII characters RFC 5424 allows in
+// header fields, using the NILVALUE for empty ones
+func syslogHeaderField(value string, maxLen int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// sendMQTTNotification publishes an AlertNotification to the route target,
+// or to AlertsTopic when it has none
+func (tas *TopologyAlertingSystem) sendMQTTNotification(route NotificationRoute, alert *TopologyAlert) (string, error) {
+	tas.mu.RLock()
+	publisher := tas.publisher
+	tas.mu.RUnlock()
+	if publisher == nil {
+		return "", fmt.Errorf("no MQTT publisher set")
+	}
+
+	payload, err := tas.encodeAlert(route, alert)
+	if err != nil {
+		return "", err
+	}
+
+	topic := route.Target.Target
+	if topic == "" {
+		tenant, site := topologyScope(tas.topologyManager)
+		topic = fmt.Sprintf(AlertsTopic, tenant, site)
+	}
+	if err := publisher.Publish(topic, 1, false, payload); err != nil {
+		return "", err
+	}
+	return "published to " + topic, nil
+}
@@ -0,0 +1,437 @@
+package topology
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rtk_controller/internal/config"
+)
+
+func newTestAlertingSystem(t *testing.T, cfg config.AlertingConfig) *TopologyAlertingSystem {
+	tas := NewTopologyAlertingSystem(&Manager{config: ManagerConfig{Tenant: "acme", Site: "hq"}},
+		nil, nil, nil, nil, nil, nil, AlertingConfig{})
+	require.NoError(t, tas.ApplyConfig(cfg))
+	return tas
+}
+
+func newTestAlert(severity AlertSeverity) *TopologyAlert {
+	now := time.Now()
+	return &TopologyAlert{
+		ID:                 "alert_1_ap-1",
+		Type:               AlertDeviceOffline,
+		Severity:           severity,
+		Status:             StatusOpen,
+		DeviceID:           "ap-1",
+		Title:              "Device Offline",
+		Description:        "ap-1 stopped reporting",
+		Message:            "ap-1 stopped reporting",
+		CreatedAt:          now,
+		LastOccurrence:     now,
+		Frequency:          1,
+		RecommendedActions: []string{"Check power"},
+	}
+}
+
+func TestAlertingSystem_ApplyConfig(t *testing.T) {
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		RetryInterval: "1m",
+		MaxRetries:    2,
+		Routes: []config.NotificationRouteConfig{
+			{Name: "oncall", Type: "webhook", Target: "http://example.invalid", MinSeverity: "error"},
+			{Type: "mqtt", Severities: []string{"warning"}},
+			{Name: "off", Type: "syslog", Target: "udp://127.0.0.1", Disabled: true},
+		},
+	})
+	assert.Equal(t, time.Minute, tas.config.NotificationRetryInterval)
+	assert.Equal(t, 2, tas.config.NotificationRetries)
+	require.Len(t, tas.config.NotificationRoutes, 3)
+	assert.Equal(t, "mqtt-2", tas.config.NotificationRoutes[1].Name)
+
+	routeNames := func(severity AlertSeverity) []string {
+		var names []string
+		for _, route := range tas.getNotificationRoutes(newTestAlert(severity)) {
+			names = append(names, route.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"oncall"}, routeNames(SeverityCritical))
+	assert.Equal(t, []string{"oncall"}, routeNames(SeverityError))
+	assert.Equal(t, []string{"mqtt-2"}, routeNames(SeverityWarning))
+	assert.Empty(t, routeNames(SeverityInfo))
+
+	for _, route := range []config.NotificationRouteConfig{
+		{Type: "pagerduty", Target: "key"},
+		{Type: "webhook"},
+		{Type: "webhook", Target: "http://example.invalid", MinSeverity: "severe"},
+		{Type: "email", Target: "ops@example.com"},
+		{Type: "syslog", Target: "tls://logs:6514"},
+	} {
+		err := tas.ApplyConfig(config.AlertingConfig{Routes: []config.NotificationRouteConfig{route}})
+		assert.Error(t, err, "route %+v", route)
+	}
+}
+
+func TestAlertingSystem_WebhookAndSlackNotifications(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]*http.Request{}
+	bodies := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests[r.URL.Path] = r
+		bodies[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		Routes: []config.NotificationRouteConfig{
+			{Name: "hook", Type: "webhook", Target: server.URL + "/hook", Secret: "s3cret",
+				Headers: map[string]string{"Authorization": "Bearer token"}},
+			{Name: "chat", Type: "slack", Target: server.URL + "/slack"},
+		},
+	})
+	alert := newTestAlert(SeverityCritical)
+	tas.activeAlerts[alert.ID] = alert
+	tas.sendNotifications(alert)
+	tas.notifications.Wait()
+
+	require.Len(t, alert.NotificationsSent, 2)
+	for _, record := range alert.NotificationsSent {
+		assert.Equal(t, NotificationSent, record.Status, record.Error)
+		assert.Equal(t, "200 OK", record.Response)
+		assert.Equal(t, 1, record.Attempts)
+		assert.True(t, record.NextRetry.IsZero())
+	}
+	assert.Equal(t, int64(2), tas.GetStats().NotificationsSent)
+
+	hook := requests["/hook"]
+	assert.Equal(t, "Bearer token", hook.Header.Get("Authorization"))
+	assert.Equal(t, "alert.device_offline", hook.Header.Get(WebhookEventHeader))
+	assert.True(t, VerifyWebhook("s3cret", hook.Header.Get(WebhookTimestampHeader), bodies["/hook"], hook.Header.Get(WebhookSignatureHeader)))
+	var notification AlertNotification
+	require.NoError(t, json.Unmarshal(bodies["/hook"], &notification))
+	assert.Equal(t, alert.ID, notification.ID)
+	assert.Equal(t, "hook", notification.Route)
+	assert.Equal(t, "acme", notification.Tenant)
+	assert.Equal(t, "hq", notification.Site)
+	assert.Equal(t, AlertSeverity(SeverityCritical), notification.Severity)
+
+	var slack slackMessage
+	require.NoError(t, json.Unmarshal(bodies["/slack"], &slack))
+	assert.Equal(t, "[CRITICAL] Device Offline", slack.Text)
+	require.Len(t, slack.Attachments, 1)
+	assert.Equal(t, "danger", slack.Attachments[0].Color)
+}
+
+func TestAlertingSystem_NotificationRetryBackoff(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		RetryInterval: "10m",
+		MaxRetries:    3,
+		Routes:        []config.NotificationRouteConfig{{Name: "hook", Type: "webhook", Target: server.URL}},
+	})
+	alert := newTestAlert(SeverityError)
+	tas.activeAlerts[alert.ID] = alert
+
+	tas.sendNotifications(alert)
+	tas.notifications.Wait()
+	record := alert.NotificationsSent[0]
+	assert.Equal(t, NotificationFailed, record.Status)
+	assert.Equal(t, "502 Bad Gateway", record.Response)
+	assert.Contains(t, record.Error, "502")
+	assert.WithinDuration(t, record.SentAt.Add(10*time.Minute), record.NextRetry, time.Second)
+
+	// Not due yet
+	tas.retryFailedNotifications()
+	assert.Equal(t, 1, alert.NotificationsSent[0].Attempts)
+
+	// Second attempt fails and doubles the backoff
+	alert.NotificationsSent[0].NextRetry = time.Now().Add(-time.Second)
+	tas.retryFailedNotifications()
+	record = alert.NotificationsSent[0]
+	assert.Equal(t, 2, record.Attempts)
+	assert.Equal(t, NotificationFailed, record.Status)
+	assert.WithinDuration(t, record.SentAt.Add(20*time.Minute), record.NextRetry, time.Second)
+
+	alert.NotificationsSent[0].NextRetry = time.Now().Add(-time.Second)
+	tas.retryFailedNotifications()
+	record = alert.NotificationsSent[0]
+	assert.Equal(t, 3, record.Attempts)
+	assert.Equal(t, NotificationSent, record.Status)
+	assert.Empty(t, record.Error)
+	assert.True(t, record.NextRetry.IsZero())
+
+	stats := tas.GetStats()
+	assert.Equal(t, int64(1), stats.NotificationsSent)
+	assert.Equal(t, int64(2), stats.NotificationsFailed)
+}
+
+func TestAlertingSystem_NotifyRoutesConcurrently(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		Routes: []config.NotificationRouteConfig{
+			{Name: "slow", Type: "webhook", Target: server.URL},
+			{Name: "bus", Type: "mqtt"},
+		},
+	})
+	publisher := &recordingPublisher{}
+	tas.SetNotificationPublisher(publisher)
+	alert := newTestAlert(SeverityCritical)
+	tas.activeAlerts[alert.ID] = alert
+
+	// A slow route neither blocks the caller nor the other routes
+	tas.sendNotifications(alert)
+	record := func(i int) NotificationRecord {
+		tas.mu.RLock()
+		defer tas.mu.RUnlock()
+		return alert.NotificationsSent[i]
+	}
+	require.Len(t, alert.NotificationsSent, 2)
+	require.Eventually(t, func() bool { return record(1).Status == NotificationSent }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, NotificationPending, record(0).Status)
+
+	close(release)
+	tas.notifications.Wait()
+	assert.Equal(t, NotificationSent, record(0).Status, record(0).Error)
+}
+
+func TestAlertingSystem_NotificationGivesUp(t *testing.T) {
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		MaxRetries: 1,
+		Routes:     []config.NotificationRouteConfig{{Name: "bus", Type: "mqtt"}},
+	})
+	alert := newTestAlert(SeverityError)
+	tas.activeAlerts[alert.ID] = alert
+
+	// No publisher set
+	tas.sendNotifications(alert)
+	tas.notifications.Wait()
+	require.False(t, alert.NotificationsSent[0].NextRetry.IsZero())
+	alert.NotificationsSent[0].NextRetry = time.Now().Add(-time.Second)
+	tas.retryFailedNotifications()
+
+	record := alert.NotificationsSent[0]
+	assert.Equal(t, 2, record.Attempts)
+	assert.Equal(t, NotificationFailed, record.Status)
+	assert.True(t, record.NextRetry.IsZero())
+}
+
+func TestAlertingSystem_MQTTNotification(t *testing.T) {
+	publisher := &recordingPublisher{}
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		Routes: []config.NotificationRouteConfig{
+			{Name: "default-topic", Type: "mqtt"},
+			{Name: "custom-topic", Type: "mqtt", Target: "noc/alerts"},
+		},
+	})
+	tas.SetNotificationPublisher(publisher)
+	alert := newTestAlert(SeverityWarning)
+	tas.sendNotifications(alert)
+	tas.notifications.Wait()
+
+	// Routes are delivered concurrently, so messages arrive in any order
+	require.Len(t, publisher.messages, 2)
+	byTopic := map[string]publishedMessage{}
+	for _, message := range publisher.messages {
+		byTopic[message.topic] = message
+	}
+	require.Contains(t, byTopic, "noc/alerts")
+	message, found := byTopic["rtk/v1/acme/hq/_controller/alerts"]
+	require.True(t, found, "no message on the default alerts topic")
+	assert.Equal(t, byte(1), message.qos)
+
+	var notification AlertNotification
+	require.NoError(t, json.Unmarshal(message.payload, &notification))
+	assert.Equal(t, alert.ID, notification.ID)
+	assert.Equal(t, "ap-1", notification.DeviceID)
+	assert.Equal(t, "default-topic", notification.Route)
+	assert.Equal(t, "published to noc/alerts", alert.NotificationsSent[1].Response)
+}
+
+func TestAlertingSystem_SyslogNotification(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		Routes: []config.NotificationRouteConfig{{Name: "siem", Type: "syslog", Target: "udp://" + conn.LocalAddr().String()}},
+	})
+	alert := newTestAlert(SeverityCritical)
+	alert.Description = `link "eth0" down]`
+	tas.sendNotifications(alert)
+	tas.notifications.Wait()
+	require.Equal(t, NotificationSent, alert.NotificationsSent[0].Status, alert.NotificationsSent[0].Error)
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	message := string(buf[:n])
+
+	// local0.crit = 16*8+2
+	assert.True(t, strings.HasPrefix(message, "<130>1 "), message)
+	fields := strings.SplitN(message, " ", 7)
+	require.Len(t, fields, 7)
+	_, err = time.Parse(time.RFC3339Nano, fields[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "rtk-controller", fields[3])
+	assert.Equal(t, "device_offline", fields[5])
+	assert.Contains(t, fields[6], `[rtk@32473 alert_id="alert_1_ap-1" type="device_offline" severity="critical" tenant="acme" site="hq" device_id="ap-1"]`)
+	assert.True(t, strings.HasSuffix(message, `Device Offline: link "eth0" down]`), message)
+
+	line := formatSyslogMessage(&TopologyAlert{Type: "x", Severity: SeverityWarning, DeviceID: `a"b`}, time.Now(), "", "t", "s")
+	assert.True(t, strings.HasPrefix(line, "<132>1 "))
+	assert.Contains(t, line, `device_id="a\"b"`)
+	assert.Contains(t, line, " - rtk-controller ")
+}
+
+func TestAlertingSystem_EmailNotification(t *testing.T) {
+	server := startTestSMTPServer(t)
+
+	host, port, err := net.SplitHostPort(server.address)
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	tas := newTestAlertingSystem(t, config.AlertingConfig{
+		SMTP: config.SMTPConfig{Host: host, Port: portNumber, From: "controller@example.com"},
+		Routes: []config.NotificationRouteConfig{
+			{Name: "noc", Type: "email", Target: "noc@example.com, oncall@example.com"},
+		},
+	})
+	alert := newTestAlert(SeverityCritical)
+	tas.sendNotifications(alert)
+	tas.notifications.Wait()
+
+	record := alert.NotificationsSent[0]
+	require.Equal(t, NotificationSent, record.Status, record.Error)
+	assert.Contains(t, record.Response, "2 recipients")
+
+	message := <-server.messages
+	assert.Equal(t, "<controller@example.com>", message.from)
+	assert.Equal(t, []string{"<noc@example.com>", "<oncall@example.com>"}, message.to)
+	assert.Contains(t, message.data, "Subject: [CRITICAL] Device Offline\r\n")
+	assert.Contains(t, message.data, "To: noc@example.com, oncall@example.com\r\n")
+	assert.Contains(t, message.data, "Device:      ap-1\r\n")
+	assert.Contains(t, message.data, "- Check power\r\n")
+}
+
+// recordingPublisher records what mqtt routes publish
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages []publishedMessage
+}
+
+type publishedMessage struct {
+	topic   string
+	qos     byte
+	payload []byte
+}
+
+func (p *recordingPublisher) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, publishedMessage{topic: topic, qos: qos, payload: payload.([]byte)})
+	return nil
+}
+
+type testSMTPServer struct {
+	address  string
+	messages chan testSMTPMessage
+}
+
+type testSMTPMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// startTestSMTPServer accepts one message over plain SMTP
+func startTestSMTPServer(t *testing.T) *testSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &testSMTPServer{address: listener.Addr().String(), messages: make(chan testSMTPMessage, 1)}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		var message testSMTPMessage
+
+		reply("220 test ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.TrimRight(line, "\r\n")
+			switch {
+			case strings.HasPrefix(command, "EHLO"):
+				reply("250 test")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				message.from = strings.TrimPrefix(command, "MAIL FROM:")
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				message.to = append(message.to, strings.TrimPrefix(command, "RCPT TO:"))
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				message.data = data.String()
+				server.messages <- message
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return server
+}
@@ -0,0 +1,636 @@
+package topology
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"rtk_controller/pkg/types"
+)
+
+// maxSampleAge is how old the latest sample of a metric may be before the
+// metric counts as having no value
+const maxSampleAge = 10 * time.Minute
+
+// RuleExpression is a compiled alert rule expression:
+//
+//	clause [and|or clause ...] [on selector[, selector ...]]
+//
+// where a clause is one of
+//
+//	metric op number [for duration]
+//	rate(metric, window) op number [for duration]      change per minute
+//	increase(metric, window) op number [for duration]  counter increase
+//	avg|min|max(metric, window) op number [for duration]
+//	absent(metric) for duration
+//
+// and a selector is all, device:<id>, mac:<mac>, group:<name> (identity
+// location or tag), location:<name>, tag:<name> or category:<name>.
+// Example: "rssi < -75 for 5m on group:bedroom".
+type RuleExpression struct {
+	Source    string
+	Clauses   []RuleClause
+	Logic     ConditionLogic // between clauses
+	Selectors []DeviceSelector
+}
+
+// RuleClause is a single condition of a rule expression
+type RuleClause struct {
+	Function  string // "" for the latest value, rate, increase, avg, min, max or absent
+	Metric    string
+	Window    time.Duration // for rate, increase, avg, min and max
+	Operator  string        // <, <=, >, >=, == or !=; empty for absent
+	Threshold float64
+	For       time.Duration // how long the condition must hold
+}
+
+// DeviceSelector restricts which devices a rule expression applies to
+type DeviceSelector struct {
+	Kind  string // all, device, mac, group, location, tag or category
+	Value string
+}
+
+// IdentityLookup returns the identity of a device, or nil if it has none
+type IdentityLookup func(device string) *types.DeviceIdentity
+
+// ClauseResult is the outcome of one clause for one device
+type ClauseResult struct {
+	Clause RuleClause
+	Held   bool
+	Value  float64
+	Known  bool // false when the metric has no value
+}
+
+var ruleFunctions = map[string]bool{
+	"rate":     true,
+	"increase": true,
+	"avg":      true,
+	"min":      true,
+	"max":      true,
+	"absent":   true,
+}
+
+var ruleOperators = map[string]bool{
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+	"==": true,
+	"!=": true,
+}
+
+var selectorKinds = map[string]bool{
+	"device":   true,
+	"mac":      true,
+	"group":    true,
+	"location": true,
+	"tag":      true,
+	"category": true,
+}
+
+// ParseRuleExpression compiles an alert rule expression
+func ParseRuleExpression(source string) (*RuleExpression, error) {
+	tokens, selectorText, err := tokenizeRule(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty rule expression")
+	}
+
+	expr := &RuleExpression{Source: strings.TrimSpace(source)}
+	p := &ruleParser{tokens: tokens}
+	for {
+		clause, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		expr.Clauses = append(expr.Clauses, clause)
+
+		if p.done() {
+			break
+		}
+		var logic ConditionLogic
+		switch strings.ToLower(p.next()) {
+		case "and":
+			logic = LogicAND
+		case "or":
+			logic = LogicOR
+		default:
+			return nil, fmt.Errorf("expected and, or or on, got %q", p.tokens[p.pos-1])
+		}
+		if expr.Logic != "" && expr.Logic != logic {
+			return nil, fmt.Errorf("cannot mix and with or in one rule")
+		}
+		expr.Logic = logic
+	}
+	if expr.Logic == "" {
+		expr.Logic = LogicAND
+	}
+
+	if selectorText != nil {
+		if expr.Selectors, err = parseSelectors(*selectorText); err != nil {
+			return nil, err
+		}
+	}
+
+	return expr, nil
+}
+
+// Metrics returns the metrics the expression refers to
+func (e *RuleExpression) Metrics() []string {
+	var metrics []string
+	seen := make(map[string]bool)
+	for _, clause := range e.Clauses {
+		if !seen[clause.Metric] {
+			seen[clause.Metric] = true
+			metrics = append(metrics, clause.Metric)
+		}
+	}
+	return metrics
+}
+
+// Lookback returns how much history the expression needs
+func (e *RuleExpression) Lookback() time.Duration {
+	var lookback time.Duration
+	for _, clause := range e.Clauses {
+		if d := clause.Window + clause.For; d > lookback {
+			lookback = d
+		}
+	}
+	return lookback + maxSampleAge
+}
+
+// AppliesTo reports whether the expression's selectors match a device
+func (e *RuleExpression) AppliesTo(device string, lookup IdentityLookup) bool {
+	if len(e.Selectors) == 0 {
+		return true
+	}
+
+	var identity *types.DeviceIdentity
+	if lookup != nil {
+		identity = lookup(device)
+	}
+	for _, selector := range e.Selectors {
+		if selector.Matches(device, identity) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate evaluates the expression for one device at a point in time
+func (e *RuleExpression) Evaluate(history *MetricHistory, device string, at time.Time) (bool, []ClauseResult) {
+	results := make([]ClauseResult, 0, len(e.Clauses))
+	fired := e.Logic == LogicAND
+	for _, clause := range e.Clauses {
+		result := clause.evaluate(history, device, at)
+		results = append(results, result)
+		if e.Logic == LogicAND {
+			fired = fired && result.Held
+		} else {
+			fired = fired || result.Held
+		}
+	}
+	return fired, results
+}
+
+// String formats the clause the way it is written in a rule
+func (c RuleClause) String() string {
+	var s string
+	switch c.Function {
+	case "":
+		s = c.Metric
+	case "absent":
+		return fmt.Sprintf("absent(%s) for %s", c.Metric, c.For)
+	default:
+		s = fmt.Sprintf("%s(%s, %s)", c.Function, c.Metric, c.Window)
+	}
+	s = fmt.Sprintf("%s %s %s", s, c.Operator, strconv.FormatFloat(c.Threshold, 'f', -1, 64))
+	if c.For > 0 {
+		s += fmt.Sprintf(" for %s", c.For)
+	}
+	return s
+}
+
+func (c RuleClause) evaluate(history *MetricHistory, device string, at time.Time) ClauseResult {
+	result := ClauseResult{Clause: c}
+	series := history.Series(device, c.Metric)
+
+	if c.Function == "absent" {
+		last, ok := latestSample(series, at)
+		if !ok {
+			// Never reported, so there is nothing to go missing
+			return result
+		}
+		result.Value = at.Sub(last.Timestamp).Minutes()
+		result.Known = true
+		result.Held = at.Sub(last.Timestamp) >= c.For
+		return result
+	}
+
+	result.Value, result.Known = c.value(series, at)
+	result.Held = result.Known && compareRuleValue(result.Value, c.Operator, c.Threshold)
+	if !result.Held || c.For <= 0 {
+		return result
+	}
+
+	// The condition must hold at the start of the period and at every sample
+	// since, so a single dip inside the period resets it
+	start := at.Add(-c.For)
+	if value, ok := c.value(series, start); !ok || !compareRuleValue(value, c.Operator, c.Threshold) {
+		result.Held = false
+		return result
+	}
+	for _, sample := range series {
+		if !sample.Timestamp.After(start) || sample.Timestamp.After(at) {
+			continue
+		}
+		if value, ok := c.value(series, sample.Timestamp); !ok || !compareRuleValue(value, c.Operator, c.Threshold) {
+			result.Held = false
+			return result
+		}
+	}
+	return result
+}
+
+// value computes the clause's left-hand side at a point in time
+func (c RuleClause) value(series []MetricSample, at time.Time) (float64, bool) {
+	if c.Function == "" {
+		sample, ok := latestSample(series, at)
+		if !ok || at.Sub(sample.Timestamp) > maxSampleAge {
+			return 0, false
+		}
+		return sample.Value, true
+	}
+
+	window := samplesBetween(series, at.Add(-c.Window), at)
+	switch c.Function {
+	case "rate":
+		if len(window) < 2 {
+			return 0, false
+		}
+		first, last := window[0], window[len(window)-1]
+		minutes := last.Timestamp.Sub(first.Timestamp).Minutes()
+		if minutes <= 0 {
+			return 0, false
+		}
+		return (last.Value - first.Value) / minutes, true
+	case "increase":
+		if len(window) < 2 {
+			return 0, false
+		}
+		var increase float64
+		for i := 1; i < len(window); i++ {
+			delta := window[i].Value - window[i-1].Value
+			if delta < 0 {
+				// Counter reset, it restarted from zero
+				delta = window[i].Value
+			}
+			increase += delta
+		}
+		return increase, true
+	case "avg", "min", "max":
+		if len(window) == 0 {
+			return 0, false
+		}
+		value := window[0].Value
+		sum := 0.0
+		for _, sample := range window {
+			sum += sample.Value
+			switch c.Function {
+			case "min":
+				value = math.Min(value, sample.Value)
+			case "max":
+				value = math.Max(value, sample.Value)
+			}
+		}
+		if c.Function == "avg" {
+			value = sum / float64(len(window))
+		}
+		return value, true
+	}
+	return 0, false
+}
+
+// Matches reports whether a device, with its identity if known, matches the
+// selector
+func (s DeviceSelector) Matches(device string, identity *types.DeviceIdentity) bool {
+	switch s.Kind {
+	case "all":
+		return true
+	case "device", "mac":
+		if normalizeDeviceKey(device) == normalizeDeviceKey(s.Value) {
+			return true
+		}
+		return identity != nil && normalizeDeviceKey(identity.MacAddress) == normalizeDeviceKey(s.Value)
+	}
+
+	if identity == nil {
+		return false
+	}
+	switch s.Kind {
+	case "group":
+		return strings.EqualFold(identity.Location, s.Value) || hasTag(identity.Tags, s.Value)
+	case "location":
+		return strings.EqualFold(identity.Location, s.Value)
+	case "tag":
+		return hasTag(identity.Tags, s.Value)
+	case "category":
+		return strings.EqualFold(identity.Category, s.Value)
+	}
+	return false
+}
+
+// String formats the selector the way it is written in a rule
+func (s DeviceSelector) String() string {
+	if s.Kind == "all" {
+		return "all"
+	}
+	if strings.ContainsAny(s.Value, " ,") {
+		return fmt.Sprintf("%s:%q", s.Kind, s.Value)
+	}
+	return s.Kind + ":" + s.Value
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDeviceKey lowercases a device ID or MAC address and drops
+// separators, so aa:bb:cc:dd:ee:ff and AABBCCDDEEFF compare equal
+func normalizeDeviceKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '-', '.':
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, key)
+}
+
+func compareRuleValue(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+// latestSample returns the last sample at or before a point in time
+func latestSample(series []MetricSample, at time.Time) (MetricSample, bool) {
+	i := sort.Search(len(series), func(i int) bool { return series[i].Timestamp.After(at) })
+	if i == 0 {
+		return MetricSample{}, false
+	}
+	return series[i-1], true
+}
+
+// samplesBetween returns the samples in [from, to]
+func samplesBetween(series []MetricSample, from, to time.Time) []MetricSample {
+	start := sort.Search(len(series), func(i int) bool { return !series[i].Timestamp.Before(from) })
+	end := sort.Search(len(series), func(i int) bool { return series[i].Timestamp.After(to) })
+	if start >= end {
+		return nil
+	}
+	return series[start:end]
+}
+
+type ruleParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *ruleParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *ruleParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *ruleParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *ruleParser) expect(token string) error {
+	if got := p.next(); got != token {
+		if got == "" {
+			return fmt.Errorf("expected %q at end of rule", token)
+		}
+		return fmt.Errorf("expected %q, got %q", token, got)
+	}
+	return nil
+}
+
+func (p *ruleParser) parseClause() (RuleClause, error) {
+	var clause RuleClause
+
+	name := p.next()
+	if !isRuleIdentifier(name) {
+		return clause, fmt.Errorf("expected a metric or function, got %q", name)
+	}
+
+	if p.peek() == "(" {
+		clause.Function = strings.ToLower(name)
+		if !ruleFunctions[clause.Function] {
+			return clause, fmt.Errorf("unknown function %q", name)
+		}
+		p.next()
+		clause.Metric = p.next()
+		if !isRuleIdentifier(clause.Metric) {
+			return clause, fmt.Errorf("%s: expected a metric, got %q", clause.Function, clause.Metric)
+		}
+		if clause.Function != "absent" {
+			if err := p.expect(","); err != nil {
+				return clause, fmt.Errorf("%s needs a window: %w", clause.Function, err)
+			}
+			window, err := parseRuleDuration(p.next())
+			if err != nil {
+				return clause, fmt.Errorf("%s window: %w", clause.Function, err)
+			}
+			clause.Window = window
+		}
+		if err := p.expect(")"); err != nil {
+			return clause, err
+		}
+	} else {
+		clause.Metric = name
+	}
+
+	if clause.Function == "absent" {
+		if !strings.EqualFold(p.next(), "for") {
+			return clause, fmt.Errorf("absent(%s) needs a for duration", clause.Metric)
+		}
+		duration, err := parseRuleDuration(p.next())
+		if err != nil {
+			return clause, fmt.Errorf("absent(%s) for: %w", clause.Metric, err)
+		}
+		clause.For = duration
+		return clause, nil
+	}
+
+	clause.Operator = p.next()
+	if !ruleOperators[clause.Operator] {
+		return clause, fmt.Errorf("expected a comparison after %s, got %q", clause.Metric, clause.Operator)
+	}
+	thresholdToken := p.next()
+	threshold, err := strconv.ParseFloat(thresholdToken, 64)
+	if err != nil {
+		return clause, fmt.Errorf("expected a number after %s %s, got %q", clause.Metric, clause.Operator, thresholdToken)
+	}
+	clause.Threshold = threshold
+
+	if strings.EqualFold(p.peek(), "for") {
+		p.next()
+		duration, err := parseRuleDuration(p.next())
+		if err != nil {
+			return clause, fmt.Errorf("%s for: %w", clause.Metric, err)
+		}
+		clause.For = duration
+	}
+
+	return clause, nil
+}
+
+func parseRuleDuration(token string) (time.Duration, error) {
+	if token == "" {
+		return 0, fmt.Errorf("missing duration")
+	}
+	duration, err := time.ParseDuration(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", token)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", token)
+	}
+	return duration, nil
+}
+
+func isRuleIdentifier(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i, r := range token {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && (unicode.IsDigit(r) || r == '.')) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// tokenizeRule splits an expression into tokens up to the "on" keyword and
+// returns the selector text after it, if any
+func tokenizeRule(source string) ([]string, *string, error) {
+	var tokens []string
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, string(r))
+			i++
+		case strings.ContainsRune("<>=!", r):
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, string(runes[i:i+2]))
+				i += 2
+			} else if r == '<' || r == '>' {
+				tokens = append(tokens, string(r))
+				i++
+			} else {
+				return nil, nil, fmt.Errorf("unexpected %q at offset %d", r, i)
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-+", r):
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("_.-+", runes[i])) {
+				i++
+			}
+			word := string(runes[start:i])
+			if strings.EqualFold(word, "on") {
+				rest := string(runes[i:])
+				return tokens, &rest, nil
+			}
+			tokens = append(tokens, word)
+		default:
+			return nil, nil, fmt.Errorf("unexpected %q at offset %d", r, i)
+		}
+	}
+	return tokens, nil, nil
+}
+
+// parseSelectors parses the comma separated selectors after "on"
+func parseSelectors(text string) ([]DeviceSelector, error) {
+	var selectors []DeviceSelector
+	for _, part := range splitSelectors(text) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty selector after on")
+		}
+		if strings.EqualFold(part, "all") {
+			selectors = append(selectors, DeviceSelector{Kind: "all"})
+			continue
+		}
+
+		kind, value, found := strings.Cut(part, ":")
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if !found || !selectorKinds[kind] {
+			return nil, fmt.Errorf("invalid selector %q, expected all or one of device:, mac:, group:, location:, tag:, category:", part)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		if value == "" {
+			return nil, fmt.Errorf("selector %s: has no value", kind)
+		}
+		selectors = append(selectors, DeviceSelector{Kind: kind, Value: value})
+	}
+	return selectors, nil
+}
+
+// splitSelectors splits on commas outside double quotes
+func splitSelectors(text string) []string {
+	var parts []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case r == ',' && !quoted:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return append(parts, current.String())
+}
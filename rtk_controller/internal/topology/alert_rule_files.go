@@ -0,0 +1,316 @@
+package topology
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v2"
+)
+
+// ruleReloadDebounce collects the burst of events an editor save produces
+// into a single reload
+const ruleReloadDebounce = 500 * time.Millisecond
+
+// alertRuleFile is the YAML layout of an alert rule file:
+//
+//	rules:
+//	  - id: bedroom_weak_signal
+//	    name: Weak signal in the bedroom
+//	    expr: rssi < -75 for 5m on group:bedroom
+//	    severity: warning
+//	    cooldown: 15m
+type alertRuleFile struct {
+	Rules []alertRuleSpec `yaml:"rules"`
+}
+
+type alertRuleSpec struct {
+	ID               string   `yaml:"id"`
+	Name             string   `yaml:"name"` // defaults to the ID
+	Description      string   `yaml:"description"`
+	Expr             string   `yaml:"expr"`
+	Enabled          *bool    `yaml:"enabled"`    // defaults to true
+	AlertType        string   `yaml:"alert_type"` // defaults to the ID
+	Severity         string   `yaml:"severity"`   // defaults to warning
+	Priority         string   `yaml:"priority"`
+	Category         string   `yaml:"category"`
+	Cooldown         string   `yaml:"cooldown"`
+	MaxFrequency     int      `yaml:"max_frequency"` // alerts per time_window
+	TimeWindow       string   `yaml:"time_window"`
+	Actions          []string `yaml:"actions"` // defaults to notify
+	AutoResolve      bool     `yaml:"auto_resolve"`
+	AutoResolveDelay string   `yaml:"auto_resolve_delay"`
+}
+
+// ParseAlertRules parses and validates the rules of a rule file
+func ParseAlertRules(data []byte, source string) ([]AlertRule, error) {
+	var file alertRuleFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	rules := make([]AlertRule, 0, len(file.Rules))
+	seen := make(map[string]bool)
+	for i, spec := range file.Rules {
+		rule, err := spec.toAlertRule(source)
+		if err != nil {
+			if spec.ID == "" {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			return nil, fmt.Errorf("rule %s: %w", spec.ID, err)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("rule %s is defined more than once", rule.ID)
+		}
+		seen[rule.ID] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// LoadAlertRuleFile loads and validates the rules of a rule file
+func LoadAlertRuleFile(path string) ([]AlertRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseAlertRules(data, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// LoadAlertRuleFiles loads the rules of several rule files. Rule IDs must be
+// unique across the files.
+func LoadAlertRuleFiles(paths []string) ([]AlertRule, error) {
+	var rules []AlertRule
+	var errs []error
+	sources := make(map[string]string)
+	for _, path := range paths {
+		fileRules, err := LoadAlertRuleFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, rule := range fileRules {
+			if other, exists := sources[rule.ID]; exists {
+				errs = append(errs, fmt.Errorf("%s: rule %s is already defined in %s", path, rule.ID, other))
+				continue
+			}
+			sources[rule.ID] = path
+			rules = append(rules, rule)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return rules, nil
+}
+
+func (spec alertRuleSpec) toAlertRule(source string) (AlertRule, error) {
+	rule := AlertRule{
+		ID:           spec.ID,
+		Name:         spec.Name,
+		Description:  spec.Description,
+		Enabled:      spec.Enabled == nil || *spec.Enabled,
+		Category:     AlertCategory(spec.Category),
+		Expression:   spec.Expr,
+		AlertType:    TopologyAlertType(spec.AlertType),
+		Severity:     AlertSeverity(spec.Severity),
+		Priority:     AlertPriority(spec.Priority),
+		MaxFrequency: spec.MaxFrequency,
+		AutoResolve:  spec.AutoResolve,
+		Source:       source,
+		CreatedBy:    "rule_file",
+	}
+	if rule.Name == "" {
+		rule.Name = rule.ID
+	}
+	if rule.Expression == "" {
+		return rule, fmt.Errorf("expr is required")
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"cooldown", spec.Cooldown, &rule.Cooldown},
+		{"time_window", spec.TimeWindow, &rule.TimeWindow},
+		{"auto_resolve_delay", spec.AutoResolveDelay, &rule.AutoResolveDelay},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return rule, fmt.Errorf("invalid %s: %w", d.name, err)
+		}
+		*d.dest = duration
+	}
+
+	if len(spec.Actions) == 0 {
+		rule.Actions = []AlertActionType{ActionNotify}
+	}
+	for _, action := range spec.Actions {
+		switch AlertActionType(action) {
+		case ActionNotify, ActionEscalate, ActionLogEvent, ActionCreateTicket:
+			rule.Actions = append(rule.Actions, AlertActionType(action))
+		default:
+			return rule, fmt.Errorf("unsupported action %q", action)
+		}
+	}
+
+	if err := validateAlertRule(&rule); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+// ReloadRuleFiles reloads the configured rule files. Rules from the files
+// are added or replaced, and rules whose definition was removed from the
+// files are dropped. If any file fails to load the current rules are kept.
+func (tas *TopologyAlertingSystem) ReloadRuleFiles() error {
+	tas.mu.RLock()
+	paths := append([]string(nil), tas.config.RuleFiles...)
+	tas.mu.RUnlock()
+
+	rules, err := LoadAlertRuleFiles(paths)
+	if err != nil {
+		tas.mu.Lock()
+		tas.stats.ProcessingErrors++
+		tas.mu.Unlock()
+		return fmt.Errorf("failed to reload alert rules, keeping the current rules: %w", err)
+	}
+
+	tas.mu.Lock()
+	defer tas.mu.Unlock()
+	tas.replaceFileRulesLocked(rules)
+
+	log.Printf("Reloaded %d alert rules from %d files", len(rules), len(paths))
+	return nil
+}
+
+// replaceFileRulesLocked swaps in the rules loaded from rule files; tas.mu
+// must be held. A removed rule that overrode a default rule brings the
+// default back.
+func (tas *TopologyAlertingSystem) replaceFileRulesLocked(rules []AlertRule) {
+	now := time.Now()
+	loaded := make(map[string]AlertRule, len(rules))
+	for _, rule := range rules {
+		loaded[rule.ID] = rule
+	}
+	defaults := make(map[string]AlertRule)
+	for _, rule := range DefaultAlertRules() {
+		defaults[rule.ID] = rule
+	}
+
+	kept := tas.alertRules[:0]
+	for _, existing := range tas.alertRules {
+		rule, reloaded := loaded[existing.ID]
+		switch {
+		case reloaded:
+			rule.CreatedAt = existing.CreatedAt
+			rule.UpdatedAt = now
+			kept = append(kept, rule)
+			delete(loaded, existing.ID)
+		case existing.Source == "":
+			kept = append(kept, existing)
+		case tas.running:
+			if rule, isDefault := defaults[existing.ID]; isDefault {
+				kept = append(kept, rule)
+			}
+		}
+	}
+	for _, rule := range rules {
+		if _, added := loaded[rule.ID]; added {
+			rule.CreatedAt = now
+			rule.UpdatedAt = now
+			kept = append(kept, rule)
+		}
+	}
+	tas.alertRules = kept
+}
+
+// startRuleFileWatcher watches the directories of the rule files and
+// reloads the rules when a rule file changes. Directories are watched
+// rather than the files so editors that replace the file are noticed.
+func (tas *TopologyAlertingSystem) startRuleFileWatcher(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create alert rule watcher: %w", err)
+	}
+
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, path := range tas.config.RuleFiles {
+		path = filepath.Clean(path)
+		files[path] = true
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch alert rule directory %s: %w", dir, err)
+		}
+		dirs[dir] = true
+	}
+
+	go tas.watchRuleFiles(ctx, watcher, files)
+
+	log.Printf("Watching alert rule files: %s", strings.Join(tas.config.RuleFiles, ", "))
+	return nil
+}
+
+func (tas *TopologyAlertingSystem) watchRuleFiles(ctx context.Context, watcher *fsnotify.Watcher, files map[string]bool) {
+	defer watcher.Close()
+
+	var debounce *time.Timer
+	var reload <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			if debounce != nil {
+				debounce.Stop()
+			}
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !files[filepath.Clean(event.Name)] || !event.Has(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) {
+				continue
+			}
+
+			if debounce == nil {
+				debounce = time.NewTimer(ruleReloadDebounce)
+			} else {
+				debounce.Reset(ruleReloadDebounce)
+			}
+			reload = debounce.C
+
+		case <-reload:
+			reload = nil
+			if err := tas.ReloadRuleFiles(); err != nil {
+				log.Printf("Alert rule hot reload failed: %v", err)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Alert rule watcher error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package topology
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rtk_controller/internal/config"
+	"rtk_controller/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addSeries records one sample per minute ending at end, oldest value first
+func addSeries(history *MetricHistory, device, metric string, end time.Time, values ...float64) {
+	for i, value := range values {
+		at := end.Add(-time.Duration(len(values)-1-i) * time.Minute)
+		history.Add(MetricSample{Device: device, Metric: metric, Value: value, Timestamp: at})
+	}
+}
+
+func TestParseRuleExpression(t *testing.T) {
+	expr, err := ParseRuleExpression("rssi < -75 for 5m on group:bedroom")
+	require.NoError(t, err)
+	require.Len(t, expr.Clauses, 1)
+	assert.Equal(t, RuleClause{Metric: "rssi", Operator: "<", Threshold: -75, For: 5 * time.Minute}, expr.Clauses[0])
+	assert.Equal(t, []DeviceSelector{{Kind: "group", Value: "bedroom"}}, expr.Selectors)
+
+	expr, err = ParseRuleExpression(`rate(rssi,10m) <= -2 and absent(online) for 15m on mac:AA:BB:CC:DD:EE:FF, location:"living room"`)
+	require.NoError(t, err)
+	assert.Equal(t, LogicAND, expr.Logic)
+	assert.Equal(t, RuleClause{Function: "rate", Metric: "rssi", Window: 10 * time.Minute, Operator: "<=", Threshold: -2}, expr.Clauses[0])
+	assert.Equal(t, RuleClause{Function: "absent", Metric: "online", For: 15 * time.Minute}, expr.Clauses[1])
+	assert.Equal(t, []DeviceSelector{{Kind: "mac", Value: "AA:BB:CC:DD:EE:FF"}, {Kind: "location", Value: "living room"}}, expr.Selectors)
+	assert.Equal(t, []string{"rssi", "online"}, expr.Metrics())
+	assert.Equal(t, 15*time.Minute+maxSampleAge, expr.Lookback())
+
+	for _, bad := range []string{
+		"",
+		"rssi",
+		"rssi <",
+		"rssi < weak",
+		"rssi = -75",
+		"median(rssi, 5m) < 1",
+		"avg(rssi) < -75",
+		"absent(online)",
+		"rssi < -75 for -5m",
+		"rssi < -75 and snr < 10 or quality < 0.5",
+		"rssi < -75 on room:bedroom",
+		"rssi < -75 on",
+	} {
+		_, err := ParseRuleExpression(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRuleExpression_ThresholdFor(t *testing.T) {
+	now := time.Now().Truncate(time.Minute)
+	history := NewMetricHistory()
+	addSeries(history, "aa:bb:cc:00:00:01", "rssi", now, -80, -80, -79, -81, -80, -82, -80)
+	// One reading above the threshold inside the period
+	addSeries(history, "aa:bb:cc:00:00:02", "rssi", now, -80, -80, -70, -81, -80, -82, -80)
+
+	expr, err := ParseRuleExpression("rssi < -75 for 5m")
+	require.NoError(t, err)
+
+	fired, results := expr.Evaluate(history, "aa:bb:cc:00:00:01", now)
+	assert.True(t, fired)
+	assert.Equal(t, -80.0, results[0].Value)
+
+	fired, _ = expr.Evaluate(history, "aa:bb:cc:00:00:02", now)
+	assert.False(t, fired)
+
+	// Not long enough yet
+	fired, _ = expr.Evaluate(history, "aa:bb:cc:00:00:01", now.Add(-3*time.Minute))
+	assert.False(t, fired)
+
+	// A stale value is no value
+	fired, results = expr.Evaluate(history, "aa:bb:cc:00:00:01", now.Add(time.Hour))
+	assert.False(t, fired)
+	assert.False(t, results[0].Known)
+}
+
+func TestRuleExpression_Functions(t *testing.T) {
+	now := time.Now().Truncate(time.Minute)
+	history := NewMetricHistory()
+	addSeries(history, "ap-1", "rssi", now, -60, -62, -64, -66, -68, -70)
+	// Counter resets between the third and fourth sample
+	addSeries(history, "ap-1", "tx_errors", now, 100, 110, 130, 5, 15)
+	addSeries(history, "ap-1", "packet_loss", now, 2, 4, 6, 8)
+
+	cases := []struct {
+		expr  string
+		value float64
+		fired bool
+	}{
+		{"rate(rssi, 5m) < -1", -2, true},
+		{"increase(tx_errors, 10m) > 40", 45, true},
+		{"avg(packet_loss, 10m) > 5", 5, false},
+		{"min(packet_loss, 2m) >= 4", 4, true},
+		{"max(rssi, 10m) == -60", -60, true},
+		{"rssi != -70", -70, false},
+	}
+	for _, tc := range cases {
+		expr, err := ParseRuleExpression(tc.expr)
+		require.NoError(t, err, tc.expr)
+		fired, results := expr.Evaluate(history, "ap-1", now)
+		assert.Equal(t, tc.fired, fired, tc.expr)
+		assert.InDelta(t, tc.value, results[0].Value, 0.001, tc.expr)
+	}
+
+	expr, err := ParseRuleExpression("rssi > -50 or rate(rssi, 5m) < -1")
+	require.NoError(t, err)
+	fired, results := expr.Evaluate(history, "ap-1", now)
+	assert.True(t, fired)
+	assert.False(t, results[0].Held)
+	assert.True(t, results[1].Held)
+}
+
+func TestRuleExpression_Absent(t *testing.T) {
+	now := time.Now().Truncate(time.Minute)
+	history := NewMetricHistory()
+	addSeries(history, "ap-1", "online", now.Add(-20*time.Minute), 1, 1, 1)
+	addSeries(history, "ap-2", "online", now, 1, 1, 1)
+
+	expr, err := ParseRuleExpression("absent(online) for 15m")
+	require.NoError(t, err)
+
+	fired, results := expr.Evaluate(history, "ap-1", now)
+	assert.True(t, fired)
+	assert.Equal(t, 20.0, results[0].Value)
+
+	fired, _ = expr.Evaluate(history, "ap-2", now)
+	assert.False(t, fired)
+
+	// A device that never reported has nothing to go missing
+	fired, _ = expr.Evaluate(history, "ap-3", now)
+	assert.False(t, fired)
+
+	// Pruning keeps the last sample so absence is still noticed
+	history.Prune(now.Add(-time.Minute))
+	fired, _ = expr.Evaluate(history, "ap-1", now)
+	assert.True(t, fired)
+}
+
+func TestRuleExpression_Selectors(t *testing.T) {
+	identities := map[string]*types.DeviceIdentity{
+		"aabbcc000001": {MacAddress: "aa:bb:cc:00:00:01", Location: "Bedroom", Category: "personal"},
+		"aabbcc000002": {MacAddress: "aa:bb:cc:00:00:02", Location: "kitchen", Tags: []string{"bedroom", "iot"}},
+	}
+	lookup := func(device string) *types.DeviceIdentity {
+		return identities[normalizeDeviceKey(device)]
+	}
+
+	cases := []struct {
+		selectors string
+		matches   []bool // aa:bb:cc:00:00:01, aa:bb:cc:00:00:02, ap-1
+	}{
+		{"all", []bool{true, true, true}},
+		{"group:bedroom", []bool{true, true, false}},
+		{"location:bedroom", []bool{true, false, false}},
+		{"tag:IOT", []bool{false, true, false}},
+		{"category:personal, device:AP-1", []bool{true, false, true}},
+		{"mac:AABBCC000002", []bool{false, true, false}},
+	}
+	for _, tc := range cases {
+		expr, err := ParseRuleExpression("rssi < -75 on " + tc.selectors)
+		require.NoError(t, err, tc.selectors)
+		for i, device := range []string{"aa:bb:cc:00:00:01", "aa:bb:cc:00:00:02", "ap-1"} {
+			assert.Equal(t, tc.matches[i], expr.AppliesTo(device, lookup), "%s on %s", device, tc.selectors)
+		}
+	}
+}
+
+func TestParseAlertRules(t *testing.T) {
+	rules, err := ParseAlertRules([]byte(`
+rules:
+  - id: bedroom_weak_signal
+    expr: rssi < -75 for 5m on group:bedroom
+    severity: error
+    cooldown: 15m
+    auto_resolve: true
+  - id: legacy_disabled
+    name: Disabled rule
+    expr: quality < 0.3
+    enabled: false
+    actions: [log_event]
+`), "rules.yaml")
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+
+	rule := rules[0]
+	assert.Equal(t, "bedroom_weak_signal", rule.Name)
+	assert.Equal(t, TopologyAlertType("bedroom_weak_signal"), rule.AlertType)
+	assert.Equal(t, AlertSeverity(SeverityError), rule.Severity)
+	assert.Equal(t, 15*time.Minute, rule.Cooldown)
+	assert.Equal(t, []AlertActionType{ActionNotify}, rule.Actions)
+	assert.Equal(t, "rules.yaml", rule.Source)
+	assert.True(t, rule.Enabled)
+	require.NotNil(t, rule.compiled)
+
+	assert.False(t, rules[1].Enabled)
+	assert.Equal(t, AlertSeverity(SeverityWarning), rules[1].Severity)
+	assert.Equal(t, []AlertActionType{ActionLogEvent}, rules[1].Actions)
+
+	for name, bad := range map[string]string{
+		"no expr":      "rules:\n  - id: a\n",
+		"bad expr":     "rules:\n  - id: a\n    expr: rssi <\n",
+		"duplicate id": "rules:\n  - id: a\n    expr: rssi < 1\n  - id: a\n    expr: rssi < 2\n",
+		"bad severity": "rules:\n  - id: a\n    expr: rssi < 1\n    severity: urgent\n",
+		"bad action":   "rules:\n  - id: a\n    expr: rssi < 1\n    actions: [reboot]\n",
+		"unknown key":  "rules:\n  - id: a\n    expression: rssi < 1\n",
+	} {
+		_, err := ParseAlertRules([]byte(bad), "rules.yaml")
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAlertingSystem_AddAlertRuleConvertsConditions(t *testing.T) {
+	tas := newTestAlertingSystem(t, config.AlertingConfig{})
+
+	require.NoError(t, tas.AddAlertRule(AlertRule{
+		ID:   "slow",
+		Name: "Slow link",
+		Conditions: []RuleCondition{
+			{Field: "latency_ms", Operator: OperatorGreaterThan, Threshold: 100, TimeWindow: 5 * time.Minute, AggregationFunction: AggregationAverage},
+			{Field: "packet_loss", Operator: OperatorGreaterThanOrEqual, Threshold: 2},
+		},
+		ConditionLogic: LogicOR,
+	}))
+	require.NoError(t, tas.AddAlertRule(AlertRule{ID: "weak", Name: "Weak", Expression: "rssi < -75"}))
+
+	// Same ID replaces the rule
+	require.NoError(t, tas.AddAlertRule(AlertRule{ID: "weak", Name: "Weaker", Expression: "rssi < -80"}))
+
+	rules := tas.GetAlertRules()
+	require.Len(t, rules, 2)
+	assert.Equal(t, "avg(latency_ms, 5m0s) > 100 or packet_loss >= 2", rules[0].Expression)
+	assert.Equal(t, "rssi < -80", rules[1].Expression)
+
+	assert.Error(t, tas.AddAlertRule(AlertRule{ID: "bad", Name: "Bad", Expression: "rssi <"}))
+	assert.Error(t, tas.AddAlertRule(AlertRule{ID: "empty", Name: "Empty"}))
+	assert.Error(t, tas.AddAlertRule(AlertRule{
+		ID:         "status",
+		Name:       "Status",
+		Conditions: []RuleCondition{{Field: "device_status", Operator: ComparisonOperator("equals"), Value: "offline"}},
+	}))
+
+	require.NoError(t, tas.RemoveAlertRule("weak"))
+	assert.Error(t, tas.RemoveAlertRule("weak"))
+	assert.Len(t, tas.GetAlertRules(), 1)
+}
+
+func TestAlertingSystem_EvaluateRule(t *testing.T) {
+	tas := newTestAlertingSystem(t, config.AlertingConfig{})
+	require.NoError(t, tas.AddAlertRule(AlertRule{
+		ID:          "weak_signal",
+		Name:        "Weak signal",
+		Enabled:     true,
+		Expression:  "rssi < -75 for 2m",
+		Severity:    SeverityWarning,
+		Cooldown:    time.Hour,
+		AutoResolve: true,
+	}))
+	rule := tas.GetAlertRules()[0]
+
+	now := time.Now().Truncate(time.Minute)
+	addSeries(tas.metricHistory, "aa:bb:cc:00:00:01", "rssi", now, -80, -80, -80)
+	addSeries(tas.metricHistory, "aa:bb:cc:00:00:02", "rssi", now, -60, -60, -60)
+
+	tas.evaluateRule(rule, now)
+	alerts := tas.GetActiveAlerts()
+	require.Len(t, alerts, 1)
+	alert := alerts[0]
+	assert.Equal(t, "aa:bb:cc:00:00:01", alert.MacAddress)
+	assert.Equal(t, TopologyAlertType("weak_signal"), alert.Type)
+	assert.Equal(t, "weak_signal", alert.CustomFields["rule_id"])
+	assert.Contains(t, alert.Description, "rssi < -75 for 2m0s (now -80)")
+	require.Len(t, alert.TriggerConditions, 1)
+	assert.Equal(t, -80.0, alert.TriggerConditions[0].ActualValue)
+
+	// Still firing: the open alert is kept, not duplicated
+	addSeries(tas.metricHistory, "aa:bb:cc:00:00:01", "rssi", now.Add(time.Minute), -81)
+	tas.evaluateRule(rule, now.Add(time.Minute))
+	alerts = tas.GetActiveAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, now.Add(time.Minute), alerts[0].LastOccurrence)
+
+	// Cleared: auto-resolved
+	addSeries(tas.metricHistory, "aa:bb:cc:00:00:01", "rssi", now.Add(2*time.Minute), -60)
+	tas.evaluateRule(rule, now.Add(2*time.Minute))
+	assert.Empty(t, tas.GetActiveAlerts())
+
+	// Firing again within the cooldown raises nothing
+	addSeries(tas.metricHistory, "aa:bb:cc:00:00:01", "rssi", now.Add(6*time.Minute), -80, -80, -80)
+	tas.evaluateRule(rule, now.Add(6*time.Minute))
+	assert.Empty(t, tas.GetActiveAlerts())
+}
+
+func TestAlertingSystem_RuleFilesReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - id: weak_signal
+    expr: rssi < -75
+  - id: excessive_roaming
+    expr: roaming_frequency > 10
+`), 0644))
+
+	tas := newTestAlertingSystem(t, config.AlertingConfig{RuleFiles: []string{path}, WatchRules: true})
+	tas.config.AlertProcessingInterval = time.Hour
+	tas.config.NotificationRetryInterval = time.Hour
+	tas.config.AlertCleanupInterval = time.Hour
+	require.NoError(t, tas.Start())
+	t.Cleanup(func() { tas.Stop() })
+
+	expressions := func() map[string]string {
+		result := make(map[string]string)
+		for _, rule := range tas.GetAlertRules() {
+			result[rule.ID] = rule.Expression
+		}
+		return result
+	}
+	assert.Equal(t, map[string]string{
+		"weak_signal":         "rssi < -75",
+		"excessive_roaming":   "roaming_frequency > 10",
+		"device_offline":      "online == 0",
+		"quality_degradation": "avg(quality, 5m) < 0.5",
+	}, expressions())
+
+	// An invalid edit keeps the current rules
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - id: weak_signal\n    expr: rssi <\n"), 0644))
+	assert.Error(t, tas.ReloadRuleFiles())
+	assert.Equal(t, "rssi < -75", expressions()["weak_signal"])
+
+	// Removing the override brings the default rule back
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - id: weak_signal
+    expr: rssi < -80 for 5m
+`), 0644))
+	require.Eventually(t, func() bool {
+		return expressions()["weak_signal"] == "rssi < -80 for 5m"
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, "roaming_frequency > 5", expressions()["excessive_roaming"])
+	assert.Len(t, expressions(), 4)
+}
+
+func TestTestAlertRule(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	history := NewMetricHistory()
+	values := []float64{-60, -60, -80, -80, -80, -80, -80, -60, -60, -60}
+	addSeries(history, "aa:bb:cc:00:00:01", "rssi", start.Add(9*time.Minute), values...)
+	addSeries(history, "aa:bb:cc:00:00:02", "rssi", start.Add(9*time.Minute), values...)
+
+	lookup := func(device string) *types.DeviceIdentity {
+		if device == "aa:bb:cc:00:00:01" {
+			return &types.DeviceIdentity{MacAddress: device, Location: "bedroom"}
+		}
+		return nil
+	}
+	rule := AlertRule{ID: "weak", Expression: "rssi < -75 for 2m on group:bedroom"}
+
+	result, err := TestAlertRule(rule, history, start, start.Add(9*time.Minute), time.Minute, lookup)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Devices)
+	assert.Equal(t, 10, result.Evaluations)
+	require.Len(t, result.Firings, 1)
+	firing := result.Firings[0]
+	assert.Equal(t, "aa:bb:cc:00:00:01", firing.Device)
+	assert.Equal(t, start.Add(4*time.Minute), firing.Start)
+	assert.Equal(t, start.Add(7*time.Minute), firing.End)
+
+	_, err = TestAlertRule(AlertRule{ID: "bad", Expression: "rssi <"}, history, start, start.Add(time.Minute), time.Minute, nil)
+	assert.Error(t, err)
+}
+
+func TestExtractMetricSamples(t *testing.T) {
+	logged := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	samples := ExtractMetricSamples("rtk/v1/acme/hq/ap-1/telemetry/wifi_clients", []byte(`{
+		"schema": "wifi_clients/1.0",
+		"timestamp": 1767268800000,
+		"radio": {"channel": 36, "enabled": true},
+		"clients": [
+			{"mac_address": "AA:BB:CC:00:00:01", "rssi": -71, "tx_rate": 433},
+			{"hostname": "no-mac", "rssi": -50}
+		]
+	}`), logged)
+	byKey := make(map[string]MetricSample)
+	for _, sample := range samples {
+		byKey[sample.Device+"/"+sample.Metric] = sample
+	}
+	assert.Len(t, byKey, 4)
+	assert.Equal(t, 36.0, byKey["ap-1/radio.channel"].Value)
+	assert.Equal(t, 1.0, byKey["ap-1/radio.enabled"].Value)
+	assert.Equal(t, -71.0, byKey["AA:BB:CC:00:00:01/rssi"].Value)
+	assert.Equal(t, 433.0, byKey["AA:BB:CC:00:00:01/tx_rate"].Value)
+	assert.Equal(t, time.UnixMilli(1767268800000), byKey["ap-1/radio.channel"].Timestamp)
+
+	samples = ExtractMetricSamples("rtk/v1/acme/hq/ap-1/lwt", []byte(`{"status":"offline"}`), logged)
+	assert.Equal(t, []MetricSample{{Device: "ap-1", Metric: "online", Value: 0, Timestamp: logged}}, samples)
+
+	samples = ExtractMetricSamples("rtk/v1/acme/hq/ap-1/state", []byte(`{"health":"ok","uptime_s":120}`), logged)
+	assert.ElementsMatch(t, []MetricSample{
+		{Device: "ap-1", Metric: "online", Value: 1, Timestamp: logged},
+		{Device: "ap-1", Metric: "uptime_s", Value: 120, Timestamp: logged},
+	}, samples)
+
+	assert.Empty(t, ExtractMetricSamples("rtk/v1/acme/hq/_controller/alerts", []byte(`{"frequency":1}`), logged))
+	assert.Empty(t, ExtractMetricSamples("rtk/v1/acme/hq/ap-1/state", []byte(`not json`), logged))
+}
@@ -347,6 +347,22 @@ type QualityMonitorConfig struct {
 	CustomThresholds *QualityThresholds
 }
 
+// DefaultQualityMonitorConfig returns the monitoring intervals and history
+// limits of the connection quality monitor
+func DefaultQualityMonitorConfig() QualityMonitorConfig {
+	return QualityMonitorConfig{
+		QualityCheckInterval:      30 * time.Second,
+		MetricsCollectionInterval: time.Minute,
+		TrendAnalysisInterval:     5 * time.Minute,
+		AlertCheckInterval:        30 * time.Second,
+		QualityHistorySize:        100,
+		MetricsRetention:          24 * time.Hour,
+		AlertRetention:            7 * 24 * time.Hour,
+		EnableTrendAnalysis:       true,
+		TrendWindowSize:           10,
+	}
+}
+
 // QualityMonitorStats holds monitoring statistics
 type QualityMonitorStats struct {
 	MonitoredConnections       int64
@@ -172,6 +172,13 @@ func (m *Manager) Stop() error {
 	return nil
 }
 
+// IsRunning reports whether the manager has been started and not stopped
+func (m *Manager) IsRunning() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.running
+}
+
 // GetTopology returns the current network topology
 func (m *Manager) GetTopology() *types.NetworkTopology {
 	m.mu.RLock()
@@ -17,6 +17,7 @@ type NetworkDiagnosticsEngine struct {
 	roamingDetector   *RoamingDetector
 	alertingSystem    *TopologyAlertingSystem
 	connectionTracker *ConnectionHistoryTracker
+	wifiCollector     *WiFiClientCollector
 	storage           *storage.TopologyStorage
 	identityStorage   *storage.IdentityStorage
 
@@ -375,6 +376,42 @@ type DiagnosticStats struct {
 	ProcessingErrors int64         `json:"processing_errors"`
 }
 
+// DefaultDiagnosticConfig returns the diagnostic configuration with the
+// thresholds reports are graded against
+func DefaultDiagnosticConfig() DiagnosticConfig {
+	return DiagnosticConfig{
+		ReportRetention:    7 * 24 * time.Hour,
+		AutoReportInterval: time.Hour,
+		QualityThresholds: DiagnosticThresholds{
+			ExcellentQuality:  0.9,
+			GoodQuality:       0.7,
+			AcceptableQuality: 0.5,
+			PoorQuality:       0.3,
+			CriticalQuality:   0.3,
+		},
+		PerformanceThresholds: PerformanceThresholds{
+			MaxAcceptableLatency:    100,
+			MinAcceptableBandwidth:  10,
+			MaxAcceptablePacketLoss: 1.0,
+			MaxAcceptableJitter:     30,
+			MinSignalStrength:       -75,
+		},
+		ConnectivityThresholds: ConnectivityThresholds{
+			MinConnectionSuccess: 0.95,
+			MaxDisconnectionRate: 2,
+			MaxReconnectionTime:  5 * time.Minute,
+			MinSessionStability:  0.9,
+		},
+		AnalysisTimeWindow:     24 * time.Hour,
+		MinimumDataPoints:      10,
+		DetailLevel:            DetailLevelStandard,
+		IncludeRecommendations: true,
+		MaxConcurrentTests:     4,
+		TestTimeoutDuration:    30 * time.Second,
+		RetryAttempts:          2,
+	}
+}
+
 // NewNetworkDiagnosticsEngine creates a new network diagnostics engine
 func NewNetworkDiagnosticsEngine(
 	topologyManager *Manager,
@@ -382,6 +419,7 @@ func NewNetworkDiagnosticsEngine(
 	roamingDetector *RoamingDetector,
 	alertingSystem *TopologyAlertingSystem,
 	connectionTracker *ConnectionHistoryTracker,
+	wifiCollector *WiFiClientCollector,
 	storage *storage.TopologyStorage,
 	identityStorage *storage.IdentityStorage,
 	config DiagnosticConfig,
@@ -392,6 +430,7 @@ func NewNetworkDiagnosticsEngine(
 		roamingDetector:   roamingDetector,
 		alertingSystem:    alertingSystem,
 		connectionTracker: connectionTracker,
+		wifiCollector:     wifiCollector,
 		storage:           storage,
 		identityStorage:   identityStorage,
 		config:            config,
@@ -597,60 +636,6 @@ func (nde *NetworkDiagnosticsEngine) generateTopologyHealth(report *NetworkDiagn
 	return nil
 }
 
-func (nde *NetworkDiagnosticsEngine) generateQualityAnalysis(report *NetworkDiagnosticReport) error {
-	// Implementation would analyze connection quality across the network
-	report.QualityAnalysis = QualityAnalysisReport{
-		AverageQuality: 0.75, // Example value
-		QualityDistribution: map[string]int{
-			"excellent": 5,
-			"good":      8,
-			"fair":      3,
-			"poor":      1,
-		},
-	}
-	return nil
-}
-
-func (nde *NetworkDiagnosticsEngine) generatePerformanceReport(report *NetworkDiagnosticReport) error {
-	// Implementation would analyze latency, throughput, packet loss, etc.
-	report.Performance = PerformanceReport{
-		LatencyAnalysis: LatencyAnalysis{
-			AverageLatency: 15.5,
-			P95Latency:     45.2,
-			P99Latency:     89.1,
-		},
-	}
-	return nil
-}
-
-func (nde *NetworkDiagnosticsEngine) generateConnectivityReport(report *NetworkDiagnosticReport) error {
-	// Implementation would analyze connection success rates, stability, etc.
-	report.Connectivity = ConnectivityReport{
-		ConnectionSuccess: 0.95,
-		SessionStability:  0.88,
-	}
-	return nil
-}
-
-func (nde *NetworkDiagnosticsEngine) generateSecurityReport(report *NetworkDiagnosticReport) error {
-	// Implementation would analyze security aspects
-	report.Security = SecurityReport{
-		SecurityScore:       85.0,
-		OpenNetworks:        []OpenNetworkInfo{},
-		WeakSecurityDevices: []WeakSecurityDevice{},
-	}
-	return nil
-}
-
-func (nde *NetworkDiagnosticsEngine) generateRoamingAnalysis(report *NetworkDiagnosticReport) error {
-	// Implementation would analyze roaming patterns and issues
-	report.RoamingAnalysis = RoamingAnalysisReport{
-		RoamingFrequency: 2.5, // Events per hour
-		RoamingSuccess:   0.92,
-	}
-	return nil
-}
-
 func (nde *NetworkDiagnosticsEngine) analyzeIssues(report *NetworkDiagnosticReport) {
 	// Implementation would analyze all collected data to identify issues
 	issues := []DiagnosticIssue{}
@@ -713,13 +698,18 @@ func (nde *NetworkDiagnosticsEngine) generatePredictions(report *NetworkDiagnost
 }
 
 func (nde *NetworkDiagnosticsEngine) calculateOverallHealth(report *NetworkDiagnosticReport) {
-	// Calculate overall health score based on various factors
-	qualityScore := report.QualityAnalysis.AverageQuality * 100
-	connectivityScore := report.Connectivity.ConnectionSuccess * 100
-	securityScore := report.Security.SecurityScore
-
-	// Weight the different scores
-	overallScore := (qualityScore*0.4 + connectivityScore*0.3 + securityScore*0.3)
+	// Weight the scores of the sections that had data to analyze
+	score := report.Security.SecurityScore * 0.3
+	weight := 0.3
+	if len(report.QualityAnalysis.QualityDistribution) > 0 {
+		score += report.QualityAnalysis.AverageQuality * 100 * 0.4
+		weight += 0.4
+	}
+	if len(report.Connectivity.DeviceReliability) > 0 {
+		score += report.Connectivity.ConnectionSuccess * 100 * 0.3
+		weight += 0.3
+	}
+	overallScore := score / weight
 	report.HealthScore = overallScore
 
 	// Determine health status
@@ -0,0 +1,1010 @@
+package topology
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"rtk_controller/pkg/types"
+)
+
+const (
+	// failedSessionDuration is how short a session must be to count as a
+	// failed connection attempt
+	failedSessionDuration = 30 * time.Second
+
+	// defaultReconnectionWindow is how soon a client must reconnect for the
+	// end of its session to count as a drop, when MaxReconnectionTime is unset
+	defaultReconnectionWindow = 5 * time.Minute
+
+	// Roaming classification used when the roaming detector has no thresholds
+	defaultPingPongWindow        = 2 * time.Minute
+	defaultExcessiveRoamsPerHour = 10
+)
+
+// analysisWindow returns the period a report covers: its time window, or
+// AnalysisTimeWindow (24h if unset) up to when the report was generated
+func (nde *NetworkDiagnosticsEngine) analysisWindow(report *NetworkDiagnosticReport) (time.Time, time.Time) {
+	end := report.TimeWindow.EndTime
+	if end.IsZero() {
+		end = report.GeneratedAt
+	}
+	start := report.TimeWindow.StartTime
+	if start.IsZero() || !start.Before(end) {
+		window := nde.config.AnalysisTimeWindow
+		if window <= 0 {
+			window = 24 * time.Hour
+		}
+		start = end.Add(-window)
+	}
+	return start, end
+}
+
+// diagnosticTopology resolves the devices collectors refer to by ID or MAC
+type diagnosticTopology struct {
+	topology *types.NetworkTopology
+	links    *upstreamLinks
+}
+
+func (nde *NetworkDiagnosticsEngine) diagnosticTopology() *diagnosticTopology {
+	if nde.topologyManager == nil {
+		return &diagnosticTopology{}
+	}
+	topology := nde.topologyManager.GetTopology()
+	if topology == nil {
+		return &diagnosticTopology{}
+	}
+	return &diagnosticTopology{topology: topology, links: newUpstreamLinks(topology)}
+}
+
+func (dt *diagnosticTopology) device(key string) *types.NetworkDevice {
+	if dt.topology == nil || key == "" {
+		return nil
+	}
+	return dt.topology.Devices[dt.links.canonical(key)]
+}
+
+// location returns the location of the first of the devices that has one
+func (dt *diagnosticTopology) location(keys ...string) string {
+	for _, key := range keys {
+		if device := dt.device(key); device != nil && device.Location != "" {
+			return device.Location
+		}
+	}
+	return "unknown"
+}
+
+// deviceIDs returns the IDs of the topology's devices in order
+func (dt *diagnosticTopology) deviceIDs() []string {
+	if dt.topology == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(dt.topology.Devices))
+	for id := range dt.topology.Devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// qualityConnections returns the monitored connections ordered by key
+func (nde *NetworkDiagnosticsEngine) qualityConnections() []*ConnectionMetrics {
+	if nde.qualityMonitor == nil {
+		return nil
+	}
+	all := nde.qualityMonitor.GetAllConnectionQuality()
+	keys := make([]string, 0, len(all))
+	for key := range all {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	connections := make([]*ConnectionMetrics, 0, len(keys))
+	for _, key := range keys {
+		connections = append(connections, all[key])
+	}
+	return connections
+}
+
+// connectionLabel names a connection by its client, or by the device when
+// it has no client MAC
+func connectionLabel(metrics *ConnectionMetrics) string {
+	if metrics.MacAddress != "" {
+		return metrics.MacAddress
+	}
+	return metrics.DeviceID
+}
+
+func (nde *NetworkDiagnosticsEngine) qualityGrade(score float64) QualityGrade {
+	thresholds := nde.config.QualityThresholds
+	switch {
+	case score >= thresholds.ExcellentQuality:
+		return GradeExcellent
+	case score >= thresholds.GoodQuality:
+		return GradeGood
+	case score >= thresholds.AcceptableQuality:
+		return GradeFair
+	case score >= thresholds.PoorQuality:
+		return GradePoor
+	default:
+		return GradeCritical
+	}
+}
+
+func (nde *NetworkDiagnosticsEngine) weakSignal(rssi int) bool {
+	minimum := nde.config.PerformanceThresholds.MinSignalStrength
+	return rssi != 0 && minimum != 0 && rssi < minimum
+}
+
+// connectionProblems lists where a connection misses the performance
+// thresholds, with a suggestion for each
+func (nde *NetworkDiagnosticsEngine) connectionProblems(metrics *ConnectionMetrics) ([]string, []string) {
+	thresholds := nde.config.PerformanceThresholds
+	var issues, suggestions []string
+
+	if rssi := metrics.SignalStrength.CurrentRSSI; nde.weakSignal(rssi) {
+		issues = append(issues, fmt.Sprintf("weak signal (%d dBm)", rssi))
+		suggestions = append(suggestions, "Move the device closer to an access point or extend coverage")
+	}
+	if latency := metrics.Latency.CurrentLatencyMs; thresholds.MaxAcceptableLatency > 0 && latency > thresholds.MaxAcceptableLatency {
+		issues = append(issues, fmt.Sprintf("high latency (%.1f ms)", latency))
+		suggestions = append(suggestions, "Check the access point and its uplink for congestion")
+	}
+	if loss := metrics.PacketLoss.CurrentLossRate; thresholds.MaxAcceptablePacketLoss > 0 && loss > thresholds.MaxAcceptablePacketLoss {
+		issues = append(issues, fmt.Sprintf("packet loss (%.1f%%)", loss))
+		suggestions = append(suggestions, "Look for interference and move to a less busy channel")
+	}
+	if jitter := metrics.Jitter.CurrentJitterMs; thresholds.MaxAcceptableJitter > 0 && jitter > thresholds.MaxAcceptableJitter {
+		issues = append(issues, fmt.Sprintf("high jitter (%.1f ms)", jitter))
+		suggestions = append(suggestions, "Prioritize real-time traffic with QoS")
+	}
+	if throughput := metrics.Throughput.CurrentThroughputMbps; thresholds.MinAcceptableBandwidth > 0 &&
+		throughput > 0 && throughput < thresholds.MinAcceptableBandwidth {
+		issues = append(issues, fmt.Sprintf("low throughput (%.1f Mbps)", throughput))
+		suggestions = append(suggestions, "Steer the client to the 5 GHz band or a wider channel")
+	}
+	return issues, suggestions
+}
+
+func (nde *NetworkDiagnosticsEngine) generateQualityAnalysis(report *NetworkDiagnosticReport) error {
+	start, end := nde.analysisWindow(report)
+	topology := nde.diagnosticTopology()
+
+	analysis := QualityAnalysisReport{
+		QualityDistribution: make(map[string]int),
+		QualityTrends:       []QualityTrendPoint{},
+		PoorQualityDevices:  []PoorQualityDevice{},
+		QualityHotspots:     []QualityHotspot{},
+		SignalCoverage: SignalCoverageAnalysis{
+			WeakSpots:         []WeakSignalSpot{},
+			OptimalPlacements: []OptimalPlacement{},
+		},
+	}
+
+	type locationQuality struct {
+		total   float64
+		devices int
+		poor    int
+		weak    int
+	}
+	type trendBucket struct {
+		total float64
+		count int
+	}
+	locations := make(map[string]*locationQuality)
+	weakSpots := make(map[string]*WeakSignalSpot)
+	weakRSSI := make(map[string]int)
+	trends := make(map[time.Time]*trendBucket)
+
+	connections := nde.qualityConnections()
+	var totalQuality float64
+	var wifiConnections, coveredConnections int
+	for _, metrics := range connections {
+		quality := metrics.OverallQuality.Overall
+		label := connectionLabel(metrics)
+		location := topology.location(metrics.MacAddress, metrics.DeviceID)
+
+		totalQuality += quality
+		analysis.QualityDistribution[string(nde.qualityGrade(quality))]++
+
+		lq, exists := locations[location]
+		if !exists {
+			lq = &locationQuality{}
+			locations[location] = lq
+		}
+		lq.total += quality
+		lq.devices++
+
+		if quality < nde.config.QualityThresholds.AcceptableQuality {
+			lq.poor++
+			issues, suggestions := nde.connectionProblems(metrics)
+			if len(issues) == 0 {
+				issues = []string{fmt.Sprintf("low quality score (%.2f)", quality)}
+				suggestions = []string{"Review the connection's stability and signal history"}
+			}
+			analysis.PoorQualityDevices = append(analysis.PoorQualityDevices, PoorQualityDevice{
+				DeviceID:    label,
+				Quality:     quality,
+				Issues:      issues,
+				Suggestions: suggestions,
+			})
+		}
+
+		if rssi := metrics.SignalStrength.CurrentRSSI; rssi != 0 {
+			wifiConnections++
+			if nde.weakSignal(rssi) {
+				lq.weak++
+				spot, exists := weakSpots[location]
+				if !exists {
+					spot = &WeakSignalSpot{Location: location}
+					weakSpots[location] = spot
+				}
+				spot.Devices = append(spot.Devices, label)
+				weakRSSI[location] += rssi
+			} else {
+				coveredConnections++
+			}
+		}
+
+		for _, snapshot := range nde.qualityMonitor.GetQualityHistory(metrics.DeviceID, metrics.MacAddress, start) {
+			if snapshot.Timestamp.After(end) {
+				continue
+			}
+			hour := snapshot.Timestamp.Truncate(time.Hour)
+			bucket, exists := trends[hour]
+			if !exists {
+				bucket = &trendBucket{}
+				trends[hour] = bucket
+			}
+			bucket.total += snapshot.OverallQuality
+			bucket.count++
+		}
+	}
+
+	if len(connections) > 0 {
+		analysis.AverageQuality = totalQuality / float64(len(connections))
+	}
+	sort.Slice(analysis.PoorQualityDevices, func(i, j int) bool {
+		a, b := analysis.PoorQualityDevices[i], analysis.PoorQualityDevices[j]
+		if a.Quality != b.Quality {
+			return a.Quality < b.Quality
+		}
+		return a.DeviceID < b.DeviceID
+	})
+
+	// Network-wide quality per hour
+	for hour, bucket := range trends {
+		analysis.QualityTrends = append(analysis.QualityTrends, QualityTrendPoint{
+			Timestamp: hour,
+			Quality:   bucket.total / float64(bucket.count),
+		})
+	}
+	sort.Slice(analysis.QualityTrends, func(i, j int) bool {
+		return analysis.QualityTrends[i].Timestamp.Before(analysis.QualityTrends[j].Timestamp)
+	})
+
+	// Locations whose connections are on average below acceptable
+	for location, lq := range locations {
+		average := lq.total / float64(lq.devices)
+		if average >= nde.config.QualityThresholds.AcceptableQuality {
+			continue
+		}
+		hotspot := QualityHotspot{
+			Location:       location,
+			AverageQuality: average,
+			DeviceCount:    lq.devices,
+			Issues:         []string{fmt.Sprintf("poor quality on %d of %d connections", lq.poor, lq.devices)},
+		}
+		if lq.weak > 0 {
+			hotspot.Issues = append(hotspot.Issues, fmt.Sprintf("weak signal on %d of %d connections", lq.weak, lq.devices))
+		}
+		analysis.QualityHotspots = append(analysis.QualityHotspots, hotspot)
+	}
+	sort.Slice(analysis.QualityHotspots, func(i, j int) bool {
+		a, b := analysis.QualityHotspots[i], analysis.QualityHotspots[j]
+		if a.AverageQuality != b.AverageQuality {
+			return a.AverageQuality < b.AverageQuality
+		}
+		return a.Location < b.Location
+	})
+
+	if wifiConnections > 0 {
+		analysis.SignalCoverage.CoveragePercentage = float64(coveredConnections) / float64(wifiConnections) * 100
+	}
+	for location, spot := range weakSpots {
+		spot.SignalStrength = weakRSSI[location] / len(spot.Devices)
+		sort.Strings(spot.Devices)
+		analysis.SignalCoverage.WeakSpots = append(analysis.SignalCoverage.WeakSpots, *spot)
+	}
+	sort.Slice(analysis.SignalCoverage.WeakSpots, func(i, j int) bool {
+		return analysis.SignalCoverage.WeakSpots[i].Location < analysis.SignalCoverage.WeakSpots[j].Location
+	})
+	for _, spot := range analysis.SignalCoverage.WeakSpots {
+		analysis.SignalCoverage.OptimalPlacements = append(analysis.SignalCoverage.OptimalPlacements, OptimalPlacement{
+			Location:    spot.Location,
+			Improvement: "Add an access point or mesh node",
+			Justification: fmt.Sprintf("clients here average %d dBm, below the %d dBm minimum",
+				spot.SignalStrength, nde.config.PerformanceThresholds.MinSignalStrength),
+		})
+	}
+
+	report.QualityAnalysis = analysis
+	return nil
+}
+
+func (nde *NetworkDiagnosticsEngine) generatePerformanceReport(report *NetworkDiagnosticReport) error {
+	start, end := nde.analysisWindow(report)
+	thresholds := nde.config.PerformanceThresholds
+
+	performance := PerformanceReport{
+		ThroughputAnalysis: ThroughputAnalysis{BottleneckDevices: []string{}},
+		PacketLossAnalysis: PacketLossAnalysis{AffectedDevices: []string{}},
+		JitterAnalysis:     JitterAnalysis{JitterHotspots: []string{}},
+		PerformanceTrends:  []PerformanceTrendPoint{},
+		Bottlenecks:        []PerformanceBottleneck{},
+	}
+
+	addBottleneck := func(device, kind, impact string, severity float64) {
+		performance.Bottlenecks = append(performance.Bottlenecks, PerformanceBottleneck{
+			DeviceID: device,
+			Type:     kind,
+			Impact:   impact,
+			Severity: severity,
+		})
+	}
+
+	var latencies []float64
+	var throughputTotal, lossTotal, jitterTotal float64
+	var throughputCount int
+	connections := nde.qualityConnections()
+	for _, metrics := range connections {
+		label := connectionLabel(metrics)
+
+		if latency := metrics.Latency.CurrentLatencyMs; latency > 0 {
+			latencies = append(latencies, latency)
+			if thresholds.MaxAcceptableLatency > 0 && latency > thresholds.MaxAcceptableLatency {
+				addBottleneck(label, "latency",
+					fmt.Sprintf("latency %.1f ms exceeds %.1f ms", latency, thresholds.MaxAcceptableLatency),
+					latency/thresholds.MaxAcceptableLatency)
+			}
+		}
+
+		if throughput := metrics.Throughput.CurrentThroughputMbps; throughput > 0 {
+			throughputTotal += throughput
+			throughputCount++
+			performance.ThroughputAnalysis.PeakThroughput = math.Max(performance.ThroughputAnalysis.PeakThroughput,
+				math.Max(throughput, metrics.Throughput.PeakThroughputMbps))
+			if thresholds.MinAcceptableBandwidth > 0 && throughput < thresholds.MinAcceptableBandwidth {
+				performance.ThroughputAnalysis.BottleneckDevices = append(performance.ThroughputAnalysis.BottleneckDevices, label)
+				addBottleneck(label, "throughput",
+					fmt.Sprintf("throughput %.1f Mbps is below %.1f Mbps", throughput, thresholds.MinAcceptableBandwidth),
+					thresholds.MinAcceptableBandwidth/throughput)
+			}
+		}
+
+		loss := metrics.PacketLoss.CurrentLossRate
+		lossTotal += loss
+		performance.PacketLossAnalysis.MaxPacketLoss = math.Max(performance.PacketLossAnalysis.MaxPacketLoss,
+			math.Max(loss, metrics.PacketLoss.MaxLossRate)/100)
+		if thresholds.MaxAcceptablePacketLoss > 0 && loss > thresholds.MaxAcceptablePacketLoss {
+			performance.PacketLossAnalysis.AffectedDevices = append(performance.PacketLossAnalysis.AffectedDevices, label)
+			addBottleneck(label, "packet_loss",
+				fmt.Sprintf("packet loss %.1f%% exceeds %.1f%%", loss, thresholds.MaxAcceptablePacketLoss),
+				loss/thresholds.MaxAcceptablePacketLoss)
+		}
+
+		jitter := metrics.Jitter.CurrentJitterMs
+		jitterTotal += jitter
+		performance.JitterAnalysis.MaxJitter = math.Max(performance.JitterAnalysis.MaxJitter,
+			math.Max(jitter, metrics.Jitter.MaxJitterMs))
+		if thresholds.MaxAcceptableJitter > 0 && jitter > thresholds.MaxAcceptableJitter {
+			performance.JitterAnalysis.JitterHotspots = append(performance.JitterAnalysis.JitterHotspots, label)
+			addBottleneck(label, "jitter",
+				fmt.Sprintf("jitter %.1f ms exceeds %.1f ms", jitter, thresholds.MaxAcceptableJitter),
+				jitter/thresholds.MaxAcceptableJitter)
+		}
+	}
+
+	if len(latencies) > 0 {
+		sort.Float64s(latencies)
+		total := 0.0
+		for _, latency := range latencies {
+			total += latency
+		}
+		performance.LatencyAnalysis = LatencyAnalysis{
+			AverageLatency: total / float64(len(latencies)),
+			P95Latency:     percentile(latencies, 0.95),
+			P99Latency:     percentile(latencies, 0.99),
+		}
+	}
+	if throughputCount > 0 {
+		performance.ThroughputAnalysis.AverageThroughput = throughputTotal / float64(throughputCount)
+	}
+	if len(connections) > 0 {
+		// The quality monitor reports percentages, the report fractions
+		performance.PacketLossAnalysis.AveragePacketLoss = lossTotal / float64(len(connections)) / 100
+		performance.JitterAnalysis.AverageJitter = jitterTotal / float64(len(connections))
+	}
+	sort.Slice(performance.Bottlenecks, func(i, j int) bool {
+		a, b := performance.Bottlenecks[i], performance.Bottlenecks[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if a.DeviceID != b.DeviceID {
+			return a.DeviceID < b.DeviceID
+		}
+		return a.Type < b.Type
+	})
+
+	// Hourly averages of the sessions that ended in the window
+	type trendBucket struct {
+		latency, throughput, loss float64
+		count                     int
+	}
+	buckets := make(map[time.Time]*trendBucket)
+	for _, session := range nde.completedSessions(start, end) {
+		hour := session.EndTime.Truncate(time.Hour)
+		bucket, exists := buckets[hour]
+		if !exists {
+			bucket = &trendBucket{}
+			buckets[hour] = bucket
+		}
+		bucket.latency += session.Quality.LatencyMs
+		bucket.throughput += session.Quality.ThroughputMbps
+		bucket.loss += session.Quality.PacketLoss
+		bucket.count++
+	}
+	for hour, bucket := range buckets {
+		count := float64(bucket.count)
+		performance.PerformanceTrends = append(performance.PerformanceTrends, PerformanceTrendPoint{
+			Timestamp:  hour,
+			Latency:    bucket.latency / count,
+			Throughput: bucket.throughput / count,
+			PacketLoss: bucket.loss / count,
+		})
+	}
+	sort.Slice(performance.PerformanceTrends, func(i, j int) bool {
+		return performance.PerformanceTrends[i].Timestamp.Before(performance.PerformanceTrends[j].Timestamp)
+	})
+
+	report.Performance = performance
+	return nil
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// completedSessions returns the sessions that started in the window and
+// have ended, oldest first
+func (nde *NetworkDiagnosticsEngine) completedSessions(start, end time.Time) []ConnectionSession {
+	if nde.connectionTracker == nil {
+		return nil
+	}
+	var sessions []ConnectionSession
+	for _, session := range nde.connectionTracker.GetSessionHistory(start, "", "") {
+		if !session.StartTime.After(end) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].StartTime.Equal(sessions[j].StartTime) {
+			return sessions[i].StartTime.Before(sessions[j].StartTime)
+		}
+		return sessions[i].MacAddress < sessions[j].MacAddress
+	})
+	return sessions
+}
+
+func (nde *NetworkDiagnosticsEngine) generateConnectivityReport(report *NetworkDiagnosticReport) error {
+	start, end := nde.analysisWindow(report)
+	thresholds := nde.config.ConnectivityThresholds
+	hours := end.Sub(start).Hours()
+
+	connectivity := ConnectivityReport{
+		ReconnectionPatterns: []ReconnectionPattern{},
+		ConnectivityIssues:   []ConnectivityIssue{},
+		DeviceReliability:    []DeviceReliabilityInfo{},
+	}
+
+	reconnectWindow := thresholds.MaxReconnectionTime
+	if reconnectWindow <= 0 {
+		reconnectWindow = defaultReconnectionWindow
+	}
+
+	// Sessions per client; active sessions run to the end of the window
+	type clientSessions struct {
+		sessions []ConnectionSession
+		active   int
+	}
+	clients := make(map[string]*clientSessions)
+	clientFor := func(mac string) *clientSessions {
+		client, exists := clients[mac]
+		if !exists {
+			client = &clientSessions{}
+			clients[mac] = client
+		}
+		return client
+	}
+	completed := nde.completedSessions(start, end)
+	for _, session := range completed {
+		client := clientFor(session.MacAddress)
+		client.sessions = append(client.sessions, session)
+	}
+	if nde.connectionTracker != nil {
+		for _, session := range nde.connectionTracker.GetActiveSessions() {
+			if session.StartTime.After(end) {
+				continue
+			}
+			active := *session
+			active.EndTime = time.Time{}
+			client := clientFor(session.MacAddress)
+			client.sessions = append(client.sessions, active)
+			client.active++
+		}
+	}
+
+	macs := make([]string, 0, len(clients))
+	for mac := range clients {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+
+	var attempts, failures, drops int
+	var frequentDisconnects, failingClients []string
+	for _, mac := range macs {
+		client := clients[mac]
+		sort.Slice(client.sessions, func(i, j int) bool {
+			return client.sessions[i].StartTime.Before(client.sessions[j].StartTime)
+		})
+
+		var connected, downtime time.Duration
+		clientFailures, clientDrops := 0, 0
+		for i, session := range client.sessions {
+			sessionEnd := session.EndTime
+			if sessionEnd.IsZero() || sessionEnd.After(end) {
+				sessionEnd = end
+			}
+			sessionStart := session.StartTime
+			if sessionStart.Before(start) {
+				sessionStart = start
+			}
+			if sessionEnd.After(sessionStart) {
+				connected += sessionEnd.Sub(sessionStart)
+			}
+
+			if session.EndTime.IsZero() {
+				continue
+			}
+			if session.Duration < failedSessionDuration {
+				clientFailures++
+			}
+			// Ended and came back soon after: the connection dropped
+			if i+1 < len(client.sessions) {
+				gap := client.sessions[i+1].StartTime.Sub(session.EndTime)
+				if gap >= 0 && gap <= reconnectWindow {
+					clientDrops++
+					downtime += gap
+				}
+			}
+		}
+
+		ended := len(client.sessions) - client.active
+		attempts += len(client.sessions)
+		failures += clientFailures
+		drops += clientDrops
+
+		reliability := DeviceReliabilityInfo{
+			DeviceID:         mac,
+			UptimePercentage: math.Min(connected.Hours()/hours*100, 100),
+			ConnectionScore:  1,
+			Issues:           []string{},
+		}
+		if ended > 0 {
+			reliability.ConnectionScore = 1 - float64(clientDrops)/float64(ended)
+		}
+		if clientDrops > 0 {
+			rate := float64(clientDrops) / hours
+			pattern := "occasional"
+			if thresholds.MaxDisconnectionRate > 0 && rate > thresholds.MaxDisconnectionRate {
+				pattern = "frequent"
+				frequentDisconnects = append(frequentDisconnects, mac)
+				reliability.Issues = append(reliability.Issues, fmt.Sprintf("drops %.1f times per hour", rate))
+			}
+			connectivity.ReconnectionPatterns = append(connectivity.ReconnectionPatterns, ReconnectionPattern{
+				DeviceID:        mac,
+				Frequency:       rate,
+				AverageDowntime: downtime / time.Duration(clientDrops),
+				Pattern:         pattern,
+			})
+		}
+		if clientFailures > 0 {
+			failingClients = append(failingClients, mac)
+			reliability.Issues = append(reliability.Issues, fmt.Sprintf("failed connection attempts: %d", clientFailures))
+		}
+		connectivity.DeviceReliability = append(connectivity.DeviceReliability, reliability)
+	}
+
+	if attempts > 0 {
+		connectivity.ConnectionSuccess = float64(attempts-failures) / float64(attempts)
+		connectivity.SessionStability = 1
+		if len(completed) > 0 {
+			connectivity.SessionStability = 1 - float64(drops)/float64(len(completed))
+		}
+	}
+
+	sort.SliceStable(connectivity.ReconnectionPatterns, func(i, j int) bool {
+		return connectivity.ReconnectionPatterns[i].Frequency > connectivity.ReconnectionPatterns[j].Frequency
+	})
+	sort.SliceStable(connectivity.DeviceReliability, func(i, j int) bool {
+		return connectivity.DeviceReliability[i].UptimePercentage < connectivity.DeviceReliability[j].UptimePercentage
+	})
+
+	topology := nde.diagnosticTopology()
+	var offline []string
+	for _, id := range topology.deviceIDs() {
+		if !topology.topology.Devices[id].Online {
+			offline = append(offline, id)
+		}
+	}
+	if len(offline) > 0 {
+		connectivity.ConnectivityIssues = append(connectivity.ConnectivityIssues, ConnectivityIssue{
+			Type:        "offline_devices",
+			Description: fmt.Sprintf("devices offline: %d", len(offline)),
+			Devices:     offline,
+			Impact:      "Devices and the clients behind them are unreachable",
+		})
+	}
+	if len(frequentDisconnects) > 0 {
+		connectivity.ConnectivityIssues = append(connectivity.ConnectivityIssues, ConnectivityIssue{
+			Type: "frequent_disconnects",
+			Description: fmt.Sprintf("clients dropping more than %.1f times per hour: %d",
+				thresholds.MaxDisconnectionRate, len(frequentDisconnects)),
+			Devices: frequentDisconnects,
+			Impact:  "Users see interrupted sessions",
+		})
+	}
+	if len(failingClients) > 0 {
+		connectivity.ConnectivityIssues = append(connectivity.ConnectivityIssues, ConnectivityIssue{
+			Type: "failed_connections",
+			Description: fmt.Sprintf("%d of %d connection attempts lasted under %s",
+				failures, attempts, failedSessionDuration),
+			Devices: failingClients,
+			Impact:  "Clients fail to stay connected",
+		})
+	}
+
+	report.Connectivity = connectivity
+	return nil
+}
+
+// wifiSecurityLevel classifies the security of an SSID as open, weak or
+// secure
+func wifiSecurityLevel(security string) string {
+	security = strings.ToLower(strings.TrimSpace(security))
+	switch {
+	case security == "" || security == "open" || security == "none":
+		return "open"
+	case strings.Contains(security, "wep"), strings.Contains(security, "tkip"),
+		security == "wpa", strings.HasPrefix(security, "wpa-"), strings.HasPrefix(security, "wpa1"):
+		return "weak"
+	default:
+		return "secure"
+	}
+}
+
+func (nde *NetworkDiagnosticsEngine) generateSecurityReport(report *NetworkDiagnosticReport) error {
+	start, end := nde.analysisWindow(report)
+	topology := nde.diagnosticTopology()
+
+	security := SecurityReport{
+		OpenNetworks:        []OpenNetworkInfo{},
+		WeakSecurityDevices: []WeakSecurityDevice{},
+		UnauthorizedDevices: []UnauthorizedDevice{},
+		SecurityEvents:      []SecurityEvent{},
+		ComplianceStatus: ComplianceStatus{
+			Standards: make(map[string]ComplianceInfo),
+		},
+	}
+
+	var networks, secureNetworks, clients, knownClients int
+	var encryptionIssues []string
+	for _, id := range topology.deviceIDs() {
+		device := topology.topology.Devices[id]
+
+		names := make([]string, 0, len(device.Interfaces))
+		for name := range device.Interfaces {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			iface := device.Interfaces[name]
+			if !strings.EqualFold(iface.WiFiMode, "ap") || iface.SSID == "" {
+				continue
+			}
+			networks++
+			switch wifiSecurityLevel(iface.Security) {
+			case "open":
+				security.OpenNetworks = append(security.OpenNetworks, OpenNetworkInfo{
+					SSID:     iface.SSID,
+					Location: topology.location(id),
+					Risk:     "high",
+				})
+				encryptionIssues = append(encryptionIssues, fmt.Sprintf("%s on %s is open", iface.SSID, id))
+			case "weak":
+				security.WeakSecurityDevices = append(security.WeakSecurityDevices, WeakSecurityDevice{
+					DeviceID:       id,
+					Issue:          fmt.Sprintf("%s uses %s", iface.SSID, iface.Security),
+					Recommendation: "Switch the SSID to WPA2-AES or WPA3",
+				})
+				encryptionIssues = append(encryptionIssues, fmt.Sprintf("%s on %s uses %s", iface.SSID, id, iface.Security))
+			default:
+				secureNetworks++
+			}
+		}
+
+		// Clients without a registered identity have not been approved
+		if nde.identityStorage == nil || (device.Role != types.RoleClient && device.DeviceType != "client") {
+			continue
+		}
+		clients++
+		mac := device.PrimaryMAC
+		if mac == "" {
+			mac = id
+		}
+		if LookupDeviceIdentity(nde.identityStorage, mac) != nil {
+			knownClients++
+			continue
+		}
+		unknown := UnauthorizedDevice{
+			DeviceID:    id,
+			MacAddress:  mac,
+			ThreatLevel: "low",
+		}
+		if device.Online {
+			unknown.ThreatLevel = "medium"
+		}
+		if nde.connectionTracker != nil {
+			if history, exists := nde.connectionTracker.GetClientHistory(mac); exists {
+				unknown.FirstSeen = history.FirstSeen
+			}
+		}
+		security.UnauthorizedDevices = append(security.UnauthorizedDevices, unknown)
+	}
+
+	if nde.alertingSystem != nil {
+		for _, alert := range nde.alertingSystem.GetActiveAlerts() {
+			if alert.Category != AlertCategory("security") || alert.CreatedAt.Before(start) || alert.CreatedAt.After(end) {
+				continue
+			}
+			security.SecurityEvents = append(security.SecurityEvents, SecurityEvent{
+				ID:          alert.ID,
+				Type:        string(alert.Type),
+				Timestamp:   alert.CreatedAt,
+				Description: alert.Title,
+				Severity:    string(alert.Severity),
+			})
+		}
+		sort.Slice(security.SecurityEvents, func(i, j int) bool {
+			return security.SecurityEvents[i].Timestamp.Before(security.SecurityEvents[j].Timestamp)
+		})
+	}
+
+	if networks > 0 {
+		security.ComplianceStatus.Standards["wifi_encryption"] = complianceInfo(secureNetworks, networks, encryptionIssues)
+	}
+	if clients > 0 {
+		var issues []string
+		for _, device := range security.UnauthorizedDevices {
+			issues = append(issues, fmt.Sprintf("%s has no registered identity", device.MacAddress))
+		}
+		security.ComplianceStatus.Standards["device_inventory"] = complianceInfo(knownClients, clients, issues)
+	}
+	security.ComplianceStatus.OverallCompliance = 1
+	if len(security.ComplianceStatus.Standards) > 0 {
+		total := 0.0
+		for _, info := range security.ComplianceStatus.Standards {
+			total += info.Compliance
+		}
+		security.ComplianceStatus.OverallCompliance = total / float64(len(security.ComplianceStatus.Standards))
+	}
+
+	score := 100.0
+	score -= 30 * float64(len(security.OpenNetworks))
+	score -= 15 * float64(len(security.WeakSecurityDevices))
+	score -= 5 * float64(len(security.UnauthorizedDevices))
+	for _, event := range security.SecurityEvents {
+		switch AlertSeverity(event.Severity) {
+		case SeverityCritical, SeverityError:
+			score -= 10
+		default:
+			score -= 5
+		}
+	}
+	security.SecurityScore = math.Max(score, 0)
+
+	report.Security = security
+	return nil
+}
+
+func complianceInfo(passed, total int, issues []string) ComplianceInfo {
+	info := ComplianceInfo{
+		Compliance: float64(passed) / float64(total),
+		Issues:     issues,
+	}
+	if info.Issues == nil {
+		info.Issues = []string{}
+	}
+	switch {
+	case passed == total:
+		info.Status = "compliant"
+	case passed > 0:
+		info.Status = "partial"
+	default:
+		info.Status = "non_compliant"
+	}
+	return info
+}
+
+func (nde *NetworkDiagnosticsEngine) generateRoamingAnalysis(report *NetworkDiagnosticReport) error {
+	start, end := nde.analysisWindow(report)
+	hours := end.Sub(start).Hours()
+
+	roaming := RoamingAnalysisReport{
+		RoamingPatterns:     []RoamingPattern{},
+		ProblematicRoaming:  []ProblematicRoamingDevice{},
+		RoamingOptimization: []RoamingOptimization{},
+	}
+
+	pingPongWindow := time.Duration(defaultPingPongWindow)
+	excessiveRate := float64(defaultExcessiveRoamsPerHour)
+	var events []RoamingAnalysisEvent
+	anomalies := make(map[string][]string)
+	if nde.roamingDetector != nil {
+		if nde.roamingDetector.config.PingPongTimeThreshold > 0 {
+			pingPongWindow = nde.roamingDetector.config.PingPongTimeThreshold
+		}
+		if nde.roamingDetector.config.ExcessiveRoamingThreshold > 0 {
+			excessiveRate = float64(nde.roamingDetector.config.ExcessiveRoamingThreshold)
+		}
+		for _, event := range nde.roamingDetector.GetRoamingEvents(start, "") {
+			if !event.Timestamp.After(end) {
+				events = append(events, event)
+			}
+		}
+		for _, anomaly := range nde.roamingDetector.GetAnomalies(false) {
+			anomalies[anomaly.MacAddress] = append(anomalies[anomaly.MacAddress], anomaly.Description)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+
+	byClient := make(map[string][]RoamingAnalysisEvent)
+	successful, weakSignalRoams := 0, 0
+	for _, event := range events {
+		byClient[event.MacAddress] = append(byClient[event.MacAddress], event)
+		if event.Quality != QualityPoor {
+			successful++
+		}
+		if event.Trigger == TriggerWeakSignal {
+			weakSignalRoams++
+		}
+	}
+	if len(events) > 0 {
+		roaming.RoamingFrequency = float64(len(events)) / hours
+		roaming.RoamingSuccess = float64(successful) / float64(len(events))
+	}
+
+	macs := make([]string, 0, len(byClient))
+	for mac := range byClient {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+
+	pingPongClients := 0
+	for _, mac := range macs {
+		clientEvents := byClient[mac]
+		pingPongs, poor := 0, 0
+		for i, event := range clientEvents {
+			if event.Quality == QualityPoor {
+				poor++
+			}
+			if i > 0 {
+				previous := clientEvents[i-1]
+				if event.ToAP == previous.FromAP && event.Timestamp.Sub(previous.Timestamp) <= pingPongWindow {
+					pingPongs++
+				}
+			}
+		}
+		rate := float64(len(clientEvents)) / hours
+
+		pattern := RoamingPattern{
+			DeviceID:    mac,
+			Pattern:     "normal",
+			Frequency:   rate,
+			SuccessRate: float64(len(clientEvents)-poor) / float64(len(clientEvents)),
+		}
+		var issues, suggestions []string
+		if pingPongs > 0 {
+			pattern.Pattern = "ping_pong"
+			pingPongClients++
+			issues = append(issues, fmt.Sprintf("bounced back to the previous AP %d times", pingPongs))
+			suggestions = append(suggestions, "Increase the RSSI difference required before roaming")
+		}
+		if rate > excessiveRate {
+			if pattern.Pattern == "normal" {
+				pattern.Pattern = "excessive"
+			}
+			issues = append(issues, fmt.Sprintf("roams %.1f times per hour", rate))
+			suggestions = append(suggestions, "Reduce overlap between neighbouring access points")
+		}
+		if poor > 0 {
+			issues = append(issues, fmt.Sprintf("%d of %d roams had poor quality", poor, len(clientEvents)))
+			suggestions = append(suggestions, "Enable 802.11r fast transition")
+		}
+		issues = append(issues, anomalies[mac]...)
+		roaming.RoamingPatterns = append(roaming.RoamingPatterns, pattern)
+
+		if len(issues) > 0 {
+			impact := "Brief interruptions while roaming"
+			if pingPongs > 0 || rate > excessiveRate {
+				impact = "Repeated interruptions from unnecessary roaming"
+			}
+			if suggestions == nil {
+				suggestions = []string{"Review the client's roaming anomalies"}
+			}
+			roaming.ProblematicRoaming = append(roaming.ProblematicRoaming, ProblematicRoamingDevice{
+				DeviceID:    mac,
+				Issues:      issues,
+				Impact:      impact,
+				Suggestions: suggestions,
+			})
+		}
+	}
+
+	if pingPongClients > 0 {
+		roaming.RoamingOptimization = append(roaming.RoamingOptimization, RoamingOptimization{
+			Type:           "roaming_hysteresis",
+			Description:    fmt.Sprintf("clients bouncing between access points: %d", pingPongClients),
+			ExpectedGain:   "Fewer unnecessary roams",
+			Implementation: "Raise the roaming RSSI hysteresis and enable 802.11k/v neighbour reports",
+		})
+	}
+	if len(events) > 0 && weakSignalRoams*2 > len(events) {
+		roaming.RoamingOptimization = append(roaming.RoamingOptimization, RoamingOptimization{
+			Type:           "coverage",
+			Description:    fmt.Sprintf("%d of %d roams happened on a weak signal", weakSignalRoams, len(events)),
+			ExpectedGain:   "Earlier, smoother handovers",
+			Implementation: "Review access point placement and transmit power",
+		})
+	}
+	if nde.wifiCollector != nil {
+		topology := nde.diagnosticTopology()
+		for _, id := range topology.deviceIDs() {
+			ap, exists := nde.wifiCollector.GetAccessPointState(id)
+			if !exists || ap.MaxClients <= 0 {
+				continue
+			}
+			if connected := len(ap.ConnectedClients); connected*5 >= ap.MaxClients*4 {
+				roaming.RoamingOptimization = append(roaming.RoamingOptimization, RoamingOptimization{
+					Type:           "load_balancing",
+					Description:    fmt.Sprintf("%s serves %d of at most %d clients", id, connected, ap.MaxClients),
+					ExpectedGain:   "Less contention on the busiest access point",
+					Implementation: "Enable band steering and client load balancing",
+				})
+			}
+		}
+	}
+
+	report.RoamingAnalysis = roaming
+	return nil
+}
@@ -0,0 +1,244 @@
+package topology
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files from the current output")
+
+// qualityFixture is a recorded snapshot of the connection quality monitor
+type qualityFixture struct {
+	Connections []struct {
+		DeviceID           string  `json:"device_id"`
+		MacAddress         string  `json:"mac_address"`
+		RSSI               int     `json:"rssi"`
+		LatencyMs          float64 `json:"latency_ms"`
+		ThroughputMbps     float64 `json:"throughput_mbps"`
+		PeakThroughputMbps float64 `json:"peak_throughput_mbps"`
+		PacketLoss         float64 `json:"packet_loss"`
+		JitterMs           float64 `json:"jitter_ms"`
+		Quality            float64 `json:"quality"`
+		History            []struct {
+			Timestamp time.Time `json:"timestamp"`
+			Quality   float64   `json:"quality"`
+		} `json:"history"`
+	} `json:"connections"`
+}
+
+// activityFixture records client sessions, roaming and AP load
+type activityFixture struct {
+	Sessions []struct {
+		MacAddress     string    `json:"mac_address"`
+		DeviceID       string    `json:"device_id"`
+		SSID           string    `json:"ssid"`
+		StartTime      time.Time `json:"start_time"`
+		EndTime        time.Time `json:"end_time"` // zero while active
+		ThroughputMbps float64   `json:"throughput_mbps"`
+		LatencyMs      float64   `json:"latency_ms"`
+		PacketLoss     float64   `json:"packet_loss"`
+	} `json:"sessions"`
+	Roaming []struct {
+		MacAddress string         `json:"mac_address"`
+		FromAP     string         `json:"from_ap"`
+		ToAP       string         `json:"to_ap"`
+		Timestamp  time.Time      `json:"timestamp"`
+		Trigger    RoamingTrigger `json:"trigger"`
+		Quality    EventQuality   `json:"quality"`
+	} `json:"roaming"`
+	Anomalies []struct {
+		MacAddress  string `json:"mac_address"`
+		Description string `json:"description"`
+	} `json:"anomalies"`
+	AccessPoints []struct {
+		DeviceID   string `json:"device_id"`
+		MaxClients int    `json:"max_clients"`
+		Clients    int    `json:"clients"`
+	} `json:"access_points"`
+	Identities []string `json:"identities"`
+}
+
+// diagnosticsGolden is the part of a report computed from the fixtures
+type diagnosticsGolden struct {
+	OverallHealth   NetworkHealthStatus   `json:"overall_health"`
+	HealthScore     float64               `json:"health_score"`
+	QualityAnalysis QualityAnalysisReport `json:"quality_analysis"`
+	Performance     PerformanceReport     `json:"performance"`
+	Connectivity    ConnectivityReport    `json:"connectivity"`
+	Security        SecurityReport        `json:"security"`
+	RoamingAnalysis RoamingAnalysisReport `json:"roaming_analysis"`
+}
+
+func readFixture(t *testing.T, path string, v interface{}) {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, v))
+}
+
+// newFixtureDiagnosticsEngine loads a scenario's recorded topology and
+// collector state into a diagnostics engine
+func newFixtureDiagnosticsEngine(t *testing.T, dir string) *NetworkDiagnosticsEngine {
+	var topology types.NetworkTopology
+	readFixture(t, filepath.Join(dir, "topology.json"), &topology)
+	var quality qualityFixture
+	readFixture(t, filepath.Join(dir, "quality.json"), &quality)
+	var activity activityFixture
+	readFixture(t, filepath.Join(dir, "activity.json"), &activity)
+
+	store, err := storage.NewBuntDB(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	identityStorage := storage.NewIdentityStorage(store)
+	for _, mac := range activity.Identities {
+		require.NoError(t, identityStorage.SaveDeviceIdentity(&types.DeviceIdentity{MacAddress: mac}))
+	}
+
+	manager := &Manager{topology: &topology}
+	wifiCollector := NewWiFiClientCollector(nil, nil, WiFiCollectorConfig{})
+	tracker := NewConnectionHistoryTracker(nil, nil, ConnectionHistoryConfig{})
+	monitor := NewConnectionQualityMonitor(manager, tracker, wifiCollector, nil, nil, nil, QualityMonitorConfig{})
+	detector := NewRoamingDetector(wifiCollector, nil, nil, RoamingDetectorConfig{
+		PingPongTimeThreshold:     2 * time.Minute,
+		ExcessiveRoamingThreshold: 4,
+	})
+
+	for _, c := range quality.Connections {
+		key := c.DeviceID + "-" + c.MacAddress
+		monitor.connectionMetrics[key] = &ConnectionMetrics{
+			DeviceID:         c.DeviceID,
+			MacAddress:       c.MacAddress,
+			SignalStrength:   SignalMetrics{CurrentRSSI: c.RSSI},
+			Latency:          LatencyMetrics{CurrentLatencyMs: c.LatencyMs},
+			Throughput:       ThroughputMetrics{CurrentThroughputMbps: c.ThroughputMbps, PeakThroughputMbps: c.PeakThroughputMbps},
+			PacketLoss:       PacketLossMetrics{CurrentLossRate: c.PacketLoss},
+			Jitter:           JitterMetrics{CurrentJitterMs: c.JitterMs},
+			OverallQuality:   QualityScore{Overall: c.Quality},
+			MonitoringActive: true,
+		}
+		for _, point := range c.History {
+			monitor.qualityHistory[key] = append(monitor.qualityHistory[key],
+				QualitySnapshot{Timestamp: point.Timestamp, OverallQuality: point.Quality})
+		}
+	}
+
+	for _, s := range activity.Sessions {
+		session := ConnectionSession{
+			MacAddress: s.MacAddress,
+			DeviceID:   s.DeviceID,
+			SSID:       s.SSID,
+			StartTime:  s.StartTime,
+			EndTime:    s.EndTime,
+			Quality: SessionQuality{
+				ThroughputMbps: s.ThroughputMbps,
+				LatencyMs:      s.LatencyMs,
+				PacketLoss:     s.PacketLoss,
+			},
+		}
+		history, exists := tracker.connections[s.MacAddress]
+		if !exists {
+			history = &ClientConnectionHistory{MacAddress: s.MacAddress, FirstSeen: s.StartTime}
+			tracker.connections[s.MacAddress] = history
+		}
+		if s.EndTime.IsZero() {
+			tracker.sessions[s.MacAddress+"-"+s.DeviceID] = &session
+			continue
+		}
+		session.Duration = s.EndTime.Sub(s.StartTime)
+		history.Sessions = append(history.Sessions, session)
+	}
+
+	for _, r := range activity.Roaming {
+		detector.roamingEvents = append(detector.roamingEvents, RoamingAnalysisEvent{
+			MacAddress: r.MacAddress,
+			FromAP:     r.FromAP,
+			ToAP:       r.ToAP,
+			Timestamp:  r.Timestamp,
+			Trigger:    r.Trigger,
+			Quality:    r.Quality,
+		})
+	}
+	for _, a := range activity.Anomalies {
+		detector.anomalies = append(detector.anomalies, RoamingAnomaly{MacAddress: a.MacAddress, Description: a.Description})
+	}
+
+	for _, ap := range activity.AccessPoints {
+		state := &AccessPointState{
+			DeviceID:         ap.DeviceID,
+			MaxClients:       ap.MaxClients,
+			ConnectedClients: make(map[string]*WiFiClientInfo),
+		}
+		for i := 0; i < ap.Clients; i++ {
+			mac := fmt.Sprintf("02:00:00:00:00:%02x", i)
+			state.ConnectedClients[mac] = &WiFiClientInfo{MacAddress: mac}
+		}
+		wifiCollector.accessPoints[ap.DeviceID] = state
+	}
+
+	return NewNetworkDiagnosticsEngine(manager, monitor, detector, nil, tracker, wifiCollector,
+		nil, identityStorage, DefaultDiagnosticConfig())
+}
+
+func TestNetworkDiagnosticsEngine_GenerateReportGolden(t *testing.T) {
+	window := DiagnosticTimeWindow{
+		StartTime: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC),
+		Duration:  6 * time.Hour,
+	}
+
+	for _, scenario := range []string{"healthy", "degraded"} {
+		t.Run(scenario, func(t *testing.T) {
+			dir := filepath.Join("testdata", "diagnostics", scenario)
+			engine := newFixtureDiagnosticsEngine(t, dir)
+
+			report, err := engine.GenerateReport(ReportTypeOnDemand, window, DetailLevelDetailed)
+			require.NoError(t, err)
+
+			got, err := json.MarshalIndent(diagnosticsGolden{
+				OverallHealth:   report.OverallHealth,
+				HealthScore:     report.HealthScore,
+				QualityAnalysis: report.QualityAnalysis,
+				Performance:     report.Performance,
+				Connectivity:    report.Connectivity,
+				Security:        report.Security,
+				RoamingAnalysis: report.RoamingAnalysis,
+			}, "", "  ")
+			require.NoError(t, err)
+			got = append(got, '\n')
+
+			golden := filepath.Join(dir, "report.golden.json")
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(golden, got, 0644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(want), string(got))
+		})
+	}
+}
+
+func TestNetworkDiagnosticsEngine_EmptyCollectors(t *testing.T) {
+	engine := NewNetworkDiagnosticsEngine(&Manager{topology: &types.NetworkTopology{}},
+		nil, nil, nil, nil, nil, nil, nil, DefaultDiagnosticConfig())
+
+	report, err := engine.GenerateReport(ReportTypeOnDemand, DiagnosticTimeWindow{}, DetailLevelSummary)
+	require.NoError(t, err)
+
+	// Nothing to analyze is neither healthy nor broken: only security scores
+	assert.Zero(t, report.QualityAnalysis.AverageQuality)
+	assert.Empty(t, report.Performance.Bottlenecks)
+	assert.Empty(t, report.Connectivity.DeviceReliability)
+	assert.Equal(t, 100.0, report.Security.SecurityScore)
+	assert.Equal(t, 100.0, report.HealthScore)
+	assert.Equal(t, HealthStatusExcellent, report.OverallHealth)
+}
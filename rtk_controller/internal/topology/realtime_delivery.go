@@ -0,0 +1,662 @@
+package topology
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Webhook request headers
+const (
+	WebhookEventHeader     = "X-RTK-Event"
+	WebhookDeliveryHeader  = "X-RTK-Delivery"
+	WebhookTimestampHeader = "X-RTK-Timestamp"
+
+	// WebhookSignatureHeader carries "sha256=<hex>", the HMAC-SHA256 of
+	// "<timestamp>.<body>" keyed with RealtimeUpdaterConfig.WebhookSecret
+	WebhookSignatureHeader = "X-RTK-Signature"
+)
+
+// TopologyEventsTopic is the MQTT topic topology events are published to
+const TopologyEventsTopic = "rtk/v1/%s/%s/_controller/topology/events"
+
+// EventPublisher publishes MQTT messages; mqtt.Client implements it
+type EventPublisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+}
+
+// TopologyEventMessage is the JSON form of a topology update event as
+// delivered to subscribers
+type TopologyEventMessage struct {
+	SubscriptionID string                 `json:"subscription_id"`
+	ID             string                 `json:"id"`
+	Type           UpdateEventType        `json:"type"`
+	Timestamp      int64                  `json:"ts"`
+	Tenant         string                 `json:"tenant"`
+	Site           string                 `json:"site"`
+	Source         string                 `json:"source,omitempty"`
+	DeviceID       string                 `json:"device_id,omitempty"`
+	Priority       UpdatePriority         `json:"priority,omitempty"`
+	Changes        []ChangeMessage        `json:"changes,omitempty"`
+	Context        *ContextMessage        `json:"context,omitempty"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ChangeMessage is the JSON form of a ChangeDetail
+type ChangeMessage struct {
+	ChangeType  ChangeType   `json:"change_type"`
+	Field       string       `json:"field,omitempty"`
+	OldValue    interface{}  `json:"old_value,omitempty"`
+	NewValue    interface{}  `json:"new_value,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Impact      ChangeImpact `json:"impact,omitempty"`
+}
+
+// ContextMessage is the JSON form of an UpdateContext
+type ContextMessage struct {
+	TriggerReason    string      `json:"trigger_reason,omitempty"`
+	RelatedEvents    []string    `json:"related_events,omitempty"`
+	AffectedDevices  []string    `json:"affected_devices,omitempty"`
+	NetworkCondition string      `json:"network_condition,omitempty"`
+	UserImpact       ImpactLevel `json:"user_impact,omitempty"`
+}
+
+// PendingDelivery is a failed webhook delivery waiting for retryProcessor
+type PendingDelivery struct {
+	SubscriptionID string
+	Event          TopologyUpdateEvent
+	Attempts       int
+	LastAttempt    time.Time
+	LastError      string
+}
+
+// streamClient is an SSE or WebSocket connection attached to a subscription
+type streamClient struct {
+	events chan []byte
+	done   chan struct{}
+}
+
+// SetEventPublisher sets the MQTT publisher used by DeliveryMQTT
+// subscriptions
+func (rtu *RealtimeTopologyUpdater) SetEventPublisher(publisher EventPublisher) {
+	rtu.mu.Lock()
+	defer rtu.mu.Unlock()
+	rtu.publisher = publisher
+}
+
+// scope returns the tenant and site of the topology the updater serves
+func (rtu *RealtimeTopologyUpdater) scope() (tenant, site string) {
+	return topologyScope(rtu.topologyManager)
+}
+
+// topologyScope returns the tenant and site of a topology manager, using
+// "default" for whatever is not set
+func topologyScope(manager *Manager) (tenant, site string) {
+	tenant, site = "default", "default"
+	if manager != nil {
+		if manager.config.Tenant != "" {
+			tenant = manager.config.Tenant
+		}
+		if manager.config.Site != "" {
+			site = manager.config.Site
+		}
+	}
+	return tenant, site
+}
+
+// encodeEvent builds the message delivered to a subscription. Changes,
+// context and metadata are only included when the filter asks for details.
+func (rtu *RealtimeTopologyUpdater) encodeEvent(subscription *Subscription, event TopologyUpdateEvent) ([]byte, error) {
+	tenant, site := rtu.scope()
+	message := TopologyEventMessage{
+		SubscriptionID: subscription.ID,
+		ID:             event.ID,
+		Type:           event.Type,
+		Timestamp:      event.Timestamp.UnixMilli(),
+		Tenant:         tenant,
+		Site:           site,
+		Source:         event.Source,
+		DeviceID:       event.DeviceID,
+		Priority:       event.Priority,
+	}
+
+	if subscription.Filter.IncludeDetails {
+		for _, change := range event.Changes {
+			message.Changes = append(message.Changes, ChangeMessage{
+				ChangeType:  change.ChangeType,
+				Field:       change.Field,
+				OldValue:    change.OldValue,
+				NewValue:    change.NewValue,
+				Description: change.Description,
+				Impact:      change.Impact,
+			})
+		}
+		message.Context = &ContextMessage{
+			TriggerReason:    event.Context.TriggerReason,
+			RelatedEvents:    event.Context.RelatedEvents,
+			AffectedDevices:  event.Context.AffectedDevices,
+			NetworkCondition: event.Context.NetworkCondition,
+			UserImpact:       event.Context.UserImpact,
+		}
+		message.Metadata = event.Metadata
+	}
+
+	return json.Marshal(&message)
+}
+
+func (rtu *RealtimeTopologyUpdater) deliverWebSocket(subscription *Subscription, event TopologyUpdateEvent) error {
+	return rtu.deliverStream(subscription, event)
+}
+
+func (rtu *RealtimeTopologyUpdater) deliverSSE(subscription *Subscription, event TopologyUpdateEvent) error {
+	return rtu.deliverStream(subscription, event)
+}
+
+// deliverStream queues an event for the SSE or WebSocket client attached to
+// a subscription. Slow clients lose events rather than block delivery.
+func (rtu *RealtimeTopologyUpdater) deliverStream(subscription *Subscription, event TopologyUpdateEvent) error {
+	payload, err := rtu.encodeEvent(subscription, event)
+	if err != nil {
+		return err
+	}
+
+	rtu.streamsMu.RLock()
+	client, exists := rtu.streams[subscription.ID]
+	rtu.streamsMu.RUnlock()
+	if !exists {
+		return fmt.Errorf("no %s client connected", subscription.DeliveryMethod)
+	}
+
+	select {
+	case client.events <- payload:
+		return nil
+	case <-client.done:
+		return fmt.Errorf("%s client disconnected", subscription.DeliveryMethod)
+	default:
+		return fmt.Errorf("%s client is too slow, event %s dropped", subscription.DeliveryMethod, event.ID)
+	}
+}
+
+func (rtu *RealtimeTopologyUpdater) deliverMQTT(subscription *Subscription, event TopologyUpdateEvent) error {
+	rtu.mu.RLock()
+	publisher := rtu.publisher
+	rtu.mu.RUnlock()
+	if publisher == nil {
+		return fmt.Errorf("no MQTT publisher configured")
+	}
+
+	payload, err := rtu.encodeEvent(subscription, event)
+	if err != nil {
+		return err
+	}
+
+	tenant, site := rtu.scope()
+	return publisher.Publish(fmt.Sprintf(TopologyEventsTopic, tenant, site), 1, false, payload)
+}
+
+// deliverWebhook POSTs an event to the subscription endpoint. Failed
+// deliveries are queued for retryProcessor.
+func (rtu *RealtimeTopologyUpdater) deliverWebhook(subscription *Subscription, event TopologyUpdateEvent) error {
+	err := rtu.postWebhook(subscription, event)
+	if err != nil {
+		rtu.queueDeliveryRetry(subscription.ID, event, err)
+	}
+	return err
+}
+
+func (rtu *RealtimeTopologyUpdater) postWebhook(subscription *Subscription, event TopologyUpdateEvent) error {
+	body, err := rtu.encodeEvent(subscription, event)
+	if err != nil {
+		return err
+	}
+
+	timeout := rtu.config.WebhookTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook endpoint: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(event.Type))
+	req.Header.Set(WebhookDeliveryHeader, event.ID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	if rtu.config.WebhookSecret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(rtu.config.WebhookSecret, timestamp, body))
+	}
+
+	resp, err := rtu.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignWebhook returns the X-RTK-Signature value for a webhook body
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks an X-RTK-Signature value; receivers should also
+// reject stale timestamps
+func VerifyWebhook(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, timestamp, body)), []byte(signature))
+}
+
+func (rtu *RealtimeTopologyUpdater) queueDeliveryRetry(subscriptionID string, event TopologyUpdateEvent, err error) {
+	rtu.mu.Lock()
+	defer rtu.mu.Unlock()
+
+	key := subscriptionID + "/" + event.ID
+	pending, exists := rtu.pendingDeliveries[key]
+	if !exists {
+		pending = &PendingDelivery{SubscriptionID: subscriptionID, Event: event}
+		rtu.pendingDeliveries[key] = pending
+	}
+	pending.Attempts++
+	pending.LastAttempt = time.Now()
+	pending.LastError = err.Error()
+}
+
+// retryFailedDeliveries re-sends failed webhook deliveries with a linear
+// backoff until MaxRetries is reached
+func (rtu *RealtimeTopologyUpdater) retryFailedDeliveries() {
+	now := time.Now()
+	var due []*PendingDelivery
+
+	rtu.mu.Lock()
+	for key, pending := range rtu.pendingDeliveries {
+		if pending.Attempts > rtu.config.MaxRetries {
+			log.Printf("Giving up webhook delivery of %s to subscription %s after %d attempts: %s",
+				pending.Event.ID, pending.SubscriptionID, pending.Attempts, pending.LastError)
+			delete(rtu.pendingDeliveries, key)
+			continue
+		}
+		backoff := time.Duration(rtu.config.RetryBackoffMs*pending.Attempts) * time.Millisecond
+		if now.Sub(pending.LastAttempt) >= backoff {
+			delete(rtu.pendingDeliveries, key)
+			copied := *pending
+			due = append(due, &copied)
+		}
+	}
+	rtu.mu.Unlock()
+
+	for _, pending := range due {
+		rtu.subscriptionsMu.RLock()
+		subscription, exists := rtu.subscriptions[pending.SubscriptionID]
+		rtu.subscriptionsMu.RUnlock()
+		if !exists {
+			continue
+		}
+
+		err := rtu.postWebhook(subscription, pending.Event)
+		rtu.recordDelivery(subscription, err)
+		if err == nil {
+			continue
+		}
+
+		rtu.mu.Lock()
+		pending.Attempts++
+		pending.LastAttempt = time.Now()
+		pending.LastError = err.Error()
+		rtu.pendingDeliveries[pending.SubscriptionID+"/"+pending.Event.ID] = pending
+		rtu.mu.Unlock()
+	}
+}
+
+// GetPendingDeliveries returns the number of webhook deliveries waiting
+// for a retry
+func (rtu *RealtimeTopologyUpdater) GetPendingDeliveries() int {
+	rtu.mu.RLock()
+	defer rtu.mu.RUnlock()
+	return len(rtu.pendingDeliveries)
+}
+
+// StreamHandler returns the HTTP handler of the SSE and WebSocket
+// endpoints:
+//
+//	GET /topology/events  Server-Sent Events
+//	GET /topology/ws      WebSocket
+//
+// A client either attaches to an existing subscription with
+// ?subscription=<id>, or gets a subscription for the connection built from
+// the query filter: event_types, device_types and device_ids (comma
+// separated), min_priority, include_details and throttle (a duration).
+//
+// With a StreamToken, clients authenticate with "Authorization: Bearer
+// <token>" or, as browsers cannot set headers on EventSource and WebSocket,
+// ?token=<token>. Browser requests are only accepted from the endpoint's
+// own origin and AllowedOrigins.
+func (rtu *RealtimeTopologyUpdater) StreamHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/topology/events", rtu.serveSSE)
+	mux.HandleFunc("/topology/ws", rtu.serveWebSocket)
+	return mux
+}
+
+// authorizeStream checks the token and origin of a stream request and
+// replies with an error if they are not accepted
+func (rtu *RealtimeTopologyUpdater) authorizeStream(w http.ResponseWriter, r *http.Request) bool {
+	if token := rtu.config.StreamToken; token != "" {
+		presented := r.URL.Query().Get("token")
+		if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+			presented = bearer
+		}
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="topology"`)
+			http.Error(w, "invalid or missing stream token", http.StatusUnauthorized)
+			return false
+		}
+	}
+
+	if !rtu.checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checkOrigin accepts requests without an Origin header (non-browser
+// clients), from the endpoint's own host and from AllowedOrigins
+func (rtu *RealtimeTopologyUpdater) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range rtu.config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func (rtu *RealtimeTopologyUpdater) serveSSE(w http.ResponseWriter, r *http.Request) {
+	if !rtu.authorizeStream(w, r) {
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Vary", "Origin")
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	subscription, client, release, err := rtu.attachStream(r, DeliverySSE)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer release()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprintf(w, "event: subscribed\ndata: {\"subscription_id\":%q}\n\n", subscription.ID)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(rtu.streamKeepalive())
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.done:
+			return
+		case payload := <-client.events:
+			if _, err := fmt.Fprintf(w, "event: topology\ndata: %s\n\n", payload); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (rtu *RealtimeTopologyUpdater) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !rtu.authorizeStream(w, r) {
+		return
+	}
+
+	subscription, client, release, err := rtu.attachStream(r, DeliveryWebSocket)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer release()
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 4096,
+		CheckOrigin:     rtu.checkOrigin,
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an HTTP error
+		return
+	}
+	defer conn.Close()
+
+	// Read only to notice the client going away; clients do not send data
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	hello, _ := json.Marshal(map[string]string{"event": "subscribed", "subscription_id": subscription.ID})
+	if err := conn.WriteMessage(websocket.TextMessage, hello); err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(rtu.streamKeepalive())
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-client.done:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "subscription removed"),
+				time.Now().Add(time.Second))
+			return
+		case payload := <-client.events:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// attachStream attaches a streaming connection to the subscription named
+// in the request, or creates one from the query filter. The returned
+// release detaches the client and removes a subscription it created.
+func (rtu *RealtimeTopologyUpdater) attachStream(r *http.Request, method DeliveryMethod) (*Subscription, *streamClient, func(), error) {
+	query := r.URL.Query()
+
+	var subscription *Subscription
+	created := false
+	if id := query.Get("subscription"); id != "" {
+		rtu.subscriptionsMu.RLock()
+		subscription = rtu.subscriptions[id]
+		rtu.subscriptionsMu.RUnlock()
+		if subscription == nil {
+			return nil, nil, nil, fmt.Errorf("subscription not found: %s", id)
+		}
+		if subscription.DeliveryMethod != method {
+			return nil, nil, nil, fmt.Errorf("subscription %s uses %s delivery", id, subscription.DeliveryMethod)
+		}
+	} else {
+		filter, err := ParseUpdateFilter(query)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		clientID := query.Get("client_id")
+		if clientID == "" {
+			clientID = r.RemoteAddr
+		}
+		subscription, err = rtu.Subscribe(clientID, filter, method, r.URL.Path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		created = true
+	}
+
+	buffer := rtu.config.StreamBufferSize
+	if buffer <= 0 {
+		buffer = 64
+	}
+	client := &streamClient{
+		events: make(chan []byte, buffer),
+		done:   make(chan struct{}),
+	}
+
+	rtu.streamsMu.Lock()
+	if previous, exists := rtu.streams[subscription.ID]; exists {
+		// The newest connection of a subscription wins
+		close(previous.done)
+	}
+	rtu.streams[subscription.ID] = client
+	rtu.streamsMu.Unlock()
+
+	release := func() {
+		rtu.streamsMu.Lock()
+		if rtu.streams[subscription.ID] == client {
+			delete(rtu.streams, subscription.ID)
+			close(client.done)
+		}
+		rtu.streamsMu.Unlock()
+
+		if created {
+			rtu.Unsubscribe(subscription.ID)
+		}
+	}
+	return subscription, client, release, nil
+}
+
+// detachStream disconnects the streaming client of a removed subscription
+func (rtu *RealtimeTopologyUpdater) detachStream(subscriptionID string) {
+	rtu.streamsMu.Lock()
+	defer rtu.streamsMu.Unlock()
+
+	if client, exists := rtu.streams[subscriptionID]; exists {
+		delete(rtu.streams, subscriptionID)
+		close(client.done)
+	}
+}
+
+func (rtu *RealtimeTopologyUpdater) streamKeepalive() time.Duration {
+	if rtu.config.StreamKeepalive > 0 {
+		return rtu.config.StreamKeepalive
+	}
+	return 30 * time.Second
+}
+
+// ParseUpdateFilter builds an UpdateFilter from URL query parameters
+func ParseUpdateFilter(query map[string][]string) (UpdateFilter, error) {
+	get := func(name string) string {
+		if values := query[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	list := func(name string) []string {
+		var items []string
+		for _, item := range strings.Split(get(name), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+
+	var filter UpdateFilter
+	for _, eventType := range list("event_types") {
+		filter.EventTypes = append(filter.EventTypes, UpdateEventType(eventType))
+	}
+	filter.DeviceTypes = list("device_types")
+	filter.DeviceIDs = list("device_ids")
+
+	if priority := get("min_priority"); priority != "" {
+		switch UpdatePriority(priority) {
+		case PriorityLow, PriorityNormal, PriorityHigh, PriorityCritical:
+			filter.MinPriority = UpdatePriority(priority)
+		default:
+			return filter, fmt.Errorf("invalid min_priority: %s", priority)
+		}
+	}
+	if details := get("include_details"); details != "" {
+		include, err := strconv.ParseBool(details)
+		if err != nil {
+			return filter, fmt.Errorf("invalid include_details: %s", details)
+		}
+		filter.IncludeDetails = include
+	}
+	if throttle := get("throttle"); throttle != "" {
+		interval, err := time.ParseDuration(throttle)
+		if err != nil {
+			return filter, fmt.Errorf("invalid throttle: %s", throttle)
+		}
+		filter.ThrottleInterval = interval
+	}
+	return filter, nil
+}
+
+// hasStream reports whether a streaming client is attached to a subscription
+func (rtu *RealtimeTopologyUpdater) hasStream(subscriptionID string) bool {
+	rtu.streamsMu.RLock()
+	defer rtu.streamsMu.RUnlock()
+
+	_, exists := rtu.streams[subscriptionID]
+	return exists
+}
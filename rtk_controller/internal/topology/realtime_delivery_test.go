@@ -0,0 +1,298 @@
+package topology
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rtk_controller/internal/mqtt"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestUpdater(t *testing.T, config RealtimeUpdaterConfig) *RealtimeTopologyUpdater {
+	config.ChannelBufferSize = 16
+	config.WorkerPoolSize = 2
+	config.MaxSubscriptions = 10
+	config.UpdateRetention = time.Hour
+
+	rtu := NewRealtimeTopologyUpdater(&Manager{config: ManagerConfig{Tenant: "acme", Site: "hq"}}, nil, nil, nil, config)
+	require.NoError(t, rtu.Start())
+	t.Cleanup(func() { rtu.Stop() })
+	return rtu
+}
+
+func TestRealtimeUpdater_WebhookDeliveryWithRetry(t *testing.T) {
+	const secret = "s3cret"
+
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	var mu sync.Mutex
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, request{header: r.Header.Clone(), body: body})
+		attempt := len(requests)
+		mu.Unlock()
+
+		// Fail the first attempt so the delivery goes through retryProcessor
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	rtu := newTestUpdater(t, RealtimeUpdaterConfig{
+		WebhookSecret:  secret,
+		MaxRetries:     3,
+		RetryBackoffMs: 20,
+	})
+	subscription, err := rtu.Subscribe("hook", UpdateFilter{}, DeliveryWebhook, server.URL)
+	require.NoError(t, err)
+
+	require.NoError(t, rtu.PublishUpdate(TopologyUpdateEvent{
+		Type:     EventDeviceOffline,
+		DeviceID: "ap-1",
+		Priority: PriorityHigh,
+	}))
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(requests) == 2 && rtu.GetPendingDeliveries() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, req := range requests {
+		assert.Equal(t, string(EventDeviceOffline), req.header.Get(WebhookEventHeader))
+		assert.True(t, VerifyWebhook(secret, req.header.Get(WebhookTimestampHeader), req.body, req.header.Get(WebhookSignatureHeader)))
+		assert.False(t, VerifyWebhook("wrong", req.header.Get(WebhookTimestampHeader), req.body, req.header.Get(WebhookSignatureHeader)))
+	}
+	assert.Equal(t, requests[0].header.Get(WebhookDeliveryHeader), requests[1].header.Get(WebhookDeliveryHeader))
+
+	var message TopologyEventMessage
+	require.NoError(t, json.Unmarshal(requests[1].body, &message))
+	assert.Equal(t, subscription.ID, message.SubscriptionID)
+	assert.Equal(t, "ap-1", message.DeviceID)
+	assert.Equal(t, "acme", message.Tenant)
+	assert.Equal(t, "hq", message.Site)
+}
+
+func TestRealtimeUpdater_SSEDelivery(t *testing.T) {
+	rtu := newTestUpdater(t, RealtimeUpdaterConfig{})
+	server := httptest.NewServer(rtu.StreamHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/topology/events?event_types=device_online&client_id=dashboard")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	event, data := readSSEEvent(t, reader)
+	require.Equal(t, "subscribed", event)
+	assert.Contains(t, data, "dashboard")
+
+	// Filtered out by event type
+	require.NoError(t, rtu.PublishUpdate(TopologyUpdateEvent{Type: EventDeviceOffline, DeviceID: "sta-1"}))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, rtu.PublishUpdate(TopologyUpdateEvent{Type: EventDeviceOnline, DeviceID: "sta-2"}))
+
+	event, data = readSSEEvent(t, reader)
+	require.Equal(t, "topology", event)
+	var message TopologyEventMessage
+	require.NoError(t, json.Unmarshal([]byte(data), &message))
+	assert.Equal(t, EventDeviceOnline, message.Type)
+	assert.Equal(t, "sta-2", message.DeviceID)
+	assert.Empty(t, message.Changes)
+}
+
+func TestRealtimeUpdater_WebSocketDelivery(t *testing.T) {
+	rtu := newTestUpdater(t, RealtimeUpdaterConfig{})
+	server := httptest.NewServer(rtu.StreamHandler())
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/topology/ws?device_ids=ap-1&include_details=true"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, hello, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Contains(t, string(hello), "subscribed")
+	assert.Equal(t, int64(1), rtu.GetStats().ActiveSubscriptions)
+
+	// Filtered out by device ID
+	require.NoError(t, rtu.PublishUpdate(TopologyUpdateEvent{Type: EventDeviceUpdated, DeviceID: "ap-2"}))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, rtu.PublishUpdate(TopologyUpdateEvent{
+		Type:     EventDeviceUpdated,
+		DeviceID: "ap-1",
+		Changes: []ChangeDetail{
+			{ChangeType: ChangeUpdate, Field: "channel", OldValue: 36, NewValue: 149, Impact: ImpactMinor},
+		},
+	}))
+
+	_, payload, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var message TopologyEventMessage
+	require.NoError(t, json.Unmarshal(payload, &message))
+	assert.Equal(t, "ap-1", message.DeviceID)
+	require.Len(t, message.Changes, 1)
+	assert.Equal(t, "channel", message.Changes[0].Field)
+
+	// The connection's subscription goes away with it
+	conn.Close()
+	require.Eventually(t, func() bool {
+		return rtu.GetStats().ActiveSubscriptions == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRealtimeUpdater_StreamRejectsBadFilter(t *testing.T) {
+	rtu := newTestUpdater(t, RealtimeUpdaterConfig{})
+	server := httptest.NewServer(rtu.StreamHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/topology/events?min_priority=urgent")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/topology/events?subscription=missing")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestRealtimeUpdater_StreamAuth(t *testing.T) {
+	rtu := newTestUpdater(t, RealtimeUpdaterConfig{
+		StreamToken:    "t0ken",
+		AllowedOrigins: []string{"https://noc.example.com"},
+	})
+	server := httptest.NewServer(rtu.StreamHandler())
+	defer server.Close()
+
+	get := func(path string, header http.Header) int {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("/topology/events", nil))
+	assert.Equal(t, http.StatusUnauthorized, get("/topology/events?token=wrong", nil))
+	assert.Equal(t, http.StatusOK, get("/topology/events?token=t0ken", nil))
+	assert.Equal(t, http.StatusOK, get("/topology/events", http.Header{"Authorization": {"Bearer t0ken"}}))
+	assert.Equal(t, http.StatusForbidden, get("/topology/events?token=t0ken", http.Header{"Origin": {"https://evil.example.com"}}))
+	assert.Equal(t, http.StatusOK, get("/topology/events?token=t0ken", http.Header{"Origin": {"https://noc.example.com"}}))
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/topology/ws"
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	_, resp, err = websocket.DefaultDialer.Dial(wsURL+"?token=t0ken", http.Header{"Origin": {"https://evil.example.com"}})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token=t0ken", http.Header{"Origin": {"https://noc.example.com"}})
+	require.NoError(t, err)
+	conn.Close()
+
+	// The endpoint is not served without a token
+	unprotected := NewRealtimeTopologyUpdater(&Manager{}, nil, nil, nil, RealtimeUpdaterConfig{StreamAddress: "127.0.0.1:0"})
+	assert.Error(t, unprotected.Start())
+}
+
+// The controller module does not depend on a broker, so MQTT delivery is
+// checked against the EventPublisher contract. The service passes its
+// mqtt.Client, whose Publish goes straight to paho; the assertion below keeps
+// the two in step.
+var _ EventPublisher = (*mqtt.Client)(nil)
+
+func TestRealtimeUpdater_MQTTDelivery(t *testing.T) {
+	publisher := &recordingPublisher{}
+	rtu := newTestUpdater(t, RealtimeUpdaterConfig{})
+	rtu.SetEventPublisher(publisher)
+	_, err := rtu.Subscribe("bus", UpdateFilter{MinPriority: PriorityHigh}, DeliveryMQTT, "")
+	require.NoError(t, err)
+
+	// Below the subscription's minimum priority
+	require.NoError(t, rtu.PublishUpdate(TopologyUpdateEvent{Type: EventAnomalyDetected, DeviceID: "sta-1", Priority: PriorityNormal}))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, rtu.PublishUpdate(TopologyUpdateEvent{Type: EventAnomalyDetected, DeviceID: "sta-2", Priority: PriorityCritical}))
+
+	published := func() []publishedMessage {
+		publisher.mu.Lock()
+		defer publisher.mu.Unlock()
+		return append([]publishedMessage(nil), publisher.messages...)
+	}
+	require.Eventually(t, func() bool { return len(published()) > 0 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	messages := published()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "rtk/v1/acme/hq/_controller/topology/events", messages[0].topic)
+	assert.Equal(t, byte(1), messages[0].qos)
+	var message TopologyEventMessage
+	require.NoError(t, json.Unmarshal(messages[0].payload, &message))
+	assert.Equal(t, "sta-2", message.DeviceID)
+	assert.Equal(t, EventAnomalyDetected, message.Type)
+}
+
+func readSSEEvent(t *testing.T, reader *bufio.Reader) (event, data string) {
+	t.Helper()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- strings.TrimRight(line, "\n")
+			if line == "\n" {
+				return
+			}
+		}
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok || line == "" {
+				return event, data
+			}
+			if value, found := strings.CutPrefix(line, "event: "); found {
+				event = value
+			} else if value, found := strings.CutPrefix(line, "data: "); found {
+				data = value
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for SSE event")
+		}
+	}
+}
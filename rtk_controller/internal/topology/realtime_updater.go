@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"sync"
 	"time"
 
@@ -23,6 +24,14 @@ type RealtimeTopologyUpdater struct {
 	subscriptions   map[string]*Subscription
 	subscriptionsMu sync.RWMutex
 
+	// Delivery
+	publisher         EventPublisher
+	httpClient        *http.Client
+	httpServer        *http.Server
+	pendingDeliveries map[string]*PendingDelivery
+	streams           map[string]*streamClient
+	streamsMu         sync.RWMutex
+
 	// Update tracking
 	pendingUpdates map[string]*PendingUpdate
 	updateBatch    []TopologyUpdateEvent
@@ -194,6 +203,15 @@ type RealtimeUpdaterConfig struct {
 	SubscriptionTimeout time.Duration
 	DefaultThrottle     time.Duration
 
+	// Delivery settings
+	WebhookSecret    string        // HMAC-SHA256 key for webhook signatures; empty disables signing
+	WebhookTimeout   time.Duration // per webhook request
+	StreamAddress    string        // listen address of the SSE/WebSocket endpoint; empty disables it
+	StreamToken      string        // bearer token stream clients must present; required with StreamAddress
+	AllowedOrigins   []string      // browser origins allowed besides the endpoint's own; "*" allows any
+	StreamBufferSize int           // events buffered per SSE/WebSocket client
+	StreamKeepalive  time.Duration // keepalive interval of SSE/WebSocket connections
+
 	// Performance settings
 	ChannelBufferSize int
 	WorkerPoolSize    int
@@ -234,6 +252,9 @@ func NewRealtimeTopologyUpdater(
 		storage:           storage,
 		updateChannel:     make(chan TopologyUpdateEvent, config.ChannelBufferSize),
 		subscriptions:     make(map[string]*Subscription),
+		httpClient:        &http.Client{},
+		pendingDeliveries: make(map[string]*PendingDelivery),
+		streams:           make(map[string]*streamClient),
 		pendingUpdates:    make(map[string]*PendingUpdate),
 		updateBatch:       []TopologyUpdateEvent{},
 		config:            config,
@@ -249,6 +270,9 @@ func (rtu *RealtimeTopologyUpdater) Start() error {
 	if rtu.running {
 		return fmt.Errorf("realtime topology updater is already running")
 	}
+	if rtu.config.StreamAddress != "" && rtu.config.StreamToken == "" {
+		return fmt.Errorf("a stream token is required to serve topology event streams")
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	rtu.cancel = cancel
@@ -268,6 +292,20 @@ func (rtu *RealtimeTopologyUpdater) Start() error {
 	go rtu.metricsCollector(ctx)
 	go rtu.cleanupProcessor(ctx)
 
+	// Serve SSE and WebSocket subscribers
+	if rtu.config.StreamAddress != "" {
+		rtu.httpServer = &http.Server{
+			Addr:    rtu.config.StreamAddress,
+			Handler: rtu.StreamHandler(),
+		}
+		go func(server *http.Server) {
+			log.Printf("Serving topology event streams on %s", server.Addr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Topology event stream server failed: %v", err)
+			}
+		}(rtu.httpServer)
+	}
+
 	return nil
 }
 
@@ -283,6 +321,13 @@ func (rtu *RealtimeTopologyUpdater) Stop() error {
 	rtu.cancel()
 	rtu.running = false
 
+	if rtu.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		rtu.httpServer.Shutdown(ctx)
+		cancel()
+		rtu.httpServer = nil
+	}
+
 	// Close update channel
 	close(rtu.updateChannel)
 
@@ -340,8 +385,13 @@ func (rtu *RealtimeTopologyUpdater) Subscribe(
 		return nil, fmt.Errorf("maximum subscriptions reached")
 	}
 
+	id := fmt.Sprintf("sub_%d_%s", time.Now().UnixMilli(), clientID)
+	for seq := 1; rtu.subscriptions[id] != nil; seq++ {
+		id = fmt.Sprintf("sub_%d_%s_%d", time.Now().UnixMilli(), clientID, seq)
+	}
+
 	subscription := &Subscription{
-		ID:             fmt.Sprintf("sub_%d_%s", time.Now().UnixMilli(), clientID),
+		ID:             id,
 		ClientID:       clientID,
 		Filter:         filter,
 		DeliveryMethod: deliveryMethod,
@@ -351,7 +401,6 @@ func (rtu *RealtimeTopologyUpdater) Subscribe(
 	}
 
 	rtu.subscriptions[subscription.ID] = subscription
-	rtu.stats.ActiveSubscriptions++
 
 	log.Printf("Created subscription %s for client %s", subscription.ID, clientID)
 	return subscription, nil
@@ -369,7 +418,7 @@ func (rtu *RealtimeTopologyUpdater) Unsubscribe(subscriptionID string) error {
 
 	subscription.Active = false
 	delete(rtu.subscriptions, subscriptionID)
-	rtu.stats.ActiveSubscriptions--
+	rtu.detachStream(subscriptionID)
 
 	log.Printf("Removed subscription %s", subscriptionID)
 	return nil
@@ -377,11 +426,17 @@ func (rtu *RealtimeTopologyUpdater) Unsubscribe(subscriptionID string) error {
 
 // GetStats returns updater statistics
 func (rtu *RealtimeTopologyUpdater) GetStats() RealtimeUpdaterStats {
+	// Subscriptions are guarded by their own lock
+	rtu.subscriptionsMu.RLock()
+	activeSubscriptions := int64(len(rtu.subscriptions))
+	rtu.subscriptionsMu.RUnlock()
+
 	rtu.mu.RLock()
 	defer rtu.mu.RUnlock()
 
 	stats := rtu.stats
 	stats.QueuedUpdates = int64(len(rtu.pendingUpdates))
+	stats.ActiveSubscriptions = activeSubscriptions
 
 	// Calculate updates per second
 	if !stats.LastUpdate.IsZero() {
@@ -619,6 +674,21 @@ func (rtu *RealtimeTopologyUpdater) matchesFilter(event TopologyUpdateEvent, fil
 		}
 	}
 
+	// Check device type filter; the type comes from the event metadata
+	if len(filter.DeviceTypes) > 0 {
+		deviceType, _ := event.Metadata["device_type"].(string)
+		found := false
+		for _, t := range filter.DeviceTypes {
+			if deviceType == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
 	// Check priority filter
 	if !rtu.priorityMatches(event.Priority, filter.MinPriority) {
 		return false
@@ -639,12 +709,17 @@ func (rtu *RealtimeTopologyUpdater) priorityMatches(eventPriority, minPriority U
 }
 
 func (rtu *RealtimeTopologyUpdater) deliverUpdate(subscription *Subscription, event TopologyUpdateEvent) {
-	// Check throttling
+	// Check throttling; deliveries run concurrently, so claim the slot
+	// under the lock
+	rtu.subscriptionsMu.Lock()
 	if !subscription.LastUpdate.IsZero() {
 		if time.Since(subscription.LastUpdate) < subscription.Filter.ThrottleInterval {
+			rtu.subscriptionsMu.Unlock()
 			return // Throttled
 		}
 	}
+	subscription.LastUpdate = time.Now()
+	rtu.subscriptionsMu.Unlock()
 
 	// Deliver update based on method
 	var err error
@@ -662,37 +737,21 @@ func (rtu *RealtimeTopologyUpdater) deliverUpdate(subscription *Subscription, ev
 	}
 
 	// Update subscription statistics
-	subscription.LastUpdate = time.Now()
+	rtu.recordDelivery(subscription, err)
 	if err != nil {
-		subscription.FailureCount++
 		log.Printf("Failed to deliver update to subscription %s: %v", subscription.ID, err)
-	} else {
-		subscription.DeliveredCount++
 	}
 }
 
-func (rtu *RealtimeTopologyUpdater) deliverWebSocket(subscription *Subscription, event TopologyUpdateEvent) error {
-	// TODO: Implement WebSocket delivery
-	log.Printf("WebSocket delivery to %s: %s", subscription.ClientID, event.Type)
-	return nil
-}
-
-func (rtu *RealtimeTopologyUpdater) deliverWebhook(subscription *Subscription, event TopologyUpdateEvent) error {
-	// TODO: Implement webhook delivery
-	log.Printf("Webhook delivery to %s: %s", subscription.Endpoint, event.Type)
-	return nil
-}
-
-func (rtu *RealtimeTopologyUpdater) deliverSSE(subscription *Subscription, event TopologyUpdateEvent) error {
-	// TODO: Implement Server-Sent Events delivery
-	log.Printf("SSE delivery to %s: %s", subscription.ClientID, event.Type)
-	return nil
-}
+func (rtu *RealtimeTopologyUpdater) recordDelivery(subscription *Subscription, err error) {
+	rtu.subscriptionsMu.Lock()
+	defer rtu.subscriptionsMu.Unlock()
 
-func (rtu *RealtimeTopologyUpdater) deliverMQTT(subscription *Subscription, event TopologyUpdateEvent) error {
-	// TODO: Implement MQTT delivery
-	log.Printf("MQTT delivery to %s: %s", subscription.Endpoint, event.Type)
-	return nil
+	if err != nil {
+		subscription.FailureCount++
+	} else {
+		subscription.DeliveredCount++
+	}
 }
 
 func (rtu *RealtimeTopologyUpdater) batchProcessor(ctx context.Context) {
@@ -758,17 +817,32 @@ func (rtu *RealtimeTopologyUpdater) cleanupSubscriptions() {
 
 	now := time.Now()
 	for id, subscription := range rtu.subscriptions {
-		// Remove inactive subscriptions that have timed out
-		if !subscription.Active || now.Sub(subscription.LastUpdate) > rtu.config.SubscriptionTimeout {
+		// Remove inactive subscriptions that have timed out. Subscriptions
+		// with a connected stream client stay until it disconnects.
+		lastActive := subscription.LastUpdate
+		if lastActive.Before(subscription.CreatedAt) {
+			lastActive = subscription.CreatedAt
+		}
+		timedOut := rtu.config.SubscriptionTimeout > 0 && now.Sub(lastActive) > rtu.config.SubscriptionTimeout
+		if timedOut && rtu.hasStream(id) {
+			timedOut = false
+		}
+		if !subscription.Active || timedOut {
 			delete(rtu.subscriptions, id)
-			rtu.stats.ActiveSubscriptions--
+			rtu.detachStream(id)
 			log.Printf("Cleaned up inactive subscription: %s", id)
 		}
 	}
 }
 
 func (rtu *RealtimeTopologyUpdater) retryProcessor(ctx context.Context) {
-	ticker := time.NewTicker(time.Minute)
+	// Check at least as often as the retry backoff so webhook retries are
+	// not held back by the ticker
+	interval := time.Minute
+	if backoff := time.Duration(rtu.config.RetryBackoffMs) * time.Millisecond; backoff > 0 && backoff < interval {
+		interval = backoff
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -777,6 +851,7 @@ func (rtu *RealtimeTopologyUpdater) retryProcessor(ctx context.Context) {
 			return
 		case <-ticker.C:
 			rtu.retryFailedUpdates()
+			rtu.retryFailedDeliveries()
 		}
 	}
 }
@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"rtk_controller/internal/storage"
+	"rtk_controller/pkg/types"
 )
 
 // TopologyAlertingSystem manages alerts for topology changes and network issues
@@ -29,9 +34,22 @@ type TopologyAlertingSystem struct {
 	escalations  map[string]*AlertEscalation
 	mu           sync.RWMutex
 
+	// Rule evaluation: sampled metrics and when each rule last raised an
+	// alert per device
+	metricHistory *MetricHistory
+	ruleLastFired map[string]time.Time
+
+	// Raise/clear transitions per alert fingerprint, for flap detection
+	flapStates map[string]*flapState
+
 	// Configuration
 	config AlertingConfig
 
+	// Notification delivery
+	publisher     EventPublisher
+	httpClient    *http.Client
+	notifications sync.WaitGroup // deliveries in flight
+
 	// Background processing
 	running bool
 	cancel  context.CancelFunc
@@ -85,8 +103,15 @@ type TopologyAlert struct {
 	RootCause          string
 	RecommendedActions []string
 
+	// Correlation: the fingerprint repeats are folded into, the incident
+	// this alert was grouped under and whether it is flapping
+	Fingerprint string
+	ParentID    string
+	Flapping    bool
+
 	// Notification status
 	NotificationsSent []NotificationRecord
+	NotificationsHeld bool // grouped or flapping, notify and escalate are skipped
 	SuppressedUntil   time.Time
 
 	// Metadata
@@ -102,7 +127,9 @@ type AlertRule struct {
 	Enabled     bool
 	Category    AlertCategory
 
-	// Conditions
+	// Conditions, either an expression (see RuleExpression) or structured
+	// conditions that are converted to one
+	Expression     string
 	Conditions     []RuleCondition
 	ConditionLogic ConditionLogic // AND, OR
 
@@ -129,9 +156,12 @@ type AlertRule struct {
 	TimeFilter   TimeFilter
 
 	// Metadata
+	Source    string // rule file the rule was loaded from, empty otherwise
 	CreatedBy string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	compiled *RuleExpression
 }
 
 // RuleCondition defines a condition within an alert rule
@@ -202,12 +232,18 @@ type NotificationTarget struct {
 
 // NotificationRecord tracks sent notifications
 type NotificationRecord struct {
-	Type     NotificationType
-	Target   string
-	SentAt   time.Time
-	Status   NotificationStatus
-	Error    string
-	Response string
+	Type      NotificationType
+	Target    string
+	Route     string
+	SentAt    time.Time
+	Status    NotificationStatus
+	Error     string
+	Response  string
+	Attempts  int
+	NextRetry time.Time // zero once delivered or given up
+
+	// route is what retries are sent through
+	route NotificationRoute
 }
 
 // AlertContext provides context about the alert
@@ -560,18 +596,32 @@ type AlertingConfig struct {
 	SuppressionEnabled        bool
 	MaintenanceWindowSuppress bool
 	DuplicateAlertSuppression bool
-	DuplicateTimeWindow       time.Duration
+	DuplicateTimeWindow       time.Duration // zero folds repeats for as long as the alert is open
+
+	// Flap detection: an alert raised and cleared FlapThreshold times within
+	// FlapWindow holds its notifications until it settles. Zero disables it.
+	FlapThreshold int
+	FlapWindow    time.Duration
 
 	// Correlation settings
 	AlertCorrelationEnabled bool
 	CorrelationTimeWindow   time.Duration
 	CorrelationDistance     float64
+	GroupByUpstream         bool // group client alerts under their AP's outage alert
+
+	// Rule files loaded on start and reloaded when they change
+	RuleFiles      []string
+	WatchRuleFiles bool
 
 	// Performance settings
 	BatchProcessingSize     int
 	ConcurrentNotifications int
 	AlertQueueSize          int
 
+	// Notification routes and the mail server used by email routes
+	NotificationRoutes []NotificationRoute
+	SMTP               SMTPSettings
+
 	// Integration settings
 	WebhookTimeout   time.Duration
 	WebhookRetries   int
@@ -580,6 +630,21 @@ type AlertingConfig struct {
 	PagerDutyEnabled bool
 }
 
+// DefaultAlertingConfig returns the processing intervals and limits of the
+// alerting system. Notification routes come from ApplyConfig.
+func DefaultAlertingConfig() AlertingConfig {
+	return AlertingConfig{
+		AlertProcessingInterval:   30 * time.Second,
+		EscalationCheckInterval:   time.Minute,
+		NotificationRetryInterval: 30 * time.Second,
+		AlertCleanupInterval:      time.Hour,
+		AlertHistoryRetention:     7 * 24 * time.Hour,
+		NotificationTimeout:       10 * time.Second,
+		NotificationRetries:       5,
+		SuppressionEnabled:        true,
+	}
+}
+
 // AlertingStats holds alerting system statistics
 type AlertingStats struct {
 	TotalAlerts           int64
@@ -587,6 +652,9 @@ type AlertingStats struct {
 	ResolvedAlerts        int64
 	EscalatedAlerts       int64
 	SuppressedAlerts      int64
+	DeduplicatedAlerts    int64
+	GroupedAlerts         int64
+	FlappingAlerts        int64
 	NotificationsSent     int64
 	NotificationsFailed   int64
 	AverageResolutionTime time.Duration
@@ -621,7 +689,11 @@ func NewTopologyAlertingSystem(
 		alertRules:        []AlertRule{},
 		suppressions:      make(map[string]*AlertSuppression),
 		escalations:       make(map[string]*AlertEscalation),
+		metricHistory:     NewMetricHistory(),
+		ruleLastFired:     make(map[string]time.Time),
+		flapStates:        make(map[string]*flapState),
 		config:            config,
+		httpClient:        &http.Client{},
 		stats: AlertingStats{
 			AlertsByType:     make(map[TopologyAlertType]int64),
 			AlertsBySeverity: make(map[AlertSeverity]int64),
@@ -647,6 +719,12 @@ func (tas *TopologyAlertingSystem) Start() error {
 	// Initialize default alert rules
 	tas.initializeDefaultRules()
 
+	if tas.config.WatchRuleFiles && len(tas.config.RuleFiles) > 0 {
+		if err := tas.startRuleFileWatcher(ctx); err != nil {
+			log.Printf("Alert rule files will not be reloaded: %v", err)
+		}
+	}
+
 	// Start background processing
 	go tas.alertProcessingLoop(ctx)
 	go tas.escalationProcessingLoop(ctx)
@@ -687,17 +765,40 @@ func (tas *TopologyAlertingSystem) CreateAlert(
 	description string,
 	context AlertContext,
 ) (*TopologyAlert, error) {
+	return tas.createAlert(alertType, severity, deviceID, macAddress, title, description, context, nil, nil)
+}
+
+// createAlert creates an alert, recording the rule and conditions that
+// triggered it if it was raised by a rule
+func (tas *TopologyAlertingSystem) createAlert(
+	alertType TopologyAlertType,
+	severity AlertSeverity,
+	deviceID string,
+	macAddress string,
+	title string,
+	description string,
+	context AlertContext,
+	rule *AlertRule,
+	triggers []TriggerCondition,
+) (*TopologyAlert, error) {
 
 	tas.mu.Lock()
 	defer tas.mu.Unlock()
 
-	// Check for duplicates
+	now := time.Now()
+	ruleID := ""
+	if rule != nil {
+		ruleID = rule.ID
+	}
+	fingerprint := alertFingerprint(alertType, deviceID, macAddress, ruleID)
+
+	// Fold repeats into the open alert
 	if tas.config.DuplicateAlertSuppression {
-		if existing := tas.findDuplicateAlert(alertType, deviceID, macAddress); existing != nil {
-			// Update existing alert
+		if existing := tas.findDuplicateAlert(fingerprint, now); existing != nil {
 			existing.Frequency++
-			existing.LastOccurrence = time.Now()
-			existing.UpdatedAt = time.Now()
+			existing.LastOccurrence = now
+			existing.UpdatedAt = now
+			tas.stats.DeduplicatedAlerts++
 			return existing, nil
 		}
 	}
@@ -710,14 +811,13 @@ func (tas *TopologyAlertingSystem) CreateAlert(
 
 	// Get friendly name
 	friendlyName := macAddress
-	if macAddress != "" {
+	if macAddress != "" && tas.identityStorage != nil {
 		if identity, err := tas.identityStorage.GetDeviceIdentity(macAddress); err == nil {
 			friendlyName = identity.FriendlyName
 		}
 	}
 
 	// Create alert
-	now := time.Now()
 	alert := &TopologyAlert{
 		ID:                 fmt.Sprintf("alert_%d_%s", now.UnixMilli(), deviceID),
 		Type:               alertType,
@@ -738,15 +838,33 @@ func (tas *TopologyAlertingSystem) CreateAlert(
 		LastOccurrence:     now,
 		Frequency:          1,
 		Context:            context,
-		TriggerConditions:  []TriggerCondition{},
+		TriggerConditions:  append([]TriggerCondition{}, triggers...),
 		AffectedDevices:    []string{deviceID},
 		RelatedAlerts:      []string{},
 		RecommendedActions: tas.generateRecommendations(alertType, severity),
+		Fingerprint:        fingerprint,
 		NotificationsSent:  []NotificationRecord{},
 		Tags:               []string{},
 		CustomFields:       make(map[string]interface{}),
 	}
 
+	if rule != nil {
+		// Several rules can fire for a device in the same evaluation
+		alert.ID = fmt.Sprintf("alert_%d_%s_%s", now.UnixMilli(), rule.ID, deviceID)
+		alert.SourceType = SourceScheduledCheck
+		alert.CustomFields["rule_id"] = rule.ID
+		if rule.Category != "" {
+			alert.Category = rule.Category
+		}
+	}
+
+	// An alert raised again soon after clearing may be flapping
+	if tas.recordTransitionLocked(fingerprint, true, now) {
+		alert.Flapping = true
+		alert.NotificationsHeld = true
+	}
+	tas.groupAlertLocked(alert)
+
 	// Store alert
 	tas.activeAlerts[alert.ID] = alert
 	tas.alertHistory = append(tas.alertHistory, *alert)
@@ -788,12 +906,17 @@ func (tas *TopologyAlertingSystem) ResolveAlert(alertID string, resolvedBy strin
 	tas.mu.Lock()
 	defer tas.mu.Unlock()
 
+	return tas.resolveAlertLocked(alertID, resolvedBy, reason, time.Now())
+}
+
+// resolveAlertLocked resolves an alert and the alerts grouped under it;
+// tas.mu must be held
+func (tas *TopologyAlertingSystem) resolveAlertLocked(alertID, resolvedBy, reason string, now time.Time) error {
 	alert, exists := tas.activeAlerts[alertID]
 	if !exists {
 		return fmt.Errorf("alert not found: %s", alertID)
 	}
 
-	now := time.Now()
 	alert.Status = StatusResolved
 	alert.ResolvedAt = now
 	alert.ResolvedBy = resolvedBy
@@ -827,6 +950,15 @@ func (tas *TopologyAlertingSystem) ResolveAlert(alertID string, resolvedBy strin
 		escalation.Completed = true
 	}
 
+	tas.recordTransitionLocked(alert.Fingerprint, false, now)
+
+	// Grouped alerts were caused by this one
+	for _, childID := range alert.RelatedAlerts {
+		if child, exists := tas.activeAlerts[childID]; exists && child.ParentID == alertID {
+			tas.resolveAlertLocked(childID, resolvedBy, "parent alert resolved: "+reason, now)
+		}
+	}
+
 	return nil
 }
 
@@ -898,22 +1030,60 @@ func (tas *TopologyAlertingSystem) GetAlertHistory(
 	return filteredAlerts
 }
 
-// AddAlertRule adds a new alert rule
+// AddAlertRule adds an alert rule, replacing the rule with the same ID if
+// there is one. The new rule takes effect on the next evaluation.
 func (tas *TopologyAlertingSystem) AddAlertRule(rule AlertRule) error {
+	// Validate rule
+	if err := validateAlertRule(&rule); err != nil {
+		return fmt.Errorf("invalid alert rule: %w", err)
+	}
+
 	tas.mu.Lock()
 	defer tas.mu.Unlock()
 
-	// Validate rule
-	if err := tas.validateAlertRule(rule); err != nil {
-		return fmt.Errorf("invalid alert rule: %w", err)
+	now := time.Now()
+	rule.UpdatedAt = now
+	for i, existing := range tas.alertRules {
+		if existing.ID == rule.ID {
+			rule.CreatedAt = existing.CreatedAt
+			tas.alertRules[i] = rule
+			log.Printf("Updated alert rule: %s", rule.Name)
+			return nil
+		}
 	}
 
+	rule.CreatedAt = now
 	tas.alertRules = append(tas.alertRules, rule)
 
 	log.Printf("Added alert rule: %s", rule.Name)
 	return nil
 }
 
+// RemoveAlertRule removes an alert rule. Alerts it raised stay open.
+func (tas *TopologyAlertingSystem) RemoveAlertRule(ruleID string) error {
+	tas.mu.Lock()
+	defer tas.mu.Unlock()
+
+	for i, rule := range tas.alertRules {
+		if rule.ID == ruleID {
+			tas.alertRules = append(tas.alertRules[:i], tas.alertRules[i+1:]...)
+			log.Printf("Removed alert rule: %s", rule.Name)
+			return nil
+		}
+	}
+	return fmt.Errorf("alert rule not found: %s", ruleID)
+}
+
+// GetAlertRules returns the alert rules in evaluation order
+func (tas *TopologyAlertingSystem) GetAlertRules() []AlertRule {
+	tas.mu.RLock()
+	defer tas.mu.RUnlock()
+
+	rules := make([]AlertRule, len(tas.alertRules))
+	copy(rules, tas.alertRules)
+	return rules
+}
+
 // CreateSuppression creates a new alert suppression
 func (tas *TopologyAlertingSystem) CreateSuppression(suppression AlertSuppression) error {
 	tas.mu.Lock()
@@ -935,23 +1105,16 @@ func (tas *TopologyAlertingSystem) GetStats() AlertingStats {
 
 // Private methods
 
-func (tas *TopologyAlertingSystem) initializeDefaultRules() {
+// DefaultAlertRules returns the built-in alert rules
+func DefaultAlertRules() []AlertRule {
 	// Device offline rule
 	deviceOfflineRule := AlertRule{
-		ID:          "device_offline",
-		Name:        "Device Offline Detection",
-		Description: "Alert when a device goes offline",
-		Enabled:     true,
-		Category:    CategoryAvailability,
-		Conditions: []RuleCondition{
-			{
-				Type:     ConditionStatusChange,
-				Field:    "device_status",
-				Operator: ComparisonOperator("equals"),
-				Value:    "offline",
-			},
-		},
-		ConditionLogic:   LogicAND,
+		ID:               "device_offline",
+		Name:             "Device Offline Detection",
+		Description:      "Alert when a device goes offline",
+		Enabled:          true,
+		Category:         CategoryAvailability,
+		Expression:       "online == 0",
 		AlertType:        AlertDeviceOffline,
 		Severity:         SeverityError,
 		Priority:         PriorityP2,
@@ -968,22 +1131,12 @@ func (tas *TopologyAlertingSystem) initializeDefaultRules() {
 		Description: "Alert when connection quality degrades significantly",
 		Enabled:     true,
 		Category:    CategoryPerformance,
-		Conditions: []RuleCondition{
-			{
-				Type:                ConditionMetricThreshold,
-				Field:               "quality_score",
-				Operator:            OperatorLessThan,
-				Threshold:           0.5,
-				TimeWindow:          5 * time.Minute,
-				AggregationFunction: AggregationAverage,
-			},
-		},
-		ConditionLogic: LogicAND,
-		AlertType:      AlertQualityDegraded,
-		Severity:       SeverityWarning,
-		Priority:       PriorityP3,
-		Cooldown:       10 * time.Minute,
-		Actions:        []AlertActionType{ActionNotify},
+		Expression:  "avg(quality, 5m) < 0.5",
+		AlertType:   AlertQualityDegraded,
+		Severity:    SeverityWarning,
+		Priority:    PriorityP3,
+		Cooldown:    10 * time.Minute,
+		Actions:     []AlertActionType{ActionNotify},
 	}
 
 	// Excessive roaming rule
@@ -993,31 +1146,43 @@ func (tas *TopologyAlertingSystem) initializeDefaultRules() {
 		Description: "Alert when a device roams excessively",
 		Enabled:     true,
 		Category:    CategoryPerformance,
-		Conditions: []RuleCondition{
-			{
-				Type:                ConditionMetricThreshold,
-				Field:               "roaming_frequency",
-				Operator:            OperatorGreaterThan,
-				Threshold:           5.0,
-				TimeWindow:          time.Hour,
-				AggregationFunction: AggregationCount,
-			},
-		},
-		ConditionLogic: LogicAND,
-		AlertType:      AlertExcessiveRoaming,
-		Severity:       SeverityWarning,
-		Priority:       PriorityP3,
-		Cooldown:       30 * time.Minute,
-		Actions:        []AlertActionType{ActionNotify},
+		Expression:  "roaming_frequency > 5",
+		AlertType:   AlertExcessiveRoaming,
+		Severity:    SeverityWarning,
+		Priority:    PriorityP3,
+		Cooldown:    30 * time.Minute,
+		Actions:     []AlertActionType{ActionNotify},
+	}
+
+	var rules []AlertRule
+	for _, rule := range []AlertRule{deviceOfflineRule, qualityDegradationRule, excessiveRoamingRule} {
+		if err := validateAlertRule(&rule); err != nil {
+			log.Printf("Skipping invalid default alert rule %s: %v", rule.ID, err)
+			continue
+		}
+		rules = append(rules, rule)
 	}
+	return rules
+}
 
-	tas.alertRules = []AlertRule{
-		deviceOfflineRule,
-		qualityDegradationRule,
-		excessiveRoamingRule,
+func (tas *TopologyAlertingSystem) initializeDefaultRules() {
+	// Rules loaded before start replace the defaults with the same ID
+	added := 0
+	for _, rule := range DefaultAlertRules() {
+		exists := false
+		for _, existing := range tas.alertRules {
+			if existing.ID == rule.ID {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			tas.alertRules = append(tas.alertRules, rule)
+			added++
+		}
 	}
 
-	log.Printf("Initialized %d default alert rules", len(tas.alertRules))
+	log.Printf("Initialized %d default alert rules", added)
 }
 
 func (tas *TopologyAlertingSystem) alertProcessingLoop(ctx context.Context) {
@@ -1030,6 +1195,7 @@ func (tas *TopologyAlertingSystem) alertProcessingLoop(ctx context.Context) {
 			return
 		case <-ticker.C:
 			tas.processAlertRules()
+			tas.processFlapping(time.Now())
 		}
 	}
 }
@@ -1086,33 +1252,42 @@ func (tas *TopologyAlertingSystem) processAlertRules() {
 	copy(rules, tas.alertRules)
 	tas.mu.RUnlock()
 
+	now := time.Now()
+	tas.metricHistory.Add(tas.collectMetricSamples(now)...)
+
+	retention := defaultMetricRetention
+	for _, rule := range rules {
+		if rule.compiled != nil && rule.compiled.Lookback() > retention {
+			retention = rule.compiled.Lookback()
+		}
+	}
+	tas.metricHistory.Prune(now.Add(-retention))
+
 	for _, rule := range rules {
 		if !rule.Enabled {
 			continue
 		}
 
 		if tas.shouldProcessRule(rule) {
-			tas.evaluateRule(rule)
+			tas.evaluateRule(rule, now)
 		}
 	}
 
-	tas.stats.LastProcessingTime = time.Now()
+	tas.mu.Lock()
+	tas.stats.LastProcessingTime = now
+	tas.mu.Unlock()
 }
 
 func (tas *TopologyAlertingSystem) shouldProcessRule(rule AlertRule) bool {
-	// Check cooldown
-	if rule.Cooldown > 0 {
-		// Find last alert of this type
-		for _, alert := range tas.activeAlerts {
-			if alert.Type == rule.AlertType &&
-				time.Since(alert.LastOccurrence) < rule.Cooldown {
-				return false
-			}
-		}
+	if rule.compiled == nil {
+		return false
 	}
 
 	// Check frequency limits
 	if rule.MaxFrequency > 0 && rule.TimeWindow > 0 {
+		tas.mu.RLock()
+		defer tas.mu.RUnlock()
+
 		count := 0
 		since := time.Now().Add(-rule.TimeWindow)
 
@@ -1130,88 +1305,212 @@ func (tas *TopologyAlertingSystem) shouldProcessRule(rule AlertRule) bool {
 	return true
 }
 
-func (tas *TopologyAlertingSystem) evaluateRule(rule AlertRule) {
-	// This is a simplified rule evaluation
-	// In a real implementation, this would be much more sophisticated
+// evaluateRule evaluates a rule for every device it applies to. A device
+// gets one alert while the condition holds; the rule's cooldown applies
+// between alerts for the same device, and auto-resolving rules resolve the
+// alert once the condition has been clear for AutoResolveDelay.
+func (tas *TopologyAlertingSystem) evaluateRule(rule AlertRule, now time.Time) {
+	expr := rule.compiled
 
-	switch rule.AlertType {
-	case AlertDeviceOffline:
-		tas.checkDeviceOfflineRule(rule)
-	case AlertQualityDegraded:
-		tas.checkQualityDegradationRule(rule)
-	case AlertExcessiveRoaming:
-		tas.checkExcessiveRoamingRule(rule)
-	default:
-		log.Printf("Unknown rule type: %s", rule.AlertType)
+	for _, device := range tas.metricHistory.Devices(expr.Metrics()...) {
+		if !expr.AppliesTo(device, tas.lookupIdentity) {
+			continue
+		}
+
+		fired, results := expr.Evaluate(tas.metricHistory, device, now)
+		if !fired {
+			if rule.AutoResolve {
+				tas.autoResolveRuleAlert(rule, device, now)
+			}
+			continue
+		}
+
+		if tas.refreshRuleAlert(rule, device, now) {
+			continue
+		}
+
+		key := rule.ID + "|" + device
+		tas.mu.Lock()
+		lastFired, exists := tas.ruleLastFired[key]
+		if exists && rule.Cooldown > 0 && now.Sub(lastFired) < rule.Cooldown {
+			tas.mu.Unlock()
+			continue
+		}
+		tas.ruleLastFired[key] = now
+		tas.mu.Unlock()
+
+		macAddress := ""
+		if isMACAddress(device) {
+			macAddress = device
+		}
+		_, err := tas.createAlert(
+			rule.AlertType,
+			rule.Severity,
+			device,
+			macAddress,
+			rule.Name,
+			describeRuleResults(expr, results),
+			tas.buildAlertContext(device, macAddress),
+			&rule,
+			ruleTriggerConditions(results),
+		)
+		if err != nil {
+			log.Printf("Alert rule %s for %s: %v", rule.ID, device, err)
+		}
 	}
 }
 
-func (tas *TopologyAlertingSystem) checkDeviceOfflineRule(rule AlertRule) {
-	// Check for offline devices using topology manager
-	// This is a placeholder implementation
+// refreshRuleAlert marks the open alert a rule raised for a device as still
+// occurring and reports whether there is one
+func (tas *TopologyAlertingSystem) refreshRuleAlert(rule AlertRule, device string, now time.Time) bool {
+	tas.mu.Lock()
+	defer tas.mu.Unlock()
 
-	// In a real implementation, this would check actual device states
-	// and create alerts for devices that have gone offline
+	if alert := tas.findRuleAlert(rule.ID, device); alert != nil {
+		alert.LastOccurrence = now
+		alert.UpdatedAt = now
+		tas.recordTransitionLocked(alert.Fingerprint, true, now)
+		return true
+	}
+	return false
 }
 
-func (tas *TopologyAlertingSystem) checkQualityDegradationRule(rule AlertRule) {
-	// Check for quality degradation using quality monitor
-	if tas.qualityMonitor == nil {
+// autoResolveRuleAlert resolves the open alert a rule raised for a device
+// once the condition has been clear for AutoResolveDelay. A flapping alert
+// stays open until processFlapping sees it settle.
+func (tas *TopologyAlertingSystem) autoResolveRuleAlert(rule AlertRule, device string, now time.Time) {
+	tas.mu.Lock()
+	defer tas.mu.Unlock()
+
+	alert := tas.findRuleAlert(rule.ID, device)
+	if alert == nil || now.Sub(alert.LastOccurrence) < rule.AutoResolveDelay {
 		return
 	}
+	if tas.recordTransitionLocked(alert.Fingerprint, false, now) {
+		return
+	}
+	if err := tas.resolveAlertLocked(alert.ID, "auto_resolve", fmt.Sprintf("%s no longer holds", rule.compiled.Source), now); err != nil {
+		log.Printf("Failed to auto-resolve alert %s: %v", alert.ID, err)
+	}
+}
 
-	allQuality := tas.qualityMonitor.GetAllConnectionQuality()
+// findRuleAlert returns the open alert a rule raised for a device; tas.mu
+// must be held
+func (tas *TopologyAlertingSystem) findRuleAlert(ruleID, device string) *TopologyAlert {
+	for _, alert := range tas.activeAlerts {
+		if alert.DeviceID == device && alert.CustomFields["rule_id"] == ruleID {
+			return alert
+		}
+	}
+	return nil
+}
 
-	for _, metrics := range allQuality {
-		if metrics.OverallQuality.Overall < 0.5 {
-			// Create quality degradation alert
-			context := tas.buildAlertContext(metrics.DeviceID, metrics.MacAddress)
+// lookupIdentity resolves a device to its identity for rule selectors
+func (tas *TopologyAlertingSystem) lookupIdentity(device string) *types.DeviceIdentity {
+	if tas.identityStorage == nil {
+		return nil
+	}
+	return LookupDeviceIdentity(tas.identityStorage, device)
+}
 
-			tas.CreateAlert(
-				AlertQualityDegraded,
-				SeverityWarning,
-				metrics.DeviceID,
-				metrics.MacAddress,
-				"Connection Quality Degraded",
-				fmt.Sprintf("Quality score: %.2f", metrics.OverallQuality.Overall),
-				context,
-			)
+// LookupDeviceIdentity finds the identity of a device given its MAC address
+// in any common notation
+func LookupDeviceIdentity(identityStorage *storage.IdentityStorage, device string) *types.DeviceIdentity {
+	candidates := []string{device}
+	if key := normalizeDeviceKey(device); len(key) == 12 {
+		var parts []string
+		for i := 0; i < 12; i += 2 {
+			parts = append(parts, key[i:i+2])
 		}
+		candidates = append(candidates, strings.Join(parts, ":"), strings.ToUpper(strings.Join(parts, ":")))
 	}
-}
 
-func (tas *TopologyAlertingSystem) checkExcessiveRoamingRule(rule AlertRule) {
-	// Check for excessive roaming using roaming detector
-	if tas.roamingDetector == nil {
-		return
+	for _, candidate := range candidates {
+		if identity, err := identityStorage.GetDeviceIdentity(candidate); err == nil {
+			return identity
+		}
 	}
+	return nil
+}
 
-	stats := tas.roamingDetector.GetStats()
+func isMACAddress(device string) bool {
+	_, err := net.ParseMAC(device)
+	return err == nil
+}
 
-	// Check if excessive roaming clients count is above threshold
-	if stats.ExcessiveRoamingClients > 0 {
-		context := tas.buildGenericAlertContext()
+func describeRuleResults(expr *RuleExpression, results []ClauseResult) string {
+	var parts []string
+	for _, result := range results {
+		if !result.Held {
+			continue
+		}
+		switch {
+		case result.Clause.Function == "absent":
+			parts = append(parts, fmt.Sprintf("no %s for %.0f minutes", result.Clause.Metric, result.Value))
+		case result.Known:
+			parts = append(parts, fmt.Sprintf("%s (now %s)", result.Clause, strconv.FormatFloat(result.Value, 'f', -1, 64)))
+		}
+	}
+	return fmt.Sprintf("%s: %s", expr.Source, strings.Join(parts, ", "))
+}
 
-		tas.CreateAlert(
-			AlertExcessiveRoaming,
-			SeverityWarning,
-			"",
-			"",
-			"Excessive Roaming Detected",
-			fmt.Sprintf("%d clients showing excessive roaming behavior", stats.ExcessiveRoamingClients),
-			context,
-		)
+func ruleTriggerConditions(results []ClauseResult) []TriggerCondition {
+	var triggers []TriggerCondition
+	for _, result := range results {
+		if !result.Held {
+			continue
+		}
+		trigger := TriggerCondition{
+			Type:             result.Clause.Function,
+			Field:            result.Clause.Metric,
+			Threshold:        result.Clause.Threshold,
+			ComparisonResult: result.Clause.String(),
+			Confidence:       1,
+		}
+		if trigger.Type == "" {
+			trigger.Type = "threshold"
+		}
+		if result.Known {
+			trigger.ActualValue = result.Value
+		}
+		triggers = append(triggers, trigger)
 	}
+	return triggers
 }
 
 func (tas *TopologyAlertingSystem) processAlertActions(alert *TopologyAlert) {
-	// Find applicable rules for this alert
+	// Find applicable rules for this alert, the rule that raised it if any
+	tas.mu.RLock()
+	ruleID, _ := alert.CustomFields["rule_id"].(string)
+	var actions []AlertActionType
+	found := false
 	for _, rule := range tas.alertRules {
-		if rule.AlertType == alert.Type && rule.Enabled {
-			tas.executeAlertActions(alert, rule.Actions)
+		if !rule.Enabled {
+			continue
+		}
+		if ruleID != "" && rule.ID == ruleID || ruleID == "" && rule.AlertType == alert.Type {
+			actions = rule.Actions
+			found = true
 			break
 		}
 	}
+	held := alert.NotificationsHeld
+	tas.mu.RUnlock()
+
+	// Grouped and flapping alerts are only logged and ticketed
+	if held {
+		kept := make([]AlertActionType, 0, len(actions))
+		for _, action := range actions {
+			if action != ActionNotify && action != ActionEscalate {
+				kept = append(kept, action)
+			}
+		}
+		actions = kept
+	}
+
+	if found {
+		tas.executeAlertActions(alert, actions)
+	}
 }
 
 func (tas *TopologyAlertingSystem) executeAlertActions(alert *TopologyAlert, actions []AlertActionType) {
@@ -1231,111 +1530,6 @@ func (tas *TopologyAlertingSystem) executeAlertActions(alert *TopologyAlert, act
 	}
 }
 
-func (tas *TopologyAlertingSystem) sendNotifications(alert *TopologyAlert) {
-	// Send notifications based on alert severity and configuration
-
-	targets := tas.getNotificationTargets(alert)
-
-	for _, target := range targets {
-		record := NotificationRecord{
-			Type:   target.Type,
-			Target: target.Target,
-			SentAt: time.Now(),
-			Status: NotificationPending,
-		}
-
-		err := tas.sendNotification(target, alert)
-		if err != nil {
-			record.Status = NotificationFailed
-			record.Error = err.Error()
-			tas.stats.NotificationsFailed++
-		} else {
-			record.Status = NotificationSent
-			tas.stats.NotificationsSent++
-		}
-
-		alert.NotificationsSent = append(alert.NotificationsSent, record)
-	}
-}
-
-func (tas *TopologyAlertingSystem) sendNotification(target NotificationTarget, alert *TopologyAlert) error {
-	switch target.Type {
-	case NotificationEmail:
-		return tas.sendEmailNotification(target.Target, alert)
-	case NotificationWebhook:
-		return tas.sendWebhookNotification(target.Target, alert)
-	case NotificationSlack:
-		return tas.sendSlackNotification(target.Target, alert)
-	case NotificationMQTT:
-		return tas.sendMQTTNotification(target.Target, alert)
-	default:
-		return fmt.Errorf("unsupported notification type: %s", target.Type)
-	}
-}
-
-func (tas *TopologyAlertingSystem) getNotificationTargets(alert *TopologyAlert) []NotificationTarget {
-	// Return default notification targets based on severity
-	// In a real implementation, this would be configurable
-
-	targets := []NotificationTarget{}
-
-	switch alert.Severity {
-	case SeverityCritical:
-		targets = append(targets, NotificationTarget{
-			Type:     NotificationEmail,
-			Target:   "admin@example.com",
-			Priority: NotificationUrgent,
-			Enabled:  true,
-		})
-		targets = append(targets, NotificationTarget{
-			Type:     NotificationSlack,
-			Target:   "#alerts",
-			Priority: NotificationHigh,
-			Enabled:  true,
-		})
-	case SeverityError:
-		targets = append(targets, NotificationTarget{
-			Type:     NotificationEmail,
-			Target:   "support@example.com",
-			Priority: NotificationHigh,
-			Enabled:  true,
-		})
-	case SeverityWarning:
-		targets = append(targets, NotificationTarget{
-			Type:     NotificationSlack,
-			Target:   "#monitoring",
-			Priority: NotificationNormal,
-			Enabled:  true,
-		})
-	}
-
-	return targets
-}
-
-func (tas *TopologyAlertingSystem) sendEmailNotification(email string, alert *TopologyAlert) error {
-	// Placeholder email notification
-	log.Printf("Sending email notification to %s for alert: %s", email, alert.Title)
-	return nil
-}
-
-func (tas *TopologyAlertingSystem) sendWebhookNotification(url string, alert *TopologyAlert) error {
-	// Placeholder webhook notification
-	log.Printf("Sending webhook notification to %s for alert: %s", url, alert.Title)
-	return nil
-}
-
-func (tas *TopologyAlertingSystem) sendSlackNotification(channel string, alert *TopologyAlert) error {
-	// Placeholder Slack notification
-	log.Printf("Sending Slack notification to %s for alert: %s", channel, alert.Title)
-	return nil
-}
-
-func (tas *TopologyAlertingSystem) sendMQTTNotification(topic string, alert *TopologyAlert) error {
-	// Placeholder MQTT notification
-	log.Printf("Sending MQTT notification to %s for alert: %s", topic, alert.Title)
-	return nil
-}
-
 func (tas *TopologyAlertingSystem) initiateEscalation(alert *TopologyAlert) {
 	if !tas.config.EscalationEnabled {
 		return
@@ -1401,7 +1595,10 @@ func (tas *TopologyAlertingSystem) executeEscalationStep(alertID string, escalat
 	alert, exists := tas.activeAlerts[alertID]
 	if exists {
 		for _, target := range step.NotificationTargets {
-			tas.sendNotification(target, alert)
+			if target.Enabled {
+				route := NotificationRoute{Name: fmt.Sprintf("escalation-%d", step.Level), Target: target}
+				go tas.notify(alert, []NotificationRoute{route})
+			}
 		}
 
 		alert.EscalationLevel = escalation.CurrentLevel
@@ -1449,34 +1646,6 @@ func (tas *TopologyAlertingSystem) createTicket(alert *TopologyAlert) {
 	log.Printf("Creating ticket for alert: %s", alert.Title)
 }
 
-func (tas *TopologyAlertingSystem) retryFailedNotifications() {
-	// Retry failed notifications
-	tas.mu.Lock()
-	defer tas.mu.Unlock()
-
-	for _, alert := range tas.activeAlerts {
-		for i, record := range alert.NotificationsSent {
-			if record.Status == NotificationFailed &&
-				time.Since(record.SentAt) > tas.config.NotificationRetryInterval {
-
-				// Retry notification
-				targets := tas.getNotificationTargets(alert)
-				for _, target := range targets {
-					if target.Target == record.Target && target.Type == record.Type {
-						err := tas.sendNotification(target, alert)
-						if err == nil {
-							alert.NotificationsSent[i].Status = NotificationSent
-							alert.NotificationsSent[i].SentAt = time.Now()
-							tas.stats.NotificationsSent++
-						}
-						break
-					}
-				}
-			}
-		}
-	}
-}
-
 func (tas *TopologyAlertingSystem) cleanupOldAlerts() {
 	now := time.Now()
 	cutoff := now.Add(-tas.config.AlertHistoryRetention)
@@ -1531,26 +1700,6 @@ func (tas *TopologyAlertingSystem) subscribeToTopologyUpdates() {
 	log.Printf("Subscribed to topology updates: %s", subscription.ID)
 }
 
-func (tas *TopologyAlertingSystem) findDuplicateAlert(
-	alertType TopologyAlertType,
-	deviceID string,
-	macAddress string,
-) *TopologyAlert {
-
-	cutoff := time.Now().Add(-tas.config.DuplicateTimeWindow)
-
-	for _, alert := range tas.activeAlerts {
-		if alert.Type == alertType &&
-			alert.DeviceID == deviceID &&
-			alert.MacAddress == macAddress &&
-			alert.LastOccurrence.After(cutoff) {
-			return alert
-		}
-	}
-
-	return nil
-}
-
 func (tas *TopologyAlertingSystem) isAlertSuppressed(
 	alertType TopologyAlertType,
 	deviceID string,
@@ -1767,19 +1916,104 @@ func (tas *TopologyAlertingSystem) buildDeviceContext(deviceID string) DeviceSta
 	}
 }
 
-func (tas *TopologyAlertingSystem) validateAlertRule(rule AlertRule) error {
+// validateAlertRule checks a rule, converts structured conditions to an
+// expression, compiles the expression and fills in defaults
+func validateAlertRule(rule *AlertRule) error {
 	if rule.ID == "" {
 		return fmt.Errorf("rule ID is required")
 	}
 	if rule.Name == "" {
 		return fmt.Errorf("rule name is required")
 	}
-	if len(rule.Conditions) == 0 {
-		return fmt.Errorf("at least one condition is required")
+	if rule.Expression == "" {
+		if len(rule.Conditions) == 0 {
+			return fmt.Errorf("an expression or at least one condition is required")
+		}
+		expression, err := conditionsToExpression(rule.Conditions, rule.ConditionLogic)
+		if err != nil {
+			return err
+		}
+		rule.Expression = expression
 	}
+
+	compiled, err := ParseRuleExpression(rule.Expression)
+	if err != nil {
+		return fmt.Errorf("expression %q: %w", rule.Expression, err)
+	}
+	rule.compiled = compiled
+
 	if rule.AlertType == "" {
-		return fmt.Errorf("alert type is required")
+		rule.AlertType = TopologyAlertType(rule.ID)
+	}
+	if rule.Severity == "" {
+		rule.Severity = SeverityWarning
+	} else if severityRank(rule.Severity) < 0 {
+		return fmt.Errorf("unknown severity %q", rule.Severity)
+	}
+	if rule.Cooldown < 0 || rule.AutoResolveDelay < 0 {
+		return fmt.Errorf("cooldown and auto resolve delay must not be negative")
 	}
 
 	return nil
 }
+
+// conditionsToExpression converts structured rule conditions on numeric
+// metrics to the equivalent expression
+func conditionsToExpression(conditions []RuleCondition, logic ConditionLogic) (string, error) {
+	operators := map[ComparisonOperator]string{
+		OperatorGreaterThan:              ">",
+		OperatorGreaterThanOrEqual:       ">=",
+		OperatorLessThan:                 "<",
+		OperatorLessThanOrEqual:          "<=",
+		ComparisonOperator("equals"):     "==",
+		ComparisonOperator("not_equals"): "!=",
+	}
+
+	var clauses []string
+	for _, condition := range conditions {
+		operator, ok := operators[condition.Operator]
+		if !ok {
+			return "", fmt.Errorf("condition on %s: unsupported operator %q", condition.Field, condition.Operator)
+		}
+
+		threshold := condition.Threshold
+		if condition.Value != nil {
+			switch v := condition.Value.(type) {
+			case float64:
+				threshold = v
+			case int:
+				threshold = float64(v)
+			default:
+				return "", fmt.Errorf("condition on %s: only numeric values are supported, use an expression", condition.Field)
+			}
+		}
+		value := strconv.FormatFloat(threshold, 'f', -1, 64)
+
+		var clause string
+		switch condition.AggregationFunction {
+		case "":
+			clause = fmt.Sprintf("%s %s %s", condition.Field, operator, value)
+			if condition.TimeWindow > 0 {
+				clause += fmt.Sprintf(" for %s", condition.TimeWindow)
+			}
+		case AggregationAverage, AggregationMin, AggregationMax, AggregationRate:
+			if condition.TimeWindow <= 0 {
+				return "", fmt.Errorf("condition on %s: %s needs a time window", condition.Field, condition.AggregationFunction)
+			}
+			function := string(condition.AggregationFunction)
+			if condition.AggregationFunction == AggregationAverage {
+				function = "avg"
+			}
+			clause = fmt.Sprintf("%s(%s, %s) %s %s", function, condition.Field, condition.TimeWindow, operator, value)
+		default:
+			return "", fmt.Errorf("condition on %s: unsupported aggregation %q", condition.Field, condition.AggregationFunction)
+		}
+		clauses = append(clauses, clause)
+	}
+
+	join := " and "
+	if logic == LogicOR {
+		join = " or "
+	}
+	return strings.Join(clauses, join), nil
+}
@@ -44,19 +44,34 @@ type Changeset struct {
 
 	// Metadata contains additional changeset information
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
+
+	// Rollout stages execution across devices (nil runs every command at once)
+	Rollout *RolloutStrategy `json:"rollout,omitempty"`
+
+	// RolloutState tracks a staged rollout while it runs
+	RolloutState *RolloutState `json:"rollout_state,omitempty"`
+
+	// RequiresApproval means the changeset must be approved before it runs
+	RequiresApproval bool `json:"requires_approval,omitempty"`
+
+	// Approval records the latest approval request and decision
+	Approval *ChangesetApproval `json:"approval,omitempty"`
 }
 
 // ChangesetStatus represents the status of a changeset
 type ChangesetStatus string
 
 const (
-	ChangesetStatusDraft          ChangesetStatus = "draft"           // Created but not executed
-	ChangesetStatusPending        ChangesetStatus = "pending"         // Waiting to be executed
-	ChangesetStatusExecuting      ChangesetStatus = "executing"       // Currently being executed
-	ChangesetStatusCompleted      ChangesetStatus = "completed"       // Successfully executed
-	ChangesetStatusFailed         ChangesetStatus = "failed"          // Execution failed
-	ChangesetStatusRolledBack     ChangesetStatus = "rolled_back"     // Successfully rolled back
-	ChangesetStatusRollbackFailed ChangesetStatus = "rollback_failed" // Rollback failed
+	ChangesetStatusDraft           ChangesetStatus = "draft"            // Created but not executed
+	ChangesetStatusPendingApproval ChangesetStatus = "pending_approval" // Submitted, waiting for an approver
+	ChangesetStatusApproved        ChangesetStatus = "approved"         // Approved and ready to execute
+	ChangesetStatusPending         ChangesetStatus = "pending"          // Waiting to be executed
+	ChangesetStatusExecuting       ChangesetStatus = "executing"        // Currently being executed
+	ChangesetStatusPaused          ChangesetStatus = "paused"           // Rollout paused between batches
+	ChangesetStatusCompleted       ChangesetStatus = "completed"        // Successfully executed
+	ChangesetStatusFailed          ChangesetStatus = "failed"           // Execution failed
+	ChangesetStatusRolledBack      ChangesetStatus = "rolled_back"      // Successfully rolled back
+	ChangesetStatusRollbackFailed  ChangesetStatus = "rollback_failed"  // Rollback failed
 )
 
 // CommandResult represents the result of executing a command within a changeset
@@ -78,8 +93,23 @@ type CommandResult struct {
 
 	// Duration is how long the command took to execute
 	Duration time.Duration `json:"duration"`
+
+	// Phase is "execute" or "rollback"
+	Phase string `json:"phase,omitempty"`
+
+	// DeviceCommandID is the ID the command manager assigned when sending
+	DeviceCommandID string `json:"device_command_id,omitempty"`
+
+	// Status is the final command status (completed, failed, timeout, ...)
+	Status string `json:"status,omitempty"`
 }
 
+// Changeset result phases
+const (
+	ResultPhaseExecute  = "execute"
+	ResultPhaseRollback = "rollback"
+)
+
 // ChangesetOptions contains options for creating a changeset
 type ChangesetOptions struct {
 	Description string
@@ -87,6 +117,151 @@ type ChangesetOptions struct {
 	SessionID   string
 	TraceID     string
 	Metadata    map[string]interface{}
+	Rollout     *RolloutStrategy
+
+	// RequireApproval forces the approval step even when the manager's
+	// policy would not require it
+	RequireApproval bool
+}
+
+// ChangesetApproval is the approval request and decision of a changeset
+type ChangesetApproval struct {
+	RequestedBy string     `json:"requested_by"`
+	RequestedAt time.Time  `json:"requested_at"`
+	Approver    string     `json:"approver,omitempty"`
+	Approved    bool       `json:"approved"`
+	Comment     string     `json:"comment,omitempty"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+}
+
+// ChangesetDiff is the dry-run view of what a changeset would change
+type ChangesetDiff struct {
+	ChangesetID string        `json:"changeset_id"`
+	Devices     []*DeviceDiff `json:"devices"`
+	GeneratedAt time.Time     `json:"generated_at"`
+}
+
+// DeviceDiff lists the changes a changeset would make on one device,
+// compared with its last known attributes and state
+type DeviceDiff struct {
+	DeviceKey string `json:"device_key"`
+
+	// Known is false when no state has been recorded for the device
+	Known    bool        `json:"known"`
+	Online   bool        `json:"online"`
+	LastSeen int64       `json:"last_seen,omitempty"`
+	Changes  []FieldDiff `json:"changes"`
+}
+
+// FieldDiff is the before/after value of one configuration field
+type FieldDiff struct {
+	Field     string      `json:"field"`
+	Before    interface{} `json:"before"`
+	After     interface{} `json:"after"`
+	Known     bool        `json:"known"` // Before was found in attr/state
+	Changed   bool        `json:"changed"`
+	CommandID string      `json:"command_id"`
+	Operation string      `json:"operation"`
+}
+
+// RolloutStrategy executes a changeset in batches of devices: a canary
+// batch first, then fixed-size batches, each followed by a pause and a
+// health gate.
+type RolloutStrategy struct {
+	// CanarySize is the number of devices in the first batch
+	CanarySize int `json:"canary_size"`
+
+	// BatchSize is the number of devices per later batch (0 for all remaining)
+	BatchSize int `json:"batch_size"`
+
+	// Pause is how long to observe the devices after each batch
+	Pause time.Duration `json:"pause"`
+
+	// HealthGate is checked after each pause; nil skips the check
+	HealthGate *HealthGate `json:"health_gate,omitempty"`
+}
+
+// HealthGate defines when devices touched by a rollout count as degraded
+type HealthGate struct {
+	// RequireOnline fails the gate for devices that are offline or critical
+	RequireOnline bool `json:"require_online"`
+
+	// MinQualityScore is the lowest connection quality score (0-1) allowed; 0 disables
+	MinQualityScore float64 `json:"min_quality_score,omitempty"`
+
+	// CheckAlerts fails the gate when more than MaxNewAlerts quality alerts
+	// were raised for the devices since the rollout started
+	CheckAlerts  bool `json:"check_alerts"`
+	MaxNewAlerts int  `json:"max_new_alerts,omitempty"`
+}
+
+// RolloutState is the progress of a staged rollout
+type RolloutState struct {
+	// Batches holds the device keys (tenant:site:device) of each batch
+	Batches [][]string `json:"batches"`
+
+	// CurrentBatch is the index of the batch running or about to run
+	CurrentBatch int `json:"current_batch"`
+
+	// Paused and Aborted are set by the rollout controls
+	Paused  bool `json:"paused"`
+	Aborted bool `json:"aborted"`
+
+	// HaltReason explains why the rollout stopped early
+	HaltReason string `json:"halt_reason,omitempty"`
+}
+
+// ChangesetSchedule starts a changeset at a given time. A "once" schedule
+// fires at RunAt; a "cron" schedule fires at each match of Cron until the
+// changeset has run.
+type ChangesetSchedule struct {
+	ID          string     `json:"id"`
+	ChangesetID string     `json:"changeset_id"`
+	Type        string     `json:"type"` // once, cron
+	RunAt       *time.Time `json:"run_at,omitempty"`
+	Cron        string     `json:"cron,omitempty"`
+	Timezone    string     `json:"timezone,omitempty"` // IANA name, empty for local time
+
+	// Force runs the changeset even outside its sites' maintenance windows
+	Force bool `json:"force"`
+
+	Status     ScheduleStatus `json:"status"`
+	NextRun    *time.Time     `json:"next_run,omitempty"`
+	LastRun    *time.Time     `json:"last_run,omitempty"`
+	LastResult string         `json:"last_result,omitempty"`
+	CreatedBy  string         `json:"created_by,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// Changeset schedule types
+const (
+	ScheduleTypeOnce = "once"
+	ScheduleTypeCron = "cron"
+)
+
+// ScheduleStatus represents the status of a changeset schedule
+type ScheduleStatus string
+
+const (
+	ScheduleStatusScheduled ScheduleStatus = "scheduled" // Waiting for its next run
+	ScheduleStatusRunning   ScheduleStatus = "running"   // Changeset is executing
+	ScheduleStatusCompleted ScheduleStatus = "completed" // Changeset executed successfully
+	ScheduleStatusFailed    ScheduleStatus = "failed"    // Changeset could not run or failed
+	ScheduleStatusCancelled ScheduleStatus = "cancelled" // Removed before it ran
+)
+
+// MaintenanceWindow is a recurring period in which changesets may run on
+// the devices of a site. The window opens at each match of Cron and stays
+// open for Duration.
+type MaintenanceWindow struct {
+	ID          string        `json:"id"`
+	Tenant      string        `json:"tenant"`
+	Site        string        `json:"site"`
+	Cron        string        `json:"cron"`
+	Duration    time.Duration `json:"duration"`
+	Timezone    string        `json:"timezone,omitempty"` // IANA name, empty for local time
+	Description string        `json:"description,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
 }
 
 // ChangesetSummary provides a summary view of a changeset
@@ -129,8 +304,11 @@ func (c *Changeset) GetSummary() *ChangesetSummary {
 		SessionID:    c.SessionID,
 	}
 
-	// Count successful and failed results
+	// Count successful and failed results of the changeset's own commands
 	for _, result := range c.Results {
+		if result.Phase == ResultPhaseRollback {
+			continue
+		}
 		if result.Success {
 			summary.SuccessCount++
 		} else {
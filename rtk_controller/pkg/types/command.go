@@ -20,6 +20,8 @@ const (
 // Command represents a command sent to a device
 type Command struct {
 	ID          string                 `json:"id"`
+	Tenant      string                 `json:"tenant,omitempty"`
+	Site        string                 `json:"site,omitempty"`
 	DeviceID    string                 `json:"device_id"`
 	Operation   string                 `json:"operation"`
 	Args        map[string]interface{} `json:"args"`
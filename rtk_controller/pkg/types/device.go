@@ -20,12 +20,27 @@ type DeviceState struct {
 	Online     bool                   `json:"online"`
 	LastWill   *LastWillMessage       `json:"last_will,omitempty"`
 
+	// Highest schema version the device supports per schema name, from its attr message
+	SchemaVersions map[string]string `json:"schema_versions,omitempty"`
+
 	// Network topology related fields
 	NetworkInfo *NetworkDeviceInfo `json:"network_info,omitempty"` // 網路拓撲資訊
 
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// SiteInfo describes a tenant site in the device registry
+type SiteInfo struct {
+	Tenant    string    `json:"tenant"`
+	Site      string    `json:"site"`
+	Name      string    `json:"name,omitempty"` // display name, e.g. "Smith home"
+	CreatedAt time.Time `json:"created_at"`
+
+	// Device counts, filled in by ListSites
+	Devices       int `json:"devices"`
+	OnlineDevices int `json:"online_devices"`
+}
+
 // NetworkDeviceInfo represents network topology information for a device
 type NetworkDeviceInfo struct {
 	PrimaryMAC   string           `json:"primary_mac,omitempty"`
@@ -70,12 +85,25 @@ type DeviceCommand struct {
 	Operation   string                 `json:"operation"`
 	Args        map[string]interface{} `json:"args"`
 	TimeoutMS   int64                  `json:"timeout_ms"`
-	Status      string                 `json:"status"` // pending, sent, ack, completed, failed, timeout
+	Status      string                 `json:"status"` // pending, queued, sent, ack, cancelling, completed, failed, timeout, cancelled
 	Result      map[string]interface{} `json:"result,omitempty"`
 	Error       string                 `json:"error,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 	SentAt      *time.Time             `json:"sent_at,omitempty"`
 	CompletedAt *time.Time             `json:"completed_at,omitempty"`
+
+	// Delivery
+	Priority      int        `json:"priority,omitempty"`        // higher is delivered first
+	Attempts      int        `json:"attempts,omitempty"`        // publish attempts so far
+	MaxAttempts   int        `json:"max_attempts,omitempty"`    // 0 or 1 disables retries
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"` // set while waiting for a retry
+
+	// Progress reported by the device on cmd/progress
+	Progress   map[string]interface{} `json:"progress,omitempty"`
+	ProgressAt *time.Time             `json:"progress_at,omitempty"`
+
+	// CancelRequestID is the cancel_command request sent for this command
+	CancelRequestID string `json:"cancel_request_id,omitempty"`
 }
 
 // DeviceFilter represents filtering criteria for devices
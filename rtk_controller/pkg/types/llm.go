@@ -26,6 +26,13 @@ type LLMTool interface {
 	Description() string
 }
 
+// SiteScopedTool is implemented by tools that act on the tenant site named
+// by their optional "tenant" and "site" parameters
+type SiteScopedTool interface {
+	// SiteScoped reports whether the tool honours the tenant/site parameters
+	SiteScoped() bool
+}
+
 // ToolCategory represents the type of diagnostic tool
 type ToolCategory string
 
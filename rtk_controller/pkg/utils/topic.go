@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"regexp"
 	"strings"
 )
@@ -33,7 +34,12 @@ func mqttToRegex(pattern string) string {
 
 	// Replace escaped MQTT wildcards with regex equivalents
 	escaped = strings.ReplaceAll(escaped, `\+`, `[^/]+`) // + matches single level
-	escaped = strings.ReplaceAll(escaped, `\#`, `.*`)    // # matches multi-level
+
+	// # matches the remaining levels, including none: a/# matches a, a/ and
+	// a/b/c. QuoteMeta leaves # unescaped.
+	if strings.HasSuffix(escaped, "/#") {
+		escaped = strings.TrimSuffix(escaped, "/#") + "(/.*)?"
+	}
 
 	// Anchor the pattern
 	return "^" + escaped + "$"
@@ -129,6 +135,18 @@ func IsValidTopic(topic string) bool {
 	return true
 }
 
+// ValidateTopicLevel checks that a tenant, site or device ID can be used as a
+// single topic level and as part of a "tenant:site:device_id" key
+func ValidateTopicLevel(kind, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s must not be empty", kind)
+	}
+	if strings.ContainsAny(value, "/:+#") {
+		return fmt.Errorf("invalid %s %q: must not contain '/', ':', '+' or '#'", kind, value)
+	}
+	return nil
+}
+
 // BuildTopic builds an RTK topic from components
 func BuildTopic(tenant, site, deviceID, messageType string, subParts ...string) string {
 	parts := []string{"rtk", "v1", tenant, site, deviceID, messageType}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		// Exact topics
+		{"rtk/v1/acme/hq/dev1/state", "rtk/v1/acme/hq/dev1/state", true},
+		{"rtk/v1/acme/hq/dev1/state", "rtk/v1/acme/hq/dev2/state", false},
+
+		// Single-level wildcard
+		{"rtk/v1/+/+/+/state", "rtk/v1/acme/hq/dev1/state", true},
+		{"rtk/v1/+/+/+/state", "rtk/v1/acme/hq/dev1/telemetry/cpu", false},
+		{"rtk/v1/+/+/+/cmd/ack", "rtk/v1/acme/hq/dev1/cmd/ack", true},
+		{"rtk/v1/+/state", "rtk/v1/acme/hq/state", false},
+
+		// Multi-level wildcard
+		{"#", "rtk/v1/acme/hq/dev1/state", true},
+		{"rtk/v1/#", "rtk/v1/acme/hq/dev1/state", true},
+		{"rtk/v1/#", "rtk/v1", true},
+		{"rtk/v1/#", "rtk/v2/acme", false},
+		{"rtk/v1/#", "rtk/v10/acme", false},
+		{"rtk/v1/+/+/+/telemetry/#", "rtk/v1/acme/hq/dev1/telemetry/cpu", true},
+		{"rtk/v1/+/+/+/telemetry/#", "rtk/v1/acme/hq/dev1/telemetry", true},
+		{"rtk/v1/+/+/+/telemetry/#", "rtk/v1/acme/hq/dev1/state", false},
+		{"$SYS/#", "$SYS/broker/clients", true},
+
+		// Regex metacharacters in patterns are literal
+		{"rtk/v1/a.b/+/dev1/state", "rtk/v1/a.b/hq/dev1/state", true},
+		{"rtk/v1/a.b/+/dev1/state", "rtk/v1/axb/hq/dev1/state", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, TopicMatches(tt.pattern, tt.topic), "TopicMatches(%q, %q)", tt.pattern, tt.topic)
+	}
+}
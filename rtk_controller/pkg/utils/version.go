@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SplitSchemaField splits a payload schema field such as "state/1.1" or
+// "evt.wifi.roam_miss/1.0" into its name and version. The version is empty
+// when the field carries none.
+func SplitSchemaField(field string) (name, version string) {
+	name, version, _ = strings.Cut(field, "/")
+	return name, version
+}
+
+// ParseSchemaVersion parses a semantic version ("1", "1.1", "1.1.0", with an
+// optional "v" prefix) into major, minor and patch numbers
+func ParseSchemaVersion(version string) ([3]int, error) {
+	var parsed [3]int
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if version == "" || len(parts) > 3 {
+		return parsed, fmt.Errorf("invalid schema version %q", version)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, fmt.Errorf("invalid schema version %q", version)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+// NormalizeSchemaVersion returns the canonical "major.minor.patch" form of a
+// version, so that "1.1" and "1.1.0" name the same version
+func NormalizeSchemaVersion(version string) (string, error) {
+	parsed, err := ParseSchemaVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d.%d", parsed[0], parsed[1], parsed[2]), nil
+}
+
+// CompareSchemaVersions returns -1, 0 or 1 as version a is lower than, equal
+// to or higher than version b
+func CompareSchemaVersions(a, b string) (int, error) {
+	va, err := ParseSchemaVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := ParseSchemaVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va {
+		if va[i] != vb[i] {
+			if va[i] < vb[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
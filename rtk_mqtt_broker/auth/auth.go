@@ -1,36 +1,245 @@
 package auth
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
 	"rtk_mqtt_broker/config"
 )
 
+// Built-in roles understood by the ACL engine
+const (
+	RoleDevice     = "device"
+	RoleController = "controller"
+	RoleAdmin      = "admin"
+)
+
+// Access is the permission granted by an ACL rule
+type Access byte
+
+const (
+	AccessDeny Access = iota
+	AccessRead
+	AccessWrite
+	AccessReadWrite
+)
+
+// ParseAccess converts the access string used in the YAML config
+func ParseAccess(s string) (Access, error) {
+	switch strings.ToLower(s) {
+	case "deny", "none":
+		return AccessDeny, nil
+	case "read", "subscribe":
+		return AccessRead, nil
+	case "write", "publish":
+		return AccessWrite, nil
+	case "readwrite", "rw", "all":
+		return AccessReadWrite, nil
+	default:
+		return AccessDeny, fmt.Errorf("unknown access %q", s)
+	}
+}
+
+func (a Access) allows(write bool) bool {
+	if write {
+		return a == AccessWrite || a == AccessReadWrite
+	}
+	return a == AccessRead || a == AccessReadWrite
+}
+
+// ACLRule grants access to every topic matched by Filter
+type ACLRule struct {
+	Filter string
+	Access Access
+}
+
+// User is a configured broker account
+type User struct {
+	Username     string
+	Role         string
+	DeviceID     string
+	password     string
+	passwordHash []byte
+	acl          []ACLRule
+}
+
 type AuthManager struct {
-	users map[string]string
+	enabled bool
+	users   map[string]*User
 }
 
-func NewAuthManager(config *config.Config) *AuthManager {
-	users := make(map[string]string)
-	
-	for _, user := range config.Security.Users {
-		if username, ok := user["username"]; ok {
-			if password, ok := user["password"]; ok {
-				users[username] = password
+func NewAuthManager(config *config.Config) (*AuthManager, error) {
+	users := make(map[string]*User)
+
+	for _, uc := range config.Security.Users {
+		if uc.Username == "" {
+			return nil, fmt.Errorf("user entry without username")
+		}
+		if uc.Password == "" && uc.PasswordHash == "" {
+			return nil, fmt.Errorf("user %s: password or password_hash is required", uc.Username)
+		}
+		if _, exists := users[uc.Username]; exists {
+			return nil, fmt.Errorf("user %s: defined more than once", uc.Username)
+		}
+
+		user := &User{
+			Username: uc.Username,
+			Role:     strings.ToLower(uc.Role),
+			DeviceID: uc.DeviceID,
+			password: uc.Password,
+		}
+		if user.Role == "" {
+			user.Role = RoleDevice
+		}
+		if user.DeviceID == "" {
+			user.DeviceID = uc.Username
+		}
+		if uc.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(uc.PasswordHash)); err != nil {
+				return nil, fmt.Errorf("user %s: invalid bcrypt password_hash: %w", uc.Username, err)
+			}
+			user.passwordHash = []byte(uc.PasswordHash)
+		}
+
+		switch user.Role {
+		case RoleDevice, RoleController, RoleAdmin:
+		default:
+			return nil, fmt.Errorf("user %s: unknown role %q", uc.Username, uc.Role)
+		}
+		// device_ids starting with "_" are reserved for controller and
+		// broker topics, which devices must not publish to
+		if user.Role == RoleDevice && strings.HasPrefix(user.DeviceID, "_") {
+			return nil, fmt.Errorf("user %s: device_id %q is reserved", uc.Username, user.DeviceID)
+		}
+
+		for _, rc := range uc.ACL {
+			access, err := ParseAccess(rc.Access)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: %w", uc.Username, err)
+			}
+			if rc.Topic == "" {
+				return nil, fmt.Errorf("user %s: acl rule without topic", uc.Username)
 			}
+			user.acl = append(user.acl, ACLRule{Filter: rc.Topic, Access: access})
 		}
+		user.acl = append(user.acl, roleRules(user.Role)...)
+
+		users[uc.Username] = user
 	}
 
 	return &AuthManager{
-		users: users,
+		enabled: config.Security.EnableAuth,
+		users:   users,
+	}, nil
+}
+
+// roleRules returns the default rules appended after a user's own ACL. Rules
+// are evaluated in order and the first matching filter decides.
+func roleRules(role string) []ACLRule {
+	switch role {
+	case RoleAdmin:
+		return []ACLRule{{Filter: "#", Access: AccessReadWrite}}
+	case RoleController:
+		return []ACLRule{
+			{Filter: "rtk/v1/#", Access: AccessReadWrite},
+		}
+	default:
+		// Devices receive commands addressed to them and may publish
+		// everything else under their own device_id.
+		return []ACLRule{
+			{Filter: "rtk/v1/+/+/{device_id}/cmd/req", Access: AccessRead},
+			{Filter: "rtk/v1/+/+/{device_id}/#", Access: AccessWrite},
+			{Filter: "rtk/v1/+/+/group/+/cmd/req", Access: AccessRead},
+			{Filter: "rtk/v1/+/broadcast/cmd/req", Access: AccessRead},
+			{Filter: "rtk/v1/broadcast/cmd/req", Access: AccessRead},
+		}
 	}
 }
 
 func (a *AuthManager) Authenticate(username, password string) bool {
-	if storedPassword, exists := a.users[username]; exists {
-		return storedPassword == password
+	user, exists := a.users[username]
+	if !exists {
+		return false
+	}
+	if user.passwordHash != nil {
+		return bcrypt.CompareHashAndPassword(user.passwordHash, []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(user.password), []byte(password)) == 1
+}
+
+// Authorize reports whether username may publish (write) or subscribe to the
+// given topic or topic filter.
+func (a *AuthManager) Authorize(username, topic string, write bool) bool {
+	user, exists := a.users[username]
+	if !exists {
+		return false
+	}
+
+	for _, rule := range user.acl {
+		filter := expandPlaceholders(rule.Filter, user)
+		if FilterCovers(filter, topic) {
+			return rule.Access.allows(write)
+		}
 	}
 	return false
 }
 
+// User returns the configured account for username, if any
+func (a *AuthManager) User(username string) (*User, bool) {
+	user, exists := a.users[username]
+	return user, exists
+}
+
 func (a *AuthManager) IsEnabled() bool {
-	return len(a.users) > 0
-}
\ No newline at end of file
+	return a.enabled
+}
+
+// HashPassword returns a bcrypt hash suitable for the password_hash field
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func expandPlaceholders(filter string, user *User) string {
+	if !strings.Contains(filter, "{") {
+		return filter
+	}
+	return strings.NewReplacer(
+		"{username}", user.Username,
+		"{device_id}", user.DeviceID,
+	).Replace(filter)
+}
+
+// FilterCovers reports whether every topic matched by sub (a topic name or a
+// subscription filter) is also matched by the rule filter.
+func FilterCovers(filter, sub string) bool {
+	rule := strings.Split(filter, "/")
+	target := strings.Split(sub, "/")
+
+	for i, r := range rule {
+		if r == "#" {
+			return true
+		}
+		if i >= len(target) {
+			return false
+		}
+		t := target[i]
+		if t == "#" {
+			return false
+		}
+		if r == "+" {
+			continue
+		}
+		if r != t {
+			return false
+		}
+	}
+
+	return len(rule) == len(target)
+}
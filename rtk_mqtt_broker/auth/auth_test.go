@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"testing"
+
+	"rtk_mqtt_broker/config"
+)
+
+func TestFilterCovers(t *testing.T) {
+	tests := []struct {
+		filter string
+		sub    string
+		want   bool
+	}{
+		// Exact topics
+		{"rtk/v1/a/b/dev1/state", "rtk/v1/a/b/dev1/state", true},
+		{"rtk/v1/a/b/dev1/state", "rtk/v1/a/b/dev2/state", false},
+		{"rtk/v1/a/b/dev1/state", "rtk/v1/a/b/dev1", false},
+		{"rtk/v1/a/b/dev1", "rtk/v1/a/b/dev1/state", false},
+
+		// Single-level wildcard
+		{"rtk/v1/+/+/dev1/state", "rtk/v1/a/b/dev1/state", true},
+		{"rtk/v1/+/+/dev1/state", "rtk/v1/a/dev1/state", false},
+		{"rtk/v1/+/+/dev1/state", "rtk/v1/+/b/dev1/state", true},
+		{"rtk/v1/a/+/dev1/state", "rtk/v1/+/b/dev1/state", false},
+		{"+", "", true},
+		{"+/+", "a", false},
+
+		// Multi-level wildcard
+		{"#", "anything/at/all", true},
+		{"#", "#", true},
+		{"rtk/v1/#", "rtk/v1", true},
+		{"rtk/v1/#", "rtk/v1/a/b/c", true},
+		{"rtk/v1/#", "rtk/v1/#", true},
+		{"rtk/v1/#", "rtk/v1/+/+/dev1/#", true},
+		{"rtk/v1/#", "rtk/v2/a", false},
+		{"rtk/v1/+/+/dev1/#", "rtk/v1/a/b/dev1/telemetry/cpu", true},
+		{"rtk/v1/+/+/dev1/#", "rtk/v1/a/b/dev2/telemetry/cpu", false},
+
+		// A wildcard subscription is only covered by a filter at least as wide
+		{"rtk/v1/a/b/dev1/state", "rtk/v1/a/b/dev1/#", false},
+		{"rtk/v1/a/b/dev1/+", "rtk/v1/a/b/dev1/#", false},
+		{"rtk/v1/a/b/dev1/state", "rtk/v1/a/b/+/state", false},
+		{"rtk/v1/a/b/+/state", "rtk/v1/a/b/+/state", true},
+	}
+
+	for _, tt := range tests {
+		if got := FilterCovers(tt.filter, tt.sub); got != tt.want {
+			t.Errorf("FilterCovers(%q, %q) = %v, want %v", tt.filter, tt.sub, got, tt.want)
+		}
+	}
+}
+
+func newTestAuthManager(t *testing.T, users ...config.UserConfig) *AuthManager {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Security.EnableAuth = true
+	cfg.Security.Users = users
+
+	manager, err := NewAuthManager(cfg)
+	if err != nil {
+		t.Fatalf("NewAuthManager: %v", err)
+	}
+	return manager
+}
+
+func TestAuthorizeRoleRules(t *testing.T) {
+	manager := newTestAuthManager(t,
+		config.UserConfig{Username: "dev1", Password: "secret"},
+		config.UserConfig{Username: "ctrl", Password: "secret", Role: RoleController},
+		config.UserConfig{Username: "root", Password: "secret", Role: RoleAdmin},
+		config.UserConfig{Username: "sensor", Password: "secret", DeviceID: "aabbcc000001", ACL: []config.ACLRuleConfig{
+			{Topic: "rtk/v1/+/+/{device_id}/attr", Access: "deny"},
+			{Topic: "shared/{username}/#", Access: "readwrite"},
+		}},
+	)
+
+	tests := []struct {
+		user  string
+		topic string
+		write bool
+		want  bool
+	}{
+		// Devices publish under their own device_id only
+		{"dev1", "rtk/v1/acme/hq/dev1/state", true, true},
+		{"dev1", "rtk/v1/acme/hq/dev1/telemetry/cpu", true, true},
+		{"dev1", "rtk/v1/acme/hq/dev2/state", true, false},
+		{"dev1", "rtk/v1/acme/hq/dev1/#", false, false},
+		{"dev1", "rtk/v1/acme/hq/+/state", false, false},
+
+		// Devices receive commands addressed to them but cannot send them
+		{"dev1", "rtk/v1/acme/hq/dev1/cmd/req", false, true},
+		{"dev1", "rtk/v1/acme/hq/dev1/cmd/req", true, false},
+		{"dev1", "rtk/v1/acme/hq/dev2/cmd/req", false, false},
+		{"dev1", "rtk/v1/acme/hq/group/floor1/cmd/req", false, true},
+		{"dev1", "rtk/v1/acme/broadcast/cmd/req", false, true},
+		{"dev1", "rtk/v1/broadcast/cmd/req", false, true},
+		{"dev1", "rtk/v1/broadcast/cmd/req", true, false},
+
+		// Controllers own the RTK tree and nothing else
+		{"ctrl", "rtk/v1/#", false, true},
+		{"ctrl", "rtk/v1/acme/hq/dev1/cmd/req", true, true},
+		{"ctrl", "#", false, false},
+		{"ctrl", "$SYS/broker/clients", false, false},
+
+		// Admins may do anything
+		{"root", "#", false, true},
+		{"root", "other/topic", true, true},
+
+		// User rules come before the role rules and the first match wins
+		{"sensor", "rtk/v1/acme/hq/aabbcc000001/attr", true, false},
+		{"sensor", "rtk/v1/acme/hq/aabbcc000001/state", true, true},
+		{"sensor", "shared/sensor/x", false, true},
+		{"sensor", "shared/other/x", false, false},
+
+		// Unknown users have no access
+		{"nobody", "rtk/v1/acme/hq/nobody/state", true, false},
+	}
+
+	for _, tt := range tests {
+		if got := manager.Authorize(tt.user, tt.topic, tt.write); got != tt.want {
+			t.Errorf("Authorize(%q, %q, write=%v) = %v, want %v", tt.user, tt.topic, tt.write, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	hash, err := HashPassword("hashed-secret")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	manager := newTestAuthManager(t,
+		config.UserConfig{Username: "plain", Password: "secret"},
+		config.UserConfig{Username: "hashed", PasswordHash: hash},
+	)
+
+	tests := []struct {
+		user     string
+		password string
+		want     bool
+	}{
+		{"plain", "secret", true},
+		{"plain", "Secret", false},
+		{"plain", "secret ", false},
+		{"plain", "", false},
+		{"hashed", "hashed-secret", true},
+		{"hashed", hash, false},
+		{"hashed", "", false},
+		{"nobody", "secret", false},
+	}
+
+	for _, tt := range tests {
+		if got := manager.Authenticate(tt.user, tt.password); got != tt.want {
+			t.Errorf("Authenticate(%q, %q) = %v, want %v", tt.user, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestReservedDeviceID(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.Users = []config.UserConfig{{Username: "_controller", Password: "secret"}}
+	if _, err := NewAuthManager(cfg); err == nil {
+		t.Error("device account with a reserved device_id was accepted")
+	}
+
+	cfg.Security.Users = []config.UserConfig{{Username: "dev1", Password: "secret", DeviceID: "_controller"}}
+	if _, err := NewAuthManager(cfg); err == nil {
+		t.Error("device account with a reserved device_id was accepted")
+	}
+
+	manager := newTestAuthManager(t, config.UserConfig{Username: "ctrl", Password: "secret", Role: RoleController})
+	if !manager.Authorize("ctrl", "rtk/v1/acme/hq/_controller/evt/audit", true) {
+		t.Error("controller may not publish to reserved topics")
+	}
+}
@@ -0,0 +1,430 @@
+package bridge
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"rtk_mqtt_broker/config"
+	"rtk_mqtt_broker/logger"
+)
+
+// inlineSubscriptionBase offsets the inline subscription IDs used for out rules
+const inlineSubscriptionBase = 1000
+
+// publishTimeout bounds the wait for the upstream broker to acknowledge a
+// QoS>0 publish before it is retried
+const publishTimeout = 10 * time.Second
+
+// Stats counts bridged messages
+type Stats struct {
+	Connected bool
+	Forwarded int64 // local -> remote
+	Relayed   int64 // remote -> local
+	Buffered  int64 // waiting for the uplink
+	Dropped   int64 // buffer overflow
+}
+
+type outMessage struct {
+	seq     uint64
+	topic   string
+	payload []byte
+	qos     byte
+	retain  bool
+}
+
+// Bridge forwards messages between the embedded broker and an upstream
+// broker, buffering outgoing messages while the uplink is down.
+type Bridge struct {
+	cfg    config.BridgeConfig
+	server *mqtt.Server
+	logger *logger.Logger
+	client paho.Client
+
+	mu      sync.Mutex
+	buffer  []outMessage
+	nextSeq uint64
+	sending bool // buffer[0] is being published
+
+	connected atomic.Bool
+	notify    chan struct{}
+	lost      chan struct{}
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+
+	forwarded int64
+	relayed   int64
+	dropped   int64
+}
+
+func New(cfg config.BridgeConfig, server *mqtt.Server, logger *logger.Logger) (*Bridge, error) {
+	b := &Bridge{
+		cfg:    cfg,
+		server: server,
+		logger: logger,
+		notify: make(chan struct{}, 1),
+		lost:   make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+	}
+
+	opts, err := b.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	b.client = paho.NewClient(opts)
+
+	return b, nil
+}
+
+func (b *Bridge) clientOptions() (*paho.ClientOptions, error) {
+	remote := b.cfg.Remote
+
+	clientID := remote.ClientID
+	if clientID == "" {
+		host, _ := os.Hostname()
+		clientID = "rtk-bridge-" + host
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(remote.URL).
+		SetClientID(clientID).
+		SetCleanSession(remote.CleanSession).
+		SetAutoReconnect(false).
+		SetConnectTimeout(10 * time.Second).
+		SetOrderMatters(false).
+		SetConnectionLostHandler(b.onConnectionLost)
+
+	if remote.KeepAlive > 0 {
+		opts.SetKeepAlive(time.Duration(remote.KeepAlive) * time.Second)
+	}
+	if remote.Username != "" {
+		opts.SetUsername(remote.Username)
+		opts.SetPassword(remote.Password)
+	}
+
+	if remote.CAFile != "" || remote.CertFile != "" || remote.InsecureSkipVerify {
+		tlsConfig := &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: remote.InsecureSkipVerify,
+		}
+		if remote.CAFile != "" {
+			caPEM, err := os.ReadFile(remote.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("bridge: failed to read CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("bridge: no certificates found in %s", remote.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if remote.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(remote.CertFile, remote.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("bridge: failed to load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	return opts, nil
+}
+
+// Start subscribes the out rules on the local broker and starts the uplink
+// connection and forwarding workers.
+func (b *Bridge) Start() error {
+	for i, rule := range b.cfg.Rules {
+		if rule.Direction != config.BridgeOut {
+			continue
+		}
+		rule := rule
+		err := b.server.Subscribe(rule.Topic, inlineSubscriptionBase+i, func(cl *mqtt.Client, sub packets.Subscription, pk packets.Packet) {
+			b.onLocalMessage(rule, cl, pk)
+		})
+		if err != nil {
+			return fmt.Errorf("bridge: failed to subscribe %s locally: %w", rule.Topic, err)
+		}
+	}
+
+	b.wg.Add(2)
+	go b.connectLoop()
+	go b.forwardLoop()
+
+	b.logger.Info(fmt.Sprintf("Bridge to %s started with %d rules", b.cfg.Remote.URL, len(b.cfg.Rules)))
+	return nil
+}
+
+// Stop disconnects from the upstream broker and stops the workers.
+func (b *Bridge) Stop() {
+	for i, rule := range b.cfg.Rules {
+		if rule.Direction == config.BridgeOut {
+			_ = b.server.Unsubscribe(rule.Topic, inlineSubscriptionBase+i)
+		}
+	}
+
+	close(b.stopCh)
+	b.wg.Wait()
+
+	if b.client.IsConnected() {
+		b.client.Disconnect(250)
+	}
+	if n := b.bufferLen(); n > 0 {
+		b.logger.Warn(fmt.Sprintf("Bridge stopped with %d undelivered messages", n))
+	}
+}
+
+// Stats returns a snapshot of the bridge counters
+func (b *Bridge) Stats() Stats {
+	return Stats{
+		Connected: b.connected.Load(),
+		Forwarded: atomic.LoadInt64(&b.forwarded),
+		Relayed:   atomic.LoadInt64(&b.relayed),
+		Buffered:  int64(b.bufferLen()),
+		Dropped:   atomic.LoadInt64(&b.dropped),
+	}
+}
+
+func (b *Bridge) connectLoop() {
+	defer b.wg.Done()
+
+	minBackoff := time.Duration(b.cfg.MinBackoff) * time.Second
+	if minBackoff <= 0 {
+		minBackoff = time.Second
+	}
+	maxBackoff := time.Duration(b.cfg.MaxBackoff) * time.Second
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+	backoff := minBackoff
+
+	for {
+		token := b.client.Connect()
+		token.Wait()
+
+		if err := token.Error(); err != nil {
+			b.logger.Warn(fmt.Sprintf("Bridge connect to %s failed: %v (retry in %s)", b.cfg.Remote.URL, err, backoff))
+			select {
+			case <-b.stopCh:
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+
+		backoff = minBackoff
+		b.subscribeRemote()
+		b.connected.Store(true)
+		b.wake()
+		b.logger.Info(fmt.Sprintf("Bridge connected to %s", b.cfg.Remote.URL))
+
+		select {
+		case <-b.stopCh:
+			b.connected.Store(false)
+			return
+		case <-b.lost:
+		}
+	}
+}
+
+func (b *Bridge) onConnectionLost(_ paho.Client, err error) {
+	b.connected.Store(false)
+	b.logger.Warn(fmt.Sprintf("Bridge connection to %s lost: %v", b.cfg.Remote.URL, err))
+	select {
+	case b.lost <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Bridge) subscribeRemote() {
+	for _, rule := range b.cfg.Rules {
+		if rule.Direction != config.BridgeIn {
+			continue
+		}
+		rule := rule
+		token := b.client.Subscribe(rule.Topic, rule.QoS, func(_ paho.Client, msg paho.Message) {
+			b.onRemoteMessage(rule, msg)
+		})
+		if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+			b.logger.Error(fmt.Sprintf("Bridge failed to subscribe %s upstream: %v", rule.Topic, token.Error()))
+		}
+	}
+}
+
+func (b *Bridge) onLocalMessage(rule config.BridgeRule, cl *mqtt.Client, pk packets.Packet) {
+	// Inline handlers always receive the broker's inline client; messages it
+	// originated itself (including relayed ones) are not sent back upstream.
+	if cl != nil && pk.Origin == cl.ID {
+		return
+	}
+
+	payload := make([]byte, len(pk.Payload))
+	copy(payload, pk.Payload)
+
+	b.enqueue(outMessage{
+		topic:   remapTopic(pk.TopicName, rule.LocalPrefix, rule.RemotePrefix),
+		payload: payload,
+		qos:     rule.QoS,
+		retain:  pk.FixedHeader.Retain,
+	})
+}
+
+func (b *Bridge) onRemoteMessage(rule config.BridgeRule, msg paho.Message) {
+	topic := remapTopic(msg.Topic(), rule.RemotePrefix, rule.LocalPrefix)
+	if err := b.server.Publish(topic, msg.Payload(), msg.Retained(), rule.QoS); err != nil {
+		b.logger.Error(fmt.Sprintf("Bridge failed to relay %s: %v", topic, err))
+		return
+	}
+	atomic.AddInt64(&b.relayed, 1)
+}
+
+func (b *Bridge) enqueue(msg outMessage) {
+	b.mu.Lock()
+	limit := b.cfg.BufferSize
+	if limit <= 0 {
+		limit = 1
+	}
+	if len(b.buffer) >= limit {
+		// Drop the oldest message that is not being published
+		drop := 0
+		if b.sending && len(b.buffer) > 1 {
+			drop = 1
+		}
+		b.buffer = append(b.buffer[:drop], b.buffer[drop+1:]...)
+		atomic.AddInt64(&b.dropped, 1)
+	}
+	b.nextSeq++
+	msg.seq = b.nextSeq
+	b.buffer = append(b.buffer, msg)
+	b.mu.Unlock()
+
+	b.wake()
+}
+
+// peek returns the oldest buffered message and marks it as being sent. It
+// stays buffered until remove confirms its delivery.
+func (b *Bridge) peek() (outMessage, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.buffer) == 0 {
+		return outMessage{}, false
+	}
+	b.sending = true
+	return b.buffer[0], true
+}
+
+// remove drops a delivered message from the head of the buffer
+func (b *Bridge) remove(msg outMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sending = false
+	if len(b.buffer) > 0 && b.buffer[0].seq == msg.seq {
+		b.buffer[0] = outMessage{}
+		b.buffer = b.buffer[1:]
+	}
+}
+
+// release keeps an undelivered message at the head of the buffer
+func (b *Bridge) release() {
+	b.mu.Lock()
+	b.sending = false
+	b.mu.Unlock()
+}
+
+func (b *Bridge) bufferLen() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.buffer)
+}
+
+func (b *Bridge) wake() {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// forwardLoop drains the buffer in order whenever the uplink is connected.
+// A message leaves the buffer only once it is delivered: QoS 0 when the
+// publish was written, QoS>0 when the upstream broker acknowledged it.
+func (b *Bridge) forwardLoop() {
+	defer b.wg.Done()
+
+	for {
+		var out outMessage
+		ok := false
+		if b.connected.Load() {
+			out, ok = b.peek()
+		}
+
+		if !ok {
+			select {
+			case <-b.stopCh:
+				return
+			case <-b.notify:
+			}
+			continue
+		}
+
+		if err := b.publish(out); err != nil {
+			b.release()
+			b.logger.Warn(fmt.Sprintf("Bridge failed to forward %s: %v (retrying)", out.topic, err))
+			select {
+			case <-b.stopCh:
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		b.remove(out)
+		atomic.AddInt64(&b.forwarded, 1)
+	}
+}
+
+func (b *Bridge) publish(out outMessage) error {
+	token := b.client.Publish(out.topic, out.qos, out.retain, out.payload)
+	if out.qos == 0 {
+		// Publish fails synchronously when the connection has just dropped
+		select {
+		case <-token.Done():
+			return token.Error()
+		default:
+			return nil
+		}
+	}
+
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-time.After(publishTimeout):
+		return fmt.Errorf("no acknowledgement within %s", publishTimeout)
+	case <-b.stopCh:
+		return fmt.Errorf("bridge stopped")
+	}
+}
+
+// remapTopic replaces the from prefix of topic with to
+func remapTopic(topic, from, to string) string {
+	if from == "" && to == "" {
+		return topic
+	}
+	if strings.HasPrefix(topic, from) {
+		return to + strings.TrimPrefix(topic, from)
+	}
+	return topic
+}
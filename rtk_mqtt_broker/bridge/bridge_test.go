@@ -0,0 +1,160 @@
+package bridge
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"rtk_mqtt_broker/config"
+	"rtk_mqtt_broker/logger"
+)
+
+func TestRemapTopic(t *testing.T) {
+	tests := []struct {
+		topic, from, to string
+		want            string
+	}{
+		{"rtk/v1/acme/hq/dev1/state", "", "", "rtk/v1/acme/hq/dev1/state"},
+		{"rtk/v1/acme/hq/dev1/state", "rtk/v1/", "site-a/rtk/v1/", "site-a/rtk/v1/acme/hq/dev1/state"},
+		{"site-a/rtk/v1/acme/hq/dev1/cmd/req", "site-a/", "", "rtk/v1/acme/hq/dev1/cmd/req"},
+		{"rtk/v1/acme/hq/dev1/state", "", "edge/", "edge/rtk/v1/acme/hq/dev1/state"},
+		{"other/topic", "rtk/v1/", "site-a/rtk/v1/", "other/topic"},
+		{"rtk/v1", "rtk/v1", "up", "up"},
+	}
+
+	for _, tt := range tests {
+		if got := remapTopic(tt.topic, tt.from, tt.to); got != tt.want {
+			t.Errorf("remapTopic(%q, %q, %q) = %q, want %q", tt.topic, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func newTestBridge(t *testing.T, url string, bufferSize int) *Bridge {
+	t.Helper()
+	b, err := New(config.BridgeConfig{
+		Remote:     config.BridgeRemoteConfig{URL: url, ClientID: "bridge-test", CleanSession: true},
+		BufferSize: bufferSize,
+	}, nil, logger.New("error"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return b
+}
+
+func outRule() config.BridgeRule {
+	return config.BridgeRule{
+		Direction:    config.BridgeOut,
+		Topic:        "rtk/v1/#",
+		LocalPrefix:  "rtk/v1/",
+		RemotePrefix: "up/rtk/v1/",
+		QoS:          1,
+	}
+}
+
+func TestBufferWhileDisconnected(t *testing.T) {
+	b := newTestBridge(t, "tcp://127.0.0.1:1", 3)
+	b.wg.Add(1)
+	go b.forwardLoop()
+	defer func() {
+		close(b.stopCh)
+		b.wg.Wait()
+	}()
+
+	for _, device := range []string{"dev1", "dev2", "dev3", "dev4", "dev5"} {
+		b.onLocalMessage(outRule(), nil, packets.Packet{
+			TopicName: "rtk/v1/acme/hq/" + device + "/state",
+			Payload:   []byte(`{}`),
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	stats := b.Stats()
+	if stats.Buffered != 3 || stats.Dropped != 2 || stats.Forwarded != 0 {
+		t.Fatalf("stats = %+v, want 3 buffered, 2 dropped, 0 forwarded", stats)
+	}
+
+	// The oldest messages are dropped and the rest keep their order
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, device := range []string{"dev3", "dev4", "dev5"} {
+		if want := "up/rtk/v1/acme/hq/" + device + "/state"; b.buffer[i].topic != want {
+			t.Errorf("buffer[%d] = %s, want %s", i, b.buffer[i].topic, want)
+		}
+	}
+}
+
+func TestFailedPublishStaysBuffered(t *testing.T) {
+	b := newTestBridge(t, "tcp://127.0.0.1:1", 10)
+
+	// Marked connected while the client is not: every publish fails
+	b.connected.Store(true)
+	b.wg.Add(1)
+	go b.forwardLoop()
+
+	b.onLocalMessage(outRule(), nil, packets.Packet{TopicName: "rtk/v1/acme/hq/dev1/state", Payload: []byte(`{}`)})
+	time.Sleep(100 * time.Millisecond)
+
+	close(b.stopCh)
+	b.wg.Wait()
+
+	if stats := b.Stats(); stats.Buffered != 1 || stats.Forwarded != 0 {
+		t.Fatalf("stats = %+v, want the message still buffered", stats)
+	}
+}
+
+func TestForwardAfterConnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	upstream := mqtt.New(&mqtt.Options{InlineClient: true})
+	if err := upstream.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := upstream.AddListener(listeners.NewTCP(listeners.Config{ID: "upstream", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 10)
+	if err := upstream.Subscribe("up/#", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		received <- pk.TopicName
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := upstream.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+
+	// Messages queued before the uplink is up are delivered once it is
+	b := newTestBridge(t, "tcp://"+addr, 10)
+	b.onLocalMessage(outRule(), nil, packets.Packet{TopicName: "rtk/v1/acme/hq/dev1/state", Payload: []byte(`{}`)})
+	b.wg.Add(2)
+	go b.connectLoop()
+	go b.forwardLoop()
+	defer b.Stop()
+
+	select {
+	case topic := <-received:
+		if topic != "up/rtk/v1/acme/hq/dev1/state" {
+			t.Fatalf("upstream received %s", topic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not forwarded")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Stats().Forwarded != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := b.Stats(); stats.Forwarded != 1 || stats.Buffered != 0 {
+		t.Fatalf("stats = %+v, want 1 forwarded and an empty buffer", stats)
+	}
+}
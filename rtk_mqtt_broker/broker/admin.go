@@ -0,0 +1,206 @@
+package broker
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// ClientInfo is one entry of the /clients listing.
+type ClientInfo struct {
+	ID            string   `json:"id"`
+	Username      string   `json:"username,omitempty"`
+	RemoteAddr    string   `json:"remote_addr"`
+	Listener      string   `json:"listener"`
+	Connected     bool     `json:"connected"`
+	Subscriptions []string `json:"subscriptions"`
+	Inflight      int      `json:"inflight"`
+}
+
+// newAdminServer builds the HTTP server exposing /metrics, /clients and the
+// disconnect action.
+func (b *Broker) newAdminServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", b.handleMetrics)
+	mux.HandleFunc("GET /clients", b.requireToken(b.handleClients))
+	mux.HandleFunc("POST /clients/{id}/disconnect", b.requireToken(b.handleDisconnect))
+
+	return &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", b.config.Admin.Host, b.config.Admin.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// startAdmin binds the admin address before serving, so a port that is
+// already in use fails Start instead of only being logged.
+func (b *Broker) startAdmin() error {
+	server := b.newAdminServer()
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start admin endpoint: %w", err)
+	}
+	b.admin = server
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		err := server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			b.logger.Error(fmt.Sprintf("Admin server error: %v", err))
+		}
+	}()
+
+	b.logger.Info(fmt.Sprintf("Admin endpoint on http://%s (/metrics, /clients)", ln.Addr()))
+	return nil
+}
+
+func (b *Broker) stopAdmin() {
+	if b.admin == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.admin.Shutdown(ctx); err != nil {
+		b.logger.Warn(fmt.Sprintf("Admin server shutdown: %v", err))
+	}
+}
+
+func (b *Broker) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := b.config.Admin.Token
+		if token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (b *Broker) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	info := b.server.Info.Clone()
+	limits := b.limits.Stats()
+
+	var sb strings.Builder
+	metric := func(name, kind, help string, value int64) {
+		fmt.Fprintf(&sb, "# HELP rtk_mqtt_%s %s\n", name, help)
+		fmt.Fprintf(&sb, "# TYPE rtk_mqtt_%s %s\n", name, kind)
+		fmt.Fprintf(&sb, "rtk_mqtt_%s %d\n", name, value)
+	}
+
+	metric("uptime_seconds", "gauge", "Seconds since the broker started.", info.Uptime)
+	metric("clients_connected", "gauge", "Currently connected clients.", info.ClientsConnected)
+	metric("clients_disconnected", "gauge", "Persistent sessions whose client is disconnected.", info.ClientsDisconnected)
+	metric("clients_maximum", "gauge", "Highest number of concurrently connected clients.", info.ClientsMaximum)
+	metric("clients_total", "gauge", "Connected clients plus persistent sessions.", info.ClientsTotal)
+	metric("messages_received_total", "counter", "Publish packets received.", info.MessagesReceived)
+	metric("messages_sent_total", "counter", "Publish packets sent.", info.MessagesSent)
+	metric("messages_dropped_total", "counter", "Publish packets dropped for slow subscribers.", info.MessagesDropped)
+	metric("retained_messages", "gauge", "Retained messages held by the broker.", info.Retained)
+	metric("inflight_messages", "gauge", "QoS>0 messages awaiting acknowledgement.", info.Inflight)
+	metric("inflight_dropped_total", "counter", "Inflight messages dropped.", info.InflightDropped)
+	metric("subscriptions", "gauge", "Active subscriptions.", info.Subscriptions)
+	metric("packets_received_total", "counter", "Packets of any type received.", info.PacketsReceived)
+	metric("packets_sent_total", "counter", "Packets of any type sent.", info.PacketsSent)
+	metric("bytes_received_total", "counter", "Bytes received.", info.BytesReceived)
+	metric("bytes_sent_total", "counter", "Bytes sent.", info.BytesSent)
+	metric("memory_alloc_bytes", "gauge", "Heap memory allocated.", info.MemoryAlloc)
+	metric("goroutines", "gauge", "Active goroutines.", info.Threads)
+	metric("rejected_connections_total", "counter", "Connections rejected by max_clients.", limits.RejectedConnections)
+	metric("rate_limited_total", "counter", "Publishes dropped by the per-client rate limit.", limits.RateLimited)
+	metric("oversized_payloads_total", "counter", "Publishes dropped for exceeding max_payload_size.", limits.OversizedPayloads)
+	if b.bridge != nil {
+		bs := b.bridge.Stats()
+		connected := int64(0)
+		if bs.Connected {
+			connected = 1
+		}
+		metric("bridge_connected", "gauge", "1 when the upstream bridge connection is up.", connected)
+		metric("bridge_forwarded_total", "counter", "Messages forwarded upstream.", bs.Forwarded)
+		metric("bridge_relayed_total", "counter", "Messages relayed from upstream.", bs.Relayed)
+		metric("bridge_buffered_messages", "gauge", "Messages waiting for the uplink.", bs.Buffered)
+		metric("bridge_dropped_total", "counter", "Messages dropped because the bridge buffer was full.", bs.Dropped)
+	}
+	if b.validator != nil {
+		invalid := b.validator.Stats()
+		metric("invalid_topics_total", "counter", "Publishes with a topic outside the RTK hierarchy.", invalid.InvalidTopics)
+		metric("invalid_payloads_total", "counter", "Publishes whose payload failed schema validation.", invalid.InvalidPayloads)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(sb.String()))
+}
+
+func (b *Broker) handleClients(w http.ResponseWriter, r *http.Request) {
+	clients := b.server.Clients.GetAll()
+	result := make([]ClientInfo, 0, len(clients))
+
+	for _, cl := range clients {
+		if cl.Net.Inline {
+			continue
+		}
+
+		subs := cl.State.Subscriptions.GetAll()
+		filters := make([]string, 0, len(subs))
+		for filter := range subs {
+			filters = append(filters, filter)
+		}
+		sort.Strings(filters)
+
+		result = append(result, ClientInfo{
+			ID:            cl.ID,
+			Username:      string(cl.Properties.Username),
+			RemoteAddr:    cl.Net.Remote,
+			Listener:      cl.Net.Listener,
+			Connected:     !cl.Closed(),
+			Subscriptions: filters,
+			Inflight:      cl.State.Inflight.Len(),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (b *Broker) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	cl, ok := b.server.Clients.Get(id)
+	if !ok || cl.Net.Inline {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "client not found"})
+		return
+	}
+	if cl.Closed() {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "client is not connected"})
+		return
+	}
+
+	// DisconnectClient reports the reason code back as an error once the
+	// client has been stopped.
+	err := b.server.DisconnectClient(cl, packets.ErrAdministrativeAction)
+	if err != nil && !errors.Is(err, packets.ErrAdministrativeAction) {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	b.logger.Info(fmt.Sprintf("Client %s disconnected by admin request from %s", id, r.RemoteAddr))
+	writeJSON(w, http.StatusOK, map[string]string{"status": "disconnected", "id": id})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,172 @@
+package broker
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"rtk_mqtt_broker/config"
+)
+
+const testAdminToken = "s3cret"
+
+// newAdminTestBroker starts a broker with one connected, subscribed client
+// and serves its admin handler over httptest.
+func newAdminTestBroker(t *testing.T) (*Broker, *httptest.Server) {
+	t.Helper()
+	host, port, err := net.SplitHostPort(freeAddr(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Server.Host = host
+	cfg.Server.Port, _ = strconv.Atoi(port)
+	cfg.Admin.Token = testAdminToken
+	cfg.Logging.Level = "error"
+
+	b, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := b.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { b.Stop() })
+
+	var client paho.Client
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c, err := connectClient("tcp://"+net.JoinHostPort(host, port), "dev1", nil)
+		if err == nil {
+			if token := c.Subscribe("rtk/v1/acme/hq/dev1/cmd/req", 1, nil); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+				t.Fatalf("subscribe: %v", token.Error())
+			}
+			client = c
+			break
+		}
+		// Serve runs in the background, so the listener may not be up yet
+		if time.Now().After(deadline) {
+			t.Fatalf("connect: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Cleanup(func() { client.Disconnect(0) })
+
+	ts := httptest.NewServer(b.newAdminServer().Handler)
+	t.Cleanup(ts.Close)
+	return b, ts
+}
+
+func adminRequest(t *testing.T, method, url, token string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestAdmin_Token(t *testing.T) {
+	_, ts := newAdminTestBroker(t)
+
+	tests := []struct {
+		method, path, token string
+		want                int
+	}{
+		{"GET", "/metrics", "", http.StatusOK},
+		{"GET", "/clients", "", http.StatusUnauthorized},
+		{"GET", "/clients", "wrong", http.StatusUnauthorized},
+		{"GET", "/clients", testAdminToken, http.StatusOK},
+		{"POST", "/clients/dev1/disconnect", "", http.StatusUnauthorized},
+		{"POST", "/clients/unknown/disconnect", testAdminToken, http.StatusNotFound},
+		{"GET", "/clients/dev1/disconnect", testAdminToken, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		if resp, body := adminRequest(t, tt.method, ts.URL+tt.path, tt.token); resp.StatusCode != tt.want {
+			t.Errorf("%s %s (token %q) = %d %s, want %d", tt.method, tt.path, tt.token, resp.StatusCode, body, tt.want)
+		}
+	}
+}
+
+func TestAdmin_Metrics(t *testing.T) {
+	_, ts := newAdminTestBroker(t)
+
+	resp, body := adminRequest(t, "GET", ts.URL+"/metrics", "")
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	for _, line := range []string{
+		"# TYPE rtk_mqtt_clients_connected gauge",
+		"rtk_mqtt_clients_connected 1",
+		"rtk_mqtt_subscriptions 1",
+		"rtk_mqtt_rejected_connections_total 0",
+		"rtk_mqtt_rate_limited_total 0",
+		"rtk_mqtt_oversized_payloads_total 0",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics missing %q", line)
+		}
+	}
+	// Bridge and validation metrics are only present when enabled
+	for _, name := range []string{"rtk_mqtt_bridge_connected", "rtk_mqtt_invalid_topics_total"} {
+		if strings.Contains(body, name) {
+			t.Errorf("metrics contain %s while it is disabled", name)
+		}
+	}
+}
+
+func TestAdmin_ClientsAndDisconnect(t *testing.T) {
+	b, ts := newAdminTestBroker(t)
+
+	_, body := adminRequest(t, "GET", ts.URL+"/clients", testAdminToken)
+	var clients []ClientInfo
+	if err := json.Unmarshal([]byte(body), &clients); err != nil {
+		t.Fatalf("decode /clients: %v (%s)", err, body)
+	}
+	if len(clients) != 1 {
+		t.Fatalf("got %d clients, want 1 (inline client hidden): %s", len(clients), body)
+	}
+	got := clients[0]
+	if got.ID != "dev1" || !got.Connected || got.Listener != "tcp" ||
+		len(got.Subscriptions) != 1 || got.Subscriptions[0] != "rtk/v1/acme/hq/dev1/cmd/req" {
+		t.Errorf("client = %+v", got)
+	}
+
+	resp, body := adminRequest(t, "POST", ts.URL+"/clients/dev1/disconnect", testAdminToken)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("disconnect = %d %s", resp.StatusCode, body)
+	}
+
+	cl, ok := b.server.Clients.Get("dev1")
+	if ok && !cl.Closed() {
+		t.Error("dev1 is still connected after the disconnect action")
+	}
+
+	// A second request finds the client gone or no longer connected
+	resp, body = adminRequest(t, "POST", ts.URL+"/clients/dev1/disconnect", testAdminToken)
+	if resp.StatusCode != http.StatusConflict && resp.StatusCode != http.StatusNotFound {
+		t.Errorf("second disconnect = %d %s, want 409 or 404", resp.StatusCode, body)
+	}
+}
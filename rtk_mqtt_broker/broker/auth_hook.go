@@ -0,0 +1,75 @@
+package broker
+
+import (
+	"fmt"
+
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"rtk_mqtt_broker/auth"
+	"rtk_mqtt_broker/logger"
+)
+
+// AuthHook authenticates clients and checks topic ACLs against the
+// configured AuthManager.
+type AuthHook struct {
+	mqtt.HookBase
+	manager *auth.AuthManager
+	logger  *logger.Logger
+	// certListeners are listeners where the identity was already proven by
+	// a verified client certificate, so no password is required.
+	certListeners map[string]bool
+}
+
+func NewAuthHook(manager *auth.AuthManager, logger *logger.Logger, certListeners map[string]bool) *AuthHook {
+	return &AuthHook{
+		manager:       manager,
+		logger:        logger,
+		certListeners: certListeners,
+	}
+}
+
+func (h *AuthHook) ID() string {
+	return "rtk-auth"
+}
+
+func (h *AuthHook) Provides(b byte) bool {
+	return b == mqtt.OnConnectAuthenticate ||
+		b == mqtt.OnACLCheck
+}
+
+func (h *AuthHook) OnConnectAuthenticate(cl *mqtt.Client, pk packets.Packet) bool {
+	if h.certListeners[cl.Net.Listener] {
+		username := string(cl.Properties.Username)
+		if _, ok := h.manager.User(username); ok {
+			return true
+		}
+		h.logger.Warn(fmt.Sprintf("Authentication failed - client: %s, certificate CN: %s is not a configured user, remote: %s",
+			cl.ID, username, cl.Net.Remote))
+		return false
+	}
+
+	username := string(pk.Connect.Username)
+	if h.manager.Authenticate(username, string(pk.Connect.Password)) {
+		return true
+	}
+
+	h.logger.Warn(fmt.Sprintf("Authentication failed - client: %s, username: %s, remote: %s",
+		cl.ID, username, cl.Net.Remote))
+	return false
+}
+
+func (h *AuthHook) OnACLCheck(cl *mqtt.Client, topic string, write bool) bool {
+	username := string(cl.Properties.Username)
+	if h.manager.Authorize(username, topic, write) {
+		return true
+	}
+
+	action := "subscribe"
+	if write {
+		action = "publish"
+	}
+	h.logger.Warn(fmt.Sprintf("ACL denied - client: %s, username: %s, %s: %s",
+		cl.ID, username, action, topic))
+	return false
+}
@@ -2,15 +2,18 @@ package broker
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/mochi-mqtt/server/v2"
-	"github.com/mochi-mqtt/server/v2/listeners"
 	"github.com/mochi-mqtt/server/v2/packets"
 	
+	"rtk_mqtt_broker/auth"
+	"rtk_mqtt_broker/bridge"
 	"rtk_mqtt_broker/config"
 	"rtk_mqtt_broker/logger"
 )
@@ -40,36 +43,109 @@ type Broker struct {
 	server     *mqtt.Server
 	config     *config.Config
 	logger     *logger.Logger
+	identities *certIdentities
+	limits     *LimitsHook
+	validator  *ValidationHook
+	admin      *http.Server
+	bridge     *bridge.Bridge
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 }
 
-func New(cfg *config.Config) *Broker {
+func New(cfg *config.Config) (*Broker, error) {
 	logger := logger.New(cfg.Logging.Level)
 	
-	server := mqtt.New(&mqtt.Options{
+	options := &mqtt.Options{
 		InlineClient: true,
-	})
+		Capabilities: mqtt.NewDefaultServerCapabilities(),
+	}
+	if cfg.Persistence.Enabled && cfg.Persistence.SessionExpiry > 0 {
+		options.Capabilities.MaximumSessionExpiryInterval = cfg.Persistence.SessionExpiry
+	}
+	if cfg.Limits.MaxInflight > 0 && cfg.Limits.MaxInflight <= 65535 {
+		options.Capabilities.MaximumInflight = uint16(cfg.Limits.MaxInflight)
+		options.Capabilities.ReceiveMaximum = uint16(cfg.Limits.MaxInflight)
+	}
+	server := mqtt.New(options)
 	
-	server.AddHook(new(AllowHook), nil)
+	if cfg.Persistence.Enabled {
+		if err := addPersistenceHook(server, cfg.Persistence); err != nil {
+			return nil, err
+		}
+	}
 
-	return &Broker{
-		server: server,
-		config: cfg,
-		logger: logger,
+	authManager, err := auth.NewAuthManager(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid security config: %w", err)
+	}
+
+	limits := NewLimitsHook(server, logger, cfg.Server.MaxClients, cfg.Limits)
+	if err := server.AddHook(limits, nil); err != nil {
+		return nil, fmt.Errorf("failed to add limits hook: %w", err)
+	}
+
+	var validator *ValidationHook
+	if cfg.Validation.Enabled {
+		validator, err = NewValidationHook(server, logger, cfg.Validation)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validation config: %w", err)
+		}
+		if err := server.AddHook(validator, nil); err != nil {
+			return nil, fmt.Errorf("failed to add validation hook: %w", err)
+		}
+	}
+
+	identities := newCertIdentities()
+	certListeners := certListenerIDs(cfg)
+	if len(certListeners) > 0 {
+		err = server.AddHook(&CertIdentityHook{listeners: certListeners, identities: identities}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add certificate identity hook: %w", err)
+		}
+	}
+
+	if authManager.IsEnabled() {
+		err = server.AddHook(NewAuthHook(authManager, logger, certListeners), nil)
+	} else {
+		err = server.AddHook(new(AllowHook), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to add auth hook: %w", err)
 	}
+
+	return &Broker{
+		server:     server,
+		config:     cfg,
+		logger:     logger,
+		identities: identities,
+		limits:     limits,
+		validator:  validator,
+		stopCh:     make(chan struct{}),
+	}, nil
 }
 
 func (b *Broker) Start() error {
 	// Display banner
 	b.printBanner()
 
-	tcp := listeners.NewTCP(listeners.Config{
-		ID:      "tcp",
-		Address: fmt.Sprintf("%s:%d", b.config.Server.Host, b.config.Server.Port),
-	})
+	for _, lc := range b.config.Server.GetListeners() {
+		listener, err := newListener(lc, b.identities)
+		if err != nil {
+			return err
+		}
 
-	err := b.server.AddListener(tcp)
-	if err != nil {
-		return fmt.Errorf("failed to add TCP listener: %w", err)
+		err = b.server.AddListener(listener)
+		if err != nil {
+			return fmt.Errorf("failed to add %s listener %s: %w", lc.Type, lc.ID, err)
+		}
+	}
+
+	if b.config.Admin.Enabled {
+		if err := b.startAdmin(); err != nil {
+			return err
+		}
 	}
 
 	go func() {
@@ -80,23 +156,49 @@ func (b *Broker) Start() error {
 	}()
 
 	// Display startup information
-	address := fmt.Sprintf("%s:%d", b.config.Server.Host, b.config.Server.Port)
 	b.logger.Info(fmt.Sprintf("Realtek Embedded MQTT Broker started successfully"))
-	b.logger.Info(fmt.Sprintf("Listening on interface: %s", b.config.Server.Host))
-	b.logger.Info(fmt.Sprintf("Listening on port: %d", b.config.Server.Port))
-	b.logger.Info(fmt.Sprintf("Full address: %s", address))
+	for _, lc := range b.config.Server.GetListeners() {
+		b.logger.Info(fmt.Sprintf("Listening (%s) on %s:%d [%s]", lc.Type, lc.Host, lc.Port, lc.ID))
+	}
 	b.logger.Info(fmt.Sprintf("Max clients: %d", b.config.Server.MaxClients))
+	if b.config.Persistence.Enabled {
+		b.logger.Info(fmt.Sprintf("Persistence: %s", persistencePath(b.config.Persistence)))
+	}
+	b.logger.Info(fmt.Sprintf("Authentication: %t (%d users)", b.config.Security.EnableAuth, len(b.config.Security.Users)))
 	
 	if b.config.Server.EnableStats {
+		b.wg.Add(1)
 		go b.printStats()
 	}
 
+	if b.config.Bridge.Enabled {
+		br, err := bridge.New(b.config.Bridge, b.server, b.logger)
+		if err != nil {
+			return err
+		}
+		b.bridge = br
+		if err := b.bridge.Start(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Stop shuts the broker down; calling it again has no effect
 func (b *Broker) Stop() error {
-	b.logger.Info("Stopping Realtek Embedded MQTT Broker...")
-	return b.server.Close()
+	var err error
+	b.stopOnce.Do(func() {
+		b.logger.Info("Stopping Realtek Embedded MQTT Broker...")
+		close(b.stopCh)
+		if b.bridge != nil {
+			b.bridge.Stop()
+		}
+		b.stopAdmin()
+		b.wg.Wait()
+		err = b.server.Close()
+	})
+	return err
 }
 
 func (b *Broker) WaitForSignal() {
@@ -118,15 +220,32 @@ func (b *Broker) printBanner() {
 }
 
 func (b *Broker) printStats() {
+	defer b.wg.Done()
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 	
 	for {
 		select {
+		case <-b.stopCh:
+			return
 		case <-ticker.C:
-			info := b.server.Info
+			info := b.server.Info.Clone()
 			b.logger.Info(fmt.Sprintf("Stats - Clients: %d, Messages Received: %d, Messages Sent: %d", 
 				info.ClientsConnected, info.MessagesReceived, info.MessagesSent))
+			limits := b.limits.Stats()
+			b.logger.Info(fmt.Sprintf("Limits - Rejected Connections: %d, Rate Limited: %d, Oversized Payloads: %d, Inflight Dropped: %d",
+				limits.RejectedConnections, limits.RateLimited, limits.OversizedPayloads, info.InflightDropped))
+			if b.bridge != nil {
+				bs := b.bridge.Stats()
+				b.logger.Info(fmt.Sprintf("Bridge - Connected: %t, Forwarded: %d, Relayed: %d, Buffered: %d, Dropped: %d",
+					bs.Connected, bs.Forwarded, bs.Relayed, bs.Buffered, bs.Dropped))
+			}
+			if b.validator != nil {
+				invalid := b.validator.Stats()
+				b.logger.Info(fmt.Sprintf("Validation - Invalid Topics: %d, Invalid Payloads: %d",
+					invalid.InvalidTopics, invalid.InvalidPayloads))
+			}
 		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,192 @@
+package broker
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"rtk_mqtt_broker/config"
+	"rtk_mqtt_broker/logger"
+)
+
+// bucketPruneInterval is how often buckets of disconnected clients are
+// checked for removal
+const bucketPruneInterval = time.Minute
+
+// LimitStats counts messages and connections rejected by the LimitsHook.
+type LimitStats struct {
+	RejectedConnections int64
+	RateLimited         int64
+	OversizedPayloads   int64
+}
+
+// LimitsHook enforces MaxClients, the per-client publish rate and payload
+// size. The inflight cap is applied through the server capabilities.
+// MaxClients is checked here rather than through the server capability,
+// which rejects clients before any hook runs and so cannot be counted.
+type LimitsHook struct {
+	mqtt.HookBase
+	server     *mqtt.Server
+	logger     *logger.Logger
+	maxClients int64
+	limits     config.LimitsConfig
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+
+	stats LimitStats
+}
+
+func NewLimitsHook(server *mqtt.Server, logger *logger.Logger, maxClients int, limits config.LimitsConfig) *LimitsHook {
+	return &LimitsHook{
+		server:     server,
+		logger:     logger,
+		maxClients: int64(maxClients),
+		limits:     limits,
+		buckets:    make(map[string]*tokenBucket),
+	}
+}
+
+func (h *LimitsHook) ID() string {
+	return "rtk-limits"
+}
+
+func (h *LimitsHook) Provides(b byte) bool {
+	return b == mqtt.OnConnect ||
+		b == mqtt.OnDisconnect ||
+		b == mqtt.OnPublish
+}
+
+// OnConnect refuses new clients once MaxClients are connected, answering
+// with the same CONNACK code the server would use.
+func (h *LimitsHook) OnConnect(cl *mqtt.Client, pk packets.Packet) error {
+	if h.maxClients <= 0 || atomic.LoadInt64(&h.server.Info.ClientsConnected) < h.maxClients {
+		return nil
+	}
+
+	atomic.AddInt64(&h.stats.RejectedConnections, 1)
+	h.logger.Warn(fmt.Sprintf("Connection rejected - client: %s, remote: %s, max clients (%d) reached",
+		cl.ID, cl.Net.Remote, h.maxClients))
+
+	code := packets.ErrServerBusy
+	if cl.Properties.ProtocolVersion < 5 {
+		code = packets.ErrServerUnavailable
+	}
+	_ = h.server.SendConnack(cl, code, false, nil)
+	return code
+}
+
+// OnDisconnect keeps the client's bucket until it would have refilled, so
+// reconnecting does not reset the rate limit.
+func (h *LimitsHook) OnDisconnect(cl *mqtt.Client, err error, expire bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if bucket, ok := h.buckets[cl.ID]; ok {
+		bucket.disconnected = now
+	}
+	if now.Sub(h.lastPrune) < bucketPruneInterval {
+		return
+	}
+	h.lastPrune = now
+	for id, bucket := range h.buckets {
+		if !bucket.disconnected.IsZero() && now.Sub(bucket.disconnected) > bucket.refillTime() {
+			delete(h.buckets, id)
+		}
+	}
+}
+
+func (h *LimitsHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	if cl.Net.Inline {
+		return pk, nil
+	}
+
+	if h.limits.MaxPayloadSize > 0 && len(pk.Payload) > h.limits.MaxPayloadSize {
+		atomic.AddInt64(&h.stats.OversizedPayloads, 1)
+		h.logger.Warn(fmt.Sprintf("Payload dropped - client: %s, topic: %s, size: %d > %d",
+			cl.ID, pk.TopicName, len(pk.Payload), h.limits.MaxPayloadSize))
+		return pk, rejectPublish(cl, pk, packets.ErrPacketTooLarge)
+	}
+
+	if h.limits.PublishRate > 0 && !h.allow(cl.ID) {
+		// Only the first drop of each burst is logged to avoid flooding
+		if atomic.AddInt64(&h.stats.RateLimited, 1)%100 == 1 {
+			h.logger.Warn(fmt.Sprintf("Publish rate limited - client: %s, limit: %.1f/s",
+				cl.ID, h.limits.PublishRate))
+		}
+		return pk, rejectPublish(cl, pk, packets.ErrQuotaExceeded)
+	}
+
+	return pk, nil
+}
+
+// Stats returns a snapshot of the rejection counters.
+func (h *LimitsHook) Stats() LimitStats {
+	return LimitStats{
+		RejectedConnections: atomic.LoadInt64(&h.stats.RejectedConnections),
+		RateLimited:         atomic.LoadInt64(&h.stats.RateLimited),
+		OversizedPayloads:   atomic.LoadInt64(&h.stats.OversizedPayloads),
+	}
+}
+
+func (h *LimitsHook) allow(clientID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	bucket, ok := h.buckets[clientID]
+	if !ok {
+		burst := float64(h.limits.PublishBurst)
+		if burst < 1 {
+			burst = h.limits.PublishRate
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		bucket = &tokenBucket{rate: h.limits.PublishRate, burst: burst, tokens: burst, last: time.Now()}
+		h.buckets[clientID] = bucket
+	}
+	bucket.disconnected = time.Time{}
+	return bucket.take(time.Now())
+}
+
+// rejectPublish drops a publish. MQTT v5 QoS>0 publishers receive a PUBACK
+// with the reason code; older clients get no acknowledgement.
+func rejectPublish(cl *mqtt.Client, pk packets.Packet, code packets.Code) error {
+	if cl.Properties.ProtocolVersion == 5 && pk.FixedHeader.Qos > 0 {
+		return code
+	}
+	return packets.ErrRejectPacket
+}
+
+type tokenBucket struct {
+	rate         float64
+	burst        float64
+	tokens       float64
+	last         time.Time
+	disconnected time.Time // zero while the client is connected
+}
+
+// refillTime is how long an empty bucket takes to fill up again
+func (b *tokenBucket) refillTime() time.Duration {
+	return time.Duration(b.burst / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
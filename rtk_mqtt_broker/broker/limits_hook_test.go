@@ -0,0 +1,159 @@
+package broker
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"rtk_mqtt_broker/config"
+	"rtk_mqtt_broker/logger"
+)
+
+// freeAddr returns a loopback address no listener is using.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// serveTCP adds a TCP listener to server and starts it. It returns the
+// broker URL.
+func serveTCP(t *testing.T, server *mqtt.Server) string {
+	t.Helper()
+	addr := freeAddr(t)
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "test", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	return "tcp://" + addr
+}
+
+// connectClient connects a paho client and returns it with the connect error.
+func connectClient(url, clientID string, configure func(*paho.ClientOptions)) (paho.Client, error) {
+	opts := paho.NewClientOptions().
+		AddBroker(url).
+		SetClientID(clientID).
+		SetProtocolVersion(4).
+		SetConnectTimeout(2 * time.Second).
+		SetAutoReconnect(false)
+	if configure != nil {
+		configure(opts)
+	}
+	client := paho.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(5 * time.Second) {
+		return client, errors.New("connect timed out")
+	}
+	return client, token.Error()
+}
+
+func TestLimitsHook_RejectsConnectionsOverMaxClients(t *testing.T) {
+	server := mqtt.New(&mqtt.Options{InlineClient: true})
+	limits := NewLimitsHook(server, logger.New("error"), 1, config.LimitsConfig{})
+	if err := server.AddHook(limits, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	url := serveTCP(t, server)
+	defer server.Close()
+
+	first, err := connectClient(url, "dev1", nil)
+	if err != nil {
+		t.Fatalf("first client: %v", err)
+	}
+	defer first.Disconnect(0)
+
+	second, err := connectClient(url, "dev2", nil)
+	if err == nil {
+		second.Disconnect(0)
+		t.Fatal("second client connected past max_clients")
+	}
+
+	if stats := limits.Stats(); stats.RejectedConnections != 1 {
+		t.Fatalf("stats = %+v, want 1 rejected connection", stats)
+	}
+}
+
+func TestLimitsHook_OnPublish(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    config.LimitsConfig
+		payloads  []int
+		wantCode  packets.Code
+		wantStats LimitStats
+	}{
+		{
+			name:      "payload within limit",
+			limits:    config.LimitsConfig{MaxPayloadSize: 8},
+			payloads:  []int{8},
+			wantStats: LimitStats{},
+		},
+		{
+			name:      "oversized payload",
+			limits:    config.LimitsConfig{MaxPayloadSize: 8},
+			payloads:  []int{8, 9},
+			wantCode:  packets.ErrPacketTooLarge,
+			wantStats: LimitStats{OversizedPayloads: 1},
+		},
+		{
+			name:      "burst exceeded",
+			limits:    config.LimitsConfig{PublishRate: 1, PublishBurst: 2},
+			payloads:  []int{1, 1, 1},
+			wantCode:  packets.ErrQuotaExceeded,
+			wantStats: LimitStats{RateLimited: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewLimitsHook(nil, logger.New("error"), 0, tt.limits)
+			cl := &mqtt.Client{ID: "dev1"}
+			cl.Properties.ProtocolVersion = 5
+
+			var err error
+			for _, size := range tt.payloads {
+				pk := packets.Packet{TopicName: "rtk/v1/acme/hq/dev1/state", Payload: make([]byte, size)}
+				pk.FixedHeader.Qos = 1
+				_, err = h.OnPublish(cl, pk)
+			}
+
+			if tt.wantCode.Code == 0 {
+				if err != nil {
+					t.Errorf("OnPublish() = %v, want nil", err)
+				}
+			} else if err != tt.wantCode {
+				t.Errorf("OnPublish() = %v, want %v", err, tt.wantCode)
+			}
+			if got := h.Stats(); got != tt.wantStats {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestLimitsHook_OldClientsDroppedSilently(t *testing.T) {
+	h := NewLimitsHook(nil, logger.New("error"), 0, config.LimitsConfig{MaxPayloadSize: 1})
+	cl := &mqtt.Client{ID: "dev1"}
+	cl.Properties.ProtocolVersion = 4
+
+	pk := packets.Packet{TopicName: "rtk/v1/acme/hq/dev1/state", Payload: []byte("too big")}
+	pk.FixedHeader.Qos = 1
+	if _, err := h.OnPublish(cl, pk); err != packets.ErrRejectPacket {
+		t.Fatalf("OnPublish() = %v, want %v", err, packets.ErrRejectPacket)
+	}
+}
@@ -0,0 +1,188 @@
+package broker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"rtk_mqtt_broker/config"
+)
+
+// newListener builds the mochi listener for one configured listener.
+func newListener(lc config.ListenerConfig, identities *certIdentities) (listeners.Listener, error) {
+	lcfg := listeners.Config{
+		ID:      lc.ID,
+		Address: fmt.Sprintf("%s:%d", lc.Host, lc.Port),
+	}
+
+	if lc.IsTLS() {
+		tlsConfig, err := newTLSConfig(lc, identities)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", lc.ID, err)
+		}
+		lcfg.TLSConfig = tlsConfig
+	}
+
+	switch lc.Type {
+	case config.ListenerTCP, config.ListenerTLS:
+		return listeners.NewTCP(lcfg), nil
+	case config.ListenerWS, config.ListenerWSS:
+		return listeners.NewWebsocket(lcfg), nil
+	default:
+		return nil, fmt.Errorf("listener %s: unknown type %q", lc.ID, lc.Type)
+	}
+}
+
+func newTLSConfig(lc config.ListenerConfig, identities *certIdentities) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(lc.CertFile, lc.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if lc.Type == config.ListenerWSS {
+		// Websocket upgrades are not possible over HTTP/2
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	}
+
+	if lc.CAFile != "" {
+		caPEM, err := os.ReadFile(lc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", lc.CAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	switch lc.ClientAuth {
+	case "request":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		tlsConfig.ClientAuth = tls.NoClientCert
+	}
+
+	if lc.CNAsUsername {
+		// Record the verified CN against the remote address so the
+		// identity hook can pick it up once the CONNECT packet arrives.
+		base := tlsConfig
+		base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			remote := hello.Conn.RemoteAddr().String()
+			conf := base.Clone()
+			conf.GetConfigForClient = nil
+			conf.VerifyConnection = func(cs tls.ConnectionState) error {
+				if len(cs.PeerCertificates) == 0 {
+					return fmt.Errorf("client certificate required")
+				}
+				cn := cs.PeerCertificates[0].Subject.CommonName
+				if cn == "" {
+					return fmt.Errorf("client certificate has no common name")
+				}
+				identities.store(remote, cn)
+				return nil
+			}
+			return conf, nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// certIdentities maps remote addresses to the CN of the client certificate
+// presented during the TLS handshake.
+type certIdentities struct {
+	mu      sync.Mutex
+	entries map[string]certIdentity
+}
+
+type certIdentity struct {
+	commonName string
+	seen       time.Time
+}
+
+// certIdentityTTL bounds how long a handshake may precede its CONNECT packet
+const certIdentityTTL = time.Minute
+
+func newCertIdentities() *certIdentities {
+	return &certIdentities{entries: make(map[string]certIdentity)}
+}
+
+func (c *certIdentities) store(remote, cn string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for addr, entry := range c.entries {
+		if now.Sub(entry.seen) > certIdentityTTL {
+			delete(c.entries, addr)
+		}
+	}
+	c.entries[remote] = certIdentity{commonName: cn, seen: now}
+}
+
+func (c *certIdentities) take(remote string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[remote]
+	if ok {
+		delete(c.entries, remote)
+	}
+	return entry.commonName, ok
+}
+
+// CertIdentityHook replaces the MQTT username with the client-certificate CN
+// for listeners configured with cn_as_username.
+type CertIdentityHook struct {
+	mqtt.HookBase
+	listeners  map[string]bool
+	identities *certIdentities
+}
+
+func (h *CertIdentityHook) ID() string {
+	return "cert-identity"
+}
+
+func (h *CertIdentityHook) Provides(b byte) bool {
+	return b == mqtt.OnConnect
+}
+
+func (h *CertIdentityHook) OnConnect(cl *mqtt.Client, pk packets.Packet) error {
+	if !h.listeners[cl.Net.Listener] {
+		return nil
+	}
+
+	cn, ok := h.identities.take(cl.Net.Remote)
+	if !ok {
+		return fmt.Errorf("no verified client certificate for %s", cl.Net.Remote)
+	}
+	cl.Properties.Username = []byte(cn)
+	return nil
+}
+
+// certListenerIDs returns the IDs of listeners whose identity comes from the
+// client certificate.
+func certListenerIDs(cfg *config.Config) map[string]bool {
+	ids := make(map[string]bool)
+	for _, lc := range cfg.Server.GetListeners() {
+		if lc.CNAsUsername {
+			ids[lc.ID] = true
+		}
+	}
+	return ids
+}
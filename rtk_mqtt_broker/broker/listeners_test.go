@@ -0,0 +1,192 @@
+package broker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mochi-mqtt/server/v2"
+
+	"rtk_mqtt_broker/auth"
+	"rtk_mqtt_broker/config"
+	"rtk_mqtt_broker/logger"
+)
+
+// testCA issues certificates for the TLS listener tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rtk-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTLSListener_CNAsUsername(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "rtk-broker", x509.ExtKeyUsageServerAuth)
+
+	host, port, err := net.SplitHostPort(freeAddr(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := config.ListenerConfig{
+		ID:           "mtls",
+		Type:         config.ListenerTLS,
+		Host:         host,
+		CertFile:     writeFile(t, dir, "server.crt", serverCert),
+		KeyFile:      writeFile(t, dir, "server.key", serverKey),
+		CAFile:       writeFile(t, dir, "ca.crt", ca.pem),
+		ClientAuth:   "require",
+		CNAsUsername: true,
+	}
+	lc.Port, _ = strconv.Atoi(port)
+
+	cfg := &config.Config{}
+	cfg.Server.Listeners = []config.ListenerConfig{lc}
+	cfg.Security.EnableAuth = true
+	cfg.Security.Users = []config.UserConfig{{Username: "dev1", Password: "not-used", Role: auth.RoleDevice}}
+	manager, err := auth.NewAuthManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wired as broker.New does for cn_as_username listeners
+	server := mqtt.New(&mqtt.Options{InlineClient: true})
+	identities := newCertIdentities()
+	certListeners := certListenerIDs(cfg)
+	if err := server.AddHook(&CertIdentityHook{listeners: certListeners, identities: identities}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddHook(NewAuthHook(manager, logger.New("error"), certListeners), nil); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := newListener(lc, identities)
+	if err != nil {
+		t.Fatalf("newListener: %v", err)
+	}
+	if err := server.AddListener(listener); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	connect := func(clientID, cn string) (paho.Client, error) {
+		tlsConfig := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		if cn != "" {
+			certPEM, keyPEM := ca.issue(t, cn, x509.ExtKeyUsageClientAuth)
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		return connectClient("ssl://"+net.JoinHostPort(host, port), clientID, func(opts *paho.ClientOptions) {
+			// The password is wrong on purpose: the certificate is the credential
+			opts.SetUsername("someone-else").SetPassword("wrong").SetTLSConfig(tlsConfig)
+		})
+	}
+
+	client, err := connect("client-1", "dev1")
+	if err != nil {
+		t.Fatalf("client with a dev1 certificate: %v", err)
+	}
+	defer client.Disconnect(0)
+
+	cl, ok := server.Clients.Get("client-1")
+	if !ok {
+		t.Fatal("client-1 is not connected")
+	}
+	if username := string(cl.Properties.Username); username != "dev1" {
+		t.Errorf("username = %q, want the certificate CN dev1", username)
+	}
+
+	// A verified certificate whose CN is not a configured user is refused
+	if c, err := connect("client-2", "intruder"); err == nil {
+		c.Disconnect(0)
+		t.Error("client with an unknown CN connected")
+	}
+
+	// So is a client without a certificate
+	if c, err := connect("client-3", ""); err == nil {
+		c.Disconnect(0)
+		t.Error("client without a certificate connected")
+	}
+}
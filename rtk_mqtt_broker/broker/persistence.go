@@ -0,0 +1,75 @@
+package broker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/storage"
+	"github.com/mochi-mqtt/server/v2/hooks/storage/bolt"
+	"go.etcd.io/bbolt"
+
+	"rtk_mqtt_broker/config"
+)
+
+// addPersistenceHook attaches the bolt storage hook so that client sessions,
+// subscriptions, inflight QoS messages and retained messages are restored
+// when the broker restarts.
+func addPersistenceHook(server *mqtt.Server, cfg config.PersistenceConfig) error {
+	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory %s: %w", cfg.DataDir, err)
+	}
+
+	err := server.AddHook(&persistenceHook{Hook: new(bolt.Hook)}, &bolt.Options{
+		Path:   persistencePath(cfg),
+		Bucket: "rtk-mqtt",
+		Options: &bbolt.Options{
+			Timeout: 5 * time.Second,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open persistence store %s: %w", persistencePath(cfg), err)
+	}
+	return nil
+}
+
+func persistencePath(cfg config.PersistenceConfig) string {
+	file := cfg.File
+	if file == "" {
+		file = "rtk_broker.db"
+	}
+	return filepath.Join(cfg.DataDir, file)
+}
+
+// persistenceHook wraps the bolt storage hook. The upstream hook does not
+// store the packet ID of inflight messages, so restored messages would be
+// resent with ID 0 and dropped by clients; recover it from the storage key
+// (IFM_<client>:<packet id>) instead.
+type persistenceHook struct {
+	*bolt.Hook
+}
+
+func (h *persistenceHook) StoredInflightMessages() ([]storage.Message, error) {
+	messages, err := h.Hook.StoredInflightMessages()
+	if err != nil {
+		return messages, err
+	}
+
+	for i := range messages {
+		if messages[i].PacketID != 0 {
+			continue
+		}
+		idx := strings.LastIndex(messages[i].ID, ":")
+		if idx < 0 {
+			continue
+		}
+		if id, err := strconv.ParseUint(messages[i].ID[idx+1:], 10, 16); err == nil {
+			messages[i].PacketID = uint16(id)
+		}
+	}
+	return messages, nil
+}
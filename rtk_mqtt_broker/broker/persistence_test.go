@@ -0,0 +1,150 @@
+package broker
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/hooks/storage/bolt"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"rtk_mqtt_broker/config"
+)
+
+func openPersistenceHook(t *testing.T, path string) *persistenceHook {
+	t.Helper()
+	h := &persistenceHook{Hook: new(bolt.Hook)}
+	h.SetOpts(slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	if err := h.Init(&bolt.Options{Path: path}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return h
+}
+
+func TestPersistenceHook_StoredInflightPacketID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rtk_broker.db")
+
+	h := openPersistenceHook(t, path)
+	pk := packets.Packet{
+		FixedHeader: packets.FixedHeader{Type: packets.Publish, Qos: 1},
+		TopicName:   "rtk/v1/acme/hq/dev1/cmd/req",
+		Payload:     []byte(`{"id":"c1"}`),
+		PacketID:    4242,
+	}
+	h.OnQosPublish(&mqtt.Client{ID: "dev1"}, pk, time.Now().Unix(), 0)
+	if err := h.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	h = openPersistenceHook(t, path)
+	defer h.Stop()
+
+	messages, err := h.StoredInflightMessages()
+	if err != nil {
+		t.Fatalf("StoredInflightMessages: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d inflight messages, want 1", len(messages))
+	}
+	if messages[0].ID != "IFM_dev1:4242" || messages[0].PacketID != 4242 {
+		t.Errorf("message %s has packet ID %d, want IFM_dev1:4242 with 4242", messages[0].ID, messages[0].PacketID)
+	}
+}
+
+// newPersistentServer starts a broker on cfg's data file, as broker.New does
+// with persistence enabled.
+func newPersistentServer(t *testing.T, cfg config.PersistenceConfig) (*mqtt.Server, string) {
+	t.Helper()
+	server := mqtt.New(&mqtt.Options{InlineClient: true})
+	if err := addPersistenceHook(server, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	return server, serveTCP(t, server)
+}
+
+func TestPersistence_SurvivesRestart(t *testing.T) {
+	cfg := config.PersistenceConfig{Enabled: true, DataDir: t.TempDir()}
+	const stateTopic = "rtk/v1/acme/hq/dev1/state"
+	const cmdTopic = "rtk/v1/acme/hq/dev1/cmd/req"
+
+	server, url := newPersistentServer(t, cfg)
+
+	// The device subscribes with a persistent session and goes offline
+	device, err := connectClient(url, "dev1", func(opts *paho.ClientOptions) { opts.SetCleanSession(false) })
+	if err != nil {
+		t.Fatalf("device: %v", err)
+	}
+	if token := device.Subscribe(cmdTopic, 1, nil); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("subscribe: %v", token.Error())
+	}
+	device.Disconnect(100)
+
+	controller, err := connectClient(url, "controller", nil)
+	if err != nil {
+		t.Fatalf("controller: %v", err)
+	}
+	for topic, retained := range map[string]bool{stateTopic: true, cmdTopic: false} {
+		token := controller.Publish(topic, 1, retained, `{"id":"c1"}`)
+		if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+			t.Fatalf("publish %s: %v", topic, token.Error())
+		}
+	}
+	controller.Disconnect(100)
+
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	server, url = newPersistentServer(t, cfg)
+	defer server.Close()
+
+	// The queued command is delivered when the device resumes its session
+	commands := make(chan string, 1)
+	device, err = connectClient(url, "dev1", func(opts *paho.ClientOptions) {
+		opts.SetCleanSession(false)
+		opts.SetDefaultPublishHandler(func(_ paho.Client, msg paho.Message) {
+			commands <- msg.Topic()
+		})
+	})
+	if err != nil {
+		t.Fatalf("device reconnect: %v", err)
+	}
+	defer device.Disconnect(0)
+
+	select {
+	case topic := <-commands:
+		if topic != cmdTopic {
+			t.Errorf("device received %s, want %s", topic, cmdTopic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued command was not delivered after restart")
+	}
+
+	// The retained state is still served to new subscribers
+	retained := make(chan paho.Message, 1)
+	observer, err := connectClient(url, "observer", nil)
+	if err != nil {
+		t.Fatalf("observer: %v", err)
+	}
+	defer observer.Disconnect(0)
+	observer.Subscribe(stateTopic, 1, func(_ paho.Client, msg paho.Message) {
+		retained <- msg
+	})
+
+	select {
+	case msg := <-retained:
+		if !msg.Retained() || string(msg.Payload()) != `{"id":"c1"}` {
+			t.Errorf("retained message = %s (retained %t)", msg.Payload(), msg.Retained())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retained message was lost across the restart")
+	}
+}
@@ -0,0 +1,164 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"rtk_mqtt_broker/config"
+	"rtk_mqtt_broker/logger"
+	"rtk_mqtt_broker/validation"
+)
+
+// ValidationStats counts messages that failed RTK protocol validation.
+type ValidationStats struct {
+	InvalidTopics   int64
+	InvalidPayloads int64
+}
+
+// ValidationHook checks rtk/... publishes against the SPEC topic hierarchy
+// and, when a schema directory is configured, the JSON schemas.
+type ValidationHook struct {
+	mqtt.HookBase
+	server  *mqtt.Server
+	logger  *logger.Logger
+	mode    string
+	topics  *validation.TopicValidator
+	schemas *validation.SchemaSet
+
+	stats ValidationStats
+}
+
+func NewValidationHook(server *mqtt.Server, logger *logger.Logger, cfg config.ValidationConfig) (*ValidationHook, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = config.ValidationReject
+	case config.ValidationReject, config.ValidationTag, config.ValidationMirror:
+	default:
+		return nil, fmt.Errorf("unknown validation mode %q", cfg.Mode)
+	}
+
+	topics, err := validation.NewTopicValidator(cfg.DeviceIDPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &ValidationHook{
+		server: server,
+		logger: logger,
+		mode:   cfg.Mode,
+		topics: topics,
+	}
+
+	if cfg.SchemaDir != "" {
+		h.schemas, err = validation.LoadSchemaDir(cfg.SchemaDir)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("Loaded %d RTK schemas from %s", h.schemas.Len(), cfg.SchemaDir))
+	}
+
+	return h, nil
+}
+
+func (h *ValidationHook) ID() string {
+	return "rtk-validation"
+}
+
+func (h *ValidationHook) Provides(b byte) bool {
+	return b == mqtt.OnPublish
+}
+
+func (h *ValidationHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	if cl.Net.Inline || !validation.IsRTKTopic(pk.TopicName) {
+		return pk, nil
+	}
+
+	topic, err := h.topics.Parse(pk.TopicName)
+	if err != nil {
+		atomic.AddInt64(&h.stats.InvalidTopics, 1)
+		return h.handleInvalid(cl, pk, []string{err.Error()})
+	}
+
+	// Empty payloads clear retained messages and are always allowed.
+	// Reserved (_controller ...) topics are validated like any other; only
+	// the controller and admin roles may publish to them.
+	if h.schemas == nil || len(pk.Payload) == 0 {
+		return pk, nil
+	}
+
+	if errs := h.schemas.Validate(topic, pk.Payload); len(errs) > 0 {
+		atomic.AddInt64(&h.stats.InvalidPayloads, 1)
+		return h.handleInvalid(cl, pk, errs)
+	}
+
+	return pk, nil
+}
+
+// Stats returns a snapshot of the validation counters.
+func (h *ValidationHook) Stats() ValidationStats {
+	return ValidationStats{
+		InvalidTopics:   atomic.LoadInt64(&h.stats.InvalidTopics),
+		InvalidPayloads: atomic.LoadInt64(&h.stats.InvalidPayloads),
+	}
+}
+
+func (h *ValidationHook) handleInvalid(cl *mqtt.Client, pk packets.Packet, errs []string) (packets.Packet, error) {
+	h.logger.Warn(fmt.Sprintf("Invalid RTK message (%s) - client: %s, topic: %s, errors: %s",
+		h.mode, cl.ID, pk.TopicName, strings.Join(errs, "; ")))
+
+	switch h.mode {
+	case config.ValidationTag:
+		pk.Properties.User = append(pk.Properties.User,
+			packets.UserProperty{Key: "rtk-validation", Val: "invalid"},
+			packets.UserProperty{Key: "rtk-validation-error", Val: errs[0]},
+		)
+		return pk, nil
+	case config.ValidationMirror:
+		h.mirror(cl, pk, errs)
+		return pk, nil
+	default:
+		return pk, rejectPublish(cl, pk, packets.ErrPayloadFormatInvalid)
+	}
+}
+
+// invalidMessage is the envelope published to rtk/v1/_invalid/...
+type invalidMessage struct {
+	Schema   string          `json:"schema"`
+	Ts       int64           `json:"ts"`
+	Topic    string          `json:"topic"`
+	ClientID string          `json:"client_id"`
+	Errors   []string        `json:"errors"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Raw      string          `json:"raw,omitempty"`
+}
+
+func (h *ValidationHook) mirror(cl *mqtt.Client, pk packets.Packet, errs []string) {
+	msg := invalidMessage{
+		Schema:   "invalid/1.0",
+		Ts:       time.Now().UnixMilli(),
+		Topic:    pk.TopicName,
+		ClientID: cl.ID,
+		Errors:   errs,
+	}
+	if json.Valid(pk.Payload) {
+		msg.Payload = pk.Payload
+	} else {
+		msg.Raw = string(pk.Payload)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to encode invalid message: %v", err))
+		return
+	}
+
+	if err := h.server.Publish(validation.InvalidTopic(pk.TopicName), data, false, 0); err != nil {
+		h.logger.Error(fmt.Sprintf("Failed to mirror invalid message: %v", err))
+	}
+}
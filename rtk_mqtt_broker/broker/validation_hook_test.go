@@ -0,0 +1,157 @@
+package broker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"rtk_mqtt_broker/config"
+	"rtk_mqtt_broker/logger"
+	"rtk_mqtt_broker/validation"
+)
+
+func newTestValidationHook(t *testing.T, server *mqtt.Server, mode string) *ValidationHook {
+	t.Helper()
+	dir := t.TempDir()
+	schema := `{"type": "object", "required": ["schema", "ts"]}`
+	if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewValidationHook(server, logger.New("error"), config.ValidationConfig{
+		Enabled:   true,
+		Mode:      mode,
+		SchemaDir: dir,
+	})
+	if err != nil {
+		t.Fatalf("NewValidationHook: %v", err)
+	}
+	return h
+}
+
+func publishPacket(topic, payload string) packets.Packet {
+	pk := packets.Packet{TopicName: topic, Payload: []byte(payload)}
+	pk.FixedHeader.Qos = 1
+	return pk
+}
+
+func v5Client(id string) *mqtt.Client {
+	cl := &mqtt.Client{ID: id}
+	cl.Properties.ProtocolVersion = 5
+	return cl
+}
+
+func TestNewValidationHook_Mode(t *testing.T) {
+	h, err := NewValidationHook(nil, logger.New("error"), config.ValidationConfig{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.mode != config.ValidationReject {
+		t.Errorf("default mode = %q, want %q", h.mode, config.ValidationReject)
+	}
+
+	if _, err := NewValidationHook(nil, logger.New("error"), config.ValidationConfig{Mode: "drop"}); err == nil {
+		t.Error("NewValidationHook accepted an unknown mode")
+	}
+}
+
+func TestValidationHook_Reject(t *testing.T) {
+	h := newTestValidationHook(t, nil, config.ValidationReject)
+	cl := v5Client("dev1")
+
+	tests := []struct {
+		topic   string
+		payload string
+		want    error
+	}{
+		{"rtk/v1/acme/hq/dev1/state", `{"schema":"state/1.0","ts":1}`, nil},
+		{"rtk/v1/acme/hq/dev1/state", ``, nil},
+		{"home/livingroom", `not json`, nil},
+		{"rtk/v1/acme/hq/dev1/status", `{"schema":"state/1.0","ts":1}`, packets.ErrPayloadFormatInvalid},
+		{"rtk/v1/acme/hq/dev1/state", `{"schema":"state/1.0"}`, packets.ErrPayloadFormatInvalid},
+	}
+
+	for _, tt := range tests {
+		if _, err := h.OnPublish(cl, publishPacket(tt.topic, tt.payload)); err != tt.want {
+			t.Errorf("OnPublish(%s, %s) = %v, want %v", tt.topic, tt.payload, err, tt.want)
+		}
+	}
+
+	if stats := h.Stats(); stats.InvalidTopics != 1 || stats.InvalidPayloads != 1 {
+		t.Errorf("stats = %+v, want 1 invalid topic and 1 invalid payload", stats)
+	}
+
+	// Inline (broker originated) publishes are trusted
+	inline := v5Client("inline")
+	inline.Net.Inline = true
+	if _, err := h.OnPublish(inline, publishPacket("rtk/v1/acme/hq/dev1/status", `{}`)); err != nil {
+		t.Errorf("inline publish rejected: %v", err)
+	}
+}
+
+func TestValidationHook_Tag(t *testing.T) {
+	h := newTestValidationHook(t, nil, config.ValidationTag)
+
+	pk, err := h.OnPublish(v5Client("dev1"), publishPacket("rtk/v1/acme/hq/dev1/state", `{"ts":1}`))
+	if err != nil {
+		t.Fatalf("tag mode rejected the message: %v", err)
+	}
+
+	props := make(map[string]string)
+	for _, p := range pk.Properties.User {
+		props[p.Key] = p.Val
+	}
+	if props["rtk-validation"] != "invalid" || props["rtk-validation-error"] == "" {
+		t.Errorf("user properties = %v, want rtk-validation=invalid and an error", props)
+	}
+
+	pk, err = h.OnPublish(v5Client("dev1"), publishPacket("rtk/v1/acme/hq/dev1/state", `{"schema":"state/1.0","ts":1}`))
+	if err != nil || len(pk.Properties.User) != 0 {
+		t.Errorf("valid message: err = %v, user properties = %v", err, pk.Properties.User)
+	}
+}
+
+func TestValidationHook_Mirror(t *testing.T) {
+	server := mqtt.New(&mqtt.Options{InlineClient: true})
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	mirrored := make(chan packets.Packet, 1)
+	if err := server.Subscribe(validation.InvalidPrefix+"/#", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		mirrored <- pk
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestValidationHook(t, server, config.ValidationMirror)
+	if _, err := h.OnPublish(v5Client("dev1"), publishPacket("rtk/v1/acme/hq/dev1/state", `online`)); err != nil {
+		t.Fatalf("mirror mode rejected the message: %v", err)
+	}
+
+	select {
+	case pk := <-mirrored:
+		if pk.TopicName != "rtk/v1/_invalid/acme/hq/dev1/state" {
+			t.Errorf("mirrored to %s", pk.TopicName)
+		}
+		var msg invalidMessage
+		if err := json.Unmarshal(pk.Payload, &msg); err != nil {
+			t.Fatalf("mirrored payload: %v", err)
+		}
+		if msg.Topic != "rtk/v1/acme/hq/dev1/state" || msg.ClientID != "dev1" || msg.Raw != "online" || len(msg.Errors) == 0 {
+			t.Errorf("mirrored message = %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("invalid message was not mirrored")
+	}
+
+	if stats := h.Stats(); stats.InvalidPayloads != 1 {
+		t.Errorf("stats = %+v, want 1 invalid payload", stats)
+	}
+}
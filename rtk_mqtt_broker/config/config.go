@@ -1,26 +1,272 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Security SecurityConfig `yaml:"security"`
-	Logging  LoggingConfig  `yaml:"logging"`
+	Server      ServerConfig      `yaml:"server"`
+	Security    SecurityConfig    `yaml:"security"`
+	Persistence PersistenceConfig `yaml:"persistence"`
+	Limits      LimitsConfig      `yaml:"limits"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Validation  ValidationConfig  `yaml:"validation"`
+	Bridge      BridgeConfig      `yaml:"bridge"`
+	Logging     LoggingConfig     `yaml:"logging"`
 }
 
 type ServerConfig struct {
-	Port        int    `yaml:"port"`
-	Host        string `yaml:"host"`
-	MaxClients  int    `yaml:"max_clients"`
-	EnableStats bool   `yaml:"enable_stats"`
+	Port        int              `yaml:"port"`
+	Host        string           `yaml:"host"`
+	MaxClients  int              `yaml:"max_clients"`
+	EnableStats bool             `yaml:"enable_stats"`
+	Listeners   []ListenerConfig `yaml:"listeners"`
+}
+
+// ListenerConfig describes one network listener. When Server.Listeners is
+// empty a single plain TCP listener on Host:Port is used.
+type ListenerConfig struct {
+	ID   string `yaml:"id"`
+	Type string `yaml:"type"` // tcp, tls, ws, wss
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	// TLS settings, used by the tls and wss types
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	CAFile     string `yaml:"ca_file"`     // CA bundle used to verify client certificates
+	ClientAuth string `yaml:"client_auth"` // none, request, require
+	// CNAsUsername makes the verified client-certificate CN the MQTT username
+	CNAsUsername bool `yaml:"cn_as_username"`
+}
+
+// Listener type values
+const (
+	ListenerTCP = "tcp"
+	ListenerTLS = "tls"
+	ListenerWS  = "ws"
+	ListenerWSS = "wss"
+)
+
+// IsTLS reports whether the listener terminates TLS
+func (l ListenerConfig) IsTLS() bool {
+	return l.Type == ListenerTLS || l.Type == ListenerWSS
+}
+
+// GetListeners returns the configured listeners, falling back to a single
+// TCP listener on Host:Port for older configuration files.
+func (s ServerConfig) GetListeners() []ListenerConfig {
+	if len(s.Listeners) == 0 {
+		return []ListenerConfig{{
+			ID:   "tcp",
+			Type: ListenerTCP,
+			Host: s.Host,
+			Port: s.Port,
+		}}
+	}
+
+	listeners := make([]ListenerConfig, len(s.Listeners))
+	for i, l := range s.Listeners {
+		if l.Type == "" {
+			l.Type = ListenerTCP
+		}
+		if l.Host == "" {
+			l.Host = s.Host
+		}
+		if l.ID == "" {
+			l.ID = fmt.Sprintf("%s-%d", l.Type, l.Port)
+		}
+		listeners[i] = l
+	}
+	return listeners
+}
+
+// Validate checks the listener settings
+func (s ServerConfig) Validate() error {
+	seen := make(map[string]bool)
+	for _, l := range s.GetListeners() {
+		if seen[l.ID] {
+			return fmt.Errorf("listener %s: duplicate id", l.ID)
+		}
+		seen[l.ID] = true
+
+		switch l.Type {
+		case ListenerTCP, ListenerWS:
+			if l.CertFile != "" || l.CNAsUsername {
+				return fmt.Errorf("listener %s: TLS settings require type tls or wss", l.ID)
+			}
+		case ListenerTLS, ListenerWSS:
+			if l.CertFile == "" || l.KeyFile == "" {
+				return fmt.Errorf("listener %s: cert_file and key_file are required", l.ID)
+			}
+		default:
+			return fmt.Errorf("listener %s: unknown type %q", l.ID, l.Type)
+		}
+
+		if l.Port <= 0 || l.Port > 65535 {
+			return fmt.Errorf("listener %s: invalid port %d", l.ID, l.Port)
+		}
+
+		switch l.ClientAuth {
+		case "", "none", "request", "require":
+		default:
+			return fmt.Errorf("listener %s: unknown client_auth %q", l.ID, l.ClientAuth)
+		}
+		if l.ClientAuth != "" && l.ClientAuth != "none" && l.CAFile == "" {
+			return fmt.Errorf("listener %s: client_auth requires ca_file", l.ID)
+		}
+		if l.CNAsUsername && l.ClientAuth != "require" {
+			return fmt.Errorf("listener %s: cn_as_username requires client_auth: require", l.ID)
+		}
+	}
+	return nil
 }
 
 type SecurityConfig struct {
-	EnableAuth bool                `yaml:"enable_auth"`
-	Users      []map[string]string `yaml:"users"`
+	EnableAuth bool         `yaml:"enable_auth"`
+	Users      []UserConfig `yaml:"users"`
+}
+
+// UserConfig describes a broker account. Either Password (plain text) or
+// PasswordHash (bcrypt) must be set. Role selects the built-in RTK topic
+// permissions ("device", "controller" or "admin"); ACL adds extra rules.
+type UserConfig struct {
+	Username     string          `yaml:"username"`
+	Password     string          `yaml:"password"`
+	PasswordHash string          `yaml:"password_hash"`
+	Role         string          `yaml:"role"`
+	DeviceID     string          `yaml:"device_id"`
+	ACL          []ACLRuleConfig `yaml:"acl"`
+}
+
+// ACLRuleConfig grants or denies access to a topic filter. The filter may use
+// the placeholders {username} and {device_id}. Access is one of "deny",
+// "read", "write" or "readwrite".
+type ACLRuleConfig struct {
+	Topic  string `yaml:"topic"`
+	Access string `yaml:"access"`
+}
+
+// PersistenceConfig enables the embedded on-disk store for sessions,
+// subscriptions, inflight QoS messages and retained messages.
+type PersistenceConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	DataDir string `yaml:"data_dir"`
+	File    string `yaml:"file"`
+	// SessionExpiry is the longest time (seconds) a persistent session is
+	// kept for a disconnected client. Zero keeps sessions forever.
+	SessionExpiry uint32 `yaml:"session_expiry"`
+}
+
+// LimitsConfig protects the broker from misbehaving clients. Zero values
+// disable the corresponding limit.
+type LimitsConfig struct {
+	MaxInflight    int     `yaml:"max_inflight"`     // QoS>0 messages pending per client
+	PublishRate    float64 `yaml:"publish_rate"`     // messages per second per client ID
+	PublishBurst   int     `yaml:"publish_burst"`    // short bursts allowed above the rate
+	MaxPayloadSize int     `yaml:"max_payload_size"` // bytes
+}
+
+// AdminConfig enables the HTTP endpoint serving Prometheus metrics, the
+// client listing and admin actions. Token, when set, is required as a
+// bearer token for everything except /metrics.
+type AdminConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Host    string `yaml:"host"`
+	Port    int    `yaml:"port"`
+	Token   string `yaml:"token"`
+}
+
+// ValidationConfig enables RTK protocol checks on rtk/... publishes.
+type ValidationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Mode decides what happens to invalid messages: "reject" drops them,
+	// "tag" delivers them with rtk-validation user properties (MQTT 5) and
+	// "mirror" delivers them and copies them to rtk/v1/_invalid/...
+	Mode            string `yaml:"mode"`
+	DeviceIDPattern string `yaml:"device_id_pattern"`
+	// SchemaDir enables payload validation against the JSON schemas in the
+	// directory (e.g. rtk_controller/docs/spec/schemas)
+	SchemaDir string `yaml:"schema_dir"`
+}
+
+// Validation modes
+const (
+	ValidationReject = "reject"
+	ValidationTag    = "tag"
+	ValidationMirror = "mirror"
+)
+
+// BridgeConfig connects this broker to an upstream broker. "out" rules
+// forward local messages upstream, "in" rules relay upstream messages
+// (typically cmd/req) back to local subscribers.
+type BridgeConfig struct {
+	Enabled bool               `yaml:"enabled"`
+	Remote  BridgeRemoteConfig `yaml:"remote"`
+	Rules   []BridgeRule       `yaml:"rules"`
+	// BufferSize is the number of outgoing messages kept while the uplink
+	// is down; the oldest are dropped first.
+	BufferSize int `yaml:"buffer_size"`
+	// MinBackoff and MaxBackoff (seconds) bound the reconnect delay.
+	MinBackoff int `yaml:"min_backoff"`
+	MaxBackoff int `yaml:"max_backoff"`
+}
+
+type BridgeRemoteConfig struct {
+	URL                string `yaml:"url"` // tcp://, ssl://, ws:// or wss://
+	ClientID           string `yaml:"client_id"`
+	Username           string `yaml:"username"`
+	Password           string `yaml:"password"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	CleanSession       bool   `yaml:"clean_session"`
+	KeepAlive          int    `yaml:"keep_alive"` // seconds
+}
+
+// BridgeRule maps one topic filter between the brokers. Topic is matched
+// on the source side; LocalPrefix is replaced by RemotePrefix (or the
+// reverse for "in" rules). QoS is used both to subscribe and to publish.
+type BridgeRule struct {
+	Direction    string `yaml:"direction"` // out or in
+	Topic        string `yaml:"topic"`
+	LocalPrefix  string `yaml:"local_prefix"`
+	RemotePrefix string `yaml:"remote_prefix"`
+	QoS          byte   `yaml:"qos"`
+}
+
+// Bridge rule directions
+const (
+	BridgeOut = "out"
+	BridgeIn  = "in"
+)
+
+// Validate checks the bridge settings
+func (b BridgeConfig) Validate() error {
+	if !b.Enabled {
+		return nil
+	}
+	if b.Remote.URL == "" {
+		return fmt.Errorf("bridge: remote.url is required")
+	}
+	if len(b.Rules) == 0 {
+		return fmt.Errorf("bridge: at least one rule is required")
+	}
+	for i, r := range b.Rules {
+		if r.Direction != BridgeOut && r.Direction != BridgeIn {
+			return fmt.Errorf("bridge rule %d: direction must be %q or %q", i, BridgeOut, BridgeIn)
+		}
+		if r.Topic == "" {
+			return fmt.Errorf("bridge rule %d: topic is required", i)
+		}
+		if r.QoS > 2 {
+			return fmt.Errorf("bridge rule %d: invalid qos %d", i, r.QoS)
+		}
+	}
+	return nil
 }
 
 type LoggingConfig struct {
@@ -37,7 +283,33 @@ func LoadConfig(configPath string) (*Config, error) {
 		},
 		Security: SecurityConfig{
 			EnableAuth: false,
-			Users:      []map[string]string{},
+			Users:      []UserConfig{},
+		},
+		Persistence: PersistenceConfig{
+			Enabled: false,
+			DataDir: "data",
+			File:    "rtk_broker.db",
+		},
+		Limits: LimitsConfig{
+			MaxInflight:    1024,
+			PublishRate:    0,
+			PublishBurst:   0,
+			MaxPayloadSize: 256 * 1024,
+		},
+		Admin: AdminConfig{
+			Enabled: false,
+			Host:    "127.0.0.1",
+			Port:    8081,
+		},
+		Validation: ValidationConfig{
+			Enabled: false,
+			Mode:    ValidationReject,
+		},
+		Bridge: BridgeConfig{
+			Enabled:    false,
+			BufferSize: 10000,
+			MinBackoff: 1,
+			MaxBackoff: 60,
 		},
 		Logging: LoggingConfig{
 			Level: "info",
@@ -58,5 +330,13 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := config.Server.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Bridge.Validate(); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
\ No newline at end of file
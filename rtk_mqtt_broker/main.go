@@ -5,21 +5,37 @@ import (
 	"fmt"
 	"os"
 
+	"rtk_mqtt_broker/auth"
 	"rtk_mqtt_broker/broker"
 	"rtk_mqtt_broker/config"
 )
 
 func main() {
 	configPath := flag.String("config", "config/config.yaml", "Path to configuration file")
+	hashPassword := flag.String("hash-password", "", "Print a bcrypt hash for the given password and exit")
 	flag.Parse()
 
+	if *hashPassword != "" {
+		hash, err := auth.HashPassword(*hashPassword)
+		if err != nil {
+			fmt.Printf("Failed to hash password: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(hash)
+		return
+	}
+
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		fmt.Printf("Failed to load config: %v\n", err)
 		os.Exit(1)
 	}
 
-	mqttBroker := broker.New(cfg)
+	mqttBroker, err := broker.New(cfg)
+	if err != nil {
+		fmt.Printf("Failed to create broker: %v\n", err)
+		os.Exit(1)
+	}
 
 	err = mqttBroker.Start()
 	if err != nil {
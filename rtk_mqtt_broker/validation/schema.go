@@ -0,0 +1,143 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// SchemaSet holds the JSON schemas from rtk_controller/docs/spec/schemas,
+// keyed by file name without extension (e.g. "state", "cmd-request").
+type SchemaSet struct {
+	schemas map[string]*gojsonschema.Schema
+}
+
+// LoadSchemaDir compiles every *.json schema found in dir. Relative $ref
+// entries (e.g. "base.json") are resolved against dir.
+func LoadSchemaDir(dir string) (*SchemaSet, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(abs, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no schema files found in %s", dir)
+	}
+
+	// The published schemas carry https://rtk.mqtt/... $id values, which
+	// would make relative $refs resolve remotely. Re-key every document on
+	// its file URL so references stay inside dir.
+	docs := make(map[string]map[string]any, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse schema %s: %w", filepath.Base(file), err)
+		}
+		url := "file://" + filepath.ToSlash(file)
+		doc["$id"] = url
+		docs[url] = doc
+	}
+
+	set := &SchemaSet{schemas: make(map[string]*gojsonschema.Schema)}
+	for _, file := range files {
+		url := "file://" + filepath.ToSlash(file)
+
+		loader := gojsonschema.NewSchemaLoader()
+		for other, doc := range docs {
+			if other != url {
+				if err := loader.AddSchema(other, gojsonschema.NewGoLoader(doc)); err != nil {
+					return nil, fmt.Errorf("failed to register schema %s: %w", filepath.Base(other), err)
+				}
+			}
+		}
+
+		schema, err := loader.Compile(gojsonschema.NewGoLoader(docs[url]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load schema %s: %w", filepath.Base(file), err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		set.schemas[name] = schema
+	}
+
+	return set, nil
+}
+
+// Len returns the number of loaded schemas
+func (s *SchemaSet) Len() int {
+	return len(s.schemas)
+}
+
+// schemaFor picks the most specific schema for a parsed topic, e.g.
+// telemetry/cpu -> telemetry-cpu, falling back to telemetry.
+func (s *SchemaSet) schemaFor(t *Topic) *gojsonschema.Schema {
+	var candidates []string
+
+	switch t.MessageType {
+	case "cmd/req":
+		candidates = []string{"cmd-request"}
+	case "cmd/ack":
+		candidates = []string{"cmd-ack"}
+	case "cmd/res":
+		candidates = []string{"cmd-result"}
+	case "cmd/progress":
+		candidates = []string{"cmd-progress"}
+	default:
+		kind := t.Kind()
+		if sub := strings.TrimPrefix(t.MessageType, kind+"/"); sub != t.MessageType {
+			name := kind + "-" + strings.NewReplacer(".", "-", "_", "-").Replace(sub)
+			candidates = append(candidates, name)
+		}
+		if kind == "evt" {
+			candidates = append(candidates, "event")
+		} else {
+			candidates = append(candidates, kind)
+		}
+	}
+
+	for _, name := range candidates {
+		if schema, ok := s.schemas[name]; ok {
+			return schema
+		}
+	}
+	return nil
+}
+
+// Validate checks payload for a parsed topic. Messages without a matching
+// schema only need to be a JSON object.
+func (s *SchemaSet) Validate(t *Topic, payload []byte) []string {
+	var doc map[string]any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return []string{fmt.Sprintf("payload is not a JSON object: %v", err)}
+	}
+
+	schema := s.schemaFor(t)
+	if schema == nil {
+		return nil
+	}
+
+	result, err := schema.Validate(gojsonschema.NewGoLoader(doc))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	errs := make([]string, 0, len(result.Errors()))
+	for _, e := range result.Errors() {
+		errs = append(errs, e.String())
+	}
+	return errs
+}
@@ -0,0 +1,123 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSchemas mimics the published layout: schemas carry remote $id values
+// and reference base.json relatively.
+var testSchemas = map[string]string{
+	"base.json": `{
+		"$id": "https://rtk.mqtt/schemas/base/1.0",
+		"type": "object",
+		"required": ["schema", "ts"],
+		"properties": {
+			"schema": {"type": "string"},
+			"ts": {"type": "integer", "minimum": 0}
+		}
+	}`,
+	"state.json": `{
+		"$id": "https://rtk.mqtt/schemas/state/1.0",
+		"allOf": [{"$ref": "base.json"}],
+		"properties": {"schema": {"enum": ["state/1.0"]}}
+	}`,
+	"telemetry.json": `{
+		"$id": "https://rtk.mqtt/schemas/telemetry/1.0",
+		"allOf": [{"$ref": "base.json"}],
+		"required": ["payload"]
+	}`,
+	"telemetry-cpu.json": `{
+		"$id": "https://rtk.mqtt/schemas/telemetry-cpu/1.0",
+		"allOf": [{"$ref": "base.json"}],
+		"properties": {"schema": {"enum": ["telemetry.cpu/1.0"]}}
+	}`,
+	"event.json": `{
+		"$id": "https://rtk.mqtt/schemas/event/1.0",
+		"allOf": [{"$ref": "base.json"}],
+		"required": ["severity"]
+	}`,
+	"cmd-request.json": `{
+		"$id": "https://rtk.mqtt/schemas/cmd-request/1.0",
+		"type": "object",
+		"required": ["id", "op"]
+	}`,
+}
+
+func writeTestSchemas(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range testSchemas {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadSchemaDir(t *testing.T) {
+	set, err := LoadSchemaDir(writeTestSchemas(t))
+	if err != nil {
+		t.Fatalf("LoadSchemaDir: %v", err)
+	}
+	if set.Len() != len(testSchemas) {
+		t.Errorf("Len() = %d, want %d", set.Len(), len(testSchemas))
+	}
+
+	if _, err := LoadSchemaDir(t.TempDir()); err == nil {
+		t.Error("LoadSchemaDir accepted a directory without schemas")
+	}
+
+	broken := t.TempDir()
+	if err := os.WriteFile(filepath.Join(broken, "state.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSchemaDir(broken); err == nil {
+		t.Error("LoadSchemaDir accepted an unparsable schema")
+	}
+}
+
+func TestSchemaSet_Validate(t *testing.T) {
+	set, err := LoadSchemaDir(writeTestSchemas(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewTopicValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		topic   string
+		payload string
+		valid   bool
+	}{
+		{"state", "rtk/v1/acme/hq/dev1/state", `{"schema":"state/1.0","ts":1}`, true},
+		{"state wrong schema", "rtk/v1/acme/hq/dev1/state", `{"schema":"attr/1.0","ts":1}`, false},
+		{"base via $ref", "rtk/v1/acme/hq/dev1/state", `{"schema":"state/1.0"}`, false},
+		{"specific schema", "rtk/v1/acme/hq/dev1/telemetry/cpu", `{"schema":"telemetry.cpu/1.0","ts":1}`, true},
+		{"specific over generic", "rtk/v1/acme/hq/dev1/telemetry/cpu", `{"schema":"telemetry.mem/1.0","ts":1,"payload":{}}`, false},
+		{"generic fallback", "rtk/v1/acme/hq/dev1/telemetry/mem", `{"schema":"telemetry.mem/1.0","ts":1}`, false},
+		{"generic fallback valid", "rtk/v1/acme/hq/dev1/telemetry/mem", `{"schema":"telemetry.mem/1.0","ts":1,"payload":{}}`, true},
+		{"evt uses event", "rtk/v1/acme/hq/dev1/evt/wifi.roam", `{"schema":"evt.wifi/1.0","ts":1}`, false},
+		{"command", "rtk/v1/acme/hq/dev1/cmd/req", `{"id":"c1","op":"reboot"}`, true},
+		{"command missing op", "rtk/v1/acme/hq/dev1/cmd/req", `{"id":"c1"}`, false},
+		{"no schema", "rtk/v1/acme/hq/dev1/attr", `{"anything":true}`, true},
+		{"no schema not an object", "rtk/v1/acme/hq/dev1/attr", `[1,2]`, false},
+		{"not json", "rtk/v1/acme/hq/dev1/state", `online`, false},
+	}
+
+	for _, tt := range tests {
+		topic, err := v.Parse(tt.topic)
+		if err != nil {
+			t.Fatalf("%s: Parse(%q): %v", tt.name, tt.topic, err)
+		}
+		errs := set.Validate(topic, []byte(tt.payload))
+		if (len(errs) == 0) != tt.valid {
+			t.Errorf("%s: Validate(%s) = [%s], want valid %t", tt.name, tt.payload, strings.Join(errs, "; "), tt.valid)
+		}
+	}
+}
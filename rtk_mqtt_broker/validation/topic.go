@@ -0,0 +1,183 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Namespace is the versioned root of every RTK topic
+const Namespace = "rtk/v1"
+
+// InvalidPrefix is the topic prefix used to mirror messages that failed
+// validation, e.g. rtk/v1/_invalid/{tenant}/{site}/{device_id}/state
+const InvalidPrefix = Namespace + "/_invalid"
+
+var segmentPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// DefaultDeviceIDPattern accepts MAC based IDs as well as the descriptive
+// IDs used by simulators. Use ^[a-f0-9]{12}$ for strict SPEC compliance.
+const DefaultDeviceIDPattern = `^[A-Za-z0-9][A-Za-z0-9._:-]*$`
+
+// messageTypes lists the message types defined by the SPEC. A true value
+// means the type takes exactly one sub-level (e.g. telemetry/{metric}).
+var messageTypes = map[string]bool{
+	"state":       false,
+	"attr":        false,
+	"lwt":         false,
+	"telemetry":   true,
+	"evt":         true,
+	"topology":    true,
+	"diagnostics": true,
+}
+
+// commandTypes lists the valid cmd/{kind} sub-levels
+var commandTypes = map[string]bool{
+	"req":      true,
+	"ack":      true,
+	"res":      true,
+	"progress": true,
+}
+
+// Topic is a parsed rtk/v1 topic
+type Topic struct {
+	Tenant      string
+	Site        string
+	DeviceID    string
+	Group       string
+	Broadcast   bool
+	Reserved    bool   // device_id segment starts with "_" (e.g. _controller)
+	MessageType string // e.g. "state", "telemetry/cpu", "cmd/req"
+}
+
+// Kind returns the first level of the message type ("telemetry", "cmd" ...)
+func (t *Topic) Kind() string {
+	if i := strings.Index(t.MessageType, "/"); i >= 0 {
+		return t.MessageType[:i]
+	}
+	return t.MessageType
+}
+
+// TopicValidator checks topics against the SPEC hierarchy
+type TopicValidator struct {
+	deviceID *regexp.Regexp
+}
+
+func NewTopicValidator(deviceIDPattern string) (*TopicValidator, error) {
+	if deviceIDPattern == "" {
+		deviceIDPattern = DefaultDeviceIDPattern
+	}
+	re, err := regexp.Compile(deviceIDPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device_id pattern: %w", err)
+	}
+	return &TopicValidator{deviceID: re}, nil
+}
+
+// IsRTKTopic reports whether the topic belongs to the RTK namespace
+func IsRTKTopic(topic string) bool {
+	return topic == "rtk" || strings.HasPrefix(topic, "rtk/")
+}
+
+// Parse validates topic and returns its components
+func (v *TopicValidator) Parse(topic string) (*Topic, error) {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 2 || parts[0] != "rtk" {
+		return nil, fmt.Errorf("topic must start with %s/", Namespace)
+	}
+	if parts[1] != "v1" {
+		return nil, fmt.Errorf("unsupported protocol version %q", parts[1])
+	}
+	rest := parts[2:]
+
+	// rtk/v1/broadcast/cmd/req
+	if len(rest) == 3 && rest[0] == "broadcast" {
+		if rest[1] != "cmd" || rest[2] != "req" {
+			return nil, fmt.Errorf("broadcast topics only carry cmd/req")
+		}
+		return &Topic{Broadcast: true, MessageType: "cmd/req"}, nil
+	}
+
+	if len(rest) < 3 {
+		return nil, fmt.Errorf("expected %s/{tenant}/{site}/{device_id}/{message_type}", Namespace)
+	}
+
+	t := &Topic{Tenant: rest[0]}
+	if !segmentPattern.MatchString(t.Tenant) {
+		return nil, fmt.Errorf("invalid tenant %q", t.Tenant)
+	}
+
+	// rtk/v1/{tenant}/broadcast/cmd/req
+	if rest[1] == "broadcast" && len(rest) == 4 {
+		if rest[2] != "cmd" || rest[3] != "req" {
+			return nil, fmt.Errorf("broadcast topics only carry cmd/req")
+		}
+		t.Broadcast = true
+		t.MessageType = "cmd/req"
+		return t, nil
+	}
+
+	t.Site = rest[1]
+	if !segmentPattern.MatchString(t.Site) {
+		return nil, fmt.Errorf("invalid site %q", t.Site)
+	}
+
+	// rtk/v1/{tenant}/{site}/group/{group_id}/cmd/req
+	if rest[2] == "group" {
+		if len(rest) != 6 || rest[4] != "cmd" || rest[5] != "req" {
+			return nil, fmt.Errorf("group topics must be %s/{tenant}/{site}/group/{group_id}/cmd/req", Namespace)
+		}
+		t.Group = rest[3]
+		if !segmentPattern.MatchString(t.Group) {
+			return nil, fmt.Errorf("invalid group %q", t.Group)
+		}
+		t.MessageType = "cmd/req"
+		return t, nil
+	}
+
+	t.DeviceID = rest[2]
+	if strings.HasPrefix(t.DeviceID, "_") {
+		// Reserved for controller/broker originated topics
+		t.Reserved = true
+		t.MessageType = strings.Join(rest[3:], "/")
+		return t, nil
+	}
+	if !v.deviceID.MatchString(t.DeviceID) {
+		return nil, fmt.Errorf("invalid device_id %q", t.DeviceID)
+	}
+
+	if len(rest) < 4 {
+		return nil, fmt.Errorf("missing message type")
+	}
+	msg := rest[3:]
+	t.MessageType = strings.Join(msg, "/")
+
+	if msg[0] == "cmd" {
+		if len(msg) != 2 || !commandTypes[msg[1]] {
+			return nil, fmt.Errorf("invalid command topic %q", t.MessageType)
+		}
+		return t, nil
+	}
+
+	sub, known := messageTypes[msg[0]]
+	if !known {
+		return nil, fmt.Errorf("unknown message type %q", msg[0])
+	}
+	if sub && (len(msg) != 2 || msg[1] == "") {
+		return nil, fmt.Errorf("message type %s requires exactly one sub-level", msg[0])
+	}
+	if !sub && len(msg) != 1 {
+		return nil, fmt.Errorf("message type %s takes no sub-level", msg[0])
+	}
+
+	return t, nil
+}
+
+// InvalidTopic returns the _invalid mirror topic for topic
+func InvalidTopic(topic string) string {
+	rest := strings.TrimPrefix(topic, Namespace+"/")
+	if rest == topic {
+		rest = strings.TrimPrefix(topic, "rtk/")
+	}
+	return InvalidPrefix + "/" + rest
+}
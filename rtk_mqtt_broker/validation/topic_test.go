@@ -0,0 +1,145 @@
+package validation
+
+import "testing"
+
+func TestTopicValidator_Parse(t *testing.T) {
+	v, err := NewTopicValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		topic string
+		want  *Topic // nil when the topic is invalid
+	}{
+		// Device topics
+		{"rtk/v1/acme/hq/dev1/state", &Topic{Tenant: "acme", Site: "hq", DeviceID: "dev1", MessageType: "state"}},
+		{"rtk/v1/acme/hq/aabbccddeeff/attr", &Topic{Tenant: "acme", Site: "hq", DeviceID: "aabbccddeeff", MessageType: "attr"}},
+		{"rtk/v1/acme/hq/AA:BB:CC:DD:EE:FF/lwt", &Topic{Tenant: "acme", Site: "hq", DeviceID: "AA:BB:CC:DD:EE:FF", MessageType: "lwt"}},
+		{"rtk/v1/acme/hq/dev1/telemetry/cpu", &Topic{Tenant: "acme", Site: "hq", DeviceID: "dev1", MessageType: "telemetry/cpu"}},
+		{"rtk/v1/acme/hq/dev1/evt/wifi.roam_triggered", &Topic{Tenant: "acme", Site: "hq", DeviceID: "dev1", MessageType: "evt/wifi.roam_triggered"}},
+		{"rtk/v1/acme/hq/dev1/cmd/req", &Topic{Tenant: "acme", Site: "hq", DeviceID: "dev1", MessageType: "cmd/req"}},
+		{"rtk/v1/acme/hq/dev1/cmd/progress", &Topic{Tenant: "acme", Site: "hq", DeviceID: "dev1", MessageType: "cmd/progress"}},
+
+		// Broadcast, group and reserved topics
+		{"rtk/v1/broadcast/cmd/req", &Topic{Broadcast: true, MessageType: "cmd/req"}},
+		{"rtk/v1/acme/broadcast/cmd/req", &Topic{Tenant: "acme", Broadcast: true, MessageType: "cmd/req"}},
+		{"rtk/v1/acme/hq/group/aps/cmd/req", &Topic{Tenant: "acme", Site: "hq", Group: "aps", MessageType: "cmd/req"}},
+		{"rtk/v1/acme/hq/_controller/changeset/control", &Topic{Tenant: "acme", Site: "hq", DeviceID: "_controller", Reserved: true, MessageType: "changeset/control"}},
+		{"rtk/v1/acme/hq/_broker", &Topic{Tenant: "acme", Site: "hq", DeviceID: "_broker", Reserved: true}},
+
+		// Namespace and version
+		{"rtk", nil},
+		{"other/v1/acme/hq/dev1/state", nil},
+		{"rtk/v2/acme/hq/dev1/state", nil},
+		{"rtk/v1/acme/hq", nil},
+
+		// Invalid segments
+		{"rtk/v1/Acme/hq/dev1/state", nil},
+		{"rtk/v1/-acme/hq/dev1/state", nil},
+		{"rtk/v1/acme/HQ/dev1/state", nil},
+		{"rtk/v1/acme//dev1/state", nil},
+		{"rtk/v1/acme/hq/dev 1/state", nil},
+		{"rtk/v1/acme/hq/.dev1/state", nil},
+
+		// Invalid message types
+		{"rtk/v1/acme/hq/dev1", nil},
+		{"rtk/v1/acme/hq/dev1/status", nil},
+		{"rtk/v1/acme/hq/dev1/state/extra", nil},
+		{"rtk/v1/acme/hq/dev1/telemetry", nil},
+		{"rtk/v1/acme/hq/dev1/telemetry/", nil},
+		{"rtk/v1/acme/hq/dev1/telemetry/cpu/core0", nil},
+		{"rtk/v1/acme/hq/dev1/cmd", nil},
+		{"rtk/v1/acme/hq/dev1/cmd/reply", nil},
+		{"rtk/v1/acme/hq/dev1/cmd/req/extra", nil},
+
+		// Invalid broadcast and group topics
+		{"rtk/v1/broadcast/cmd/res", nil},
+		{"rtk/v1/acme/broadcast/state/x", nil},
+		{"rtk/v1/acme/hq/group/aps/state", nil},
+		{"rtk/v1/acme/hq/group/APs/cmd/req", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := v.Parse(tt.topic)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("Parse(%q) = %+v, want an error", tt.topic, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", tt.topic, err)
+			continue
+		}
+		if *got != *tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestTopicValidator_StrictDeviceID(t *testing.T) {
+	v, err := NewTopicValidator(`^[a-f0-9]{12}$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		topic string
+		valid bool
+	}{
+		{"rtk/v1/acme/hq/aabbccddeeff/state", true},
+		{"rtk/v1/acme/hq/dev1/state", false},
+		{"rtk/v1/acme/hq/AABBCCDDEEFF/state", false},
+		// Reserved IDs are not subject to the device_id pattern
+		{"rtk/v1/acme/hq/_controller/state", true},
+	}
+
+	for _, tt := range tests {
+		if _, err := v.Parse(tt.topic); (err == nil) != tt.valid {
+			t.Errorf("Parse(%q) error = %v, want valid %t", tt.topic, err, tt.valid)
+		}
+	}
+
+	if _, err := NewTopicValidator("["); err == nil {
+		t.Error("NewTopicValidator accepted an invalid pattern")
+	}
+}
+
+func TestIsRTKTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  bool
+	}{
+		{"rtk", true},
+		{"rtk/v1/acme/hq/dev1/state", true},
+		{"rtk/v2/anything", true},
+		{"rtkx/v1", false},
+		{"$SYS/broker/uptime", false},
+		{"home/livingroom", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRTKTopic(tt.topic); got != tt.want {
+			t.Errorf("IsRTKTopic(%q) = %t, want %t", tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestInvalidTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  string
+	}{
+		{"rtk/v1/acme/hq/dev1/state", "rtk/v1/_invalid/acme/hq/dev1/state"},
+		{"rtk/v1/acme/hq/dev1/telemetry/cpu", "rtk/v1/_invalid/acme/hq/dev1/telemetry/cpu"},
+		{"rtk/v2/acme/hq/dev1/state", "rtk/v1/_invalid/v2/acme/hq/dev1/state"},
+		{"rtk/acme", "rtk/v1/_invalid/acme"},
+	}
+
+	for _, tt := range tests {
+		if got := InvalidTopic(tt.topic); got != tt.want {
+			t.Errorf("InvalidTopic(%q) = %q, want %q", tt.topic, got, tt.want)
+		}
+	}
+}